@@ -51,6 +51,12 @@ func (c *DNSCache) getShard(key string) *cacheShard {
 
 // Add adds a DNS message to the cache with a given TTL.
 func (c *DNSCache) Add(key string, msg *dns.Msg, ttl time.Duration, isNegative bool) {
+	if msg != nil && msg.Truncated {
+		// A truncated response is incomplete; never let it poison the cache
+		// for a subsequent query that might get the full answer.
+		return
+	}
+
 	shard := c.getShard(key)
 	shard.mu.Lock()
 	defer shard.mu.Unlock()
@@ -24,10 +24,22 @@ func NewCachingResolver(cache *ShardedCache, resolver *resolver.Resolver) *Cachi
 
 // Exchange performs a DNS query, using the cache first.
 func (r *CachingResolver) Exchange(ctx context.Context, msg *dns.Msg) (*dns.Msg, error) {
-	cacheKey := msg.Question[0].Name + ":" + dns.TypeToString[msg.Question[0].Qtype]
+	do := false
+	if opt := msg.IsEdns0(); opt != nil {
+		do = opt.Do()
+	}
+	cd := msg.CheckingDisabled
+	cacheKey := CacheKey{
+		Qname:  msg.Question[0].Name,
+		Qtype:  msg.Question[0].Qtype,
+		Qclass: msg.Question[0].Qclass,
+		DO:     do,
+		CD:     cd,
+	}
 
 	// Try to get the response from cache
-	if cachedMsg, found, isNegative, _ := r.cache.Get(cacheKey); found {
+	cachedMsg, found, isNegative, _, stale := r.cache.Get(cacheKey)
+	if found {
 		if isNegative {
 			log.Printf("Cache HIT (negative) for %s", cacheKey)
 			m := new(dns.Msg)
@@ -45,9 +57,16 @@ func (r *CachingResolver) Exchange(ctx context.Context, msg *dns.Msg) (*dns.Msg,
 	upstreamMsg.SetQuestion(msg.Question[0].Name, msg.Question[0].Qtype)
 	upstreamMsg.SetEdns0(4096, true)
 
-	result := r.resolver.Exchange(ctx, upstreamMsg)
+	upstreamCtx, cancel := context.WithTimeout(ctx, 1800*time.Millisecond)
+	defer cancel()
+
+	result := r.resolver.Exchange(upstreamCtx, upstreamMsg)
 	if result.Err != nil {
 		log.Printf("Error exchanging DNS query: %v", result.Err)
+		if stale && cachedMsg != nil {
+			log.Printf("Serving stale entry for %s after upstream failure: %v", cacheKey, result.Err)
+			return r.staleAnswer(msg, cachedMsg), nil
+		}
 		if r.cache.config.NegativeCacheEnabled {
 			ttl := time.Duration(r.cache.config.NegativeTTLSecs) * time.Second
 			r.cache.Set(cacheKey, nil, ttl, true, false)
@@ -68,7 +68,7 @@ func TestCachingResolverCacheHit(t *testing.T) {
 	rr, _ := dns.NewRR(qname + " 60 IN A 1.2.3.4")
 	msg.Answer = append(msg.Answer, rr)
 
-	shardedCache.Set(qname+":"+dns.TypeToString[qtype], msg, 60*time.Second, false, true)
+	shardedCache.Set(CacheKey{Qname: qname, Qtype: qtype, Qclass: dns.ClassINET}, msg, 60*time.Second, false, true)
 
 	// The underlying resolver should not be called.
 	baseResolver := resolver.NewResolver()
@@ -129,7 +129,7 @@ func TestCachingResolverCacheMiss(t *testing.T) {
 		t.Errorf("Expected a non-success Rcode, got %s", dns.RcodeToString[resp.Rcode])
 	}
 
-	cacheKey := qname + ":" + dns.TypeToString[dns.TypeA]
+	cacheKey := CacheKey{Qname: qname, Qtype: dns.TypeA, Qclass: dns.ClassINET}
 	_, found, isNegative, _ := shardedCache.Get(cacheKey)
 
 	if !found {
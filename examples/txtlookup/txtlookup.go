@@ -1,28 +1,45 @@
 package main
 
 import (
+	"encoding/json"
+	"flag"
 	"fmt"
 	"log"
-	"os"
 
 	"github.com/miekg/dns"
+
 	goresolver "github.com/peterzen/goresolver"
 )
 
 func main() {
+	trace := flag.Bool("trace", false, "print each hop taken during resolution, like dig +trace, instead of just the final answer")
+	flag.Parse()
+
 	// Initialize the resolver with the system's resolv.conf
 	res, err := goresolver.NewResolver("/etc/resolv.conf")
 	if err != nil {
 		log.Fatalf("Failed to initialize resolver: %v", err)
 	}
-	goresolver.CurrentResolver = res // Set the global resolver instance
 
 	qname := "google.com"
 	qtype := dns.TypeTXT
 
+	if *trace {
+		steps, err := res.Trace(qname, qtype)
+		if err != nil {
+			log.Fatalf("Error tracing DNS resolution: %v", err)
+		}
+		out, err := json.MarshalIndent(steps, "", "  ")
+		if err != nil {
+			log.Fatalf("Error encoding trace: %v", err)
+		}
+		fmt.Println(string(out))
+		return
+	}
+
 	fmt.Printf("Looking up %s (type %s) using goresolver...\n", qname, dns.TypeToString[qtype])
 
-	msg, err := goresolver.CurrentResolver.Query(qname, qtype)
+	msg, err := res.Query(qname, qtype)
 	if err != nil {
 		log.Fatalf("Error querying DNS: %v", err)
 	}
@@ -38,4 +55,4 @@ func main() {
 			fmt.Printf("  %s\n", t.String())
 		}
 	}
-}
\ No newline at end of file
+}
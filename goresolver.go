@@ -1,13 +1,23 @@
 package goresolver
 
 import (
+	"context"
+	"encoding/json"
 	"errors"
+	"fmt"
 	"log"
 	"net"
+	"net/http"
+	"sort"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/miekg/dns"
+
+	"dns-resolver/internal/cache/persistent"
+	"dns-resolver/internal/metrics"
+	"dns-resolver/internal/workerpool"
 )
 
 var (
@@ -54,8 +64,131 @@ type Resolver struct {
 	dnsClient    *dns.Client
 	rootServers  []string
 	trustAnchors map[string][]*dns.DNSKEY
-	// Add a cache for validated DNSKEYs to avoid re-validation
-	dnskeyCache map[string][]*dns.DNSKEY
+
+	// zoneCacheMu guards zoneCache, which caches each zone's validated
+	// signedZone for signedZoneCacheTTL so repeated queries under the same
+	// zone skip re-fetching and re-validating its DNSKEY/DS chain.
+	zoneCacheMu sync.RWMutex
+	zoneCache   map[string]zoneCacheEntry
+
+	// persistentCache, if set via SetPersistentCache, is consulted before
+	// zoneCache falls back to the network, and is populated with whatever
+	// zoneCache validates. It lets the delegation graph survive a restart
+	// instead of being rebuilt from the root down on every cold start.
+	persistentCache *persistent.Cache
+	cacheMaxTTL     time.Duration
+
+	// rankMu guards serverRanks, the per-zone EWMA-RTT/failure ranking
+	// table queryAuthoritativeServers uses to order its fanout and to
+	// blacklist repeatedly-failing servers for serverCooldown.
+	rankMu      sync.RWMutex
+	serverRanks map[string]map[string]*serverRank
+
+	// queryFanout is how many of a zone's authoritative servers
+	// queryAuthoritativeServers queries in parallel; 0 means
+	// defaultQueryFanout.
+	queryFanout int
+	// serverFailureThreshold is how many consecutive failures blacklist a
+	// server for serverCooldown; 0 means defaultServerFailureThreshold.
+	serverFailureThreshold int
+	// serverCooldown is how long a blacklisted server is skipped once
+	// serverFailureThreshold is reached; 0 means defaultServerCooldown.
+	serverCooldown time.Duration
+
+	// workerPool, if set via SetWorkerPool, bounds queryAuthoritativeServers'
+	// fanout queries against a shared concurrency budget instead of one
+	// bare goroutine per server.
+	workerPool *workerpool.Pool
+	// metrics, if set via SetMetrics, receives per-server RTT and outcome
+	// observations from queryAuthoritativeServers.
+	metrics *metrics.Metrics
+}
+
+const (
+	// defaultQueryFanout is how many authoritative servers
+	// queryAuthoritativeServers queries in parallel when queryFanout isn't
+	// set.
+	defaultQueryFanout = 3
+	// defaultServerFailureThreshold is how many consecutive failures
+	// blacklist a server when serverFailureThreshold isn't set.
+	defaultServerFailureThreshold = 3
+	// defaultServerCooldown is how long a blacklisted server is skipped
+	// when serverCooldown isn't set.
+	defaultServerCooldown = 30 * time.Second
+	// serverRankEWMAWeight is the weight given to the newest RTT sample
+	// when folding it into a server's EWMA.
+	serverRankEWMAWeight = 0.3
+)
+
+// serverRank tracks one authoritative server's recent performance within a
+// zone: an EWMA of its RTT (so the fastest historical servers sort first,
+// à la Unbound's infra cache), and a consecutive-failure count that
+// blacklists it for serverCooldown once it crosses serverFailureThreshold.
+type serverRank struct {
+	ewmaRTT          time.Duration
+	consecutiveFails int
+	blacklistedUntil time.Time
+}
+
+// ServerRank is a read-only snapshot of one server's ranking within a zone,
+// returned by ServerRankings for debugging and monitoring.
+type ServerRank struct {
+	Server           string        `json:"server"`
+	EWMARTT          time.Duration `json:"ewma_rtt"`
+	ConsecutiveFails int           `json:"consecutive_fails"`
+	Blacklisted      bool          `json:"blacklisted"`
+}
+
+// fanoutJob adapts a plain func() into a workerpool.Job so
+// queryAuthoritativeServers' parallel queries can be bounded by a shared
+// worker pool when one is attached.
+type fanoutJob func()
+
+func (j fanoutJob) Execute() { j() }
+
+// SetWorkerPool attaches the pool queryAuthoritativeServers' fanout queries
+// run on. Without one (or if the pool's queue is full), a query just runs
+// on a bare goroutine instead.
+func (r *Resolver) SetWorkerPool(p *workerpool.Pool) {
+	r.workerPool = p
+}
+
+// SetMetrics attaches a Metrics instance so queryAuthoritativeServers'
+// per-server RTT and outcome are exported as Prometheus series.
+func (r *Resolver) SetMetrics(m *metrics.Metrics) {
+	r.metrics = m
+}
+
+// SetPersistentCache attaches an on-disk cache of zone-cut and NS-resolution
+// results to r. maxTTL caps how long an entry already capped by the
+// persistent cache's own configuration is still trusted once read back; pass
+// 0 to defer entirely to the cache's own expiry. It's a setter rather than a
+// NewResolver parameter so existing callers that construct a Resolver
+// without a persistent cache don't need to change.
+func (r *Resolver) SetPersistentCache(c *persistent.Cache, maxTTL time.Duration) {
+	r.persistentCache = c
+	r.cacheMaxTTL = maxTTL
+}
+
+// zoneCacheTTL returns how long a zone written to persistentCache should be
+// trusted for, falling back to signedZoneCacheTTL when SetPersistentCache
+// wasn't given an explicit maxTTL.
+func (r *Resolver) zoneCacheTTL() time.Duration {
+	if r.cacheMaxTTL > 0 {
+		return r.cacheMaxTTL
+	}
+	return signedZoneCacheTTL
+}
+
+// signedZoneCacheTTL bounds how long a validated signedZone is reused
+// before BuildDelegationChain fetches and validates it again.
+const signedZoneCacheTTL = 5 * time.Minute
+
+// zoneCacheEntry is one cached, already-validated signedZone plus the time
+// it expires at.
+type zoneCacheEntry struct {
+	zone      *signedZone
+	expiresAt time.Time
 }
 
 // DNSResult represents the result of a DNS query
@@ -64,6 +197,9 @@ type DNSResult struct {
 	Err     error
 	AuthNS  []*dns.NS
 	Glue    []dns.RR
+	// Server is the address of the server that produced Msg, or the last
+	// one attempted if every server in the set failed.
+	Server string
 }
 
 // NewDNSMessage creates and initializes a dns.Msg object, with EDNS enabled
@@ -84,7 +220,7 @@ func (r *Resolver) Query(name string, qtype uint16) (*dns.Msg, error) {
 	}
 
 	// Start iterative resolution from root
-	result, err := r.iterativeResolve(name, qtype, true)
+	result, err := r.iterativeResolve(name, qtype, true, nil)
 	if err != nil {
 		if errors.Is(err, ErrDNSSECValidationFailed) {
 			// If DNSSEC validation failed, return SERVFAIL
@@ -98,8 +234,68 @@ func (r *Resolver) Query(name string, qtype uint16) (*dns.Msg, error) {
 	return result.Msg, result.Err
 }
 
-// iterativeResolve performs iterative DNS resolution
-func (r *Resolver) iterativeResolve(name string, qtype uint16, dnssec bool) (*DNSResult, error) {
+// TraceStep is one hop of Resolver.Trace's walk through the iterative
+// resolution of a name, mirroring what "dig +trace" prints interactively.
+// It's JSON-serializable so operators can pipe a trace into diagnostics
+// tooling instead of grepping log.Printf output.
+type TraceStep struct {
+	Zone              string        `json:"zone"`
+	Server            string        `json:"server,omitempty"`
+	RTT               time.Duration `json:"rtt"`
+	Rcode             string        `json:"rcode"`
+	NS                []string      `json:"ns,omitempty"`
+	Glue              []string      `json:"glue,omitempty"`
+	DNSSECValidated   bool          `json:"dnssec_validated"`
+	DNSSECError       string        `json:"dnssec_error,omitempty"`
+	AuthenticatedData bool          `json:"authenticated_data"`
+}
+
+// Trace resolves name the same way Query does, but returns the ordered
+// list of hops taken along the way instead of just the final answer.
+func (r *Resolver) Trace(name string, qtype uint16) ([]TraceStep, error) {
+	if name == "" {
+		return nil, ErrInvalidQuery
+	}
+
+	var steps []TraceStep
+	_, err := r.iterativeResolve(name, qtype, true, &steps)
+	if err != nil && !errors.Is(err, ErrDNSSECValidationFailed) {
+		return steps, err
+	}
+	return steps, nil
+}
+
+// newTraceStep builds the TraceStep for one queryAuthoritativeServers call.
+// DNSSECValidated/DNSSECError are left at their zero values here; the
+// DNSSEC-validation branch of iterativeResolve fills them in once it knows
+// the outcome.
+func newTraceStep(zone string, result *DNSResult, rtt time.Duration) TraceStep {
+	step := TraceStep{
+		Zone:   zone,
+		Server: result.Server,
+		RTT:    rtt,
+	}
+	if result.Msg != nil {
+		step.Rcode = dns.RcodeToString[result.Msg.Rcode]
+		step.AuthenticatedData = result.Msg.AuthenticatedData
+	} else if result.Err != nil {
+		step.Rcode = result.Err.Error()
+	}
+	return step
+}
+
+// appendTraceStep appends step to *trace if trace is non-nil.
+func appendTraceStep(trace *[]TraceStep, step TraceStep) {
+	if trace == nil {
+		return
+	}
+	*trace = append(*trace, step)
+}
+
+// iterativeResolve performs iterative DNS resolution. When trace is
+// non-nil, one TraceStep is appended to it per hop (including hops taken
+// while recursively resolving a referred-to NS's own address).
+func (r *Resolver) iterativeResolve(name string, qtype uint16, dnssec bool, trace *[]TraceStep) (*DNSResult, error) {
 	// Start with root servers
 	currentServers := r.rootServers
 	
@@ -117,12 +313,15 @@ func (r *Resolver) iterativeResolve(name string, qtype uint16, dnssec bool) (*DN
 		log.Printf("Iteration %d: Current domain: %s", iterations, currentDomain)
 		
 		// Query current servers for the target
+		queryStart := time.Now()
 		result := r.queryAuthoritativeServers(currentServers, currentDomain, qtype, dnssec)
-		
+		step := newTraceStep(currentDomain, result, time.Since(queryStart))
+
 		// If we got a direct answer for our target, return it
 		if result.Msg != nil && (result.Msg.Rcode == dns.RcodeSuccess || result.Msg.Rcode == dns.RcodeNameError) {
 			if isFinalAnswer(currentDomain, name) {
 				log.Printf("Got final answer at iteration %d", iterations)
+				appendTraceStep(trace, step)
 				return result, nil
 			}
 		}
@@ -151,6 +350,16 @@ func (r *Resolver) iterativeResolve(name string, qtype uint16, dnssec bool) (*DN
 			// If we found NS records, update our server list
 			if len(nsRecords) > 0 {
 				log.Printf("Found NS records for %s: %d records", currentDomain, len(nsRecords))
+				for _, ns := range nsRecords {
+					step.NS = append(step.NS, ns.Ns)
+				}
+				for _, glue := range glueRecords {
+					if a, ok := glue.(*dns.A); ok {
+						step.Glue = append(step.Glue, a.A.String())
+					} else if aaaa, ok := glue.(*dns.AAAA); ok {
+						step.Glue = append(step.Glue, aaaa.AAAA.String())
+					}
+				}
 				
 				// Get IP addresses for NS servers
 				var newServers []string
@@ -174,53 +383,56 @@ func (r *Resolver) iterativeResolve(name string, qtype uint16, dnssec bool) (*DN
 					
 					// If no glue, we need to resolve the NS name
 					if !foundGlue {
+						if addrs, ok := r.nsAddrsFromCache(ns.Ns); ok {
+							newServers = append(newServers, addrs...)
+							log.Printf("Resolved NS %s from persistent cache: %v", ns.Ns, addrs)
+							continue
+						}
+
 						log.Printf("No glue record for NS %s, resolving iteratively", ns.Ns)
-						nsResult, err := r.iterativeResolve(trimDot(ns.Ns), dns.TypeA, dnssec)
+						nsResult, err := r.iterativeResolve(trimDot(ns.Ns), dns.TypeA, dnssec, trace)
 						if err == nil && nsResult.Msg != nil && nsResult.Msg.Rcode == dns.RcodeSuccess {
+							var addrs []string
 							for _, rr := range nsResult.Msg.Answer {
 								if a, ok := rr.(*dns.A); ok {
-									newServers = append(newServers, a.A.String())
+									addrs = append(addrs, a.A.String())
 									log.Printf("Resolved NS %s to %s", ns.Ns, a.A.String())
 								} else if aaaa, ok := rr.(*dns.AAAA); ok {
-									newServers = append(newServers, aaaa.AAAA.String())
+									addrs = append(addrs, aaaa.AAAA.String())
 									log.Printf("Resolved NS %s to %s", ns.Ns, aaaa.AAAA.String())
 								}
 							}
+							newServers = append(newServers, addrs...)
+							r.cacheNSAddrs(ns.Ns, addrs, nsResult.Msg)
 						} else {
 							log.Printf("Failed to resolve NS name %s: %v", ns.Ns, err)
 						}
 					}
 				}
 				
-				// DNSSEC: Fetch DS records from the parent zone (current authoritative servers)
-				var parentDS []*dns.DS
+				// DNSSEC: build and validate the full delegation chain from
+				// the root down to currentDomain. BuildDelegationChain fans
+				// out one fetch per zone in that chain instead of the
+				// one-zone-at-a-time walk this used to do here, and caches
+				// each validated zone so later iterations (and later
+				// queries under the same zone) don't refetch it.
 				if dnssec {
-					dsResult := r.queryAuthoritativeServers(currentServers, currentDomain, dns.TypeDS, dnssec)
-					if dsResult.Msg != nil && dsResult.Msg.Rcode == dns.RcodeSuccess {
-						for _, rr := range dsResult.Msg.Answer {
-							if ds, ok := rr.(*dns.DS); ok {
-								parentDS = append(parentDS, ds)
-							}
-						}
-					}
-					
-					// Validate delegation if DS records are present
-					if len(parentDS) > 0 || currentDomain == "." {
-						// For root, we don't have parent DS, but we still want to validate DNSKEYs
-						_, err := r.QueryDelegation(currentDomain, parentDS, dnssec)
-						if err != nil {
-							log.Printf("DNSSEC validation failed for delegation %s: %v", currentDomain, err)
-							return &DNSResult{Msg: nil, Err: ErrDNSSECValidationFailed}, nil
-						}
+					if _, err := r.BuildDelegationChain(currentDomain); err != nil {
+						log.Printf("DNSSEC validation failed for delegation %s: %v", currentDomain, err)
+						step.DNSSECError = err.Error()
+						appendTraceStep(trace, step)
+						return &DNSResult{Msg: nil, Err: ErrDNSSECValidationFailed}, nil
 					}
+					step.DNSSECValidated = true
 				}
-				
+				appendTraceStep(trace, step)
+
 				if len(newServers) > 0 {
 					currentServers = newServers
 				} else {
 					log.Printf("No servers found from NS records, using previous servers")
 				}
-				
+
 				// Move to the next level down (closer to our target)
 				nextDomain := getNextDomain(currentDomain, name)
 				if nextDomain != currentDomain {
@@ -229,12 +441,16 @@ func (r *Resolver) iterativeResolve(name string, qtype uint16, dnssec bool) (*DN
 					continue
 				} else {
 					// We can't go further down, try to get the actual record now
+					queryStart := time.Now()
 					finalResult := r.queryAuthoritativeServers(currentServers, name, qtype, dnssec)
+					appendTraceStep(trace, newTraceStep(name, finalResult, time.Since(queryStart)))
 					return finalResult, finalResult.Err
 				}
 			}
 		}
-		
+
+		appendTraceStep(trace, step)
+
 		// If we get here, try to get closer to the target domain
 		nextDomain := getNextDomain(currentDomain, name)
 		if nextDomain != currentDomain {
@@ -243,7 +459,9 @@ func (r *Resolver) iterativeResolve(name string, qtype uint16, dnssec bool) (*DN
 			continue
 		} else {
 			// Try final query
+			queryStart := time.Now()
 			finalResult := r.queryAuthoritativeServers(currentServers, name, qtype, dnssec)
+			appendTraceStep(trace, newTraceStep(name, finalResult, time.Since(queryStart)))
 			return finalResult, finalResult.Err
 		}
 	}
@@ -251,45 +469,221 @@ func (r *Resolver) iterativeResolve(name string, qtype uint16, dnssec bool) (*DN
 	return &DNSResult{Msg: nil, Err: ErrMaxIterations}, nil
 }
 
-// queryAuthoritativeServers queries a set of authoritative servers
+// queryAuthoritativeServers queries name/qtype against up to queryFanout of
+// servers in parallel, ranked by rankedServers so the historically fastest
+// (and not currently blacklisted) servers for this zone go first. It
+// returns as soon as one gives a definitive answer, cancelling the rest of
+// the fanout; every response, successful or not, updates that server's
+// ranking via recordServerResult.
 func (r *Resolver) queryAuthoritativeServers(servers []string, name string, qtype uint16, dnssec bool) *DNSResult {
+	zone := dns.Fqdn(name)
+	fanout := r.queryFanout
+	if fanout <= 0 {
+		fanout = defaultQueryFanout
+	}
+
+	ranked := r.rankedServers(zone, servers)
+	if len(ranked) > fanout {
+		ranked = ranked[:fanout]
+	}
+
+	log.Printf("Querying servers %v for %s (type %s)", ranked, name, dns.TypeToString[qtype])
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	type queryOutcome struct {
+		server string
+		msg    *dns.Msg
+		rtt    time.Duration
+		err    error
+	}
+	outcomes := make(chan queryOutcome, len(ranked))
+
+	var wg sync.WaitGroup
+	for _, server := range ranked {
+		server := server
+		wg.Add(1)
+		run := func() {
+			defer wg.Done()
+			addr := net.JoinHostPort(server, "53")
+			msg := NewDNSMessage(name, qtype)
+
+			log.Printf("Sending query to %s", addr)
+			start := time.Now()
+			response, _, err := r.dnsClient.ExchangeContext(ctx, msg, addr)
+			outcomes <- queryOutcome{server: addr, msg: response, rtt: time.Since(start), err: err}
+		}
+		if r.workerPool == nil || r.workerPool.TrySubmit(fanoutJob(run)) != nil {
+			go run()
+		}
+	}
+	go func() {
+		wg.Wait()
+		close(outcomes)
+	}()
+
 	result := &DNSResult{}
-	
-	log.Printf("Querying servers %v for %s (type %s)", servers, name, dns.TypeToString[qtype])
-	
-	for _, server := range servers {
-		addr := net.JoinHostPort(server, "53")
-		msg := NewDNSMessage(name, qtype)
-		
-		log.Printf("Sending query to %s", addr)
-		response, _, err := r.dnsClient.Exchange(msg, addr)
-		if err == nil && response != nil {
-			log.Printf("Got response from %s, Rcode: %s", addr, dns.RcodeToString[response.Rcode])
-			result.Msg = response
-			
-			// Collect NS records from the response
-			for _, rr := range response.Ns {
-				if ns, ok := rr.(*dns.NS); ok {
-					result.AuthNS = append(result.AuthNS, ns)
-				}
+	for outcome := range outcomes {
+		success := outcome.err == nil && outcome.msg != nil
+		r.recordServerResult(zone, outcome.server, outcome.rtt, success)
+
+		if !success {
+			if outcome.err != nil && outcome.err != context.Canceled {
+				log.Printf("Error querying %s: %v", outcome.server, outcome.err)
 			}
-			
-			result.Glue = append(result.Glue, response.Extra...)
-			
-			// If we got a definitive answer, return it
-			if response.Rcode == dns.RcodeSuccess || response.Rcode == dns.RcodeNameError {
-				log.Printf("Got definitive answer from %s", addr)
-				return result
+			continue
+		}
+
+		log.Printf("Got response from %s, Rcode: %s", outcome.server, dns.RcodeToString[outcome.msg.Rcode])
+
+		result.Msg = outcome.msg
+		result.Server = outcome.server
+		result.AuthNS = nil
+		result.Glue = nil
+		for _, rr := range outcome.msg.Ns {
+			if ns, ok := rr.(*dns.NS); ok {
+				result.AuthNS = append(result.AuthNS, ns)
 			}
-		} else if err != nil {
-			log.Printf("Error querying %s: %v", addr, err)
+		}
+		result.Glue = append(result.Glue, outcome.msg.Extra...)
+
+		if outcome.msg.Rcode == dns.RcodeSuccess || outcome.msg.Rcode == dns.RcodeNameError {
+			log.Printf("Got definitive answer from %s", outcome.server)
+			cancel() // we have our answer; stop the rest of the fanout
+			break
 		}
 	}
-	
-	result.Err = ErrNsNotAvailable
+
+	if result.Msg == nil {
+		result.Err = ErrNsNotAvailable
+	}
 	return result
 }
 
+// rankedServers orders servers by ascending EWMA RTT within zone, moving
+// any still-blacklisted server to the back instead of dropping it, so a
+// zone with every server currently in cooldown is still queried. Servers
+// with no ranking yet (never queried, or queried but not yet returned) keep
+// their relative order from the input slice.
+func (r *Resolver) rankedServers(zone string, servers []string) []string {
+	r.rankMu.RLock()
+	zoneRanks := r.serverRanks[zone]
+	r.rankMu.RUnlock()
+
+	if zoneRanks == nil {
+		return servers
+	}
+
+	now := time.Now()
+	ranked := make([]string, len(servers))
+	copy(ranked, servers)
+	sort.SliceStable(ranked, func(i, j int) bool {
+		ri, rj := zoneRanks[ranked[i]], zoneRanks[ranked[j]]
+		iBlacklisted := ri != nil && now.Before(ri.blacklistedUntil)
+		jBlacklisted := rj != nil && now.Before(rj.blacklistedUntil)
+		if iBlacklisted != jBlacklisted {
+			return !iBlacklisted
+		}
+		var iRTT, jRTT time.Duration
+		if ri != nil {
+			iRTT = ri.ewmaRTT
+		}
+		if rj != nil {
+			jRTT = rj.ewmaRTT
+		}
+		if iRTT == 0 || jRTT == 0 {
+			return iRTT != 0 // a server with a known RTT sorts ahead of one with none
+		}
+		return iRTT < jRTT
+	})
+	return ranked
+}
+
+// recordServerResult updates server's ranking within zone after one query:
+// folding rtt into its EWMA on success, or incrementing its consecutive
+// failure count (blacklisting it for serverCooldown once that reaches
+// serverFailureThreshold) on failure.
+func (r *Resolver) recordServerResult(zone, server string, rtt time.Duration, success bool) {
+	if r.metrics != nil {
+		r.metrics.ObserveAuthServerRTT(zone, server, rtt)
+		r.metrics.IncrementAuthServerOutcome(zone, server, success)
+	}
+
+	r.rankMu.Lock()
+	defer r.rankMu.Unlock()
+
+	zoneRanks := r.serverRanks[zone]
+	if zoneRanks == nil {
+		zoneRanks = make(map[string]*serverRank)
+		r.serverRanks[zone] = zoneRanks
+	}
+	rank := zoneRanks[server]
+	if rank == nil {
+		rank = &serverRank{}
+		zoneRanks[server] = rank
+	}
+
+	if success {
+		if rank.ewmaRTT == 0 {
+			rank.ewmaRTT = rtt
+		} else {
+			rank.ewmaRTT = time.Duration(serverRankEWMAWeight*float64(rtt) + (1-serverRankEWMAWeight)*float64(rank.ewmaRTT))
+		}
+		rank.consecutiveFails = 0
+		rank.blacklistedUntil = time.Time{}
+		return
+	}
+
+	rank.consecutiveFails++
+	failureThreshold := r.serverFailureThreshold
+	if failureThreshold <= 0 {
+		failureThreshold = defaultServerFailureThreshold
+	}
+	if rank.consecutiveFails >= failureThreshold {
+		cooldown := r.serverCooldown
+		if cooldown <= 0 {
+			cooldown = defaultServerCooldown
+		}
+		rank.blacklistedUntil = time.Now().Add(cooldown)
+	}
+}
+
+// ServerRankings returns a snapshot of every server's ranking within zone,
+// for a debug/monitoring endpoint. An unknown zone returns nil.
+func (r *Resolver) ServerRankings(zone string) []ServerRank {
+	r.rankMu.RLock()
+	defer r.rankMu.RUnlock()
+
+	zoneRanks := r.serverRanks[dns.Fqdn(zone)]
+	if zoneRanks == nil {
+		return nil
+	}
+
+	now := time.Now()
+	out := make([]ServerRank, 0, len(zoneRanks))
+	for server, rank := range zoneRanks {
+		out = append(out, ServerRank{
+			Server:           server,
+			EWMARTT:          rank.ewmaRTT,
+			ConsecutiveFails: rank.consecutiveFails,
+			Blacklisted:      now.Before(rank.blacklistedUntil),
+		})
+	}
+	return out
+}
+
+// ServerRankingsHandler is an http.HandlerFunc exposing ServerRankings as
+// JSON for the zone named by the "zone" query parameter. goresolver runs no
+// HTTP server of its own; this lets a caller that does mount it as a debug
+// endpoint.
+func (r *Resolver) ServerRankingsHandler(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(r.ServerRankings(req.URL.Query().Get("zone"))); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
 // isFinalAnswer checks if we've reached the final answer for our query
 func isFinalAnswer(currentDomain, targetDomain string) bool {
 	return dns.Fqdn(targetDomain) == currentDomain || dns.IsSubDomain(currentDomain, dns.Fqdn(targetDomain))
@@ -350,8 +744,9 @@ func NewResolver(resolvConf string) (res *Resolver, err error) {
 	
 	// Initialize trust anchors (simplified)
 	resolver.trustAnchors = make(map[string][]*dns.DNSKEY)
-	resolver.dnskeyCache = make(map[string][]*dns.DNSKEY)
-	
+	resolver.zoneCache = make(map[string]zoneCacheEntry)
+	resolver.serverRanks = make(map[string]map[string]*serverRank)
+
 	log.Printf("Initialized resolver with %d root servers", len(resolver.rootServers))
 	
 	return resolver, nil
@@ -418,93 +813,148 @@ func (r *Resolver) ResolvePTR(name string) (*dns.Msg, error) {
 	return r.Query(name, dns.TypePTR)
 }
 
-// QueryDelegation performs DNSSEC validation for a delegated zone.
-// It fetches DS records from the parent, DNSKEYs from the child, and validates them.
-// Returns the validated DNSKEYs for the child zone if successful.
+// QueryDelegation performs DNSSEC validation for a single delegated zone:
+// it fetches DNSKEYs from the zone, validates them against their own
+// self-signed KSK, and (if parentDS is non-empty) validates that KSK's
+// hash against parentDS. It's kept for callers that only need one zone
+// validated; BuildDelegationChain is the parallel, whole-chain version
+// used by iterativeResolve.
 func (r *Resolver) QueryDelegation(zone string, parentDS []*dns.DS, dnssec bool) ([]*dns.DNSKEY, error) {
 	if !dnssec {
 		return nil, nil // DNSSEC not enabled
 	}
 
-	// Check cache first
-	if keys, ok := r.dnskeyCache[zone]; ok {
-		log.Printf("Using cached DNSKEYs for zone %s", zone)
-		return keys, nil
+	z := r.signedZoneFor(zone) // checks the in-memory and on-disk caches before the network
+	if z.validatedKSKs != nil {
+		return z.validatedKSKs, nil
+	}
+	z.ds = parentDS
+	if err := validateZone(z); err != nil {
+		return nil, err
 	}
+	r.cacheValidatedZone(z)
+	return z.validatedKSKs, nil
+}
 
-	log.Printf("Performing DNSSEC validation for delegated zone: %s", zone)
+// signedZone holds one zone's DNSSEC material as fetched from the network
+// (its DNSKEY RRset, the RRSIGs covering it, and its DS records), plus the
+// KSKs that have survived validateZone.
+type signedZone struct {
+	name         string
+	dnskeys      []*dns.DNSKEY
+	dnskeyRRSIGs []*dns.RRSIG
+	dnskeyAnswer []dns.RR // the raw Answer section the RRSIGs above cover
+	ds           []*dns.DS
 
-	// 1. Query DNSKEYs from the child zone
-	childDNSKEYResult := r.queryAuthoritativeServers(r.rootServers, zone, dns.TypeDNSKEY, dnssec)
-	if childDNSKEYResult.Err != nil || childDNSKEYResult.Msg == nil || childDNSKEYResult.Msg.Rcode != dns.RcodeSuccess {
-		log.Printf("Failed to fetch DNSKEYs for %s: %v", zone, childDNSKEYResult.Err)
-		return nil, ErrDNSSECValidationFailed
+	validatedKSKs []*dns.DNSKEY
+	err           error
+}
+
+// zoneSuffixes splits name into its label suffixes from the name itself up
+// to the root, e.g. "www.example.com." -> ["www.example.com.",
+// "example.com.", "com.", "."].
+func zoneSuffixes(name string) []string {
+	fqdn := dns.Fqdn(name)
+	offsets := dns.Split(fqdn)
+	suffixes := make([]string, 0, len(offsets)+1)
+	for _, off := range offsets {
+		suffixes = append(suffixes, fqdn[off:])
 	}
+	suffixes = append(suffixes, ".")
+	return suffixes
+}
 
-	var childDNSKEYs []*dns.DNSKEY
-	var childRRSIGs []*dns.RRSIG
-	for _, rr := range childDNSKEYResult.Msg.Answer {
-		if key, ok := rr.(*dns.DNSKEY); ok {
-			childDNSKEYs = append(childDNSKEYs, key)
-		} else if sig, ok := rr.(*dns.RRSIG); ok {
-			childRRSIGs = append(childRRSIGs, sig)
+// fetchSignedZone fetches zone's DNSKEY RRset (with covering RRSIGs) and,
+// unless zone is the root, its DS records. It does not validate anything;
+// that's validateZone's job.
+func (r *Resolver) fetchSignedZone(zone string) *signedZone {
+	z := &signedZone{name: zone}
+
+	dnskeyResult := r.queryAuthoritativeServers(r.rootServers, zone, dns.TypeDNSKEY, true)
+	if dnskeyResult.Err != nil || dnskeyResult.Msg == nil || dnskeyResult.Msg.Rcode != dns.RcodeSuccess {
+		log.Printf("Failed to fetch DNSKEYs for %s: %v", zone, dnskeyResult.Err)
+		z.err = ErrDnskeyNotAvailable
+		return z
+	}
+	for _, rr := range dnskeyResult.Msg.Answer {
+		switch v := rr.(type) {
+		case *dns.DNSKEY:
+			z.dnskeys = append(z.dnskeys, v)
+		case *dns.RRSIG:
+			z.dnskeyRRSIGs = append(z.dnskeyRRSIGs, v)
 		}
 	}
-
-	if len(childDNSKEYs) == 0 {
+	z.dnskeyAnswer = dnskeyResult.Msg.Answer
+	if len(z.dnskeys) == 0 {
 		log.Printf("No DNSKEYs found for %s", zone)
-		return nil, ErrDNSSECValidationFailed
+		z.err = ErrDnskeyNotAvailable
+		return z
 	}
 
-	// 2. Validate RRSIGs for DNSKEYs using the DNSKEYs themselves (self-signed KSKs)
-	// This is a simplified approach. A full validator would need to handle ZSKs and KSKs separately.
-	ksks := getKSKs(childDNSKEYs)
+	if zone != "." {
+		dsResult := r.queryAuthoritativeServers(r.rootServers, zone, dns.TypeDS, true)
+		if dsResult.Err == nil && dsResult.Msg != nil && dsResult.Msg.Rcode == dns.RcodeSuccess {
+			for _, rr := range dsResult.Msg.Answer {
+				if ds, ok := rr.(*dns.DS); ok {
+					z.ds = append(z.ds, ds)
+				}
+			}
+		}
+	}
+
+	return z
+}
+
+// validateZone validates z in place: its DNSKEY RRset's RRSIG must verify
+// against one of its own KSKs (a self-signed KSK, as DNSSEC requires), and
+// if z.ds is non-empty that KSK's hash must match one of them. On success
+// z.validatedKSKs holds the DNSKEYs that passed.
+func validateZone(z *signedZone) error {
+	if z.err != nil {
+		return z.err
+	}
+
+	ksks := getKSKs(z.dnskeys)
 	if len(ksks) == 0 {
-		log.Printf("No KSKs found for %s", zone)
-		return nil, ErrDNSSECValidationFailed
+		log.Printf("No KSKs found for %s", z.name)
+		return ErrDnskeyNotAvailable
 	}
 
-	// For each RRSIG, try to validate it with a KSK
 	validatedDNSKEYs := make(map[string]*dns.DNSKEY)
-	for _, sig := range childRRSIGs {
+	for _, sig := range z.dnskeyRRSIGs {
 		if sig.TypeCovered != dns.TypeDNSKEY {
 			continue
 		}
 		for _, key := range ksks {
-			if err := sig.Verify(key, childDNSKEYResult.Msg.Answer); err == nil {
-				log.Printf("Successfully validated RRSIG for DNSKEYs in %s with KSK ID %d", zone, key.KeyTag())
-				// Add all DNSKEYs to the validated set if at least one RRSIG is valid
-				for _, k := range childDNSKEYs {
+			if err := sig.Verify(key, z.dnskeyAnswer); err == nil {
+				log.Printf("Successfully validated RRSIG for DNSKEYs in %s with KSK ID %d", z.name, key.KeyTag())
+				for _, k := range z.dnskeys {
 					validatedDNSKEYs[k.String()] = k
 				}
-				break // Move to next RRSIG
+				break
 			}
 		}
 	}
-
 	if len(validatedDNSKEYs) == 0 {
-		log.Printf("Failed to validate RRSIGs for DNSKEYs in %s", zone)
-		return nil, ErrDNSSECValidationFailed
+		log.Printf("Failed to validate RRSIGs for DNSKEYs in %s", z.name)
+		return ErrInvalidRRsig
 	}
 
-	// Convert map back to slice
-	var finalDNSKEYs []*dns.DNSKEY
+	finalDNSKEYs := make([]*dns.DNSKEY, 0, len(validatedDNSKEYs))
 	for _, key := range validatedDNSKEYs {
 		finalDNSKEYs = append(finalDNSKEYs, key)
 	}
 
-	// 3. If parentDS is provided, validate DS records against the child's KSKs
-	if len(parentDS) > 0 {
-		log.Printf("Validating DS records for %s against child DNSKEYs", zone)
+	if len(z.ds) > 0 {
+		log.Printf("Validating DS records for %s against its DNSKEYs", z.name)
 		didValidateDS := false
-		for _, ds := range parentDS {
+		for _, ds := range z.ds {
 			for _, key := range finalDNSKEYs {
 				if key.KeyTag() == ds.KeyTag && ds.Algorithm == key.Algorithm {
-					// Re-create DS from DNSKEY and compare digests
 					generatedDS := key.ToDS(ds.DigestType)
 					if generatedDS != nil && compareDigests([]byte(generatedDS.Digest), []byte(ds.Digest)) {
 						didValidateDS = true
-						log.Printf("Successfully validated DS record for %s with DNSKEY ID %d", zone, key.KeyTag())
+						log.Printf("Successfully validated DS record for %s with DNSKEY ID %d", z.name, key.KeyTag())
 						break
 					}
 				}
@@ -514,17 +964,196 @@ func (r *Resolver) QueryDelegation(zone string, parentDS []*dns.DS, dnssec bool)
 			}
 		}
 		if !didValidateDS {
-			log.Printf("Failed to validate DS records for %s", zone)
-			return nil, ErrDNSSECValidationFailed
+			log.Printf("Failed to validate DS records for %s", z.name)
+			return ErrDsInvalid
 		}
 	} else {
-		log.Printf("No parent DS records provided for %s, skipping DS validation", zone)
+		log.Printf("No DS records provided for %s, skipping DS validation", z.name)
+	}
+
+	z.validatedKSKs = finalDNSKEYs
+	return nil
+}
+
+// signedZoneFor returns zone's signedZone: from the in-memory cache if
+// present and unexpired, failing that from the on-disk persistentCache (if
+// one is attached) if present and unexpired, and failing that by fetching
+// it fresh over the network. A freshly-fetched zone is cached only once
+// it's later validated by BuildDelegationChain, not here, so a zone that
+// fails validation is never served stale out of either cache.
+func (r *Resolver) signedZoneFor(zone string) *signedZone {
+	r.zoneCacheMu.RLock()
+	entry, ok := r.zoneCache[zone]
+	r.zoneCacheMu.RUnlock()
+	if ok && time.Now().Before(entry.expiresAt) {
+		return entry.zone
+	}
+
+	if r.persistentCache != nil {
+		if z, ok := r.signedZoneFromDisk(zone); ok {
+			return z
+		}
+	}
+
+	return r.fetchSignedZone(zone)
+}
+
+// signedZoneFromDisk reconstructs a signedZone from persistentCache's
+// on-disk record for zone, if one exists and hasn't expired. The returned
+// zone already carries validatedKSKs: persistentCache only ever holds zones
+// that BuildDelegationChain itself validated before writing them out, the
+// same trust model as the in-memory zoneCache, just surviving a restart.
+func (r *Resolver) signedZoneFromDisk(zone string) (*signedZone, bool) {
+	entry, found := r.persistentCache.GetZone(zone)
+	if !found {
+		return nil, false
+	}
+
+	dnskeys := make([]*dns.DNSKEY, 0, len(entry.DNSKEY))
+	for _, rrText := range entry.DNSKEY {
+		rr, err := dns.NewRR(rrText)
+		if err != nil {
+			log.Printf("persistent cache: failed to parse cached DNSKEY for %s: %v", zone, err)
+			return nil, false
+		}
+		if key, ok := rr.(*dns.DNSKEY); ok {
+			dnskeys = append(dnskeys, key)
+		}
+	}
+	if len(dnskeys) == 0 {
+		return nil, false
+	}
+
+	var ds []*dns.DS
+	for _, rrText := range entry.DS {
+		rr, err := dns.NewRR(rrText)
+		if err != nil {
+			log.Printf("persistent cache: failed to parse cached DS for %s: %v", zone, err)
+			return nil, false
+		}
+		if d, ok := rr.(*dns.DS); ok {
+			ds = append(ds, d)
+		}
+	}
+
+	return &signedZone{
+		name:          zone,
+		dnskeys:       dnskeys,
+		ds:            ds,
+		validatedKSKs: dnskeys,
+	}, true
+}
+
+// nsAddrsFromCache returns nsname's addresses from persistentCache, if one
+// is attached and holds an unexpired entry for it.
+func (r *Resolver) nsAddrsFromCache(nsname string) ([]string, bool) {
+	if r.persistentCache == nil {
+		return nil, false
+	}
+	entry, found := r.persistentCache.GetNS(dns.Fqdn(nsname))
+	if !found {
+		return nil, false
+	}
+	return entry.Addrs, true
+}
+
+// cacheNSAddrs writes nsname's resolved addrs to persistentCache (if one is
+// attached), expiring after min(the lowest TTL among answer, the configured
+// maxTTL).
+func (r *Resolver) cacheNSAddrs(nsname string, addrs []string, answer *dns.Msg) {
+	if r.persistentCache == nil || len(addrs) == 0 {
+		return
+	}
+	ttl := r.zoneCacheTTL()
+	if minTTL := minAnswerTTL(answer); minTTL > 0 {
+		ttl = minTTL
+	}
+	entry := persistent.NSEntry{Addrs: addrs}
+	if err := r.persistentCache.PutNS(dns.Fqdn(nsname), entry, ttl); err != nil {
+		log.Printf("persistent cache: failed to store NS %s: %v", nsname, err)
+	}
+}
+
+// minAnswerTTL returns the lowest TTL among answer's records, or 0 if it has
+// none.
+func minAnswerTTL(answer *dns.Msg) time.Duration {
+	if answer == nil {
+		return 0
+	}
+	var min uint32
+	for _, rr := range answer.Answer {
+		ttl := rr.Header().Ttl
+		if min == 0 || ttl < min {
+			min = ttl
+		}
+	}
+	return time.Duration(min) * time.Second
+}
+
+// cacheValidatedZone stores z, already validated by BuildDelegationChain,
+// under its name for signedZoneCacheTTL, and (if a persistentCache is
+// attached) writes it through to disk so a restarted resolver doesn't lose
+// it.
+func (r *Resolver) cacheValidatedZone(z *signedZone) {
+	r.zoneCacheMu.Lock()
+	r.zoneCache[z.name] = zoneCacheEntry{zone: z, expiresAt: time.Now().Add(signedZoneCacheTTL)}
+	r.zoneCacheMu.Unlock()
+
+	if r.persistentCache != nil {
+		dnskeyText := make([]string, len(z.dnskeys))
+		for i, k := range z.dnskeys {
+			dnskeyText[i] = k.String()
+		}
+		dsText := make([]string, len(z.ds))
+		for i, d := range z.ds {
+			dsText[i] = d.String()
+		}
+
+		entry := persistent.ZoneEntry{DNSKEY: dnskeyText, DS: dsText}
+		if err := r.persistentCache.PutZone(z.name, entry, r.zoneCacheTTL()); err != nil {
+			log.Printf("persistent cache: failed to store zone %s: %v", z.name, err)
+		}
+	}
+}
+
+// BuildDelegationChain builds and validates the full DNSSEC delegation
+// chain for qname, from the root down to the queried name. It fetches
+// every zone in the chain concurrently (one goroutine per zone) instead of
+// walking the chain one zone at a time, then validates top-down: each
+// zone's DNSKEY RRSIG against one of its own KSKs, and that KSK's hash
+// against the zone's DS records. The returned slice is ordered root-first,
+// leaf-last. Each zone already validated within signedZoneCacheTTL is
+// served from cache instead of refetched.
+func (r *Resolver) BuildDelegationChain(qname string) ([]*signedZone, error) {
+	suffixes := zoneSuffixes(qname) // leaf-first, e.g. [a.b.com. b.com. com. .]
+
+	fetched := make([]*signedZone, len(suffixes))
+	var wg sync.WaitGroup
+	for i, zone := range suffixes {
+		wg.Add(1)
+		go func(i int, zone string) {
+			defer wg.Done()
+			fetched[i] = r.signedZoneFor(zone)
+		}(i, zone)
+	}
+	wg.Wait()
+
+	chain := make([]*signedZone, len(fetched))
+	for i, z := range fetched {
+		chain[len(fetched)-1-i] = z // reverse into root-first order
+	}
+
+	for _, z := range chain {
+		if z.validatedKSKs != nil {
+			continue // already validated, whether freshly or from cache
+		}
+		if err := validateZone(z); err != nil {
+			return nil, fmt.Errorf("goresolver: DNSSEC validation failed for zone %q: %w", z.name, err)
+		}
+		r.cacheValidatedZone(z)
 	}
 
-	// Cache validated DNSKEYs
-	r.dnskeyCache[zone] = finalDNSKEYs
-	log.Printf("DNSSEC validation successful for %s. Cached %d DNSKEYs.", zone, len(finalDNSKEYs))
-	return finalDNSKEYs, nil
+	return chain, nil
 }
 
 // getKSKs extracts Key Signing Keys (KSKs) from a slice of DNSKEYs.
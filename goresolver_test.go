@@ -0,0 +1,169 @@
+package goresolver
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+func TestZoneSuffixes_WalksFromNameToRoot(t *testing.T) {
+	got := zoneSuffixes("www.example.com.")
+	want := []string{"www.example.com.", "example.com.", "com.", "."}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("zoneSuffixes(%q) = %v, want %v", "www.example.com.", got, want)
+	}
+}
+
+func TestZoneSuffixes_Root(t *testing.T) {
+	got := zoneSuffixes(".")
+	want := []string{"."}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("zoneSuffixes(%q) = %v, want %v", ".", got, want)
+	}
+}
+
+func TestValidateZone_PropagatesFetchError(t *testing.T) {
+	z := &signedZone{name: "example.com.", err: ErrDnskeyNotAvailable}
+	if err := validateZone(z); err != ErrDnskeyNotAvailable {
+		t.Errorf("expected validateZone to surface the fetch error, got %v", err)
+	}
+}
+
+func TestValidateZone_FailsWithoutAKSK(t *testing.T) {
+	z := &signedZone{
+		name:    "example.com.",
+		dnskeys: []*dns.DNSKEY{{Flags: dns.ZONE}}, // no SEP bit: not a KSK
+	}
+	if err := validateZone(z); err != ErrDnskeyNotAvailable {
+		t.Errorf("expected ErrDnskeyNotAvailable when no KSK is present, got %v", err)
+	}
+}
+
+func TestAppendTraceStep_NoopWhenTraceIsNil(t *testing.T) {
+	// Must not panic: iterativeResolve always passes a nil trace for plain
+	// Query calls, and appendTraceStep is the only thing that touches it.
+	appendTraceStep(nil, TraceStep{Zone: "example.com."})
+}
+
+func TestAppendTraceStep_AppendsToTrace(t *testing.T) {
+	var trace []TraceStep
+	appendTraceStep(&trace, TraceStep{Zone: "example.com."})
+	appendTraceStep(&trace, TraceStep{Zone: "com."})
+
+	if len(trace) != 2 || trace[0].Zone != "example.com." || trace[1].Zone != "com." {
+		t.Errorf("expected two steps in order, got %+v", trace)
+	}
+}
+
+func TestNewTraceStep_FillsRcodeAndAuthenticatedDataFromMsg(t *testing.T) {
+	msg := new(dns.Msg)
+	msg.Rcode = dns.RcodeSuccess
+	msg.AuthenticatedData = true
+
+	step := newTraceStep("example.com.", &DNSResult{Msg: msg, Server: "198.41.0.4:53"}, 5*time.Millisecond)
+
+	if step.Rcode != "NOERROR" || !step.AuthenticatedData || step.Server != "198.41.0.4:53" {
+		t.Errorf("unexpected step: %+v", step)
+	}
+}
+
+func TestNewTraceStep_FallsBackToErrWhenNoMsg(t *testing.T) {
+	step := newTraceStep("example.com.", &DNSResult{Err: ErrNsNotAvailable}, 0)
+	if step.Rcode != ErrNsNotAvailable.Error() {
+		t.Errorf("expected the error's message as Rcode, got %q", step.Rcode)
+	}
+}
+
+func TestValidateZone_FailsWithoutAMatchingRRSIG(t *testing.T) {
+	z := &signedZone{
+		name:    "example.com.",
+		dnskeys: []*dns.DNSKEY{{Flags: dns.ZONE | dns.SEP}},
+		// No RRSIGs at all, so the KSK's self-signature can never validate.
+	}
+	if err := validateZone(z); err != ErrInvalidRRsig {
+		t.Errorf("expected ErrInvalidRRsig when no RRSIG validates, got %v", err)
+	}
+}
+
+func TestRankedServers_PrefersLowerEWMARTT(t *testing.T) {
+	r := &Resolver{serverRanks: make(map[string]map[string]*serverRank)}
+	r.recordServerResult("example.com.", "10.0.0.1", 100*time.Millisecond, true)
+	r.recordServerResult("example.com.", "10.0.0.2", 10*time.Millisecond, true)
+
+	got := r.rankedServers("example.com.", []string{"10.0.0.1", "10.0.0.2"})
+	want := []string{"10.0.0.2", "10.0.0.1"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("rankedServers() = %v, want %v", got, want)
+	}
+}
+
+func TestRankedServers_MovesBlacklistedServerToBack(t *testing.T) {
+	r := &Resolver{
+		serverRanks:            make(map[string]map[string]*serverRank),
+		serverFailureThreshold: 1,
+		serverCooldown:         time.Minute,
+	}
+	r.recordServerResult("example.com.", "10.0.0.1", 5*time.Millisecond, false) // blacklisted after 1 failure
+	r.recordServerResult("example.com.", "10.0.0.2", 50*time.Millisecond, true)
+
+	got := r.rankedServers("example.com.", []string{"10.0.0.1", "10.0.0.2"})
+	want := []string{"10.0.0.2", "10.0.0.1"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("rankedServers() = %v, want %v", got, want)
+	}
+}
+
+func TestRankedServers_UnknownZoneReturnsInputUnchanged(t *testing.T) {
+	r := &Resolver{serverRanks: make(map[string]map[string]*serverRank)}
+	servers := []string{"10.0.0.1", "10.0.0.2"}
+	got := r.rankedServers("unseen.example.com.", servers)
+	if !reflect.DeepEqual(got, servers) {
+		t.Errorf("rankedServers() = %v, want %v", got, servers)
+	}
+}
+
+func TestRecordServerResult_SuccessResetsFailuresAndBlacklist(t *testing.T) {
+	r := &Resolver{
+		serverRanks:            make(map[string]map[string]*serverRank),
+		serverFailureThreshold: 1,
+		serverCooldown:         time.Minute,
+	}
+	r.recordServerResult("example.com.", "10.0.0.1", 5*time.Millisecond, false)
+	r.recordServerResult("example.com.", "10.0.0.1", 5*time.Millisecond, true)
+
+	ranks := r.ServerRankings("example.com.")
+	if len(ranks) != 1 {
+		t.Fatalf("expected 1 ranking, got %d", len(ranks))
+	}
+	if ranks[0].Blacklisted || ranks[0].ConsecutiveFails != 0 {
+		t.Errorf("expected a success to clear blacklist/failures, got %+v", ranks[0])
+	}
+}
+
+func TestRecordServerResult_BlacklistsAfterThreshold(t *testing.T) {
+	r := &Resolver{
+		serverRanks:            make(map[string]map[string]*serverRank),
+		serverFailureThreshold: 2,
+		serverCooldown:         time.Minute,
+	}
+	r.recordServerResult("example.com.", "10.0.0.1", 5*time.Millisecond, false)
+	ranks := r.ServerRankings("example.com.")
+	if ranks[0].Blacklisted {
+		t.Fatal("expected no blacklist before the failure threshold is reached")
+	}
+
+	r.recordServerResult("example.com.", "10.0.0.1", 5*time.Millisecond, false)
+	ranks = r.ServerRankings("example.com.")
+	if !ranks[0].Blacklisted {
+		t.Fatal("expected the server to be blacklisted once the failure threshold is reached")
+	}
+}
+
+func TestServerRankings_UnknownZoneReturnsNil(t *testing.T) {
+	r := &Resolver{serverRanks: make(map[string]map[string]*serverRank)}
+	if got := r.ServerRankings("unseen.example.com."); got != nil {
+		t.Errorf("expected nil for an unseen zone, got %v", got)
+	}
+}
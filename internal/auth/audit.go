@@ -0,0 +1,69 @@
+package auth
+
+import (
+	"encoding/json"
+	"os"
+	"sync"
+	"time"
+)
+
+// AuditEntry is one record of a privileged dashboard action.
+type AuditEntry struct {
+	Timestamp time.Time `json:"ts"`
+	Subject   string    `json:"subject"` // Principal.Subject, or "" if authentication itself failed
+	Action    string    `json:"action"`  // e.g. "POST /zones"
+	Resource  string    `json:"resource"`
+	Result    string    `json:"result"` // "allowed", "denied", or "forbidden"
+}
+
+// AuditSink persists one AuditEntry somewhere durable. It's the same shape
+// as query_logging.Sink, modeled on it deliberately so an audit log can
+// eventually be wired into the same CSV/SQLite rotation machinery; for now
+// only the stdout sink is implemented.
+type AuditSink interface {
+	Write(e AuditEntry) error
+}
+
+// stdoutAuditSink writes every entry to os.Stdout as a newline-delimited
+// JSON object, the same approach query_logging.stdoutSink takes.
+type stdoutAuditSink struct {
+	mu sync.Mutex
+}
+
+func (s *stdoutAuditSink) Write(e AuditEntry) error {
+	line, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, err = os.Stdout.Write(append(line, '\n'))
+	return err
+}
+
+// AuditLogger records every privileged action the dashboard's RBAC
+// middleware gates, regardless of outcome, so "who did what, when, with
+// what result" is always reconstructable.
+type AuditLogger struct {
+	sink AuditSink
+}
+
+// NewAuditLogger builds an AuditLogger. A nil sink defaults to stdout.
+func NewAuditLogger(sink AuditSink) *AuditLogger {
+	if sink == nil {
+		sink = &stdoutAuditSink{}
+	}
+	return &AuditLogger{sink: sink}
+}
+
+// Log records one privileged action. subject is "" when authentication
+// itself failed (no Principal was established).
+func (l *AuditLogger) Log(subject, action, resource, result string) {
+	l.sink.Write(AuditEntry{
+		Timestamp: time.Now(),
+		Subject:   subject,
+		Action:    action,
+		Resource:  resource,
+		Result:    result,
+	})
+}
@@ -0,0 +1,58 @@
+// Package auth implements the dashboard's pluggable authentication and
+// scope-based RBAC: API tokens (bcrypt-hashed, stored in config.json) and
+// OIDC (JWT bearer tokens verified against an issuer's JWKS), both
+// producing a Principal carrying the scopes a request is allowed. It
+// replaces the dashboard's previous hardcoded Basic Auth credential.
+package auth
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// Principal is the authenticated identity behind a request, together with
+// the scopes it's authorized for.
+type Principal struct {
+	Subject string
+	Scopes  []string
+}
+
+// Authenticator extracts and verifies a Principal from an incoming
+// request, e.g. from its Authorization header. It returns an error if the
+// request carries no usable credential or the credential doesn't verify;
+// it is not responsible for scope checks, see HasScope/HasZoneScope.
+type Authenticator interface {
+	Authenticate(r *http.Request) (*Principal, error)
+}
+
+// Chain tries each Authenticator in order and returns the first Principal
+// that verifies, so a deployment can accept API tokens and OIDC bearer
+// tokens side by side. It returns the last error if none verify.
+type Chain []Authenticator
+
+func (c Chain) Authenticate(r *http.Request) (*Principal, error) {
+	var lastErr error
+	for _, a := range c {
+		p, err := a.Authenticate(r)
+		if err == nil {
+			return p, nil
+		}
+		lastErr = err
+	}
+	if lastErr == nil {
+		lastErr = fmt.Errorf("auth: no authenticator configured")
+	}
+	return nil, lastErr
+}
+
+// bearerToken extracts the credential from a standard "Authorization:
+// Bearer <token>" header, used by both the API-token and OIDC
+// authenticators.
+func bearerToken(r *http.Request) (string, error) {
+	header := r.Header.Get("Authorization")
+	const prefix = "Bearer "
+	if len(header) <= len(prefix) || header[:len(prefix)] != prefix {
+		return "", fmt.Errorf("auth: missing or malformed Authorization header")
+	}
+	return header[len(prefix):], nil
+}
@@ -0,0 +1,227 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestHasScope(t *testing.T) {
+	p := &Principal{Scopes: []string{"zones:read"}}
+	if !HasScope(p, "zones:read") {
+		t.Error("expected an exact scope match to be granted")
+	}
+	if HasScope(p, "zones:write") {
+		t.Error("expected an unrelated scope to be denied")
+	}
+	if !HasScope(&Principal{Scopes: []string{"*"}}, "config:write") {
+		t.Error("expected the wildcard scope to grant anything")
+	}
+	if HasScope(nil, "zones:read") {
+		t.Error("expected a nil principal to be denied everything")
+	}
+}
+
+func TestHasZoneScope(t *testing.T) {
+	zoneScoped := &Principal{Scopes: []string{"zone:example.com:write"}}
+	if !HasZoneScope(zoneScoped, "example.com", "write") {
+		t.Error("expected the zone-specific scope to grant that zone")
+	}
+	if HasZoneScope(zoneScoped, "other.com", "write") {
+		t.Error("expected the zone-specific scope to not grant a different zone")
+	}
+
+	blanket := &Principal{Scopes: []string{"zones:write"}}
+	if !HasZoneScope(blanket, "any-zone.com", "write") {
+		t.Error("expected the blanket zones:write scope to grant every zone")
+	}
+	if HasZoneScope(blanket, "any-zone.com", "read") {
+		t.Error("expected zones:write to not grant the read action")
+	}
+}
+
+func TestTokenAuthenticator_ValidCredential(t *testing.T) {
+	hashed, err := HashTokenSecret("s3cret")
+	if err != nil {
+		t.Fatalf("HashTokenSecret returned error: %v", err)
+	}
+	a := NewTokenAuthenticator(func() []APIToken {
+		return []APIToken{{ID: "tok1", HashedSecret: hashed, Scopes: []string{"zones:read"}}}
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/zones", nil)
+	req.Header.Set("Authorization", "Bearer tok1.s3cret")
+
+	p, err := a.Authenticate(req)
+	if err != nil {
+		t.Fatalf("Authenticate returned error: %v", err)
+	}
+	if !HasScope(p, "zones:read") {
+		t.Errorf("expected principal to carry zones:read, got %v", p.Scopes)
+	}
+}
+
+func TestTokenAuthenticator_WrongSecretRejected(t *testing.T) {
+	hashed, _ := HashTokenSecret("s3cret")
+	a := NewTokenAuthenticator(func() []APIToken {
+		return []APIToken{{ID: "tok1", HashedSecret: hashed}}
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/zones", nil)
+	req.Header.Set("Authorization", "Bearer tok1.wrong")
+
+	if _, err := a.Authenticate(req); err == nil {
+		t.Error("expected a wrong secret to be rejected")
+	}
+}
+
+func TestTokenAuthenticator_MissingHeaderRejected(t *testing.T) {
+	a := NewTokenAuthenticator(func() []APIToken { return nil })
+	req := httptest.NewRequest(http.MethodGet, "/zones", nil)
+
+	if _, err := a.Authenticate(req); err == nil {
+		t.Error("expected a request with no Authorization header to be rejected")
+	}
+}
+
+// newTestJWT builds and signs a compact RS256 JWT with the given claims,
+// for exercising OIDCAuthenticator against a key pair generated in-test.
+func newTestJWT(t *testing.T, key *rsa.PrivateKey, kid string, claims map[string]any) string {
+	t.Helper()
+
+	header := map[string]any{"alg": "RS256", "typ": "JWT", "kid": kid}
+	headerSeg := base64.RawURLEncoding.EncodeToString(mustJSON(t, header))
+	claimsSeg := base64.RawURLEncoding.EncodeToString(mustJSON(t, claims))
+	signingInput := headerSeg + "." + claimsSeg
+
+	sum := sha256.Sum256([]byte(signingInput))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, sum[:])
+	if err != nil {
+		t.Fatalf("signing test JWT: %v", err)
+	}
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+func mustJSON(t *testing.T, v any) []byte {
+	t.Helper()
+	b, err := json.Marshal(v)
+	if err != nil {
+		t.Fatalf("marshaling JSON: %v", err)
+	}
+	return b
+}
+
+func TestOIDCAuthenticator_VerifiesValidToken(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generating test key: %v", err)
+	}
+
+	jwks := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]any{
+			"keys": []map[string]any{{
+				"kty": "RSA",
+				"kid": "test-kid",
+				"n":   base64.RawURLEncoding.EncodeToString(key.PublicKey.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big2bytes(key.PublicKey.E)),
+			}},
+		})
+	}))
+	defer jwks.Close()
+
+	a := NewOIDCAuthenticator(OIDCConfig{
+		Issuer:      "https://issuer.example.com",
+		Audience:    "dashboard",
+		JWKSURL:     jwks.URL,
+		ScopeClaim:  "scope",
+		GroupsClaim: "groups",
+		GroupScopeMap: map[string][]string{
+			"dns-admins": {"config:write"},
+		},
+	})
+
+	token := newTestJWT(t, key, "test-kid", map[string]any{
+		"iss":    "https://issuer.example.com",
+		"aud":    "dashboard",
+		"sub":    "alice",
+		"exp":    float64(time.Now().Add(time.Hour).Unix()),
+		"scope":  "zones:read",
+		"groups": []string{"dns-admins"},
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/zones", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	p, err := a.Authenticate(req)
+	if err != nil {
+		t.Fatalf("Authenticate returned error: %v", err)
+	}
+	if !HasScope(p, "zones:read") || !HasScope(p, "config:write") {
+		t.Errorf("expected scopes from both the scope and groups claims, got %v", p.Scopes)
+	}
+}
+
+func TestOIDCAuthenticator_RejectsExpiredToken(t *testing.T) {
+	key, _ := rsa.GenerateKey(rand.Reader, 2048)
+	jwks := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]any{
+			"keys": []map[string]any{{
+				"kty": "RSA",
+				"kid": "test-kid",
+				"n":   base64.RawURLEncoding.EncodeToString(key.PublicKey.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big2bytes(key.PublicKey.E)),
+			}},
+		})
+	}))
+	defer jwks.Close()
+
+	a := NewOIDCAuthenticator(OIDCConfig{Issuer: "https://issuer.example.com", Audience: "dashboard", JWKSURL: jwks.URL})
+
+	token := newTestJWT(t, key, "test-kid", map[string]any{
+		"iss": "https://issuer.example.com",
+		"aud": "dashboard",
+		"sub": "alice",
+		"exp": float64(time.Now().Add(-time.Hour).Unix()),
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/zones", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	if _, err := a.Authenticate(req); err == nil {
+		t.Error("expected an expired token to be rejected")
+	}
+}
+
+func big2bytes(e int) []byte {
+	b := make([]byte, 0, 4)
+	for e > 0 {
+		b = append([]byte{byte(e & 0xff)}, b...)
+		e >>= 8
+	}
+	if len(b) == 0 {
+		b = []byte{0}
+	}
+	return b
+}
+
+func TestChain_TriesEachAuthenticatorInOrder(t *testing.T) {
+	hashed, _ := HashTokenSecret("s3cret")
+	tokenAuth := NewTokenAuthenticator(func() []APIToken {
+		return []APIToken{{ID: "tok1", HashedSecret: hashed, Scopes: []string{"zones:read"}}}
+	})
+	chain := Chain{tokenAuth}
+
+	req := httptest.NewRequest(http.MethodGet, "/zones", nil)
+	req.Header.Set("Authorization", "Bearer tok1.s3cret")
+
+	if _, err := chain.Authenticate(req); err != nil {
+		t.Fatalf("Authenticate returned error: %v", err)
+	}
+}
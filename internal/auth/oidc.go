@@ -0,0 +1,243 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// defaultJWKSCacheTTL bounds how long a fetched JWKS is reused before
+// OIDCAuthenticator refetches it, so a key rotation on the issuer's side is
+// picked up without requiring a restart.
+const defaultJWKSCacheTTL = 10 * time.Minute
+
+// OIDCConfig configures an OIDCAuthenticator.
+type OIDCConfig struct {
+	Issuer   string
+	Audience string
+	JWKSURL  string
+	// ScopeClaim names the claim holding a space-delimited OAuth2 scope
+	// string, e.g. "scope". Empty disables scope-claim mapping.
+	ScopeClaim string
+	// GroupsClaim names the claim holding the subject's group membership
+	// (a JSON array of strings), mapped to scopes via GroupScopeMap.
+	GroupsClaim string
+	// GroupScopeMap maps one group name to the scopes it grants.
+	GroupScopeMap map[string][]string
+}
+
+// OIDCAuthenticator verifies "Authorization: Bearer <JWT>" credentials: the
+// JWT's RS256 signature against a key fetched from cfg.JWKSURL, then its
+// iss/aud/exp claims against cfg.Issuer/cfg.Audience, and finally maps its
+// scope and/or group claims to Principal.Scopes.
+type OIDCAuthenticator struct {
+	cfg    OIDCConfig
+	client *http.Client
+
+	mu     sync.Mutex
+	keys   map[string]*rsa.PublicKey // by kid
+	keysAt time.Time
+}
+
+// NewOIDCAuthenticator builds an OIDCAuthenticator from cfg.
+func NewOIDCAuthenticator(cfg OIDCConfig) *OIDCAuthenticator {
+	return &OIDCAuthenticator{
+		cfg:    cfg,
+		client: &http.Client{Timeout: 5 * time.Second},
+	}
+}
+
+func (a *OIDCAuthenticator) Authenticate(r *http.Request) (*Principal, error) {
+	tok, err := bearerToken(r)
+	if err != nil {
+		return nil, err
+	}
+
+	claims, err := a.verify(tok)
+	if err != nil {
+		return nil, err
+	}
+
+	if iss, _ := claims["iss"].(string); iss != a.cfg.Issuer {
+		return nil, fmt.Errorf("auth: unexpected OIDC issuer %q", iss)
+	}
+	if !audienceMatches(claims["aud"], a.cfg.Audience) {
+		return nil, fmt.Errorf("auth: token audience does not include %q", a.cfg.Audience)
+	}
+	if exp, ok := claims["exp"].(float64); ok && time.Now().After(time.Unix(int64(exp), 0)) {
+		return nil, fmt.Errorf("auth: token expired")
+	}
+
+	subject, _ := claims["sub"].(string)
+	return &Principal{Subject: "oidc:" + subject, Scopes: a.scopesFromClaims(claims)}, nil
+}
+
+// scopesFromClaims maps the configured scope and group claims to scopes.
+func (a *OIDCAuthenticator) scopesFromClaims(claims map[string]any) []string {
+	var scopes []string
+
+	if a.cfg.ScopeClaim != "" {
+		if raw, ok := claims[a.cfg.ScopeClaim].(string); ok {
+			scopes = append(scopes, strings.Fields(raw)...)
+		}
+	}
+	if a.cfg.GroupsClaim != "" {
+		if raw, ok := claims[a.cfg.GroupsClaim].([]any); ok {
+			for _, g := range raw {
+				if name, ok := g.(string); ok {
+					scopes = append(scopes, a.cfg.GroupScopeMap[name]...)
+				}
+			}
+		}
+	}
+	return scopes
+}
+
+// verify parses a compact JWT, checks its RS256 signature against the key
+// named by its "kid" header (fetched from cfg.JWKSURL), and returns its
+// decoded header and claims. It deliberately supports only RS256, the
+// algorithm every mainstream OIDC provider signs with by default.
+func (a *OIDCAuthenticator) verify(token string) (claims map[string]any, err error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("auth: malformed JWT")
+	}
+
+	var header map[string]any
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, fmt.Errorf("auth: decoding JWT header: %w", err)
+	}
+	if alg, _ := header["alg"].(string); alg != "RS256" {
+		return nil, fmt.Errorf("auth: unsupported JWT signing algorithm %q", header["alg"])
+	}
+	kid, _ := header["kid"].(string)
+
+	key, err := a.publicKey(kid)
+	if err != nil {
+		return nil, err
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("auth: decoding JWT signature: %w", err)
+	}
+	signed := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if err := rsa.VerifyPKCS1v15(key, crypto.SHA256, signed[:], signature); err != nil {
+		return nil, fmt.Errorf("auth: JWT signature verification failed: %w", err)
+	}
+
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, fmt.Errorf("auth: decoding JWT claims: %w", err)
+	}
+	return claims, nil
+}
+
+func decodeSegment(seg string, out any) error {
+	raw, err := base64.RawURLEncoding.DecodeString(seg)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(raw, out)
+}
+
+// publicKey returns the RSA public key for kid, fetching (and caching) the
+// issuer's JWKS document if it's missing or stale.
+func (a *OIDCAuthenticator) publicKey(kid string) (*rsa.PublicKey, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if key, ok := a.keys[kid]; ok && time.Since(a.keysAt) < defaultJWKSCacheTTL {
+		return key, nil
+	}
+
+	keys, err := fetchJWKS(a.client, a.cfg.JWKSURL)
+	if err != nil {
+		return nil, err
+	}
+	a.keys = keys
+	a.keysAt = time.Now()
+
+	key, ok := a.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("auth: no JWKS key found for kid %q", kid)
+	}
+	return key, nil
+}
+
+// jwk is the subset of RFC 7517 fields needed for an RSA signing key.
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+}
+
+func fetchJWKS(client *http.Client, url string) (map[string]*rsa.PublicKey, error) {
+	resp, err := client.Get(url)
+	if err != nil {
+		return nil, fmt.Errorf("auth: fetching JWKS from %s: %w", url, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("auth: JWKS endpoint %s returned HTTP %d", url, resp.StatusCode)
+	}
+
+	var doc struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&doc); err != nil {
+		return nil, fmt.Errorf("auth: decoding JWKS from %s: %w", url, err)
+	}
+
+	keys := make(map[string]*rsa.PublicKey, len(doc.Keys))
+	for _, k := range doc.Keys {
+		if k.Kty != "RSA" {
+			continue
+		}
+		pub, err := jwkToRSAPublicKey(k)
+		if err != nil {
+			continue // skip a malformed key rather than failing the whole fetch
+		}
+		keys[k.Kid] = pub
+	}
+	return keys, nil
+}
+
+func jwkToRSAPublicKey(k jwk) (*rsa.PublicKey, error) {
+	nBytes, err := base64.RawURLEncoding.DecodeString(k.N)
+	if err != nil {
+		return nil, fmt.Errorf("decoding modulus: %w", err)
+	}
+	eBytes, err := base64.RawURLEncoding.DecodeString(k.E)
+	if err != nil {
+		return nil, fmt.Errorf("decoding exponent: %w", err)
+	}
+	return &rsa.PublicKey{
+		N: new(big.Int).SetBytes(nBytes),
+		E: int(new(big.Int).SetBytes(eBytes).Int64()),
+	}, nil
+}
+
+// audienceMatches reports whether claim audience aud (a string or a JSON
+// array of strings per RFC 7519) contains want.
+func audienceMatches(aud any, want string) bool {
+	switch v := aud.(type) {
+	case string:
+		return v == want
+	case []any:
+		for _, entry := range v {
+			if s, ok := entry.(string); ok && s == want {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,25 @@
+package auth
+
+import "fmt"
+
+// HasScope reports whether p carries scope exactly, or the wildcard "*".
+func HasScope(p *Principal, scope string) bool {
+	if p == nil {
+		return false
+	}
+	for _, s := range p.Scopes {
+		if s == scope || s == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+// HasZoneScope reports whether p is authorized for action ("read" or
+// "write") on zone, via either a zone-specific scope
+// ("zone:<zone>:<action>") or the matching blanket scope
+// ("zones:<action>"), so a token can be granted either one zone or every
+// zone without the dashboard's handlers needing to know which.
+func HasZoneScope(p *Principal, zone, action string) bool {
+	return HasScope(p, fmt.Sprintf("zone:%s:%s", zone, action)) || HasScope(p, fmt.Sprintf("zones:%s", action))
+}
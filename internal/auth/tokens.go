@@ -0,0 +1,76 @@
+package auth
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// APIToken is one configured API token: ID is the public identifier sent
+// in the bearer credential ("<ID>.<secret>"), HashedSecret is the bcrypt
+// hash of the secret half, and Scopes lists what it's authorized for, e.g.
+// "zones:read", "zone:example.com:write", "config:write".
+type APIToken struct {
+	ID           string
+	Name         string
+	HashedSecret string
+	Scopes       []string
+}
+
+// HashTokenSecret bcrypt-hashes secret for storage as an APIToken's
+// HashedSecret, used by the /api/v1/tokens admin endpoint when minting a
+// new token.
+func HashTokenSecret(secret string) (string, error) {
+	hashed, err := bcrypt.GenerateFromPassword([]byte(secret), bcrypt.DefaultCost)
+	if err != nil {
+		return "", fmt.Errorf("auth: hashing token secret: %w", err)
+	}
+	return string(hashed), nil
+}
+
+// TokenAuthenticator verifies "Authorization: Bearer <id>.<secret>"
+// credentials against a configured list of APIToken. tokensFunc is called
+// on every request rather than the list being captured once, so a
+// dashboard-driven token CRUD (or a hot-reloaded config.json) takes effect
+// immediately - the same "read current config each time" approach
+// resolver.ConditionalUpstreamResolver uses via config.Subscribe.
+type TokenAuthenticator struct {
+	mu         sync.RWMutex
+	tokensFunc func() []APIToken
+}
+
+// NewTokenAuthenticator builds a TokenAuthenticator that calls tokensFunc
+// to get the current token list on every Authenticate call.
+func NewTokenAuthenticator(tokensFunc func() []APIToken) *TokenAuthenticator {
+	return &TokenAuthenticator{tokensFunc: tokensFunc}
+}
+
+func (a *TokenAuthenticator) Authenticate(r *http.Request) (*Principal, error) {
+	cred, err := bearerToken(r)
+	if err != nil {
+		return nil, err
+	}
+
+	id, secret, ok := strings.Cut(cred, ".")
+	if !ok {
+		return nil, fmt.Errorf("auth: malformed API token")
+	}
+
+	a.mu.RLock()
+	tokensFunc := a.tokensFunc
+	a.mu.RUnlock()
+
+	for _, t := range tokensFunc() {
+		if t.ID != id {
+			continue
+		}
+		if err := bcrypt.CompareHashAndPassword([]byte(t.HashedSecret), []byte(secret)); err != nil {
+			return nil, fmt.Errorf("auth: invalid API token secret for %q", id)
+		}
+		return &Principal{Subject: "token:" + t.ID, Scopes: t.Scopes}, nil
+	}
+	return nil, fmt.Errorf("auth: unknown API token %q", id)
+}
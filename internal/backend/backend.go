@@ -0,0 +1,39 @@
+// Package backend is the single entry point for constructing an
+// interfaces.Backend by name. It used to pick between Unbound and Knot
+// Resolver with a //go:build kres tag on its New function, which meant
+// choosing a backend required recompiling the binary and ruled out shipping
+// one build that supports several backends at once. New now dispatches on
+// Config.BackendName through the shared interfaces registry instead; build
+// tags on individual backend files (e.g. unbound's "unbound && cgo") still
+// control whether a cgo-heavy implementation compiles in, but no longer
+// control which one gets picked at runtime.
+package backend
+
+import (
+	"os"
+
+	"dns-resolver/internal/config"
+	"dns-resolver/internal/interfaces"
+	"dns-resolver/internal/metrics"
+)
+
+// defaultBackendName is used when neither Config.BackendName nor the
+// ASTRACAT_BACKEND environment variable name a backend.
+const defaultBackendName = "stub"
+
+// New constructs the interfaces.Backend named by cfg.BackendName, falling
+// back to the ASTRACAT_BACKEND environment variable (kept for compatibility
+// with the old build-tag-selected default) and then the cgo-free stub
+// backend. m is currently unused by every registered factory but is kept on
+// New's signature so a future backend needing direct metrics access doesn't
+// have to change every caller.
+func New(cfg *config.Config, m *metrics.Metrics) (interfaces.Backend, error) {
+	name := cfg.BackendName
+	if name == "" {
+		name = os.Getenv("ASTRACAT_BACKEND")
+	}
+	if name == "" {
+		name = defaultBackendName
+	}
+	return interfaces.GetBackend(name, cfg)
+}
@@ -0,0 +1,260 @@
+// Package caching implements a negative-caching, serve-stale
+// interfaces.Backend that wraps another Backend, so any backend (stub,
+// kres, unbound, ...) can be dropped behind it without that backend needing
+// to know about caching at all.
+package caching
+
+import (
+	"context"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"dns-resolver/internal/cache"
+	"dns-resolver/internal/config"
+	"dns-resolver/internal/ecs"
+	"dns-resolver/internal/interfaces"
+	"dns-resolver/internal/metrics"
+
+	"github.com/miekg/dns"
+	"golang.org/x/sync/singleflight"
+)
+
+// subnetKeySep separates the base cache.Key from the ECS subnet suffix, so
+// storageKey can strip the suffix back off on RFC 7871 opt-out.
+const subnetKeySep = "|subnet="
+
+// entry is a single cached answer, keyed on (qname, qtype, qclass, DO-bit).
+type entry struct {
+	msg        *dns.Msg
+	dnssec     interfaces.DNSSECStatus
+	expiry     time.Time // answer is fresh until this time
+	staleUntil time.Time // answer may still be served, with an async refresh, until this time
+}
+
+// Backend wraps another interfaces.Backend with an in-memory cache that
+// honors Config.CacheMinTTL, Config.CacheMaxTTL, and
+// Config.StaleWhileRevalidate, caches negative answers using the SOA
+// MINIMUM per RFC 2308, and coalesces concurrent identical in-flight
+// queries with singleflight so a thundering herd collapses to one call into
+// the wrapped Backend.
+type Backend struct {
+	next    interfaces.Backend
+	config  *config.Config
+	metrics *metrics.Metrics
+	sf      singleflight.Group
+
+	mu      sync.RWMutex
+	entries map[string]*entry
+}
+
+// NewBackend wraps next with a caching layer governed by cfg.
+func NewBackend(next interfaces.Backend, cfg *config.Config, m *metrics.Metrics) *Backend {
+	return &Backend{
+		next:    next,
+		config:  cfg,
+		metrics: m,
+		entries: make(map[string]*entry),
+	}
+}
+
+// Exchange serves req from cache when possible, otherwise forwards it to the
+// wrapped Backend and caches the result.
+func (b *Backend) Exchange(ctx context.Context, req *dns.Msg) (*dns.Msg, interfaces.DNSSECStatus, error) {
+	q := req.Question[0]
+	do := false
+	if opt := req.IsEdns0(); opt != nil {
+		do = opt.Do()
+	}
+	baseKey := cache.Key(q, do, req.CheckingDisabled)
+	key := baseKey + b.subnetSuffix(ctx)
+
+	now := time.Now()
+	e := b.lookup(key)
+	if e == nil && key != baseKey {
+		// Fall back to the subnet-independent entry, in case the upstream
+		// opted this name out of subnet-specific answers (SCOPE 0).
+		e = b.lookup(baseKey)
+	}
+	if e != nil {
+		if now.Before(e.expiry) {
+			b.metrics.IncrementCachingBackendHits()
+			return reply(e.msg, req), e.dnssec, nil
+		}
+		if now.Before(e.staleUntil) {
+			b.metrics.IncrementCachingBackendStaleServes()
+			b.refreshAsync(key, req, q)
+			return reply(e.msg, req), e.dnssec, nil
+		}
+	}
+
+	b.metrics.IncrementCachingBackendMisses()
+
+	res, err, _ := b.sf.Do(key, func() (interface{}, error) {
+		return b.fetch(ctx, req, key)
+	})
+	if err != nil {
+		return nil, interfaces.DNSSECUnknown, err
+	}
+
+	r := res.(*fetchResult)
+	return reply(r.msg, req), r.dnssec, nil
+}
+
+type fetchResult struct {
+	msg    *dns.Msg
+	dnssec interfaces.DNSSECStatus
+}
+
+// fetch calls the wrapped Backend and stores the result, if cacheable.
+func (b *Backend) fetch(ctx context.Context, req *dns.Msg, key string) (*fetchResult, error) {
+	msg, dnssec, err := b.next.Exchange(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	b.store(b.storageKey(key, msg), msg, dnssec)
+	return &fetchResult{msg: msg, dnssec: dnssec}, nil
+}
+
+// subnetSuffix returns a cache-key suffix partitioning entries by the
+// querying client's subnet when ECS is enabled, so a CDN-tailored answer
+// built for one subnet is never served to a client in another. It's empty
+// when ECS is disabled or ctx carries no client address.
+func (b *Backend) subnetSuffix(ctx context.Context) string {
+	if !b.config.ECSEnabled {
+		return ""
+	}
+	clientAddr, ok := interfaces.ClientAddrFromContext(ctx)
+	if !ok {
+		return ""
+	}
+	prefix := b.config.ECSPrefixV4
+	if clientAddr.To4() == nil {
+		prefix = b.config.ECSPrefixV6
+	}
+	if subnet := ecs.Subnet(clientAddr, prefix); subnet != "" {
+		return subnetKeySep + subnet
+	}
+	return ""
+}
+
+// storageKey returns the key msg should actually be cached under: key as
+// computed for the request, unless msg carries an EDNS Client Subnet
+// SCOPE of 0, the RFC 7871 signal that the upstream's answer doesn't vary
+// by subnet - in which case the subnet suffix is dropped so every client
+// shares the one cached answer.
+func (b *Backend) storageKey(key string, msg *dns.Msg) string {
+	if subnet, ok := ecs.FromMsg(msg); ok && subnet.SourceScope == 0 {
+		if i := strings.Index(key, subnetKeySep); i >= 0 {
+			return key[:i]
+		}
+	}
+	return key
+}
+
+// refreshAsync triggers a background re-fetch of key once, coalescing
+// concurrent callers via singleflight the same way a foreground miss does.
+func (b *Backend) refreshAsync(key string, req *dns.Msg, q dns.Question) {
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), b.config.UpstreamTimeout)
+		defer cancel()
+
+		refreshReq := req.Copy()
+		refreshReq.Id = dns.Id()
+
+		_, err, _ := b.sf.Do(key+"-stale-refresh", func() (interface{}, error) {
+			return b.fetch(ctx, refreshReq, key)
+		})
+		if err != nil {
+			log.Printf("Background refresh failed for %s: %v", q.Name, err)
+		}
+	}()
+}
+
+func (b *Backend) lookup(key string) *entry {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return b.entries[key]
+}
+
+// store caches msg under key if it's eligible: a truncated response is
+// incomplete and must never poison the cache, and a transport-level
+// SERVFAIL isn't a stable answer worth caching.
+func (b *Backend) store(key string, msg *dns.Msg, dnssec interfaces.DNSSECStatus) {
+	if msg == nil || msg.Truncated || msg.Rcode == dns.RcodeServerFailure {
+		return
+	}
+
+	ttl := b.clampTTL(minTTL(msg))
+	now := time.Now()
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.entries[key] = &entry{
+		msg:        msg.Copy(),
+		dnssec:     dnssec,
+		expiry:     now.Add(ttl),
+		staleUntil: now.Add(ttl).Add(b.config.StaleWhileRevalidate),
+	}
+}
+
+// clampTTL ensures ttl falls within the configured min/max bounds.
+func (b *Backend) clampTTL(ttl time.Duration) time.Duration {
+	if b.config.CacheMaxTTL > 0 && ttl > b.config.CacheMaxTTL {
+		return b.config.CacheMaxTTL
+	}
+	if ttl < b.config.CacheMinTTL {
+		return b.config.CacheMinTTL
+	}
+	return ttl
+}
+
+// minTTL extracts the minimum TTL to cache msg for: the lowest TTL among its
+// answer records for a positive answer, or the SOA MINIMUM (per RFC 2308,
+// clamped to the SOA's own TTL) for a negative answer.
+func minTTL(msg *dns.Msg) time.Duration {
+	var ttl uint32
+
+	if len(msg.Answer) > 0 {
+		ttl = msg.Answer[0].Header().Ttl
+		for _, rr := range msg.Answer {
+			if rr.Header().Ttl < ttl {
+				ttl = rr.Header().Ttl
+			}
+		}
+	} else if len(msg.Ns) > 0 {
+		for _, rr := range msg.Ns {
+			if soa, ok := rr.(*dns.SOA); ok {
+				ttl = soa.Minttl
+				if rr.Header().Ttl < ttl {
+					ttl = rr.Header().Ttl
+				}
+				break
+			}
+		}
+	}
+
+	if ttl == 0 {
+		ttl = 60
+	}
+	return time.Duration(ttl) * time.Second
+}
+
+// reply returns a copy of cached stamped with req's message ID, so the same
+// cached entry can answer multiple distinct client requests.
+func reply(msg *dns.Msg, req *dns.Msg) *dns.Msg {
+	out := msg.Copy()
+	out.Id = req.Id
+	return out
+}
+
+// LastExchangeLatency delegates to the wrapped Backend when it reports its
+// own latency, satisfying interfaces.BackendLatencyObserver.
+func (b *Backend) LastExchangeLatency() time.Duration {
+	if observer, ok := b.next.(interfaces.BackendLatencyObserver); ok {
+		return observer.LastExchangeLatency()
+	}
+	return 0
+}
@@ -0,0 +1,126 @@
+package caching
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"dns-resolver/internal/config"
+	"dns-resolver/internal/interfaces"
+	"dns-resolver/internal/metrics"
+
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+)
+
+// countingBackend answers every query with an A record at the given TTL,
+// counting how many times Exchange was actually called so tests can assert
+// on cache hits/misses/coalescing.
+type countingBackend struct {
+	calls int32
+	ttl   uint32
+	rcode int
+}
+
+func (b *countingBackend) Exchange(ctx context.Context, req *dns.Msg) (*dns.Msg, interfaces.DNSSECStatus, error) {
+	atomic.AddInt32(&b.calls, 1)
+	q := req.Question[0]
+
+	m := new(dns.Msg)
+	m.SetReply(req)
+	m.Rcode = b.rcode
+
+	if b.rcode == dns.RcodeSuccess {
+		m.Answer = []dns.RR{&dns.A{
+			Hdr: dns.RR_Header{Name: q.Name, Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: b.ttl},
+		}}
+	} else if b.rcode == dns.RcodeNameError {
+		m.Ns = []dns.RR{&dns.SOA{
+			Hdr:    dns.RR_Header{Name: q.Name, Rrtype: dns.TypeSOA, Class: dns.ClassINET, Ttl: b.ttl},
+			Minttl: b.ttl,
+		}}
+	}
+	return m, interfaces.DNSSECInsecure, nil
+}
+
+func newTestConfig() *config.Config {
+	return &config.Config{
+		CacheMinTTL:          1 * time.Second,
+		CacheMaxTTL:          time.Hour,
+		StaleWhileRevalidate: 1 * time.Minute,
+		UpstreamTimeout:      2 * time.Second,
+	}
+}
+
+func testQuery() *dns.Msg {
+	req := new(dns.Msg)
+	req.SetQuestion("example.com.", dns.TypeA)
+	return req
+}
+
+func TestBackend_CachesPositiveAnswer(t *testing.T) {
+	next := &countingBackend{ttl: 300, rcode: dns.RcodeSuccess}
+	b := NewBackend(next, newTestConfig(), metrics.NewMetrics(newTestConfig()))
+
+	_, _, err := b.Exchange(context.Background(), testQuery())
+	assert.NoError(t, err)
+	_, _, err = b.Exchange(context.Background(), testQuery())
+	assert.NoError(t, err)
+
+	assert.Equal(t, int32(1), next.calls, "a second query within TTL should be served from cache")
+}
+
+func TestBackend_CachesNegativeAnswerUsingSOAMinimum(t *testing.T) {
+	next := &countingBackend{ttl: 300, rcode: dns.RcodeNameError}
+	b := NewBackend(next, newTestConfig(), metrics.NewMetrics(newTestConfig()))
+
+	resp, _, err := b.Exchange(context.Background(), testQuery())
+	assert.NoError(t, err)
+	assert.Equal(t, dns.RcodeNameError, resp.Rcode)
+
+	_, _, err = b.Exchange(context.Background(), testQuery())
+	assert.NoError(t, err)
+	assert.Equal(t, int32(1), next.calls, "an NXDOMAIN should be negatively cached for the SOA MINIMUM")
+}
+
+func TestBackend_ServesStaleWhileRevalidating(t *testing.T) {
+	cfg := newTestConfig()
+	cfg.CacheMinTTL = 0
+
+	next := &countingBackend{ttl: 1, rcode: dns.RcodeSuccess} // expires after 1s
+	b := NewBackend(next, cfg, metrics.NewMetrics(newTestConfig()))
+
+	_, _, err := b.Exchange(context.Background(), testQuery())
+	assert.NoError(t, err)
+	assert.Equal(t, int32(1), next.calls)
+
+	time.Sleep(1100 * time.Millisecond)
+
+	resp, _, err := b.Exchange(context.Background(), testQuery())
+	assert.NoError(t, err)
+	assert.Equal(t, dns.RcodeSuccess, resp.Rcode, "an expired-but-not-yet-stale-expired entry should still be served")
+
+	assert.Eventually(t, func() bool {
+		return atomic.LoadInt32(&next.calls) >= 2
+	}, time.Second, 10*time.Millisecond, "serving a stale answer should trigger an async refresh")
+}
+
+func TestBackend_CoalescesConcurrentMisses(t *testing.T) {
+	next := &countingBackend{ttl: 300, rcode: dns.RcodeSuccess}
+	b := NewBackend(next, newTestConfig(), metrics.NewMetrics(newTestConfig()))
+
+	const concurrency = 10
+	done := make(chan struct{}, concurrency)
+	for i := 0; i < concurrency; i++ {
+		go func() {
+			_, _, _ = b.Exchange(context.Background(), testQuery())
+			done <- struct{}{}
+		}()
+	}
+	for i := 0; i < concurrency; i++ {
+		<-done
+	}
+
+	assert.Equal(t, int32(1), next.calls, "concurrent identical misses should collapse into a single upstream call")
+}
@@ -0,0 +1,287 @@
+// Package failover implements an interfaces.Backend that tries its
+// children in a fixed, configured order, moving to the next one only when
+// the current one errors, answers too slowly, or its own circuit breaker
+// is currently open. It complements parallelbest's concurrent racing with
+// a cheaper sequential strategy for deployments that would rather not
+// double their upstream query volume on every lookup.
+package failover
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"dns-resolver/internal/config"
+	"dns-resolver/internal/interfaces"
+	"dns-resolver/internal/metrics"
+
+	"github.com/miekg/dns"
+)
+
+func init() {
+	interfaces.RegisterBackend("failover", func(cfg *config.Config) (interfaces.Backend, error) {
+		if len(cfg.FailoverBackends) < 2 {
+			return nil, fmt.Errorf("failover: FailoverBackends needs at least two registered backend names, got %d", len(cfg.FailoverBackends))
+		}
+
+		children := make([]Child, 0, len(cfg.FailoverBackends))
+		for _, name := range cfg.FailoverBackends {
+			b, err := interfaces.GetBackend(name, cfg)
+			if err != nil {
+				return nil, fmt.Errorf("failover: building child backend %q: %w", name, err)
+			}
+			children = append(children, Child{Name: name, Backend: b})
+		}
+		return NewBackend(children, metrics.NewMetrics(cfg)), nil
+	})
+}
+
+// ewmaAlpha weights each new latency/error sample against a child's
+// running average, the same weight parallelbest uses for its own EWMAs.
+const ewmaAlpha = 0.3
+
+const (
+	// minSamplesBeforeTrip keeps a cold child from tripping its own
+	// breaker off a single unlucky Exchange before it has built up a
+	// trustworthy error rate.
+	minSamplesBeforeTrip = 3
+	// errorRateTripThreshold opens a child's circuit breaker once its EWMA
+	// error rate crosses this fraction of recent Exchange attempts.
+	errorRateTripThreshold = 0.5
+	// rttTripMultiple opens a child's breaker if its EWMA RTT grows to this
+	// many multiples of the fastest child's, treating "too slow to be
+	// useful" the same as "erroring" for failover purposes.
+	rttTripMultiple = 5
+
+	// initialBackoff is how long a freshly tripped breaker stays open
+	// before allowing one half-open probe.
+	initialBackoff = 1 * time.Second
+	// maxBackoff caps the exponential backoff so a consistently broken
+	// child is still retried occasionally rather than abandoned forever.
+	maxBackoff = 2 * time.Minute
+)
+
+// Child pairs a Backend with the name it was registered under, so errors
+// and metrics can be attributed per-upstream.
+type Child struct {
+	Name    string
+	Backend interfaces.Backend
+}
+
+// breaker tracks one child's recent health and, once tripped, fails it
+// fast rather than spending a request's time budget on a child likely to
+// error or answer too slowly. backoff grows exponentially on each
+// consecutive trip and resets the moment the child produces a clean,
+// timely answer again.
+type breaker struct {
+	mu          sync.Mutex
+	errorEWMA   float64
+	latencyEWMA time.Duration
+	samples     int64
+	openUntil   time.Time
+	backoff     time.Duration
+}
+
+// allow reports whether the breaker currently permits an attempt: closed,
+// or open but its backoff window has elapsed (a half-open probe).
+func (b *breaker) allow(now time.Time) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return !now.Before(b.openUntil)
+}
+
+// record folds one Exchange outcome into the breaker's error/latency EWMAs
+// and trips (or resets) the breaker as appropriate. fastestRTT is the
+// current fastest known child's EWMA RTT, used to judge "too slow" trips;
+// it's zero until at least one child has a sample, in which case the RTT
+// check is skipped. It reports whether this call just tripped the breaker
+// (i.e. it was closed going in), so the caller can record a metric once
+// per trip rather than once per rejected attempt.
+func (b *breaker) record(now time.Time, latency time.Duration, failed bool, fastestRTT time.Duration) (tripped bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	errSample := 0.0
+	if failed {
+		errSample = 1.0
+	}
+	if b.samples == 0 {
+		b.latencyEWMA = latency
+		b.errorEWMA = errSample
+	} else {
+		b.latencyEWMA = time.Duration(ewmaAlpha*float64(latency) + (1-ewmaAlpha)*float64(b.latencyEWMA))
+		b.errorEWMA = ewmaAlpha*errSample + (1-ewmaAlpha)*b.errorEWMA
+	}
+	b.samples++
+
+	tooSlow := fastestRTT > 0 && b.latencyEWMA > fastestRTT*rttTripMultiple
+	tooErrorProne := b.samples >= minSamplesBeforeTrip && b.errorEWMA >= errorRateTripThreshold
+
+	if !failed && !tooSlow && !tooErrorProne {
+		wasOpen := !b.openUntil.IsZero()
+		b.openUntil = time.Time{}
+		b.backoff = 0
+		_ = wasOpen
+		return false
+	}
+
+	wasClosed := b.backoff == 0
+	if b.backoff == 0 {
+		b.backoff = initialBackoff
+	} else {
+		b.backoff *= 2
+		if b.backoff > maxBackoff {
+			b.backoff = maxBackoff
+		}
+	}
+	b.openUntil = now.Add(b.backoff)
+	return wasClosed
+}
+
+// Backend implements interfaces.Backend by trying its children in
+// configured order, skipping any whose circuit breaker is currently open,
+// and returning the first successful response. If every breaker happens to
+// be open, it probes the child soonest due to recover rather than failing
+// the query outright.
+type Backend struct {
+	children []Child
+	breakers map[string]*breaker
+	metrics  *metrics.Metrics
+
+	mu      sync.Mutex
+	lastRTT time.Duration
+}
+
+// NewBackend wraps children, trying them in order on every Exchange. m may
+// be nil, in which case per-child error/trip metrics are skipped.
+func NewBackend(children []Child, m *metrics.Metrics) *Backend {
+	breakers := make(map[string]*breaker, len(children))
+	for _, c := range children {
+		breakers[c.Name] = &breaker{}
+	}
+	return &Backend{
+		children: children,
+		breakers: breakers,
+		metrics:  m,
+	}
+}
+
+// Exchange tries each child in order, skipping any whose breaker is open,
+// and returns the first non-error, non-SERVFAIL response. If every
+// breaker is open, it falls back to probing the one soonest due to
+// recover so a simultaneous outage of every child doesn't refuse every
+// query outright.
+func (b *Backend) Exchange(ctx context.Context, req *dns.Msg) (*dns.Msg, interfaces.DNSSECStatus, error) {
+	now := time.Now()
+	fastestRTT := b.fastestRTT(now)
+
+	order := b.children
+	if !b.anyAllowed(now) {
+		order = []Child{b.soonestToRecover()}
+	}
+
+	var lastErr error
+	for _, c := range order {
+		brk := b.breakers[c.Name]
+		if !brk.allow(now) {
+			continue
+		}
+
+		start := time.Now()
+		msg, dnssec, err := c.Backend.Exchange(ctx, req)
+		latency := time.Since(start)
+		failed := err != nil || (msg != nil && msg.Rcode == dns.RcodeServerFailure)
+
+		if brk.record(time.Now(), latency, failed, fastestRTT) && b.metrics != nil {
+			b.metrics.IncrementCircuitBreakerTrips(c.Name)
+		}
+
+		if failed {
+			if err == nil {
+				err = fmt.Errorf("failover: backend %q returned SERVFAIL", c.Name)
+			}
+			lastErr = err
+			if b.metrics != nil {
+				b.metrics.IncrementBackendErrors(c.Name)
+			}
+			continue
+		}
+
+		b.mu.Lock()
+		b.lastRTT = latency
+		b.mu.Unlock()
+		return msg, dnssec, nil
+	}
+
+	if lastErr == nil {
+		lastErr = fmt.Errorf("failover: every backend's circuit breaker is open")
+	}
+	return nil, interfaces.DNSSECUnknown, lastErr
+}
+
+// anyAllowed reports whether at least one child's breaker currently
+// permits an attempt.
+func (b *Backend) anyAllowed(now time.Time) bool {
+	for _, c := range b.children {
+		if b.breakers[c.Name].allow(now) {
+			return true
+		}
+	}
+	return false
+}
+
+// soonestToRecover returns the child whose breaker's backoff window ends
+// first, for the all-breakers-open fallback probe.
+func (b *Backend) soonestToRecover() Child {
+	best := b.children[0]
+	bestUntil := b.breakers[best.Name].openUntilTime()
+	for _, c := range b.children[1:] {
+		if until := b.breakers[c.Name].openUntilTime(); until.Before(bestUntil) {
+			best, bestUntil = c, until
+		}
+	}
+	return best
+}
+
+// openUntilTime returns the time the breaker's current backoff window
+// ends, the zero time if it's closed.
+func (b *breaker) openUntilTime() time.Time {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.openUntil
+}
+
+// fastestRTT returns the lowest EWMA RTT among children that currently
+// have a closed breaker and at least one sample, or zero if none qualify.
+// A child whose breaker is open is excluded: its EWMA is typically
+// dragged low by fast failures rather than fast, successful answers, and
+// using it as the baseline would unfairly trip a healthy but merely
+// un-cached-yet child's own RTT check.
+func (b *Backend) fastestRTT(now time.Time) time.Duration {
+	var fastest time.Duration
+	for _, c := range b.children {
+		brk := b.breakers[c.Name]
+		if !brk.allow(now) {
+			continue
+		}
+		brk.mu.Lock()
+		rtt, samples := brk.latencyEWMA, brk.samples
+		brk.mu.Unlock()
+		if samples == 0 {
+			continue
+		}
+		if fastest == 0 || rtt < fastest {
+			fastest = rtt
+		}
+	}
+	return fastest
+}
+
+// LastExchangeLatency reports the winning child's round-trip time for the
+// last Exchange call, satisfying interfaces.BackendLatencyObserver.
+func (b *Backend) LastExchangeLatency() time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.lastRTT
+}
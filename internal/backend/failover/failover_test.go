@@ -0,0 +1,122 @@
+package failover
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"dns-resolver/internal/interfaces"
+
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+)
+
+// fixedBackend answers after delay, either with a fixed A record or err.
+type fixedBackend struct {
+	delay time.Duration
+	err   error
+}
+
+func (b *fixedBackend) Exchange(ctx context.Context, req *dns.Msg) (*dns.Msg, interfaces.DNSSECStatus, error) {
+	if b.delay > 0 {
+		time.Sleep(b.delay)
+	}
+	if b.err != nil {
+		return nil, interfaces.DNSSECUnknown, b.err
+	}
+	m := new(dns.Msg)
+	m.SetReply(req)
+	m.Answer = []dns.RR{&dns.A{Hdr: dns.RR_Header{Name: req.Question[0].Name, Rrtype: dns.TypeA, Class: dns.ClassINET}}}
+	return m, interfaces.DNSSECInsecure, nil
+}
+
+func testQuery() *dns.Msg {
+	req := new(dns.Msg)
+	req.SetQuestion("example.com.", dns.TypeA)
+	return req
+}
+
+func TestExchange_TriesChildrenInOrder(t *testing.T) {
+	first := &fixedBackend{}
+	second := &fixedBackend{err: errors.New("should not be reached")}
+	b := NewBackend([]Child{{Name: "first", Backend: first}, {Name: "second", Backend: second}}, nil)
+
+	msg, dnssec, err := b.Exchange(context.Background(), testQuery())
+	assert.NoError(t, err)
+	assert.Equal(t, interfaces.DNSSECInsecure, dnssec)
+	assert.NotNil(t, msg)
+}
+
+func TestExchange_FallsThroughToNextChildOnError(t *testing.T) {
+	failing := &fixedBackend{err: errors.New("upstream unreachable")}
+	ok := &fixedBackend{}
+	b := NewBackend([]Child{{Name: "failing", Backend: failing}, {Name: "ok", Backend: ok}}, nil)
+
+	msg, _, err := b.Exchange(context.Background(), testQuery())
+	assert.NoError(t, err)
+	assert.NotNil(t, msg)
+}
+
+func TestExchange_ReturnsErrorWhenAllChildrenFail(t *testing.T) {
+	a := &fixedBackend{err: errors.New("a failed")}
+	bb := &fixedBackend{err: errors.New("b failed")}
+	b := NewBackend([]Child{{Name: "a", Backend: a}, {Name: "b", Backend: bb}}, nil)
+
+	_, _, err := b.Exchange(context.Background(), testQuery())
+	assert.Error(t, err)
+}
+
+func TestExchange_SkipsOpenBreakerAndUsesNextChild(t *testing.T) {
+	failing := &fixedBackend{err: errors.New("down")}
+	ok := &fixedBackend{}
+	b := NewBackend([]Child{{Name: "failing", Backend: failing}, {Name: "ok", Backend: ok}}, nil)
+
+	// Trip "failing"'s breaker open.
+	for i := 0; i < minSamplesBeforeTrip; i++ {
+		_, _, err := b.Exchange(context.Background(), testQuery())
+		assert.NoError(t, err, "ok should always answer once tried")
+	}
+	assert.False(t, b.breakers["failing"].allow(time.Now()), "failing's breaker should be open by now")
+
+	// Further exchanges should go straight to "ok" without calling "failing"
+	// (we can't observe that directly, but the result must still succeed).
+	msg, _, err := b.Exchange(context.Background(), testQuery())
+	assert.NoError(t, err)
+	assert.NotNil(t, msg)
+}
+
+func TestBreaker_ReopensWithExponentialBackoff(t *testing.T) {
+	b := &breaker{}
+	now := time.Now()
+
+	b.record(now, time.Millisecond, true, 0)
+	firstBackoff := b.backoff
+
+	b.record(now, time.Millisecond, true, 0)
+	secondBackoff := b.backoff
+
+	assert.True(t, secondBackoff > firstBackoff, "backoff should grow on repeated trips")
+}
+
+func TestBreaker_ClosesAfterCleanAnswer(t *testing.T) {
+	b := &breaker{}
+	now := time.Now()
+
+	b.record(now, time.Millisecond, true, 0)
+	assert.False(t, b.allow(now), "breaker should be open right after tripping")
+
+	closed := now.Add(b.backoff + time.Millisecond)
+	tripped := b.record(closed, time.Millisecond, false, 0)
+	assert.False(t, tripped, "a clean answer must not count as a new trip")
+	assert.True(t, b.allow(closed), "breaker should close again after a clean answer")
+}
+
+func TestExchange_LastExchangeLatencyReportsWinningChild(t *testing.T) {
+	ok := &fixedBackend{delay: 5 * time.Millisecond}
+	b := NewBackend([]Child{{Name: "ok", Backend: ok}, {Name: "unused", Backend: &fixedBackend{}}}, nil)
+
+	_, _, err := b.Exchange(context.Background(), testQuery())
+	assert.NoError(t, err)
+	assert.True(t, b.LastExchangeLatency() >= 5*time.Millisecond)
+}
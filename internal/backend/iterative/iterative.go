@@ -0,0 +1,438 @@
+// Package iterative implements a from-scratch iterative interfaces.Backend:
+// instead of forwarding to a configured upstream resolver, it walks the
+// delegation chain itself starting at the root hints, the way a real
+// recursive resolver does. It performs its own CNAME chasing, QNAME
+// minimization, RFC 2308 negative caching, and RFC 8198 aggressive NSEC
+// reuse, and bounds how many upstream queries a single client query can
+// trigger with a work-queue semaphore.
+package iterative
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"dns-resolver/internal/cache"
+	"dns-resolver/internal/config"
+	"dns-resolver/internal/interfaces"
+
+	"github.com/miekg/dns"
+)
+
+func init() {
+	interfaces.RegisterBackend("iterative", func(cfg *config.Config) (interfaces.Backend, error) {
+		return NewBackend(cfg), nil
+	})
+}
+
+// defaultRootHints is the compiled-in IANA root server address list, used
+// whenever Config.RootHints is empty.
+var defaultRootHints = []string{
+	"198.41.0.4:53",     // a.root-servers.net
+	"199.9.14.201:53",   // b.root-servers.net
+	"192.33.4.12:53",    // c.root-servers.net
+	"199.7.91.13:53",    // d.root-servers.net
+	"192.203.230.10:53", // e.root-servers.net
+	"192.5.5.241:53",    // f.root-servers.net
+	"192.112.36.4:53",   // g.root-servers.net
+	"198.97.190.53:53",  // h.root-servers.net
+	"192.36.148.17:53",  // i.root-servers.net
+	"192.58.128.30:53",  // j.root-servers.net
+	"193.0.14.129:53",   // k.root-servers.net
+	"199.7.83.42:53",    // l.root-servers.net
+	"202.12.27.33:53",   // m.root-servers.net
+}
+
+const (
+	// maxReferrals bounds the number of delegation hops a single name's
+	// resolution may take, guarding against referral loops.
+	maxReferrals = 20
+	// maxCNAMEChase bounds how many CNAMEs Exchange follows for one query.
+	maxCNAMEChase = 16
+	// maxNSResolveDepth bounds how deeply resolveNSAddrs may recurse into
+	// resolveOne to resolve a glueless nameserver's own address, guarding
+	// against nameservers that delegate to each other in a cycle.
+	maxNSResolveDepth = 4
+)
+
+type nsDepthKey struct{}
+
+// negEntry is a cached negative (NXDOMAIN/NODATA) answer, TTL-bounded per
+// RFC 2308 by the SOA MINIMUM seen in the authority section of the response
+// that produced it.
+type negEntry struct {
+	rcode  int
+	expiry time.Time
+}
+
+// Backend is a pure-Go iterative resolver: it starts at the root hints and
+// follows referrals down to an authoritative answer rather than trusting a
+// single upstream to do that work. DNSSEC chain-of-trust validation is left
+// to the "validating" backend when composed in front of this one.
+type Backend struct {
+	rootHints         []string
+	client            *dns.Client
+	queryTimeout      time.Duration
+	qnameMinimization bool
+
+	sem chan struct{} // bounded work queue: caps concurrent in-flight upstream queries
+
+	nsecCache  *cache.NsecCache
+	nsec3Cache *cache.NSEC3Cache
+
+	mu  sync.Mutex
+	neg map[string]negEntry // RFC 2308 negative cache, keyed by negKey(qname, qtype)
+}
+
+// NewBackend builds an iterative Backend from cfg, falling back to the
+// compiled-in root hints and sane defaults when cfg leaves the relevant
+// fields empty/zero.
+func NewBackend(cfg *config.Config) *Backend {
+	hints := cfg.RootHints
+	if len(hints) == 0 {
+		hints = defaultRootHints
+	}
+
+	concurrency := cfg.IterativeMaxConcurrency
+	if concurrency <= 0 {
+		concurrency = 20
+	}
+
+	timeout := cfg.IterativeQueryTimeout
+	if timeout <= 0 {
+		timeout = 3 * time.Second
+	}
+
+	return &Backend{
+		rootHints:         hints,
+		client:            &dns.Client{Net: "udp", Timeout: timeout},
+		queryTimeout:      timeout,
+		qnameMinimization: !cfg.QNAMEMinimizationDisabled,
+		sem:               make(chan struct{}, concurrency),
+		nsecCache:         cache.NewNsecCache(cfg),
+		nsec3Cache:        cache.NewNSEC3Cache(cfg),
+		neg:               make(map[string]negEntry),
+	}
+}
+
+// Exchange resolves req iteratively, chasing any CNAMEs it encounters, and
+// returns a fully-formed reply. It always reports DNSSECInsecure: this
+// backend verifies the delegation structure but no signatures, trusting
+// whatever wraps it (see internal/backend/validating) to do that.
+func (b *Backend) Exchange(ctx context.Context, req *dns.Msg) (*dns.Msg, interfaces.DNSSECStatus, error) {
+	if len(req.Question) == 0 {
+		return nil, interfaces.DNSSECUnknown, fmt.Errorf("iterative: request has no question")
+	}
+	q := req.Question[0]
+
+	resp := new(dns.Msg)
+	resp.SetReply(req)
+	resp.RecursionAvailable = true
+
+	qname := dns.Fqdn(q.Name)
+	visited := map[string]bool{}
+
+	for hop := 0; ; hop++ {
+		if hop >= maxCNAMEChase {
+			resp.Rcode = dns.RcodeServerFailure
+			return resp, interfaces.DNSSECUnknown, fmt.Errorf("iterative: CNAME chain too long resolving %s", q.Name)
+		}
+		if visited[qname] {
+			resp.Rcode = dns.RcodeServerFailure
+			return resp, interfaces.DNSSECUnknown, fmt.Errorf("iterative: CNAME loop detected at %s", qname)
+		}
+		visited[qname] = true
+
+		step, err := b.resolveOne(ctx, qname, q.Qtype)
+		if err != nil {
+			resp.Rcode = dns.RcodeServerFailure
+			return resp, interfaces.DNSSECUnknown, err
+		}
+
+		resp.Answer = append(resp.Answer, step.Answer...)
+		resp.Ns = step.Ns
+		resp.Extra = step.Extra
+		resp.Rcode = step.Rcode
+
+		var next string
+		if q.Qtype != dns.TypeCNAME {
+			for _, rr := range step.Answer {
+				if cn, ok := rr.(*dns.CNAME); ok && strings.EqualFold(rr.Header().Name, qname) {
+					next = cn.Target
+					break
+				}
+			}
+		}
+		if next == "" {
+			break
+		}
+		qname = dns.Fqdn(next)
+	}
+
+	return resp, interfaces.DNSSECUnknown, nil
+}
+
+// resolveOne resolves a single (non-CNAME-chased) qname/qtype pair by
+// walking referrals from the root hints down to an authoritative answer,
+// minimizing the query name sent at each intermediate hop unless
+// qnameMinimization is disabled.
+func (b *Backend) resolveOne(ctx context.Context, qname string, qtype uint16) (*dns.Msg, error) {
+	key := negKey(qname, qtype)
+	if m, ok := b.negativeCached(key); ok {
+		return m, nil
+	}
+	// This backend never sets the DO bit on its own upstream queries (see
+	// queryServers), so it has no RRSIGs to offer back regardless of the
+	// original request's DO bit.
+	nsecQuestion := dns.Question{Name: qname, Qtype: qtype, Qclass: dns.ClassINET}
+	if cached, ok := b.nsecCache.Check(nsecQuestion, false); ok {
+		return cached, nil
+	}
+	if cached, ok := b.nsec3Cache.Check(nsecQuestion, false); ok {
+		return cached, nil
+	}
+
+	labels := dns.SplitDomainName(qname)
+	servers := b.rootHints
+	depth := 0 // labels of qname confirmed to belong to the current servers' zone
+
+	for hop := 0; hop < maxReferrals; hop++ {
+		queryName, queryType := qname, qtype
+		minimized := depth < len(labels) && b.qnameMinimization
+		if minimized {
+			queryName = dns.Fqdn(strings.Join(labels[len(labels)-depth-1:], "."))
+			queryType = dns.TypeNS
+		}
+
+		resp, _, err := b.queryServers(ctx, servers, queryName, queryType)
+		if err != nil {
+			return nil, err
+		}
+
+		if !minimized {
+			b.handleTerminal(qname, qtype, resp)
+			return resp, nil
+		}
+
+		switch {
+		case resp.Rcode == dns.RcodeNameError:
+			// The ancestor the minimized probe asked about doesn't exist,
+			// so qname can't exist either.
+			b.handleTerminal(qname, qtype, resp)
+			out := new(dns.Msg)
+			out.Rcode = dns.RcodeNameError
+			out.Ns = resp.Ns
+			return out, nil
+		default:
+			nsNames, addrs := extractReferral(resp)
+			if len(nsNames) > 0 {
+				if len(addrs) == 0 {
+					addrs, err = b.resolveNSAddrs(ctx, nsNames)
+					if err != nil || len(addrs) == 0 {
+						return nil, fmt.Errorf("iterative: could not resolve nameserver addresses for %s: %w", qname, err)
+					}
+				}
+				servers = addrs
+				depth++
+				continue
+			}
+			if resp.Authoritative {
+				// Current servers are authoritative this deep but don't
+				// delegate any further; probe one label deeper against them.
+				depth++
+				continue
+			}
+			// Neither a referral nor an authoritative answer (e.g. a strict
+			// server refused the bare minimized NS query): fall back to a
+			// direct, non-minimized query so one picky hop doesn't stall
+			// the whole resolution.
+			resp2, _, err := b.queryServers(ctx, servers, qname, qtype)
+			if err != nil {
+				return nil, err
+			}
+			b.handleTerminal(qname, qtype, resp2)
+			return resp2, nil
+		}
+	}
+
+	return nil, fmt.Errorf("iterative: referral limit exceeded resolving %s", qname)
+}
+
+// resolveNSAddrs resolves the address of the first of nsNames it can, for
+// referrals that arrived without glue in the Additional section. It is
+// bounded by maxNSResolveDepth via ctx so nameservers that delegate to each
+// other in a cycle don't recurse forever.
+func (b *Backend) resolveNSAddrs(ctx context.Context, nsNames []string) ([]string, error) {
+	depth, _ := ctx.Value(nsDepthKey{}).(int)
+	if depth >= maxNSResolveDepth {
+		return nil, fmt.Errorf("nameserver resolution nested too deep")
+	}
+	ctx = context.WithValue(ctx, nsDepthKey{}, depth+1)
+
+	var lastErr error
+	for _, name := range nsNames {
+		resp, err := b.resolveOne(ctx, dns.Fqdn(name), dns.TypeA)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		var addrs []string
+		for _, rr := range resp.Answer {
+			if a, ok := rr.(*dns.A); ok {
+				addrs = append(addrs, net.JoinHostPort(a.A.String(), "53"))
+			}
+		}
+		if len(addrs) > 0 {
+			return addrs, nil
+		}
+	}
+	if lastErr == nil {
+		lastErr = fmt.Errorf("no address found for %v", nsNames)
+	}
+	return nil, lastErr
+}
+
+// queryServers tries each server in order, acquiring a work-queue slot for
+// each attempt, and returns the first one that answers at all (including a
+// referral or error Rcode - only a transport failure moves on to the next
+// server).
+func (b *Backend) queryServers(ctx context.Context, servers []string, qname string, qtype uint16) (*dns.Msg, string, error) {
+	m := new(dns.Msg)
+	m.SetQuestion(qname, qtype)
+	m.SetEdns0(4096, false)
+
+	var lastErr error
+	for _, srv := range servers {
+		if err := b.acquire(ctx); err != nil {
+			return nil, "", err
+		}
+		qctx, cancel := context.WithTimeout(ctx, b.queryTimeout)
+		in, _, err := b.client.ExchangeContext(qctx, m, srv)
+		cancel()
+		b.release()
+
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		return in, srv, nil
+	}
+	return nil, "", fmt.Errorf("no reachable server for %s %s: %w", qname, dns.TypeToString[qtype], lastErr)
+}
+
+// acquire blocks until a work-queue slot is free or ctx is done, bounding
+// how many upstream queries this backend has in flight at once.
+func (b *Backend) acquire(ctx context.Context) error {
+	select {
+	case b.sem <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (b *Backend) release() { <-b.sem }
+
+// handleTerminal records the RFC 2308 negative-cache entry and any NSEC
+// denial proof for a terminal (queryName == qname) response; it's a no-op
+// for a positive answer.
+func (b *Backend) handleTerminal(qname string, qtype uint16, resp *dns.Msg) {
+	if resp.Rcode == dns.RcodeSuccess && len(resp.Answer) > 0 {
+		return
+	}
+
+	var soaTTL uint32
+	var zone string
+	haveSOA := false
+	var nsecs []*dns.NSEC
+	var nsec3s []*dns.NSEC3
+	for _, rr := range resp.Ns {
+		switch v := rr.(type) {
+		case *dns.SOA:
+			ttl := v.Hdr.Ttl
+			if v.Minttl < ttl {
+				ttl = v.Minttl
+			}
+			soaTTL = ttl
+			haveSOA = true
+			zone = v.Hdr.Name
+		case *dns.NSEC:
+			nsecs = append(nsecs, v)
+		case *dns.NSEC3:
+			nsec3s = append(nsec3s, v)
+		}
+	}
+	// No RRSIGs to carry and never validated (see the DO comment in
+	// resolveOne), so these entries are never eligible for aggressive
+	// synthesis; they're cached purely so a future Add with a secure proof
+	// has somewhere to land. Added after the loop above so soaTTL is known
+	// regardless of where the SOA fell relative to the NSEC/NSEC3 records.
+	for _, v := range nsecs {
+		if zone != "" {
+			b.nsecCache.Add(zone, v, nil, false, soaTTL)
+		}
+	}
+	for _, v := range nsec3s {
+		b.nsec3Cache.Add(v, nil, false, soaTTL)
+	}
+	if !haveSOA {
+		return
+	}
+
+	b.mu.Lock()
+	b.neg[negKey(qname, qtype)] = negEntry{rcode: resp.Rcode, expiry: time.Now().Add(time.Duration(soaTTL) * time.Second)}
+	b.mu.Unlock()
+}
+
+// negativeCached returns the cached negative answer for key, if any and
+// still fresh.
+func (b *Backend) negativeCached(key string) (*dns.Msg, bool) {
+	b.mu.Lock()
+	e, ok := b.neg[key]
+	if ok && time.Now().After(e.expiry) {
+		delete(b.neg, key)
+		ok = false
+	}
+	b.mu.Unlock()
+	if !ok {
+		return nil, false
+	}
+	m := new(dns.Msg)
+	m.Rcode = e.rcode
+	return m, true
+}
+
+// extractReferral pulls the delegated nameserver names out of resp.Ns and
+// any matching glue addresses out of resp.Extra.
+func extractReferral(resp *dns.Msg) (nsNames, addrs []string) {
+	glue := map[string][]string{}
+	for _, rr := range resp.Extra {
+		switch v := rr.(type) {
+		case *dns.A:
+			name := strings.ToLower(v.Hdr.Name)
+			glue[name] = append(glue[name], net.JoinHostPort(v.A.String(), "53"))
+		case *dns.AAAA:
+			name := strings.ToLower(v.Hdr.Name)
+			glue[name] = append(glue[name], net.JoinHostPort(v.AAAA.String(), "53"))
+		}
+	}
+
+	for _, rr := range resp.Ns {
+		ns, ok := rr.(*dns.NS)
+		if !ok {
+			continue
+		}
+		nsNames = append(nsNames, ns.Ns)
+		if a, ok := glue[strings.ToLower(ns.Ns)]; ok {
+			addrs = append(addrs, a...)
+		}
+	}
+	return nsNames, addrs
+}
+
+func negKey(qname string, qtype uint16) string {
+	return strings.ToLower(qname) + "|" + dns.TypeToString[qtype]
+}
@@ -0,0 +1,130 @@
+package iterative
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"dns-resolver/internal/config"
+
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+)
+
+// newTestServer starts a UDP DNS server on laddr running handler, for
+// building a tiny fake root/TLD/authoritative hierarchy in tests. A glue A
+// record only ever carries an IP, never a port - extractReferral assumes
+// port 53 like a real resolver would - so any server a test wants to be
+// reachable via glue must bind port 53 on its own loopback IP; only root
+// hints (which carry an explicit port) can use an arbitrary one.
+func newTestServer(t *testing.T, laddr string, handler dns.HandlerFunc) *dns.Server {
+	t.Helper()
+
+	pc, err := net.ListenPacket("udp", laddr)
+	assert.NoError(t, err)
+
+	srv := &dns.Server{PacketConn: pc, Handler: handler}
+	go srv.ActivateAndServe()
+	t.Cleanup(func() { srv.Shutdown() })
+	return srv
+}
+
+func addr(srv *dns.Server) string {
+	return srv.PacketConn.LocalAddr().String()
+}
+
+// TestResolveOne_WalksReferralChainToAnswer builds a fake root -> TLD ->
+// authoritative hierarchy and checks the iterative backend walks all the
+// way down to the final answer, following glue at each referral.
+func TestResolveOne_WalksReferralChainToAnswer(t *testing.T) {
+	const authIP, tldIP = "127.0.0.2", "127.0.0.3"
+
+	auth := newTestServer(t, authIP+":53", func(w dns.ResponseWriter, r *dns.Msg) {
+		m := new(dns.Msg)
+		m.SetReply(r)
+		m.Authoritative = true
+		if r.Question[0].Qtype == dns.TypeA && r.Question[0].Name == "www.example.com." {
+			rr, _ := dns.NewRR("www.example.com. 300 IN A 5.6.7.8")
+			m.Answer = append(m.Answer, rr)
+		}
+		w.WriteMsg(m)
+	})
+	_ = auth
+
+	tld := newTestServer(t, tldIP+":53", func(w dns.ResponseWriter, r *dns.Msg) {
+		m := new(dns.Msg)
+		m.SetReply(r)
+		ns, _ := dns.NewRR("example.com. 300 IN NS ns1.example.com.")
+		glue, _ := dns.NewRR("ns1.example.com. 300 IN A " + authIP)
+		m.Ns = append(m.Ns, ns)
+		m.Extra = append(m.Extra, glue)
+		w.WriteMsg(m)
+	})
+	_ = tld
+
+	root := newTestServer(t, "127.0.0.1:0", func(w dns.ResponseWriter, r *dns.Msg) {
+		m := new(dns.Msg)
+		m.SetReply(r)
+		ns, _ := dns.NewRR("com. 300 IN NS a.gtld-servers.net.")
+		glue, _ := dns.NewRR("a.gtld-servers.net. 300 IN A " + tldIP)
+		m.Ns = append(m.Ns, ns)
+		m.Extra = append(m.Extra, glue)
+		w.WriteMsg(m)
+	})
+
+	b := NewBackend(&config.Config{
+		RootHints:             []string{addr(root)},
+		IterativeQueryTimeout: 2 * time.Second,
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	resp, err := b.resolveOne(ctx, "www.example.com.", dns.TypeA)
+	assert.NoError(t, err)
+	assert.Equal(t, dns.RcodeSuccess, resp.Rcode)
+	assert.Len(t, resp.Answer, 1)
+	a, ok := resp.Answer[0].(*dns.A)
+	assert.True(t, ok)
+	assert.Equal(t, "5.6.7.8", a.A.String())
+}
+
+// TestResolveOne_CachesNegativeAnswerPerRFC2308 checks that an NXDOMAIN
+// carrying a SOA is cached and served without a second round of queries.
+func TestResolveOne_CachesNegativeAnswerPerRFC2308(t *testing.T) {
+	var queries int
+	auth := newTestServer(t, "127.0.0.1:0", func(w dns.ResponseWriter, r *dns.Msg) {
+		queries++
+		m := new(dns.Msg)
+		m.SetReply(r)
+		m.Authoritative = true
+		m.Rcode = dns.RcodeNameError
+		soa, _ := dns.NewRR("example.com. 300 IN SOA ns1.example.com. hostmaster.example.com. 1 7200 3600 1209600 60")
+		m.Ns = append(m.Ns, soa)
+		w.WriteMsg(m)
+	})
+
+	b := NewBackend(&config.Config{
+		RootHints:                 []string{addr(auth)},
+		QNAMEMinimizationDisabled: true,
+		IterativeQueryTimeout:     2 * time.Second,
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	resp, err := b.resolveOne(ctx, "nope.example.com.", dns.TypeA)
+	assert.NoError(t, err)
+	assert.Equal(t, dns.RcodeNameError, resp.Rcode)
+
+	resp2, err := b.resolveOne(ctx, "nope.example.com.", dns.TypeA)
+	assert.NoError(t, err)
+	assert.Equal(t, dns.RcodeNameError, resp2.Rcode)
+
+	assert.Equal(t, 1, queries, "second lookup should be served from the RFC 2308 negative cache, not a new query")
+}
+
+func TestNegKey_DistinguishesQtype(t *testing.T) {
+	assert.NotEqual(t, negKey("example.com.", dns.TypeA), negKey("example.com.", dns.TypeAAAA))
+}
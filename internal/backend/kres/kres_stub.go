@@ -5,12 +5,19 @@ package kres
 import (
     "context"
 
+    "dns-resolver/internal/config"
     "dns-resolver/internal/interfaces"
     "dns-resolver/internal/metrics"
 
     "github.com/miekg/dns"
 )
 
+func init() {
+    interfaces.RegisterBackend("kres", func(cfg *config.Config) (interfaces.Backend, error) {
+        return New(cfg, nil), nil
+    })
+}
+
 // Backend is a placeholder for libkres-based implementation.
 type Backend struct{}
 
@@ -0,0 +1,83 @@
+// Package multi implements a Backend that forwards each query to one of
+// several named child backends chosen by the query name's longest
+// configured zone suffix, falling back to a default backend for everything
+// else - the same split ncdns uses to mix a custom backend with a
+// recursive fallback, and a natural fit for routing local authoritative
+// zones to the "authoritative" backend while the rest of the namespace
+// recurses through e.g. "unbound".
+package multi
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"dns-resolver/internal/config"
+	"dns-resolver/internal/interfaces"
+
+	"github.com/miekg/dns"
+)
+
+func init() {
+	interfaces.RegisterBackend("multi", func(cfg *config.Config) (interfaces.Backend, error) {
+		return NewFromConfig(cfg)
+	})
+}
+
+// route pairs a zone suffix with the backend that answers it.
+type route struct {
+	suffix  string // FQDN
+	backend interfaces.Backend
+}
+
+// Backend dispatches Exchange to a child interfaces.Backend by zone suffix.
+type Backend struct {
+	routes   []route // sorted longest suffix first, so the most specific zone wins
+	fallback interfaces.Backend
+}
+
+// NewFromConfig builds a Backend from cfg.MultiBackendZones (zone suffix ->
+// registered backend name) and cfg.MultiBackendDefault (the fallback
+// backend name), looking up every named child in the shared interfaces
+// registry. It errors if MultiBackendDefault is empty or any named backend
+// isn't registered.
+func NewFromConfig(cfg *config.Config) (*Backend, error) {
+	if cfg.MultiBackendDefault == "" {
+		return nil, fmt.Errorf("multi: MultiBackendDefault must name a registered backend")
+	}
+	fallback, err := interfaces.GetBackend(cfg.MultiBackendDefault, cfg)
+	if err != nil {
+		return nil, fmt.Errorf("multi: default backend %q: %w", cfg.MultiBackendDefault, err)
+	}
+
+	routes := make([]route, 0, len(cfg.MultiBackendZones))
+	for suffix, name := range cfg.MultiBackendZones {
+		b, err := interfaces.GetBackend(name, cfg)
+		if err != nil {
+			return nil, fmt.Errorf("multi: zone %q backend %q: %w", suffix, name, err)
+		}
+		routes = append(routes, route{suffix: dns.Fqdn(strings.ToLower(suffix)), backend: b})
+	}
+	sort.Slice(routes, func(i, j int) bool { return len(routes[i].suffix) > len(routes[j].suffix) })
+
+	return &Backend{routes: routes, fallback: fallback}, nil
+}
+
+// Exchange forwards req to the child backend whose configured zone is the
+// longest suffix of the query name, or to the default backend if none match.
+// routes is kept sorted longest-suffix-first by NewFromConfig, so the first
+// match here is already the most specific one.
+func (b *Backend) Exchange(ctx context.Context, req *dns.Msg) (*dns.Msg, interfaces.DNSSECStatus, error) {
+	if len(req.Question) == 0 {
+		return b.fallback.Exchange(ctx, req)
+	}
+
+	name := dns.Fqdn(strings.ToLower(req.Question[0].Name))
+	for _, r := range b.routes {
+		if dns.IsSubDomain(r.suffix, name) {
+			return r.backend.Exchange(ctx, req)
+		}
+	}
+	return b.fallback.Exchange(ctx, req)
+}
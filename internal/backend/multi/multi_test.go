@@ -0,0 +1,105 @@
+package multi
+
+import (
+	"context"
+	"testing"
+
+	"dns-resolver/internal/config"
+	"dns-resolver/internal/interfaces"
+
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+)
+
+func init() {
+	interfaces.RegisterBackend("multi-test-zone", func(cfg *config.Config) (interfaces.Backend, error) {
+		return &namedBackend{name: "zone"}, nil
+	})
+	interfaces.RegisterBackend("multi-test-fallback", func(cfg *config.Config) (interfaces.Backend, error) {
+		return &namedBackend{name: "fallback"}, nil
+	})
+}
+
+// namedBackend answers every query with an A record tagged by name, so
+// tests can tell which child handled a query.
+type namedBackend struct {
+	name string
+}
+
+func (b *namedBackend) Exchange(_ context.Context, req *dns.Msg) (*dns.Msg, interfaces.DNSSECStatus, error) {
+	m := new(dns.Msg)
+	m.SetReply(req)
+	m.Answer = []dns.RR{&dns.TXT{
+		Hdr: dns.RR_Header{Name: req.Question[0].Name, Rrtype: dns.TypeTXT, Class: dns.ClassINET},
+		Txt: []string{b.name},
+	}}
+	return m, interfaces.DNSSECInsecure, nil
+}
+
+func query(name string) *dns.Msg {
+	req := new(dns.Msg)
+	req.SetQuestion(dns.Fqdn(name), dns.TypeA)
+	return req
+}
+
+func answeredBy(t *testing.T, msg *dns.Msg) string {
+	t.Helper()
+	txt, ok := msg.Answer[0].(*dns.TXT)
+	if !ok {
+		t.Fatalf("expected a TXT answer, got %T", msg.Answer[0])
+	}
+	return txt.Txt[0]
+}
+
+func TestExchange_RoutesByLongestZoneSuffix(t *testing.T) {
+	b := &Backend{
+		// routes must be longest-suffix-first, the invariant NewFromConfig
+		// maintains; Exchange returns the first match.
+		routes: []route{
+			{suffix: "internal.example.com.", backend: &namedBackend{name: "subzone"}},
+			{suffix: "example.com.", backend: &namedBackend{name: "zone"}},
+		},
+		fallback: &namedBackend{name: "fallback"},
+	}
+
+	msg, _, err := b.Exchange(context.Background(), query("host.internal.example.com."))
+	assert.NoError(t, err)
+	assert.Equal(t, "subzone", answeredBy(t, msg), "the more specific zone should win over its parent")
+
+	msg, _, err = b.Exchange(context.Background(), query("host.example.com."))
+	assert.NoError(t, err)
+	assert.Equal(t, "zone", answeredBy(t, msg))
+}
+
+func TestExchange_FallsBackOutsideConfiguredZones(t *testing.T) {
+	b := &Backend{
+		routes:   []route{{suffix: "example.com.", backend: &namedBackend{name: "zone"}}},
+		fallback: &namedBackend{name: "fallback"},
+	}
+
+	msg, _, err := b.Exchange(context.Background(), query("unrelated.net."))
+	assert.NoError(t, err)
+	assert.Equal(t, "fallback", answeredBy(t, msg))
+}
+
+func TestNewFromConfig_SortsRoutesLongestSuffixFirst(t *testing.T) {
+	b, err := NewFromConfig(&config.Config{
+		MultiBackendZones: map[string]string{
+			"example.com.":          "multi-test-zone",
+			"internal.example.com.": "multi-test-zone",
+		},
+		MultiBackendDefault: "multi-test-fallback",
+	})
+	if err != nil {
+		t.Fatalf("NewFromConfig returned error: %v", err)
+	}
+	if len(b.routes) != 2 {
+		t.Fatalf("expected 2 routes, got %d", len(b.routes))
+	}
+	assert.Equal(t, "internal.example.com.", b.routes[0].suffix, "the longer zone suffix should sort first")
+}
+
+func TestNewFromConfig_RequiresDefaultBackend(t *testing.T) {
+	_, err := NewFromConfig(&config.Config{})
+	assert.Error(t, err)
+}
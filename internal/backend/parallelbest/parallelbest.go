@@ -0,0 +1,233 @@
+// Package parallelbest implements an interfaces.Backend that races its two
+// fastest-known children for each query, on the theory that a second
+// upstream query costs far less than waiting out a slow or unhealthy one.
+// It complements the singleflight-based coalescer in caching.Backend: that
+// one deduplicates identical in-flight queries against the *same* upstream,
+// while parallelbest races *different* upstreams for one query.
+package parallelbest
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+
+	"dns-resolver/internal/config"
+	"dns-resolver/internal/interfaces"
+	"dns-resolver/internal/metrics"
+
+	"github.com/miekg/dns"
+)
+
+func init() {
+	interfaces.RegisterBackend("parallel_best", func(cfg *config.Config) (interfaces.Backend, error) {
+		if len(cfg.ParallelBestBackends) < 2 {
+			return nil, fmt.Errorf("parallelbest: ParallelBestBackends needs at least two registered backend names, got %d", len(cfg.ParallelBestBackends))
+		}
+
+		children := make([]Child, 0, len(cfg.ParallelBestBackends))
+		for _, name := range cfg.ParallelBestBackends {
+			b, err := interfaces.GetBackend(name, cfg)
+			if err != nil {
+				return nil, fmt.Errorf("parallelbest: building child backend %q: %w", name, err)
+			}
+			children = append(children, Child{Name: name, Backend: b})
+		}
+		return NewBackend(children, metrics.NewMetrics(cfg)), nil
+	})
+}
+
+// ewmaAlpha weights each new latency/error sample against a child's
+// running average; higher reacts faster to a child getting slow or flaky,
+// lower smooths out one-off blips.
+const ewmaAlpha = 0.3
+
+// minSamplesForEWMA is how many Exchange calls a child needs before its
+// EWMA is trusted to pick candidates; until then children are tried
+// round-robin so a fresh child isn't starved by an established one's head
+// start.
+const minSamplesForEWMA = 5
+
+// probeInterval controls how often pickCandidates swaps the usual runner-up
+// for a random non-top child, once ranking is warmed up. Without this, a
+// child that's fallen out of the top two never gets raced again even after
+// it recovers, since its EWMA only updates on races it's included in. One
+// probe in every probeInterval queries is enough to notice a recovery
+// without meaningfully diluting the latency benefit of racing the best two.
+const probeInterval = 20
+
+// Child pairs a Backend with the name it was registered under, so stats
+// and metrics can be reported per-upstream.
+type Child struct {
+	Name    string
+	Backend interfaces.Backend
+}
+
+// stat is a child's running performance estimate.
+type stat struct {
+	latencyEWMA time.Duration
+	errorEWMA   float64 // 0 (always succeeds) .. 1 (always errors)
+	samples     int64
+}
+
+// Backend implements interfaces.Backend by firing each query at the two
+// children with the best recent EWMA of latency and error rate, and
+// returning whichever produces a usable answer first. The loser's result
+// is discarded (but still used to update its stats) once a winner lands.
+type Backend struct {
+	children []Child
+	metrics  *metrics.Metrics
+
+	mu         sync.Mutex
+	stats      map[string]*stat
+	rrNext     int64 // next child index to try while stats are still warming up
+	lastRTT    time.Duration
+	queryCount int64 // total Exchange calls, used to pace the self-healing probe
+}
+
+// NewBackend wraps children, racing the best two of them per query. m may
+// be nil, in which case per-upstream race-win metrics are skipped.
+func NewBackend(children []Child, m *metrics.Metrics) *Backend {
+	stats := make(map[string]*stat, len(children))
+	for _, c := range children {
+		stats[c.Name] = &stat{}
+	}
+	return &Backend{
+		children: children,
+		metrics:  m,
+		stats:    stats,
+	}
+}
+
+// result is one child's outcome, tagged with its name so the caller can
+// attribute stats and metrics after the race.
+type result struct {
+	name    string
+	msg     *dns.Msg
+	dnssec  interfaces.DNSSECStatus
+	err     error
+	latency time.Duration
+}
+
+// Exchange races the two best-known candidate children and returns the
+// first one to produce a valid (non-error) answer.
+func (b *Backend) Exchange(ctx context.Context, req *dns.Msg) (*dns.Msg, interfaces.DNSSECStatus, error) {
+	candidates := b.pickCandidates()
+
+	raceCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	resCh := make(chan result, len(candidates))
+	for _, c := range candidates {
+		c := c
+		go func() {
+			start := time.Now()
+			msg, dnssec, err := c.Backend.Exchange(raceCtx, req)
+			resCh <- result{name: c.Name, msg: msg, dnssec: dnssec, err: err, latency: time.Since(start)}
+		}()
+	}
+
+	var firstErr error
+	for i := 0; i < len(candidates); i++ {
+		r := <-resCh
+		b.record(r.name, r.latency, r.err != nil)
+
+		if r.err != nil {
+			if firstErr == nil {
+				firstErr = r.err
+			}
+			continue
+		}
+
+		b.mu.Lock()
+		b.lastRTT = r.latency
+		b.mu.Unlock()
+		if b.metrics != nil {
+			b.metrics.IncrementParallelBestWins(r.name)
+		}
+		cancel() // stop waiting on whichever candidate hasn't answered yet
+		return r.msg, r.dnssec, nil
+	}
+
+	return nil, interfaces.DNSSECUnknown, firstErr
+}
+
+// pickCandidates returns the two children to race for the next query: the
+// two with the lowest (latency * (1 + errorEWMA)) score once every child
+// has at least minSamplesForEWMA samples, otherwise the next two in
+// round-robin order so a cold child gets a chance to build up stats.
+func (b *Backend) pickCandidates() []Child {
+	if len(b.children) <= 2 {
+		return b.children
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for _, c := range b.children {
+		if b.stats[c.Name].samples < minSamplesForEWMA {
+			first := b.children[b.rrNext%int64(len(b.children))]
+			second := b.children[(b.rrNext+1)%int64(len(b.children))]
+			b.rrNext++
+			return []Child{first, second}
+		}
+	}
+
+	best := append([]Child{}, b.children...)
+	sortByScore(best, b.stats)
+
+	b.queryCount++
+	if b.queryCount%probeInterval == 0 {
+		nonTop := best[1:]
+		probe := nonTop[rand.Intn(len(nonTop))]
+		return []Child{best[0], probe}
+	}
+	return best[:2]
+}
+
+// sortByScore orders candidates ascending by their current score, a simple
+// insertion sort since candidate lists are always small.
+func sortByScore(candidates []Child, stats map[string]*stat) {
+	score := func(name string) float64 {
+		s := stats[name]
+		return float64(s.latencyEWMA) * (1 + s.errorEWMA)
+	}
+	for i := 1; i < len(candidates); i++ {
+		for j := i; j > 0 && score(candidates[j].Name) < score(candidates[j-1].Name); j-- {
+			candidates[j], candidates[j-1] = candidates[j-1], candidates[j]
+		}
+	}
+}
+
+// record folds one Exchange outcome into name's EWMA latency and error
+// rate.
+func (b *Backend) record(name string, latency time.Duration, failed bool) {
+	errSample := 0.0
+	if failed {
+		errSample = 1.0
+		if b.metrics != nil {
+			b.metrics.IncrementBackendErrors(name)
+		}
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	s := b.stats[name]
+	if s.samples == 0 {
+		s.latencyEWMA = latency
+		s.errorEWMA = errSample
+	} else {
+		s.latencyEWMA = time.Duration(ewmaAlpha*float64(latency) + (1-ewmaAlpha)*float64(s.latencyEWMA))
+		s.errorEWMA = ewmaAlpha*errSample + (1-ewmaAlpha)*s.errorEWMA
+	}
+	s.samples++
+}
+
+// LastExchangeLatency reports the winning child's round-trip time for the
+// last Exchange call, satisfying interfaces.BackendLatencyObserver.
+func (b *Backend) LastExchangeLatency() time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.lastRTT
+}
@@ -0,0 +1,133 @@
+package parallelbest
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"dns-resolver/internal/interfaces"
+
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+)
+
+// fixedBackend answers after delay, either with a fixed A record or err.
+type fixedBackend struct {
+	delay time.Duration
+	err   error
+}
+
+func (b *fixedBackend) Exchange(ctx context.Context, req *dns.Msg) (*dns.Msg, interfaces.DNSSECStatus, error) {
+	select {
+	case <-time.After(b.delay):
+	case <-ctx.Done():
+		return nil, interfaces.DNSSECUnknown, ctx.Err()
+	}
+	if b.err != nil {
+		return nil, interfaces.DNSSECUnknown, b.err
+	}
+	m := new(dns.Msg)
+	m.SetReply(req)
+	m.Answer = []dns.RR{&dns.A{Hdr: dns.RR_Header{Name: req.Question[0].Name, Rrtype: dns.TypeA, Class: dns.ClassINET}}}
+	return m, interfaces.DNSSECInsecure, nil
+}
+
+func testQuery() *dns.Msg {
+	req := new(dns.Msg)
+	req.SetQuestion("example.com.", dns.TypeA)
+	return req
+}
+
+func TestExchange_ReturnsFasterChild(t *testing.T) {
+	fast := &fixedBackend{delay: 5 * time.Millisecond}
+	slow := &fixedBackend{delay: 200 * time.Millisecond}
+	b := NewBackend([]Child{{Name: "fast", Backend: fast}, {Name: "slow", Backend: slow}}, nil)
+
+	msg, dnssec, err := b.Exchange(context.Background(), testQuery())
+	assert.NoError(t, err)
+	assert.Equal(t, interfaces.DNSSECInsecure, dnssec)
+	assert.NotNil(t, msg)
+}
+
+func TestExchange_FallsBackWhenOneChildErrors(t *testing.T) {
+	failing := &fixedBackend{delay: time.Millisecond, err: errors.New("upstream unreachable")}
+	ok := &fixedBackend{delay: 20 * time.Millisecond}
+	b := NewBackend([]Child{{Name: "failing", Backend: failing}, {Name: "ok", Backend: ok}}, nil)
+
+	msg, _, err := b.Exchange(context.Background(), testQuery())
+	assert.NoError(t, err)
+	assert.NotNil(t, msg)
+}
+
+func TestExchange_ReturnsErrorWhenAllChildrenFail(t *testing.T) {
+	a := &fixedBackend{delay: time.Millisecond, err: errors.New("a failed")}
+	bb := &fixedBackend{delay: time.Millisecond, err: errors.New("b failed")}
+	b := NewBackend([]Child{{Name: "a", Backend: a}, {Name: "b", Backend: bb}}, nil)
+
+	_, _, err := b.Exchange(context.Background(), testQuery())
+	assert.Error(t, err)
+}
+
+func TestPickCandidates_RoundRobinsUntilWarm(t *testing.T) {
+	b := NewBackend([]Child{
+		{Name: "one", Backend: &fixedBackend{}},
+		{Name: "two", Backend: &fixedBackend{}},
+		{Name: "three", Backend: &fixedBackend{}},
+	}, nil)
+
+	seen := make(map[string]bool)
+	for i := 0; i < 6; i++ {
+		for _, c := range b.pickCandidates() {
+			seen[c.Name] = true
+		}
+	}
+	assert.Len(t, seen, 3, "every child should get a turn before stats are trusted")
+}
+
+func TestPickCandidates_PrefersLowerScoreOnceWarm(t *testing.T) {
+	b := NewBackend([]Child{
+		{Name: "fast", Backend: &fixedBackend{}},
+		{Name: "slow", Backend: &fixedBackend{}},
+		{Name: "flaky", Backend: &fixedBackend{}},
+	}, nil)
+
+	for i := 0; i < minSamplesForEWMA; i++ {
+		b.record("fast", 5*time.Millisecond, false)
+		b.record("slow", 100*time.Millisecond, false)
+		b.record("flaky", 5*time.Millisecond, true)
+	}
+
+	names := make(map[string]bool)
+	for _, c := range b.pickCandidates() {
+		names[c.Name] = true
+	}
+	assert.True(t, names["fast"], "the lowest-latency, error-free child should always be a candidate")
+	assert.False(t, names["slow"], "the slowest child should lose out to fast and flaky")
+}
+
+func TestPickCandidates_PeriodicallyProbesNonTopChild(t *testing.T) {
+	b := NewBackend([]Child{
+		{Name: "fast", Backend: &fixedBackend{}},
+		{Name: "slow", Backend: &fixedBackend{}},
+		{Name: "flaky", Backend: &fixedBackend{}},
+	}, nil)
+
+	for i := 0; i < minSamplesForEWMA; i++ {
+		b.record("fast", 5*time.Millisecond, false)
+		b.record("slow", 100*time.Millisecond, false)
+		b.record("flaky", 5*time.Millisecond, true)
+	}
+
+	sawNonTopProbe := false
+	for i := 0; i < probeInterval*10; i++ {
+		names := make(map[string]bool)
+		for _, c := range b.pickCandidates() {
+			names[c.Name] = true
+		}
+		if names["slow"] {
+			sawNonTopProbe = true
+		}
+	}
+	assert.True(t, sawNonTopProbe, "ranking should self-heal by occasionally racing a non-top child")
+}
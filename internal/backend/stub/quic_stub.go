@@ -0,0 +1,16 @@
+//go:build !quic
+
+package stub
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/miekg/dns"
+)
+
+// exchangeQUIC is a stub returning an error; build with -tags=quic to
+// enable the real quic-go-backed DNS-over-QUIC (RFC 9250) transport.
+func (b *Backend) exchangeQUIC(_ context.Context, u *upstream, _ *dns.Msg) (*dns.Msg, error) {
+	return nil, fmt.Errorf("doq: upstream %s requires building with -tags=quic", u.raw)
+}
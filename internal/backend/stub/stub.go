@@ -1,62 +1,593 @@
 package stub
 
 import (
-    "context"
-    "os"
-    "time"
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
 
-    "dns-resolver/internal/interfaces"
+	"dns-resolver/internal/config"
+	"dns-resolver/internal/ecs"
+	"dns-resolver/internal/interfaces"
 
-    "github.com/miekg/dns"
+	"github.com/miekg/dns"
 )
 
-// Backend implements interfaces.Backend by forwarding to a configurable upstream.
-// This is a cgo-free fallback to keep default builds working in environments
+// dohMediaType is the RFC 8484 content type for wire-format DNS over HTTP.
+const dohMediaType = "application/dns-message"
+
+// errDoHMethodNotAllowed signals exchangeDoH to fall back from POST to GET;
+// it never escapes exchangeDoH.
+var errDoHMethodNotAllowed = fmt.Errorf("stub: DoH endpoint rejected POST")
+
+func init() {
+	interfaces.RegisterBackend("stub", func(cfg *config.Config) (interfaces.Backend, error) {
+		return NewFromConfig(cfg)
+	})
+}
+
+// upstream is a single configured upstream target, dialed with the
+// transport implied by its scheme (udp, tcp, tls, https, quic). conn is a
+// reused connection for the tls transport so repeated queries don't pay a
+// fresh handshake each time; it is guarded by mu and redialed lazily after a
+// failure.
+type upstream struct {
+	raw      string
+	scheme   string
+	hostname string // original hostname (or IP literal) for udp/tcp/tls/quic; unused for https, see addr
+	port     string // port for udp/tcp/tls/quic
+	addr     string // host:port for udp/tcp/tls/quic; original hostname for https
+	url      string // full URL for https, re-pointed at the bootstrapped IP
+
+	mu         sync.Mutex
+	resolvedIP string // IP addr/url was last built from, so refreshUpstream only rebuilds on change
+	conn       *dns.Conn
+	connUsed   time.Time // last time conn was handed back healthy, for idle eviction
+	healthy    bool
+	lastRTT    time.Duration
+}
+
+// Backend implements interfaces.Backend by forwarding to one or more
+// configurable upstreams over UDP, TCP, DNS-over-TLS, or DNS-over-HTTPS,
+// failing over to the next upstream on a transport error or SERVFAIL. This
+// is a cgo-free fallback to keep default builds working in environments
 // without libunbound/libkres.
 type Backend struct {
-    upstream string
-    lastRTT  time.Duration
+	upstreams []*upstream
+
+	udpTimeout     time.Duration
+	tcpTimeout     time.Duration
+	tlsTimeout     time.Duration
+	httpsTimeout   time.Duration
+	tlsIdleTimeout time.Duration
+
+	sessionCache tls.ClientSessionCache
+	httpClient   *http.Client
+	bootstrap    *bootstrapResolver
+
+	ecsEnabled   bool
+	ecsPrefixV4  int
+	ecsPrefixV6  int
+	ecsAllowlist []string
+
+	lastRTT time.Duration
 }
 
+// NewDefault builds a Backend from the UPSTREAM_DNS environment variable
+// (falling back to Quad9 over plain UDP), for callers that don't have a
+// *config.Config handy, e.g. quick manual testing.
 func NewDefault() *Backend {
-    upstream := os.Getenv("UPSTREAM_DNS")
-    if upstream == "" {
-        upstream = "9.9.9.9:53" // Quad9 default
-    }
-    return &Backend{upstream: upstream}
+	up := os.Getenv("UPSTREAM_DNS")
+	if up == "" {
+		up = "udp://9.9.9.9:53"
+	} else if !strings.Contains(up, "://") {
+		up = "udp://" + up
+	}
+
+	b, err := NewFromConfig(&config.Config{Upstreams: []string{up}})
+	if err != nil {
+		// NewFromConfig only fails on a malformed upstream string, which
+		// can't happen for the fixed strings built above.
+		panic(err)
+	}
+	return b
+}
+
+// NewFromConfig builds a Backend from cfg.Upstreams (falling back to Quad9
+// over plain UDP when empty), applying cfg's per-transport timeouts and
+// resolving any hostname-only tls://, https://, or quic:// upstream once
+// against cfg.BootstrapDNS so it can be dialed by IP afterward.
+func NewFromConfig(cfg *config.Config) (*Backend, error) {
+	raws := cfg.Upstreams
+	if len(raws) == 0 {
+		raws = []string{"udp://9.9.9.9:53"}
+	}
+
+	b := &Backend{
+		udpTimeout:     nonZero(cfg.UpstreamUDPTimeout, 2*time.Second),
+		tcpTimeout:     nonZero(cfg.UpstreamTCPTimeout, 5*time.Second),
+		tlsTimeout:     nonZero(cfg.UpstreamTLSTimeout, 5*time.Second),
+		httpsTimeout:   nonZero(cfg.UpstreamHTTPSTimeout, 5*time.Second),
+		tlsIdleTimeout: nonZero(cfg.UpstreamTLSIdleTimeout, 30*time.Second),
+		sessionCache:   tls.NewLRUClientSessionCache(0),
+		bootstrap:      newBootstrapResolver(cfg.BootstrapDNS),
+		ecsEnabled:     cfg.ECSEnabled,
+		ecsPrefixV4:    nonZeroInt(cfg.ECSPrefixV4, 24),
+		ecsPrefixV6:    nonZeroInt(cfg.ECSPrefixV6, 56),
+		ecsAllowlist:   cfg.ECSAllowlist,
+	}
+
+	// A single shared http.Client/Transport lets every https:// upstream
+	// reuse HTTP/2 connections across queries instead of dialing fresh for
+	// each one.
+	b.httpClient = &http.Client{
+		Timeout: b.httpsTimeout,
+		Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{ClientSessionCache: b.sessionCache},
+		},
+	}
+
+	for _, raw := range raws {
+		u, err := parseUpstream(raw, b.bootstrap)
+		if err != nil {
+			return nil, err
+		}
+		b.upstreams = append(b.upstreams, u)
+	}
+
+	return b, nil
+}
+
+func nonZero(d, fallback time.Duration) time.Duration {
+	if d <= 0 {
+		return fallback
+	}
+	return d
+}
+
+func nonZeroInt(v, fallback int) int {
+	if v <= 0 {
+		return fallback
+	}
+	return v
 }
 
+// parseUpstream splits a scheme-prefixed upstream string into its transport
+// and target, bootstrapping a hostname-only host against bootstrap so the
+// returned upstream can be dialed by IP without depending on the system
+// resolver.
+func parseUpstream(raw string, bootstrap *bootstrapResolver) (*upstream, error) {
+	parsed, err := url.Parse(raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid upstream %q: %w", raw, err)
+	}
+
+	scheme := strings.ToLower(parsed.Scheme)
+	switch scheme {
+	case "udp", "tcp", "tls", "quic":
+		host := parsed.Host
+		if host == "" {
+			return nil, fmt.Errorf("invalid upstream %q: missing host", raw)
+		}
+		hostname, port, err := net.SplitHostPort(host)
+		if err != nil {
+			hostname = host
+			port = defaultPortFor(scheme)
+		}
+		resolved, err := bootstrap.resolve(hostname)
+		if err != nil {
+			return nil, fmt.Errorf("bootstrapping upstream %q: %w", raw, err)
+		}
+		return &upstream{raw: raw, scheme: scheme, hostname: hostname, port: port, resolvedIP: resolved, addr: net.JoinHostPort(resolved, port), healthy: true}, nil
+	case "https":
+		hostname := parsed.Hostname()
+		if hostname == "" {
+			return nil, fmt.Errorf("invalid upstream %q: missing host", raw)
+		}
+		port := portOrDefault(parsed.Port(), "443")
+		resolved, err := bootstrap.resolve(hostname)
+		if err != nil {
+			return nil, fmt.Errorf("bootstrapping upstream %q: %w", raw, err)
+		}
+		dohURL := *parsed
+		dohURL.Host = net.JoinHostPort(resolved, port)
+		// addr keeps the original hostname, used as the Host header (and
+		// thus SNI via the transport) even though we dial the bootstrapped IP.
+		return &upstream{raw: raw, scheme: scheme, port: port, url: dohURL.String(), addr: hostname, resolvedIP: resolved, healthy: true}, nil
+	default:
+		return nil, fmt.Errorf("invalid upstream %q: unsupported scheme %q", raw, parsed.Scheme)
+	}
+}
+
+func defaultPortFor(scheme string) string {
+	if scheme == "tls" || scheme == "quic" {
+		return "853"
+	}
+	return "53"
+}
+
+func portOrDefault(port, fallback string) string {
+	if port == "" {
+		return fallback
+	}
+	return port
+}
+
+// minBootstrapTTL floors an implausibly short (or zero) TTL on a bootstrap
+// A record so a misbehaving bootstrap server can't force a fresh query on
+// every single upstream refresh.
+const minBootstrapTTL = 30 * time.Second
+
+// bootstrapEntry is a bootstrapResolver's cached answer for one hostname.
+type bootstrapEntry struct {
+	ip     string
+	expiry time.Time
+}
+
+// bootstrapResolver resolves a tls://, https://, or quic:// upstream's
+// hostname against the configured BootstrapDNS servers (tried in order),
+// caching each result until its A record's TTL expires so a dial doesn't
+// pay for a fresh bootstrap query every time; see refreshUpstream for where
+// a cached entry gets re-resolved.
+type bootstrapResolver struct {
+	addrs []string
+
+	mu    sync.Mutex
+	cache map[string]bootstrapEntry
+}
+
+func newBootstrapResolver(addrs []string) *bootstrapResolver {
+	return &bootstrapResolver{addrs: addrs, cache: make(map[string]bootstrapEntry)}
+}
+
+// resolve returns hostname unchanged if it already parses as an IP,
+// otherwise its cached bootstrapped IP, re-resolving against r.addrs once
+// the cache entry's TTL has lapsed. A re-resolution that fails falls back
+// to the stale cached entry, if there is one, rather than failing the
+// query outright.
+func (r *bootstrapResolver) resolve(hostname string) (string, error) {
+	if net.ParseIP(hostname) != nil {
+		return hostname, nil
+	}
+
+	r.mu.Lock()
+	entry, cached := r.cache[hostname]
+	r.mu.Unlock()
+	if cached && time.Now().Before(entry.expiry) {
+		return entry.ip, nil
+	}
+
+	if len(r.addrs) == 0 {
+		if cached {
+			return entry.ip, nil
+		}
+		return "", fmt.Errorf("upstream host %q is not an IP and no BootstrapDNS is configured", hostname)
+	}
+
+	var lastErr error
+	for _, addr := range r.addrs {
+		ip, ttl, err := queryBootstrapA(hostname, addr)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		if ttl < minBootstrapTTL {
+			ttl = minBootstrapTTL
+		}
+		r.mu.Lock()
+		r.cache[hostname] = bootstrapEntry{ip: ip, expiry: time.Now().Add(ttl)}
+		r.mu.Unlock()
+		return ip, nil
+	}
+
+	if cached {
+		return entry.ip, nil
+	}
+	return "", lastErr
+}
+
+// queryBootstrapA resolves hostname's A record against bootstrapAddr (a
+// plain-DNS server), returning its TTL alongside the address so callers can
+// cache it no longer than the record itself is valid.
+func queryBootstrapA(hostname, bootstrapAddr string) (string, time.Duration, error) {
+	m := new(dns.Msg)
+	m.SetQuestion(dns.Fqdn(hostname), dns.TypeA)
+	c := &dns.Client{Net: "udp", Timeout: 5 * time.Second}
+	in, _, err := c.Exchange(m, bootstrapAddr)
+	if err != nil {
+		return "", 0, err
+	}
+	for _, rr := range in.Answer {
+		if a, ok := rr.(*dns.A); ok {
+			return a.A.String(), time.Duration(a.Hdr.Ttl) * time.Second, nil
+		}
+	}
+	return "", 0, fmt.Errorf("bootstrap resolver %s returned no A record for %q", bootstrapAddr, hostname)
+}
+
+// refreshUpstream re-resolves u's bootstrapped hostname, rebuilding addr
+// (or url, for https) when the bootstrapResolver's cache has picked up a
+// new IP since u was last dialed. A tls:// upstream's pooled connection is
+// dropped on change so the next query redials the new address instead of
+// talking to the old one.
+func (b *Backend) refreshUpstream(u *upstream) error {
+	hostname := u.hostname
+	if u.scheme == "https" {
+		hostname = u.addr
+	}
+	if net.ParseIP(hostname) != nil {
+		return nil
+	}
+
+	ip, err := b.bootstrap.resolve(hostname)
+	if err != nil {
+		return err
+	}
+
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if ip == u.resolvedIP {
+		return nil
+	}
+	u.resolvedIP = ip
+
+	if u.scheme == "https" {
+		parsed, err := url.Parse(u.url)
+		if err != nil {
+			return nil // keep serving the old URL rather than fail on a parse error here
+		}
+		parsed.Host = net.JoinHostPort(ip, u.port)
+		u.url = parsed.String()
+		return nil
+	}
+
+	u.addr = net.JoinHostPort(ip, u.port)
+	if u.conn != nil {
+		u.conn.Close()
+		u.conn = nil
+	}
+	return nil
+}
+
+// Exchange tries each configured upstream in order, failing over to the
+// next on a transport error or an upstream SERVFAIL. When ECS is enabled
+// for req's zone, it attaches an EDNS Client Subnet option built from the
+// client address stashed in ctx by the server before forwarding.
 func (b *Backend) Exchange(ctx context.Context, req *dns.Msg) (*dns.Msg, interfaces.DNSSECStatus, error) {
-    c := &dns.Client{Net: "udp"}
-    // miekg/dns supports ExchangeContext; timeouts also honored via Client.Timeout
-    if deadline, ok := ctx.Deadline(); ok {
-        c.Timeout = time.Until(deadline)
-        if c.Timeout <= 0 {
-            c.Timeout = 50 * time.Millisecond
-        }
-    }
-    start := time.Now()
-    in, rtt, err := c.ExchangeContext(ctx, req, b.upstream)
-    if err != nil {
-        b.lastRTT = time.Since(start)
-        return in, interfaces.DNSSECUnknown, err
-    }
-    b.lastRTT = rtt
-
-    // Determine DNSSEC status based on AD bit presence only (upstream-validated)
-    status := interfaces.DNSSECUnknown
-    if in != nil {
-        if in.AuthenticatedData {
-            status = interfaces.DNSSECSecure
-        } else {
-            status = interfaces.DNSSECInsecure
-        }
-    }
-    // If upstream returns SERVFAIL for DO queries, treat as BOGUS to match tests
-    if in != nil && in.Rcode == dns.RcodeServerFailure {
-        return in, interfaces.DNSSECBogus, dns.ErrRcode
-    }
-    return in, status, nil
+	if b.ecsEnabled && len(req.Question) > 0 && ecs.Allowed(req.Question[0].Name, b.ecsAllowlist) {
+		if clientAddr, ok := interfaces.ClientAddrFromContext(ctx); ok {
+			ecs.Attach(req, clientAddr, b.ecsPrefixV4, b.ecsPrefixV6)
+		}
+	}
+
+	var lastErr error
+	var lastResp *dns.Msg
+
+	for _, u := range b.upstreams {
+		resp, err := b.exchangeWith(ctx, u, req)
+		if err != nil {
+			u.mu.Lock()
+			u.healthy = false
+			u.mu.Unlock()
+			lastErr = err
+			continue
+		}
+
+		u.mu.Lock()
+		u.healthy = true
+		b.lastRTT = u.lastRTT
+		u.mu.Unlock()
+
+		if resp.Rcode == dns.RcodeServerFailure {
+			lastResp = resp
+			lastErr = dns.ErrRcode
+			continue
+		}
+
+		return resp, dnssecStatus(resp), nil
+	}
+
+	if lastResp != nil {
+		return lastResp, interfaces.DNSSECBogus, lastErr
+	}
+	return nil, interfaces.DNSSECUnknown, lastErr
+}
+
+// dnssecStatus derives a DNSSECStatus from the upstream's own AD bit, since
+// the stub backend trusts upstream validation rather than performing its
+// own chain-of-trust verification.
+func dnssecStatus(in *dns.Msg) interfaces.DNSSECStatus {
+	if in == nil {
+		return interfaces.DNSSECUnknown
+	}
+	if in.AuthenticatedData {
+		return interfaces.DNSSECSecure
+	}
+	return interfaces.DNSSECInsecure
+}
+
+func (b *Backend) exchangeWith(ctx context.Context, u *upstream, req *dns.Msg) (*dns.Msg, error) {
+	if err := b.refreshUpstream(u); err != nil {
+		return nil, err
+	}
+
+	switch u.scheme {
+	case "udp":
+		return b.exchangeClassic(ctx, u, "udp", req, b.udpTimeout)
+	case "tcp":
+		return b.exchangeClassic(ctx, u, "tcp", req, b.tcpTimeout)
+	case "tls":
+		return b.exchangeTLS(ctx, u, req)
+	case "https":
+		return b.exchangeDoH(ctx, u, req)
+	case "quic":
+		return b.exchangeQUIC(ctx, u, req)
+	default:
+		return nil, fmt.Errorf("unsupported upstream scheme %q", u.scheme)
+	}
+}
+
+// exchangeClassic handles plain udp:// and tcp:// upstreams. These are
+// cheap enough per-query that a fresh client each call is fine; there's no
+// persistent connection to reuse like there is for tls/https.
+func (b *Backend) exchangeClassic(ctx context.Context, u *upstream, network string, req *dns.Msg, timeout time.Duration) (*dns.Msg, error) {
+	c := &dns.Client{Net: network, Timeout: timeout}
+	in, rtt, err := c.ExchangeContext(ctx, req, u.addr)
+	if err != nil {
+		return nil, err
+	}
+	u.mu.Lock()
+	u.lastRTT = rtt
+	u.mu.Unlock()
+	return in, nil
+}
+
+// exchangeTLS performs the exchange over a long-lived DNS-over-TLS
+// connection, reusing both the TCP connection and, via the backend's shared
+// ClientSessionCache, the TLS session across queries; a connection that
+// errors is dropped so the next query redials. A connection that has sat
+// idle longer than tlsIdleTimeout is closed and redialed too, rather than
+// risking a stale connection the peer has already timed out on its end,
+// per RFC 7858's recommendation that idle DoT connections be closed.
+func (b *Backend) exchangeTLS(ctx context.Context, u *upstream, req *dns.Msg) (*dns.Msg, error) {
+	u.mu.Lock()
+	conn := u.conn
+	if conn != nil && time.Since(u.connUsed) > b.tlsIdleTimeout {
+		conn.Close()
+		conn = nil
+		u.conn = nil
+	}
+	u.mu.Unlock()
+
+	c := &dns.Client{
+		Net:     "tcp-tls",
+		Timeout: b.tlsTimeout,
+		TLSConfig: &tls.Config{
+			ServerName:         hostOnly(u.addr),
+			ClientSessionCache: b.sessionCache,
+		},
+	}
+
+	if conn == nil {
+		dialed, err := c.Dial(u.addr)
+		if err != nil {
+			return nil, err
+		}
+		conn = dialed
+	}
+
+	conn.SetDeadline(time.Now().Add(b.tlsTimeout))
+	in, rtt, err := c.ExchangeWithConnContext(ctx, req, conn)
+	if err != nil {
+		conn.Close()
+		u.mu.Lock()
+		u.conn = nil
+		u.mu.Unlock()
+		return nil, err
+	}
+
+	u.mu.Lock()
+	u.conn = conn
+	u.connUsed = time.Now()
+	u.lastRTT = rtt
+	u.mu.Unlock()
+	return in, nil
+}
+
+// exchangeDoH performs the exchange as an RFC 8484 POST over the backend's
+// shared http.Client, which reuses HTTP/2 connections across queries,
+// falling back to a GET with a base64url "dns=" query param if the
+// endpoint rejects POST outright (405 Method Not Allowed).
+func (b *Backend) exchangeDoH(ctx context.Context, u *upstream, req *dns.Msg) (*dns.Msg, error) {
+	packed, err := req.Pack()
+	if err != nil {
+		return nil, err
+	}
+
+	start := time.Now()
+	in, err := b.doDoHPost(ctx, u, packed)
+	if err == errDoHMethodNotAllowed {
+		in, err = b.doDoHGet(ctx, u, packed)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	u.mu.Lock()
+	u.lastRTT = time.Since(start)
+	u.mu.Unlock()
+	return in, nil
+}
+
+func (b *Backend) doDoHPost(ctx context.Context, u *upstream, packed []byte) (*dns.Msg, error) {
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, u.url, bytes.NewReader(packed))
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("Content-Type", dohMediaType)
+	httpReq.Header.Set("Accept", dohMediaType)
+	httpReq.Host = u.addr // original hostname, for SNI/Host despite dialing by IP
+
+	return b.doDoH(httpReq, u)
+}
+
+func (b *Backend) doDoHGet(ctx context.Context, u *upstream, packed []byte) (*dns.Msg, error) {
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodGet, u.url, nil)
+	if err != nil {
+		return nil, err
+	}
+	q := httpReq.URL.Query()
+	q.Set("dns", base64.RawURLEncoding.EncodeToString(packed))
+	httpReq.URL.RawQuery = q.Encode()
+	httpReq.Header.Set("Accept", dohMediaType)
+	httpReq.Host = u.addr
+
+	return b.doDoH(httpReq, u)
+}
+
+func (b *Backend) doDoH(httpReq *http.Request, u *upstream) (*dns.Msg, error) {
+	resp, err := b.httpClient.Do(httpReq)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusMethodNotAllowed {
+		return nil, errDoHMethodNotAllowed
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("DoH upstream %s returned HTTP %d", u.raw, resp.StatusCode)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 65535))
+	if err != nil {
+		return nil, err
+	}
+
+	in := new(dns.Msg)
+	if err := in.Unpack(body); err != nil {
+		return nil, err
+	}
+	return in, nil
+}
+
+func hostOnly(hostport string) string {
+	host, _, err := net.SplitHostPort(hostport)
+	if err != nil {
+		return hostport
+	}
+	return host
 }
 
+// LastExchangeLatency reports the round-trip time of the last upstream that
+// successfully answered a query, satisfying interfaces.BackendLatencyObserver.
 func (b *Backend) LastExchangeLatency() time.Duration { return b.lastRTT }
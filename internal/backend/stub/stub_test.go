@@ -0,0 +1,235 @@
+package stub
+
+import (
+	"context"
+	"encoding/base64"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"dns-resolver/internal/config"
+	"dns-resolver/internal/interfaces"
+
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseUpstream_Schemes(t *testing.T) {
+	noBootstrap := newBootstrapResolver(nil)
+
+	u, err := parseUpstream("udp://9.9.9.9:53", noBootstrap)
+	assert.NoError(t, err)
+	assert.Equal(t, "udp", u.scheme)
+	assert.Equal(t, "9.9.9.9:53", u.addr)
+
+	u, err = parseUpstream("tls://1.1.1.1", noBootstrap)
+	assert.NoError(t, err)
+	assert.Equal(t, "tls", u.scheme)
+	assert.Equal(t, "1.1.1.1:853", u.addr, "tls upstream with no port should default to 853")
+
+	u, err = parseUpstream("https://9.9.9.9/dns-query", noBootstrap)
+	assert.NoError(t, err)
+	assert.Equal(t, "https", u.scheme)
+	assert.Equal(t, "https://9.9.9.9:443/dns-query", u.url)
+
+	u, err = parseUpstream("quic://9.9.9.9", noBootstrap)
+	assert.NoError(t, err)
+	assert.Equal(t, "quic", u.scheme)
+	assert.Equal(t, "9.9.9.9:853", u.addr, "quic upstream with no port should default to 853")
+}
+
+func TestParseUpstream_RejectsUnknownScheme(t *testing.T) {
+	_, err := parseUpstream("ftp://9.9.9.9:53", newBootstrapResolver(nil))
+	assert.Error(t, err)
+}
+
+func TestParseUpstream_HostnameRequiresBootstrap(t *testing.T) {
+	_, err := parseUpstream("tls://dns.quad9.net", newBootstrapResolver(nil))
+	assert.Error(t, err, "a hostname-only upstream with no bootstrap resolver configured should fail to parse")
+}
+
+func TestBootstrapResolver_PassesThroughIPLiterals(t *testing.T) {
+	resolved, err := newBootstrapResolver(nil).resolve("9.9.9.9")
+	assert.NoError(t, err)
+	assert.Equal(t, "9.9.9.9", resolved)
+}
+
+func TestDNSSECStatus(t *testing.T) {
+	assert.Equal(t, interfaces.DNSSECUnknown, dnssecStatus(nil))
+
+	msg := new(dns.Msg)
+	msg.AuthenticatedData = true
+	assert.Equal(t, interfaces.DNSSECSecure, dnssecStatus(msg))
+
+	msg.AuthenticatedData = false
+	assert.Equal(t, interfaces.DNSSECInsecure, dnssecStatus(msg))
+}
+
+func TestBackend_ExchangeFailsOverToNextUpstream(t *testing.T) {
+	// The second upstream is a real local UDP server; the first is a dead
+	// port that refuses the connection immediately, proving Exchange moves
+	// on instead of returning the first upstream's error.
+	good := newTestUDPServer(t, dns.RcodeSuccess)
+	defer good.Shutdown()
+
+	b, err := NewFromConfig(&config.Config{
+		Upstreams: []string{
+			"udp://127.0.0.1:1",
+			"udp://" + good.PacketConn.LocalAddr().String(),
+		},
+		UpstreamUDPTimeout: 2 * time.Second,
+	})
+	assert.NoError(t, err)
+	assert.Len(t, b.upstreams, 2)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	req := new(dns.Msg)
+	req.SetQuestion("example.com.", dns.TypeA)
+
+	resp, _, err := b.Exchange(ctx, req)
+	assert.NoError(t, err)
+	assert.Equal(t, dns.RcodeSuccess, resp.Rcode)
+}
+
+func TestBackend_ExchangeTreatsServfailAsFailoverTrigger(t *testing.T) {
+	bad := newTestUDPServer(t, dns.RcodeServerFailure)
+	defer bad.Shutdown()
+	good := newTestUDPServer(t, dns.RcodeSuccess)
+	defer good.Shutdown()
+
+	b, err := NewFromConfig(&config.Config{
+		Upstreams: []string{
+			"udp://" + bad.PacketConn.LocalAddr().String(),
+			"udp://" + good.PacketConn.LocalAddr().String(),
+		},
+		UpstreamUDPTimeout: 2 * time.Second,
+	})
+	assert.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	req := new(dns.Msg)
+	req.SetQuestion("example.com.", dns.TypeA)
+
+	resp, _, err := b.Exchange(ctx, req)
+	assert.NoError(t, err)
+	assert.Equal(t, dns.RcodeSuccess, resp.Rcode)
+}
+
+func TestBackend_ExchangeDoHFallsBackToGETOn405(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		wire, err := base64.RawURLEncoding.DecodeString(r.URL.Query().Get("dns"))
+		assert.NoError(t, err)
+		q := new(dns.Msg)
+		assert.NoError(t, q.Unpack(wire))
+
+		resp := new(dns.Msg)
+		resp.SetReply(q)
+		packed, err := resp.Pack()
+		assert.NoError(t, err)
+		w.Header().Set("Content-Type", dohMediaType)
+		w.Write(packed)
+	}))
+	defer srv.Close()
+
+	b := &Backend{httpClient: srv.Client(), httpsTimeout: 2 * time.Second}
+	u := &upstream{raw: srv.URL, scheme: "https", addr: "127.0.0.1", url: srv.URL, healthy: true}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	req := new(dns.Msg)
+	req.SetQuestion("example.com.", dns.TypeA)
+
+	resp, err := b.exchangeDoH(ctx, u, req)
+	assert.NoError(t, err)
+	assert.Equal(t, dns.RcodeSuccess, resp.Rcode)
+}
+
+func TestBackend_ExchangeHTTPSUpstreamEndToEnd(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		assert.NoError(t, err)
+		q := new(dns.Msg)
+		assert.NoError(t, q.Unpack(body))
+
+		resp := new(dns.Msg)
+		resp.SetReply(q)
+		packed, err := resp.Pack()
+		assert.NoError(t, err)
+		w.Header().Set("Content-Type", dohMediaType)
+		w.Write(packed)
+	}))
+	defer srv.Close()
+
+	// srv.URL's host is already "127.0.0.1:port", an IP literal, so
+	// NewFromConfig's parseUpstream resolves it without needing a
+	// BootstrapDNS entry.
+	b, err := NewFromConfig(&config.Config{
+		Upstreams:            []string{srv.URL + "/dns-query"},
+		UpstreamHTTPSTimeout: 2 * time.Second,
+	})
+	require.NoError(t, err)
+	b.httpClient = srv.Client()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	req := new(dns.Msg)
+	req.SetQuestion("example.com.", dns.TypeA)
+
+	resp, _, err := b.Exchange(ctx, req)
+	assert.NoError(t, err)
+	assert.Equal(t, dns.RcodeSuccess, resp.Rcode)
+}
+
+func TestBackend_ExchangeTLSEvictsIdleConnection(t *testing.T) {
+	clientSide, serverSide := net.Pipe()
+	defer serverSide.Close()
+
+	u := &upstream{raw: "tls://127.0.0.1:1", scheme: "tls", addr: "127.0.0.1:1", healthy: true}
+	u.conn = &dns.Conn{Conn: clientSide}
+	u.connUsed = time.Now().Add(-time.Hour)
+
+	b := &Backend{tlsTimeout: 50 * time.Millisecond, tlsIdleTimeout: time.Second}
+
+	// 127.0.0.1:1 refuses connections, so the redial this triggers fails
+	// fast; what this test actually checks is that the stale idle
+	// connection was evicted (and thus closed) rather than reused.
+	_, err := b.exchangeTLS(context.Background(), u, new(dns.Msg))
+	assert.Error(t, err)
+
+	_, err = clientSide.Write([]byte("x"))
+	assert.Error(t, err, "the evicted connection should have been closed")
+}
+
+// newTestUDPServer starts a local DNS server that answers every query with
+// rcode, for exercising Backend.Exchange against a real socket.
+func newTestUDPServer(t *testing.T, rcode int) *dns.Server {
+	t.Helper()
+
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	assert.NoError(t, err)
+
+	srv := &dns.Server{PacketConn: pc, Handler: dns.HandlerFunc(func(w dns.ResponseWriter, r *dns.Msg) {
+		m := new(dns.Msg)
+		m.SetReply(r)
+		m.Rcode = rcode
+		w.WriteMsg(m)
+	})}
+	go srv.ActivateAndServe()
+	t.Cleanup(func() { srv.Shutdown() })
+	return srv
+}
@@ -7,6 +7,7 @@ import (
     "errors"
     "time"
 
+    "dns-resolver/internal/config"
     "dns-resolver/internal/interfaces"
     "dns-resolver/internal/metrics"
 
@@ -14,6 +15,12 @@ import (
     "github.com/miekg/unbound"
 )
 
+func init() {
+    interfaces.RegisterBackend("unbound", func(cfg *config.Config) (interfaces.Backend, error) {
+        return New(cfg, nil), nil
+    })
+}
+
 // Backend implements interfaces.Backend using libunbound via github.com/miekg/unbound.
 type Backend struct {
     u       *unbound.Unbound
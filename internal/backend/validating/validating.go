@@ -0,0 +1,372 @@
+// Package validating implements a pure-Go DNSSEC chain-of-trust validator,
+// independent of libunbound/libknot, so a cgo-free build doesn't have to
+// trust an upstream's AD bit blindly.
+package validating
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"dns-resolver/internal/cache"
+	"dns-resolver/internal/config"
+	"dns-resolver/internal/interfaces"
+
+	"github.com/miekg/dns"
+)
+
+func init() {
+	interfaces.RegisterBackend("validating", func(cfg *config.Config) (interfaces.Backend, error) {
+		next, err := interfaces.GetBackend("stub", cfg)
+		if err != nil {
+			return nil, fmt.Errorf("validating backend requires the stub backend to fetch DNSKEY/DS/NSEC records: %w", err)
+		}
+		return NewBackend(next, cfg)
+	})
+}
+
+// defaultRootTrustAnchors is the compiled-in IANA root zone trust anchor
+// (KSK-2017), used whenever Config.DNSSECRootTrustAnchors is empty.
+var defaultRootTrustAnchors = []string{
+	". IN DS 20326 8 2 E06D44B80B8F1D39A95C0B0D7C65D08458E880409BBC683457104237C7F8EC8",
+}
+
+// Backend implements interfaces.Backend with its own chain-of-trust DNSSEC
+// validation: for every answer it walks from the root down to the queried
+// zone, verifying DNSKEY/DS RRSIGs at each delegation, then verifies the
+// RRSIGs over the answer/authority sections (including NSEC/NSEC3
+// denial-of-existence proofs). It wraps another Backend purely to fetch the
+// DNSKEY/DS/NSEC records it needs and never trusts that Backend's own AD
+// bit.
+type Backend struct {
+	next         interfaces.Backend
+	dnskeyCache  *cache.DNSKeyCache
+	trustAnchors []*dns.DS
+}
+
+// NewBackend wraps next with chain-of-trust DNSSEC validation governed by
+// cfg. next is used only to issue the auxiliary DNSKEY/DS/NSEC queries the
+// validator needs; its own DNSSEC opinion (the AD bit) is ignored.
+func NewBackend(next interfaces.Backend, cfg *config.Config) (*Backend, error) {
+	anchors := cfg.DNSSECRootTrustAnchors
+	if len(anchors) == 0 {
+		anchors = defaultRootTrustAnchors
+	}
+
+	var trustAnchors []*dns.DS
+	for _, a := range anchors {
+		rr, err := dns.NewRR(a)
+		if err != nil {
+			return nil, fmt.Errorf("parsing DNSSEC root trust anchor %q: %w", a, err)
+		}
+		ds, ok := rr.(*dns.DS)
+		if !ok {
+			return nil, fmt.Errorf("DNSSEC root trust anchor %q is not a DS record", a)
+		}
+		trustAnchors = append(trustAnchors, ds)
+	}
+
+	return &Backend{
+		next:         next,
+		dnskeyCache:  cache.NewDNSKeyCache(cfg),
+		trustAnchors: trustAnchors,
+	}, nil
+}
+
+// Exchange forwards req to the wrapped backend, then independently
+// validates the response's chain of trust, returning DNSSECSecure only when
+// the full chain verifies, DNSSECInsecure on a proven insecure delegation,
+// and DNSSECBogus on any signature or DS mismatch.
+func (b *Backend) Exchange(ctx context.Context, req *dns.Msg) (*dns.Msg, interfaces.DNSSECStatus, error) {
+	resp, _, err := b.next.Exchange(ctx, req)
+	if err != nil || resp == nil || len(req.Question) == 0 {
+		return resp, interfaces.DNSSECUnknown, err
+	}
+
+	status, verr := b.validate(ctx, req.Question[0], resp)
+	if verr != nil {
+		log.Printf("validating: chain-of-trust validation for %s %s failed: %v", req.Question[0].Name, dns.TypeToString[req.Question[0].Qtype], verr)
+	}
+	return resp, status, nil
+}
+
+// validate walks the chain of trust down to qname's zone and then verifies
+// the RRSIGs covering resp's answer, falling back to NSEC/NSEC3 denial of
+// existence when the answer is empty.
+func (b *Backend) validate(ctx context.Context, q dns.Question, resp *dns.Msg) (interfaces.DNSSECStatus, error) {
+	if len(b.trustAnchors) == 0 {
+		return interfaces.DNSSECInsecure, fmt.Errorf("no DNSSEC root trust anchors configured")
+	}
+
+	keys, zone, status, err := b.walkChain(ctx, q.Name)
+	if status != interfaces.DNSSECSecure {
+		return status, err
+	}
+
+	if len(resp.Answer) == 0 {
+		ok, derr := proveDenial(q.Name, resp.Ns, keys)
+		if derr != nil || !ok {
+			return interfaces.DNSSECBogus, fmt.Errorf("no verifiable denial of existence for %s under zone %s: %w", q.Name, zone, derr)
+		}
+		return interfaces.DNSSECSecure, nil
+	}
+
+	sets, sigs := splitAnswer(resp.Answer)
+	for k, rrset := range sets {
+		if err := verifyRRset(rrset, sigs[k], keys); err != nil {
+			return interfaces.DNSSECBogus, fmt.Errorf("answer RRSIG for %s/%s under zone %s: %w", k.name, dns.TypeToString[k.rtype], zone, err)
+		}
+	}
+	return interfaces.DNSSECSecure, nil
+}
+
+// walkChain validates the DNSKEY/DS chain of trust from the root down to
+// qname's enclosing zone, returning that zone's validated DNSKEY RRset.
+// DNSSECInsecure is returned as soon as a proven DS denial of existence is
+// found at a delegation; everything below that point is unsigned by
+// definition and is not an error.
+func (b *Backend) walkChain(ctx context.Context, qname string) ([]*dns.DNSKEY, string, interfaces.DNSSECStatus, error) {
+	zone := "."
+	keys, err := b.zoneKeys(ctx, zone, b.trustAnchors)
+	if err != nil {
+		return nil, zone, interfaces.DNSSECBogus, fmt.Errorf("validating root DNSKEY: %w", err)
+	}
+
+	labels := dns.SplitDomainName(dns.Fqdn(qname))
+	for i := len(labels) - 1; i >= 0; i-- {
+		child := dns.Fqdn(strings.Join(labels[i:], "."))
+
+		dsResp, err := b.lookup(ctx, child, dns.TypeDS)
+		if err != nil {
+			return keys, zone, interfaces.DNSSECUnknown, fmt.Errorf("fetching DS for %s: %w", child, err)
+		}
+
+		dsRRs, dsSigs := splitRRSIG(dsResp.Answer)
+		var ds []*dns.DS
+		for _, rr := range dsRRs {
+			if d, ok := rr.(*dns.DS); ok {
+				ds = append(ds, d)
+			}
+		}
+
+		if len(ds) == 0 {
+			ok, derr := proveDenial(child, dsResp.Ns, keys)
+			if derr != nil || !ok {
+				return keys, zone, interfaces.DNSSECUnknown, fmt.Errorf("no DS for %s and its absence did not verify: %w", child, derr)
+			}
+			return nil, zone, interfaces.DNSSECInsecure, nil
+		}
+
+		if err := verifyRRset(dsRRs, dsSigs, keys); err != nil {
+			return nil, zone, interfaces.DNSSECBogus, fmt.Errorf("DS RRSIG for %s: %w", child, err)
+		}
+
+		childKeys, err := b.zoneKeys(ctx, child, ds)
+		if err != nil {
+			return nil, zone, interfaces.DNSSECBogus, fmt.Errorf("validating DNSKEY for %s: %w", child, err)
+		}
+
+		zone, keys = child, childKeys
+	}
+
+	return keys, zone, interfaces.DNSSECSecure, nil
+}
+
+// zoneKeys returns zone's validated DNSKEY RRset, verifying that at least
+// one key's digest matches an entry in ds (the parent's DS RRset, or the
+// configured root trust anchors for the root zone) and that the DNSKEY
+// RRset's RRSIG verifies against it, per RFC 4035 5.2. Results are cached in
+// the shared cache.DNSKeyCache, keyed by zone, to amortize repeated
+// validations.
+func (b *Backend) zoneKeys(ctx context.Context, zone string, ds []*dns.DS) ([]*dns.DNSKEY, error) {
+	if cached, ok := b.dnskeyCache.Get(zone); ok {
+		return cached, nil
+	}
+
+	resp, err := b.lookup(ctx, zone, dns.TypeDNSKEY)
+	if err != nil {
+		return nil, err
+	}
+
+	rrs, sigs := splitRRSIG(resp.Answer)
+	var keys []*dns.DNSKEY
+	for _, rr := range rrs {
+		if k, ok := rr.(*dns.DNSKEY); ok {
+			keys = append(keys, k)
+		}
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("no DNSKEY RRset for zone %s", zone)
+	}
+
+	anchored := false
+	for _, k := range keys {
+		if dsMatchesKey(k, ds) {
+			anchored = true
+			break
+		}
+	}
+	if !anchored {
+		return nil, fmt.Errorf("no DNSKEY in zone %s matches its DS/trust anchor", zone)
+	}
+
+	if err := verifyRRset(rrs, sigs, keys); err != nil {
+		return nil, fmt.Errorf("DNSKEY RRSIG for zone %s: %w", zone, err)
+	}
+
+	b.dnskeyCache.Set(zone, keys)
+	return keys, nil
+}
+
+// lookup issues a single query for name/qtype with the DO bit set, via the
+// wrapped backend, so DNSSEC RRSIGs come back alongside the requested
+// records.
+func (b *Backend) lookup(ctx context.Context, name string, qtype uint16) (*dns.Msg, error) {
+	m := new(dns.Msg)
+	m.SetQuestion(dns.Fqdn(name), qtype)
+	m.SetEdns0(4096, true)
+
+	resp, _, err := b.next.Exchange(ctx, m)
+	if err != nil {
+		return nil, err
+	}
+	if resp == nil {
+		return nil, fmt.Errorf("no response for %s %s", name, dns.TypeToString[qtype])
+	}
+	return resp, nil
+}
+
+// rrsetKey identifies an RRset by owner name and type, used to pair up
+// RRSIGs with the RRset they cover.
+type rrsetKey struct {
+	name  string
+	rtype uint16
+}
+
+// splitAnswer groups rrs into RRsets and their covering RRSIGs, keyed by
+// owner name and (for the signed RRset) its type.
+func splitAnswer(rrs []dns.RR) (map[rrsetKey][]dns.RR, map[rrsetKey][]*dns.RRSIG) {
+	sets := make(map[rrsetKey][]dns.RR)
+	sigs := make(map[rrsetKey][]*dns.RRSIG)
+	for _, rr := range rrs {
+		if sig, ok := rr.(*dns.RRSIG); ok {
+			k := rrsetKey{strings.ToLower(sig.Hdr.Name), sig.TypeCovered}
+			sigs[k] = append(sigs[k], sig)
+			continue
+		}
+		k := rrsetKey{strings.ToLower(rr.Header().Name), rr.Header().Rrtype}
+		sets[k] = append(sets[k], rr)
+	}
+	return sets, sigs
+}
+
+// splitRRSIG separates rrs (expected to be a single RRset plus its RRSIGs,
+// e.g. one Answer section) into the signed records and their RRSIGs.
+func splitRRSIG(rrs []dns.RR) ([]dns.RR, []*dns.RRSIG) {
+	var signed []dns.RR
+	var sigs []*dns.RRSIG
+	for _, rr := range rrs {
+		if sig, ok := rr.(*dns.RRSIG); ok {
+			sigs = append(sigs, sig)
+			continue
+		}
+		signed = append(signed, rr)
+	}
+	return signed, sigs
+}
+
+// verifyRRset checks that rrset is covered by at least one cryptographically
+// valid, time-valid RRSIG in sigs signed by one of keys. An empty rrset is
+// trivially valid; callers must use denial-of-existence proofs to confirm
+// that emptiness is itself authentic.
+func verifyRRset(rrset []dns.RR, sigs []*dns.RRSIG, keys []*dns.DNSKEY) error {
+	if len(rrset) == 0 {
+		return nil
+	}
+
+	now := time.Now()
+	var lastErr error
+	for _, sig := range sigs {
+		if !sig.ValidityPeriod(now) {
+			lastErr = fmt.Errorf("RRSIG keytag %d outside its validity period", sig.KeyTag)
+			continue
+		}
+		for _, key := range keys {
+			if key.KeyTag() != sig.KeyTag {
+				continue
+			}
+			if err := sig.Verify(key, rrset); err != nil {
+				lastErr = err
+				continue
+			}
+			return nil
+		}
+	}
+	if lastErr == nil {
+		lastErr = fmt.Errorf("no RRSIG found covering the RRset")
+	}
+	return lastErr
+}
+
+// dsMatchesKey reports whether key's digest, under any digest type present
+// in ds, matches one of ds's entries.
+func dsMatchesKey(key *dns.DNSKEY, ds []*dns.DS) bool {
+	for _, d := range ds {
+		computed := key.ToDS(d.DigestType)
+		if computed != nil && strings.EqualFold(computed.Digest, d.Digest) {
+			return true
+		}
+	}
+	return false
+}
+
+// proveDenial reports whether authority contains a verifiable NSEC or NSEC3
+// record, signed by keys, that proves name does not exist (or has no record
+// of the queried type).
+func proveDenial(name string, authority []dns.RR, keys []*dns.DNSKEY) (bool, error) {
+	sets, sigs := splitAnswer(authority)
+
+	var lastErr error
+	for k, rrset := range sets {
+		if k.rtype != dns.TypeNSEC && k.rtype != dns.TypeNSEC3 {
+			continue
+		}
+		if err := verifyRRset(rrset, sigs[k], keys); err != nil {
+			lastErr = err
+			continue
+		}
+		for _, rr := range rrset {
+			switch nsec := rr.(type) {
+			case *dns.NSEC:
+				if nsecCovers(nsec, name) {
+					return true, nil
+				}
+			case *dns.NSEC3:
+				if nsec.Cover(name) || nsec.Match(name) {
+					return true, nil
+				}
+			}
+		}
+	}
+	if lastErr == nil {
+		lastErr = fmt.Errorf("no NSEC/NSEC3 record present")
+	}
+	return false, lastErr
+}
+
+// nsecCovers reports whether name falls in the range (owner, nextDomain)
+// that nsec denies, accounting for the final NSEC in a zone wrapping back to
+// the apex.
+func nsecCovers(nsec *dns.NSEC, name string) bool {
+	owner := strings.ToLower(nsec.Hdr.Name)
+	next := strings.ToLower(nsec.NextDomain)
+	n := strings.ToLower(dns.Fqdn(name))
+
+	if owner < next {
+		return owner <= n && n < next
+	}
+	// The last NSEC in the zone wraps around to the apex.
+	return n >= owner || n < next
+}
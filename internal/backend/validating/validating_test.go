@@ -0,0 +1,116 @@
+package validating
+
+import (
+	"crypto"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// newTestZone generates an ECDSAP256SHA256 DNSKEY for zone along with its DS
+// record, returning a helper that signs an RRset with it.
+func newTestZone(t *testing.T, zone string) (key *dns.DNSKEY, ds *dns.DS, sign func(rrset []dns.RR) *dns.RRSIG) {
+	t.Helper()
+
+	key = &dns.DNSKEY{
+		Hdr:       dns.RR_Header{Name: zone, Rrtype: dns.TypeDNSKEY, Class: dns.ClassINET, Ttl: 3600},
+		Flags:     257,
+		Protocol:  3,
+		Algorithm: dns.ECDSAP256SHA256,
+	}
+	priv, err := key.Generate(256)
+	if err != nil {
+		t.Fatalf("generating key for %s: %v", zone, err)
+	}
+	signer, ok := priv.(crypto.Signer)
+	if !ok {
+		t.Fatalf("generated key for %s does not implement crypto.Signer", zone)
+	}
+
+	ds = key.ToDS(dns.SHA256)
+
+	sign = func(rrset []dns.RR) *dns.RRSIG {
+		t.Helper()
+		now := time.Now()
+		sig := &dns.RRSIG{
+			Hdr:         dns.RR_Header{Name: rrset[0].Header().Name, Rrtype: dns.TypeRRSIG, Class: dns.ClassINET, Ttl: rrset[0].Header().Ttl},
+			TypeCovered: rrset[0].Header().Rrtype,
+			Algorithm:   key.Algorithm,
+			Labels:      uint8(dns.CountLabel(rrset[0].Header().Name)),
+			OrigTtl:     rrset[0].Header().Ttl,
+			Expiration:  uint32(now.Add(time.Hour).Unix()),
+			Inception:   uint32(now.Add(-time.Hour).Unix()),
+			KeyTag:      key.KeyTag(),
+			SignerName:  zone,
+		}
+		if err := sig.Sign(signer, rrset); err != nil {
+			t.Fatalf("signing RRset for %s: %v", zone, err)
+		}
+		return sig
+	}
+	return key, ds, sign
+}
+
+func TestVerifyRRset(t *testing.T) {
+	key, _, sign := newTestZone(t, "example.com.")
+	rrset := []dns.RR{&dns.A{
+		Hdr: dns.RR_Header{Name: "example.com.", Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: 300},
+		A:   nil,
+	}}
+	sig := sign(rrset)
+
+	if err := verifyRRset(rrset, []*dns.RRSIG{sig}, []*dns.DNSKEY{key}); err != nil {
+		t.Fatalf("expected RRset to verify, got: %v", err)
+	}
+}
+
+func TestVerifyRRsetWrongKey(t *testing.T) {
+	_, _, sign := newTestZone(t, "example.com.")
+	otherKey, _, _ := newTestZone(t, "example.com.")
+	rrset := []dns.RR{&dns.A{
+		Hdr: dns.RR_Header{Name: "example.com.", Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: 300},
+	}}
+	sig := sign(rrset)
+
+	if err := verifyRRset(rrset, []*dns.RRSIG{sig}, []*dns.DNSKEY{otherKey}); err == nil {
+		t.Fatal("expected verification to fail against a non-matching key")
+	}
+}
+
+func TestDSMatchesKey(t *testing.T) {
+	key, ds, _ := newTestZone(t, "example.com.")
+	other, _, _ := newTestZone(t, "example.com.")
+
+	if !dsMatchesKey(key, []*dns.DS{ds}) {
+		t.Fatal("expected key to match its own DS record")
+	}
+	if dsMatchesKey(other, []*dns.DS{ds}) {
+		t.Fatal("expected a different key not to match")
+	}
+}
+
+func TestNSECCovers(t *testing.T) {
+	nsec := &dns.NSEC{
+		Hdr:        dns.RR_Header{Name: "a.example.com.", Rrtype: dns.TypeNSEC, Class: dns.ClassINET},
+		NextDomain: "c.example.com.",
+	}
+
+	if !nsecCovers(nsec, "b.example.com.") {
+		t.Fatal("expected b.example.com. to be covered by [a, c)")
+	}
+	if nsecCovers(nsec, "d.example.com.") {
+		t.Fatal("did not expect d.example.com. to be covered by [a, c)")
+	}
+}
+
+func TestNSECCoversWrapsAroundZoneApex(t *testing.T) {
+	nsec := &dns.NSEC{
+		Hdr:        dns.RR_Header{Name: "z.example.com.", Rrtype: dns.TypeNSEC, Class: dns.ClassINET},
+		NextDomain: "example.com.",
+	}
+
+	if !nsecCovers(nsec, "zz.example.com.") {
+		t.Fatal("expected the last NSEC in the zone to cover a name after its owner")
+	}
+}
@@ -1,6 +1,7 @@
 package cache
 
 import (
+	"dns-resolver/internal/config"
 	"dns-resolver/internal/metrics"
 	"fmt"
 	"log"
@@ -19,6 +20,9 @@ type CacheItem struct {
 	Msg                  *dns.Msg
 	Expiration           time.Time
 	StaleWhileRevalidate time.Duration
+	// OriginalTTL is the TTL the item was stored with, used by ShouldPrefetch
+	// to judge how close to expiry the item currently is.
+	OriginalTTL time.Duration
 }
 
 // Cache is a thread-safe, sharded DNS cache with Ristretto.
@@ -27,14 +31,24 @@ type Cache struct {
 	resolver interfaces.CacheResolver
 	metrics  *metrics.Metrics
 	msgPool  sync.Pool
+	prefetch *PrefetchTracker
 }
 
-// NewCache creates and returns a new Cache with Ristretto.
-func NewCache(size int, m *metrics.Metrics) (*Cache, error) {
+// NewCache creates and returns a new Cache with Ristretto. cfg, if non-nil,
+// supplies the CachePrefetchMinHits/CachePrefetchPercentage thresholds used
+// by ShouldPrefetch; a nil cfg falls back to the package defaults.
+func NewCache(size int, cfg *config.Config, m *metrics.Metrics) (*Cache, error) {
 	if size <= 0 {
 		size = DefaultCacheSize
 	}
 
+	var thresholdHits int64
+	var percentage float64
+	if cfg != nil {
+		thresholdHits = cfg.CachePrefetchMinHits
+		percentage = cfg.CachePrefetchPercentage
+	}
+
 	ristrettoCache, err := ristretto.NewCache(&ristretto.Config{
 		NumCounters: int64(size * 10), // Recommended value from Ristretto docs
 		MaxCost:     int64(size),
@@ -64,6 +78,7 @@ func NewCache(size int, m *metrics.Metrics) (*Cache, error) {
 				return new(dns.Msg)
 			},
 		},
+		prefetch: NewPrefetchTracker(thresholdHits, percentage),
 	}
 
 	return c, nil
@@ -103,23 +118,56 @@ func (c *Cache) Get(key string) (*dns.Msg, bool, bool) {
 	}
 
 	c.metrics.IncrementCacheHits()
+	c.prefetch.RecordHit(key)
 	// Return a deep copy to prevent race conditions
 	msgCopy := item.Msg.Copy()
 	return msgCopy, true, false // Not stale
 }
 
+// ShouldPrefetch reports whether key is hot enough, and close enough to
+// expiry, to warrant a background refetch ahead of its natural expiration.
+// It consults the item's own OriginalTTL rather than taking one from the
+// caller, since the resolver only has the cache key at the point it decides
+// whether to prefetch.
+func (c *Cache) ShouldPrefetch(key string) bool {
+	value, found := c.cache.Get(key)
+	if !found {
+		return false
+	}
+	item, ok := value.(*CacheItem)
+	if !ok {
+		return false
+	}
+	remaining := time.Until(item.Expiration)
+	return c.prefetch.ShouldPrefetch(key, remaining, item.OriginalTTL)
+}
+
+// EvictPrefetch drops key's tracked hit history, called once a prefetch has
+// refreshed it with a new TTL so stale hit counts don't linger.
+func (c *Cache) EvictPrefetch(key string) {
+	c.prefetch.Evict(key)
+	c.metrics.IncrementCachePrefetchEvictions()
+}
+
 func (c *Cache) Set(key string, msg *dns.Msg, swr time.Duration) {
 	if msg.Rcode == dns.RcodeServerFailure || msg.Rcode == dns.RcodeNameError {
 		return
 	}
+	if msg.Truncated {
+		// A truncated response is incomplete; never let it poison the cache
+		// for a subsequent query that might get the full answer.
+		return
+	}
 
 	ttl := getMinTTL(msg)
-	expiration := time.Now().Add(time.Duration(ttl) * time.Second)
+	originalTTL := time.Duration(ttl) * time.Second
+	expiration := time.Now().Add(originalTTL)
 
 	item := &CacheItem{
 		Msg:                  msg.Copy(), // Store a copy to avoid race conditions
 		Expiration:           expiration,
 		StaleWhileRevalidate: swr,
+		OriginalTTL:          originalTTL,
 	}
 
 	// The cost is 1, as we are not sizing items individually for this cache.
@@ -132,8 +180,13 @@ func (c *Cache) SetResolver(r interfaces.CacheResolver) {
 	c.resolver = r
 }
 
-func Key(q dns.Question) string {
-	return fmt.Sprintf("%s:%d:%d", strings.ToLower(q.Name), q.Qtype, q.Qclass)
+// Key generates a cache key from a dns.Question plus the DO and CD bits of
+// the request. Folding those two bits into the key keeps a response
+// resolved with DNSSEC validation suppressed (CD=1) from ever being served
+// to a client that expects validation, and keeps RRSIGs pulled in for a
+// DO=1 query from leaking into a DO=0 response (or vice versa).
+func Key(q dns.Question, do, cd bool) string {
+	return fmt.Sprintf("%s:%d:%d:%t:%t", strings.ToLower(q.Name), q.Qtype, q.Qclass, do, cd)
 }
 
 func getMinTTL(msg *dns.Msg) uint32 {
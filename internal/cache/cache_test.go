@@ -1,6 +1,7 @@
 package cache
 
 import (
+	"dns-resolver/internal/config"
 	"dns-resolver/internal/metrics"
 	"strconv"
 	"testing"
@@ -14,8 +15,8 @@ import (
 func newTestCache(t *testing.T) (*Cache, func()) {
 	t.Helper()
 
-	m := metrics.NewMetrics()
-	cache, err := NewCache(128, m)
+	m := metrics.NewMetrics(config.NewConfig())
+	cache, err := NewCache(128, nil, m)
 	assert.NoError(t, err)
 
 	cleanup := func() {
@@ -41,7 +42,7 @@ func TestCacheSetAndGet(t *testing.T) {
 	defer cleanup()
 
 	q := dns.Question{Name: "example.com.", Qtype: dns.TypeA, Qclass: dns.ClassINET}
-	key := Key(q)
+	key := Key(q, false, false)
 	msg := createTestMsg("example.com.", 60, "1.2.3.4")
 
 	c.Set(key, msg, 0)
@@ -60,7 +61,7 @@ func TestCacheNotFound(t *testing.T) {
 	defer cleanup()
 
 	q := dns.Question{Name: "notfound.com.", Qtype: dns.TypeA, Qclass: dns.ClassINET}
-	key := Key(q)
+	key := Key(q, false, false)
 
 	_, found, _ := c.Get(key)
 	assert.False(t, found, "expected to not find message in cache, but did")
@@ -71,7 +72,7 @@ func TestCacheExpiration(t *testing.T) {
 	defer cleanup()
 
 	q := dns.Question{Name: "shortlived.com.", Qtype: dns.TypeA, Qclass: dns.ClassINET}
-	key := Key(q)
+	key := Key(q, false, false)
 	msg := createTestMsg("shortlived.com.", 1, "2.3.4.5")
 
 	c.Set(key, msg, 0)
@@ -82,12 +83,62 @@ func TestCacheExpiration(t *testing.T) {
 	assert.False(t, found, "expected message to be expired and not found, but it was found")
 }
 
+func TestKeyDiffersByCDAndDOBits(t *testing.T) {
+	q := dns.Question{Name: "example.com.", Qtype: dns.TypeA, Qclass: dns.ClassINET}
+
+	keyCD0 := Key(q, false, false)
+	keyCD1 := Key(q, false, true)
+	assert.NotEqual(t, keyCD0, keyCD1, "CD=0 and CD=1 must not share a cache key")
+
+	keyDO0 := Key(q, false, false)
+	keyDO1 := Key(q, true, false)
+	assert.NotEqual(t, keyDO0, keyDO1, "DO=0 and DO=1 must not share a cache key")
+}
+
+func TestCacheMissesAcrossCDBit(t *testing.T) {
+	c, cleanup := newTestCache(t)
+	defer cleanup()
+
+	q := dns.Question{Name: "bogus.example.com.", Qtype: dns.TypeA, Qclass: dns.ClassINET}
+	cd1Key := Key(q, false, true)
+
+	// Simulate a CD=1 client caching a bogus-but-accepted answer.
+	msg := createTestMsg("bogus.example.com.", 60, "6.6.6.6")
+	c.Set(cd1Key, msg, 0)
+	time.Sleep(10 * time.Millisecond)
+
+	// A CD=0 client, which expects DNSSEC-validated data, must not see it.
+	cd0Key := Key(q, false, false)
+	_, found, _ := c.Get(cd0Key)
+	assert.False(t, found, "CD=0 lookup must miss an entry cached under CD=1")
+
+	// And vice versa: a CD=1 entry must not leak from a CD=0-keyed lookup either.
+	_, found, _ = c.Get(cd1Key)
+	assert.True(t, found, "CD=1 lookup should still find its own entry")
+}
+
+func TestCacheSkipsTruncatedResponses(t *testing.T) {
+	c, cleanup := newTestCache(t)
+	defer cleanup()
+
+	q := dns.Question{Name: "truncated.example.com.", Qtype: dns.TypeA, Qclass: dns.ClassINET}
+	key := Key(q, false, false)
+
+	msg := createTestMsg("truncated.example.com.", 60, "7.7.7.7")
+	msg.Truncated = true
+	c.Set(key, msg, 0)
+	time.Sleep(10 * time.Millisecond)
+
+	_, found, _ := c.Get(key)
+	assert.False(t, found, "a truncated response must never be cached")
+}
+
 func TestCacheStaleWhileRevalidate(t *testing.T) {
 	c, cleanup := newTestCache(t)
 	defer cleanup()
 
 	q := dns.Question{Name: "stale.com.", Qtype: dns.TypeA, Qclass: dns.ClassINET}
-	key := Key(q)
+	key := Key(q, false, false)
 	// TTL of 1 second, SWR of 5 seconds
 	msg := createTestMsg("stale.com.", 1, "3.4.5.6")
 	swrDuration := 5 * time.Second
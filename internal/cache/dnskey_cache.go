@@ -0,0 +1,117 @@
+package cache
+
+import (
+	"dns-resolver/internal/config"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// DNSKeyCacheItem holds a zone's validated DNSKEY RRset and its expiration,
+// so a chain-of-trust validator doesn't need to re-verify the same zone's
+// keys for every query underneath it.
+type DNSKeyCacheItem struct {
+	DNSKEYs    []*dns.DNSKEY
+	Expiration time.Time
+}
+
+// DNSKeyCache stores validated DNSKEY RRsets, keyed by zone.
+type DNSKeyCache struct {
+	sync.RWMutex
+	items  map[string]*DNSKeyCacheItem // Keyed by zone name (lowercased, fully qualified)
+	config *config.Config
+	stop   chan struct{}
+}
+
+// NewDNSKeyCache creates a new DNSKeyCache.
+func NewDNSKeyCache(cfg *config.Config) *DNSKeyCache {
+	kc := &DNSKeyCache{
+		items:  make(map[string]*DNSKeyCacheItem),
+		config: cfg,
+		stop:   make(chan struct{}),
+	}
+	go kc.runCleaner()
+	return kc
+}
+
+// runCleaner periodically removes expired items from the cache.
+func (kc *DNSKeyCache) runCleaner() {
+	ticker := time.NewTicker(5 * time.Minute)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			kc.cleanup()
+		case <-kc.stop:
+			return
+		}
+	}
+}
+
+// cleanup iterates over the cache and removes expired items.
+func (kc *DNSKeyCache) cleanup() {
+	kc.Lock()
+	defer kc.Unlock()
+
+	now := time.Now()
+	for key, item := range kc.items {
+		if now.After(item.Expiration) {
+			delete(kc.items, key)
+		}
+	}
+}
+
+// Stop terminates the background cleaner goroutine.
+func (kc *DNSKeyCache) Stop() {
+	close(kc.stop)
+}
+
+// Set stores zone's validated DNSKEY RRset, using the lowest TTL among keys
+// as its expiration, clamped to the configured min/max.
+func (kc *DNSKeyCache) Set(zone string, keys []*dns.DNSKEY) {
+	if len(keys) == 0 {
+		return
+	}
+
+	ttl := keys[0].Hdr.Ttl
+	for _, k := range keys {
+		if k.Hdr.Ttl < ttl {
+			ttl = k.Hdr.Ttl
+		}
+	}
+	clampedTTL := kc.clampTTL(time.Duration(ttl) * time.Second)
+
+	kc.Lock()
+	defer kc.Unlock()
+	kc.items[strings.ToLower(zone)] = &DNSKeyCacheItem{
+		DNSKEYs:    keys,
+		Expiration: time.Now().Add(clampedTTL),
+	}
+}
+
+// Get returns zone's cached, already-validated DNSKEY RRset, if present and
+// not expired.
+func (kc *DNSKeyCache) Get(zone string) ([]*dns.DNSKEY, bool) {
+	kc.RLock()
+	defer kc.RUnlock()
+
+	item, ok := kc.items[strings.ToLower(zone)]
+	if !ok || time.Now().After(item.Expiration) {
+		return nil, false
+	}
+	return item.DNSKEYs, true
+}
+
+// clampTTL ensures that the TTL is within the configured min and max bounds.
+func (kc *DNSKeyCache) clampTTL(ttl time.Duration) time.Duration {
+	if kc.config.CacheMaxTTL > 0 && ttl > kc.config.CacheMaxTTL {
+		return kc.config.CacheMaxTTL
+	}
+	if ttl < kc.config.CacheMinTTL {
+		return kc.config.CacheMinTTL
+	}
+	return ttl
+}
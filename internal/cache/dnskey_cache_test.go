@@ -0,0 +1,41 @@
+package cache
+
+import (
+	"testing"
+
+	"dns-resolver/internal/config"
+
+	"github.com/miekg/dns"
+)
+
+func TestDNSKeyCache_SetAndGet(t *testing.T) {
+	cfg := config.NewConfig()
+	kc := NewDNSKeyCache(cfg)
+	defer kc.Stop()
+
+	key, err := dns.NewRR("example.com. 300 IN DNSKEY 257 3 8 AwEAAag==")
+	if err != nil {
+		t.Fatalf("failed to create DNSKEY RR: %v", err)
+	}
+
+	kc.Set("example.com.", []*dns.DNSKEY{key.(*dns.DNSKEY)})
+
+	got, found := kc.Get("EXAMPLE.COM.")
+	if !found {
+		t.Fatal("expected a cached DNSKEY RRset for example.com.")
+	}
+	if len(got) != 1 || got[0].KeyTag() != key.(*dns.DNSKEY).KeyTag() {
+		t.Errorf("cached DNSKEY RRset did not round-trip correctly")
+	}
+}
+
+func TestDNSKeyCache_GetMissesUnknownZone(t *testing.T) {
+	cfg := config.NewConfig()
+	kc := NewDNSKeyCache(cfg)
+	defer kc.Stop()
+
+	_, found := kc.Get("unknown.example.")
+	if found {
+		t.Fatal("expected no cached DNSKEY RRset for an unknown zone")
+	}
+}
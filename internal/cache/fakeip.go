@@ -0,0 +1,304 @@
+package cache
+
+import (
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"log"
+	"math/big"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+// fakeIPEntry is a single bidirectional name<->IP mapping, persisted to disk
+// so in-flight connections through a downstream proxy survive a restart.
+type fakeIPEntry struct {
+	Name   string    `json:"name"`
+	IP     string    `json:"ip"`
+	Expiry time.Time `json:"expiry"`
+}
+
+// FakeIPCache hands out synthesized IPs for fake-IP mode: a qname is mapped
+// to a deterministically-allocated address from a configured private range,
+// and the mapping is kept in both directions so a later PTR query, or a
+// downstream proxy handed the fake IP as a flow destination, can recover the
+// original hostname via Lookup.
+type FakeIPCache struct {
+	mu       sync.RWMutex
+	nameToIP map[string]fakeIPEntry
+	ipToName map[string]string
+	range4   *ipRange
+	range6   *ipRange
+	ttl      time.Duration
+	filePath string
+	stop     chan struct{}
+}
+
+// ipRange is an inclusive [base, base+size) block of addresses, addressed as
+// an offset from base so allocation can hash into it and probe linearly.
+type ipRange struct {
+	base net.IP
+	size *big.Int
+	is4  bool
+}
+
+func newIPRange(cidr string) (*ipRange, error) {
+	if cidr == "" {
+		return nil, nil
+	}
+	ip, ipnet, err := net.ParseCIDR(cidr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid fake-IP CIDR %q: %w", cidr, err)
+	}
+
+	ones, bits := ipnet.Mask.Size()
+	size := new(big.Int).Lsh(big.NewInt(1), uint(bits-ones))
+
+	return &ipRange{
+		base: ipnet.IP,
+		size: size,
+		is4:  ip.To4() != nil,
+	}, nil
+}
+
+// addr returns the address at offset within the range, wrapping via mod so
+// callers never need to bounds-check it themselves.
+func (r *ipRange) addr(offset *big.Int) net.IP {
+	mod := new(big.Int).Mod(offset, r.size)
+
+	var base *big.Int
+	if r.is4 {
+		base = new(big.Int).SetBytes(r.base.To4())
+	} else {
+		base = new(big.Int).SetBytes(r.base.To16())
+	}
+	val := new(big.Int).Add(base, mod)
+
+	if r.is4 {
+		b := val.Bytes()
+		out := make(net.IP, 4)
+		copy(out[4-len(b):], b)
+		return out
+	}
+	b := val.Bytes()
+	out := make(net.IP, 16)
+	copy(out[16-len(b):], b)
+	return out
+}
+
+// NewFakeIPCache creates a FakeIPCache allocating A records from range4 and
+// AAAA records from range6 (either may be empty to disable that family),
+// with ttl as the mapping lifetime. filePath, if non-empty, is where the
+// cache is persisted by SaveToFile and reloaded from by LoadFromFile.
+func NewFakeIPCache(range4, range6 string, ttl time.Duration, filePath string) (*FakeIPCache, error) {
+	r4, err := newIPRange(range4)
+	if err != nil {
+		return nil, err
+	}
+	r6, err := newIPRange(range6)
+	if err != nil {
+		return nil, err
+	}
+	if ttl <= 0 {
+		ttl = 1 * time.Hour
+	}
+
+	c := &FakeIPCache{
+		nameToIP: make(map[string]fakeIPEntry),
+		ipToName: make(map[string]string),
+		range4:   r4,
+		range6:   r6,
+		ttl:      ttl,
+		filePath: filePath,
+		stop:     make(chan struct{}),
+	}
+
+	go c.runCleanup()
+	return c, nil
+}
+
+// Allocate returns the fake IP for name, allocating a new one from the v6
+// range when v6 is true, or the v4 range otherwise. A name already holding a
+// live mapping gets its existing IP back with its expiry refreshed. The
+// address is chosen deterministically as hash(name) mod range-size, probing
+// linearly forward on collision with a live mapping for a different name.
+func (c *FakeIPCache) Allocate(name string, v6 bool) (net.IP, error) {
+	r := c.range4
+	if v6 {
+		r = c.range6
+	}
+	if r == nil {
+		return nil, fmt.Errorf("fake-IP range for this query type is not configured")
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	if entry, ok := c.nameToIP[name]; ok && now.Before(entry.Expiry) {
+		entry.Expiry = now.Add(c.ttl)
+		c.nameToIP[name] = entry
+		return net.ParseIP(entry.IP), nil
+	}
+
+	h := fnv.New64a()
+	h.Write([]byte(name))
+	offset := new(big.Int).SetUint64(h.Sum64())
+
+	size := r.size
+	attempts := size
+	if size.BitLen() > 32 {
+		// Never probe more than the whole 32-bit worth of offsets; a /0 v6
+		// range would otherwise make this loop effectively unbounded.
+		attempts = new(big.Int).SetUint64(1 << 32)
+	}
+
+	one := big.NewInt(1)
+	for i := big.NewInt(0); i.Cmp(attempts) < 0; i.Add(i, one) {
+		candidate := r.addr(offset)
+		key := candidate.String()
+		if existing, taken := c.ipToName[key]; !taken || existing == name {
+			c.assignLocked(name, key, now)
+			return candidate, nil
+		}
+		if entry, ok := c.nameToIP[c.ipToName[key]]; ok && now.After(entry.Expiry) {
+			// The holder's mapping has lapsed; reclaim the address.
+			delete(c.ipToName, key)
+			delete(c.nameToIP, entry.Name)
+			c.assignLocked(name, key, now)
+			return candidate, nil
+		}
+		offset.Add(offset, one)
+	}
+
+	return nil, fmt.Errorf("fake-IP range exhausted")
+}
+
+// assignLocked records the name<->ip mapping. Callers must hold c.mu.
+func (c *FakeIPCache) assignLocked(name, ip string, now time.Time) {
+	if old, ok := c.nameToIP[name]; ok {
+		delete(c.ipToName, old.IP)
+	}
+	entry := fakeIPEntry{Name: name, IP: ip, Expiry: now.Add(c.ttl)}
+	c.nameToIP[name] = entry
+	c.ipToName[ip] = name
+}
+
+// Lookup resolves a previously-allocated fake IP back to its original
+// hostname, e.g. for a PTR query or a proxy plugin rewriting a flow
+// destination. It reports false for an unknown or expired mapping.
+func (c *FakeIPCache) Lookup(ip string) (name string, ok bool) {
+	c.mu.RLock()
+	name, ok = c.ipToName[ip]
+	if !ok {
+		c.mu.RUnlock()
+		return "", false
+	}
+	entry, hasEntry := c.nameToIP[name]
+	c.mu.RUnlock()
+
+	if !hasEntry || time.Now().After(entry.Expiry) {
+		return "", false
+	}
+	return name, true
+}
+
+// runCleanup periodically frees mappings whose TTL has lapsed so their IPs
+// become available for reallocation.
+func (c *FakeIPCache) runCleanup() {
+	ticker := time.NewTicker(c.ttl / 4)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			c.sweep()
+		case <-c.stop:
+			return
+		}
+	}
+}
+
+func (c *FakeIPCache) sweep() {
+	now := time.Now()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for name, entry := range c.nameToIP {
+		if now.After(entry.Expiry) {
+			delete(c.nameToIP, name)
+			delete(c.ipToName, entry.IP)
+		}
+	}
+}
+
+// Close stops the background cleanup goroutine.
+func (c *FakeIPCache) Close() {
+	close(c.stop)
+}
+
+// SaveToFile persists the cache's current, unexpired mappings to filePath as
+// JSON. It is a no-op when filePath is empty.
+func (c *FakeIPCache) SaveToFile() error {
+	if c.filePath == "" {
+		return nil
+	}
+
+	now := time.Now()
+	c.mu.RLock()
+	entries := make([]fakeIPEntry, 0, len(c.nameToIP))
+	for _, entry := range c.nameToIP {
+		if now.Before(entry.Expiry) {
+			entries = append(entries, entry)
+		}
+	}
+	c.mu.RUnlock()
+
+	data, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal fake-IP cache: %w", err)
+	}
+
+	if err := os.WriteFile(c.filePath, data, 0644); err != nil {
+		return fmt.Errorf("failed to write fake-IP cache to %s: %w", c.filePath, err)
+	}
+	return nil
+}
+
+// LoadFromFile reloads previously persisted mappings from filePath, skipping
+// any that have already expired. It is a no-op when filePath is empty, and
+// it is not an error for the file not to exist yet.
+func (c *FakeIPCache) LoadFromFile() error {
+	if c.filePath == "" {
+		return nil
+	}
+
+	data, err := os.ReadFile(c.filePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("failed to read fake-IP cache from %s: %w", c.filePath, err)
+	}
+
+	var entries []fakeIPEntry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return fmt.Errorf("failed to unmarshal fake-IP cache: %w", err)
+	}
+
+	now := time.Now()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	loaded := 0
+	for _, entry := range entries {
+		if now.After(entry.Expiry) {
+			continue
+		}
+		c.nameToIP[entry.Name] = entry
+		c.ipToName[entry.IP] = entry.Name
+		loaded++
+	}
+	log.Printf("Loaded %d fake-IP cache entries from %s", loaded, c.filePath)
+	return nil
+}
@@ -0,0 +1,133 @@
+package cache
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFakeIPCache_AllocateIsDeterministic(t *testing.T) {
+	c, err := NewFakeIPCache("198.18.0.0/24", "", time.Hour, "")
+	assert.NoError(t, err)
+	defer c.Close()
+
+	ip1, err := c.Allocate("example.com.", false)
+	assert.NoError(t, err)
+
+	ip2, err := c.Allocate("example.com.", false)
+	assert.NoError(t, err)
+	assert.Equal(t, ip1.String(), ip2.String(), "the same name should always get the same fake IP while its mapping is live")
+}
+
+func TestFakeIPCache_AllocateHandlesCollisions(t *testing.T) {
+	// A tiny range forces hash collisions across many names, exercising the
+	// linear-probing fallback.
+	c, err := NewFakeIPCache("198.18.0.0/29", "", time.Hour, "")
+	assert.NoError(t, err)
+	defer c.Close()
+
+	seen := make(map[string]string)
+	for i := 0; i < 6; i++ {
+		name := "host" + string(rune('a'+i)) + ".example.com."
+		ip, err := c.Allocate(name, false)
+		assert.NoError(t, err)
+		for otherName, otherIP := range seen {
+			assert.NotEqual(t, otherIP, ip.String(), "distinct live names %s and %s must not share a fake IP", otherName, name)
+		}
+		seen[name] = ip.String()
+	}
+}
+
+func TestFakeIPCache_AllocateErrorsWhenRangeExhausted(t *testing.T) {
+	c, err := NewFakeIPCache("198.18.0.0/30", "", time.Hour, "")
+	assert.NoError(t, err)
+	defer c.Close()
+
+	for i := 0; i < 4; i++ {
+		name := "host" + string(rune('a'+i)) + ".example.com."
+		_, err := c.Allocate(name, false)
+		assert.NoError(t, err)
+	}
+
+	_, err = c.Allocate("onemore.example.com.", false)
+	assert.Error(t, err)
+}
+
+func TestFakeIPCache_LookupReturnsHostname(t *testing.T) {
+	c, err := NewFakeIPCache("198.18.0.0/24", "", time.Hour, "")
+	assert.NoError(t, err)
+	defer c.Close()
+
+	ip, err := c.Allocate("reverse.example.com.", false)
+	assert.NoError(t, err)
+
+	name, ok := c.Lookup(ip.String())
+	assert.True(t, ok)
+	assert.Equal(t, "reverse.example.com.", name)
+}
+
+func TestFakeIPCache_LookupMissesUnknownIP(t *testing.T) {
+	c, err := NewFakeIPCache("198.18.0.0/24", "", time.Hour, "")
+	assert.NoError(t, err)
+	defer c.Close()
+
+	_, ok := c.Lookup("198.18.0.200")
+	assert.False(t, ok)
+}
+
+func TestFakeIPCache_ExpiryFreesTheIPForReallocation(t *testing.T) {
+	c, err := NewFakeIPCache("198.18.0.0/30", "", 10*time.Millisecond, "")
+	assert.NoError(t, err)
+	defer c.Close()
+
+	ip, err := c.Allocate("expiring.example.com.", false)
+	assert.NoError(t, err)
+
+	time.Sleep(20 * time.Millisecond)
+
+	_, ok := c.Lookup(ip.String())
+	assert.False(t, ok, "an expired mapping must not be returned by Lookup")
+
+	// With the original name's entry lapsed, a different name probing into
+	// the same slot should be able to reclaim the address rather than
+	// erroring out with the range exhausted.
+	reallocated := false
+	for i := 0; i < 4; i++ {
+		name := "host" + string(rune('a'+i)) + ".example.com."
+		if _, err := c.Allocate(name, false); err == nil {
+			reallocated = true
+		}
+	}
+	assert.True(t, reallocated, "expiring an entry should free its IP for reallocation")
+}
+
+func TestFakeIPCache_SaveAndLoadFromFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "fakeip_cache.json")
+
+	c, err := NewFakeIPCache("198.18.0.0/24", "", time.Hour, path)
+	assert.NoError(t, err)
+	ip, err := c.Allocate("persisted.example.com.", false)
+	assert.NoError(t, err)
+	assert.NoError(t, c.SaveToFile())
+	c.Close()
+
+	reloaded, err := NewFakeIPCache("198.18.0.0/24", "", time.Hour, path)
+	assert.NoError(t, err)
+	defer reloaded.Close()
+	assert.NoError(t, reloaded.LoadFromFile())
+
+	name, ok := reloaded.Lookup(ip.String())
+	assert.True(t, ok, "a reverse mapping should survive a save/load round trip")
+	assert.Equal(t, "persisted.example.com.", name)
+}
+
+func TestFakeIPCache_AllocateErrorsWhenFamilyNotConfigured(t *testing.T) {
+	c, err := NewFakeIPCache("198.18.0.0/24", "", time.Hour, "")
+	assert.NoError(t, err)
+	defer c.Close()
+
+	_, err = c.Allocate("v6.example.com.", true)
+	assert.Error(t, err, "allocating an AAAA address with no FakeIPRange6 configured should fail")
+}
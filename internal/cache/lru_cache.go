@@ -34,17 +34,21 @@ func NewLRUCache(maxSize int) *LRUCache {
 	}
 }
 
-// key generates a unique cache key for a zone and question.
-func (c *LRUCache) key(zone string, q dns.Question) string {
-	return fmt.Sprintf("%s:%s:%d:%d", zone, q.Name, q.Qtype, q.Qclass)
+// key generates a unique cache key for a zone and question, plus the DO
+// (DNSSEC OK) and CD (Checking Disabled) bits: a CD=1 query may accept
+// unvalidated data that a CD=0 query must never be served, and a DO=1
+// response carries RRSIGs a DO=0 client doesn't expect, so both bits have to
+// be part of the key or those responses would collide.
+func (c *LRUCache) key(zone string, q dns.Question, do, cd bool) string {
+	return fmt.Sprintf("%s:%s:%d:%d:do=%t:cd=%t", zone, q.Name, q.Qtype, q.Qclass, do, cd)
 }
 
 // Get retrieves a message from the cache.
-func (c *LRUCache) Get(zone string, question dns.Question) (*dns.Msg, error) {
+func (c *LRUCache) Get(zone string, question dns.Question, do, cd bool) (*dns.Msg, error) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
-	key := c.key(zone, question)
+	key := c.key(zone, question, do, cd)
 	if elem, hit := c.cache[key]; hit {
 		c.ll.MoveToFront(elem)
 		return elem.Value.(*entry).value.Copy(), nil
@@ -52,15 +56,20 @@ func (c *LRUCache) Get(zone string, question dns.Question) (*dns.Msg, error) {
 	return nil, nil
 }
 
-// Update adds or updates a message in the cache.
-func (c *LRUCache) Update(zone string, question dns.Question, msg *dns.Msg) error {
+// Update adds or updates a message in the cache. If an entry already exists
+// for key, msg's Answer records are merged into it (see mergeAnswers)
+// instead of discarding whatever was cached before, so an update that only
+// adds to what's known for a name - e.g. one more hop of a CNAME chain
+// resolved separately from the rest - doesn't lose the records from an
+// earlier Update call.
+func (c *LRUCache) Update(zone string, question dns.Question, do, cd bool, msg *dns.Msg) error {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
-	key := c.key(zone, question)
+	key := c.key(zone, question, do, cd)
 	if elem, hit := c.cache[key]; hit {
 		c.ll.MoveToFront(elem)
-		elem.Value.(*entry).value = msg.Copy()
+		elem.Value.(*entry).value = mergeAnswers(elem.Value.(*entry).value, msg)
 		return nil
 	}
 
@@ -74,6 +83,34 @@ func (c *LRUCache) Update(zone string, question dns.Question, msg *dns.Msg) erro
 	return nil
 }
 
+// mergeAnswers combines existing's Answer records with fresh's: a record
+// present in both (compared by rrIdentity, so a differing TTL still counts
+// as "the same" record) is kept once, using fresh's copy, and any record
+// only present in existing is appended alongside it.
+func mergeAnswers(existing, fresh *dns.Msg) *dns.Msg {
+	merged := fresh.Copy()
+	seen := make(map[string]bool, len(merged.Answer))
+	for _, rr := range merged.Answer {
+		seen[rrIdentity(rr)] = true
+	}
+	for _, rr := range existing.Answer {
+		if id := rrIdentity(rr); !seen[id] {
+			merged.Answer = append(merged.Answer, rr)
+			seen[id] = true
+		}
+	}
+	return merged
+}
+
+// rrIdentity renders rr's name/type/class/rdata, ignoring its TTL, so two
+// observations of the same record at different TTLs are recognized as the
+// same record by mergeAnswers rather than kept as duplicates.
+func rrIdentity(rr dns.RR) string {
+	c := dns.Copy(rr)
+	c.Header().Ttl = 0
+	return c.String()
+}
+
 // removeOldest removes the oldest item from the cache.
 func (c *LRUCache) removeOldest() {
 	elem := c.ll.Back()
@@ -15,25 +15,70 @@ func TestLRUCache_GetAndUpdate(t *testing.T) {
 	msg.Answer = append(msg.Answer, &dns.A{Hdr: dns.RR_Header{Name: "example.com.", Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: 3600}, A: []byte{1, 2, 3, 4}})
 
 	// Test Get on empty cache
-	if m, _ := cache.Get(zone, q); m != nil {
+	if m, _ := cache.Get(zone, q, false, false); m != nil {
 		t.Error("expected nil from empty cache")
 	}
 
 	// Test Update
-	cache.Update(zone, q, msg)
-	if m, _ := cache.Get(zone, q); m == nil {
+	cache.Update(zone, q, false, false, msg)
+	if m, _ := cache.Get(zone, q, false, false); m == nil {
 		t.Error("failed to get item from cache")
 	}
 
 	// Test update existing
 	msg.Answer = append(msg.Answer, &dns.A{Hdr: dns.RR_Header{Name: "example.com.", Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: 3600}, A: []byte{5, 6, 7, 8}})
-	cache.Update(zone, q, msg)
-	m, _ := cache.Get(zone, q)
+	cache.Update(zone, q, false, false, msg)
+	m, _ := cache.Get(zone, q, false, false)
 	if len(m.Answer) != 2 {
 		t.Error("failed to update item in cache")
 	}
 }
 
+func TestLRUCache_UpdateMergesOverlappingRecordsInsteadOfReplacing(t *testing.T) {
+	cache := NewLRUCache(2)
+	zone := "."
+	q := dns.Question{Name: "example.com.", Qtype: dns.TypeA, Qclass: dns.ClassINET}
+
+	msg1 := new(dns.Msg)
+	msg1.SetQuestion("example.com.", dns.TypeA)
+	msg1.Answer = append(msg1.Answer, &dns.A{Hdr: dns.RR_Header{Name: "example.com.", Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: 3600}, A: []byte{1, 2, 3, 4}})
+	cache.Update(zone, q, false, false, msg1)
+
+	// A second, independently-built message for the same key that only
+	// knows about a different record - as if it came from resolving one
+	// more hop of a chain rather than the whole answer at once.
+	msg2 := new(dns.Msg)
+	msg2.SetQuestion("example.com.", dns.TypeA)
+	msg2.Answer = append(msg2.Answer, &dns.A{Hdr: dns.RR_Header{Name: "example.com.", Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: 3600}, A: []byte{5, 6, 7, 8}})
+	cache.Update(zone, q, false, false, msg2)
+
+	m, _ := cache.Get(zone, q, false, false)
+	if len(m.Answer) != 2 {
+		t.Fatalf("expected the second Update to merge with, not replace, the first entry's records, got %d", len(m.Answer))
+	}
+}
+
+func TestLRUCache_UpdateDeduplicatesSameRecordAtDifferentTTL(t *testing.T) {
+	cache := NewLRUCache(2)
+	zone := "."
+	q := dns.Question{Name: "example.com.", Qtype: dns.TypeA, Qclass: dns.ClassINET}
+
+	msg1 := new(dns.Msg)
+	msg1.SetQuestion("example.com.", dns.TypeA)
+	msg1.Answer = append(msg1.Answer, &dns.A{Hdr: dns.RR_Header{Name: "example.com.", Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: 3600}, A: []byte{1, 2, 3, 4}})
+	cache.Update(zone, q, false, false, msg1)
+
+	msg2 := new(dns.Msg)
+	msg2.SetQuestion("example.com.", dns.TypeA)
+	msg2.Answer = append(msg2.Answer, &dns.A{Hdr: dns.RR_Header{Name: "example.com.", Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: 60}, A: []byte{1, 2, 3, 4}})
+	cache.Update(zone, q, false, false, msg2)
+
+	m, _ := cache.Get(zone, q, false, false)
+	if len(m.Answer) != 1 {
+		t.Fatalf("expected the same record seen at a different TTL to be deduplicated, got %d records", len(m.Answer))
+	}
+}
+
 func TestLRUCache_Eviction(t *testing.T) {
 	cache := NewLRUCache(2)
 	zone := "."
@@ -51,27 +96,27 @@ func TestLRUCache_Eviction(t *testing.T) {
 	msg3.SetQuestion("example3.com.", dns.TypeA)
 
 	// Fill the cache
-	cache.Update(zone, q1, msg1)
-	cache.Update(zone, q2, msg2)
+	cache.Update(zone, q1, false, false, msg1)
+	cache.Update(zone, q2, false, false, msg2)
 
 	// Access q1 to make it most recently used
-	cache.Get(zone, q1)
+	cache.Get(zone, q1, false, false)
 
 	// Add a third item, which should evict q2
-	cache.Update(zone, q3, msg3)
+	cache.Update(zone, q3, false, false, msg3)
 
 	// q1 should still be in the cache
-	if m, _ := cache.Get(zone, q1); m == nil {
+	if m, _ := cache.Get(zone, q1, false, false); m == nil {
 		t.Error("q1 should be in the cache")
 	}
 
 	// q2 should have been evicted
-	if m, _ := cache.Get(zone, q2); m != nil {
+	if m, _ := cache.Get(zone, q2, false, false); m != nil {
 		t.Error("q2 should have been evicted from the cache")
 	}
 
 	// q3 should be in the cache
-	if m, _ := cache.Get(zone, q3); m == nil {
+	if m, _ := cache.Get(zone, q3, false, false); m == nil {
 		t.Error("q3 should be in the cache")
 	}
 }
@@ -1,42 +1,57 @@
 package cache
 
 import (
+	"container/heap"
 	"context"
 	"dns-resolver/internal/config"
-	"fmt"
-	"log"
-	"strings"
+	"log/slog"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"container/list"
 	"dns-resolver/internal/interfaces"
+	"dns-resolver/internal/logging"
+	"dns-resolver/internal/metrics"
 	"github.com/miekg/dns"
 )
 
-const (
-	// DefaultCacheSize is the default number of items the cache can hold.
-	DefaultCacheSize = 10000
-	// DefaultShards is the default number of shards for the cache.
-	DefaultShards = 32
+// slruProbationFraction is the fraction of the cache size allocated to the probation segment.
+const slruProbationFraction = 0.8
 
-	// slruProbationFraction is the fraction of the cache size allocated to the probation segment.
-	slruProbationFraction = 0.8
-)
+// windowFraction is the fraction of a shard's total capacity given to its
+// W-TinyLFU admission window, the small always-admit LRU new keys land in
+// before they have to earn a spot in the SLRU segments.
+const windowFraction = 0.01
+
+// topNPrefetchCandidates bounds how many of a shard's hottest keys are
+// tracked in its hot-key heap for early, 10%-rule-bypassing prefetch.
+const topNPrefetchCandidates = 32
 
 // MessageCacheItem represents an item in the message cache.
 type MessageCacheItem struct {
-	Message    *dns.Msg
-	Expiration time.Time
+	Message     *dns.Msg
+	Expiration  time.Time
 	OriginalTTL time.Duration
 	// StaleWhileRevalidate will be used to store the duration for which a stale entry can be served.
 	StaleWhileRevalidate time.Duration
 	// Prefetch will be used to store the duration before expiration to trigger a prefetch.
 	Prefetch time.Duration
+	// HitCount is incremented on every Get and drained back to 0 each
+	// checkAndPrefetch tick, so it approximates the item's hit rate over
+	// the last half-PrefetchInterval window rather than a cumulative total.
+	HitCount int64
+	// key is this item's cache key, set once at insertion so the hot-key
+	// heap (and checkAndPrefetch) can look it up without going through
+	// element/parentList.
+	key string
 	// element is a reference to the list.Element in the LRU list for quick deletion/movement.
 	element *list.Element
 	// parentList is a reference to the list.List this item belongs to.
 	parentList *list.List
+	// heapIndex is this item's position in its shard's hot-key heap, or -1
+	// if it isn't currently tracked there. Maintained by heap.Interface.
+	heapIndex int
 }
 
 // messageSlruSegment represents one segment of the SLRU message cache.
@@ -47,6 +62,24 @@ type messageSlruSegment struct {
 	protectedList     *list.List // Protected segment (MRU of this list stays, LRU moves to probation or evicted)
 	probationCapacity int
 	protectedCapacity int
+
+	// windowList is the W-TinyLFU admission window: every new key lands
+	// here first and is always admitted. When it overflows, its LRU victim
+	// is weighed against the probation segment's own LRU victim (see
+	// admit) instead of being admitted outright.
+	windowList     *list.List
+	windowCapacity int
+	// sketch estimates each key's access frequency; door guards it so a
+	// key seen only once never pollutes the estimate.
+	sketch *countMinSketch
+	door   *doorkeeper
+
+	// hotMu guards hotHeap, a bounded min-heap (by HitCount) of this
+	// shard's topNPrefetchCandidates hottest keys, tracked independently of
+	// items' own RWMutex since it's updated on every Get, including reads
+	// that otherwise only take the read lock.
+	hotMu   sync.Mutex
+	hotHeap prefetchHeap
 }
 
 // MessageCache is a thread-safe, sharded DNS message cache with SLRU eviction policy.
@@ -62,6 +95,15 @@ type MessageCache struct {
 	stopPrefetch     chan struct{}
 	resolver         interfaces.CacheResolver // Reference to the resolver for prefetching
 	config           *config.Config
+
+	// metrics, if set via SetMetrics, receives W-TinyLFU admission outcomes
+	// and popularity-driven prefetch outcomes.
+	metrics *metrics.Metrics
+
+	// logger records prefetch lifecycle events; built from cfg by
+	// logging.New, so its format/dedup window follow cfg.LogFormat/
+	// LogDedupWindow.
+	logger *slog.Logger
 }
 
 // NewMessageCache creates and returns a new MessageCache.
@@ -76,15 +118,31 @@ func NewMessageCache(cfg *config.Config, numShards int) *MessageCache {
 
 	probationSize := int(float64(size) * slruProbationFraction)
 	protectedSize := size - probationSize
+	windowSize := int(float64(size) * windowFraction)
+	if windowSize < numShards {
+		windowSize = numShards
+	}
 
 	shards := make([]*messageSlruSegment, numShards)
 	for i := 0; i < numShards; i++ {
+		probationCapacity := probationSize / numShards
+		protectedCapacity := protectedSize / numShards
+		windowCapacity := windowSize / numShards
+		if windowCapacity < 1 {
+			windowCapacity = 1
+		}
+		shardCapacity := probationCapacity + protectedCapacity + windowCapacity
+
 		shards[i] = &messageSlruSegment{
 			items:             make(map[string]*MessageCacheItem),
 			probationList:     list.New(),
 			protectedList:     list.New(),
-			probationCapacity: probationSize / numShards,
-			protectedCapacity: protectedSize / numShards,
+			probationCapacity: probationCapacity,
+			protectedCapacity: protectedCapacity,
+			windowList:        list.New(),
+			windowCapacity:    windowCapacity,
+			sketch:            newCountMinSketch(shardCapacity),
+			door:              newDoorkeeper(shardCapacity),
 		}
 	}
 
@@ -96,6 +154,7 @@ func NewMessageCache(cfg *config.Config, numShards int) *MessageCache {
 		prefetchInterval: cfg.PrefetchInterval,
 		stopPrefetch:     make(chan struct{}),
 		config:           cfg,
+		logger:           logging.New(cfg),
 	}
 }
 
@@ -105,6 +164,13 @@ func (c *MessageCache) SetResolver(r interfaces.CacheResolver) {
 	go c.runPrefetcher()
 }
 
+// SetMetrics wires m so W-TinyLFU admission/rejection/aging-reset outcomes
+// can be observed. It may be left unset in tests that don't care about
+// metrics.
+func (c *MessageCache) SetMetrics(m *metrics.Metrics) {
+	c.metrics = m
+}
+
 // runPrefetcher periodically checks for items to prefetch.
 func (c *MessageCache) runPrefetcher() {
 	ticker := time.NewTicker(c.prefetchInterval / 2) // Check more frequently than prefetch interval
@@ -121,29 +187,74 @@ func (c *MessageCache) runPrefetcher() {
 }
 
 // checkAndPrefetch iterates through cache items and prefetches those nearing expiration.
+// checkAndPrefetch walks each shard's bounded hot-key heap (not its full
+// item set) and prefetches a candidate once it's close enough to expiry.
+// Membership in that heap only means a key was the shard's hottest at some
+// point since the last tick, not that it's still popular now, so every
+// candidate here - whether it clears via CachePrefetchThreshold or the 10%
+// TTL rule - first has to have actually been queried CachePrefetchMinHits
+// times since the last tick; one that misses that gate is counted as
+// skipped rather than silently dropped or, worse, refreshed anyway.
 func (c *MessageCache) checkAndPrefetch() {
 	now := time.Now()
-	// Iterate over all shards and their items
+	minHits := c.config.CachePrefetchMinHits
+	if minHits <= 0 {
+		minHits = DefaultPrefetchThresholdHits
+	}
+
 	for _, shard := range c.shards {
-		shard.RLock()
-		for key, item := range shard.items {
-			if item.OriginalTTL > 0 {
-				remainingTTL := item.Expiration.Sub(now)
-				// Prefetch if the remaining TTL is less than 10% of the original TTL.
-				if remainingTTL > 0 && remainingTTL < (item.OriginalTTL/10) {
-					go c.performPrefetch(key, item.Message.Question[0])
+		shard.hotMu.Lock()
+		candidates := make([]*MessageCacheItem, len(shard.hotHeap))
+		copy(candidates, shard.hotHeap)
+		shard.hotMu.Unlock()
+
+		for _, item := range candidates {
+			shard.RLock()
+			present := shard.items[item.key] == item
+			shard.RUnlock()
+			if !present || item.OriginalTTL <= 0 {
+				continue
+			}
+
+			remainingTTL := item.Expiration.Sub(now)
+			if remainingTTL <= 0 {
+				continue
+			}
+			hits := atomic.SwapInt64(&item.HitCount, 0)
+			if hits < minHits {
+				if c.metrics != nil {
+					c.metrics.IncrementPrefetchesSkippedLowPopularity()
+				}
+				continue
+			}
+
+			if c.config.CachePrefetchThreshold > 0 && remainingTTL < c.config.CachePrefetchThreshold {
+				go c.performPrefetch(item.key, item.Message.Question[0])
+				if c.metrics != nil {
+					c.metrics.IncrementPrefetchesPopularityTriggered()
 				}
+				continue
+			}
+
+			if remainingTTL >= item.OriginalTTL/10 {
+				continue
 			}
+			go c.performPrefetch(item.key, item.Message.Question[0])
 		}
-		shard.RUnlock()
 	}
 }
 
 // performPrefetch performs a background DNS lookup for a given question.
 func (c *MessageCache) performPrefetch(key string, q dns.Question) {
+	if c.resolver == nil {
+		// No resolver wired up yet (SetResolver hasn't run); nothing to
+		// prefetch through.
+		return
+	}
+
 	// Use singleflight to avoid duplicate prefetch requests
 	_, err, _ := c.resolver.GetSingleflightGroup().Do(key+"-prefetch", func() (interface{}, error) {
-		log.Printf("Prefetching %s", q.Name)
+		c.logger.Info("prefetching", "qname", q.Name, "qtype", q.Qtype)
 		// Create a new request for prefetching
 		req := new(dns.Msg)
 		req.SetQuestion(q.Name, q.Qtype)
@@ -154,7 +265,7 @@ func (c *MessageCache) performPrefetch(key string, q dns.Question) {
 
 		resp, err := c.resolver.LookupWithoutCache(ctx, req) // Assuming a method to lookup without cache
 		if err != nil {
-			log.Printf("Prefetch failed for %s: %v", q.Name, err)
+			c.logger.Error("prefetch failed", "qname", q.Name, "qtype", q.Qtype, "error", err)
 			return nil, err
 		}
 
@@ -164,15 +275,10 @@ func (c *MessageCache) performPrefetch(key string, q dns.Question) {
 	})
 
 	if err != nil {
-		log.Printf("Prefetch singleflight error for %s: %v", q.Name, err)
+		c.logger.Error("prefetch singleflight error", "qname", q.Name, "qtype", q.Qtype, "error", err)
 	}
 }
 
-// Key generates a cache key from a dns.Question.
-func Key(q dns.Question) string {
-	return fmt.Sprintf("%s:%d:%d", strings.ToLower(q.Name), q.Qtype, q.Qclass)
-}
-
 // getShard returns the shard for a given key.
 func (c *MessageCache) getShard(key string) *messageSlruSegment {
 	hash := fnv32(key)
@@ -200,6 +306,10 @@ func (c *MessageCache) Get(key string) (*dns.Msg, bool, bool) {
 		return nil, false, false // Not found, not stale
 	}
 
+	shard.recordAccess(key, c.metrics)
+	atomic.AddInt64(&item.HitCount, 1)
+	shard.trackHeat(item)
+
 	// Check if the item is expired
 	if time.Now().After(item.Expiration) {
 		// Item is expired. Check for stale-while-revalidate.
@@ -225,6 +335,12 @@ func (c *MessageCache) Get(key string) (*dns.Msg, bool, bool) {
 
 // Set adds a message to the cache.
 func (c *MessageCache) Set(key string, msg *dns.Msg, swr, prefetch time.Duration) {
+	if msg.Truncated {
+		// A truncated response is incomplete; never let it poison the cache
+		// for a subsequent query that might get the full answer.
+		return
+	}
+
 	shard := c.getShard(key)
 	shard.Lock()
 	defer shard.Unlock()
@@ -240,9 +356,13 @@ func (c *MessageCache) Set(key string, msg *dns.Msg, swr, prefetch time.Duration
 		existingItem.OriginalTTL = rawTTL
 		existingItem.StaleWhileRevalidate = swr
 		existingItem.Prefetch = prefetch
-		// Move to front of protected list
+		shard.recordAccess(key, c.metrics)
+		// Move to front of protected list (or, for a window item, just to
+		// the window's MRU position; see accessItem).
 		if existingItem.element != nil {
-			if existingItem.parentList == shard.probationList {
+			if existingItem.parentList == shard.windowList {
+				shard.windowList.MoveToFront(existingItem.element)
+			} else if existingItem.parentList == shard.probationList {
 				shard.probationList.Remove(existingItem.element)
 				shard.addProtected(key, existingItem)
 			} else if existingItem.parentList == shard.protectedList {
@@ -252,15 +372,108 @@ func (c *MessageCache) Set(key string, msg *dns.Msg, swr, prefetch time.Duration
 		return
 	}
 
-	// New item, add to probation segment.
+	// New item: run it through the W-TinyLFU admission window rather than
+	// handing it straight to the probation segment.
 	item := &MessageCacheItem{
 		Message:              msg.Copy(),
 		Expiration:           expiration,
 		OriginalTTL:          rawTTL,
 		StaleWhileRevalidate: swr,
 		Prefetch:             prefetch,
+		key:                  key,
+		heapIndex:            -1,
+	}
+	shard.admit(key, item, c.metrics)
+}
+
+// recordAccess registers key's access with the shard's doorkeeper/sketch,
+// reporting an aging reset via m (if set) when it occurs. A key's first
+// sighting only sets its doorkeeper bits; only a repeat sighting reaches the
+// sketch, so a one-off key never inflates another key's frequency estimate.
+func (s *messageSlruSegment) recordAccess(key string, m *metrics.Metrics) {
+	if !s.door.testAndSet(key) {
+		return
+	}
+	if s.sketch.Add(key) {
+		s.door.reset()
+		if m != nil {
+			m.IncrementCacheAdmissionAgingReset()
+		}
+	}
+}
+
+// trackHeat records item in the shard's bounded top-N hot-key heap, used by
+// checkAndPrefetch to refresh the hottest keys ahead of the 10% TTL rule
+// without having to scan every item in the shard. A key already tracked has
+// its position fixed to reflect its new HitCount; otherwise it's pushed on,
+// evicting the coldest tracked key once the heap exceeds
+// topNPrefetchCandidates. An item that's since been evicted from the cache
+// (or had its HitCount drained back to 0 by checkAndPrefetch) is the
+// natural next eviction candidate, so stale entries age out of the heap on
+// their own without an explicit removal path.
+func (s *messageSlruSegment) trackHeat(item *MessageCacheItem) {
+	s.hotMu.Lock()
+	defer s.hotMu.Unlock()
+
+	if item.heapIndex >= 0 {
+		heap.Fix(&s.hotHeap, item.heapIndex)
+		return
+	}
+
+	heap.Push(&s.hotHeap, item)
+	if s.hotHeap.Len() > topNPrefetchCandidates {
+		heap.Pop(&s.hotHeap)
+	}
+}
+
+// admit runs a brand-new key through the shard's W-TinyLFU admission
+// window: it's always pushed onto the window first, and only once that
+// overflows is its LRU victim weighed against the probation segment's own
+// LRU victim by estimated frequency (see countMinSketch), so a burst of
+// one-hit-wonders can no longer evict an already-hot probation entry.
+func (s *messageSlruSegment) admit(key string, item *MessageCacheItem, m *metrics.Metrics) {
+	s.recordAccess(key, m)
+
+	item.element = s.windowList.PushFront(key)
+	item.parentList = s.windowList
+	s.items[key] = item
+
+	if s.windowList.Len() <= s.windowCapacity {
+		return
+	}
+
+	victimElem := s.windowList.Back()
+	victimKey := victimElem.Value.(string)
+	victimItem := s.items[victimKey]
+	s.windowList.Remove(victimElem)
+	delete(s.items, victimKey)
+
+	probationVictimElem := s.probationList.Back()
+	if s.probationList.Len() < s.probationCapacity || probationVictimElem == nil {
+		// The probation segment has room: admit the window victim outright.
+		s.addProbation(victimKey, victimItem)
+		if m != nil {
+			m.IncrementCacheAdmission()
+		}
+		return
+	}
+
+	probationVictimKey := probationVictimElem.Value.(string)
+	if s.sketch.Estimate(victimKey) <= s.sketch.Estimate(probationVictimKey) {
+		// The window victim isn't hot enough to displace the incumbent;
+		// it's dropped from the cache entirely.
+		if m != nil {
+			m.IncrementCacheRejection()
+		}
+		return
+	}
+
+	delete(s.items, probationVictimKey)
+	s.probationList.Remove(probationVictimElem)
+	s.addProbation(victimKey, victimItem)
+	if m != nil {
+		m.IncrementCacheAdmission()
 	}
-	shard.addProbation(key, item)
 }
 
 // addProbation adds an item to the probation segment.
@@ -348,14 +561,20 @@ func (c *MessageCache) clampTTL(ttl time.Duration) time.Duration {
 	return ttl
 }
 
-// accessItem moves an item to the front of its respective SLRU list (probation or protected).
+// accessItem moves an item to the front of its respective list on a cache
+// hit. A window item just moves to the window's MRU position (admission
+// into probation/protected only happens when it falls out of the window,
+// see admit); a probation item is promoted to protected; a protected item
+// just moves to the front.
 func (s *messageSlruSegment) accessItem(item *MessageCacheItem) {
 	if item.element == nil {
 		// This should not happen for items retrieved from cache, but as a safeguard.
 		return
 	}
 
-	if item.parentList == s.probationList {
+	if item.parentList == s.windowList {
+		s.windowList.MoveToFront(item.element)
+	} else if item.parentList == s.probationList {
 		// Item is in probation, move to protected.
 		s.probationList.Remove(item.element)
 		s.addProtected(item.element.Value.(string), item)
@@ -364,3 +583,37 @@ func (s *messageSlruSegment) accessItem(item *MessageCacheItem) {
 		s.protectedList.MoveToFront(item.element)
 	}
 }
+
+// prefetchHeap is a min-heap of *MessageCacheItem ordered by HitCount, used
+// to track a shard's topNPrefetchCandidates hottest keys: the item with the
+// lowest HitCount is always at index 0, so overflowing the heap's capacity
+// evicts the coldest tracked candidate first.
+type prefetchHeap []*MessageCacheItem
+
+func (h prefetchHeap) Len() int { return len(h) }
+
+func (h prefetchHeap) Less(i, j int) bool {
+	return atomic.LoadInt64(&h[i].HitCount) < atomic.LoadInt64(&h[j].HitCount)
+}
+
+func (h prefetchHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].heapIndex = i
+	h[j].heapIndex = j
+}
+
+func (h *prefetchHeap) Push(x interface{}) {
+	item := x.(*MessageCacheItem)
+	item.heapIndex = len(*h)
+	*h = append(*h, item)
+}
+
+func (h *prefetchHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	item := old[n-1]
+	old[n-1] = nil
+	item.heapIndex = -1
+	*h = old[:n-1]
+	return item
+}
@@ -0,0 +1,226 @@
+package cache
+
+import (
+	"dns-resolver/internal/config"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+func TestMessageCache_MissesAcrossCDAndDOBits(t *testing.T) {
+	cfg := config.NewConfig()
+	mc := NewMessageCache(cfg, DefaultShards)
+
+	q := dns.Question{Name: "bogus.example.com.", Qtype: dns.TypeA, Qclass: dns.ClassINET}
+	cd1Key := Key(q, false, true)
+
+	msg := new(dns.Msg)
+	msg.SetQuestion(q.Name, q.Qtype)
+	rr, err := dns.NewRR("bogus.example.com. 60 IN A 6.6.6.6")
+	if err != nil {
+		t.Fatalf("failed to create RR: %v", err)
+	}
+	msg.Answer = []dns.RR{rr}
+
+	// A client with CD=1 resolved and cached a bogus-but-accepted answer.
+	mc.Set(cd1Key, msg, 0, 0)
+
+	// A CD=0 client expects DNSSEC-validated data and must not see it.
+	cd0Key := Key(q, false, false)
+	if _, found, _ := mc.Get(cd0Key); found {
+		t.Fatal("CD=0 lookup must miss an entry cached under CD=1")
+	}
+
+	// A DO=1 query carrying RRSIGs must not be handed to a DO=0 querier either.
+	doQ := dns.Question{Name: "signed.example.com.", Qtype: dns.TypeA, Qclass: dns.ClassINET}
+	do1Key := Key(doQ, true, false)
+	doMsg := new(dns.Msg)
+	doMsg.SetQuestion(doQ.Name, doQ.Qtype)
+	aRR, _ := dns.NewRR("signed.example.com. 60 IN A 1.2.3.4")
+	doMsg.Answer = []dns.RR{aRR}
+	mc.Set(do1Key, doMsg, 0, 0)
+
+	do0Key := Key(doQ, false, false)
+	if _, found, _ := mc.Get(do0Key); found {
+		t.Fatal("DO=0 lookup must miss an entry cached under DO=1")
+	}
+	if _, found, _ := mc.Get(do1Key); !found {
+		t.Fatal("DO=1 lookup should still find its own entry")
+	}
+}
+
+func newTestMsg(name string) *dns.Msg {
+	msg := new(dns.Msg)
+	msg.SetQuestion(name, dns.TypeA)
+	rr, _ := dns.NewRR(name + " 60 IN A 1.2.3.4")
+	msg.Answer = []dns.RR{rr}
+	return msg
+}
+
+func TestMessageCache_NewKeyEntersWindowAndIsFetchable(t *testing.T) {
+	cfg := config.NewConfig()
+	mc := NewMessageCache(cfg, 1)
+
+	key := Key(dns.Question{Name: "window.example.com.", Qtype: dns.TypeA, Qclass: dns.ClassINET}, false, false)
+	mc.Set(key, newTestMsg("window.example.com."), 0, 0)
+
+	if _, found, _ := mc.Get(key); !found {
+		t.Fatal("a freshly-set key must be fetchable from the admission window")
+	}
+
+	shard := mc.getShard(key)
+	if shard.windowList.Len() != 1 {
+		t.Fatalf("expected the new item to land in the window, got window length %d", shard.windowList.Len())
+	}
+}
+
+func TestMessageSlruSegment_Admit_RejectsColdWindowVictimWhenProbationIsFull(t *testing.T) {
+	cfg := config.NewConfig()
+	mc := NewMessageCache(cfg, 1)
+	shard := mc.getShard("irrelevant")
+	shard.windowCapacity = 1
+	shard.probationCapacity = 1
+
+	hotKey := "hot.example.com."
+	hotItem := &MessageCacheItem{Message: newTestMsg(hotKey)}
+	shard.admit(hotKey, hotItem, nil)
+	// Promote hot into probation by overflowing the window with a filler key.
+	shard.admit("filler-1.example.com.", &MessageCacheItem{Message: newTestMsg("filler-1.example.com.")}, nil)
+	if _, ok := shard.items[hotKey]; !ok {
+		t.Fatal("hotKey should have been admitted into probation")
+	}
+
+	// Make hotKey's estimated frequency clearly higher than a one-off key's.
+	shard.sketch.Add(hotKey)
+	shard.sketch.Add(hotKey)
+	shard.sketch.Add(hotKey)
+
+	coldKey := "cold.example.com."
+	shard.admit(coldKey, &MessageCacheItem{Message: newTestMsg(coldKey)}, nil)
+	// Overflow the window again so coldKey is evaluated against hotKey.
+	shard.admit("filler-2.example.com.", &MessageCacheItem{Message: newTestMsg("filler-2.example.com.")}, nil)
+
+	if _, ok := shard.items[coldKey]; ok {
+		t.Fatal("a cold window victim must not displace a hotter probation entry")
+	}
+	if _, ok := shard.items[hotKey]; !ok {
+		t.Fatal("the hotter probation entry must survive a cold challenger")
+	}
+}
+
+func TestMessageSlruSegment_Admit_AdmitsHotWindowVictimOverColdProbationEntry(t *testing.T) {
+	cfg := config.NewConfig()
+	mc := NewMessageCache(cfg, 1)
+	shard := mc.getShard("irrelevant")
+	shard.windowCapacity = 1
+	shard.probationCapacity = 1
+
+	coldKey := "cold.example.com."
+	shard.admit(coldKey, &MessageCacheItem{Message: newTestMsg(coldKey)}, nil)
+	shard.admit("filler-1.example.com.", &MessageCacheItem{Message: newTestMsg("filler-1.example.com.")}, nil)
+	if _, ok := shard.items[coldKey]; !ok {
+		t.Fatal("coldKey should have been admitted into probation (it's the only occupant)")
+	}
+
+	hotKey := "hot.example.com."
+	shard.sketch.Add(hotKey)
+	shard.sketch.Add(hotKey)
+	shard.sketch.Add(hotKey)
+
+	shard.admit(hotKey, &MessageCacheItem{Message: newTestMsg(hotKey)}, nil)
+	shard.admit("filler-2.example.com.", &MessageCacheItem{Message: newTestMsg("filler-2.example.com.")}, nil)
+
+	if _, ok := shard.items[hotKey]; !ok {
+		t.Fatal("a hot window victim must displace a colder probation entry")
+	}
+	if _, ok := shard.items[coldKey]; ok {
+		t.Fatal("the colder probation entry must have been evicted")
+	}
+}
+
+func TestMessageCache_Get_IncrementsHitCountAndTracksHeat(t *testing.T) {
+	cfg := config.NewConfig()
+	mc := NewMessageCache(cfg, 1)
+
+	key := Key(dns.Question{Name: "popular.example.com.", Qtype: dns.TypeA, Qclass: dns.ClassINET}, false, false)
+	mc.Set(key, newTestMsg("popular.example.com."), 0, 0)
+
+	for i := 0; i < 3; i++ {
+		if _, found, _ := mc.Get(key); !found {
+			t.Fatal("expected the key to remain fetchable across repeated Gets")
+		}
+	}
+
+	shard := mc.getShard(key)
+	item := shard.items[key]
+	if item.HitCount != 3 {
+		t.Fatalf("expected HitCount of 3 after 3 Gets, got %d", item.HitCount)
+	}
+	if item.heapIndex < 0 {
+		t.Fatal("expected the item to be tracked in the shard's hot-key heap")
+	}
+}
+
+func TestMessageSlruSegment_TrackHeat_EvictsColdestBeyondTopN(t *testing.T) {
+	cfg := config.NewConfig()
+	mc := NewMessageCache(cfg, 1)
+	shard := mc.getShard("irrelevant")
+
+	items := make([]*MessageCacheItem, topNPrefetchCandidates+1)
+	for i := range items {
+		items[i] = &MessageCacheItem{key: string(rune('a' + i)), heapIndex: -1, HitCount: int64(i)}
+		shard.trackHeat(items[i])
+	}
+
+	if shard.hotHeap.Len() != topNPrefetchCandidates {
+		t.Fatalf("expected the heap to stay bounded at %d, got %d", topNPrefetchCandidates, shard.hotHeap.Len())
+	}
+	if items[0].heapIndex != -1 {
+		t.Fatal("expected the coldest item (HitCount 0) to have been evicted from the heap")
+	}
+}
+
+func TestMessageCache_CheckAndPrefetch_SkipsColdCandidateUnderTTLRule(t *testing.T) {
+	cfg := config.NewConfig()
+	cfg.CachePrefetchMinHits = 100
+	mc := NewMessageCache(cfg, 1)
+
+	key := Key(dns.Question{Name: "lowhits.example.com.", Qtype: dns.TypeA, Qclass: dns.ClassINET}, false, false)
+	mc.Set(key, newTestMsg("lowhits.example.com."), 0, 0)
+	mc.Get(key) // HitCount = 1, well below CachePrefetchMinHits
+
+	shard := mc.getShard(key)
+	item := shard.items[key]
+	// 60s remaining is within the 10% TTL window (OriginalTTL/10 = 360s)
+	// but above the default CachePrefetchThreshold (10s), so this exercises
+	// the 10% TTL rule's minHits gate specifically, not the threshold
+	// bypass's.
+	item.Expiration = time.Now().Add(60 * time.Second)
+	item.OriginalTTL = time.Hour
+
+	mc.checkAndPrefetch()
+
+	if atomic.LoadInt64(&item.HitCount) != 0 {
+		t.Fatal("expected checkAndPrefetch to drain HitCount even when it skips the candidate")
+	}
+}
+
+func TestMessageCache_SkipsTruncatedResponses(t *testing.T) {
+	cfg := config.NewConfig()
+	mc := NewMessageCache(cfg, DefaultShards)
+
+	q := dns.Question{Name: "truncated.example.com.", Qtype: dns.TypeA, Qclass: dns.ClassINET}
+	key := Key(q, false, false)
+
+	msg := new(dns.Msg)
+	msg.SetQuestion(q.Name, q.Qtype)
+	msg.Truncated = true
+
+	mc.Set(key, msg, 0, 0)
+
+	if _, found, _ := mc.Get(key); found {
+		t.Fatal("a truncated response must never be cached")
+	}
+}
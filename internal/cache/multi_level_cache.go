@@ -5,6 +5,7 @@ import (
 
 	"dns-resolver/internal/config"
 	"dns-resolver/internal/interfaces"
+	"dns-resolver/internal/workerpool"
 	"github.com/miekg/dns"
 )
 
@@ -13,15 +14,17 @@ type MultiLevelCache struct {
 	messageCache *MessageCache
 	rrsetCache   *RRsetCache
 	nsecCache    *NsecCache
+	nsec3Cache   *NSEC3Cache
 	resolver     interfaces.CacheResolver
 }
 
 // NewMultiLevelCache creates a new MultiLevelCache.
 func NewMultiLevelCache(cfg *config.Config) *MultiLevelCache {
 	return &MultiLevelCache{
-		messageCache: NewMessageCache(cfg, cfg.MsgCacheSlabs),
-		rrsetCache:   NewRRsetCache(cfg, cfg.RRsetCacheSlabs),
+		messageCache: NewMessageCache(cfg, DefaultShards),
+		rrsetCache:   NewRRsetCache(cfg, DefaultShards),
 		nsecCache:    NewNsecCache(cfg),
+		nsec3Cache:   NewNSEC3Cache(cfg),
 	}
 }
 
@@ -32,38 +35,65 @@ func (c *MultiLevelCache) SetResolver(r interfaces.CacheResolver) {
 	c.rrsetCache.SetResolver(r)
 }
 
+// SetWorkerPool attaches the pool that background RRset refreshes (prefetch
+// and stale revalidation) are submitted to.
+func (c *MultiLevelCache) SetWorkerPool(p *workerpool.Pool) {
+	c.rrsetCache.SetWorkerPool(p)
+}
+
 // Get retrieves a message from the cache, checking both message and RRset caches.
-func (c *MultiLevelCache) Get(q dns.Question) (*dns.Msg, bool, bool) {
-	key := Key(q)
+// do and cd are the DO and CD bits of the request, which are folded into the
+// message cache key, the RRset/RRSIG cache keys used by synthesizeFromRRset,
+// and the NSEC/NSEC3 lookups, so a response (or synthesized answer)
+// resolved for one combination of those bits is never handed to a client
+// that sent the other.
+func (c *MultiLevelCache) Get(q dns.Question, do, cd bool) (*dns.Msg, bool, bool) {
+	key := Key(q, do, cd)
 	// First, check the message cache.
 	if msg, found, revalidate := c.messageCache.Get(key); found {
 		return msg, true, revalidate
 	}
 
 	// If not in message cache, try to synthesize from RRset cache.
-	if msg, found := c.synthesizeFromRRset(q); found {
+	if msg, found := c.synthesizeFromRRset(q, do, cd); found {
 		return msg, true, false
 	}
 
-	// Finally, check the NSEC cache to prove non-existence.
-	if msg, found := c.nsecCache.Check(q); found {
+	// Finally, check the NSEC/NSEC3 caches to prove non-existence.
+	if msg, found := c.nsecCache.Check(q, do); found {
+		return msg, true, false
+	}
+	if msg, found := c.nsec3Cache.Check(q, do); found {
 		return msg, true, false
 	}
 
 	return nil, false, false
 }
 
-// Set adds a message to the cache, decomposing it into RRsets as well.
-func (c *MultiLevelCache) Set(key string, msg *dns.Msg, swr, prefetch time.Duration) {
+// Set adds a message to the cache, decomposing it into RRsets as well. do
+// and cd are the DO/CD bits of the request that produced msg, so the
+// decomposed RRsets (and, for do, their RRSIGs) land under the same
+// do/cd-qualified keys synthesizeFromRRset looks them up under.
+func (c *MultiLevelCache) Set(key string, msg *dns.Msg, swr, prefetch time.Duration, do, cd bool) {
+	if msg.Truncated {
+		// A truncated response is incomplete; never let it poison the cache
+		// for a subsequent query that might get the full answer.
+		return
+	}
+
 	// Add the full message to the message cache.
 	c.messageCache.Set(key, msg, swr, prefetch)
 
 	// Decompose the message and add RRsets to the RRset cache.
-	c.decomposeAndCacheRRsets(msg)
+	c.decomposeAndCacheRRsets(msg, do, cd)
 }
 
-// synthesizeFromRRset tries to build a DNS response from cached RRsets.
-func (c *MultiLevelCache) synthesizeFromRRset(q dns.Question) (*dns.Msg, bool) {
+// synthesizeFromRRset tries to build a DNS response from cached RRsets,
+// keying every lookup on do/cd so it never mixes data cached for one
+// combination of those bits into a response for the other. When do is set,
+// it also attaches the RRSIG set cached alongside each RRset (see
+// rrsigKey), so a DO=1 client gets signatures a DO=0 client never sees.
+func (c *MultiLevelCache) synthesizeFromRRset(q dns.Question, do, cd bool) (*dns.Msg, bool) {
 	msg := new(dns.Msg)
 	msg.SetQuestion(q.Name, q.Qtype)
 
@@ -72,22 +102,28 @@ func (c *MultiLevelCache) synthesizeFromRRset(q dns.Question) (*dns.Msg, bool) {
 
 	for i := 0; i < 10; i++ { // CNAME loop limit
 		// Look for the requested type for the current name
-		qKey := Key(dns.Question{Name: currentName, Qtype: q.Qtype, Qclass: q.Qclass})
-		rrset, found := c.rrsetCache.Get(qKey)
+		qKey := Key(dns.Question{Name: currentName, Qtype: q.Qtype, Qclass: q.Qclass}, do, cd)
+		rrset, found, _ := c.rrsetCache.Get(qKey)
 		if found {
 			msg.Answer = append(msg.Answer, rrset...)
+			if do {
+				msg.Answer = append(msg.Answer, c.lookupRRSIGs(currentName, q.Qtype, q.Qclass)...)
+			}
 			foundAnswer = true
 			break // Found the answer, no need to look for CNAMEs
 		}
 
 		// If no direct answer, look for a CNAME
-		cnameKey := Key(dns.Question{Name: currentName, Qtype: dns.TypeCNAME, Qclass: q.Qclass})
-		cnameRRset, cnameFound := c.rrsetCache.Get(cnameKey)
+		cnameKey := Key(dns.Question{Name: currentName, Qtype: dns.TypeCNAME, Qclass: q.Qclass}, do, cd)
+		cnameRRset, cnameFound, _ := c.rrsetCache.Get(cnameKey)
 		if !cnameFound {
 			break // No answer and no CNAME, can't proceed
 		}
 
 		msg.Answer = append(msg.Answer, cnameRRset...)
+		if do {
+			msg.Answer = append(msg.Answer, c.lookupRRSIGs(currentName, dns.TypeCNAME, q.Qclass)...)
+		}
 		foundAnswer = true
 		if cname, ok := cnameRRset[0].(*dns.CNAME); ok {
 			currentName = cname.Target
@@ -102,20 +138,29 @@ func (c *MultiLevelCache) synthesizeFromRRset(q dns.Question) (*dns.Msg, bool) {
 
 	// Try to add authority and additional records for the original question's zone.
 	nsQ := dns.Question{Name: q.Name, Qtype: dns.TypeNS, Qclass: q.Qclass}
-	nsKey := Key(nsQ)
-	nsRRset, nsFound := c.rrsetCache.Get(nsKey)
+	nsKey := Key(nsQ, do, cd)
+	nsRRset, nsFound, _ := c.rrsetCache.Get(nsKey)
 	if nsFound {
 		msg.Ns = append(msg.Ns, nsRRset...)
+		if do {
+			msg.Ns = append(msg.Ns, c.lookupRRSIGs(q.Name, dns.TypeNS, q.Qclass)...)
+		}
 		// Try to add glue records (A/AAAA for the nameservers)
 		for _, nsRR := range nsRRset {
 			if ns, ok := nsRR.(*dns.NS); ok {
-				glueAKey := Key(dns.Question{Name: ns.Ns, Qtype: dns.TypeA, Qclass: q.Qclass})
-				if glue, found := c.rrsetCache.Get(glueAKey); found {
+				glueAKey := Key(dns.Question{Name: ns.Ns, Qtype: dns.TypeA, Qclass: q.Qclass}, do, cd)
+				if glue, found, _ := c.rrsetCache.Get(glueAKey); found {
 					msg.Extra = append(msg.Extra, glue...)
+					if do {
+						msg.Extra = append(msg.Extra, c.lookupRRSIGs(ns.Ns, dns.TypeA, q.Qclass)...)
+					}
 				}
-				glueAAAAKey := Key(dns.Question{Name: ns.Ns, Qtype: dns.TypeAAAA, Qclass: q.Qclass})
-				if glue, found := c.rrsetCache.Get(glueAAAAKey); found {
+				glueAAAAKey := Key(dns.Question{Name: ns.Ns, Qtype: dns.TypeAAAA, Qclass: q.Qclass}, do, cd)
+				if glue, found, _ := c.rrsetCache.Get(glueAAAAKey); found {
 					msg.Extra = append(msg.Extra, glue...)
+					if do {
+						msg.Extra = append(msg.Extra, c.lookupRRSIGs(ns.Ns, dns.TypeAAAA, q.Qclass)...)
+					}
 				}
 			}
 		}
@@ -125,32 +170,109 @@ func (c *MultiLevelCache) synthesizeFromRRset(q dns.Question) (*dns.Msg, bool) {
 	return msg, true
 }
 
-// decomposeAndCacheRRsets breaks down a DNS message into RRsets and caches them.
-func (c *MultiLevelCache) decomposeAndCacheRRsets(msg *dns.Msg) {
+// lookupRRSIGs fetches the RRSIG set cached alongside the RRset for
+// name/coveredType/class (see rrsigKey), returned as []dns.RR so callers can
+// append it directly to a dns.Msg section. A miss returns nil.
+func (c *MultiLevelCache) lookupRRSIGs(name string, coveredType, class uint16) []dns.RR {
+	rrsigs, found, _ := c.rrsetCache.Get(rrsigKey(name, coveredType, class))
+	if !found {
+		return nil
+	}
+	return rrsigs
+}
+
+// decomposeAndCacheRRsets breaks down a DNS message into RRsets and caches
+// them under keys qualified by the do/cd bits of the request that produced
+// msg. RRSIGs are cached separately from the RRset they cover, under a
+// parallel key (rrsigKey) synthesizeFromRRset only consults for a DO=1
+// client, so a DO=0 response built from the same cached data never leaks
+// signatures.
+func (c *MultiLevelCache) decomposeAndCacheRRsets(msg *dns.Msg, do, cd bool) {
 	rrsets := make(map[string][]dns.RR)
+	rrsigs := make(map[string][]dns.RR)
 	allRRs := append(append(msg.Answer, msg.Ns...), msg.Extra...)
 
+	// An NSEC's owner name doesn't carry its zone apex, so find the SOA
+	// carried alongside it in the same negative response first; an NSEC3
+	// doesn't need this; its zone is read straight off its own owner name.
+	// The SOA's MINIMUM field also bounds how long a negative proof may be
+	// served for once synthesized from the cached NSEC/NSEC3 (RFC 2308
+	// §5), alongside the record's own TTL.
+	zone := ""
+	var soaMinTTL uint32
+	for _, rr := range allRRs {
+		if soa, ok := rr.(*dns.SOA); ok {
+			zone = soa.Hdr.Name
+			soaMinTTL = soa.Minttl
+			break
+		}
+	}
+
+	// RRSIGs are grouped by the name/type they cover up front so the
+	// NSEC/NSEC3 branch below can carry its own signatures into
+	// NsecCache/NSEC3Cache without a second scan over allRRs.
+	coveringSigs := make(map[string][]dns.RR)
+	for _, rr := range allRRs {
+		sig, ok := rr.(*dns.RRSIG)
+		if !ok {
+			continue
+		}
+		if sig.TypeCovered == dns.TypeNSEC || sig.TypeCovered == dns.TypeNSEC3 {
+			coveringSigs[sig.Hdr.Name] = append(coveringSigs[sig.Hdr.Name], sig)
+		}
+	}
+
+	// msg.AuthenticatedData is only set once a validating backend (or
+	// resolver.go's own validator) has verified the response's full chain
+	// of trust (see backend_resolver.go/resolver.go/knot_resolver.go).
+	// NsecCache/NSEC3Cache only ever synthesize an aggressive answer from a
+	// proof cached with this set, so an unvalidated or bogus denial of
+	// existence is never reused that way.
+	secure := msg.AuthenticatedData
+
 	// Group RRs by name, type, and class.
 	for _, rr := range allRRs {
 		switch r := rr.(type) {
 		case *dns.NSEC:
-			c.nsecCache.Add(r)
+			if zone != "" {
+				c.nsecCache.Add(zone, r, coveringSigs[r.Hdr.Name], secure, soaMinTTL)
+			}
+		case *dns.NSEC3:
+			c.nsec3Cache.Add(r, coveringSigs[r.Hdr.Name], secure, soaMinTTL)
+		case *dns.RRSIG:
+			key := rrsigKey(r.Header().Name, r.TypeCovered, r.Header().Class)
+			rrsigs[key] = append(rrsigs[key], r)
 		case *dns.OPT:
 			// Do not cache OPT records
 			continue
 		default:
-			key := rrsetKey(rr.Header())
+			key := rrsetKey(rr.Header(), do, cd)
 			rrsets[key] = append(rrsets[key], rr)
 		}
 	}
 
-	// Cache each RRset.
+	// Cache each RRset and RRSIG set.
 	for key, rrset := range rrsets {
 		c.rrsetCache.Set(key, rrset)
 	}
+	for key, sigs := range rrsigs {
+		c.rrsetCache.Set(key, sigs)
+	}
 }
 
-// rrsetKey generates a cache key for an RRset.
-func rrsetKey(h *dns.RR_Header) string {
-	return Key(dns.Question{Name: h.Name, Qtype: h.Rrtype, Qclass: h.Class})
-}
\ No newline at end of file
+// rrsetKey generates a cache key for an RRset, folding in the do/cd bits of
+// the request it was decomposed from.
+func rrsetKey(h *dns.RR_Header, do, cd bool) string {
+	return Key(dns.Question{Name: h.Name, Qtype: h.Rrtype, Qclass: h.Class}, do, cd)
+}
+
+// rrsigKey generates the cache key for the RRSIG set covering coveredType at
+// name, parallel to (but distinct from) the key rrsetKey gives the covered
+// RRset itself. RRSIGs are only ever requested by a DO=1 client, and their
+// presence doesn't depend on CD, so they're always cached under do=true,
+// cd=false regardless of the bits the covered RRset itself was keyed under;
+// the coveredType suffix keeps sibling RRSIGs (e.g. over A and AAAA at the
+// same name) from colliding in a single cache entry.
+func rrsigKey(name string, coveredType, class uint16) string {
+	return Key(dns.Question{Name: name, Qtype: dns.TypeRRSIG, Qclass: class}, true, false) + "#" + dns.TypeToString[coveredType]
+}
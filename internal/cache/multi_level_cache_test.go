@@ -12,7 +12,7 @@ func TestMultiLevelCache_SynthesizeFromRRset(t *testing.T) {
 	c := NewMultiLevelCache(cfg)
 
 	q := dns.Question{Name: "example.com.", Qtype: dns.TypeA, Qclass: dns.ClassINET}
-	key := Key(q)
+	key := Key(q, false, false)
 
 	// Manually add an RRset to the rrsetCache
 	rr, err := dns.NewRR("example.com. 60 IN A 1.2.3.4")
@@ -29,7 +29,7 @@ func TestMultiLevelCache_SynthesizeFromRRset(t *testing.T) {
 	}
 
 	// Now, Get from the multi-level cache should synthesize a response
-	retrievedMsg, found, _ := c.Get(q)
+	retrievedMsg, found, _ := c.Get(q, false, false)
 	if !found {
 		t.Fatal("expected to synthesize a message from the RRset cache")
 	}
@@ -59,11 +59,11 @@ func TestMultiLevelCache_SynthesizeWithCNAME(t *testing.T) {
 	aRR, _ := dns.NewRR("real.example.com. 60 IN A 1.2.3.4")
 
 	// Add records to RRset cache
-	c.rrsetCache.Set(Key(dns.Question{Name: "www.example.com.", Qtype: dns.TypeCNAME, Qclass: dns.ClassINET}), []dns.RR{cnameRR})
-	c.rrsetCache.Set(Key(dns.Question{Name: "real.example.com.", Qtype: dns.TypeA, Qclass: dns.ClassINET}), []dns.RR{aRR})
+	c.rrsetCache.Set(Key(dns.Question{Name: "www.example.com.", Qtype: dns.TypeCNAME, Qclass: dns.ClassINET}, false, false), []dns.RR{cnameRR})
+	c.rrsetCache.Set(Key(dns.Question{Name: "real.example.com.", Qtype: dns.TypeA, Qclass: dns.ClassINET}, false, false), []dns.RR{aRR})
 
 	// Get from multi-level cache, which should synthesize the response
-	msg, found, _ := c.Get(q)
+	msg, found, _ := c.Get(q, false, false)
 	if !found {
 		t.Fatal("expected to synthesize a message for a CNAME query")
 	}
@@ -90,4 +90,36 @@ func TestMultiLevelCache_SynthesizeWithCNAME(t *testing.T) {
 	if !foundA {
 		t.Error("synthesized response should contain the A record")
 	}
-}
\ No newline at end of file
+}
+
+func TestMultiLevelCache_SynthesizeAttachesRRSIGOnlyForDO(t *testing.T) {
+	cfg := config.NewConfig()
+	c := NewMultiLevelCache(cfg)
+
+	q := dns.Question{Name: "example.com.", Qtype: dns.TypeA, Qclass: dns.ClassINET}
+	rr, _ := dns.NewRR("example.com. 60 IN A 1.2.3.4")
+	sig, _ := dns.NewRR("example.com. 60 IN RRSIG A 8 2 60 20260101000000 20250101000000 12345 example.com. c2lnbmF0dXJl")
+
+	// A DO=1 response decomposes into both an RRset entry and a parallel
+	// RRSIG entry.
+	msg := new(dns.Msg)
+	msg.SetQuestion(q.Name, q.Qtype)
+	msg.Answer = []dns.RR{rr, sig}
+	c.decomposeAndCacheRRsets(msg, true, false)
+
+	doMsg, found, _ := c.Get(q, true, false)
+	if !found {
+		t.Fatal("expected to synthesize a DO=1 response from the RRset cache")
+	}
+	if len(doMsg.Answer) != 2 {
+		t.Fatalf("expected RRset + RRSIG in a DO=1 answer, got %d records", len(doMsg.Answer))
+	}
+
+	// A DO=0 query for the same name/type was never cached (decompose above
+	// only populated the do=true key), so it must miss rather than leak the
+	// DO=1 entry's RRSIG.
+	_, found, _ = c.Get(q, false, false)
+	if found {
+		t.Error("a DO=0 query should not be answered from a DO=1 cache entry")
+	}
+}
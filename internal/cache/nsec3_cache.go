@@ -0,0 +1,408 @@
+package cache
+
+import (
+	"dns-resolver/internal/config"
+	"dns-resolver/internal/metrics"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// nsec3Entry is a single cached NSEC3 record, positioned within its zone's
+// index by owner hash (the upper-case base32hex first label of its owner
+// name). rrsigs and secure mirror nsecEntry's: they record enough of the
+// original response's DNSSEC state for Check to decide whether the proof
+// can be trusted for aggressive synthesis, and to carry a synthesized
+// answer's own signatures.
+type nsec3Entry struct {
+	ownerHash   string
+	nsec3       *dns.NSEC3
+	rrsigs      []dns.RR
+	secure      bool
+	expiration  time.Time
+	originalTTL time.Duration
+}
+
+// zoneNsec3Index keeps every cached NSEC3 record for one zone sorted
+// ascending by owner hash, the same trade-off zoneNsecIndex makes: O(n)
+// inserts for O(log n) predecessor lookups on the hot (query) path.
+type zoneNsec3Index struct {
+	entries []*nsec3Entry
+}
+
+func (z *zoneNsec3Index) search(hash string) (int, bool) {
+	i := sort.Search(len(z.entries), func(i int) bool { return z.entries[i].ownerHash >= hash })
+	if i < len(z.entries) && z.entries[i].ownerHash == hash {
+		return i, true
+	}
+	return i, false
+}
+
+func (z *zoneNsec3Index) upsert(e *nsec3Entry) {
+	i, found := z.search(e.ownerHash)
+	if found {
+		z.entries[i] = e
+		return
+	}
+	z.entries = append(z.entries, nil)
+	copy(z.entries[i+1:], z.entries[i:])
+	z.entries[i] = e
+}
+
+func (z *zoneNsec3Index) removeExpired(now time.Time) {
+	kept := z.entries[:0]
+	for _, e := range z.entries {
+		if now.Before(e.expiration) {
+			kept = append(kept, e)
+		}
+	}
+	z.entries = kept
+}
+
+// candidateFor returns the entry whose owner hash exactly matches hash
+// (nil if none), and the entry whose owner hash is its predecessor --
+// wrapping to the last entry if hash sorts before every owner, since the
+// NSEC3 with the numerically greatest owner hash covers the wraparound
+// interval back to the smallest one.
+func (z *zoneNsec3Index) candidateFor(hash string) (pred, exact *nsec3Entry) {
+	if len(z.entries) == 0 {
+		return nil, nil
+	}
+	i, found := z.search(hash)
+	if found {
+		exact = z.entries[i]
+	}
+	predIdx := i - 1
+	if predIdx < 0 {
+		predIdx = len(z.entries) - 1
+	}
+	return z.entries[predIdx], exact
+}
+
+// NSEC3PrefetchCallback is invoked with the zone and NSEC3 record for an
+// entry NSEC3Cache has decided is hot enough, and close enough to expiry,
+// to warrant a background refetch.
+type NSEC3PrefetchCallback func(zone string, nsec3 *dns.NSEC3)
+
+// NSEC3Cache caches NSEC3 records for RFC 5155 non-existence proofs and
+// RFC 8198 aggressive use, keyed per zone the same way NsecCache is. Each
+// NSEC3 record carries its zone's hash algorithm, iteration count, and
+// salt (NSEC3PARAM) directly, so unlike NsecCache the zone apex can be
+// read straight off the record's own owner name instead of needing it
+// threaded in from the caller.
+type NSEC3Cache struct {
+	sync.RWMutex
+	zones            map[string]*zoneNsec3Index // keyed by the zone name carried in each record's owner
+	config           *config.Config
+	stop             chan struct{}
+	prefetch         *PrefetchTracker
+	prefetchCallback NSEC3PrefetchCallback
+	prefetchSem      chan struct{}
+	metrics          *metrics.Metrics
+}
+
+// NewNSEC3Cache creates a new NSEC3Cache.
+func NewNSEC3Cache(cfg *config.Config) *NSEC3Cache {
+	nc := &NSEC3Cache{
+		zones:       make(map[string]*zoneNsec3Index),
+		config:      cfg,
+		stop:        make(chan struct{}),
+		prefetch:    NewPrefetchTracker(cfg.CachePrefetchMinHits, cfg.CachePrefetchPercentage),
+		prefetchSem: make(chan struct{}, defaultPrefetchWorkers),
+	}
+	go nc.runCleaner()
+	return nc
+}
+
+// SetPrefetchCallback wires cb as the upstream refetch path for TTL-driven
+// NSEC3 prefetch. Until set, NSEC3Cache still tracks hits but never
+// schedules a prefetch, since there would be nowhere to send it.
+func (nc *NSEC3Cache) SetPrefetchCallback(cb NSEC3PrefetchCallback) {
+	nc.prefetchCallback = cb
+}
+
+// SetMetrics wires m so prefetch scheduling/success can be observed. It may
+// be left unset in tests that don't care about metrics.
+func (nc *NSEC3Cache) SetMetrics(m *metrics.Metrics) {
+	nc.metrics = m
+}
+
+func (nc *NSEC3Cache) schedulePrefetch(zone string, nsec3 *dns.NSEC3) {
+	if nc.prefetchCallback == nil {
+		return
+	}
+
+	select {
+	case nc.prefetchSem <- struct{}{}:
+	default:
+		return
+	}
+
+	if nc.metrics != nil {
+		nc.metrics.IncrementCachePrefetchScheduled()
+	}
+
+	go func() {
+		defer func() { <-nc.prefetchSem }()
+		nc.prefetchCallback(zone, nsec3)
+		if nc.metrics != nil {
+			nc.metrics.IncrementCachePrefetchSuccess()
+		}
+	}()
+}
+
+// runCleaner periodically removes expired items from the cache.
+func (nc *NSEC3Cache) runCleaner() {
+	ticker := time.NewTicker(5 * time.Minute)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			nc.cleanup()
+		case <-nc.stop:
+			return
+		}
+	}
+}
+
+// cleanup removes expired entries, and any zone left with none, from the cache.
+func (nc *NSEC3Cache) cleanup() {
+	nc.Lock()
+	defer nc.Unlock()
+
+	now := time.Now()
+	for zone, idx := range nc.zones {
+		idx.removeExpired(now)
+		if len(idx.entries) == 0 {
+			delete(nc.zones, zone)
+		}
+	}
+}
+
+// Stop terminates the background cleaner goroutine.
+func (nc *NSEC3Cache) Stop() {
+	close(nc.stop)
+}
+
+// ownerZone splits an NSEC3 RR's owner name into its hash label (e.g.
+// "2T7B4G4VSA5SMI47K61MV5BV1A22BOJR") and the zone it belongs to (e.g.
+// "example.com."), the same split dns.NSEC3.Cover/Match make internally.
+func ownerZone(nsec3 *dns.NSEC3) (hash, zone string) {
+	name := nsec3.Hdr.Name
+	idx := dns.Split(name)
+	if len(idx) < 2 {
+		return strings.ToUpper(name), ""
+	}
+	return strings.ToUpper(name[:idx[1]-1]), strings.ToLower(name[idx[1]:])
+}
+
+// Add adds an NSEC3 record to its zone's index. The zone and hash
+// parameters are read from the record itself (see ownerZone), so callers
+// don't need to track NSEC3PARAM separately. rrsigs is the RRSIG set
+// covering nsec3, if any; secure reports whether the response nsec3 came
+// from had its chain of trust fully validated (see dns.Msg.AuthenticatedData);
+// soaMinTTL is the zone's SOA MINIMUM field carried alongside nsec3, or 0 if
+// none was seen. Only a secure entry is ever used by Check to synthesize a
+// new answer.
+func (nc *NSEC3Cache) Add(nsec3 *dns.NSEC3, rrsigs []dns.RR, secure bool, soaMinTTL uint32) {
+	hash, zone := ownerZone(nsec3)
+	if zone == "" {
+		return
+	}
+
+	nc.Lock()
+	defer nc.Unlock()
+
+	ttl := time.Duration(negativeTTLSeconds(nsec3.Hdr.Ttl, soaMinTTL)) * time.Second
+	clampedTTL := clampCacheTTL(nc.config, ttl)
+
+	idx, ok := nc.zones[zone]
+	if !ok {
+		idx = &zoneNsec3Index{}
+		nc.zones[zone] = idx
+	}
+	idx.upsert(&nsec3Entry{
+		ownerHash:   hash,
+		nsec3:       nsec3,
+		rrsigs:      rrsigs,
+		secure:      secure,
+		expiration:  time.Now().Add(clampedTTL),
+		originalTTL: clampedTTL,
+	})
+	nc.prefetch.Evict(zone + "/" + hash)
+}
+
+// zoneFor returns the name and index of the longest registered zone that
+// name falls under, or "", nil if no cached zone covers it.
+func (nc *NSEC3Cache) zoneFor(name string) (string, *zoneNsec3Index) {
+	bestZone := ""
+	var best *zoneNsec3Index
+	for zone, idx := range nc.zones {
+		if zone != name && !strings.HasSuffix(name, "."+zone) {
+			continue
+		}
+		if len(zone) > len(bestZone) {
+			bestZone, best = zone, idx
+		}
+	}
+	return bestZone, best
+}
+
+// Check attempts to prove the non-existence of a name using cached NSEC3
+// records, per RFC 5155 and RFC 8198's aggressive use of DNSSEC-validated
+// denial of existence: it hashes q.Name with the zone's own hash
+// parameters, binary-searches for the owner hash that would be its
+// predecessor, and delegates the actual cover/match decision to
+// dns.NSEC3.Cover/Match so the wraparound and empty-interval edge cases
+// match the same logic the validator uses elsewhere in this codebase. It's
+// disabled entirely unless cfg.AggressiveNSEC is set, and only ever
+// synthesizes from entries cached as secure (see Add). do controls whether
+// the synthesized answer's RRSIGs are attached, matching the DO bit of the
+// request they cover.
+func (nc *NSEC3Cache) Check(q dns.Question, do bool) (*dns.Msg, bool) {
+	if !nc.config.AggressiveNSEC {
+		return nil, false
+	}
+
+	nc.RLock()
+	defer nc.RUnlock()
+
+	qNameLower := strings.ToLower(q.Name)
+	zone, idx := nc.zoneFor(qNameLower)
+	if idx == nil || len(idx.entries) == 0 {
+		return nil, false
+	}
+
+	params := idx.entries[0].nsec3
+	hash := dns.HashName(q.Name, params.Hash, params.Iterations, params.Salt)
+	now := time.Now()
+	pred, exact := idx.candidateFor(hash)
+
+	if exact != nil && now.Before(exact.expiration) && exact.nsec3.Match(q.Name) {
+		typeExists := false
+		for _, t := range exact.nsec3.TypeBitMap {
+			if t == q.Qtype || t == dns.TypeCNAME {
+				typeExists = true
+				break
+			}
+		}
+		if typeExists {
+			return nil, false
+		}
+		if !exact.secure {
+			nc.recordMiss()
+			return nil, false
+		}
+		msg := new(dns.Msg)
+		msg.SetQuestion(q.Name, q.Qtype)
+		msg.Rcode = dns.RcodeSuccess
+		msg.Ns = append(msg.Ns, exact.nsec3)
+		if do {
+			msg.Ns = append(msg.Ns, exact.rrsigs...)
+		}
+		nc.recordHitAndMaybePrefetch(zone, exact)
+		return msg, true
+	}
+
+	if pred != nil && now.Before(pred.expiration) && pred.nsec3.Cover(q.Name) {
+		if !pred.secure {
+			nc.recordMiss()
+			return nil, false
+		}
+		if msg, ok := nc.closestEncloserProof(zone, idx, q, now, do); ok {
+			nc.recordHitAndMaybePrefetch(zone, pred)
+			return msg, true
+		}
+		msg := new(dns.Msg)
+		msg.SetQuestion(q.Name, q.Qtype)
+		msg.Rcode = dns.RcodeNameError
+		msg.Ns = append(msg.Ns, pred.nsec3)
+		if do {
+			msg.Ns = append(msg.Ns, pred.rrsigs...)
+		}
+		nc.recordHitAndMaybePrefetch(zone, pred)
+		return msg, true
+	}
+
+	return nil, false
+}
+
+// recordMiss increments the aggressive-synthesis miss counter for a
+// covering NSEC3 entry that was found but couldn't be trusted to answer
+// from (not cached as DNSSEC-secure).
+func (nc *NSEC3Cache) recordMiss() {
+	if nc.metrics != nil {
+		nc.metrics.IncrementAggressiveNSECMisses()
+	}
+}
+
+// closestEncloserProof attempts the RFC 5155 §7.2.1 closest-encloser proof
+// for a wildcard-aware NXDOMAIN: it walks q.Name's ancestors from the
+// nearest out, looking for the longest one a cached NSEC3 matches (the
+// closest encloser). Once found, it confirms both the next-closer name
+// (one label below the closest encloser, towards q.Name) and the closest
+// encloser's wildcard are covered, and returns all three NSEC3 records a
+// validator needs. It reports ok=false, leaving the caller to fall back
+// to a plain covering-NSEC3 NXDOMAIN, if any step can't be confirmed from
+// what's cached, or if any of the three entries wasn't cached as
+// DNSSEC-secure -- a proof is only as trustworthy as its weakest link. do
+// controls whether each record's RRSIGs are attached alongside it.
+func (nc *NSEC3Cache) closestEncloserProof(zone string, idx *zoneNsec3Index, q dns.Question, now time.Time, do bool) (*dns.Msg, bool) {
+	params := idx.entries[0].nsec3
+	labels := dns.SplitDomainName(q.Name)
+
+	for i := 1; i < len(labels); i++ {
+		ancestor := dns.Fqdn(strings.Join(labels[i:], "."))
+		ancestorHash := dns.HashName(ancestor, params.Hash, params.Iterations, params.Salt)
+		_, exact := idx.candidateFor(ancestorHash)
+		if exact == nil || now.After(exact.expiration) || !exact.nsec3.Match(ancestor) || !exact.secure {
+			continue
+		}
+
+		nextCloser := dns.Fqdn(strings.Join(labels[i-1:], "."))
+		nextCloserHash := dns.HashName(nextCloser, params.Hash, params.Iterations, params.Salt)
+		nextPred, _ := idx.candidateFor(nextCloserHash)
+		if nextPred == nil || now.After(nextPred.expiration) || !nextPred.nsec3.Cover(nextCloser) || !nextPred.secure {
+			return nil, false
+		}
+
+		wildcard := "*." + ancestor
+		wildcardHash := dns.HashName(wildcard, params.Hash, params.Iterations, params.Salt)
+		wildcardPred, _ := idx.candidateFor(wildcardHash)
+		if wildcardPred == nil || now.After(wildcardPred.expiration) || !wildcardPred.nsec3.Cover(wildcard) || !wildcardPred.secure {
+			return nil, false
+		}
+
+		msg := new(dns.Msg)
+		msg.SetQuestion(q.Name, q.Qtype)
+		msg.Rcode = dns.RcodeNameError
+		msg.Ns = append(msg.Ns, exact.nsec3, nextPred.nsec3, wildcardPred.nsec3)
+		if do {
+			msg.Ns = append(msg.Ns, exact.rrsigs...)
+			msg.Ns = append(msg.Ns, nextPred.rrsigs...)
+			msg.Ns = append(msg.Ns, wildcardPred.rrsigs...)
+		}
+		return msg, true
+	}
+
+	return nil, false
+}
+
+// recordHitAndMaybePrefetch records an aggressive-synthesis hit against
+// zone/entry and, if it's now hot and close enough to expiry, schedules a
+// background refetch through the prefetch callback.
+func (nc *NSEC3Cache) recordHitAndMaybePrefetch(zone string, entry *nsec3Entry) {
+	if nc.metrics != nil {
+		nc.metrics.IncrementAggressiveNSECHits()
+	}
+	key := zone + "/" + entry.ownerHash
+	remainingTTL := time.Until(entry.expiration)
+	nc.prefetch.RecordHit(key)
+	if nc.prefetch.ShouldPrefetch(key, remainingTTL, entry.originalTTL) {
+		nc.schedulePrefetch(zone, entry.nsec3)
+	}
+}
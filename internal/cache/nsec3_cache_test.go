@@ -0,0 +1,148 @@
+package cache
+
+import (
+	"dns-resolver/internal/config"
+	"fmt"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+// buildNSEC3Chain hashes each of names with the zero-iteration, unsalted
+// SHA-1 parameters and returns one NSEC3 RR per name, in hash order, each
+// pointing at the next one's hash (the last wrapping back to the first).
+func buildNSEC3Chain(t *testing.T, zone string, names []string) []*dns.NSEC3 {
+	t.Helper()
+
+	hashes := make(map[string]string, len(names))
+	for _, n := range names {
+		hashes[n] = dns.HashName(n, dns.SHA1, 0, "")
+	}
+	ordered := append([]string{}, names...)
+	sort.Slice(ordered, func(i, j int) bool { return hashes[ordered[i]] < hashes[ordered[j]] })
+
+	rrs := make([]*dns.NSEC3, 0, len(ordered))
+	for i, n := range ordered {
+		next := hashes[ordered[(i+1)%len(ordered)]]
+		owner := strings.ToLower(hashes[n]) + "." + zone
+		zoneStr := fmt.Sprintf("%s 60 IN NSEC3 1 0 0 - %s A", owner, next)
+		rr, err := dns.NewRR(zoneStr)
+		if err != nil {
+			t.Fatalf("failed to build NSEC3 RR for %s: %v", n, err)
+		}
+		rrs = append(rrs, rr.(*dns.NSEC3))
+	}
+	return rrs
+}
+
+func TestNSEC3Cache_CoversMissingName(t *testing.T) {
+	cfg := config.NewConfig()
+	cfg.AggressiveNSEC = true
+	nc := NewNSEC3Cache(cfg)
+	defer nc.Stop()
+
+	zone := "example.com."
+	for _, rr := range buildNSEC3Chain(t, zone, []string{"example.com.", "a.example.com.", "z.example.com."}) {
+		nc.Add(rr, nil, true, 0)
+	}
+
+	q := dns.Question{Name: "missing.example.com.", Qtype: dns.TypeA, Qclass: dns.ClassINET}
+	msg, found := nc.Check(q, false)
+	if !found {
+		t.Fatal("expected a covering NSEC3 to prove non-existence")
+	}
+	if msg.Rcode != dns.RcodeNameError {
+		t.Errorf("expected RcodeNameError, got %d", msg.Rcode)
+	}
+}
+
+func TestNSEC3Cache_MatchWithoutTypeIsNodata(t *testing.T) {
+	cfg := config.NewConfig()
+	cfg.AggressiveNSEC = true
+	nc := NewNSEC3Cache(cfg)
+	defer nc.Stop()
+
+	zone := "example.com."
+	for _, rr := range buildNSEC3Chain(t, zone, []string{"example.com.", "a.example.com.", "z.example.com."}) {
+		nc.Add(rr, nil, true, 0)
+	}
+
+	q := dns.Question{Name: "a.example.com.", Qtype: dns.TypeTXT, Qclass: dns.ClassINET}
+	msg, found := nc.Check(q, false)
+	if !found {
+		t.Fatal("expected a matching NSEC3 to prove NODATA")
+	}
+	if msg.Rcode != dns.RcodeSuccess {
+		t.Errorf("expected RcodeSuccess for NODATA, got %d", msg.Rcode)
+	}
+}
+
+func TestNSEC3Cache_MatchWithTypePresentIsNoProof(t *testing.T) {
+	cfg := config.NewConfig()
+	cfg.AggressiveNSEC = true
+	nc := NewNSEC3Cache(cfg)
+	defer nc.Stop()
+
+	zone := "example.com."
+	for _, rr := range buildNSEC3Chain(t, zone, []string{"example.com.", "a.example.com.", "z.example.com."}) {
+		nc.Add(rr, nil, true, 0)
+	}
+
+	q := dns.Question{Name: "a.example.com.", Qtype: dns.TypeA, Qclass: dns.ClassINET}
+	if _, found := nc.Check(q, false); found {
+		t.Fatal("should not get a denial proof for a type that exists at the matched name")
+	}
+}
+
+func TestNSEC3Cache_InsecureEntryNotSynthesized(t *testing.T) {
+	cfg := config.NewConfig()
+	cfg.AggressiveNSEC = true
+	nc := NewNSEC3Cache(cfg)
+	defer nc.Stop()
+
+	zone := "example.com."
+	for _, rr := range buildNSEC3Chain(t, zone, []string{"example.com.", "a.example.com.", "z.example.com."}) {
+		nc.Add(rr, nil, false, 0)
+	}
+
+	q := dns.Question{Name: "missing.example.com.", Qtype: dns.TypeA, Qclass: dns.ClassINET}
+	if _, found := nc.Check(q, false); found {
+		t.Fatal("an NSEC3 cached as insecure must never be used to synthesize an answer")
+	}
+}
+
+func TestNSEC3Cache_DisabledByConfig(t *testing.T) {
+	cfg := config.NewConfig()
+	cfg.AggressiveNSEC = false
+	nc := NewNSEC3Cache(cfg)
+	defer nc.Stop()
+
+	zone := "example.com."
+	for _, rr := range buildNSEC3Chain(t, zone, []string{"example.com.", "a.example.com.", "z.example.com."}) {
+		nc.Add(rr, nil, true, 0)
+	}
+
+	q := dns.Question{Name: "missing.example.com.", Qtype: dns.TypeA, Qclass: dns.ClassINET}
+	if _, found := nc.Check(q, false); found {
+		t.Fatal("Check must refuse to synthesize while AggressiveNSEC is disabled")
+	}
+}
+
+func TestNSEC3Cache_UnrelatedZoneNotConsulted(t *testing.T) {
+	cfg := config.NewConfig()
+	cfg.AggressiveNSEC = true
+	nc := NewNSEC3Cache(cfg)
+	defer nc.Stop()
+
+	zone := "example.com."
+	for _, rr := range buildNSEC3Chain(t, zone, []string{"example.com.", "a.example.com."}) {
+		nc.Add(rr, nil, true, 0)
+	}
+
+	q := dns.Question{Name: "b.other.org.", Qtype: dns.TypeA, Qclass: dns.ClassINET}
+	if _, found := nc.Check(q, false); found {
+		t.Fatal("expected no proof for a name outside any cached zone")
+	}
+}
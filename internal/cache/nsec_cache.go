@@ -2,6 +2,8 @@ package cache
 
 import (
 	"dns-resolver/internal/config"
+	"dns-resolver/internal/metrics"
+	"sort"
 	"strings"
 	"sync"
 	"time"
@@ -9,31 +11,213 @@ import (
 	"github.com/miekg/dns"
 )
 
-// NsecCacheItem holds an NSEC record and its expiration.
-type NsecCacheItem struct {
-	Nsec       *dns.NSEC
-	Expiration time.Time
+// compareCanonical orders a and b per RFC 4034 §6.1 canonical ordering:
+// labels are compared right-to-left (least significant label first), and
+// a name that is a strict prefix of another (fewer labels) sorts first.
+// It returns -1, 0, or 1 the way bytes.Compare/strings.Compare do.
+func compareCanonical(a, b string) int {
+	la := dns.SplitDomainName(a)
+	lb := dns.SplitDomainName(b)
+	i, j := len(la)-1, len(lb)-1
+	for i >= 0 && j >= 0 {
+		ca, cb := strings.ToLower(la[i]), strings.ToLower(lb[j])
+		if ca != cb {
+			if ca < cb {
+				return -1
+			}
+			return 1
+		}
+		i--
+		j--
+	}
+	switch {
+	case i < 0 && j < 0:
+		return 0
+	case i < 0:
+		return -1
+	default:
+		return 1
+	}
+}
+
+// clampCacheTTL bounds ttl to cfg's configured min/max, shared by every
+// cache type that stores RRs straight off the wire.
+func clampCacheTTL(cfg *config.Config, ttl time.Duration) time.Duration {
+	if cfg.CacheMaxTTL > 0 && ttl > cfg.CacheMaxTTL {
+		return cfg.CacheMaxTTL
+	}
+	if ttl < cfg.CacheMinTTL {
+		return cfg.CacheMinTTL
+	}
+	return ttl
+}
+
+// negativeTTLSeconds applies RFC 2308 §5 to a cached denial-of-existence
+// record: its effective TTL is the lesser of its own TTL and the zone's SOA
+// MINIMUM field, the same rule message_cache.go's getRawMinTTL applies to a
+// whole negative response. soaMinTTL of 0 means no SOA was seen alongside
+// the record, so only its own TTL applies.
+func negativeTTLSeconds(recordTTL, soaMinTTL uint32) uint32 {
+	if soaMinTTL > 0 && soaMinTTL < recordTTL {
+		return soaMinTTL
+	}
+	return recordTTL
+}
+
+// nsecEntry is a single cached NSEC record, positioned within its zone's
+// canonical-order index by owner (lowercased). rrsigs and secure carry
+// enough of the original response's DNSSEC state to let Check decide
+// whether the proof is trustworthy enough to synthesize a new answer from,
+// and to hand a synthesized answer's own RRSIGs to a client that asked for
+// them.
+type nsecEntry struct {
+	owner       string
+	nsec        *dns.NSEC
+	rrsigs      []dns.RR
+	secure      bool
+	expiration  time.Time
+	originalTTL time.Duration
+}
+
+// zoneNsecIndex keeps every cached NSEC record for one zone in ascending
+// canonical order, so Check can find the predecessor of a query name with
+// a binary search instead of scanning every record in the cache. Entries
+// are kept in a flat, sorted slice rather than a balanced tree: inserts
+// are O(n) (an insertion shift), but the hot path -- a predecessor lookup
+// on every query -- is O(log n), and NSEC churn is far rarer than lookups.
+type zoneNsecIndex struct {
+	entries []*nsecEntry // sorted ascending by entries[i].owner
+}
+
+// search returns the index of the first entry whose owner is
+// canonically >= name, and whether that entry is an exact match.
+func (z *zoneNsecIndex) search(name string) (int, bool) {
+	i := sort.Search(len(z.entries), func(i int) bool {
+		return compareCanonical(z.entries[i].owner, name) >= 0
+	})
+	if i < len(z.entries) && compareCanonical(z.entries[i].owner, name) == 0 {
+		return i, true
+	}
+	return i, false
+}
+
+// upsert inserts e in canonical order, replacing any existing entry for
+// the same owner.
+func (z *zoneNsecIndex) upsert(e *nsecEntry) {
+	i, found := z.search(e.owner)
+	if found {
+		z.entries[i] = e
+		return
+	}
+	z.entries = append(z.entries, nil)
+	copy(z.entries[i+1:], z.entries[i:])
+	z.entries[i] = e
+}
+
+// removeExpired drops every entry whose expiration has passed.
+func (z *zoneNsecIndex) removeExpired(now time.Time) {
+	kept := z.entries[:0]
+	for _, e := range z.entries {
+		if now.Before(e.expiration) {
+			kept = append(kept, e)
+		}
+	}
+	z.entries = kept
+}
+
+// predecessor returns the entry whose owner is the greatest one <= name
+// in canonical order, wrapping to the last entry if name sorts before
+// every owner (the last NSEC in a zone's chain covers the wraparound
+// interval back to the apex). The second return reports an exact match.
+func (z *zoneNsecIndex) predecessor(name string) (*nsecEntry, bool) {
+	if len(z.entries) == 0 {
+		return nil, false
+	}
+	i, exact := z.search(name)
+	if exact {
+		return z.entries[i], true
+	}
+	if i == 0 {
+		return z.entries[len(z.entries)-1], false
+	}
+	return z.entries[i-1], false
 }
 
-// NsecCache stores NSEC records for aggressive caching.
+// NsecPrefetchCallback is invoked with the owner name and NSEC record for
+// an entry NsecCache has decided is hot enough, and close enough to
+// expiry, to warrant a background refetch. Authoritative-heavy zones that
+// serve the same NSEC proof repeatedly benefit from this the same way
+// ShardedCache's positive/negative answers do.
+type NsecPrefetchCallback func(owner string, nsec *dns.NSEC)
+
+// NsecCache stores NSEC records for aggressive (RFC 8198) caching,
+// partitioned by the zone each record belongs to so a predecessor lookup
+// never has to consider records from an unrelated zone.
 type NsecCache struct {
 	sync.RWMutex
-	items  map[string]*NsecCacheItem // Keyed by NSEC owner name (lowercased)
-	config *config.Config
-	stop   chan struct{}
+	zones            map[string]*zoneNsecIndex // keyed by canonical zone apex
+	config           *config.Config
+	stop             chan struct{}
+	prefetch         *PrefetchTracker
+	prefetchCallback NsecPrefetchCallback
+	prefetchSem      chan struct{}
+	metrics          *metrics.Metrics
 }
 
 // NewNsecCache creates a new NsecCache.
 func NewNsecCache(cfg *config.Config) *NsecCache {
 	nc := &NsecCache{
-		items:  make(map[string]*NsecCacheItem),
-		config: cfg,
-		stop:   make(chan struct{}),
+		zones:       make(map[string]*zoneNsecIndex),
+		config:      cfg,
+		stop:        make(chan struct{}),
+		prefetch:    NewPrefetchTracker(cfg.CachePrefetchMinHits, cfg.CachePrefetchPercentage),
+		prefetchSem: make(chan struct{}, defaultPrefetchWorkers),
 	}
 	go nc.runCleaner()
 	return nc
 }
 
+// SetPrefetchCallback wires cb as the upstream refetch path for TTL-driven
+// NSEC prefetch. Until set, NsecCache still tracks hits but never
+// schedules a prefetch, since there would be nowhere to send it.
+func (nc *NsecCache) SetPrefetchCallback(cb NsecPrefetchCallback) {
+	nc.prefetchCallback = cb
+}
+
+// SetMetrics wires m so prefetch scheduling/success can be observed. It may
+// be left unset in tests that don't care about metrics.
+func (nc *NsecCache) SetMetrics(m *metrics.Metrics) {
+	nc.metrics = m
+}
+
+// schedulePrefetch runs the prefetch callback for owner/nsec in the
+// bounded prefetch worker pool. If the pool is saturated, the refetch is
+// dropped for this round; the owner stays hot and will be retried on its
+// next hit.
+func (nc *NsecCache) schedulePrefetch(owner string, nsec *dns.NSEC) {
+	if nc.prefetchCallback == nil {
+		return
+	}
+
+	select {
+	case nc.prefetchSem <- struct{}{}:
+	default:
+		return
+	}
+
+	if nc.metrics != nil {
+		nc.metrics.IncrementCachePrefetchScheduled()
+	}
+
+	go func() {
+		defer func() { <-nc.prefetchSem }()
+		nc.prefetchCallback(owner, nsec)
+		if nc.metrics != nil {
+			nc.metrics.IncrementCachePrefetchSuccess()
+		}
+	}()
+}
+
 // runCleaner periodically removes expired items from the cache.
 func (nc *NsecCache) runCleaner() {
 	// A more configurable interval could be added to the config.
@@ -50,15 +234,16 @@ func (nc *NsecCache) runCleaner() {
 	}
 }
 
-// cleanup iterates over the cache and removes expired items.
+// cleanup removes expired entries, and any zone left with none, from the cache.
 func (nc *NsecCache) cleanup() {
 	nc.Lock()
 	defer nc.Unlock()
 
 	now := time.Now()
-	for key, item := range nc.items {
-		if now.After(item.Expiration) {
-			delete(nc.items, key)
+	for zone, idx := range nc.zones {
+		idx.removeExpired(now)
+		if len(idx.entries) == 0 {
+			delete(nc.zones, zone)
 		}
 	}
 }
@@ -68,80 +253,165 @@ func (nc *NsecCache) Stop() {
 	close(nc.stop)
 }
 
-// Add adds an NSEC record to the cache.
-func (nc *NsecCache) Add(nsec *dns.NSEC) {
+// Add adds an NSEC record to zone's canonical-order index. zone is the
+// apex of the zone the record was received for (e.g. the owner of the SOA
+// carried alongside it in the same negative response), which is what lets
+// Check restrict its predecessor search to records from the same zone.
+// rrsigs is the RRSIG set covering nsec, if any; secure reports whether the
+// response nsec came from had its chain of trust fully validated (see
+// dns.Msg.AuthenticatedData); soaMinTTL is the zone's SOA MINIMUM field
+// carried alongside nsec, or 0 if none was seen. Only a secure entry is
+// ever used by Check to synthesize a new answer.
+func (nc *NsecCache) Add(zone string, nsec *dns.NSEC, rrsigs []dns.RR, secure bool, soaMinTTL uint32) {
 	nc.Lock()
 	defer nc.Unlock()
 
-	key := strings.ToLower(nsec.Hdr.Name)
-	ttl := time.Duration(nsec.Hdr.Ttl) * time.Second
-	clampedTTL := nc.clampTTL(ttl)
-	expiration := time.Now().Add(clampedTTL)
+	zoneKey := strings.ToLower(zone)
+	owner := strings.ToLower(nsec.Hdr.Name)
+	ttl := time.Duration(negativeTTLSeconds(nsec.Hdr.Ttl, soaMinTTL)) * time.Second
+	clampedTTL := clampCacheTTL(nc.config, ttl)
 
-	nc.items[key] = &NsecCacheItem{
-		Nsec:       nsec,
-		Expiration: expiration,
+	idx, ok := nc.zones[zoneKey]
+	if !ok {
+		idx = &zoneNsecIndex{}
+		nc.zones[zoneKey] = idx
 	}
+	idx.upsert(&nsecEntry{
+		owner:       owner,
+		nsec:        nsec,
+		rrsigs:      rrsigs,
+		secure:      secure,
+		expiration:  time.Now().Add(clampedTTL),
+		originalTTL: clampedTTL,
+	})
+	nc.prefetch.Evict(owner)
 }
 
-// Check attempts to prove the non-existence of a name using cached NSEC records.
-func (nc *NsecCache) Check(q dns.Question) (*dns.Msg, bool) {
+// zoneFor returns the index for the longest registered zone that name
+// falls under, or nil if no cached zone covers it.
+func (nc *NsecCache) zoneFor(name string) *zoneNsecIndex {
+	var best *zoneNsecIndex
+	bestLen := -1
+	for zone, idx := range nc.zones {
+		if zone != name && !strings.HasSuffix(name, "."+zone) {
+			continue
+		}
+		if len(zone) > bestLen {
+			best = idx
+			bestLen = len(zone)
+		}
+	}
+	return best
+}
+
+// Check attempts to prove the non-existence of a name using cached NSEC
+// records, per RFC 8198's aggressive use of DNSSEC-validated denial of
+// existence. It's disabled entirely unless cfg.AggressiveNSEC is set, and
+// only ever synthesizes from an entry cached as secure (see Add) -- an
+// insecure or never-validated proof is left for the resolver to re-fetch
+// rather than risk answering from it. do controls whether the synthesized
+// answer's RRSIGs are attached, matching the DO bit of the request they
+// cover.
+func (nc *NsecCache) Check(q dns.Question, do bool) (*dns.Msg, bool) {
+	if !nc.config.AggressiveNSEC {
+		return nil, false
+	}
+
 	nc.RLock()
 	defer nc.RUnlock()
 
-	now := time.Now()
 	qNameLower := strings.ToLower(q.Name)
+	idx := nc.zoneFor(qNameLower)
+	if idx == nil {
+		return nil, false
+	}
 
-	for _, item := range nc.items {
-		if now.After(item.Expiration) {
-			continue
-		}
-
-		nsec := item.Nsec
-		ownerLower := strings.ToLower(nsec.Hdr.Name)
-		nextLower := strings.ToLower(nsec.NextDomain)
+	entry, exact := idx.predecessor(qNameLower)
+	if entry == nil || time.Now().After(entry.expiration) {
+		return nil, false
+	}
 
+	if exact {
 		// Case 1: Exact match on owner name (potential NODATA)
-		if ownerLower == qNameLower {
-			typeExists := false
-			for _, t := range nsec.TypeBitMap {
-				if t == q.Qtype || t == dns.TypeCNAME { // If CNAME exists, client must query for that
-					typeExists = true
-					break
-				}
-			}
-			if !typeExists {
-				msg := new(dns.Msg)
-				msg.SetQuestion(q.Name, q.Qtype)
-				msg.Rcode = dns.RcodeSuccess // NODATA is a success response with no answer
-				msg.Ns = append(msg.Ns, nsec)
-				return msg, true
+		typeExists := false
+		for _, t := range entry.nsec.TypeBitMap {
+			if t == q.Qtype || t == dns.TypeCNAME { // If CNAME exists, client must query for that
+				typeExists = true
+				break
 			}
 		}
+		if typeExists {
+			return nil, false
+		}
+		if !entry.secure {
+			nc.recordMiss()
+			return nil, false
+		}
+		msg := new(dns.Msg)
+		msg.SetQuestion(q.Name, q.Qtype)
+		msg.Rcode = dns.RcodeSuccess // NODATA is a success response with no answer
+		msg.Ns = append(msg.Ns, entry.nsec)
+		if do {
+			msg.Ns = append(msg.Ns, entry.rrsigs...)
+		}
+		nc.recordHitAndMaybePrefetch(entry)
+		return msg, true
+	}
 
-		// Case 2: Name falls between owner and next domain (potential NXDOMAIN)
-		if ownerLower < qNameLower && qNameLower < nextLower {
-			msg := new(dns.Msg)
-			msg.SetQuestion(q.Name, q.Qtype)
-			msg.Rcode = dns.RcodeNameError
-			msg.Ns = append(msg.Ns, nsec)
-			return msg, true
+	// Case 2: Name falls in (owner, NextDomain] canonical order (potential NXDOMAIN)
+	if coversName(entry, qNameLower) {
+		if !entry.secure {
+			nc.recordMiss()
+			return nil, false
+		}
+		msg := new(dns.Msg)
+		msg.SetQuestion(q.Name, q.Qtype)
+		msg.Rcode = dns.RcodeNameError
+		msg.Ns = append(msg.Ns, entry.nsec)
+		if do {
+			msg.Ns = append(msg.Ns, entry.rrsigs...)
 		}
+		nc.recordHitAndMaybePrefetch(entry)
+		return msg, true
 	}
 
 	return nil, false
 }
 
-// TODO: The current NSEC Check is O(N). A more efficient data structure (e.g., a balanced tree) is needed for production.
-// TODO: A full implementation needs to handle RRSIGs for the NSEC records.
+// recordMiss increments the aggressive-synthesis miss counter for a
+// covering NSEC entry that was found but couldn't be trusted to answer
+// from (not cached as DNSSEC-secure).
+func (nc *NsecCache) recordMiss() {
+	if nc.metrics != nil {
+		nc.metrics.IncrementAggressiveNSECMisses()
+	}
+}
 
-// clampTTL ensures that the TTL is within the configured min and max bounds.
-func (nc *NsecCache) clampTTL(ttl time.Duration) time.Duration {
-	if nc.config.CacheMaxTTL > 0 && ttl > nc.config.CacheMaxTTL {
-		return nc.config.CacheMaxTTL
+// coversName reports whether qname falls in the interval entry's NSEC
+// record denies existence for. The common case is owner < qname <
+// NextDomain; the last NSEC in a zone's chain instead has a NextDomain
+// that wraps back to the apex (NextDomain <= owner), and covers
+// everything after owner as well as everything before that wraparound
+// point.
+func coversName(entry *nsecEntry, qname string) bool {
+	owner := entry.owner
+	next := strings.ToLower(entry.nsec.NextDomain)
+	if compareCanonical(next, owner) <= 0 {
+		return compareCanonical(qname, owner) > 0 || compareCanonical(qname, next) < 0
 	}
-	if ttl < nc.config.CacheMinTTL {
-		return nc.config.CacheMinTTL
+	return compareCanonical(owner, qname) < 0 && compareCanonical(qname, next) < 0
+}
+
+// recordHitAndMaybePrefetch records an aggressive-synthesis hit against
+// entry's owner and, if it's now hot and close enough to expiry, schedules
+// a background refetch through the prefetch callback.
+func (nc *NsecCache) recordHitAndMaybePrefetch(entry *nsecEntry) {
+	if nc.metrics != nil {
+		nc.metrics.IncrementAggressiveNSECHits()
 	}
-	return ttl
-}
\ No newline at end of file
+	remainingTTL := time.Until(entry.expiration)
+	nc.prefetch.RecordHit(entry.owner)
+	if nc.prefetch.ShouldPrefetch(entry.owner, remainingTTL, entry.originalTTL) {
+		nc.schedulePrefetch(entry.owner, entry.nsec)
+	}
+}
@@ -3,6 +3,7 @@ package cache
 import (
 	"dns-resolver/internal/config"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -11,6 +12,7 @@ import (
 
 func TestNsecCache_AddAndCheck(t *testing.T) {
 	cfg := config.NewConfig()
+	cfg.AggressiveNSEC = true
 	nc := NewNsecCache(cfg)
 	defer nc.Stop()
 
@@ -19,11 +21,11 @@ func TestNsecCache_AddAndCheck(t *testing.T) {
 	if err != nil {
 		t.Fatalf("failed to create NSEC RR: %v", err)
 	}
-	nc.Add(nsecRR.(*dns.NSEC))
+	nc.Add("example.com.", nsecRR.(*dns.NSEC), nil, true, 0)
 
 	// Test case 1: Check for a name that should be covered (NXDOMAIN)
 	qNxdomain := dns.Question{Name: "b.example.com.", Qtype: dns.TypeA, Qclass: dns.ClassINET}
-	msg, found := nc.Check(qNxdomain)
+	msg, found := nc.Check(qNxdomain, false)
 	if !found {
 		t.Fatal("expected to get NXDOMAIN proof from NSEC cache")
 	}
@@ -36,7 +38,7 @@ func TestNsecCache_AddAndCheck(t *testing.T) {
 
 	// Test case 2: Check for a type that doesn't exist (NODATA)
 	qNodata := dns.Question{Name: "a.example.com.", Qtype: dns.TypeTXT, Qclass: dns.ClassINET}
-	msg, found = nc.Check(qNodata)
+	msg, found = nc.Check(qNodata, false)
 	if !found {
 		t.Fatal("expected to get NODATA proof from NSEC cache")
 	}
@@ -49,14 +51,130 @@ func TestNsecCache_AddAndCheck(t *testing.T) {
 
 	// Test case 3: Check for a type that does exist
 	qExists := dns.Question{Name: "a.example.com.", Qtype: dns.TypeA, Qclass: dns.ClassINET}
-	_, found = nc.Check(qExists)
+	_, found = nc.Check(qExists, false)
 	if found {
 		t.Fatal("should not get a match for a type that exists")
 	}
 }
 
+func TestNsecCache_InsecureEntryNotSynthesized(t *testing.T) {
+	cfg := config.NewConfig()
+	cfg.AggressiveNSEC = true
+	nc := NewNsecCache(cfg)
+	defer nc.Stop()
+
+	nsecRR, err := dns.NewRR("a.example.com. 60 IN NSEC c.example.com. A")
+	if err != nil {
+		t.Fatalf("failed to create NSEC RR: %v", err)
+	}
+	nc.Add("example.com.", nsecRR.(*dns.NSEC), nil, false, 0)
+
+	q := dns.Question{Name: "b.example.com.", Qtype: dns.TypeA, Qclass: dns.ClassINET}
+	if _, found := nc.Check(q, false); found {
+		t.Fatal("an NSEC cached as insecure must never be used to synthesize an answer")
+	}
+}
+
+func TestNsecCache_DisabledByConfig(t *testing.T) {
+	cfg := config.NewConfig()
+	cfg.AggressiveNSEC = false
+	nc := NewNsecCache(cfg)
+	defer nc.Stop()
+
+	nsecRR, err := dns.NewRR("a.example.com. 60 IN NSEC c.example.com. A")
+	if err != nil {
+		t.Fatalf("failed to create NSEC RR: %v", err)
+	}
+	nc.Add("example.com.", nsecRR.(*dns.NSEC), nil, true, 0)
+
+	q := dns.Question{Name: "b.example.com.", Qtype: dns.TypeA, Qclass: dns.ClassINET}
+	if _, found := nc.Check(q, false); found {
+		t.Fatal("Check must refuse to synthesize while AggressiveNSEC is disabled")
+	}
+}
+
+func TestNsecCache_RRSIGAttachedOnlyForDO(t *testing.T) {
+	cfg := config.NewConfig()
+	cfg.AggressiveNSEC = true
+	nc := NewNsecCache(cfg)
+	defer nc.Stop()
+
+	nsecRR, err := dns.NewRR("a.example.com. 60 IN NSEC c.example.com. A")
+	if err != nil {
+		t.Fatalf("failed to create NSEC RR: %v", err)
+	}
+	sigRR, err := dns.NewRR("a.example.com. 60 IN RRSIG NSEC 8 3 60 20260101000000 20250101000000 12345 example.com. c2lnbmF0dXJl")
+	if err != nil {
+		t.Fatalf("failed to create RRSIG RR: %v", err)
+	}
+	nc.Add("example.com.", nsecRR.(*dns.NSEC), []dns.RR{sigRR}, true, 0)
+
+	q := dns.Question{Name: "b.example.com.", Qtype: dns.TypeA, Qclass: dns.ClassINET}
+	msg, found := nc.Check(q, true)
+	if !found {
+		t.Fatal("expected a covering NSEC to prove non-existence")
+	}
+	if len(msg.Ns) != 2 {
+		t.Fatalf("expected the NSEC plus its RRSIG for a DO=1 query, got %d records", len(msg.Ns))
+	}
+
+	msg, found = nc.Check(q, false)
+	if !found {
+		t.Fatal("expected a covering NSEC to prove non-existence")
+	}
+	if len(msg.Ns) != 1 {
+		t.Errorf("expected only the NSEC, no RRSIG, for a DO=0 query, got %d records", len(msg.Ns))
+	}
+}
+
+func TestNsecCache_UnrelatedZoneNotConsulted(t *testing.T) {
+	cfg := config.NewConfig()
+	cfg.AggressiveNSEC = true
+	nc := NewNsecCache(cfg)
+	defer nc.Stop()
+
+	nsecRR, err := dns.NewRR("a.example.com. 60 IN NSEC c.example.com. A")
+	if err != nil {
+		t.Fatalf("failed to create NSEC RR: %v", err)
+	}
+	nc.Add("example.com.", nsecRR.(*dns.NSEC), nil, true, 0)
+
+	// A name that isn't a subdomain of the only cached zone must never be
+	// answered from that zone's NSEC chain, however it happens to sort.
+	q := dns.Question{Name: "b.other.org.", Qtype: dns.TypeA, Qclass: dns.ClassINET}
+	if _, found := nc.Check(q, false); found {
+		t.Fatal("expected no proof for a name outside any cached zone")
+	}
+}
+
+func TestNsecCache_WraparoundCoversEndOfChain(t *testing.T) {
+	cfg := config.NewConfig()
+	cfg.AggressiveNSEC = true
+	nc := NewNsecCache(cfg)
+	defer nc.Stop()
+
+	// A single-record chain: the last (and only) NSEC wraps its
+	// NextDomain back to the zone apex, so it covers everything after its
+	// owner as well as everything before the apex.
+	nsecRR, err := dns.NewRR("z.example.com. 60 IN NSEC example.com. A")
+	if err != nil {
+		t.Fatalf("failed to create NSEC RR: %v", err)
+	}
+	nc.Add("example.com.", nsecRR.(*dns.NSEC), nil, true, 0)
+
+	q := dns.Question{Name: "zz.example.com.", Qtype: dns.TypeA, Qclass: dns.ClassINET}
+	msg, found := nc.Check(q, false)
+	if !found {
+		t.Fatal("expected the wraparound NSEC to cover a name sorting after its owner")
+	}
+	if msg.Rcode != dns.RcodeNameError {
+		t.Errorf("expected RcodeNameError, got %d", msg.Rcode)
+	}
+}
+
 func TestNsecCache_Expiration(t *testing.T) {
 	cfg := config.NewConfig()
+	cfg.AggressiveNSEC = true
 	cfg.CacheMaxTTL = 1 * time.Second // Clamp TTL to 1 second
 	nc := NewNsecCache(cfg)
 	defer nc.Stop()
@@ -65,19 +183,21 @@ func TestNsecCache_Expiration(t *testing.T) {
 	if err != nil {
 		t.Fatalf("failed to create NSEC RR: %v", err)
 	}
-	nc.Add(nsecRR.(*dns.NSEC))
+	nc.Add("example.com.", nsecRR.(*dns.NSEC), nil, true, 0)
 
 	// Check that the key exists before expiration
-	key := strings.ToLower(nsecRR.Header().Name)
+	owner := strings.ToLower(nsecRR.Header().Name)
 	nc.RLock()
-	item, ok := nc.items[key]
+	idx := nc.zones["example.com."]
+	_, ok := idx.search(owner)
+	expiry := idx.entries[0].expiration
 	nc.RUnlock()
 	if !ok {
 		t.Fatal("NSEC record was not added to the cache")
 	}
 	// Check if TTL was clamped
-	if item.Expiration.Sub(time.Now()) > 2*time.Second {
-		t.Fatalf("TTL was not clamped correctly. Expiration is %v", item.Expiration)
+	if expiry.Sub(time.Now()) > 2*time.Second {
+		t.Fatalf("TTL was not clamped correctly. Expiration is %v", expiry)
 	}
 
 	time.Sleep(2 * time.Second)
@@ -87,8 +207,55 @@ func TestNsecCache_Expiration(t *testing.T) {
 	// we would need to trigger the cleanup manually or use a shorter interval.
 	// Here, we'll just check if the Check function ignores the expired record.
 	q := dns.Question{Name: "b.example.com.", Qtype: dns.TypeA, Qclass: dns.ClassINET}
-	_, found := nc.Check(q)
+	_, found := nc.Check(q, false)
 	if found {
 		t.Fatal("expected expired NSEC record to be ignored")
 	}
-}
\ No newline at end of file
+}
+
+func TestNsecCache_PrefetchScheduledForHotEntryNearExpiry(t *testing.T) {
+	cfg := config.NewConfig()
+	cfg.AggressiveNSEC = true
+	cfg.CachePrefetchMinHits = 1
+	cfg.CachePrefetchPercentage = 0.9
+	cfg.CacheMaxTTL = 50 * time.Millisecond
+	nc := NewNsecCache(cfg)
+	defer nc.Stop()
+
+	var mu sync.Mutex
+	var prefetchedOwner string
+	done := make(chan struct{}, 1)
+	nc.SetPrefetchCallback(func(owner string, nsec *dns.NSEC) {
+		mu.Lock()
+		prefetchedOwner = owner
+		mu.Unlock()
+		done <- struct{}{}
+	})
+
+	nsecRR, err := dns.NewRR("a.example.com. 60 IN NSEC c.example.com. A AAAA RRSIG")
+	if err != nil {
+		t.Fatalf("failed to create NSEC RR: %v", err)
+	}
+	nc.Add("example.com.", nsecRR.(*dns.NSEC), nil, true, 0)
+
+	// Let enough of the clamped TTL elapse that the remaining fraction
+	// drops below CachePrefetchPercentage, then hit it once to cross
+	// CachePrefetchMinHits.
+	time.Sleep(10 * time.Millisecond)
+	q := dns.Question{Name: "b.example.com.", Qtype: dns.TypeA, Qclass: dns.ClassINET}
+	if _, found := nc.Check(q, false); !found {
+		t.Fatal("expected to get NXDOMAIN proof from NSEC cache")
+	}
+
+	select {
+	case <-done:
+	case <-time.After(1 * time.Second):
+		t.Fatal("expected prefetch callback to run for a hot, near-expiry NSEC entry")
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if prefetchedOwner != "a.example.com." {
+		t.Errorf("expected prefetch callback for a.example.com., got %q", prefetchedOwner)
+	}
+}
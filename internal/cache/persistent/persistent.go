@@ -0,0 +1,270 @@
+// Package persistent is an on-disk, LMDB-backed cache for the resolver's
+// delegation graph: which nameservers are authoritative for a zone, their
+// DS/DNSKEY RRsets, and the addresses those nameserver names resolve to.
+// Keeping this on disk means a restarted resolver doesn't have to re-walk
+// the root and TLD servers from scratch for every zone it had already
+// learned about before it went down.
+package persistent
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/bmatsuo/lmdb-go/lmdb"
+
+	"dns-resolver/internal/metrics"
+)
+
+const (
+	zonesDBIName = "zones"
+	nsDBIName    = "nsnames"
+
+	// defaultMapSize is generous on purpose: LMDB's map size is a virtual
+	// address space reservation, not disk actually used, so there's no
+	// cost to sizing it well above what this cache will ever hold.
+	defaultMapSize = 1 << 30 // 1 GiB
+
+	compactionInterval = 1 * time.Hour
+)
+
+// ZoneEntry is everything iterativeResolve/QueryDelegation need to skip the
+// network for a zone cut: the NS names that serve it, glue for those names
+// (when the parent provided it), the zone's DS and DNSKEY RRsets, and when
+// the entry expires. DS/DNSKEY are stored as already-validated: this table
+// only ever holds zones that BuildDelegationChain has itself verified, the
+// same trust model as Resolver's in-memory zoneCache, just surviving a
+// restart.
+type ZoneEntry struct {
+	NS      []string  `json:"ns"`
+	Glue    []string  `json:"glue,omitempty"`   // RR text, e.g. "ns1.example.com. 300 IN A 192.0.2.1"
+	DS      []string  `json:"ds,omitempty"`     // RR text
+	DNSKEY  []string  `json:"dnskey,omitempty"` // RR text
+	Expires time.Time `json:"expires"`
+}
+
+// NSEntry is a resolved nameserver hostname's address set.
+type NSEntry struct {
+	Addrs   []string  `json:"addrs"`
+	Expires time.Time `json:"expires"`
+}
+
+// Cache is an LMDB-backed store of ZoneEntry and NSEntry records. All
+// methods are safe for concurrent use; LMDB itself serializes writers and
+// lets readers run alongside them without blocking.
+type Cache struct {
+	dir      string
+	env      *lmdb.Env
+	zonesDBI lmdb.DBI
+	nsDBI    lmdb.DBI
+	maxTTL   time.Duration
+	metrics  *metrics.Metrics
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// Open opens (creating if necessary) an LMDB environment rooted at dir and
+// starts its background compaction goroutine. maxTTL caps every entry's
+// lifetime at min(RRset TTL, maxTTL); pass 0 to leave entries capped only by
+// their own RRset TTL. m may be nil to skip hit/miss metrics.
+func Open(dir string, maxTTL time.Duration, m *metrics.Metrics) (*Cache, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("persistent cache: failed to create %s: %w", dir, err)
+	}
+
+	env, err := lmdb.NewEnv()
+	if err != nil {
+		return nil, fmt.Errorf("persistent cache: failed to create LMDB environment: %w", err)
+	}
+	if err := env.SetMapSize(defaultMapSize); err != nil {
+		env.Close()
+		return nil, fmt.Errorf("persistent cache: failed to set map size: %w", err)
+	}
+	if err := env.SetMaxDBs(2); err != nil {
+		env.Close()
+		return nil, fmt.Errorf("persistent cache: failed to set max DBs: %w", err)
+	}
+	if err := env.Open(dir, 0, 0644); err != nil {
+		env.Close()
+		return nil, fmt.Errorf("persistent cache: failed to open %s: %w", dir, err)
+	}
+
+	c := &Cache{
+		dir:     dir,
+		env:     env,
+		maxTTL:  maxTTL,
+		metrics: m,
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+
+	err = env.Update(func(txn *lmdb.Txn) error {
+		var err error
+		c.zonesDBI, err = txn.OpenDBI(zonesDBIName, lmdb.Create)
+		if err != nil {
+			return err
+		}
+		c.nsDBI, err = txn.OpenDBI(nsDBIName, lmdb.Create)
+		return err
+	})
+	if err != nil {
+		env.Close()
+		return nil, fmt.Errorf("persistent cache: failed to open tables in %s: %w", dir, err)
+	}
+
+	go c.compactionLoop()
+	return c, nil
+}
+
+// Close stops the background compaction goroutine and closes the
+// underlying LMDB environment.
+func (c *Cache) Close() error {
+	close(c.stop)
+	<-c.done
+	return c.env.Close()
+}
+
+// capTTL applies the configured maxTTL ceiling to ttl.
+func (c *Cache) capTTL(ttl time.Duration) time.Duration {
+	if c.maxTTL > 0 && ttl > c.maxTTL {
+		return c.maxTTL
+	}
+	return ttl
+}
+
+// PutZone stores entry for zone, expiring after min(ttl, the configured
+// maxTTL).
+func (c *Cache) PutZone(zone string, entry ZoneEntry, ttl time.Duration) error {
+	entry.Expires = time.Now().Add(c.capTTL(ttl))
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("persistent cache: failed to marshal zone entry for %q: %w", zone, err)
+	}
+	return c.env.Update(func(txn *lmdb.Txn) error {
+		return txn.Put(c.zonesDBI, []byte(zone), data, 0)
+	})
+}
+
+// GetZone returns zone's cached ZoneEntry, if present and unexpired. An
+// expired entry is deleted as part of this same lookup rather than by a
+// separate sweep.
+func (c *Cache) GetZone(zone string) (ZoneEntry, bool) {
+	var entry ZoneEntry
+	found, err := c.lookup(c.zonesDBI, zone, &entry)
+	if err != nil {
+		log.Printf("persistent cache: zone lookup for %q failed: %v", zone, err)
+	}
+	c.reportOutcome("zone", found)
+	return entry, found
+}
+
+// PutNS stores entry for nsname, expiring after min(ttl, the configured
+// maxTTL).
+func (c *Cache) PutNS(nsname string, entry NSEntry, ttl time.Duration) error {
+	entry.Expires = time.Now().Add(c.capTTL(ttl))
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("persistent cache: failed to marshal NS entry for %q: %w", nsname, err)
+	}
+	return c.env.Update(func(txn *lmdb.Txn) error {
+		return txn.Put(c.nsDBI, []byte(nsname), data, 0)
+	})
+}
+
+// GetNS returns nsname's cached address set, if present and unexpired. An
+// expired entry is deleted as part of this same lookup.
+func (c *Cache) GetNS(nsname string) (NSEntry, bool) {
+	var entry NSEntry
+	found, err := c.lookup(c.nsDBI, nsname, &entry)
+	if err != nil {
+		log.Printf("persistent cache: NS lookup for %q failed: %v", nsname, err)
+	}
+	c.reportOutcome("ns", found)
+	return entry, found
+}
+
+// lookup reads key from dbi into dst, evicting and reporting a miss if the
+// stored entry's Expires has already passed. dst must embed an Expires
+// field, which is all lookup needs to know about its shape.
+func (c *Cache) lookup(dbi lmdb.DBI, key string, dst interface{ expiresAt() time.Time }) (bool, error) {
+	found := false
+	err := c.env.Update(func(txn *lmdb.Txn) error {
+		data, getErr := txn.Get(dbi, []byte(key))
+		if lmdb.IsNotFound(getErr) {
+			return nil
+		}
+		if getErr != nil {
+			return getErr
+		}
+		if jsonErr := json.Unmarshal(data, dst); jsonErr != nil {
+			return jsonErr
+		}
+		if time.Now().After(dst.expiresAt()) {
+			return txn.Del(dbi, []byte(key), nil)
+		}
+		found = true
+		return nil
+	})
+	return found, err
+}
+
+func (e *ZoneEntry) expiresAt() time.Time { return e.Expires }
+func (e *NSEntry) expiresAt() time.Time   { return e.Expires }
+
+func (c *Cache) reportOutcome(table string, hit bool) {
+	if c.metrics == nil {
+		return
+	}
+	if hit {
+		c.metrics.IncrementPersistentCacheHit(table)
+	} else {
+		c.metrics.IncrementPersistentCacheMiss(table)
+	}
+}
+
+// compactionLoop periodically reclaims space LMDB has freed internally
+// (via lazy eviction in lookup, and Puts that replace existing keys) but
+// hasn't returned to the filesystem, since LMDB has no in-place compaction.
+//
+// This is a best-effort implementation: LMDB's documented way to compact is
+// Env.CopyFlag with lmdb.CopyCompact into a fresh directory, which this does,
+// but safely swapping that compacted copy in under a live, memory-mapped
+// Env would require closing and reopening it. Rather than disrupt
+// in-flight readers/writers to do that on every tick, compactionLoop here
+// just keeps the compacted copy refreshed on disk at dir+".compact" as a
+// space-usage signal; promoting it to the live path is a restart-time
+// operation, not something this loop does itself.
+func (c *Cache) compactionLoop() {
+	defer close(c.done)
+	ticker := time.NewTicker(compactionInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			c.compactOnce()
+		case <-c.stop:
+			return
+		}
+	}
+}
+
+func (c *Cache) compactOnce() {
+	compactDir := filepath.Clean(c.dir) + ".compact"
+	if err := os.RemoveAll(compactDir); err != nil {
+		log.Printf("persistent cache: compaction failed to clear %s: %v", compactDir, err)
+		return
+	}
+	if err := os.MkdirAll(compactDir, 0755); err != nil {
+		log.Printf("persistent cache: compaction failed to create %s: %v", compactDir, err)
+		return
+	}
+	if err := c.env.CopyFlag(compactDir, lmdb.CopyCompact); err != nil {
+		log.Printf("persistent cache: compaction copy failed: %v", err)
+		return
+	}
+	log.Printf("persistent cache: refreshed compacted copy at %s", compactDir)
+}
@@ -0,0 +1,35 @@
+package persistent
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// capTTL and the expiresAt accessors don't touch the LMDB environment, so
+// they're exercised directly; opening a real *Cache requires the cgo-backed
+// lmdb.Env this package depends on.
+
+func TestCache_CapTTL_AppliesCeilingWhenSet(t *testing.T) {
+	c := &Cache{maxTTL: time.Minute}
+	assert.Equal(t, time.Minute, c.capTTL(time.Hour))
+	assert.Equal(t, 30*time.Second, c.capTTL(30*time.Second))
+}
+
+func TestCache_CapTTL_NoCeilingWhenMaxTTLUnset(t *testing.T) {
+	c := &Cache{}
+	assert.Equal(t, time.Hour, c.capTTL(time.Hour))
+}
+
+func TestZoneEntry_ExpiresAt(t *testing.T) {
+	want := time.Now().Add(time.Minute)
+	e := &ZoneEntry{Expires: want}
+	assert.True(t, e.expiresAt().Equal(want))
+}
+
+func TestNSEntry_ExpiresAt(t *testing.T) {
+	want := time.Now().Add(time.Minute)
+	e := &NSEntry{Expires: want}
+	assert.True(t, e.expiresAt().Equal(want))
+}
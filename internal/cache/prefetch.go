@@ -0,0 +1,122 @@
+package cache
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultPrefetchThresholdHits is the minimum hit count within the
+	// sliding window for a key to be considered hot enough to prefetch
+	// ahead of expiry.
+	DefaultPrefetchThresholdHits = 5
+	// DefaultPrefetchPercentage is the fraction of original TTL remaining
+	// at or below which a hot key becomes eligible for prefetch.
+	DefaultPrefetchPercentage = 0.10
+	// prefetchWindow is the sliding window hit counts are tracked over, so
+	// a key that was hot an hour ago doesn't stay "hot" forever.
+	prefetchWindow = 5 * time.Minute
+)
+
+// hitCounter is a small sliding-window hit tracker for a single cache key:
+// it keeps only the hit timestamps that still fall within prefetchWindow.
+type hitCounter struct {
+	mu   sync.Mutex
+	hits []time.Time
+}
+
+func (h *hitCounter) record(now time.Time) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.hits = append(h.hits, now)
+	h.prune(now)
+}
+
+func (h *hitCounter) count(now time.Time) int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.prune(now)
+	return len(h.hits)
+}
+
+// prune drops hits older than prefetchWindow. Callers must hold h.mu.
+func (h *hitCounter) prune(now time.Time) {
+	cutoff := now.Add(-prefetchWindow)
+	i := 0
+	for i < len(h.hits) && h.hits[i].Before(cutoff) {
+		i++
+	}
+	if i > 0 {
+		h.hits = h.hits[i:]
+	}
+}
+
+// PrefetchTracker tracks per-key hit counts within a sliding window and
+// decides whether a key nearing expiry is hot enough to warrant an
+// asynchronous refetch, so that a rarely-queried (cold) name isn't
+// revalidated just as aggressively as one under constant load.
+// ThresholdHits and Percentage correspond to config.Config's
+// CachePrefetchMinHits and CachePrefetchPercentage.
+type PrefetchTracker struct {
+	mu            sync.Mutex
+	counters      map[string]*hitCounter
+	thresholdHits int64
+	percentage    float64
+}
+
+// NewPrefetchTracker creates a PrefetchTracker. A non-positive thresholdHits
+// or percentage falls back to the package defaults (5 hits, 10%).
+func NewPrefetchTracker(thresholdHits int64, percentage float64) *PrefetchTracker {
+	if thresholdHits <= 0 {
+		thresholdHits = DefaultPrefetchThresholdHits
+	}
+	if percentage <= 0 {
+		percentage = DefaultPrefetchPercentage
+	}
+	return &PrefetchTracker{
+		counters:      make(map[string]*hitCounter),
+		thresholdHits: thresholdHits,
+		percentage:    percentage,
+	}
+}
+
+// RecordHit records a cache hit for key within the sliding window.
+func (t *PrefetchTracker) RecordHit(key string) {
+	t.mu.Lock()
+	hc, ok := t.counters[key]
+	if !ok {
+		hc = &hitCounter{}
+		t.counters[key] = hc
+	}
+	t.mu.Unlock()
+	hc.record(time.Now())
+}
+
+// ShouldPrefetch reports whether key is hot enough, and close enough to
+// expiry, to warrant a background refetch: hit-count >= ThresholdHits AND
+// remainingTTL <= Percentage * originalTTL.
+func (t *PrefetchTracker) ShouldPrefetch(key string, remainingTTL, originalTTL time.Duration) bool {
+	if originalTTL <= 0 || remainingTTL <= 0 {
+		return false
+	}
+
+	t.mu.Lock()
+	hc, ok := t.counters[key]
+	t.mu.Unlock()
+	if !ok {
+		return false
+	}
+
+	if int64(hc.count(time.Now())) < t.thresholdHits {
+		return false
+	}
+	return remainingTTL <= time.Duration(float64(originalTTL)*t.percentage)
+}
+
+// Evict drops key's tracked hit history, e.g. once a prefetch has refreshed
+// it with a new TTL, so stale hit counts don't linger against the new entry.
+func (t *PrefetchTracker) Evict(key string) {
+	t.mu.Lock()
+	delete(t.counters, key)
+	t.mu.Unlock()
+}
@@ -0,0 +1,60 @@
+package cache
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPrefetchTrackerHotKeyNearExpiry(t *testing.T) {
+	tr := NewPrefetchTracker(3, 0.10)
+
+	for i := 0; i < 3; i++ {
+		tr.RecordHit("hot.example.com.")
+	}
+
+	originalTTL := 100 * time.Second
+	assert.True(t, tr.ShouldPrefetch("hot.example.com.", 5*time.Second, originalTTL),
+		"a key with enough hits and <=10%% TTL remaining should be prefetched")
+}
+
+func TestPrefetchTrackerHotKeyNotYetNearExpiry(t *testing.T) {
+	tr := NewPrefetchTracker(3, 0.10)
+
+	for i := 0; i < 3; i++ {
+		tr.RecordHit("hot.example.com.")
+	}
+
+	originalTTL := 100 * time.Second
+	assert.False(t, tr.ShouldPrefetch("hot.example.com.", 50*time.Second, originalTTL),
+		"a hot key should not be prefetched while well within its TTL")
+}
+
+func TestPrefetchTrackerColdKeyNearExpiry(t *testing.T) {
+	tr := NewPrefetchTracker(5, 0.10)
+
+	tr.RecordHit("cold.example.com.")
+
+	originalTTL := 100 * time.Second
+	assert.False(t, tr.ShouldPrefetch("cold.example.com.", 5*time.Second, originalTTL),
+		"a cold key should not be prefetched just because it's close to expiry")
+}
+
+func TestPrefetchTrackerUnknownKey(t *testing.T) {
+	tr := NewPrefetchTracker(3, 0.10)
+
+	assert.False(t, tr.ShouldPrefetch("never-queried.example.com.", time.Second, 100*time.Second))
+}
+
+func TestPrefetchTrackerEvictClearsHitHistory(t *testing.T) {
+	tr := NewPrefetchTracker(1, 0.10)
+
+	tr.RecordHit("hot.example.com.")
+	originalTTL := 100 * time.Second
+	assert.True(t, tr.ShouldPrefetch("hot.example.com.", 5*time.Second, originalTTL))
+
+	tr.Evict("hot.example.com.")
+	assert.False(t, tr.ShouldPrefetch("hot.example.com.", 5*time.Second, originalTTL),
+		"evicting a key's hit history should make it cold again until it's hit again")
+}
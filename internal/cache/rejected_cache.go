@@ -0,0 +1,245 @@
+package cache
+
+import (
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// RejectReason identifies why a response was rejected rather than served
+// normally, so the RejectedResponseCache can synthesize an appropriate
+// rcode on a later hit and metrics can be broken down by cause.
+type RejectReason string
+
+const (
+	// RejectReasonPolicy covers a filter plugin explicitly blocking a query.
+	RejectReasonPolicy RejectReason = "policy"
+	// RejectReasonRefused covers an upstream authoritative answering REFUSED.
+	RejectReasonRefused RejectReason = "refused"
+	// RejectReasonServfail covers repeated SERVFAIL from upstream after retries.
+	RejectReasonServfail RejectReason = "servfail"
+	// RejectReasonBogus covers a DNSSEC validation failure (BOGUS).
+	RejectReasonBogus RejectReason = "bogus"
+)
+
+// rcodeForReason maps a reject reason to the rcode synthesized on a cache hit.
+func rcodeForReason(reason RejectReason) int {
+	switch reason {
+	case RejectReasonPolicy:
+		return dns.RcodeNameError
+	case RejectReasonRefused:
+		return dns.RcodeRefused
+	case RejectReasonBogus:
+		return dns.RcodeServerFailure
+	case RejectReasonServfail:
+		return dns.RcodeServerFailure
+	default:
+		return dns.RcodeServerFailure
+	}
+}
+
+// knownRejectReasons is the set of reasons RejectedResponseCache.Check probes
+// when the caller doesn't already know which reason produced a prior
+// rejection (e.g. a resolver checking the cache before it has attempted
+// resolution).
+var knownRejectReasons = []RejectReason{
+	RejectReasonPolicy,
+	RejectReasonRefused,
+	RejectReasonServfail,
+	RejectReasonBogus,
+}
+
+// rejectedEntry is a single persisted rejection record.
+type rejectedEntry struct {
+	Key    string       `json:"key"`
+	Reason RejectReason `json:"reason"`
+	Expiry time.Time    `json:"expiry"`
+}
+
+type rejectedShard struct {
+	mu      sync.RWMutex
+	entries map[string]rejectedEntry
+}
+
+// RejectedResponseCache (RDRC) is a cache tier for responses the resolver or
+// a plugin has explicitly rejected: blocked by policy, upstream REFUSED,
+// repeated SERVFAIL, or DNSSEC BOGUS. It sits alongside the ShardedCache /
+// MultiLevelCache and is consulted before upstream resolution so we don't
+// hammer broken authoritatives or re-run expensive DNSSEC validation for
+// domains already known to be bogus.
+type RejectedResponseCache struct {
+	shards     []*rejectedShard
+	numShards  uint32
+	defaultTTL time.Duration
+	filePath   string
+}
+
+// NewRejectedResponseCache creates a RejectedResponseCache with numShards
+// shards. filePath, if non-empty, is where the cache is persisted by
+// SaveToFile and reloaded from by LoadFromFile.
+func NewRejectedResponseCache(numShards int, cfg CacheConfig, filePath string) *RejectedResponseCache {
+	if numShards <= 0 {
+		numShards = defaultShards
+	}
+
+	ttl := time.Duration(cfg.RejectedTTLSecs) * time.Second
+	if ttl <= 0 {
+		ttl = 60 * time.Second
+	}
+
+	shards := make([]*rejectedShard, numShards)
+	for i := 0; i < numShards; i++ {
+		shards[i] = &rejectedShard{entries: make(map[string]rejectedEntry)}
+	}
+
+	return &RejectedResponseCache{
+		shards:     shards,
+		numShards:  uint32(numShards),
+		defaultTTL: ttl,
+		filePath:   filePath,
+	}
+}
+
+// rejectedKey builds the qname/qtype/qclass/reason key used by the RDRC.
+func rejectedKey(q dns.Question, reason RejectReason) string {
+	return fmt.Sprintf("%s:%d:%d:%s", strings.ToLower(q.Name), q.Qtype, q.Qclass, reason)
+}
+
+func (c *RejectedResponseCache) getShard(key string) *rejectedShard {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return c.shards[h.Sum32()%c.numShards]
+}
+
+// RejectFor records that q was rejected for reason, expiring after ttl (or
+// the cache's configured default TTL when ttl <= 0). Plugins call this after
+// a policy decision; KnotResolver.exchange calls it on upstream REFUSED,
+// repeated SERVFAIL, or DNSSEC BOGUS.
+func (c *RejectedResponseCache) RejectFor(q dns.Question, reason RejectReason, ttl time.Duration) {
+	if ttl <= 0 {
+		ttl = c.defaultTTL
+	}
+
+	key := rejectedKey(q, reason)
+	shard := c.getShard(key)
+
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+	shard.entries[key] = rejectedEntry{
+		Key:    key,
+		Reason: reason,
+		Expiry: time.Now().Add(ttl),
+	}
+}
+
+// Check looks across every known reject reason for q and, on a hit, returns a
+// synthesized response carrying the rcode appropriate to that reason. This is
+// what KnotResolver.Resolve consults before running upstream resolution.
+func (c *RejectedResponseCache) Check(q dns.Question) (*dns.Msg, RejectReason, bool) {
+	for _, reason := range knownRejectReasons {
+		if msg, found := c.get(q, reason); found {
+			return msg, reason, true
+		}
+	}
+	return nil, "", false
+}
+
+// get looks up a rejection for q/reason and, if still valid, synthesizes a
+// response message with the rcode for that reason.
+func (c *RejectedResponseCache) get(q dns.Question, reason RejectReason) (*dns.Msg, bool) {
+	key := rejectedKey(q, reason)
+	shard := c.getShard(key)
+
+	shard.mu.RLock()
+	entry, found := shard.entries[key]
+	shard.mu.RUnlock()
+	if !found {
+		return nil, false
+	}
+
+	if time.Now().After(entry.Expiry) {
+		shard.mu.Lock()
+		delete(shard.entries, key)
+		shard.mu.Unlock()
+		return nil, false
+	}
+
+	msg := new(dns.Msg)
+	msg.SetQuestion(q.Name, q.Qtype)
+	msg.Rcode = rcodeForReason(reason)
+	return msg, true
+}
+
+// SaveToFile persists the cache's current entries to filePath as JSON. It is
+// a no-op when filePath is empty.
+func (c *RejectedResponseCache) SaveToFile() error {
+	if c.filePath == "" {
+		return nil
+	}
+
+	now := time.Now()
+	var entries []rejectedEntry
+	for _, shard := range c.shards {
+		shard.mu.RLock()
+		for _, entry := range shard.entries {
+			if now.Before(entry.Expiry) {
+				entries = append(entries, entry)
+			}
+		}
+		shard.mu.RUnlock()
+	}
+
+	data, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal rejected-response cache: %w", err)
+	}
+
+	if err := os.WriteFile(c.filePath, data, 0644); err != nil {
+		return fmt.Errorf("failed to write rejected-response cache to %s: %w", c.filePath, err)
+	}
+	return nil
+}
+
+// LoadFromFile reloads previously persisted entries from filePath, skipping
+// any that have already expired. It is a no-op when filePath is empty, and
+// it is not an error for the file not to exist yet.
+func (c *RejectedResponseCache) LoadFromFile() error {
+	if c.filePath == "" {
+		return nil
+	}
+
+	data, err := os.ReadFile(c.filePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("failed to read rejected-response cache from %s: %w", c.filePath, err)
+	}
+
+	var entries []rejectedEntry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return fmt.Errorf("failed to unmarshal rejected-response cache: %w", err)
+	}
+
+	now := time.Now()
+	loaded := 0
+	for _, entry := range entries {
+		if now.After(entry.Expiry) {
+			continue
+		}
+		shard := c.getShard(entry.Key)
+		shard.mu.Lock()
+		shard.entries[entry.Key] = entry
+		shard.mu.Unlock()
+		loaded++
+	}
+	log.Printf("Loaded %d rejected-response cache entries from %s", loaded, c.filePath)
+	return nil
+}
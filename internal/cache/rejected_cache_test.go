@@ -0,0 +1,77 @@
+package cache
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRejectedResponseCache_RejectForAndCheck(t *testing.T) {
+	c := NewRejectedResponseCache(4, CacheConfig{RejectedTTLSecs: 60}, "")
+	q := dns.Question{Name: "blocked.example.", Qtype: dns.TypeA, Qclass: dns.ClassINET}
+
+	_, _, found := c.Check(q)
+	assert.False(t, found)
+
+	c.RejectFor(q, RejectReasonRefused, time.Minute)
+
+	msg, reason, found := c.Check(q)
+	assert.True(t, found)
+	assert.Equal(t, RejectReasonRefused, reason)
+	assert.Equal(t, dns.RcodeRefused, msg.Rcode)
+}
+
+func TestRejectedResponseCache_ExpiresEntries(t *testing.T) {
+	c := NewRejectedResponseCache(4, CacheConfig{RejectedTTLSecs: 60}, "")
+	q := dns.Question{Name: "expiring.example.", Qtype: dns.TypeA, Qclass: dns.ClassINET}
+
+	c.RejectFor(q, RejectReasonServfail, time.Millisecond)
+	time.Sleep(10 * time.Millisecond)
+
+	_, _, found := c.Check(q)
+	assert.False(t, found)
+}
+
+func TestRejectedResponseCache_DefaultTTLAppliesWhenTTLNotPositive(t *testing.T) {
+	c := NewRejectedResponseCache(4, CacheConfig{RejectedTTLSecs: 60}, "")
+	q := dns.Question{Name: "default-ttl.example.", Qtype: dns.TypeA, Qclass: dns.ClassINET}
+
+	c.RejectFor(q, RejectReasonBogus, 0)
+
+	_, reason, found := c.Check(q)
+	assert.True(t, found)
+	assert.Equal(t, RejectReasonBogus, reason)
+}
+
+func TestRejectedResponseCache_SaveAndLoadFromFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rejected_cache.json")
+	q := dns.Question{Name: "persisted.example.", Qtype: dns.TypeAAAA, Qclass: dns.ClassINET}
+
+	c := NewRejectedResponseCache(4, CacheConfig{RejectedTTLSecs: 60}, path)
+	c.RejectFor(q, RejectReasonPolicy, time.Hour)
+	assert.NoError(t, c.SaveToFile())
+
+	reloaded := NewRejectedResponseCache(4, CacheConfig{RejectedTTLSecs: 60}, path)
+	assert.NoError(t, reloaded.LoadFromFile())
+
+	_, reason, found := reloaded.Check(q)
+	assert.True(t, found)
+	assert.Equal(t, RejectReasonPolicy, reason)
+}
+
+func TestRejectedResponseCache_LoadFromFileMissingIsNotError(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "does_not_exist.json")
+	c := NewRejectedResponseCache(4, CacheConfig{RejectedTTLSecs: 60}, path)
+	assert.NoError(t, c.LoadFromFile())
+}
+
+func TestRejectedResponseCache_SaveToFileNoOpWhenPathEmpty(t *testing.T) {
+	c := NewRejectedResponseCache(4, CacheConfig{RejectedTTLSecs: 60}, "")
+	assert.NoError(t, c.SaveToFile())
+	_, err := os.Stat("")
+	assert.Error(t, err)
+}
@@ -2,18 +2,32 @@ package cache
 
 import (
 	"container/list"
+	"context"
 	"dns-resolver/internal/config"
 	"dns-resolver/internal/interfaces"
+	"dns-resolver/internal/workerpool"
+	"log"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/miekg/dns"
 )
 
+// staleServeTTL is the TTL stamped on an RRset served from the stale-while-
+// revalidate window, so that anything downstream doesn't treat it as if it
+// were as fresh as the original answer.
+const staleServeTTL = 30 * time.Second
+
 // RRsetCacheItem represents an item in the RRset cache.
 type RRsetCacheItem struct {
 	RRset      []dns.RR
 	Expiration time.Time
+	// AccessCount counts hits since the item was last (re)populated. The
+	// prefetcher uses it to decide which hot items are worth refreshing
+	// ahead of expiry instead of waiting for a stale hit.
+	AccessCount int64
 	// element is a reference to the list.Element in the LRU list for quick deletion/movement.
 	element *list.Element
 	// parentList is a reference to the list.List this item belongs to.
@@ -30,12 +44,83 @@ type rrsetSlruSegment struct {
 	protectedCapacity int
 }
 
+// CacheState describes the freshness of an RRset as returned by
+// GetWithStale: whether it was found at all, and if so whether it's safe to
+// use as-is or is being revalidated in the background.
+type CacheState int
+
+const (
+	// Miss means no RRset was found for the key.
+	Miss CacheState = iota
+	// Fresh means the returned RRset is within its original TTL.
+	Fresh
+	// Prefetch means the returned RRset is fresh but within
+	// CachePrefetchThreshold of expiry; a background refresh has been
+	// triggered so it doesn't go stale before the next lookup.
+	Prefetch
+	// Stale means the returned RRset's TTL has passed but it's still
+	// within CacheStaleTTL (RFC 8767 serve-stale); a background refresh
+	// has been triggered and the RRset's TTL has been clamped to
+	// staleServeTTL.
+	Stale
+)
+
+func (s CacheState) String() string {
+	switch s {
+	case Fresh:
+		return "Fresh"
+	case Prefetch:
+		return "Prefetch"
+	case Stale:
+		return "Stale"
+	default:
+		return "Miss"
+	}
+}
+
 // RRsetCache is a thread-safe, sharded DNS RRset cache with SLRU eviction policy.
 type RRsetCache struct {
 	shards    []*rrsetSlruSegment
 	numShards uint32
 	resolver  interfaces.CacheResolver
 	config    *config.Config
+
+	prefetchInterval time.Duration
+	stopPrefetch     chan struct{}
+
+	// workerPool, if set via SetWorkerPool, runs background refreshes
+	// (prefetch and stale revalidation) as jobs bounded by its shared
+	// concurrency budget instead of an unbounded goroutine per refresh.
+	workerPool *workerpool.Pool
+}
+
+// SetWorkerPool attaches the pool background refreshes are submitted to. If
+// unset, or if the pool's queue is full, refreshes fall back to a bare
+// goroutine so a slow pool never blocks a cache hit.
+func (c *RRsetCache) SetWorkerPool(p *workerpool.Pool) {
+	c.workerPool = p
+}
+
+// refreshJob adapts a refresh call into a workerpool.Job.
+type refreshJob struct {
+	cache *RRsetCache
+	key   string
+	item  *RRsetCacheItem
+}
+
+func (j refreshJob) Execute() {
+	j.cache.refresh(j.key, j.item)
+}
+
+// triggerRefresh runs a background refresh of key via the worker pool when
+// one is attached and has room, falling back to a bare goroutine otherwise.
+func (c *RRsetCache) triggerRefresh(key string, item *RRsetCacheItem) {
+	if c.workerPool != nil {
+		if err := c.workerPool.TrySubmit(refreshJob{cache: c, key: key, item: item}); err == nil {
+			return
+		}
+	}
+	go c.refresh(key, item)
 }
 
 // NewRRsetCache creates and returns a new RRsetCache.
@@ -63,15 +148,19 @@ func NewRRsetCache(cfg *config.Config, numShards int) *RRsetCache {
 	}
 
 	return &RRsetCache{
-		shards:    shards,
-		numShards: uint32(numShards),
-		config:    cfg,
+		shards:           shards,
+		numShards:        uint32(numShards),
+		config:           cfg,
+		prefetchInterval: cfg.PrefetchInterval,
+		stopPrefetch:     make(chan struct{}),
 	}
 }
 
-// SetResolver sets the resolver instance for the cache.
+// SetResolver sets the resolver instance for the cache and starts the
+// background prefetcher that refreshes hot items before they expire.
 func (c *RRsetCache) SetResolver(r interfaces.CacheResolver) {
 	c.resolver = r
+	go c.runPrefetcher()
 }
 
 // getShard returns the shard for a given key.
@@ -80,24 +169,34 @@ func (c *RRsetCache) getShard(key string) *rrsetSlruSegment {
 	return c.shards[hash%c.numShards]
 }
 
-// Get retrieves an RRset from the cache.
-func (c *RRsetCache) Get(key string) ([]dns.RR, bool) {
+// Get retrieves an RRset from the cache. The second return value reports
+// whether an RRset was returned at all (fresh or stale); the third reports
+// whether the returned RRset is stale and is being revalidated in the
+// background.
+func (c *RRsetCache) Get(key string) ([]dns.RR, bool, bool) {
 	shard := c.getShard(key)
 	shard.RLock()
 	defer shard.RUnlock()
 
 	item, found := shard.items[key]
 	if !found {
-		return nil, false
+		return nil, false, false
 	}
 
-	if time.Now().After(item.Expiration) {
-		// Item is expired, remove it.
-		// A more advanced implementation might handle stale data.
+	now := time.Now()
+	if now.After(item.Expiration) {
+		if c.config.CacheStaleTTL > 0 && now.Before(item.Expiration.Add(c.config.CacheStaleTTL)) {
+			// Within the stale-while-revalidate window: serve the stale
+			// RRset with a clamped TTL and kick off a coalesced refresh.
+			c.triggerRefresh(key, item)
+			return cloneRRsetWithTTL(item.RRset, staleServeTTL), true, true
+		}
+
+		// Past the stale window, remove it.
 		shard.RUnlock()
 		shard.Lock()
 		// Re-check after acquiring write lock
-		if item, found = shard.items[key]; found && time.Now().After(item.Expiration) {
+		if item, found = shard.items[key]; found && time.Now().After(item.Expiration.Add(c.config.CacheStaleTTL)) {
 			s := c.getShard(key)
 			if item.parentList == s.probationList {
 				s.probationList.Remove(item.element)
@@ -108,15 +207,43 @@ func (c *RRsetCache) Get(key string) ([]dns.RR, bool) {
 		}
 		shard.Unlock()
 		shard.RLock()
-		return nil, false
+		return nil, false, false
 	}
 
+	atomic.AddInt64(&item.AccessCount, 1)
 	shard.accessItem(item)
 
 	// Return a copy of the RRset
 	rrsetCopy := make([]dns.RR, len(item.RRset))
 	copy(rrsetCopy, item.RRset)
-	return rrsetCopy, true
+	return rrsetCopy, true, false
+}
+
+// GetWithStale is Get plus a CachePrefetchThreshold check on the fresh path:
+// an RRset within CachePrefetchThreshold of expiry is still returned as-is
+// (state Prefetch), but also triggers the same background refresh a Stale
+// hit would, so a hot key doesn't have to go stale before it's revalidated.
+func (c *RRsetCache) GetWithStale(key string) ([]dns.RR, CacheState) {
+	rrset, found, stale := c.Get(key)
+	if !found {
+		return nil, Miss
+	}
+	if stale {
+		return rrset, Stale
+	}
+
+	if c.config.CachePrefetchThreshold > 0 {
+		shard := c.getShard(key)
+		shard.RLock()
+		item, stillPresent := shard.items[key]
+		shard.RUnlock()
+		if stillPresent && time.Until(item.Expiration) <= c.config.CachePrefetchThreshold {
+			c.triggerRefresh(key, item)
+			return rrset, Prefetch
+		}
+	}
+
+	return rrset, Fresh
 }
 
 // Set adds an RRset to the cache.
@@ -137,6 +264,7 @@ func (c *RRsetCache) Set(key string, rrset []dns.RR) {
 	if existingItem, found := shard.items[key]; found {
 		existingItem.RRset = rrset
 		existingItem.Expiration = expiration
+		atomic.StoreInt64(&existingItem.AccessCount, 0)
 		if existingItem.parentList == shard.probationList {
 			shard.probationList.Remove(existingItem.element)
 			shard.addProtected(key, existingItem)
@@ -154,6 +282,106 @@ func (c *RRsetCache) Set(key string, rrset []dns.RR) {
 	shard.addProbation(key, item)
 }
 
+// refresh performs a coalesced background lookup to repopulate key, used
+// both by stale hits in Get and by the prefetcher. Concurrent refreshes of
+// the same key are collapsed into a single upstream query via singleflight.
+func (c *RRsetCache) refresh(key string, item *RRsetCacheItem) {
+	if c.resolver == nil || len(item.RRset) == 0 {
+		return
+	}
+
+	h := item.RRset[0].Header()
+	_, err, _ := c.resolver.GetSingleflightGroup().Do(key+"-rrset-refresh", func() (interface{}, error) {
+		req := new(dns.Msg)
+		req.SetQuestion(h.Name, h.Rrtype)
+		req.RecursionDesired = true
+
+		ctx, cancel := context.WithTimeout(context.Background(), c.resolver.GetConfig().UpstreamTimeout)
+		defer cancel()
+
+		resp, err := c.resolver.LookupWithoutCache(ctx, req)
+		if err != nil {
+			return nil, err
+		}
+
+		var refreshed []dns.RR
+		for _, rr := range resp.Answer {
+			if rr.Header().Rrtype == h.Rrtype && strings.EqualFold(rr.Header().Name, h.Name) {
+				refreshed = append(refreshed, rr)
+			}
+		}
+		if len(refreshed) == 0 {
+			return nil, nil
+		}
+
+		c.Set(key, refreshed)
+		return refreshed, nil
+	})
+
+	if err != nil {
+		log.Printf("rrset refresh failed for %s: %v", h.Name, err)
+	}
+}
+
+// runPrefetcher periodically scans for hot items nearing expiry and
+// refreshes them before they go stale.
+func (c *RRsetCache) runPrefetcher() {
+	interval := c.prefetchInterval
+	if interval <= 0 {
+		interval = 30 * time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			c.checkAndPrefetch()
+		case <-c.stopPrefetch:
+			return
+		}
+	}
+}
+
+// checkAndPrefetch refreshes items whose remaining TTL has dropped below
+// CachePrefetchThreshold and that have seen at least CachePrefetchMinHits
+// accesses since their last refresh.
+func (c *RRsetCache) checkAndPrefetch() {
+	if c.config.CachePrefetchThreshold <= 0 {
+		return
+	}
+
+	now := time.Now()
+	for _, shard := range c.shards {
+		shard.RLock()
+		for key, item := range shard.items {
+			remaining := item.Expiration.Sub(now)
+			if remaining <= 0 || remaining >= c.config.CachePrefetchThreshold {
+				continue
+			}
+			if atomic.LoadInt64(&item.AccessCount) < c.config.CachePrefetchMinHits {
+				continue
+			}
+			c.triggerRefresh(key, item)
+		}
+		shard.RUnlock()
+	}
+}
+
+// cloneRRsetWithTTL returns a deep copy of rrset with every record's TTL
+// clamped to ttl, so a stale answer served to a client isn't cached
+// downstream as if it were as fresh as the real TTL suggests.
+func cloneRRsetWithTTL(rrset []dns.RR, ttl time.Duration) []dns.RR {
+	secs := uint32(ttl / time.Second)
+	out := make([]dns.RR, len(rrset))
+	for i, rr := range rrset {
+		cp := dns.Copy(rr)
+		cp.Header().Ttl = secs
+		out[i] = cp
+	}
+	return out
+}
+
 // addProbation adds an item to the probation segment.
 func (s *rrsetSlruSegment) addProbation(key string, item *RRsetCacheItem) {
 	if s.probationList.Len() >= s.probationCapacity {
@@ -203,4 +431,4 @@ func (c *RRsetCache) clampTTL(ttl time.Duration) time.Duration {
 		return c.config.CacheMinTTL
 	}
 	return ttl
-}
\ No newline at end of file
+}
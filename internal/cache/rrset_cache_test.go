@@ -1,11 +1,16 @@
 package cache
 
 import (
+	"context"
 	"dns-resolver/internal/config"
+	"dns-resolver/internal/workerpool"
+	"errors"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/miekg/dns"
+	"golang.org/x/sync/singleflight"
 )
 
 func TestRRsetCache_SetGet(t *testing.T) {
@@ -13,7 +18,7 @@ func TestRRsetCache_SetGet(t *testing.T) {
 	c := NewRRsetCache(cfg, DefaultShards)
 
 	q := dns.Question{Name: "example.com.", Qtype: dns.TypeA, Qclass: dns.ClassINET}
-	key := Key(q)
+	key := Key(q, false, false)
 
 	rr, err := dns.NewRR("example.com. 60 IN A 1.2.3.4")
 	if err != nil {
@@ -23,10 +28,13 @@ func TestRRsetCache_SetGet(t *testing.T) {
 
 	c.Set(key, rrset)
 
-	retrievedRRset, found := c.Get(key)
+	retrievedRRset, found, stale := c.Get(key)
 	if !found {
 		t.Fatal("expected to find RRset in cache")
 	}
+	if stale {
+		t.Fatal("expected a freshly-set RRset to not be stale")
+	}
 
 	if len(retrievedRRset) != 1 {
 		t.Fatalf("expected RRset of length 1, got %d", len(retrievedRRset))
@@ -40,10 +48,11 @@ func TestRRsetCache_SetGet(t *testing.T) {
 func TestRRsetCache_Expiration(t *testing.T) {
 	cfg := config.NewConfig()
 	cfg.CacheMaxTTL = 1 * time.Second // Clamp TTL to 1 second for test
+	cfg.CacheStaleTTL = 0             // Disable serve-stale so true expiration can be observed
 	c := NewRRsetCache(cfg, DefaultShards)
 
 	q := dns.Question{Name: "example.com.", Qtype: dns.TypeA, Qclass: dns.ClassINET}
-	key := Key(q)
+	key := Key(q, false, false)
 
 	// TTL is 60, but should be clamped to 1 by CacheMaxTTL
 	rr, err := dns.NewRR("example.com. 60 IN A 1.2.3.4")
@@ -57,8 +66,284 @@ func TestRRsetCache_Expiration(t *testing.T) {
 	// Wait for the item to expire
 	time.Sleep(2 * time.Second)
 
-	_, found := c.Get(key)
+	_, found, _ := c.Get(key)
 	if found {
 		t.Fatal("expected RRset to be expired from cache")
 	}
-}
\ No newline at end of file
+}
+
+// fakeCacheResolver is a minimal interfaces.CacheResolver used to drive
+// refreshes from tests without a real resolver.
+type fakeCacheResolver struct {
+	sf     singleflight.Group
+	cfg    *config.Config
+	mu     sync.Mutex
+	calls  int
+	lookup func(ctx context.Context, req *dns.Msg) (*dns.Msg, error)
+}
+
+func (f *fakeCacheResolver) GetSingleflightGroup() *singleflight.Group { return &f.sf }
+func (f *fakeCacheResolver) GetConfig() *config.Config                 { return f.cfg }
+func (f *fakeCacheResolver) LookupWithoutCache(ctx context.Context, req *dns.Msg) (*dns.Msg, error) {
+	f.mu.Lock()
+	f.calls++
+	f.mu.Unlock()
+	return f.lookup(ctx, req)
+}
+
+func (f *fakeCacheResolver) callCount() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.calls
+}
+
+func TestRRsetCache_StaleHitWhenUpstreamUnreachable(t *testing.T) {
+	cfg := config.NewConfig()
+	cfg.CacheMaxTTL = 1 * time.Second
+	cfg.CacheStaleTTL = 10 * time.Second
+	c := NewRRsetCache(cfg, DefaultShards)
+
+	resolver := &fakeCacheResolver{
+		cfg: cfg,
+		lookup: func(ctx context.Context, req *dns.Msg) (*dns.Msg, error) {
+			return nil, errors.New("upstream unreachable")
+		},
+	}
+	c.SetResolver(resolver)
+	defer close(c.stopPrefetch)
+
+	q := dns.Question{Name: "stale.example.com.", Qtype: dns.TypeA, Qclass: dns.ClassINET}
+	key := Key(q, false, false)
+	rr, _ := dns.NewRR("stale.example.com. 60 IN A 1.2.3.4")
+	c.Set(key, []dns.RR{rr})
+
+	time.Sleep(1100 * time.Millisecond) // let the 1s clamped TTL expire
+
+	rrset, found, stale := c.Get(key)
+	if !found || !stale {
+		t.Fatalf("expected a stale hit, got found=%v stale=%v", found, stale)
+	}
+	if len(rrset) != 1 || rrset[0].Header().Ttl != uint32(staleServeTTL/time.Second) {
+		t.Fatalf("expected stale RRset with clamped TTL %d, got %+v", staleServeTTL/time.Second, rrset)
+	}
+
+	// Give the background refresh goroutine time to run and fail.
+	time.Sleep(100 * time.Millisecond)
+	if resolver.callCount() == 0 {
+		t.Fatal("expected the stale hit to trigger a background refresh attempt")
+	}
+}
+
+func TestRRsetCache_FreshValueReplacesStaleAfterRefresh(t *testing.T) {
+	cfg := config.NewConfig()
+	cfg.CacheMaxTTL = 1 * time.Second
+	cfg.CacheStaleTTL = 10 * time.Second
+	c := NewRRsetCache(cfg, DefaultShards)
+
+	q := dns.Question{Name: "refresh.example.com.", Qtype: dns.TypeA, Qclass: dns.ClassINET}
+	key := Key(q, false, false)
+	rr, _ := dns.NewRR("refresh.example.com. 60 IN A 1.2.3.4")
+	refreshedRR, _ := dns.NewRR("refresh.example.com. 60 IN A 5.6.7.8")
+
+	resolver := &fakeCacheResolver{
+		cfg: cfg,
+		lookup: func(ctx context.Context, req *dns.Msg) (*dns.Msg, error) {
+			resp := new(dns.Msg)
+			resp.SetQuestion(req.Question[0].Name, req.Question[0].Qtype)
+			resp.Answer = []dns.RR{refreshedRR}
+			return resp, nil
+		},
+	}
+	c.SetResolver(resolver)
+	defer close(c.stopPrefetch)
+
+	c.Set(key, []dns.RR{rr})
+
+	time.Sleep(1100 * time.Millisecond) // let the 1s clamped TTL expire
+
+	_, found, stale := c.Get(key)
+	if !found || !stale {
+		t.Fatalf("expected a stale hit before the refresh completes, got found=%v stale=%v", found, stale)
+	}
+
+	// Wait for the background refresh triggered by the stale Get to land.
+	time.Sleep(200 * time.Millisecond)
+
+	rrset, found, stale := c.Get(key)
+	if !found || stale {
+		t.Fatalf("expected the refreshed value to be fresh, got found=%v stale=%v", found, stale)
+	}
+	if rrset[0].String() != refreshedRR.String() {
+		t.Fatalf("expected refreshed RRset %s, got %s", refreshedRR.String(), rrset[0].String())
+	}
+}
+
+func TestRRsetCache_StaleHitsCoalesceIntoOneUpstreamCall(t *testing.T) {
+	cfg := config.NewConfig()
+	cfg.CacheMaxTTL = 1 * time.Second
+	cfg.CacheStaleTTL = 10 * time.Second
+	c := NewRRsetCache(cfg, DefaultShards)
+
+	var inFlight sync.WaitGroup
+	release := make(chan struct{})
+	resolver := &fakeCacheResolver{
+		cfg: cfg,
+		lookup: func(ctx context.Context, req *dns.Msg) (*dns.Msg, error) {
+			<-release
+			resp := new(dns.Msg)
+			resp.SetQuestion(req.Question[0].Name, req.Question[0].Qtype)
+			rr, _ := dns.NewRR("coalesce.example.com. 60 IN A 9.9.9.9")
+			resp.Answer = []dns.RR{rr}
+			return resp, nil
+		},
+	}
+	c.SetResolver(resolver)
+	defer close(c.stopPrefetch)
+
+	q := dns.Question{Name: "coalesce.example.com.", Qtype: dns.TypeA, Qclass: dns.ClassINET}
+	key := Key(q, false, false)
+	rr, _ := dns.NewRR("coalesce.example.com. 60 IN A 1.2.3.4")
+	c.Set(key, []dns.RR{rr})
+
+	time.Sleep(1100 * time.Millisecond) // let the 1s clamped TTL expire
+
+	const concurrentGets = 20
+	inFlight.Add(concurrentGets)
+	for i := 0; i < concurrentGets; i++ {
+		go func() {
+			defer inFlight.Done()
+			c.Get(key)
+		}()
+	}
+	inFlight.Wait()
+	close(release)
+
+	time.Sleep(200 * time.Millisecond)
+	if calls := resolver.callCount(); calls != 1 {
+		t.Fatalf("expected singleflight to collapse concurrent stale gets into 1 upstream call, got %d", calls)
+	}
+}
+
+func TestRRsetCache_GetWithStale_Miss(t *testing.T) {
+	cfg := config.NewConfig()
+	c := NewRRsetCache(cfg, DefaultShards)
+
+	q := dns.Question{Name: "missing.example.com.", Qtype: dns.TypeA, Qclass: dns.ClassINET}
+	if _, state := c.GetWithStale(Key(q, false, false)); state != Miss {
+		t.Fatalf("expected Miss, got %s", state)
+	}
+}
+
+func TestRRsetCache_GetWithStale_Fresh(t *testing.T) {
+	cfg := config.NewConfig()
+	c := NewRRsetCache(cfg, DefaultShards)
+
+	q := dns.Question{Name: "fresh.example.com.", Qtype: dns.TypeA, Qclass: dns.ClassINET}
+	key := Key(q, false, false)
+	rr, _ := dns.NewRR("fresh.example.com. 3600 IN A 1.2.3.4")
+	c.Set(key, []dns.RR{rr})
+
+	rrset, state := c.GetWithStale(key)
+	if state != Fresh {
+		t.Fatalf("expected Fresh, got %s", state)
+	}
+	if len(rrset) != 1 {
+		t.Fatalf("expected 1 RR, got %d", len(rrset))
+	}
+}
+
+func TestRRsetCache_GetWithStale_Prefetch(t *testing.T) {
+	cfg := config.NewConfig()
+	cfg.CacheMaxTTL = 2 * time.Second
+	cfg.CachePrefetchThreshold = 3 * time.Second // wider than the TTL, so every fresh hit qualifies
+	c := NewRRsetCache(cfg, DefaultShards)
+
+	resolver := &fakeCacheResolver{
+		cfg: cfg,
+		lookup: func(ctx context.Context, req *dns.Msg) (*dns.Msg, error) {
+			return nil, errors.New("upstream unreachable")
+		},
+	}
+	c.SetResolver(resolver)
+	defer close(c.stopPrefetch)
+
+	q := dns.Question{Name: "prefetch.example.com.", Qtype: dns.TypeA, Qclass: dns.ClassINET}
+	key := Key(q, false, false)
+	rr, _ := dns.NewRR("prefetch.example.com. 60 IN A 1.2.3.4")
+	c.Set(key, []dns.RR{rr})
+
+	_, state := c.GetWithStale(key)
+	if state != Prefetch {
+		t.Fatalf("expected Prefetch, got %s", state)
+	}
+
+	time.Sleep(100 * time.Millisecond)
+	if resolver.callCount() == 0 {
+		t.Fatal("expected a Prefetch hit to trigger a background refresh attempt")
+	}
+}
+
+func TestRRsetCache_GetWithStale_Stale(t *testing.T) {
+	cfg := config.NewConfig()
+	cfg.CacheMaxTTL = 1 * time.Second
+	cfg.CacheStaleTTL = 10 * time.Second
+	c := NewRRsetCache(cfg, DefaultShards)
+
+	resolver := &fakeCacheResolver{
+		cfg: cfg,
+		lookup: func(ctx context.Context, req *dns.Msg) (*dns.Msg, error) {
+			return nil, errors.New("upstream unreachable")
+		},
+	}
+	c.SetResolver(resolver)
+	defer close(c.stopPrefetch)
+
+	q := dns.Question{Name: "stalestate.example.com.", Qtype: dns.TypeA, Qclass: dns.ClassINET}
+	key := Key(q, false, false)
+	rr, _ := dns.NewRR("stalestate.example.com. 60 IN A 1.2.3.4")
+	c.Set(key, []dns.RR{rr})
+
+	time.Sleep(1100 * time.Millisecond)
+
+	_, state := c.GetWithStale(key)
+	if state != Stale {
+		t.Fatalf("expected Stale, got %s", state)
+	}
+}
+
+func TestRRsetCache_SetWorkerPool_RunsRefreshThroughPool(t *testing.T) {
+	cfg := config.NewConfig()
+	cfg.CacheMaxTTL = 1 * time.Second
+	cfg.CacheStaleTTL = 10 * time.Second
+	c := NewRRsetCache(cfg, DefaultShards)
+
+	pool := workerpool.New(2, 4, "test", nil)
+	defer pool.Stop()
+	c.SetWorkerPool(pool)
+
+	resolver := &fakeCacheResolver{
+		cfg: cfg,
+		lookup: func(ctx context.Context, req *dns.Msg) (*dns.Msg, error) {
+			resp := new(dns.Msg)
+			resp.SetQuestion(req.Question[0].Name, req.Question[0].Qtype)
+			rr, _ := dns.NewRR("pooled.example.com. 60 IN A 9.9.9.9")
+			resp.Answer = []dns.RR{rr}
+			return resp, nil
+		},
+	}
+	c.SetResolver(resolver)
+	defer close(c.stopPrefetch)
+
+	q := dns.Question{Name: "pooled.example.com.", Qtype: dns.TypeA, Qclass: dns.ClassINET}
+	key := Key(q, false, false)
+	rr, _ := dns.NewRR("pooled.example.com. 60 IN A 1.2.3.4")
+	c.Set(key, []dns.RR{rr})
+
+	time.Sleep(1100 * time.Millisecond)
+	c.Get(key) // triggers the stale refresh, via the attached pool
+
+	time.Sleep(200 * time.Millisecond)
+	if resolver.callCount() == 0 {
+		t.Fatal("expected the pool-backed refresh to have run")
+	}
+}
@@ -0,0 +1,118 @@
+package cache
+
+import (
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+func mustRR(t *testing.T, s string) dns.RR {
+	t.Helper()
+	rr, err := dns.NewRR(s)
+	if err != nil {
+		t.Fatalf("failed to parse RR %q: %v", s, err)
+	}
+	return rr
+}
+
+func TestShardedCache_SynthesizeFromRRsets_FollowsCNAMEChain(t *testing.T) {
+	sc := NewShardedCache(1, 1*time.Minute, CacheConfig{MaxEntries: 10})
+
+	cnameMsg := new(dns.Msg)
+	cnameMsg.SetQuestion("www.example.com.", dns.TypeA)
+	cnameMsg.Answer = append(cnameMsg.Answer, mustRR(t, "www.example.com. 60 IN CNAME foo.example.net."))
+	sc.Set(CacheKey{Qname: "www.example.com.", Qtype: dns.TypeA, Qclass: dns.ClassINET}, cnameMsg, 60*time.Second, false, true)
+
+	aMsg := new(dns.Msg)
+	aMsg.SetQuestion("foo.example.net.", dns.TypeA)
+	aMsg.Answer = append(aMsg.Answer, mustRR(t, "foo.example.net. 60 IN A 1.2.3.4"))
+	sc.Set(CacheKey{Qname: "foo.example.net.", Qtype: dns.TypeA, Qclass: dns.ClassINET}, aMsg, 60*time.Second, false, true)
+
+	got, ok := sc.SynthesizeFromRRsets(dns.Question{Name: "www.example.com.", Qtype: dns.TypeA, Qclass: dns.ClassINET})
+	if !ok {
+		t.Fatal("expected the CNAME chain to be synthesized from cached RRsets")
+	}
+	if len(got.Answer) != 2 {
+		t.Fatalf("expected the CNAME plus its target's A record, got %d records", len(got.Answer))
+	}
+	if _, ok := got.Answer[0].(*dns.CNAME); !ok {
+		t.Errorf("expected the first answer record to be the CNAME, got %T", got.Answer[0])
+	}
+	a, ok := got.Answer[1].(*dns.A)
+	if !ok || a.A.String() != "1.2.3.4" {
+		t.Errorf("expected the second answer record to be the target's A record, got %v", got.Answer[1])
+	}
+}
+
+func TestShardedCache_SynthesizeFromRRsets_DanglingCNAMEIsAMiss(t *testing.T) {
+	sc := NewShardedCache(1, 1*time.Minute, CacheConfig{MaxEntries: 10})
+
+	cnameMsg := new(dns.Msg)
+	cnameMsg.SetQuestion("www.example.com.", dns.TypeA)
+	cnameMsg.Answer = append(cnameMsg.Answer, mustRR(t, "www.example.com. 60 IN CNAME foo.example.net."))
+	sc.Set(CacheKey{Qname: "www.example.com.", Qtype: dns.TypeA, Qclass: dns.ClassINET}, cnameMsg, 60*time.Second, false, true)
+
+	// foo.example.net's own A record was never cached (or has since been
+	// evicted), leaving the CNAME dangling.
+	_, ok := sc.SynthesizeFromRRsets(dns.Question{Name: "www.example.com.", Qtype: dns.TypeA, Qclass: dns.ClassINET})
+	if ok {
+		t.Fatal("expected a dangling CNAME target to be treated as a miss, not an incomplete chain")
+	}
+}
+
+func TestShardedCache_SynthesizeFromRRsets_DirectAnswerWithNoCNAME(t *testing.T) {
+	sc := NewShardedCache(1, 1*time.Minute, CacheConfig{MaxEntries: 10})
+
+	aMsg := new(dns.Msg)
+	aMsg.SetQuestion("foo.example.net.", dns.TypeA)
+	aMsg.Answer = append(aMsg.Answer, mustRR(t, "foo.example.net. 60 IN A 1.2.3.4"))
+	sc.Set(CacheKey{Qname: "foo.example.net.", Qtype: dns.TypeA, Qclass: dns.ClassINET}, aMsg, 60*time.Second, false, true)
+
+	got, ok := sc.SynthesizeFromRRsets(dns.Question{Name: "foo.example.net.", Qtype: dns.TypeA, Qclass: dns.ClassINET})
+	if !ok {
+		t.Fatal("expected a direct answer RRset to be synthesized without needing a CNAME")
+	}
+	if len(got.Answer) != 1 {
+		t.Fatalf("expected exactly 1 answer record, got %d", len(got.Answer))
+	}
+}
+
+func TestShardedCache_SynthesizeFromRRsets_ExpiredTargetIsAMiss(t *testing.T) {
+	sc := NewShardedCache(1, 1*time.Minute, CacheConfig{MaxEntries: 10})
+
+	cnameMsg := new(dns.Msg)
+	cnameMsg.SetQuestion("www.example.com.", dns.TypeA)
+	cnameMsg.Answer = append(cnameMsg.Answer, mustRR(t, "www.example.com. 60 IN CNAME foo.example.net."))
+	sc.Set(CacheKey{Qname: "www.example.com.", Qtype: dns.TypeA, Qclass: dns.ClassINET}, cnameMsg, 60*time.Second, false, true)
+
+	aMsg := new(dns.Msg)
+	aMsg.SetQuestion("foo.example.net.", dns.TypeA)
+	aMsg.Answer = append(aMsg.Answer, mustRR(t, "foo.example.net. 60 IN A 1.2.3.4"))
+	// Already expired by the time it's looked up.
+	sc.Set(CacheKey{Qname: "foo.example.net.", Qtype: dns.TypeA, Qclass: dns.ClassINET}, aMsg, -1*time.Second, false, true)
+
+	_, ok := sc.SynthesizeFromRRsets(dns.Question{Name: "www.example.com.", Qtype: dns.TypeA, Qclass: dns.ClassINET})
+	if ok {
+		t.Fatal("expected an expired CNAME target RRset to be treated as a miss")
+	}
+}
+
+func TestShardedCache_IsDanglingCNAME(t *testing.T) {
+	sc := NewShardedCache(1, 1*time.Minute, CacheConfig{MaxEntries: 10})
+	now := time.Now()
+
+	cname := mustRR(t, "www.example.com. 60 IN CNAME foo.example.net.").(*dns.CNAME)
+	if !sc.isDanglingCNAME(cname, dns.TypeA, dns.ClassINET, now) {
+		t.Error("expected a CNAME with no indexed target to be dangling")
+	}
+
+	aMsg := new(dns.Msg)
+	aMsg.SetQuestion("foo.example.net.", dns.TypeA)
+	aMsg.Answer = append(aMsg.Answer, mustRR(t, "foo.example.net. 60 IN A 1.2.3.4"))
+	sc.Set(CacheKey{Qname: "foo.example.net.", Qtype: dns.TypeA, Qclass: dns.ClassINET}, aMsg, 60*time.Second, false, true)
+
+	if sc.isDanglingCNAME(cname, dns.TypeA, dns.ClassINET, time.Now()) {
+		t.Error("expected a CNAME whose target now has a cached A record not to be dangling")
+	}
+}
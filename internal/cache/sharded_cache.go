@@ -2,6 +2,9 @@ package cache
 
 import (
 	"container/list"
+	"dns-resolver/internal/dnstap"
+	"dns-resolver/internal/metrics"
+	"fmt"
 	"hash/fnv"
 	"sync"
 	"time"
@@ -13,6 +16,32 @@ const (
 	defaultShards = 32 // Example: 32 shards
 )
 
+// CacheKey identifies a cached response by its question plus the two EDNS
+// bits that change what may be served for it: DO (DNSSEC OK) and CD
+// (Checking Disabled). A CD=1 query may accept answers that skipped or
+// failed DNSSEC validation, so a response cached under CD=1 must never be
+// handed back to a CD=0 query (or vice versa); keying on DO/CD as well as
+// the question keeps those entries from ever colliding, even though they
+// answer the same name/type/class.
+type CacheKey struct {
+	Qname  string
+	Qtype  uint16
+	Qclass uint16
+	DO     bool
+	CD     bool
+}
+
+// String renders k as the opaque string ShardedCache actually indexes on.
+func (k CacheKey) String() string {
+	return fmt.Sprintf("%s:%d:%d:do=%t:cd=%t", k.Qname, k.Qtype, k.Qclass, k.DO, k.CD)
+}
+
+// question renders k as the dns.Question dnstap's CACHE_HIT/CACHE_MISS
+// frames are built from.
+func (k CacheKey) question() dns.Question {
+	return dns.Question{Name: k.Qname, Qtype: k.Qtype, Qclass: k.Qclass}
+}
+
 // CacheConfig holds configuration for the cache.
 type CacheConfig struct {
 	MaxEntries           int
@@ -20,6 +49,55 @@ type CacheConfig struct {
 	MaxTTLSecs           int
 	NegativeCacheEnabled bool
 	NegativeTTLSecs      int
+	// RejectedTTLSecs is the default TTL applied to entries in the
+	// RejectedResponseCache when RejectFor is called with ttl <= 0.
+	RejectedTTLSecs int
+	// PrefetchThresholdPct is the fraction (0-1) of an entry's original TTL
+	// remaining at or below which it becomes eligible for prefetch. A
+	// non-positive value falls back to DefaultPrefetchPercentage.
+	PrefetchThresholdPct float64
+	// PrefetchMinHits is the minimum number of hits an entry must see within
+	// the prefetch window before it's considered hot enough to prefetch. A
+	// non-positive value falls back to DefaultPrefetchThresholdHits.
+	PrefetchMinHits int64
+	// PrefetchWorkers bounds the number of prefetch refetches that may run
+	// concurrently, so a burst of near-expiry hot keys can't exhaust
+	// goroutines. A non-positive value falls back to defaultPrefetchWorkers.
+	PrefetchWorkers int
+	// MaxStaleTTLSecs is how long past Expiry (RFC 8767 "stale-until", up
+	// to e.g. 24h) an entry is still kept around and returned by Get as a
+	// stale hit instead of a miss. A non-positive value disables
+	// serve-stale entirely: entries are evicted as soon as they expire.
+	MaxStaleTTLSecs int
+	// StaleAnswerTTLSecs is the TTL stamped onto a response synthesized
+	// from a stale entry (commonly 30s), so anything caching our answer
+	// re-checks with us again soon. A non-positive value falls back to
+	// defaultStaleAnswerTTLSecs.
+	StaleAnswerTTLSecs int
+	// PrefetchingEnabled gates the TTL-driven prefetcher entirely: when
+	// false, Get neither tracks hit counts nor schedules refetches, even if
+	// PrefetchThresholdPct/PrefetchMinHits are set.
+	PrefetchingEnabled bool
+	// StaleRefreshMode controls how a caller (CachingResolver.Exchange)
+	// should treat a stale Get hit: "verify" (the default when unset)
+	// retries upstream first with a short deadline and only falls back to
+	// the stale entry on failure, while "immediate" serves the stale entry
+	// right away and expects the caller to refresh it asynchronously.
+	StaleRefreshMode string
+	// StaleRefreshWorkers bounds how many background stale refreshes (as
+	// used by StaleRefreshMode "immediate") may run concurrently. A
+	// non-positive value falls back to defaultStaleRefreshWorkers.
+	StaleRefreshWorkers int
+	// DisableSuccess lists zone suffixes for which positive (success)
+	// responses are never cached. nil (the default) never disables
+	// caching; a configured but empty list disables success caching
+	// globally; otherwise only names equal to, or a subdomain of, one of
+	// the listed zones are affected.
+	DisableSuccess []string
+	// DisableDenial is DisableSuccess's counterpart for negative (NXDOMAIN/
+	// NODATA) responses, e.g. so a subtree with flaky DNSSEC never has its
+	// bogus denials cached.
+	DisableDenial []string
 }
 
 // CacheEntry represents a single entry in the cache.
@@ -29,8 +107,22 @@ type CacheEntry struct {
 	Expiry          time.Time
 	IsNegative      bool
 	DNSSECValidated bool
+	// OriginalTTL is the TTL the entry was stored with, used to judge how
+	// close to expiry it is as a fraction of its lifetime.
+	OriginalTTL time.Duration
 }
 
+// PrefetchCallback is invoked with the key and most recently cached message
+// for an entry ShardedCache has decided is hot enough, and close enough to
+// expiry, to warrant a background refetch. The resolver wires this to its
+// own upstream query path via SetPrefetchCallback, returning any error from
+// that refetch so schedulePrefetch can tell success from failure.
+type PrefetchCallback func(key CacheKey, msg *dns.Msg) error
+
+// defaultPrefetchWorkers bounds concurrent prefetch refetches when
+// CacheConfig.PrefetchWorkers isn't set.
+const defaultPrefetchWorkers = 4
+
 // Shard is a part of the ShardedCache, protected by a mutex.
 type Shard struct {
 	entries    map[string]*list.Element
@@ -41,11 +133,34 @@ type Shard struct {
 
 // ShardedCache implements a sharded, in-memory cache for DNS responses.
 type ShardedCache struct {
-	shards          []*Shard
-	numShards       uint32
-	Config          CacheConfig
-	stop            chan struct{}
-	cleanupInterval time.Duration
+	shards           []*Shard
+	numShards        uint32
+	Config           CacheConfig
+	stop             chan struct{}
+	cleanupInterval  time.Duration
+	prefetch         *PrefetchTracker
+	prefetchCallback PrefetchCallback
+	prefetchSem      chan struct{}
+	metrics          *metrics.Metrics
+	dnstap           *dnstap.Logger
+	// rrsets indexes individual RRsets by owner name/type/class (see
+	// indexRRsets), alongside the whole-message entries above, so
+	// synthesizeFromRRsets can answer a question by walking a CNAME chain
+	// even when no single message covers the full chain.
+	rrsets sync.Map // cnameChainKey(...) -> *rrsetEntry
+}
+
+// rrsetEntry is a single RRset cached for CNAME-chain synthesis, with its
+// own expiry independent of whatever whole-message entry it was decomposed
+// from.
+type rrsetEntry struct {
+	rrs    []dns.RR
+	expiry time.Time
+}
+
+// cnameChainKey identifies an rrsetEntry by owner name, type, and class.
+func cnameChainKey(name string, rrtype, class uint16) string {
+	return fmt.Sprintf("%s:%d:%d", name, rrtype, class)
 }
 
 // NewShardedCache creates a new ShardedCache with the specified number of shards.
@@ -61,63 +176,163 @@ func NewShardedCache(numShards int, cleanupInterval time.Duration, config CacheC
 			maxEntries: config.MaxEntries,
 		}
 	}
+	workers := config.PrefetchWorkers
+	if workers <= 0 {
+		workers = defaultPrefetchWorkers
+	}
 	cache := &ShardedCache{
 		shards:          shards,
 		numShards:       uint32(numShards),
 		Config:          config,
 		stop:            make(chan struct{}),
 		cleanupInterval: cleanupInterval,
+		prefetch:        NewPrefetchTracker(config.PrefetchMinHits, config.PrefetchThresholdPct),
+		prefetchSem:     make(chan struct{}, workers),
 	}
 
 	cache.startCleanup()
 	return cache
 }
 
-// Get retrieves a DNS message from the cache.
-func (c *ShardedCache) Get(key string) (*dns.Msg, bool, bool, bool) {
-	shard := c.getShard(key)
+// SetPrefetchCallback wires cb as the upstream refetch path for TTL-driven
+// prefetch. Until set, ShardedCache still tracks hits but never schedules a
+// prefetch, since there would be nowhere to send it.
+func (c *ShardedCache) SetPrefetchCallback(cb PrefetchCallback) {
+	c.prefetchCallback = cb
+}
+
+// SetMetrics wires m so prefetch scheduling/success can be observed. It may
+// be left unset in tests that don't care about metrics.
+func (c *ShardedCache) SetMetrics(m *metrics.Metrics) {
+	c.metrics = m
+}
+
+// SetDnstap wires l so every Get/Set emits a CACHE_HIT/CACHE_MISS dnstap
+// frame. A nil l (dnstap disabled, or left unset in tests) makes Get/Set's
+// calls into it no-ops.
+func (c *ShardedCache) SetDnstap(l *dnstap.Logger) {
+	c.dnstap = l
+}
+
+// Get retrieves a DNS message from the cache. The final two return values
+// distinguish a fresh hit from a stale one: found=true means the entry is
+// within its original TTL, while stale=true means it has expired but is
+// still within CacheConfig.MaxStaleTTLSecs of its expiry and msg is the
+// stale record, for a caller implementing RFC 8767 serve-stale to fall back
+// on; found and stale are never both true. ttlRemaining is how much of the
+// entry's TTL is left (zero once it's gone stale), for a caller that needs
+// to stamp a decremented TTL onto a reconstructed reply rather than reusing
+// the entry's original TTL verbatim.
+func (c *ShardedCache) Get(key CacheKey) (msg *dns.Msg, found bool, isNegative bool, dnssecValidated bool, stale bool, ttlRemaining time.Duration) {
+	k := key.String()
+	shard := c.getShard(k)
 	shard.mu.RLock()
 
-	element, found := shard.entries[key]
-	if !found {
+	element, ok := shard.entries[k]
+	if !ok {
 		shard.mu.RUnlock()
-		return nil, false, false, false
+		c.dnstap.LogCacheMissQuestion(key.question())
+		return nil, false, false, false, false, 0
 	}
 
 	entry := element.Value.(*CacheEntry)
-	if time.Now().After(entry.Expiry) {
+	now := time.Now()
+	if now.After(entry.Expiry) {
+		maxStaleTTL := time.Duration(c.Config.MaxStaleTTLSecs) * time.Second
+		if c.Config.MaxStaleTTLSecs <= 0 || now.After(staleUntil(entry, maxStaleTTL)) {
+			shard.mu.RUnlock()
+			c.dnstap.LogCacheMissQuestion(key.question())
+			return nil, false, false, false, false, 0
+		}
+		msg, isNegative, dnssecValidated := entry.Msg, entry.IsNegative, entry.DNSSECValidated
 		shard.mu.RUnlock()
-		return nil, false, false, false
+		c.dnstap.LogCacheHitQuestion(key.question())
+		return msg, false, isNegative, dnssecValidated, true, 0
 	}
 
-	msg := entry.Msg
-	isNegative := entry.IsNegative
-	dnssecValidated := entry.DNSSECValidated
+	msg, isNegative, dnssecValidated = entry.Msg, entry.IsNegative, entry.DNSSECValidated
+	originalTTL := entry.OriginalTTL
+	remainingTTL := time.Until(entry.Expiry)
 	shard.mu.RUnlock()
 
 	shard.mu.Lock()
 	// Re-check existence, as the entry might have been removed in the meantime.
-	if element, found := shard.entries[key]; found {
+	if element, found := shard.entries[k]; found {
 		shard.lruList.MoveToFront(element)
 	}
 	shard.mu.Unlock()
 
-	return msg, true, isNegative, dnssecValidated
+	// Negative entries are never prefetched: there's no point racing to
+	// refresh an NXDOMAIN/NODATA answer ahead of its expiry.
+	if c.Config.PrefetchingEnabled && !isNegative {
+		c.prefetch.RecordHit(k)
+		if c.prefetch.ShouldPrefetch(k, remainingTTL, originalTTL) {
+			c.schedulePrefetch(key, msg)
+		}
+	}
+
+	c.dnstap.LogCacheHitQuestion(key.question())
+	return msg, true, isNegative, dnssecValidated, false, remainingTTL
+}
+
+// schedulePrefetch runs the prefetch callback for key/msg in the bounded
+// prefetch worker pool. If the pool is saturated, the refetch is dropped
+// for this round; the key stays hot and will be retried on its next hit.
+func (c *ShardedCache) schedulePrefetch(key CacheKey, msg *dns.Msg) {
+	if c.prefetchCallback == nil {
+		return
+	}
+
+	select {
+	case c.prefetchSem <- struct{}{}:
+	default:
+		return
+	}
+
+	if c.metrics != nil {
+		c.metrics.IncrementCachePrefetchScheduled()
+	}
+
+	go func() {
+		defer func() { <-c.prefetchSem }()
+		if err := c.prefetchCallback(key, msg); err != nil {
+			if c.metrics != nil {
+				c.metrics.IncrementCachePrefetchFailed()
+			}
+			return
+		}
+		if c.metrics != nil {
+			c.metrics.IncrementCachePrefetchSuccess()
+		}
+	}()
 }
 
 // Set adds a DNS message to the cache.
-func (c *ShardedCache) Set(key string, msg *dns.Msg, ttl time.Duration, isNegative bool, dnssecValidated bool) {
-	shard := c.getShard(key)
+func (c *ShardedCache) Set(key CacheKey, msg *dns.Msg, ttl time.Duration, isNegative bool, dnssecValidated bool) {
+	if msg != nil && msg.Truncated {
+		// A truncated response is incomplete; never let it poison the cache
+		// for a subsequent query that might get the full answer.
+		return
+	}
+
+	if !isNegative && msg != nil {
+		c.indexRRsets(msg, ttl)
+	}
+
+	k := key.String()
+	shard := c.getShard(k)
 	shard.mu.Lock()
 	defer shard.mu.Unlock()
 
-	if element, found := shard.entries[key]; found {
+	if element, found := shard.entries[k]; found {
 		entry := element.Value.(*CacheEntry)
 		entry.Msg = msg
 		entry.Expiry = time.Now().Add(ttl)
 		entry.IsNegative = isNegative
 		entry.DNSSECValidated = dnssecValidated
+		entry.OriginalTTL = ttl
 		shard.lruList.MoveToFront(element)
+		c.prefetch.Evict(k)
 		return
 	}
 
@@ -130,14 +345,109 @@ func (c *ShardedCache) Set(key string, msg *dns.Msg, ttl time.Duration, isNegati
 	}
 
 	entry := &CacheEntry{
-		Key:             key,
+		Key:             k,
 		Msg:             msg,
 		Expiry:          time.Now().Add(ttl),
 		IsNegative:      isNegative,
 		DNSSECValidated: dnssecValidated,
+		OriginalTTL:     ttl,
 	}
 	element := shard.lruList.PushFront(entry)
-	shard.entries[key] = element
+	shard.entries[k] = element
+	c.prefetch.Evict(k)
+}
+
+// maxCNAMEChain bounds how many CNAME hops synthesizeFromRRsets follows,
+// matching common resolver chain-following limits and guarding against a
+// cached loop (A -> B -> A).
+const maxCNAMEChain = 10
+
+// indexRRsets decomposes msg's answer section into per-owner-name/type/class
+// RRsets (see cnameChainKey) so a later question for a different but related
+// name - notably a CNAME's target - can potentially be answered by
+// synthesizeFromRRsets without an upstream query, even though no single
+// whole-message entry covers that name. ttl is the same effective TTL the
+// caller is storing the whole-message entry with, so an RRset's expiry here
+// always agrees with its source entry's Expiry rather than being
+// recomputed (and potentially disagreeing) from the records' own header
+// TTLs.
+func (c *ShardedCache) indexRRsets(msg *dns.Msg, ttl time.Duration) {
+	grouped := make(map[string][]dns.RR)
+	for _, rr := range msg.Answer {
+		h := rr.Header()
+		if h.Rrtype == dns.TypeOPT {
+			continue
+		}
+		grouped[cnameChainKey(h.Name, h.Rrtype, h.Class)] = append(grouped[cnameChainKey(h.Name, h.Rrtype, h.Class)], rr)
+	}
+
+	expiry := time.Now().Add(ttl)
+	for key, rrs := range grouped {
+		c.rrsets.Store(key, &rrsetEntry{rrs: rrs, expiry: expiry})
+	}
+}
+
+// lookupRRset returns the unexpired RRset indexed for name/rrtype/class, if
+// any; an expired entry is treated the same as no entry at all.
+func (c *ShardedCache) lookupRRset(name string, rrtype, class uint16, now time.Time) ([]dns.RR, bool) {
+	v, ok := c.rrsets.Load(cnameChainKey(name, rrtype, class))
+	if !ok {
+		return nil, false
+	}
+	entry := v.(*rrsetEntry)
+	if now.After(entry.expiry) {
+		return nil, false
+	}
+	return entry.rrs, true
+}
+
+// isDanglingCNAME reports whether cname's target has neither a direct
+// rrtype/class answer nor a further CNAME indexed for it, meaning its chain
+// can't be completed from the RRsets currently in the cache (e.g. the
+// target's own entry expired or was evicted independently of the CNAME
+// pointing at it).
+func (c *ShardedCache) isDanglingCNAME(cname *dns.CNAME, rrtype, class uint16, now time.Time) bool {
+	if _, ok := c.lookupRRset(cname.Target, rrtype, class, now); ok {
+		return false
+	}
+	_, ok := c.lookupRRset(cname.Target, dns.TypeCNAME, class, now)
+	return !ok
+}
+
+// SynthesizeFromRRsets tries to answer q entirely from previously-indexed
+// RRsets by walking a CNAME chain one hop at a time. A dangling CNAME (see
+// isDanglingCNAME) aborts the walk and reports a miss rather than returning
+// an incomplete chain, so the caller falls back to an upstream query
+// instead of handing a client a response it can't fully resolve.
+func (c *ShardedCache) SynthesizeFromRRsets(q dns.Question) (*dns.Msg, bool) {
+	now := time.Now()
+	msg := new(dns.Msg)
+	msg.SetQuestion(q.Name, q.Qtype)
+	msg.Rcode = dns.RcodeSuccess
+
+	name := q.Name
+	for i := 0; i < maxCNAMEChain; i++ {
+		if rrs, ok := c.lookupRRset(name, q.Qtype, q.Qclass, now); ok {
+			msg.Answer = append(msg.Answer, rrs...)
+			return msg, true
+		}
+
+		cnameRRs, ok := c.lookupRRset(name, dns.TypeCNAME, q.Qclass, now)
+		if !ok {
+			return nil, false
+		}
+		cname, ok := cnameRRs[0].(*dns.CNAME)
+		if !ok {
+			return nil, false
+		}
+		if c.isDanglingCNAME(cname, q.Qtype, q.Qclass, now) {
+			return nil, false
+		}
+
+		msg.Answer = append(msg.Answer, cnameRRs...)
+		name = cname.Target
+	}
+	return nil, false
 }
 
 // Stop stops the background cleanup goroutines.
@@ -152,15 +462,53 @@ func (c *ShardedCache) getShard(key string) *Shard {
 	return c.shards[h.Sum32()%c.numShards]
 }
 
-// startCleanup starts a goroutine for each shard to periodically remove expired entries.
+// startCleanup starts a goroutine for each shard to periodically remove
+// entries once they've fallen out of the stale-serving window.
 func (c *ShardedCache) startCleanup() {
+	maxStaleTTL := time.Duration(c.Config.MaxStaleTTLSecs) * time.Second
 	for i := 0; i < int(c.numShards); i++ {
-		go c.shards[i].cleanup(c.cleanupInterval, c.stop)
+		go c.shards[i].cleanup(c.cleanupInterval, maxStaleTTL, c.stop)
 	}
+	go c.cleanupRRsets(c.cleanupInterval, c.stop)
 }
 
-// cleanup removes expired entries from the shard.
-func (s *Shard) cleanup(interval time.Duration, stop <-chan struct{}) {
+// cleanupRRsets periodically sweeps the rrsets side-index for expired
+// entries. Unlike the per-shard whole-message entries, lookupRRset only
+// checks expiry at read time and nothing else ever deletes from rrsets, so
+// without this an entry for every owner/type/class ever indexed would live
+// in memory for the life of the process.
+func (c *ShardedCache) cleanupRRsets(interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			now := time.Now()
+			c.rrsets.Range(func(key, value interface{}) bool {
+				if now.After(value.(*rrsetEntry).expiry) {
+					c.rrsets.Delete(key)
+				}
+				return true
+			})
+		case <-stop:
+			return
+		}
+	}
+}
+
+// staleUntil is the point after which an entry is no longer eligible to be
+// served stale and can be hard-evicted; it's just entry.Expiry when
+// serve-stale is disabled (maxStaleTTL <= 0).
+func staleUntil(entry *CacheEntry, maxStaleTTL time.Duration) time.Time {
+	if maxStaleTTL <= 0 {
+		return entry.Expiry
+	}
+	return entry.Expiry.Add(maxStaleTTL)
+}
+
+// cleanup removes entries that are past their stale-serving window.
+func (s *Shard) cleanup(interval time.Duration, maxStaleTTL time.Duration, stop <-chan struct{}) {
 	ticker := time.NewTicker(interval)
 	defer ticker.Stop()
 
@@ -172,7 +520,7 @@ func (s *Shard) cleanup(interval time.Duration, stop <-chan struct{}) {
 			now := time.Now()
 			for element := s.lruList.Back(); element != nil; element = element.Prev() {
 				entry := element.Value.(*CacheEntry)
-				if now.After(entry.Expiry) {
+				if now.After(staleUntil(entry, maxStaleTTL)) {
 					keysToDelete = append(keysToDelete, entry.Key)
 				} else {
 					break
@@ -184,7 +532,7 @@ func (s *Shard) cleanup(interval time.Duration, stop <-chan struct{}) {
 				s.mu.Lock()
 				for _, key := range keysToDelete {
 					if element, found := s.entries[key]; found {
-						if time.Now().After(element.Value.(*CacheEntry).Expiry) {
+						if time.Now().After(staleUntil(element.Value.(*CacheEntry), maxStaleTTL)) {
 							s.lruList.Remove(element)
 							delete(s.entries, key)
 						}
@@ -196,4 +544,4 @@ func (s *Shard) cleanup(interval time.Duration, stop <-chan struct{}) {
 			return
 		}
 	}
-}
\ No newline at end of file
+}
@@ -2,6 +2,7 @@ package cache_test
 
 import (
 	"dns-resolver/internal/cache"
+	"sync"
 	"testing"
 	"time"
 
@@ -10,13 +11,13 @@ import (
 
 func TestCacheSetGet(t *testing.T) {
 	config := cache.CacheConfig{MaxEntries: 10}
-	cache := cache.NewShardedCache(1, 1*time.Minute, config)
+	sc := cache.NewShardedCache(1, 1*time.Minute, config)
 
 	msg := new(dns.Msg)
 	msg.SetQuestion("example.com.", dns.TypeA)
-	cache.Set("key1", msg, 1*time.Minute, false, true)
+	sc.Set(cache.CacheKey{Qname: "key1"}, msg, 1*time.Minute, false, true)
 
-	retrievedMsg, found, isNegative, isValidated := cache.Get("key1")
+	retrievedMsg, found, isNegative, isValidated, _, _ := sc.Get(cache.CacheKey{Qname: "key1"})
 	if !found {
 		t.Fatal("Expected to find key1 in cache")
 	}
@@ -33,58 +34,199 @@ func TestCacheSetGet(t *testing.T) {
 
 func TestCacheEviction(t *testing.T) {
 	config := cache.CacheConfig{MaxEntries: 2}
-	cache := cache.NewShardedCache(1, 1*time.Minute, config)
+	sc := cache.NewShardedCache(1, 1*time.Minute, config)
 
 	msg1 := new(dns.Msg)
 	msg1.SetQuestion("example1.com.", dns.TypeA)
-	cache.Set("key1", msg1, 1*time.Minute, false, false)
+	sc.Set(cache.CacheKey{Qname: "key1"}, msg1, 1*time.Minute, false, false)
 
 	msg2 := new(dns.Msg)
 	msg2.SetQuestion("example2.com.", dns.TypeA)
-	cache.Set("key2", msg2, 1*time.Minute, false, false)
+	sc.Set(cache.CacheKey{Qname: "key2"}, msg2, 1*time.Minute, false, false)
 
 	// Access key1 to make it the most recently used, so key2 is the LRU
-	cache.Get("key1")
+	sc.Get(cache.CacheKey{Qname: "key1"})
 
 	// Add a third key, which should evict key2
 	msg3 := new(dns.Msg)
 	msg3.SetQuestion("example3.com.", dns.TypeA)
-	cache.Set("key3", msg3, 1*time.Minute, false, false)
+	sc.Set(cache.CacheKey{Qname: "key3"}, msg3, 1*time.Minute, false, false)
 
 	// Check that key2 is evicted
-	_, found, _, _ := cache.Get("key2")
+	_, found, _, _, _, _ := sc.Get(cache.CacheKey{Qname: "key2"})
 	if found {
 		t.Error("Expected key2 to be evicted from the cache")
 	}
 
 	// Check that key1 and key3 are still there
-	_, found, _, _ = cache.Get("key1")
+	_, found, _, _, _, _ = sc.Get(cache.CacheKey{Qname: "key1"})
 	if !found {
 		t.Error("Expected key1 to be in the cache")
 	}
-	_, found, _, _ = cache.Get("key3")
+	_, found, _, _, _, _ = sc.Get(cache.CacheKey{Qname: "key3"})
 	if !found {
 		t.Error("Expected key3 to be in the cache")
 	}
 }
 
+func TestCacheKeySegregatesByCheckingDisabled(t *testing.T) {
+	config := cache.CacheConfig{MaxEntries: 10}
+	sc := cache.NewShardedCache(1, 1*time.Minute, config)
+
+	msg := new(dns.Msg)
+	msg.SetQuestion("example.com.", dns.TypeA)
+
+	cdKey := cache.CacheKey{Qname: "example.com.", Qtype: dns.TypeA, CD: true}
+	sc.Set(cdKey, msg, 1*time.Minute, false, false)
+
+	// A CD=1 entry (possibly unvalidated) must never be served to a CD=0
+	// query, and an absent CD=0 entry must not fall back to it either.
+	nonCDKey := cache.CacheKey{Qname: "example.com.", Qtype: dns.TypeA, CD: false}
+	if _, found, _, _, _, _ := sc.Get(nonCDKey); found {
+		t.Error("CD=1 entry must not be served to a CD=0 query")
+	}
+
+	// And the reverse: a CD=0 (validated) entry must not answer a CD=1 query.
+	sc.Set(nonCDKey, msg, 1*time.Minute, false, true)
+	if _, found, _, _, _, _ := sc.Get(cdKey); !found {
+		t.Error("expected the earlier CD=1 entry to still be present under its own key")
+	}
+
+	otherCDKey := cache.CacheKey{Qname: "other.com.", Qtype: dns.TypeA, CD: true}
+	if _, found, _, _, _, _ := sc.Get(otherCDKey); found {
+		t.Error("unrelated CD=1 query must not hit the CD=0 entry")
+	}
+}
+
+func TestCacheKeySegregatesByDOAndCDCombinations(t *testing.T) {
+	config := cache.CacheConfig{MaxEntries: 10}
+	sc := cache.NewShardedCache(1, 1*time.Minute, config)
+
+	msg := new(dns.Msg)
+	msg.SetQuestion("example.com.", dns.TypeA)
+
+	combos := []struct{ do, cd bool }{
+		{false, false},
+		{false, true},
+		{true, false},
+		{true, true},
+	}
+	for _, c := range combos {
+		key := cache.CacheKey{Qname: "example.com.", Qtype: dns.TypeA, Qclass: dns.ClassINET, DO: c.do, CD: c.cd}
+		sc.Set(key, msg, 1*time.Minute, false, true)
+	}
+
+	for _, c := range combos {
+		key := cache.CacheKey{Qname: "example.com.", Qtype: dns.TypeA, Qclass: dns.ClassINET, DO: c.do, CD: c.cd}
+		if _, found, _, _, _, _ := sc.Get(key); !found {
+			t.Errorf("expected do=%t cd=%t to hit its own entry", c.do, c.cd)
+		}
+		for _, other := range combos {
+			if other == c {
+				continue
+			}
+			otherKey := cache.CacheKey{Qname: "other.com.", Qtype: dns.TypeA, Qclass: dns.ClassINET, DO: other.do, CD: other.cd}
+			sc.Set(otherKey, msg, 1*time.Minute, false, true)
+		}
+	}
+
+	// Every combination must resolve to a distinct key for the same question.
+	seen := make(map[string]struct{})
+	for _, c := range combos {
+		key := cache.CacheKey{Qname: "example.com.", Qtype: dns.TypeA, Qclass: dns.ClassINET, DO: c.do, CD: c.cd}
+		if _, dup := seen[key.String()]; dup {
+			t.Errorf("do=%t cd=%t produced a duplicate cache key", c.do, c.cd)
+		}
+		seen[key.String()] = struct{}{}
+	}
+}
+
+func TestCacheKeySegregatesByQclass(t *testing.T) {
+	config := cache.CacheConfig{MaxEntries: 10}
+	sc := cache.NewShardedCache(1, 1*time.Minute, config)
+
+	inMsg := new(dns.Msg)
+	inMsg.SetQuestion("version.bind.", dns.TypeTXT)
+	inKey := cache.CacheKey{Qname: "version.bind.", Qtype: dns.TypeTXT, Qclass: dns.ClassINET}
+	sc.Set(inKey, inMsg, 1*time.Minute, false, true)
+
+	chaosMsg := new(dns.Msg)
+	chaosMsg.SetQuestion("version.bind.", dns.TypeTXT)
+	chaosKey := cache.CacheKey{Qname: "version.bind.", Qtype: dns.TypeTXT, Qclass: dns.ClassCHAOS}
+	if _, found, _, _, _, _ := sc.Get(chaosKey); found {
+		t.Error("an IN-class entry must not answer a CHAOS-class query for the same name/type")
+	}
+	sc.Set(chaosKey, chaosMsg, 1*time.Minute, false, true)
+
+	if _, found, _, _, _, _ := sc.Get(inKey); !found {
+		t.Error("expected the earlier IN-class entry to still be present under its own key")
+	}
+	if _, found, _, _, _, _ := sc.Get(chaosKey); !found {
+		t.Error("expected the CHAOS-class entry to be retrievable under its own key")
+	}
+}
+
 func TestCacheExpiration(t *testing.T) {
 	config := cache.CacheConfig{MaxEntries: 10}
-	cache := cache.NewShardedCache(1, 5*time.Millisecond, config)
+	sc := cache.NewShardedCache(1, 5*time.Millisecond, config)
 
 	msg := new(dns.Msg)
 	msg.SetQuestion("example.com.", dns.TypeA)
-	cache.Set("key1", msg, 1*time.Millisecond, false, true)
+	sc.Set(cache.CacheKey{Qname: "key1"}, msg, 1*time.Millisecond, false, true)
 
-	_, found, _, _ := cache.Get("key1")
+	_, found, _, _, _, _ := sc.Get(cache.CacheKey{Qname: "key1"})
 	if !found {
 		t.Fatal("Expected to find key1 immediately after setting")
 	}
 
 	time.Sleep(10 * time.Millisecond)
 
-	_, found, _, _ = cache.Get("key1")
+	_, found, _, _, _, _ = sc.Get(cache.CacheKey{Qname: "key1"})
 	if found {
 		t.Error("Expected key1 to be expired and not found")
 	}
 }
+
+func TestPrefetchScheduledForHotEntryNearExpiry(t *testing.T) {
+	config := cache.CacheConfig{
+		MaxEntries:           10,
+		PrefetchingEnabled:   true,
+		PrefetchMinHits:      1,
+		PrefetchThresholdPct: 0.9,
+		PrefetchWorkers:      1,
+	}
+	sc := cache.NewShardedCache(1, 1*time.Minute, config)
+
+	var mu sync.Mutex
+	var prefetched cache.CacheKey
+	done := make(chan struct{}, 1)
+	sc.SetPrefetchCallback(func(key cache.CacheKey, msg *dns.Msg) error {
+		mu.Lock()
+		prefetched = key
+		mu.Unlock()
+		done <- struct{}{}
+		return nil
+	})
+
+	msg := new(dns.Msg)
+	msg.SetQuestion("hot.example.com.", dns.TypeA)
+	key := cache.CacheKey{Qname: "hot.example.com.", Qtype: dns.TypeA}
+	sc.Set(key, msg, 50*time.Millisecond, false, true)
+
+	// Let enough of the TTL elapse that the remaining fraction drops below
+	// PrefetchThresholdPct, then hit it once to cross PrefetchMinHits.
+	time.Sleep(10 * time.Millisecond)
+	sc.Get(key)
+
+	select {
+	case <-done:
+	case <-time.After(1 * time.Second):
+		t.Fatal("expected prefetch callback to run for a hot, near-expiry entry")
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if prefetched != key {
+		t.Errorf("expected prefetch callback for %v, got %v", key, prefetched)
+	}
+}
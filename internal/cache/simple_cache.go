@@ -20,12 +20,15 @@ func NewSimpleCache() *SimpleCache {
 	}
 }
 
-// Get retrieves a message from the cache.
-func (c *SimpleCache) Get(zone string, question dns.Question) (*dns.Msg, error) {
+// Get retrieves a message from the cache. do and cd are the DO and CD bits
+// of the request, which are part of the key so that a response cached for
+// one combination of those bits is never handed to a client that sent the
+// other.
+func (c *SimpleCache) Get(zone string, question dns.Question, do, cd bool) (*dns.Msg, error) {
 	c.mu.RLock()
 	defer c.mu.RUnlock()
 
-	key := c.key(zone, question)
+	key := c.key(zone, question, do, cd)
 	msg, found := c.store[key]
 	if found {
 		// Return a copy to prevent race conditions
@@ -35,17 +38,24 @@ func (c *SimpleCache) Get(zone string, question dns.Question) (*dns.Msg, error)
 }
 
 // Update adds or updates a message in the cache.
-func (c *SimpleCache) Update(zone string, question dns.Question, msg *dns.Msg) error {
+func (c *SimpleCache) Update(zone string, question dns.Question, msg *dns.Msg, do, cd bool) error {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
-	key := c.key(zone, question)
+	if msg.Truncated {
+		// A truncated response is incomplete; never let it poison the cache
+		// for a subsequent query that might get the full answer.
+		return nil
+	}
+
+	key := c.key(zone, question, do, cd)
 	// Store a copy to prevent race conditions
 	c.store[key] = msg.Copy()
 	return nil
 }
 
-// key generates a unique cache key for a zone and question.
-func (c *SimpleCache) key(zone string, q dns.Question) string {
-	return fmt.Sprintf("%s:%s:%d:%d", zone, q.Name, q.Qtype, q.Qclass)
+// key generates a unique cache key for a zone, question, and the request's
+// DO/CD bits.
+func (c *SimpleCache) key(zone string, q dns.Question, do, cd bool) string {
+	return fmt.Sprintf("%s:%s:%d:%d:%t:%t", zone, q.Name, q.Qtype, q.Qclass, do, cd)
 }
@@ -0,0 +1,169 @@
+package cache
+
+// cmsDepth is the number of independent hash rows in a countMinSketch.
+const cmsDepth = 4
+
+// cmsMaxCounter is the ceiling a count-min sketch counter saturates at; each
+// counter is packed into 4 bits, so 15 is the largest value it can hold.
+const cmsMaxCounter = 15
+
+// countMinSketch is a small, fixed-width frequency estimator: Add increments
+// the 4-bit counter at one hash position per row, and Estimate returns the
+// minimum across rows, the standard count-min recipe, which only ever
+// overestimates a key's true frequency due to hash collisions, never
+// underestimates it. Counters are packed two-per-byte to keep the sketch
+// cheap relative to the cache it guards.
+type countMinSketch struct {
+	rows    [cmsDepth][]byte
+	width   uint32
+	inserts uint64
+	resetAt uint64
+}
+
+// newCountMinSketch returns a sketch sized for capacity items, with a width
+// of roughly 10x capacity as recommended for W-TinyLFU's target false-positive
+// rate, and configured to age (halve) its counters every capacity inserts.
+func newCountMinSketch(capacity int) *countMinSketch {
+	width := uint32(capacity * 10)
+	if width == 0 {
+		width = 16
+	}
+	resetAt := uint64(capacity)
+	if resetAt == 0 {
+		resetAt = 1
+	}
+
+	sketch := &countMinSketch{width: width, resetAt: resetAt}
+	for row := range sketch.rows {
+		sketch.rows[row] = make([]byte, (width+1)/2)
+	}
+	return sketch
+}
+
+// indexFor computes the hash position row uses for key, via double hashing
+// (h1 + row*h2) off two independent FNV variants, rather than carrying
+// cmsDepth distinct hash functions.
+func (c *countMinSketch) indexFor(row int, key string) uint32 {
+	return (fnv32(key) + uint32(row)*fnv32a(key)) % c.width
+}
+
+// Add records one observation of key, aging the sketch once it has seen
+// resetAt inserts since the last aging, and reports whether this call
+// triggered that aging.
+func (c *countMinSketch) Add(key string) (aged bool) {
+	for row := 0; row < cmsDepth; row++ {
+		idx := c.indexFor(row, key)
+		if v := getNibble(c.rows[row], idx); v < cmsMaxCounter {
+			setNibble(c.rows[row], idx, v+1)
+		}
+	}
+
+	c.inserts++
+	if c.inserts >= c.resetAt {
+		c.age()
+		return true
+	}
+	return false
+}
+
+// Estimate returns key's estimated access frequency.
+func (c *countMinSketch) Estimate(key string) byte {
+	min := byte(cmsMaxCounter)
+	for row := 0; row < cmsDepth; row++ {
+		if v := getNibble(c.rows[row], c.indexFor(row, key)); v < min {
+			min = v
+		}
+	}
+	return min
+}
+
+// age halves every counter, so the sketch tracks recent traffic instead of
+// saturating toward cmsMaxCounter as more keys are ever seen.
+func (c *countMinSketch) age() {
+	for row := range c.rows {
+		for i, b := range c.rows[row] {
+			lo := b & 0x0F
+			hi := b >> 4
+			c.rows[row][i] = (lo / 2) | ((hi / 2) << 4)
+		}
+	}
+	c.inserts = 0
+}
+
+// getNibble reads the idx'th 4-bit counter out of a nibble-packed byte slice.
+func getNibble(b []byte, idx uint32) byte {
+	v := b[idx/2]
+	if idx%2 == 0 {
+		return v & 0x0F
+	}
+	return v >> 4
+}
+
+// setNibble writes the idx'th 4-bit counter into a nibble-packed byte slice.
+func setNibble(b []byte, idx uint32, v byte) {
+	i := idx / 2
+	if idx%2 == 0 {
+		b[i] = (b[i] & 0xF0) | (v & 0x0F)
+	} else {
+		b[i] = (b[i] & 0x0F) | (v << 4)
+	}
+}
+
+// doorkeeper is a small Bloom filter that guards countMinSketch against
+// one-hit-wonders: a key's first-ever sighting only sets its doorkeeper
+// bits, so it never touches the sketch at all; only a key seen a second
+// time (already present in the doorkeeper) gets counted. It's cleared
+// whenever the sketch it guards ages.
+type doorkeeper struct {
+	bits []byte
+	size uint32
+}
+
+// newDoorkeeper returns a doorkeeper sized for capacity items, matching
+// countMinSketch's width-to-capacity ratio.
+func newDoorkeeper(capacity int) *doorkeeper {
+	size := uint32(capacity * 10)
+	if size == 0 {
+		size = 16
+	}
+	return &doorkeeper{bits: make([]byte, (size+7)/8), size: size}
+}
+
+// testAndSet reports whether key was already present, then sets its bits
+// regardless, so a repeat call always observes true.
+func (d *doorkeeper) testAndSet(key string) bool {
+	i1 := fnv32(key) % d.size
+	i2 := fnv32a(key) % d.size
+	present := d.get(i1) && d.get(i2)
+	d.set(i1)
+	d.set(i2)
+	return present
+}
+
+func (d *doorkeeper) get(idx uint32) bool {
+	return d.bits[idx/8]&(1<<(idx%8)) != 0
+}
+
+func (d *doorkeeper) set(idx uint32) {
+	d.bits[idx/8] |= 1 << (idx % 8)
+}
+
+// reset clears every bit, discarding the doorkeeper's record of what it's
+// seen so far.
+func (d *doorkeeper) reset() {
+	for i := range d.bits {
+		d.bits[i] = 0
+	}
+}
+
+// fnv32a is FNV-1a, used alongside fnv32 (plain FNV-1) as a second,
+// independent hash for countMinSketch/doorkeeper's double hashing, without
+// pulling in a hashing dependency for a second, unrelated algorithm.
+func fnv32a(key string) uint32 {
+	hash := uint32(2166136261)
+	for i := 0; i < len(key); i++ {
+		hash ^= uint32(key[i])
+		hash *= 16777619
+	}
+	return hash
+}
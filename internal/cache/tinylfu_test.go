@@ -0,0 +1,68 @@
+package cache
+
+import "testing"
+
+func TestCountMinSketch_EstimateIncreasesWithAdds(t *testing.T) {
+	s := newCountMinSketch(100)
+
+	if got := s.Estimate("hot"); got != 0 {
+		t.Fatalf("expected 0 for an unseen key, got %d", got)
+	}
+
+	s.Add("hot")
+	s.Add("hot")
+	s.Add("hot")
+
+	if got := s.Estimate("hot"); got != 3 {
+		t.Fatalf("expected estimate of 3 after 3 adds, got %d", got)
+	}
+	if got := s.Estimate("cold"); got != 0 {
+		t.Fatalf("expected 0 for a key never added, got %d", got)
+	}
+}
+
+func TestCountMinSketch_CounterSaturatesAtMax(t *testing.T) {
+	s := newCountMinSketch(100)
+	for i := 0; i < cmsMaxCounter+10; i++ {
+		s.Add("hot")
+	}
+	if got := s.Estimate("hot"); got != cmsMaxCounter {
+		t.Fatalf("expected counter to saturate at %d, got %d", cmsMaxCounter, got)
+	}
+}
+
+func TestCountMinSketch_AgesAfterCapacityInserts(t *testing.T) {
+	s := newCountMinSketch(4) // resetAt == 4
+	s.Add("hot")
+	s.Add("hot")
+	if got := s.Estimate("hot"); got != 2 {
+		t.Fatalf("expected estimate of 2 before aging, got %d", got)
+	}
+
+	if aged := s.Add("a"); aged {
+		t.Fatal("aging shouldn't trigger on the 3rd insert")
+	}
+	if aged := s.Add("b"); !aged {
+		t.Fatal("expected aging to trigger on the 4th insert")
+	}
+
+	if got := s.Estimate("hot"); got != 1 {
+		t.Fatalf("expected estimate to halve to 1 after aging, got %d", got)
+	}
+}
+
+func TestDoorkeeper_TestAndSet(t *testing.T) {
+	d := newDoorkeeper(100)
+
+	if d.testAndSet("key") {
+		t.Fatal("a key's first sighting must not already be present")
+	}
+	if !d.testAndSet("key") {
+		t.Fatal("a key's second sighting must be reported as present")
+	}
+
+	d.reset()
+	if d.testAndSet("key") {
+		t.Fatal("reset must clear prior sightings")
+	}
+}
@@ -2,60 +2,485 @@ package config
 
 import (
 	"encoding/json"
+	"fmt"
 	"os"
 	"time"
 )
 
 // Config holds the configuration for the DNS resolver.
 type Config struct {
-	ListenAddr           string
-	MetricsAddr          string
-	PrometheusEnabled    bool
-	PrometheusNamespace  string
-	UpstreamTimeout      time.Duration
-	RequestTimeout       time.Duration
-	MaxWorkers           int
-	CacheSize            int
-	MessageCacheSize     int
-	RRsetCacheSize       int
-	CacheMaxTTL          time.Duration
-	CacheMinTTL          time.Duration
-	StaleWhileRevalidate time.Duration
-	LMDBPath             string
-	ResolverType         string // "unbound" or "knot"
-	ServerRole           string // "master", "slave", or "standalone"
-	MasterAPIEndpoint    string
-	MasterAPIKey         string
-	SlaveAPIKey          string
-	SyncInterval         time.Duration
+	// SchemaVersion is the config.json schema version this Config was
+	// migrated to. LoadConfig stamps it at CurrentSchemaVersion; a
+	// config.json missing it (or declaring an older one) is migrated
+	// forward automatically, see migrate.go.
+	SchemaVersion           int
+	ListenAddr              string
+	MetricsAddr             string
+	PrometheusEnabled       bool
+	PrometheusNamespace     string
+	UpstreamTimeout         time.Duration
+	RequestTimeout          time.Duration
+	MaxWorkers              int
+	MaxWorkerQueueDepth     int // depth of the workerpool.Pool queue backing Job-based submissions (TrySubmit/SubmitContext)
+	CacheSize               int
+	MessageCacheSize        int
+	RRsetCacheSize          int
+	CacheMaxTTL             time.Duration
+	CacheMinTTL             time.Duration
+	StaleWhileRevalidate    time.Duration
+	PrefetchInterval        time.Duration
+	CacheStaleTTL           time.Duration
+	CachePrefetchThreshold  time.Duration
+	CachePrefetchMinHits    int64
+	CachePrefetchPercentage float64 // fraction of original TTL remaining at which a hot key becomes eligible for prefetch
+	DoHAddr                 string  // listen address for the DNS-over-HTTPS frontend; empty disables it
+	DoHPath                 string  // URL path the DoH handler is mounted at; defaults to "/dns-query" if empty
+	DoHCertFile             string
+	DoHKeyFile              string
+	DoHClientCAFile         string // optional; enables mTLS client auth when set
+	DoH3Enabled             bool   // also serve DoH over HTTP/3 (requires building with -tags=http3)
+	// DoHAutocertEnabled sources the DoH/DoT TLS certificate from ACME
+	// (e.g. Let's Encrypt) via golang.org/x/crypto/acme/autocert instead of
+	// DoHCertFile/DoHKeyFile, renewing automatically in the background so a
+	// certificate rotation never requires a listener restart.
+	// DoHAutocertDomains must be set when this is enabled.
+	DoHAutocertEnabled  bool
+	DoHAutocertDomains  []string
+	DoHAutocertCacheDir string // directory autocert persists issued certificates/keys to across restarts
+	// DoTAddr is the listen address for the DNS-over-TLS (RFC 7858)
+	// frontend; empty disables it. It reuses the DoH listener's certificate
+	// configuration (DoHCertFile/DoHKeyFile, or autocert when enabled).
+	DoTAddr string
+	// ShutdownTimeout bounds how long Server.Shutdown waits for in-flight
+	// queries to finish on every listener before forcing them closed.
+	ShutdownTimeout   time.Duration
+	LMDBPath          string
+	ResolverType      string // "unbound" or "knot"
+	ServerRole        string // "master", "slave", or "standalone"
+	MasterAPIEndpoint string
+	MasterAPIKey      string
+	SlaveAPIKey       string
+	SyncInterval      time.Duration
+	RejectedTTL       time.Duration // default TTL for RejectedResponseCache entries
+	RejectedCachePath string        // file the RejectedResponseCache persists to on shutdown
+	FakeIPEnabled     bool          // synthesize fake IPs for FakeIPDomains instead of resolving them upstream
+	FakeIPRange4      string        // CIDR fake A records are allocated from, e.g. "198.18.0.0/15"
+	FakeIPRange6      string        // CIDR fake AAAA records are allocated from
+	FakeIPDomains     []string      // suffix-matched domains eligible for fake-IP synthesis
+	FakeIPTTL         time.Duration // TTL of a fake-IP mapping; expiry frees the IP for reallocation
+	FakeIPCachePath   string        // file the fake-IP reverse map persists to on shutdown
+	// Upstreams is the ordered list of upstream servers the stub backend
+	// dials, each written as a scheme-prefixed address: "udp://9.9.9.9:53",
+	// "tcp://9.9.9.9:53", "tls://1.1.1.1:853", "https://dns.quad9.net/dns-query",
+	// or "quic://1.1.1.1:853" (DNS-over-QUIC, RFC 9250; requires building
+	// with -tags=quic). On Exchange failure or SERVFAIL the stub backend
+	// fails over to the next entry.
+	Upstreams            []string
+	UpstreamUDPTimeout   time.Duration // dial/exchange timeout for udp:// upstreams
+	UpstreamTCPTimeout   time.Duration // dial/exchange timeout for tcp:// upstreams
+	UpstreamTLSTimeout   time.Duration // dial/exchange timeout for tls:// (DoT) upstreams
+	UpstreamHTTPSTimeout time.Duration // request timeout for https:// (DoH) upstreams
+	// BootstrapDNS lists plain "host:port" DNS servers used to resolve a
+	// hostname-only tls://, https://, or quic:// upstream before any user
+	// query arrives, so the stub backend doesn't circularly depend on
+	// itself to resolve its own upstreams. Tried in order; the result is
+	// cached and re-resolved once its A record's TTL expires, so an
+	// upstream that rotates IPs over time is picked up without a restart.
+	BootstrapDNS           []string
+	UpstreamTLSIdleTimeout time.Duration // a tls:// upstream's persistent connection is closed and redialed if idle longer than this
+
+	// DNSSECRootTrustAnchors overrides the compiled-in IANA root trust
+	// anchor (KSK-2017/KSK-2024) for the "validating" backend, each entry a
+	// zone-file format DS record for the root zone, e.g.
+	// ". IN DS 20326 8 2 E06D44B80B8F1D39A95C0B0D7C65D08458E880409BBC683457104237C7F8EC8".
+	// Empty uses the compiled-in defaults.
+	DNSSECRootTrustAnchors []string
+
+	// AggressiveNSEC enables RFC 8198 aggressive use of DNSSEC-validated
+	// denial of existence: NsecCache/NSEC3Cache may answer a query for an
+	// uncached name directly from a cached NSEC/NSEC3 record that provably
+	// covers it (or its closest-encloser wildcard), without a round trip
+	// upstream. Only proofs cached from a response with the AD bit set are
+	// ever used this way.
+	AggressiveNSEC bool
+
+	// ECSEnabled attaches an EDNS Client Subnet (RFC 7871) option, built
+	// from the querying client's own source address, to outgoing queries
+	// the stub/kres/unbound backends send upstream.
+	ECSEnabled bool
+	// ECSPrefixV4 and ECSPrefixV6 are the source prefix lengths sent in the
+	// ECS option for IPv4 and IPv6 clients, respectively.
+	ECSPrefixV4 int
+	ECSPrefixV6 int
+	// ECSAllowlist restricts ECS to the listed zones/domains (suffix
+	// matched, e.g. "example.com."); empty means attach ECS to every
+	// upstream query.
+	ECSAllowlist []string
+
+	// RootHints overrides the compiled-in IANA root server address list
+	// (each entry "ip:port") used by the "iterative" backend to start its
+	// walk from the root. Empty uses the compiled-in defaults.
+	RootHints []string
+	// IterativeMaxConcurrency bounds how many upstream queries the
+	// "iterative" backend may have in flight at once across all of a
+	// single client query's referral/CNAME/glue resolution. Zero uses a
+	// built-in default.
+	IterativeMaxConcurrency int
+	// IterativeQueryTimeout bounds each individual upstream query the
+	// "iterative" backend sends while walking a referral chain. Zero uses
+	// a built-in default.
+	IterativeQueryTimeout time.Duration
+	// QNAMEMinimizationDisabled turns off RFC 7816 QNAME minimization in
+	// the "iterative" backend, sending the full query name to every
+	// server in the referral chain instead of just the next label. Off by
+	// default; minimization is on unless this is set.
+	QNAMEMinimizationDisabled bool
+
+	// UpstreamStrategy selects how the "parallel_best" backend picks among
+	// ParallelBestBackends for each query. Empty behaves like
+	// UpstreamStrategySingle.
+	UpstreamStrategy UpstreamStrategy
+	// ParallelBestBackends lists the registered interfaces.Backend names
+	// (e.g. "stub", "unbound", "kres") the "parallel_best" backend races
+	// against each other. Needs at least two entries to have any effect.
+	ParallelBestBackends []string
+	// FailoverBackends lists the registered interfaces.Backend names the
+	// "failover" backend tries in order, moving on to the next one when
+	// the current one errors, answers too slowly, or its circuit breaker
+	// is currently open. Needs at least two entries to have any effect.
+	FailoverBackends []string
+
+	// BackendName selects which registered interfaces.Backend backend.New
+	// constructs, e.g. "stub", "unbound", "kres", "multi". Empty falls back
+	// to the ASTRACAT_BACKEND environment variable, then "stub".
+	BackendName string
+	// MultiBackendZones maps a zone suffix (FQDN, trailing dot optional) to
+	// the registered backend name that should answer queries under it. The
+	// "multi" backend matches by longest suffix, the same precedence
+	// authoritative zone lookups use.
+	MultiBackendZones map[string]string
+	// MultiBackendDefault is the registered backend name the "multi"
+	// backend forwards to when no entry in MultiBackendZones matches, e.g.
+	// "unbound" for a recursive fallback alongside local authoritative
+	// zones.
+	MultiBackendDefault string
+
+	// AuthoritativeZoneFile is the JSON zone store path the "authoritative"
+	// backend loads at startup and persists changes to. Empty keeps zones
+	// in memory only, same as passing "" to authoritative.New directly.
+	AuthoritativeZoneFile string
+
+	// QueryLogEnabled turns on the query_logger plugin's structured,
+	// per-query JSON log.
+	QueryLogEnabled bool
+	// QueryLogSink selects where log entries are written: "stdout",
+	// "file", "syslog", or "udp"/"tcp" for a remote line-protocol
+	// shipper. Defaults to "stdout".
+	QueryLogSink string
+	// QueryLogPath is the file path used by the "file" sink.
+	QueryLogPath string
+	// QueryLogMaxSizeMB rotates the "file" sink once its current file
+	// reaches this size. Zero disables size-based rotation.
+	QueryLogMaxSizeMB int
+	// QueryLogMaxAge rotates the "file" sink once its current file has
+	// been open this long. Zero disables time-based rotation.
+	QueryLogMaxAge time.Duration
+	// QueryLogShipAddr is the "host:port" a "udp" or "tcp" sink connects
+	// to, shipping one JSON line per query.
+	QueryLogShipAddr string
+	// QueryLogPIIMode controls how the query_logger plugin records the
+	// querying client's address: "" / "none" logs it verbatim, "hash"
+	// replaces it with a truncated SHA-256 digest, and "truncate" zeroes
+	// out the host bits (/24 for IPv4, /48 for IPv6), the same
+	// granularity as ECS.
+	QueryLogPIIMode string
+	// QueryLogBufferSize bounds the in-memory queue of log entries
+	// awaiting a write to the configured sink. Once full, the oldest
+	// queued entry is dropped to make room rather than blocking query
+	// handling. Zero uses a built-in default.
+	QueryLogBufferSize int
+
+	// ConditionalUpstreamMap maps a zone suffix (FQDN, trailing dot
+	// optional, case-insensitive) to the plain "host:port" upstream
+	// server(s) that should answer queries under it, selected by
+	// longest-suffix match. The root suffix "." is the catch-all default;
+	// a query under no more specific suffix falls through to whatever "."
+	// maps to, or to the resolver.ConditionalUpstreamResolver's own
+	// fallback if "." isn't listed either.
+	ConditionalUpstreamMap map[string][]string
+	// ConditionalUpstreamTimeout bounds each upstream exchange a
+	// resolver.ConditionalUpstreamResolver route makes. Zero uses a
+	// built-in default.
+	ConditionalUpstreamTimeout time.Duration
+
+	// QueryLoggingEnabled turns on the query_logging plugin's structured,
+	// per-query log (timestamp, client address, QNAME/QTYPE, rcode, answer
+	// count, resolution duration, upstream, cache status, DNSSEC AD bit).
+	// It is independent of the older QueryLog* fields, which configure the
+	// separate query_logger plugin.
+	QueryLoggingEnabled bool
+	// QueryLoggingSink selects where entries are written: "stdout"
+	// (newline-delimited JSON), "csv" (daily-rotated CSV files under
+	// QueryLoggingDir), "sqlite" (batched writes to a
+	// QueryLoggingDir-sharded-by-date SQLite file), "jsonl" (size/age
+	// rotated, gzip-compressed NDJSON files under QueryLoggingDir), "ring"
+	// (an in-memory ring buffer queryable with richer filters, nothing
+	// persisted across a restart), or "otlp" (each entry exported as an
+	// OTLP/HTTP log record to QueryLoggingOTLPEndpoint). Defaults to
+	// "stdout".
+	QueryLoggingSink string
+	// QueryLoggingDir is the directory the "csv", "sqlite" and "jsonl"
+	// sinks write their files into.
+	QueryLoggingDir string
+	// QueryLoggingRetentionDays prunes a "csv" or "sqlite" sink's files
+	// older than this many days on every daily rotation. Zero disables
+	// pruning.
+	QueryLoggingRetentionDays int
+	// QueryLoggingSQLiteDriver names the database/sql driver the "sqlite"
+	// sink opens each day's shard with, e.g. "sqlite3"; this package
+	// depends on database/sql alone, not a specific driver, so the chosen
+	// one must be registered elsewhere via its own blank import.
+	QueryLoggingSQLiteDriver string
+	// QueryLoggingAnonymizationLevel controls how the query_logging
+	// plugin records the querying client's address: "" / "none" logs it
+	// verbatim, "hash" replaces it with a truncated SHA-256 digest, and
+	// "truncate" zeroes out the host bits (/24 for IPv4, /48 for IPv6).
+	QueryLoggingAnonymizationLevel string
+	// QueryLoggingBufferSize bounds the in-memory queue of log entries
+	// awaiting a write to the configured sink. Once full, the oldest
+	// queued entry is dropped to make room rather than blocking query
+	// handling. Zero uses a built-in default.
+	QueryLoggingBufferSize int
+	// QueryLoggingJSONLMaxSizeMB rotates the "jsonl" sink's current file
+	// once it reaches this size. Zero uses a built-in default.
+	QueryLoggingJSONLMaxSizeMB int
+	// QueryLoggingJSONLMaxAge rotates the "jsonl" sink's current file once
+	// it has been open this long, regardless of size. Zero uses a
+	// built-in default.
+	QueryLoggingJSONLMaxAge time.Duration
+	// QueryLoggingRingCapacity bounds how many entries the "ring" sink
+	// keeps in memory before it starts overwriting the oldest ones. Zero
+	// uses a built-in default.
+	QueryLoggingRingCapacity int
+	// QueryLoggingOTLPEndpoint is the OTLP/HTTP logs collector URL the
+	// "otlp" sink POSTs each entry to, e.g.
+	// "http://localhost:4318/v1/logs".
+	QueryLoggingOTLPEndpoint string
+
+	// DnstapEnabled turns on dnstap (https://dnstap.info) event emission: a
+	// Frame Streams-framed, protobuf-encoded record for every CLIENT_QUERY,
+	// CLIENT_RESPONSE, RESOLVER_QUERY, RESOLVER_RESPONSE, and this
+	// resolver's own CACHE_HIT/CACHE_MISS extension, streamed to DnstapSink
+	// for an external collector to replay or index.
+	DnstapEnabled bool
+	// DnstapSink selects the transport: "unix" (DnstapSocketPath), "tcp"
+	// (DnstapTCPAddr), or "file" (DnstapFilePath, rotated by
+	// DnstapFileMaxSizeMB/DnstapFileMaxAge).
+	DnstapSink string
+	// DnstapSocketPath is the unix domain socket path a "unix" sink
+	// connects to.
+	DnstapSocketPath string
+	// DnstapTCPAddr is the "host:port" a "tcp" sink connects to.
+	DnstapTCPAddr string
+	// DnstapFilePath is the file a "file" sink appends Frame Streams-framed
+	// records to.
+	DnstapFilePath string
+	// DnstapFileMaxSizeMB rotates the "file" sink once its current file
+	// reaches this size. Zero disables size-based rotation.
+	DnstapFileMaxSizeMB int
+	// DnstapFileMaxAge rotates the "file" sink once its current file has
+	// been open this long. Zero disables time-based rotation.
+	DnstapFileMaxAge time.Duration
+	// DnstapIdentity and DnstapVersion are stamped into every emitted
+	// frame's envelope so a collector aggregating multiple resolvers can
+	// tell them apart. Empty defaults to "astracat-resolver"/"dns-resolver".
+	DnstapIdentity string
+	DnstapVersion  string
+
+	// LogFormat selects the handler internal/logging.New builds for the
+	// metrics and cache packages' background-loop logging: "json" for
+	// slog.JSONHandler, anything else (including empty) for
+	// slog.TextHandler.
+	LogFormat string
+	// LogDedupWindow suppresses a repeated identical log message (same
+	// level, same text, same attrs) within this long of the first one, to
+	// protect against log storms from e.g. a prefetch failure repeating
+	// every cache miss during an upstream outage. Zero disables dedup.
+	LogDedupWindow time.Duration
+
+	// RemoteWriteEnabled turns on pushing every dns_resolver_* series to
+	// RemoteWriteURL via the Prometheus remote-write protocol, for
+	// short-lived POPs a central Prometheus can't scrape directly.
+	RemoteWriteEnabled bool
+	// RemoteWriteURL is the remote-write endpoint samples are POSTed to.
+	RemoteWriteURL string
+	// RemoteWriteBasicAuthUser/Pass, if RemoteWriteBasicAuthUser is set,
+	// authenticate each request with HTTP basic auth.
+	RemoteWriteBasicAuthUser string
+	RemoteWriteBasicAuthPass string
+	// RemoteWriteBearerToken, if set, authenticates each request with a
+	// "Bearer" Authorization header instead of basic auth.
+	RemoteWriteBearerToken string
+	// RemoteWriteTimeout bounds each remote-write HTTP request.
+	RemoteWriteTimeout time.Duration
+	// RemoteWriteFlushInterval bounds how long a shard's queue batches
+	// samples before sending regardless of RemoteWriteMaxSamplesPerSend.
+	RemoteWriteFlushInterval time.Duration
+	// RemoteWriteMaxSamplesPerSend caps how many samples go in one
+	// WriteRequest; a shard flushes early once it reaches this many.
+	RemoteWriteMaxSamplesPerSend int
+	// RemoteWriteQueueCapacity bounds each shard's in-memory sample queue;
+	// a shard drops the oldest queued sample once it's full rather than
+	// blocking the collector.
+	RemoteWriteQueueCapacity int
+
+	// NXDomainTrackingCapacity bounds how many distinct domains the
+	// top-NXDOMAIN tracker keeps counters for at once, via a Misra-Gries
+	// sketch, so a zone-walk attack against many distinct names can't grow
+	// the tracker without bound. Zero falls back to a built-in default.
+	NXDomainTrackingCapacity int
+
+	// UpstreamTransport selects the transport a resolver.DoHResolver-style
+	// upstream wrapper uses: "udp", "tcp", "doh", or "dot". This is
+	// separate from the scheme-prefixed entries in Upstreams (which the
+	// stub backend reads directly); it's read by callers that build a
+	// single-transport resolver.Upstream from DoHUpstream* below. Empty
+	// defaults to "udp".
+	UpstreamTransport string
+	// DoHUpstreamEndpoints lists the RFC 8484 DNS-over-HTTPS query URLs a
+	// resolver.DoHResolver exchanges against, e.g.
+	// "https://dns.quad9.net/dns-query". The first reachable endpoint
+	// answers each query; on a network error resolver.DoHResolver retries
+	// once against the next entry.
+	DoHUpstreamEndpoints []string
+	// DoHUpstreamServerName overrides the TLS ServerName (SNI and
+	// certificate verification hostname) used for every DoHUpstreamEndpoints
+	// entry. Empty uses each endpoint URL's own hostname.
+	DoHUpstreamServerName string
+	// DoHUpstreamClientCertFile and DoHUpstreamClientKeyFile optionally
+	// configure a client certificate for mTLS to the DoH endpoints. Both
+	// must be set together, or not at all.
+	DoHUpstreamClientCertFile string
+	DoHUpstreamClientKeyFile  string
+	// DoHUpstreamTimeout bounds each DoH request, including the retry.
+	// Zero uses a built-in default.
+	DoHUpstreamTimeout time.Duration
+
+	// DashboardAuthTokens lists the API tokens the dashboard's auth
+	// middleware accepts, replacing its previous hardcoded Basic Auth
+	// credential. Selectable alongside DashboardOIDCEnabled; both run if
+	// configured, in the order an incoming bearer credential is tried.
+	DashboardAuthTokens []DashboardAPIToken
+	// DashboardOIDCEnabled turns on the dashboard's OIDC bearer-token
+	// authenticator, verifying "Authorization: Bearer <JWT>" against
+	// DashboardOIDCIssuer's JWKS.
+	DashboardOIDCEnabled bool
+	// DashboardOIDCIssuer and DashboardOIDCAudience are the expected
+	// "iss"/"aud" claims of a verified token.
+	DashboardOIDCIssuer   string
+	DashboardOIDCAudience string
+	// DashboardOIDCJWKSURL is the issuer's JWKS endpoint, fetched to
+	// verify a token's RS256 signature.
+	DashboardOIDCJWKSURL string
+	// DashboardOIDCScopeClaim names the claim holding a space-delimited
+	// OAuth2 scope string, e.g. "scope". Empty disables scope-claim
+	// mapping.
+	DashboardOIDCScopeClaim string
+	// DashboardOIDCGroupsClaim names the claim holding the subject's
+	// group membership (a JSON array of strings), mapped to scopes via
+	// DashboardOIDCGroupScopeMap.
+	DashboardOIDCGroupsClaim string
+	// DashboardOIDCGroupScopeMap maps one group name to the scopes a
+	// token carrying it is granted.
+	DashboardOIDCGroupScopeMap map[string][]string
 }
 
+// DashboardAPIToken is one API token config.json grants the dashboard: ID
+// is the public identifier sent in the bearer credential
+// ("<ID>.<secret>"), HashedSecret is the bcrypt hash of the secret half
+// (see auth.HashTokenSecret), and Scopes lists what it authorizes, e.g.
+// "zones:read", "config:write", "zone:example.com:write".
+type DashboardAPIToken struct {
+	ID           string
+	Name         string
+	HashedSecret string
+	Scopes       []string
+}
+
+// UpstreamStrategy names how a resolver chooses among multiple configured
+// upstream backends for a single query.
+type UpstreamStrategy string
+
+const (
+	// UpstreamStrategySingle sends every query to one backend, with no
+	// racing or failover.
+	UpstreamStrategySingle UpstreamStrategy = "single"
+	// UpstreamStrategyParallelBest races the two fastest-known backends
+	// (by recent EWMA latency/error rate) for each query and keeps
+	// whichever answers first.
+	UpstreamStrategyParallelBest UpstreamStrategy = "parallel_best"
+	// UpstreamStrategyFailover tries backends in order, moving to the next
+	// one only when the current one errors.
+	UpstreamStrategyFailover UpstreamStrategy = "failover"
+)
+
 // NewConfig loads the configuration from config.json or returns a default config.
 func NewConfig() *Config {
 	cfg, err := LoadConfig("config.json")
 	if err != nil {
 		// If config doesn't exist or is invalid, create a default one and save it.
 		defaultCfg := &Config{
-			ListenAddr:           "0.0.0.0:5053",
-			MetricsAddr:          "0.0.0.0:9090",
-			PrometheusEnabled:    false,
-			PrometheusNamespace:  "dns_resolver",
-			UpstreamTimeout:      5 * time.Second,
-			RequestTimeout:       5 * time.Second,
-			MaxWorkers:           10,
-			CacheSize:            5000,
-			MessageCacheSize:     5000,
-			RRsetCacheSize:       5000,
-			CacheMaxTTL:          3600 * time.Second,
-			CacheMinTTL:          60 * time.Second,
-			StaleWhileRevalidate: 1 * time.Minute,
-			LMDBPath:             "/tmp/dns_cache.lmdb",
-			ResolverType:         "knot",
-			ServerRole:           "master",
-			MasterAPIEndpoint:    "http://localhost:8080/api/v1/zones",
-			MasterAPIKey:         "master-key",
-			SlaveAPIKey:          "slave-key",
-			SyncInterval:         1 * time.Minute,
+			ListenAddr:              "0.0.0.0:5053",
+			MetricsAddr:             "0.0.0.0:9090",
+			PrometheusEnabled:       false,
+			PrometheusNamespace:     "dns_resolver",
+			UpstreamTimeout:         5 * time.Second,
+			RequestTimeout:          5 * time.Second,
+			MaxWorkers:              10,
+			MaxWorkerQueueDepth:     100,
+			CacheSize:               5000,
+			MessageCacheSize:        5000,
+			RRsetCacheSize:          5000,
+			CacheMaxTTL:             3600 * time.Second,
+			CacheMinTTL:             60 * time.Second,
+			StaleWhileRevalidate:    1 * time.Minute,
+			PrefetchInterval:        30 * time.Second,
+			CacheStaleTTL:           1 * time.Hour,
+			CachePrefetchThreshold:  10 * time.Second,
+			CachePrefetchMinHits:    5,
+			CachePrefetchPercentage: 0.10,
+			DoHAddr:                 "",
+			DoHPath:                 "/dns-query",
+			DoH3Enabled:             false,
+			DoHAutocertEnabled:      false,
+			DoTAddr:                 "",
+			ShutdownTimeout:         5 * time.Second,
+			LMDBPath:                "/tmp/dns_cache.lmdb",
+			ResolverType:            "knot",
+			ServerRole:              "master",
+			MasterAPIEndpoint:       "http://localhost:8080/api/v1/zones",
+			MasterAPIKey:            "master-key",
+			SlaveAPIKey:             "slave-key",
+			SyncInterval:            1 * time.Minute,
+			RejectedTTL:             5 * time.Minute,
+			RejectedCachePath:       "/tmp/dns_rejected_cache.json",
+			FakeIPEnabled:           false,
+			FakeIPRange4:            "198.18.0.0/15",
+			FakeIPRange6:            "fd00:dead:beef::/48",
+			FakeIPTTL:               1 * time.Hour,
+			FakeIPCachePath:         "/tmp/dns_fakeip_cache.json",
+			Upstreams:               []string{"udp://9.9.9.9:53"},
+			UpstreamUDPTimeout:      2 * time.Second,
+			UpstreamTCPTimeout:      5 * time.Second,
+			UpstreamTLSTimeout:      5 * time.Second,
+			UpstreamHTTPSTimeout:    5 * time.Second,
+			BootstrapDNS:            []string{"9.9.9.9:53"},
+			UpstreamTLSIdleTimeout:  30 * time.Second,
+			SchemaVersion:           CurrentSchemaVersion,
+			AggressiveNSEC:          false,
+			ECSEnabled:              false,
+			ECSPrefixV4:             24,
+			ECSPrefixV6:             56,
 		}
 		defaultCfg.Save("config.json")
 		return defaultCfg
@@ -63,22 +488,61 @@ func NewConfig() *Config {
 	return cfg
 }
 
-// LoadConfig loads configuration from a file.
+// LoadConfig loads configuration from a file, migrating it to
+// CurrentSchemaVersion first (see migrate.go) so a config.json written by an
+// older binary still loads correctly.
 func LoadConfig(path string) (*Config, error) {
 	file, err := os.Open(path)
 	if err != nil {
 		return nil, err
 	}
 	defer file.Close()
-	decoder := json.NewDecoder(file)
-	cfg := &Config{}
-	err = decoder.Decode(cfg)
+
+	var raw map[string]interface{}
+	if err := json.NewDecoder(file).Decode(&raw); err != nil {
+		return nil, err
+	}
+
+	raw, err = migrate(raw)
 	if err != nil {
 		return nil, err
 	}
+
+	migrated, err := json.Marshal(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := &Config{}
+	if err := json.Unmarshal(migrated, cfg); err != nil {
+		return nil, err
+	}
 	return cfg, nil
 }
 
+// Validate reports whether c is sane enough to swap in as the running
+// configuration. LoadConfig does not call this itself, so callers needing a
+// more permissive load (tests, migrations) still can; Watcher calls it
+// before ever swapping in a reloaded config.
+func (c *Config) Validate() error {
+	if c.ListenAddr == "" {
+		return fmt.Errorf("ListenAddr must not be empty")
+	}
+	if c.MaxWorkers <= 0 {
+		return fmt.Errorf("MaxWorkers must be positive")
+	}
+	if c.MaxWorkerQueueDepth < 0 {
+		return fmt.Errorf("MaxWorkerQueueDepth must not be negative")
+	}
+	if c.CacheMinTTL < 0 || c.CacheMaxTTL < 0 {
+		return fmt.Errorf("CacheMinTTL and CacheMaxTTL must not be negative")
+	}
+	if c.CacheMaxTTL > 0 && c.CacheMinTTL > c.CacheMaxTTL {
+		return fmt.Errorf("CacheMinTTL must not exceed CacheMaxTTL")
+	}
+	return nil
+}
+
 // Save saves configuration to a file.
 func (c *Config) Save(path string) error {
 	file, err := os.Create(path)
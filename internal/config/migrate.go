@@ -0,0 +1,63 @@
+package config
+
+import "fmt"
+
+// CurrentSchemaVersion is the config.json schema version NewConfig and
+// LoadConfig produce. A config.json missing SchemaVersion predates this and
+// is treated as version 0.
+const CurrentSchemaVersion = 2
+
+// migrationFunc upgrades a decoded config.json from one schema version to
+// the next, mutating raw in place (renaming or defaulting fields as needed)
+// before it is re-marshaled into a Config.
+type migrationFunc func(raw map[string]interface{}) error
+
+// migrations holds one entry per schema version upgrade, in order:
+// migrations[i] upgrades a config at version i to version i+1. Adding a new
+// schema version is normally just appending an entry here plus bumping
+// CurrentSchemaVersion.
+var migrations = []migrationFunc{
+	migrateV0toV1,
+	migrateV1toV2,
+}
+
+// migrateV0toV1 upgrades a pre-versioning config.json; every field that
+// version needs already has the same name and shape in v1, so there's
+// nothing to do here beyond running it at all (see migrate, which stamps
+// SchemaVersion once every migration has finished rather than each function
+// stamping its own target version).
+func migrateV0toV1(raw map[string]interface{}) error {
+	return nil
+}
+
+// migrateV1toV2 replaces the single UpstreamBootstrapAddr string with the
+// BootstrapDNS list it was folded into, so an existing config.json keeps
+// resolving its hostname-only upstreams the same way after the upgrade.
+func migrateV1toV2(raw map[string]interface{}) error {
+	if addr, ok := raw["UpstreamBootstrapAddr"].(string); ok && addr != "" {
+		raw["BootstrapDNS"] = []interface{}{addr}
+	}
+	delete(raw, "UpstreamBootstrapAddr")
+	return nil
+}
+
+// migrate runs raw (a decoded config.json) through every migration between
+// its declared SchemaVersion and CurrentSchemaVersion.
+func migrate(raw map[string]interface{}) (map[string]interface{}, error) {
+	version := 0
+	if v, ok := raw["SchemaVersion"].(float64); ok {
+		version = int(v)
+	}
+
+	if version > CurrentSchemaVersion {
+		return nil, fmt.Errorf("config schema version %d is newer than this binary supports (%d)", version, CurrentSchemaVersion)
+	}
+
+	for i := version; i < CurrentSchemaVersion; i++ {
+		if err := migrations[i](raw); err != nil {
+			return nil, fmt.Errorf("migrating config from schema version %d to %d: %w", i, i+1, err)
+		}
+	}
+	raw["SchemaVersion"] = float64(CurrentSchemaVersion)
+	return raw, nil
+}
@@ -0,0 +1,149 @@
+package config
+
+import (
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// SubscriberFunc is called by a Watcher after it swaps in a newly reloaded,
+// validated Config. old is the config that was active immediately before
+// the swap.
+type SubscriberFunc func(newCfg, oldCfg *Config)
+
+var (
+	subscribersMu sync.Mutex
+	subscribers   []SubscriberFunc
+)
+
+// Subscribe registers fn to run after every successful reload performed by
+// any Watcher, so subsystems (resolver, cache, metrics listener) can react
+// to config changes — e.g. resize the cache, swap upstreams, toggle
+// Prometheus — without a process restart. Subscribe is process-global,
+// since a process normally runs exactly one Watcher over its config.json.
+func Subscribe(fn SubscriberFunc) {
+	subscribersMu.Lock()
+	defer subscribersMu.Unlock()
+	subscribers = append(subscribers, fn)
+}
+
+func publish(newCfg, oldCfg *Config) {
+	subscribersMu.Lock()
+	fns := append([]SubscriberFunc(nil), subscribers...)
+	subscribersMu.Unlock()
+
+	for _, fn := range fns {
+		fn(newCfg, oldCfg)
+	}
+}
+
+// Watcher polls a config file's mtime on an interval and reloads it on
+// change, validating the new config before swapping it in. A reload that
+// fails to parse or fails Validate is logged and discarded, leaving the
+// previously active Config in place — a hot reload can never leave the
+// process without a usable config.
+type Watcher struct {
+	path     string
+	interval time.Duration
+
+	mu      sync.RWMutex
+	current *Config
+	modTime time.Time
+
+	stop chan struct{}
+}
+
+// NewWatcher creates a Watcher over path, seeded with initial (normally the
+// Config NewConfig/LoadConfig already produced for path, so Watcher doesn't
+// reload it a second time before Start is called).
+func NewWatcher(path string, initial *Config, interval time.Duration) *Watcher {
+	if interval <= 0 {
+		interval = 5 * time.Second
+	}
+	modTime, _ := fileModTime(path)
+	return &Watcher{
+		path:     path,
+		interval: interval,
+		current:  initial,
+		modTime:  modTime,
+		stop:     make(chan struct{}),
+	}
+}
+
+// Current returns the Watcher's currently active, validated Config.
+func (w *Watcher) Current() *Config {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	return w.current
+}
+
+// Start polls w.path for mtime changes on its configured interval until Stop
+// is called; it blocks, so callers run it in its own goroutine.
+func (w *Watcher) Start() {
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			w.checkAndReload()
+		case <-w.stop:
+			return
+		}
+	}
+}
+
+// Stop terminates Start's polling loop.
+func (w *Watcher) Stop() {
+	close(w.stop)
+}
+
+// Reload forces an immediate reload of w.path regardless of its mtime, e.g.
+// in response to SIGHUP.
+func (w *Watcher) Reload() error {
+	return w.reloadFrom(w.path)
+}
+
+func (w *Watcher) checkAndReload() {
+	modTime, err := fileModTime(w.path)
+	if err != nil {
+		log.Printf("config: watcher could not stat %s: %v", w.path, err)
+		return
+	}
+	if !modTime.After(w.modTime) {
+		return
+	}
+	_ = w.reloadFrom(w.path)
+}
+
+func (w *Watcher) reloadFrom(path string) error {
+	newCfg, err := LoadConfig(path)
+	if err != nil {
+		log.Printf("config: reload of %s failed, keeping the active config: %v", path, err)
+		return err
+	}
+	if err := newCfg.Validate(); err != nil {
+		log.Printf("config: reload of %s produced an invalid config, keeping the active config: %v", path, err)
+		return err
+	}
+
+	modTime, _ := fileModTime(path)
+
+	w.mu.Lock()
+	oldCfg := w.current
+	w.current = newCfg
+	w.modTime = modTime
+	w.mu.Unlock()
+
+	log.Printf("config: reloaded %s (schema version %d)", path, newCfg.SchemaVersion)
+	publish(newCfg, oldCfg)
+	return nil
+}
+
+func fileModTime(path string) (time.Time, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return info.ModTime(), nil
+}
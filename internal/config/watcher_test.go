@@ -0,0 +1,106 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func writeConfig(t *testing.T, path string, cfg *Config) {
+	t.Helper()
+	if err := cfg.Save(path); err != nil {
+		t.Fatalf("saving config to %s: %v", path, err)
+	}
+}
+
+func TestLoadConfigMigratesMissingSchemaVersion(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.json")
+	if err := os.WriteFile(path, []byte(`{"ListenAddr":"0.0.0.0:5053","MaxWorkers":10}`), 0644); err != nil {
+		t.Fatalf("writing config: %v", err)
+	}
+
+	cfg, err := LoadConfig(path)
+	if err != nil {
+		t.Fatalf("LoadConfig: %v", err)
+	}
+	if cfg.SchemaVersion != CurrentSchemaVersion {
+		t.Errorf("expected SchemaVersion %d, got %d", CurrentSchemaVersion, cfg.SchemaVersion)
+	}
+	if cfg.ListenAddr != "0.0.0.0:5053" {
+		t.Errorf("expected ListenAddr to survive migration unchanged, got %q", cfg.ListenAddr)
+	}
+}
+
+func TestLoadConfigRejectsNewerSchema(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.json")
+	if err := os.WriteFile(path, []byte(`{"SchemaVersion":999}`), 0644); err != nil {
+		t.Fatalf("writing config: %v", err)
+	}
+
+	if _, err := LoadConfig(path); err == nil {
+		t.Fatal("expected LoadConfig to reject a config declaring a future schema version")
+	}
+}
+
+func TestWatcherReloadsOnChangeAndPublishes(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.json")
+
+	initial := &Config{ListenAddr: "0.0.0.0:5053", MaxWorkers: 10, SchemaVersion: CurrentSchemaVersion}
+	writeConfig(t, path, initial)
+
+	w := NewWatcher(path, initial, time.Hour)
+
+	got := make(chan *Config, 1)
+	Subscribe(func(newCfg, oldCfg *Config) {
+		if newCfg.ListenAddr == "0.0.0.0:5054" {
+			got <- newCfg
+		}
+	})
+
+	updated := &Config{ListenAddr: "0.0.0.0:5054", MaxWorkers: 10, SchemaVersion: CurrentSchemaVersion}
+	// Ensure a strictly later mtime than the initial write.
+	time.Sleep(10 * time.Millisecond)
+	writeConfig(t, path, updated)
+
+	if err := w.Reload(); err != nil {
+		t.Fatalf("Reload: %v", err)
+	}
+
+	select {
+	case cfg := <-got:
+		if cfg.ListenAddr != "0.0.0.0:5054" {
+			t.Errorf("unexpected published config: %+v", cfg)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected a subscriber notification after Reload")
+	}
+
+	if w.Current().ListenAddr != "0.0.0.0:5054" {
+		t.Errorf("expected Watcher.Current to reflect the reloaded config")
+	}
+}
+
+func TestWatcherKeepsActiveConfigOnInvalidReload(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.json")
+
+	initial := &Config{ListenAddr: "0.0.0.0:5053", MaxWorkers: 10, SchemaVersion: CurrentSchemaVersion}
+	writeConfig(t, path, initial)
+
+	w := NewWatcher(path, initial, time.Hour)
+
+	if err := os.WriteFile(path, []byte(`{"MaxWorkers":0}`), 0644); err != nil {
+		t.Fatalf("writing invalid config: %v", err)
+	}
+
+	if err := w.Reload(); err == nil {
+		t.Fatal("expected Reload to reject a config with MaxWorkers <= 0")
+	}
+	if w.Current().ListenAddr != "0.0.0.0:5053" {
+		t.Errorf("expected the invalid reload to leave the active config unchanged")
+	}
+}
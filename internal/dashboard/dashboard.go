@@ -9,6 +9,8 @@ import (
 	"net/http"
 
 	"dns-resolver/internal/metrics"
+
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
 //go:embed public
@@ -40,9 +42,20 @@ func (s *Server) Start() {
 	fs := http.FileServer(http.FS(staticFS))
 	http.Handle("/", fs)
 
-	// Handle metrics endpoint.
+	// Handle metrics endpoint. This is the hand-rolled JSON blob the
+	// embedded dashboard UI polls, not a Prometheus exposition format; see
+	// /prom for that.
 	http.HandleFunc("/metrics", s.metricsHandler)
 
+	// Handle cache-prefetch stats endpoint.
+	http.HandleFunc("/prefetch/stats", s.prefetchStatsHandler)
+
+	// Handle the Prometheus exposition endpoint, scraped by standard
+	// tooling. It's sourced from the same promauto collectors Metrics
+	// updates throughout a query's lifecycle, so it and the JSON /metrics
+	// blob never drift apart.
+	http.Handle("/prom", promhttp.Handler())
+
 	log.Printf("Dashboard server starting on %s", s.addr)
 	if err := http.ListenAndServe(s.addr, nil); err != nil {
 		log.Fatalf("Failed to start dashboard server: %v", err)
@@ -54,41 +67,62 @@ func (s *Server) metricsHandler(w http.ResponseWriter, r *http.Request) {
 	qps, totalQueries, probation, protected, qpsHistory, cacheLoadHistory, cpuUsage, memUsage, goroutines, cpuHistory, memHistory, topNX, topLatency, queryTypes, responseCodes := s.metrics.GetStats()
 
 	data := struct {
-		QPS                 float64             `json:"qps"`
-		TotalQueries        int64               `json:"total_queries"`
-		CacheProbation      int                 `json:"cache_probation"`
-		CacheProtected      int                 `json:"cache_protected"`
-		QPSHistory          []float64           `json:"qps_history"`
-		CacheLoadHistory    []float64           `json:"cache_load_history"`
-		CPUUsage            float64             `json:"cpu_usage"`
-		MemoryUsage         float64             `json:"mem_usage"`
-		GoroutineCount      int                 `json:"goroutine_count"`
-		CPUHistory          []float64           `json:"cpu_history"`
-		MemHistory          []float64           `json:"mem_history"`
-		TopNXDomains        []metrics.TopDomain `json:"top_nx_domains"`
-		TopLatencyDomains   []metrics.TopDomain `json:"top_latency_domains"`
-		QueryTypes          []metrics.StatItem  `json:"query_types"`
-		ResponseCodes       []metrics.StatItem  `json:"response_codes"`
+		QPS               float64             `json:"qps"`
+		TotalQueries      int64               `json:"total_queries"`
+		CacheProbation    int                 `json:"cache_probation"`
+		CacheProtected    int                 `json:"cache_protected"`
+		QPSHistory        []float64           `json:"qps_history"`
+		CacheLoadHistory  []float64           `json:"cache_load_history"`
+		CPUUsage          float64             `json:"cpu_usage"`
+		MemoryUsage       float64             `json:"mem_usage"`
+		GoroutineCount    int                 `json:"goroutine_count"`
+		CPUHistory        []float64           `json:"cpu_history"`
+		MemHistory        []float64           `json:"mem_history"`
+		TopNXDomains      []metrics.TopDomain `json:"top_nx_domains"`
+		TopLatencyDomains []metrics.TopDomain `json:"top_latency_domains"`
+		QueryTypes        []metrics.StatItem  `json:"query_types"`
+		ResponseCodes     []metrics.StatItem  `json:"response_codes"`
 	}{
-		QPS:                 qps,
-		TotalQueries:        totalQueries,
-		CacheProbation:      probation,
-		CacheProtected:      protected,
-		QPSHistory:          qpsHistory,
-		CacheLoadHistory:    cacheLoadHistory,
-		CPUUsage:            cpuUsage,
-		MemoryUsage:         memUsage,
-		GoroutineCount:      goroutines,
-		CPUHistory:          cpuHistory,
-		MemHistory:          memHistory,
-		TopNXDomains:        topNX,
-		TopLatencyDomains:   topLatency,
-		QueryTypes:          queryTypes,
-		ResponseCodes:       responseCodes,
+		QPS:               qps,
+		TotalQueries:      totalQueries,
+		CacheProbation:    probation,
+		CacheProtected:    protected,
+		QPSHistory:        qpsHistory,
+		CacheLoadHistory:  cacheLoadHistory,
+		CPUUsage:          cpuUsage,
+		MemoryUsage:       memUsage,
+		GoroutineCount:    goroutines,
+		CPUHistory:        cpuHistory,
+		MemHistory:        memHistory,
+		TopNXDomains:      topNX,
+		TopLatencyDomains: topLatency,
+		QueryTypes:        queryTypes,
+		ResponseCodes:     responseCodes,
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	if err := json.NewEncoder(w).Encode(data); err != nil {
 		http.Error(w, fmt.Sprintf("Failed to encode metrics: %v", err), http.StatusInternalServerError)
 	}
-}
\ No newline at end of file
+}
+
+// prefetchStatsHandler handles requests for the TTL-driven cache-prefetcher's
+// started/succeeded/failed counters.
+func (s *Server) prefetchStatsHandler(w http.ResponseWriter, r *http.Request) {
+	started, success, failed := s.metrics.CachePrefetchStats()
+
+	data := struct {
+		PrefetchesStarted int64 `json:"prefetches_started"`
+		PrefetchesSuccess int64 `json:"prefetches_success"`
+		PrefetchesFailed  int64 `json:"prefetches_failed"`
+	}{
+		PrefetchesStarted: started,
+		PrefetchesSuccess: success,
+		PrefetchesFailed:  failed,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(data); err != nil {
+		http.Error(w, fmt.Sprintf("Failed to encode prefetch stats: %v", err), http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,116 @@
+package depgraph
+
+// SPOFReport describes a dependency node whose removal disconnects the
+// graph's root domain from every resolvable path.
+type SPOFReport struct {
+	Node GraphNode
+}
+
+// FindSinglePointsOfFailure removes each node from the graph in turn and
+// checks whether g.Root can still reach some IP node through the remaining
+// edges. A node whose removal breaks that reachability is a single point of
+// failure: every currently-working resolution path for the domain goes
+// through it.
+func FindSinglePointsOfFailure(g *Graph) []SPOFReport {
+	var reports []SPOFReport
+	for _, n := range g.Nodes() {
+		if n.ID() == g.Root {
+			continue
+		}
+		if !reaches(g.adjacency(n.ID()), g.Root) {
+			reports = append(reports, SPOFReport{Node: n})
+		}
+	}
+	return reports
+}
+
+// reaches reports whether some IP node is reachable from root via adj.
+func reaches(adj map[string][]Edge, root string) bool {
+	visited := map[string]bool{root: true}
+	queue := []string{root}
+	for len(queue) > 0 {
+		cur := queue[0]
+		queue = queue[1:]
+		for _, e := range adj[cur] {
+			if e.To.Type() == NodeTypeIP {
+				return true
+			}
+			if !visited[e.To.ID()] {
+				visited[e.To.ID()] = true
+				queue = append(queue, e.To.ID())
+			}
+		}
+	}
+	return false
+}
+
+// ZoneCycle is a circular dependency among domain/nameserver nodes:
+// resolving the first node eventually depends on the first node again, e.g.
+// ns1.a.example in-bailiwick of a.example served only by ns1.b.example,
+// whose zone is served only by ns1.a.example.
+type ZoneCycle struct {
+	Nodes []GraphNode
+}
+
+// FindZoneCycles detects circular dependencies between zones. It ignores IP
+// nodes, which are always leaves in the dependency graph and so can never
+// participate in a cycle.
+func FindZoneCycles(g *Graph) []ZoneCycle {
+	adj := make(map[string][]Edge)
+	nodeByID := make(map[string]GraphNode)
+	for _, e := range g.Edges() {
+		if e.To.Type() == NodeTypeIP {
+			continue
+		}
+		adj[e.From.ID()] = append(adj[e.From.ID()], e)
+		nodeByID[e.From.ID()] = e.From
+		nodeByID[e.To.ID()] = e.To
+	}
+
+	const (
+		white = iota
+		gray
+		black
+	)
+	color := make(map[string]int)
+	var stack []GraphNode
+	var cycles []ZoneCycle
+
+	var visit func(id string)
+	visit = func(id string) {
+		color[id] = gray
+		stack = append(stack, nodeByID[id])
+		for _, e := range adj[id] {
+			switch color[e.To.ID()] {
+			case white:
+				visit(e.To.ID())
+			case gray:
+				if cycle := extractCycle(stack, e.To.ID()); cycle != nil {
+					cycles = append(cycles, ZoneCycle{Nodes: cycle})
+				}
+			}
+		}
+		stack = stack[:len(stack)-1]
+		color[id] = black
+	}
+
+	for id := range adj {
+		if color[id] == white {
+			visit(id)
+		}
+	}
+	return cycles
+}
+
+// extractCycle returns the portion of stack from startID onward, i.e. the
+// actual cycle found when a back-edge to startID was encountered.
+func extractCycle(stack []GraphNode, startID string) []GraphNode {
+	for i, n := range stack {
+		if n.ID() == startID {
+			cycle := make([]GraphNode, len(stack)-i)
+			copy(cycle, stack[i:])
+			return cycle
+		}
+	}
+	return nil
+}
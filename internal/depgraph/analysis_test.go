@@ -0,0 +1,92 @@
+package depgraph
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFindSinglePointsOfFailure(t *testing.T) {
+	g := NewGraph("www.example.com.")
+
+	domain := DomainName{Name: "www.example.com."}
+	ns1 := NameServer{Name: "ns1.example.com."}
+	ns2 := NameServer{Name: "ns2.example.com."}
+	ip1 := IP{Addr: "192.0.2.1"}
+	ip2 := IP{Addr: "192.0.2.2"}
+
+	g.AddEdge(domain, ns1, EdgeDelegation)
+	g.AddEdge(domain, ns2, EdgeDelegation)
+	g.AddEdge(ns1, ip1, EdgeResolution)
+	g.AddEdge(ns2, ip2, EdgeResolution)
+
+	reports := FindSinglePointsOfFailure(g)
+	assert.Empty(t, reports, "two independent nameservers should not produce a SPOF")
+}
+
+func TestFindSinglePointsOfFailureDetectsSharedNameServer(t *testing.T) {
+	g := NewGraph("www.example.com.")
+
+	domain := DomainName{Name: "www.example.com."}
+	ns1 := NameServer{Name: "ns1.example.com."}
+	ip1 := IP{Addr: "192.0.2.1"}
+
+	g.AddEdge(domain, ns1, EdgeDelegation)
+	g.AddEdge(ns1, ip1, EdgeResolution)
+
+	reports := FindSinglePointsOfFailure(g)
+	var ids []string
+	for _, r := range reports {
+		ids = append(ids, r.Node.ID())
+	}
+	assert.Contains(t, ids, ns1.ID())
+	assert.Contains(t, ids, ip1.ID())
+}
+
+func TestFindZoneCyclesDetectsCircularDelegation(t *testing.T) {
+	g := NewGraph("a.example.")
+
+	zoneA := DomainName{Name: "a.example."}
+	zoneB := DomainName{Name: "b.example."}
+	nsInB := NameServer{Name: "ns1.b.example."}
+	nsInA := NameServer{Name: "ns1.a.example."}
+
+	g.AddEdge(zoneA, nsInB, EdgeDelegation)
+	g.AddEdge(nsInB, zoneB, EdgeResolution)
+	g.AddEdge(zoneB, nsInA, EdgeDelegation)
+	g.AddEdge(nsInA, zoneA, EdgeResolution)
+
+	cycles := FindZoneCycles(g)
+	assert.NotEmpty(t, cycles, "circular delegation between a.example and b.example should be detected")
+}
+
+func TestFindZoneCyclesNoCycleInTree(t *testing.T) {
+	g := NewGraph("www.example.com.")
+
+	domain := DomainName{Name: "www.example.com."}
+	zone := DomainName{Name: "example.com."}
+	ns := NameServer{Name: "ns1.example.com."}
+
+	g.AddEdge(domain, zone, EdgeAlias)
+	g.AddEdge(zone, ns, EdgeDelegation)
+
+	assert.Empty(t, FindZoneCycles(g))
+}
+
+func TestToJSONAndToDOT(t *testing.T) {
+	g := NewGraph("example.com.")
+	domain := DomainName{Name: "example.com."}
+	ns := NameServer{Name: "ns1.example.com."}
+	ip := IP{Addr: "192.0.2.1"}
+
+	g.AddEdge(domain, ns, EdgeDelegation)
+	g.AddEdge(ns, ip, EdgeResolution)
+
+	data, err := ToJSON(g)
+	assert.NoError(t, err)
+	assert.Contains(t, string(data), "ns1.example.com.")
+
+	dot := ToDOT(g)
+	assert.Contains(t, dot, "digraph depgraph {")
+	assert.Contains(t, dot, "ns1.example.com.")
+}
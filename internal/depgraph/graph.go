@@ -0,0 +1,152 @@
+// Package depgraph builds and analyzes the DNS delegation dependency graph
+// for a domain: the chain of zone cuts from the root down to the domain,
+// every nameserver that chain depends on, and the IPs those nameservers
+// resolve to. It gives operators a way to audit the authoritative fragility
+// of domains their resolver depends on.
+package depgraph
+
+import (
+	"strings"
+	"sync"
+)
+
+// NodeType identifies the kind of entity a GraphNode represents.
+type NodeType string
+
+const (
+	NodeTypeDomain     NodeType = "domain"
+	NodeTypeAlias      NodeType = "alias"
+	NodeTypeNameServer NodeType = "nameserver"
+	NodeTypeIP         NodeType = "ip"
+)
+
+// GraphNode is a single vertex in the dependency graph.
+type GraphNode interface {
+	// ID uniquely identifies the node within the graph, e.g. "ns1.example.com." or "192.0.2.1".
+	ID() string
+	// Type reports what kind of node this is.
+	Type() NodeType
+}
+
+// DomainName is a zone or hostname node, e.g. "example.com.".
+type DomainName struct {
+	Name string
+}
+
+func (d DomainName) ID() string     { return d.Name }
+func (d DomainName) Type() NodeType { return NodeTypeDomain }
+
+// AliasName is a CNAME target node.
+type AliasName struct {
+	Name string
+}
+
+func (a AliasName) ID() string     { return a.Name }
+func (a AliasName) Type() NodeType { return NodeTypeAlias }
+
+// NameServer is an NS record target.
+type NameServer struct {
+	Name string
+}
+
+func (n NameServer) ID() string     { return n.Name }
+func (n NameServer) Type() NodeType { return NodeTypeNameServer }
+
+// IP is an A/AAAA record target.
+type IP struct {
+	Addr string
+}
+
+func (ip IP) ID() string     { return ip.Addr }
+func (ip IP) Type() NodeType { return NodeTypeIP }
+
+// EdgeKind describes why two nodes are connected.
+type EdgeKind string
+
+const (
+	EdgeDelegation EdgeKind = "delegation" // zone -> nameserver (NS record)
+	EdgeAlias      EdgeKind = "alias"      // domain -> alias (CNAME record)
+	EdgeResolution EdgeKind = "resolution" // nameserver -> ip (A/AAAA record)
+)
+
+// Edge is a directed dependency: From requires To to resolve.
+type Edge struct {
+	From GraphNode
+	To   GraphNode
+	Kind EdgeKind
+}
+
+// Graph is the set of nodes and edges discovered while walking a domain's
+// delegation chain. It is safe for concurrent writes via AddEdge.
+type Graph struct {
+	Root string
+
+	mu    sync.Mutex
+	nodes map[string]GraphNode
+	edges []Edge
+}
+
+// NewGraph creates an empty Graph rooted at domain.
+func NewGraph(domain string) *Graph {
+	return &Graph{
+		Root:  domain,
+		nodes: make(map[string]GraphNode),
+	}
+}
+
+// AddEdge records a dependency edge, adding both endpoints as nodes if new.
+func (g *Graph) AddEdge(from, to GraphNode, kind EdgeKind) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if _, ok := g.nodes[from.ID()]; !ok {
+		g.nodes[from.ID()] = from
+	}
+	if _, ok := g.nodes[to.ID()]; !ok {
+		g.nodes[to.ID()] = to
+	}
+	g.edges = append(g.edges, Edge{From: from, To: to, Kind: kind})
+}
+
+// Nodes returns a snapshot of every node currently in the graph.
+func (g *Graph) Nodes() []GraphNode {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	nodes := make([]GraphNode, 0, len(g.nodes))
+	for _, n := range g.nodes {
+		nodes = append(nodes, n)
+	}
+	return nodes
+}
+
+// Edges returns a snapshot of every edge currently in the graph.
+func (g *Graph) Edges() []Edge {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	edges := make([]Edge, len(g.edges))
+	copy(edges, g.edges)
+	return edges
+}
+
+// adjacency builds a from-node-ID -> outgoing-edges index, skipping every
+// edge that touches excludeID. Used by the SPOF and cycle analyses to
+// simulate removing a node from the graph without mutating it.
+func (g *Graph) adjacency(excludeID string) map[string][]Edge {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	adj := make(map[string][]Edge)
+	for _, e := range g.edges {
+		if e.From.ID() == excludeID || e.To.ID() == excludeID {
+			continue
+		}
+		adj[e.From.ID()] = append(adj[e.From.ID()], e)
+	}
+	return adj
+}
+
+func fqdn(name string) string {
+	if !strings.HasSuffix(name, ".") {
+		return name + "."
+	}
+	return name
+}
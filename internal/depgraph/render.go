@@ -0,0 +1,66 @@
+package depgraph
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+type jsonNode struct {
+	ID   string   `json:"id"`
+	Type NodeType `json:"type"`
+}
+
+type jsonEdge struct {
+	From string   `json:"from"`
+	To   string   `json:"to"`
+	Kind EdgeKind `json:"kind"`
+}
+
+type jsonGraph struct {
+	Root  string     `json:"root"`
+	Nodes []jsonNode `json:"nodes"`
+	Edges []jsonEdge `json:"edges"`
+}
+
+// ToJSON renders the graph as JSON, suitable for the dependency-graph
+// dashboard endpoint.
+func ToJSON(g *Graph) ([]byte, error) {
+	out := jsonGraph{Root: g.Root}
+	for _, n := range g.Nodes() {
+		out.Nodes = append(out.Nodes, jsonNode{ID: n.ID(), Type: n.Type()})
+	}
+	for _, e := range g.Edges() {
+		out.Edges = append(out.Edges, jsonEdge{From: e.From.ID(), To: e.To.ID(), Kind: e.Kind})
+	}
+	return json.MarshalIndent(out, "", "  ")
+}
+
+// nodeShape picks a Graphviz shape for n's type so the dashboard rendering
+// visually distinguishes domains, aliases, nameservers, and IPs.
+func nodeShape(n GraphNode) string {
+	switch n.Type() {
+	case NodeTypeDomain:
+		return "ellipse"
+	case NodeTypeAlias:
+		return "diamond"
+	case NodeTypeIP:
+		return "oval"
+	default:
+		return "box"
+	}
+}
+
+// ToDOT renders the graph as Graphviz DOT source.
+func ToDOT(g *Graph) string {
+	var b strings.Builder
+	b.WriteString("digraph depgraph {\n")
+	for _, n := range g.Nodes() {
+		fmt.Fprintf(&b, "  %q [shape=%s, label=%q];\n", n.ID(), nodeShape(n), fmt.Sprintf("%s\n(%s)", n.ID(), n.Type()))
+	}
+	for _, e := range g.Edges() {
+		fmt.Fprintf(&b, "  %q -> %q [label=%q];\n", e.From.ID(), e.To.ID(), e.Kind)
+	}
+	b.WriteString("}\n")
+	return b.String()
+}
@@ -0,0 +1,204 @@
+package depgraph
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	"dns-resolver/internal/resolver"
+
+	"github.com/miekg/dns"
+	"golang.org/x/sync/singleflight"
+)
+
+// DefaultWorkers bounds how many delegation-chain branches are walked concurrently.
+const DefaultWorkers = 8
+
+// maxAliasChain bounds how many CNAME hops are followed for a single
+// domain, guarding against a CNAME loop.
+const maxAliasChain = 10
+
+// Walker builds a Graph for a domain by walking its delegation chain from
+// the root down through every zone cut, resolving every nameserver it finds
+// to A/AAAA. It reuses the supplied resolver, and therefore the resolver's
+// own MultiLevelCache, so repeated lookups of the same nameserver or zone
+// cut hit cache instead of re-querying upstream.
+type Walker struct {
+	resolver resolver.ResolverInterface
+	workers  int
+
+	sf      singleflight.Group
+	visited sync.Map // dedupe key -> struct{}, avoids re-walking an already-processed node
+}
+
+// NewWalker creates a Walker with the given worker concurrency. A
+// non-positive workers value falls back to DefaultWorkers.
+func NewWalker(r resolver.ResolverInterface, workers int) *Walker {
+	if workers <= 0 {
+		workers = DefaultWorkers
+	}
+	return &Walker{resolver: r, workers: workers}
+}
+
+// BuildGraph walks the delegation chain for domain, from the root down to
+// domain itself, resolving every nameserver it depends on to A/AAAA, and
+// returns the resulting dependency graph.
+func (w *Walker) BuildGraph(ctx context.Context, domain string) (*Graph, error) {
+	domain = fqdn(domain)
+	g := NewGraph(domain)
+
+	zones := zoneCuts(domain)
+
+	sem := make(chan struct{}, w.workers)
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var firstErr error
+
+	recordErr := func(err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	for _, zone := range zones {
+		zone := zone
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			nsNames, err := w.resolveNS(ctx, zone)
+			if err != nil {
+				recordErr(fmt.Errorf("resolving NS for %s: %w", zone, err))
+				return
+			}
+
+			zoneNode := DomainName{Name: zone}
+			for _, ns := range nsNames {
+				nsNode := NameServer{Name: ns}
+				g.AddEdge(zoneNode, nsNode, EdgeDelegation)
+				w.resolveNameServerIPs(ctx, g, nsNode)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if err := w.resolveAliasChain(ctx, g, domain); err != nil {
+		recordErr(err)
+	}
+
+	return g, firstErr
+}
+
+// zoneCuts returns every zone cut from the root down to domain itself, e.g.
+// for "www.example.com." it returns [".", "com.", "example.com.", "www.example.com."].
+func zoneCuts(domain string) []string {
+	labels := dns.SplitDomainName(domain)
+	zones := make([]string, 0, len(labels)+1)
+	zones = append(zones, ".")
+	for i := len(labels) - 1; i >= 0; i-- {
+		zones = append(zones, fqdn(strings.Join(labels[i:], ".")))
+	}
+	return zones
+}
+
+// query performs a single DNS lookup through the underlying resolver,
+// deduplicating concurrent lookups of the same (qtype, qname) via singleflight.
+func (w *Walker) query(ctx context.Context, qname string, qtype uint16) (*dns.Msg, error) {
+	key := fmt.Sprintf("%d:%s", qtype, qname)
+	v, err, _ := w.sf.Do(key, func() (interface{}, error) {
+		req := new(dns.Msg)
+		req.SetQuestion(qname, qtype)
+		req.RecursionDesired = true
+		return w.resolver.Resolve(ctx, req)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return v.(*dns.Msg), nil
+}
+
+// resolveNS resolves the nameservers delegated for zone. It is a no-op on a
+// repeat call for the same zone, so concurrent branches that share a zone
+// cut don't walk it twice.
+func (w *Walker) resolveNS(ctx context.Context, zone string) ([]string, error) {
+	if _, seen := w.visited.LoadOrStore("NS:"+zone, struct{}{}); seen {
+		return nil, nil
+	}
+
+	msg, err := w.query(ctx, zone, dns.TypeNS)
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for _, rr := range msg.Answer {
+		if ns, ok := rr.(*dns.NS); ok {
+			names = append(names, ns.Ns)
+		}
+	}
+	for _, rr := range msg.Ns {
+		if ns, ok := rr.(*dns.NS); ok {
+			names = append(names, ns.Ns)
+		}
+	}
+	return names, nil
+}
+
+// resolveNameServerIPs resolves ns to its A/AAAA records and records a
+// resolution edge for each one found.
+func (w *Walker) resolveNameServerIPs(ctx context.Context, g *Graph, ns NameServer) {
+	if _, seen := w.visited.LoadOrStore("IPS:"+ns.Name, struct{}{}); seen {
+		return
+	}
+
+	for _, qtype := range []uint16{dns.TypeA, dns.TypeAAAA} {
+		msg, err := w.query(ctx, ns.Name, qtype)
+		if err != nil {
+			continue
+		}
+		for _, rr := range msg.Answer {
+			var addr string
+			switch v := rr.(type) {
+			case *dns.A:
+				addr = v.A.String()
+			case *dns.AAAA:
+				addr = v.AAAA.String()
+			default:
+				continue
+			}
+			g.AddEdge(ns, IP{Addr: addr}, EdgeResolution)
+		}
+	}
+}
+
+// resolveAliasChain follows the CNAME chain for domain, if any, recording an
+// alias edge for every hop.
+func (w *Walker) resolveAliasChain(ctx context.Context, g *Graph, domain string) error {
+	current := domain
+	for i := 0; i < maxAliasChain; i++ {
+		msg, err := w.query(ctx, current, dns.TypeCNAME)
+		if err != nil {
+			return fmt.Errorf("resolving CNAME for %s: %w", current, err)
+		}
+
+		var target string
+		for _, rr := range msg.Answer {
+			if cname, ok := rr.(*dns.CNAME); ok {
+				target = cname.Target
+				break
+			}
+		}
+		if target == "" {
+			return nil
+		}
+
+		g.AddEdge(DomainName{Name: current}, AliasName{Name: target}, EdgeAlias)
+		current = target
+	}
+	return nil
+}
@@ -0,0 +1,359 @@
+// Package dnstap streams dnstap (https://dnstap.info) event records for
+// query auditing: Frame Streams-framed, protobuf-encoded payloads built on
+// github.com/dnstap/golang-dnstap's standard Dnstap/Message schema, covering
+// the four standard message types (CLIENT_QUERY, CLIENT_RESPONSE,
+// RESOLVER_QUERY, RESOLVER_RESPONSE) plus a CACHE_HIT/CACHE_MISS extension
+// of our own, since the upstream schema has no notion of a cache lookup.
+// That extension is carried in the Dnstap envelope's Extra field rather than
+// Message.Type, so it stays readable by any standard dnstap collector that
+// simply ignores fields it doesn't recognize, rather than breaking strict
+// decoders that only know the schema's own enum values.
+package dnstap
+
+import (
+	"net"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"dns-resolver/internal/config"
+
+	dnstap "github.com/dnstap/golang-dnstap"
+	"github.com/miekg/dns"
+	"google.golang.org/protobuf/proto"
+)
+
+// cacheExtra marks a frame as this resolver's own CACHE_HIT/CACHE_MISS
+// extension; stamped into Dnstap.Extra since Message.Type has no such value
+// in the standard schema.
+type cacheExtra string
+
+const (
+	cacheHitExtra  cacheExtra = "CACHE_HIT"
+	cacheMissExtra cacheExtra = "CACHE_MISS"
+)
+
+// Logger emits dnstap frames onto a pluggable Sink from a single background
+// goroutine (see sink.go's newSink and the enqueue/drain pair below), so a
+// slow or unreachable collector never adds latency to query handling; once
+// the queue is full, the oldest frame is dropped to make room, mirroring
+// plugins/query_logger's QueryLoggerPlugin.
+type Logger struct {
+	sink     Sink
+	identity []byte
+	version  []byte
+
+	queue   chan []byte
+	dropped int64
+}
+
+// defaultQueueSize bounds the number of encoded frames awaiting a write to
+// the configured sink.
+const defaultQueueSize = 4096
+
+// New builds a Logger from cfg. It returns (nil, nil) when cfg.DnstapEnabled
+// is false, so callers can hold onto a nil *Logger and call its methods
+// unconditionally (see the nil-receiver guards below) rather than checking
+// an enabled flag at every call site.
+func New(cfg *config.Config) (*Logger, error) {
+	if !cfg.DnstapEnabled {
+		return nil, nil
+	}
+
+	sink, err := newSink(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	identity := cfg.DnstapIdentity
+	if identity == "" {
+		identity = "astracat-resolver"
+	}
+	version := cfg.DnstapVersion
+	if version == "" {
+		version = "dns-resolver"
+	}
+
+	l := &Logger{
+		sink:     sink,
+		identity: []byte(identity),
+		version:  []byte(version),
+		queue:    make(chan []byte, defaultQueueSize),
+	}
+	go l.drain()
+	return l, nil
+}
+
+// Close flushes and releases the underlying sink. It does not drain
+// remaining queued frames. A nil *Logger (dnstap disabled) is a no-op.
+func (l *Logger) Close() error {
+	if l == nil {
+		return nil
+	}
+	return l.sink.Close()
+}
+
+// Dropped returns the number of frames discarded so far because the queue
+// was full and the sink couldn't keep up.
+func (l *Logger) Dropped() int64 {
+	if l == nil {
+		return 0
+	}
+	return atomic.LoadInt64(&l.dropped)
+}
+
+// LogClientQuery records a CLIENT_QUERY event: the query as received from
+// clientAddr, before any cache lookup or upstream exchange.
+func (l *Logger) LogClientQuery(q *dns.Msg, clientAddr net.Addr) {
+	if l == nil {
+		return
+	}
+	l.logMessage(dnstap.Message_CLIENT_QUERY, q, nil, clientAddr, time.Time{}, time.Now())
+}
+
+// LogClientResponse records a CLIENT_RESPONSE event: the final response
+// written back to clientAddr.
+func (l *Logger) LogClientResponse(q, resp *dns.Msg, clientAddr net.Addr) {
+	if l == nil {
+		return
+	}
+	l.logMessage(dnstap.Message_CLIENT_RESPONSE, q, resp, clientAddr, time.Time{}, time.Now())
+}
+
+// LogResolverQuery records a RESOLVER_QUERY event: the query this resolver
+// sent to upstream, queryTime marking when it was sent.
+func (l *Logger) LogResolverQuery(q *dns.Msg, upstream string, queryTime time.Time) {
+	if l == nil {
+		return
+	}
+	l.logResolverMessage(dnstap.Message_RESOLVER_QUERY, q, nil, upstream, queryTime, time.Time{})
+}
+
+// LogResolverResponse records a RESOLVER_RESPONSE event: upstream's reply,
+// queryTime/responseTime bounding the round trip.
+func (l *Logger) LogResolverResponse(q, resp *dns.Msg, upstream string, queryTime, responseTime time.Time) {
+	if l == nil {
+		return
+	}
+	l.logResolverMessage(dnstap.Message_RESOLVER_RESPONSE, q, resp, upstream, queryTime, responseTime)
+}
+
+// LogCacheHit records this resolver's CACHE_HIT extension for a query
+// answered from cache without an upstream round trip.
+func (l *Logger) LogCacheHit(q *dns.Msg) {
+	if l == nil {
+		return
+	}
+	l.logCacheEvent(cacheHitExtra, q)
+}
+
+// LogCacheMiss records this resolver's CACHE_MISS extension for a query
+// that fell through to an upstream lookup.
+func (l *Logger) LogCacheMiss(q *dns.Msg) {
+	if l == nil {
+		return
+	}
+	l.logCacheEvent(cacheMissExtra, q)
+}
+
+// LogCacheHitQuestion is LogCacheHit for a caller (e.g. ShardedCache) that
+// only has the question, not a full *dns.Msg, on hand.
+func (l *Logger) LogCacheHitQuestion(q dns.Question) {
+	if l == nil {
+		return
+	}
+	l.logCacheEvent(cacheHitExtra, questionMsg(q))
+}
+
+// LogCacheMissQuestion is LogCacheMiss for a caller that only has the
+// question, not a full *dns.Msg, on hand.
+func (l *Logger) LogCacheMissQuestion(q dns.Question) {
+	if l == nil {
+		return
+	}
+	l.logCacheEvent(cacheMissExtra, questionMsg(q))
+}
+
+// questionMsg builds a minimal *dns.Msg wrapping q, just enough to pack onto
+// the wire for a dnstap frame.
+func questionMsg(q dns.Question) *dns.Msg {
+	msg := new(dns.Msg)
+	msg.SetQuestion(q.Name, q.Qtype)
+	return msg
+}
+
+// logMessage builds and enqueues a standard dnstap Message frame. clientAddr
+// is only meaningful for CLIENT_QUERY/CLIENT_RESPONSE; queryTime/
+// responseTime, when non-zero, are stamped onto the message.
+func (l *Logger) logMessage(mtype dnstap.Message_Type, q, resp *dns.Msg, clientAddr net.Addr, queryTime, responseTime time.Time) {
+	msg := &dnstap.Message{Type: &mtype}
+
+	if clientAddr != nil {
+		setSocketAddr(msg, clientAddr, true)
+	}
+	if q != nil {
+		if wire, err := q.Pack(); err == nil {
+			msg.QueryMessage = wire
+		}
+	}
+	if resp != nil {
+		if wire, err := resp.Pack(); err == nil {
+			msg.ResponseMessage = wire
+		}
+	}
+	stampTimes(msg, queryTime, responseTime)
+
+	l.enqueue(msg)
+}
+
+// logResolverMessage is logMessage plus the upstream server's address,
+// parsed out of the "host:port" form the backends use.
+func (l *Logger) logResolverMessage(mtype dnstap.Message_Type, q, resp *dns.Msg, upstream string, queryTime, responseTime time.Time) {
+	msg := &dnstap.Message{Type: &mtype}
+
+	if q != nil {
+		if wire, err := q.Pack(); err == nil {
+			msg.QueryMessage = wire
+		}
+	}
+	if resp != nil {
+		if wire, err := resp.Pack(); err == nil {
+			msg.ResponseMessage = wire
+		}
+	}
+	if addr, err := net.ResolveUDPAddr("udp", upstream); err == nil {
+		setSocketAddr(msg, addr, false)
+	}
+	stampTimes(msg, queryTime, responseTime)
+
+	l.enqueue(msg)
+}
+
+// logCacheEvent builds the CACHE_HIT/CACHE_MISS extension frame: a bare
+// Message carrying only the query, with extra identifying which of the two
+// this is, since Message.Type has no value for either.
+func (l *Logger) logCacheEvent(extra cacheExtra, q *dns.Msg) {
+	mtype := dnstap.Message_CLIENT_QUERY
+	msg := &dnstap.Message{Type: &mtype}
+	if wire, err := q.Pack(); err == nil {
+		msg.QueryMessage = wire
+	}
+	now := time.Now()
+	stampTimes(msg, now, time.Time{})
+
+	frame := &dnstap.Dnstap{
+		Identity: l.identity,
+		Version:  l.version,
+		Type:     dnstap.Dnstap_MESSAGE.Enum(),
+		Message:  msg,
+		Extra:    []byte(extra),
+	}
+	l.send(frame)
+}
+
+// enqueue wraps msg in its Dnstap envelope and sends it.
+func (l *Logger) enqueue(msg *dnstap.Message) {
+	frame := &dnstap.Dnstap{
+		Identity: l.identity,
+		Version:  l.version,
+		Type:     dnstap.Dnstap_MESSAGE.Enum(),
+		Message:  msg,
+	}
+	l.send(frame)
+}
+
+// send marshals frame and pushes it onto the bounded queue, dropping the
+// oldest queued frame to make room when it's full rather than blocking the
+// caller (a DNS request-handling goroutine).
+func (l *Logger) send(frame *dnstap.Dnstap) {
+	wire, err := proto.Marshal(frame)
+	if err != nil {
+		return
+	}
+
+	select {
+	case l.queue <- wire:
+		return
+	default:
+	}
+
+	atomic.AddInt64(&l.dropped, 1)
+	select {
+	case <-l.queue:
+	default:
+	}
+	select {
+	case l.queue <- wire:
+	default:
+	}
+}
+
+// drain is the single goroutine that owns writes to l.sink, so a slow sink
+// only ever backs up the queue, never a query-handling goroutine.
+func (l *Logger) drain() {
+	for wire := range l.queue {
+		_ = l.sink.Write(wire)
+	}
+}
+
+// stampTimes sets QueryTimeSec/Nsec and ResponseTimeSec/Nsec on msg from
+// whichever of queryTime/responseTime are non-zero.
+func stampTimes(msg *dnstap.Message, queryTime, responseTime time.Time) {
+	if !queryTime.IsZero() {
+		sec := uint64(queryTime.Unix())
+		nsec := uint32(queryTime.Nanosecond())
+		msg.QueryTimeSec = &sec
+		msg.QueryTimeNsec = &nsec
+	}
+	if !responseTime.IsZero() {
+		sec := uint64(responseTime.Unix())
+		nsec := uint32(responseTime.Nanosecond())
+		msg.ResponseTimeSec = &sec
+		msg.ResponseTimeNsec = &nsec
+	}
+}
+
+// setSocketAddr fills in msg's address/port fields from addr, as the
+// query-side fields when isClient is true (QueryAddress/QueryPort) or the
+// response-side fields otherwise (ResponseAddress/ResponsePort), along with
+// the socket family/protocol the standard schema expects.
+func setSocketAddr(msg *dnstap.Message, addr net.Addr, isClient bool) {
+	host, portStr, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return
+	}
+	port, err := parsePort(portStr)
+	if err != nil {
+		return
+	}
+
+	family := dnstap.SocketFamily_INET
+	if ip.To4() == nil {
+		family = dnstap.SocketFamily_INET6
+	}
+	sockProto := dnstap.SocketProtocol_UDP
+	if _, ok := addr.(*net.TCPAddr); ok {
+		sockProto = dnstap.SocketProtocol_TCP
+	}
+	msg.SocketFamily = &family
+	msg.SocketProtocol = &sockProto
+
+	portU32 := uint32(port)
+	if isClient {
+		msg.QueryAddress = ip
+		msg.QueryPort = &portU32
+	} else {
+		msg.ResponseAddress = ip
+		msg.ResponsePort = &portU32
+	}
+}
+
+// parsePort parses a port number out of the string half of a
+// net.SplitHostPort result.
+func parsePort(s string) (int, error) {
+	return strconv.Atoi(s)
+}
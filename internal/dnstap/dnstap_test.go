@@ -0,0 +1,160 @@
+package dnstap
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"dns-resolver/internal/config"
+
+	dnstap "github.com/dnstap/golang-dnstap"
+	"github.com/miekg/dns"
+	"google.golang.org/protobuf/proto"
+)
+
+// memSink is a Sink that appends every write to an in-memory slice, for
+// test assertions.
+type memSink struct {
+	frames [][]byte
+}
+
+func (s *memSink) Write(frame []byte) error {
+	s.frames = append(s.frames, append([]byte(nil), frame...))
+	return nil
+}
+
+func (s *memSink) Close() error { return nil }
+
+func newTestLogger(sink Sink) *Logger {
+	l := &Logger{
+		sink:     sink,
+		identity: []byte("test"),
+		version:  []byte("test"),
+		queue:    make(chan []byte, 8),
+	}
+	go l.drain()
+	return l
+}
+
+func waitForFrames(t *testing.T, sink *memSink, n int) [][]byte {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		if len(sink.frames) >= n {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	return sink.frames
+}
+
+func TestNilLogger_MethodsAreNoops(t *testing.T) {
+	var l *Logger
+
+	q := new(dns.Msg)
+	q.SetQuestion("example.com.", dns.TypeA)
+
+	l.LogClientQuery(q, &net.UDPAddr{IP: net.ParseIP("203.0.113.1"), Port: 53})
+	l.LogClientResponse(q, q, &net.UDPAddr{IP: net.ParseIP("203.0.113.1"), Port: 53})
+	l.LogResolverQuery(q, "8.8.8.8:53", time.Now())
+	l.LogResolverResponse(q, q, "8.8.8.8:53", time.Now(), time.Now())
+	l.LogCacheHit(q)
+	l.LogCacheMiss(q)
+	l.LogCacheHitQuestion(q.Question[0])
+	l.LogCacheMissQuestion(q.Question[0])
+
+	if got := l.Dropped(); got != 0 {
+		t.Errorf("expected a nil Logger to report 0 dropped frames, got %d", got)
+	}
+	if err := l.Close(); err != nil {
+		t.Errorf("expected a nil Logger to close cleanly, got %v", err)
+	}
+}
+
+func TestNew_DisabledReturnsNilLogger(t *testing.T) {
+	l, err := New(&config.Config{DnstapEnabled: false})
+	if err != nil {
+		t.Fatalf("New returned error: %v", err)
+	}
+	if l != nil {
+		t.Errorf("expected a nil *Logger when dnstap is disabled, got %v", l)
+	}
+}
+
+func TestNew_UnknownSink(t *testing.T) {
+	_, err := New(&config.Config{DnstapEnabled: true, DnstapSink: "carrier-pigeon"})
+	if err == nil {
+		t.Fatal("expected an error for an unrecognized sink kind")
+	}
+}
+
+func TestLogClientQuery_EmitsClientQueryMessage(t *testing.T) {
+	sink := &memSink{}
+	l := newTestLogger(sink)
+
+	q := new(dns.Msg)
+	q.SetQuestion("example.com.", dns.TypeA)
+	l.LogClientQuery(q, &net.UDPAddr{IP: net.ParseIP("203.0.113.1"), Port: 5353})
+
+	frames := waitForFrames(t, sink, 1)
+	if len(frames) != 1 {
+		t.Fatalf("expected 1 emitted frame, got %d", len(frames))
+	}
+
+	var frame dnstap.Dnstap
+	if err := proto.Unmarshal(frames[0], &frame); err != nil {
+		t.Fatalf("failed to unmarshal frame: %v", err)
+	}
+	msg := frame.Message
+	if msg.GetType() != dnstap.Message_CLIENT_QUERY {
+		t.Errorf("expected CLIENT_QUERY, got %s", msg.GetType())
+	}
+	if !net.IP(msg.QueryAddress).Equal(net.ParseIP("203.0.113.1")) {
+		t.Errorf("expected query address 203.0.113.1, got %s", msg.QueryAddress)
+	}
+	if msg.GetQueryPort() != 5353 {
+		t.Errorf("expected query port 5353, got %d", msg.GetQueryPort())
+	}
+
+	var packed dns.Msg
+	if err := packed.Unpack(msg.QueryMessage); err != nil {
+		t.Fatalf("failed to unpack QueryMessage: %v", err)
+	}
+	if packed.Question[0].Name != "example.com." {
+		t.Errorf("expected qname example.com., got %q", packed.Question[0].Name)
+	}
+}
+
+func TestLogCacheHitQuestion_SetsExtraMarker(t *testing.T) {
+	sink := &memSink{}
+	l := newTestLogger(sink)
+
+	l.LogCacheHitQuestion(dns.Question{Name: "cached.example.", Qtype: dns.TypeA, Qclass: dns.ClassINET})
+
+	frames := waitForFrames(t, sink, 1)
+	var frame dnstap.Dnstap
+	if err := proto.Unmarshal(frames[0], &frame); err != nil {
+		t.Fatalf("failed to unmarshal frame: %v", err)
+	}
+	if string(frame.Extra) != string(cacheHitExtra) {
+		t.Errorf("expected Extra %q, got %q", cacheHitExtra, frame.Extra)
+	}
+}
+
+func TestEnqueue_DropsOldestWhenFull(t *testing.T) {
+	l := &Logger{queue: make(chan []byte, 2), identity: []byte("x"), version: []byte("x")}
+
+	mtype := dnstap.Message_CLIENT_QUERY
+	frame := &dnstap.Dnstap{Type: dnstap.Dnstap_MESSAGE.Enum(), Message: &dnstap.Message{Type: &mtype}}
+
+	l.send(frame)
+	l.send(frame)
+	l.send(frame) // queue is full; the first frame should be dropped to make room
+
+	if got := l.Dropped(); got != 1 {
+		t.Errorf("expected 1 dropped frame, got %d", got)
+	}
+	if got := len(l.queue); got != 2 {
+		t.Errorf("expected 2 frames left queued, got %d", got)
+	}
+}
@@ -0,0 +1,256 @@
+package dnstap
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"dns-resolver/internal/config"
+)
+
+// contentType is the Frame Streams content type string identifying the
+// payload as dnstap protobuf frames, per the dnstap specification.
+const contentType = "protobuf:dnstap.Dnstap"
+
+// Frame Streams control frame types (see
+// https://github.com/farsightsec/fstrm/blob/master/fstrm/control.h).
+const (
+	fstrmControlStart     uint32 = 1
+	fstrmControlStop      uint32 = 2
+	fstrmControlReady     uint32 = 3
+	fstrmControlAccept    uint32 = 4
+	fstrmFieldContentType uint32 = 1
+)
+
+// Sink writes one already-encoded dnstap frame (the raw protobuf bytes of a
+// Dnstap message, not yet length-prefixed) onto a transport. Write must be
+// safe to call from multiple goroutines (it isn't in practice, since Logger
+// only ever calls it from its single drain goroutine, but implementations
+// guard it anyway so they're safe to reuse outside that caller too).
+type Sink interface {
+	Write(frame []byte) error
+	Close() error
+}
+
+// newSink builds the Sink cfg.DnstapSink selects.
+func newSink(cfg *config.Config) (Sink, error) {
+	switch cfg.DnstapSink {
+	case "unix":
+		return newStreamSink("unix", cfg.DnstapSocketPath)
+	case "tcp":
+		return newStreamSink("tcp", cfg.DnstapTCPAddr)
+	case "file":
+		return newFileSink(cfg.DnstapFilePath, cfg.DnstapFileMaxSizeMB, cfg.DnstapFileMaxAge)
+	default:
+		return nil, fmt.Errorf("dnstap: unknown sink %q (want \"unix\", \"tcp\", or \"file\")", cfg.DnstapSink)
+	}
+}
+
+// writeFrame length-prefixes payload (a data frame) with a 4-byte
+// big-endian length and writes it to w, per the Frame Streams wire format.
+// An empty payload is reserved for control frames and must go through
+// writeControlFrame instead.
+func writeFrame(w io.Writer, payload []byte) error {
+	var lenBuf [4]byte
+	binary.BigEndian.PutUint32(lenBuf[:], uint32(len(payload)))
+	if _, err := w.Write(lenBuf[:]); err != nil {
+		return err
+	}
+	_, err := w.Write(payload)
+	return err
+}
+
+// writeControlFrame writes a Frame Streams control frame: the escape
+// sequence (a zero-length data frame), the control frame's own length, its
+// type, and (for START) a CONTENT_TYPE field carrying contentType.
+func writeControlFrame(w io.Writer, frameType uint32) error {
+	var body []byte
+	body = appendUint32(body, frameType)
+	if frameType == fstrmControlStart {
+		body = appendUint32(body, fstrmFieldContentType)
+		body = appendUint32(body, uint32(len(contentType)))
+		body = append(body, contentType...)
+	}
+
+	var zero [4]byte
+	if _, err := w.Write(zero[:]); err != nil {
+		return err
+	}
+	var lenBuf [4]byte
+	binary.BigEndian.PutUint32(lenBuf[:], uint32(len(body)))
+	if _, err := w.Write(lenBuf[:]); err != nil {
+		return err
+	}
+	_, err := w.Write(body)
+	return err
+}
+
+func appendUint32(b []byte, v uint32) []byte {
+	var buf [4]byte
+	binary.BigEndian.PutUint32(buf[:], v)
+	return append(b, buf[:]...)
+}
+
+// streamSink is a Frame Streams sink over a unix or tcp connection: START is
+// sent once at handshake, STOP at Close, and every frame in between is a
+// plain data frame. It mirrors plugins/query_logger's shipperSink: dial
+// lazily, reuse the connection, and redial on the next write after any
+// error instead of failing the whole sink.
+type streamSink struct {
+	mu      sync.Mutex
+	network string // "unix" or "tcp"
+	addr    string
+	conn    net.Conn
+}
+
+func newStreamSink(network, addr string) (*streamSink, error) {
+	if addr == "" {
+		return nil, fmt.Errorf("dnstap: %s sink requires an address", network)
+	}
+	return &streamSink{network: network, addr: addr}, nil
+}
+
+func (s *streamSink) Write(frame []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.conn == nil {
+		conn, err := net.DialTimeout(s.network, s.addr, 5*time.Second)
+		if err != nil {
+			return fmt.Errorf("dnstap: dialing %s %s: %w", s.network, s.addr, err)
+		}
+		if err := writeControlFrame(conn, fstrmControlStart); err != nil {
+			conn.Close()
+			return fmt.Errorf("dnstap: sending START to %s %s: %w", s.network, s.addr, err)
+		}
+		s.conn = conn
+	}
+
+	if err := writeFrame(s.conn, frame); err != nil {
+		s.conn.Close()
+		s.conn = nil
+		return fmt.Errorf("dnstap: writing to %s %s: %w", s.network, s.addr, err)
+	}
+	return nil
+}
+
+func (s *streamSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.conn == nil {
+		return nil
+	}
+	err := writeControlFrame(s.conn, fstrmControlStop)
+	if cerr := s.conn.Close(); err == nil {
+		err = cerr
+	}
+	s.conn = nil
+	return err
+}
+
+// fileSink writes a Frame Streams-formatted .fstrm file, rotating it once it
+// exceeds maxSizeBytes or has been open longer than maxAge (either check is
+// skipped if its threshold is zero). It mirrors plugins/query_logger's
+// fileSink.
+type fileSink struct {
+	mu          sync.Mutex
+	path        string
+	maxSizeByte int64
+	maxAge      time.Duration
+
+	f        *os.File
+	curSize  int64
+	openedAt time.Time
+}
+
+func newFileSink(path string, maxSizeMB int, maxAge time.Duration) (*fileSink, error) {
+	if path == "" {
+		return nil, fmt.Errorf("dnstap: file sink requires a path")
+	}
+	s := &fileSink{
+		path:        path,
+		maxSizeByte: int64(maxSizeMB) * 1024 * 1024,
+		maxAge:      maxAge,
+	}
+	if err := s.open(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *fileSink) open() error {
+	f, err := os.OpenFile(s.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("dnstap: opening %s: %w", s.path, err)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return fmt.Errorf("dnstap: stat %s: %w", s.path, err)
+	}
+	s.f = f
+	s.curSize = info.Size()
+	s.openedAt = time.Now()
+	return writeControlFrame(s.f, fstrmControlStart)
+}
+
+func (s *fileSink) Write(frame []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.needsRotation(int64(len(frame) + 4)) {
+		if err := s.rotate(); err != nil {
+			// Keep writing to the over-sized/over-age file rather than
+			// dropping the frame; rotation will be retried next write.
+			return err
+		}
+	}
+
+	before := s.curSize
+	if err := writeFrame(s.f, frame); err != nil {
+		return err
+	}
+	s.curSize = before + int64(len(frame)) + 4
+	return nil
+}
+
+func (s *fileSink) needsRotation(nextWrite int64) bool {
+	if s.maxSizeByte > 0 && s.curSize+nextWrite > s.maxSizeByte {
+		return true
+	}
+	if s.maxAge > 0 && time.Since(s.openedAt) > s.maxAge {
+		return true
+	}
+	return false
+}
+
+// rotate closes the current file (after a STOP control frame), renames it
+// aside with a timestamp suffix, and opens a fresh file at the original
+// path.
+func (s *fileSink) rotate() error {
+	if err := writeControlFrame(s.f, fstrmControlStop); err != nil {
+		return fmt.Errorf("dnstap: sending STOP before rotating %s: %w", s.path, err)
+	}
+	if err := s.f.Close(); err != nil {
+		return fmt.Errorf("dnstap: closing %s before rotation: %w", s.path, err)
+	}
+	rotated := fmt.Sprintf("%s.%s", s.path, time.Now().UTC().Format("20060102T150405"))
+	if err := os.Rename(s.path, rotated); err != nil {
+		return fmt.Errorf("dnstap: rotating %s: %w", s.path, err)
+	}
+	return s.open()
+}
+
+func (s *fileSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := writeControlFrame(s.f, fstrmControlStop); err != nil {
+		s.f.Close()
+		return err
+	}
+	return s.f.Close()
+}
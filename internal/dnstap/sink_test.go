@@ -0,0 +1,144 @@
+package dnstap
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestWriteFrame_LengthPrefixesPayload(t *testing.T) {
+	var buf bytes.Buffer
+	if err := writeFrame(&buf, []byte("hello")); err != nil {
+		t.Fatalf("writeFrame returned error: %v", err)
+	}
+
+	got := buf.Bytes()
+	if len(got) != 4+5 {
+		t.Fatalf("expected a 4-byte length prefix plus 5-byte payload, got %d bytes", len(got))
+	}
+	if n := binary.BigEndian.Uint32(got[:4]); n != 5 {
+		t.Errorf("expected length prefix 5, got %d", n)
+	}
+	if string(got[4:]) != "hello" {
+		t.Errorf("expected payload %q, got %q", "hello", got[4:])
+	}
+}
+
+func TestWriteControlFrame_Start_CarriesContentType(t *testing.T) {
+	var buf bytes.Buffer
+	if err := writeControlFrame(&buf, fstrmControlStart); err != nil {
+		t.Fatalf("writeControlFrame returned error: %v", err)
+	}
+
+	got := buf.Bytes()
+	// Escape sequence: a zero-length data frame.
+	if n := binary.BigEndian.Uint32(got[:4]); n != 0 {
+		t.Fatalf("expected the escape sequence's length field to be 0, got %d", n)
+	}
+	bodyLen := binary.BigEndian.Uint32(got[4:8])
+	body := got[8 : 8+bodyLen]
+
+	if n := binary.BigEndian.Uint32(body[:4]); n != fstrmControlStart {
+		t.Errorf("expected control type START, got %d", n)
+	}
+	if n := binary.BigEndian.Uint32(body[4:8]); n != fstrmFieldContentType {
+		t.Errorf("expected a CONTENT_TYPE field, got field type %d", n)
+	}
+	ctLen := binary.BigEndian.Uint32(body[8:12])
+	if string(body[12:12+ctLen]) != contentType {
+		t.Errorf("expected content type %q, got %q", contentType, body[12:12+ctLen])
+	}
+}
+
+func TestWriteControlFrame_Stop_HasNoContentType(t *testing.T) {
+	var buf bytes.Buffer
+	if err := writeControlFrame(&buf, fstrmControlStop); err != nil {
+		t.Fatalf("writeControlFrame returned error: %v", err)
+	}
+
+	got := buf.Bytes()
+	bodyLen := binary.BigEndian.Uint32(got[4:8])
+	if bodyLen != 4 {
+		t.Errorf("expected a STOP control frame body of just the 4-byte type, got %d bytes", bodyLen)
+	}
+	body := got[8 : 8+bodyLen]
+	if n := binary.BigEndian.Uint32(body); n != fstrmControlStop {
+		t.Errorf("expected control type STOP, got %d", n)
+	}
+}
+
+func TestNewStreamSink_RequiresAddr(t *testing.T) {
+	if _, err := newStreamSink("tcp", ""); err == nil {
+		t.Fatal("expected an error for an empty address")
+	}
+}
+
+func TestNewFileSink_WritesStartFrame(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dnstap.fstrm")
+	s, err := newFileSink(path, 0, 0)
+	if err != nil {
+		t.Fatalf("newFileSink returned error: %v", err)
+	}
+	defer s.Close()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed to read sink file: %v", err)
+	}
+	if len(data) == 0 {
+		t.Fatal("expected the START control frame to be written immediately on open")
+	}
+}
+
+func TestFileSink_RotatesOnSize(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dnstap.fstrm")
+	s, err := newFileSink(path, 0, 0)
+	if err != nil {
+		t.Fatalf("newFileSink returned error: %v", err)
+	}
+	s.maxSizeByte = 1 // force rotation on the very next write
+	defer s.Close()
+
+	if err := s.Write([]byte("first")); err != nil {
+		t.Fatalf("Write returned error: %v", err)
+	}
+	if err := s.Write([]byte("second")); err != nil {
+		t.Fatalf("Write returned error: %v", err)
+	}
+
+	matches, err := filepath.Glob(path + ".*")
+	if err != nil {
+		t.Fatalf("Glob returned error: %v", err)
+	}
+	if len(matches) != 1 {
+		t.Fatalf("expected exactly 1 rotated file, got %d: %v", len(matches), matches)
+	}
+	if _, err := os.Stat(path); err != nil {
+		t.Fatalf("expected a fresh file at the original path after rotation: %v", err)
+	}
+}
+
+func TestFileSink_RotatesOnAge(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dnstap.fstrm")
+	s, err := newFileSink(path, 0, time.Nanosecond)
+	if err != nil {
+		t.Fatalf("newFileSink returned error: %v", err)
+	}
+	defer s.Close()
+	time.Sleep(time.Millisecond)
+
+	if err := s.Write([]byte("frame")); err != nil {
+		t.Fatalf("Write returned error: %v", err)
+	}
+
+	matches, err := filepath.Glob(path + ".*")
+	if err != nil {
+		t.Fatalf("Glob returned error: %v", err)
+	}
+	if len(matches) != 1 {
+		t.Fatalf("expected exactly 1 rotated file from the age check, got %d: %v", len(matches), matches)
+	}
+}
@@ -0,0 +1,101 @@
+// Package ecs builds, reads, and strips the EDNS Client Subnet (RFC 7871)
+// option shared by the backends that attach it to upstream queries and the
+// server that must not leak it back to a client that never asked for it.
+package ecs
+
+import (
+	"net"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// Allowed reports whether ECS should be attached for qname, given allowlist
+// (suffix-matched zones/domains). An empty allowlist allows every name.
+func Allowed(qname string, allowlist []string) bool {
+	if len(allowlist) == 0 {
+		return true
+	}
+	qname = strings.ToLower(qname)
+	for _, zone := range allowlist {
+		if dns.IsSubDomain(dns.Fqdn(zone), qname) {
+			return true
+		}
+	}
+	return false
+}
+
+// Attach adds an EDNS Client Subnet option derived from clientAddr to m,
+// truncated to prefixV4/prefixV6 bits depending on address family. It
+// requires m to already carry an OPT record (e.g. via SetEdns0) and is a
+// no-op if clientAddr can't be classified as IPv4 or IPv6.
+func Attach(m *dns.Msg, clientAddr net.IP, prefixV4, prefixV6 int) {
+	opt := m.IsEdns0()
+	if opt == nil {
+		return
+	}
+
+	subnet := new(dns.EDNS0_SUBNET)
+	if v4 := clientAddr.To4(); v4 != nil {
+		subnet.Family = 1
+		subnet.SourceNetmask = uint8(prefixV4)
+		subnet.Address = v4.Mask(net.CIDRMask(prefixV4, 32))
+	} else if v6 := clientAddr.To16(); v6 != nil {
+		subnet.Family = 2
+		subnet.SourceNetmask = uint8(prefixV6)
+		subnet.Address = v6.Mask(net.CIDRMask(prefixV6, 128))
+	} else {
+		return
+	}
+
+	opt.Option = append(opt.Option, subnet)
+}
+
+// FromMsg returns the first EDNS Client Subnet option found in m's OPT
+// record, if any.
+func FromMsg(m *dns.Msg) (*dns.EDNS0_SUBNET, bool) {
+	opt := m.IsEdns0()
+	if opt == nil {
+		return nil, false
+	}
+	for _, o := range opt.Option {
+		if subnet, ok := o.(*dns.EDNS0_SUBNET); ok {
+			return subnet, true
+		}
+	}
+	return nil, false
+}
+
+// Strip removes any EDNS Client Subnet option from m's OPT record, so a
+// subnet hint meant for an upstream resolver never leaks back to a client
+// that didn't ask for it.
+func Strip(m *dns.Msg) {
+	opt := m.IsEdns0()
+	if opt == nil {
+		return
+	}
+	kept := opt.Option[:0]
+	for _, o := range opt.Option {
+		if _, ok := o.(*dns.EDNS0_SUBNET); ok {
+			continue
+		}
+		kept = append(kept, o)
+	}
+	opt.Option = kept
+}
+
+// Subnet formats addr truncated to prefix bits as a CIDR string, to
+// partition cache entries by client subnet (e.g. for a SCOPE-aware cache
+// key). prefix is interpreted as /prefix out of 32 bits for an IPv4 addr and
+// out of 128 bits for an IPv6 one.
+func Subnet(addr net.IP, prefix int) string {
+	if v4 := addr.To4(); v4 != nil {
+		mask := net.CIDRMask(prefix, 32)
+		return (&net.IPNet{IP: v4.Mask(mask), Mask: mask}).String()
+	}
+	if v6 := addr.To16(); v6 != nil {
+		mask := net.CIDRMask(prefix, 128)
+		return (&net.IPNet{IP: v6.Mask(mask), Mask: mask}).String()
+	}
+	return ""
+}
@@ -0,0 +1,119 @@
+package ecs
+
+import (
+	"net"
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+func TestAllowed(t *testing.T) {
+	tests := []struct {
+		name      string
+		qname     string
+		allowlist []string
+		want      bool
+	}{
+		{"empty allowlist allows everything", "example.com.", nil, true},
+		{"exact match", "example.com.", []string{"example.com."}, true},
+		{"subdomain match", "www.example.com.", []string{"example.com."}, true},
+		{"case insensitive", "WWW.EXAMPLE.COM.", []string{"example.com."}, true},
+		{"no match", "example.net.", []string{"example.com."}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Allowed(tt.qname, tt.allowlist); got != tt.want {
+				t.Errorf("Allowed(%q, %v) = %v, want %v", tt.qname, tt.allowlist, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAttachAndFromMsg(t *testing.T) {
+	m := new(dns.Msg)
+	m.SetQuestion("example.com.", dns.TypeA)
+	m.SetEdns0(4096, false)
+
+	Attach(m, net.ParseIP("203.0.113.42"), 24, 56)
+
+	subnet, ok := FromMsg(m)
+	if !ok {
+		t.Fatal("FromMsg: no ECS option found after Attach")
+	}
+	if subnet.Family != 1 {
+		t.Errorf("Family = %d, want 1", subnet.Family)
+	}
+	if subnet.SourceNetmask != 24 {
+		t.Errorf("SourceNetmask = %d, want 24", subnet.SourceNetmask)
+	}
+	if subnet.Address.String() != "203.0.113.0" {
+		t.Errorf("Address = %s, want 203.0.113.0", subnet.Address)
+	}
+}
+
+func TestAttachIPv6(t *testing.T) {
+	m := new(dns.Msg)
+	m.SetQuestion("example.com.", dns.TypeAAAA)
+	m.SetEdns0(4096, false)
+
+	Attach(m, net.ParseIP("2001:db8::1"), 24, 56)
+
+	subnet, ok := FromMsg(m)
+	if !ok {
+		t.Fatal("FromMsg: no ECS option found after Attach")
+	}
+	if subnet.Family != 2 {
+		t.Errorf("Family = %d, want 2", subnet.Family)
+	}
+	if subnet.SourceNetmask != 56 {
+		t.Errorf("SourceNetmask = %d, want 56", subnet.SourceNetmask)
+	}
+}
+
+func TestAttachWithoutEdns0IsNoop(t *testing.T) {
+	m := new(dns.Msg)
+	m.SetQuestion("example.com.", dns.TypeA)
+
+	Attach(m, net.ParseIP("203.0.113.42"), 24, 56)
+
+	if _, ok := FromMsg(m); ok {
+		t.Error("FromMsg: found an ECS option despite no OPT record being present")
+	}
+}
+
+func TestStrip(t *testing.T) {
+	m := new(dns.Msg)
+	m.SetQuestion("example.com.", dns.TypeA)
+	m.SetEdns0(4096, false)
+	Attach(m, net.ParseIP("203.0.113.42"), 24, 56)
+
+	Strip(m)
+
+	if _, ok := FromMsg(m); ok {
+		t.Error("FromMsg: ECS option survived Strip")
+	}
+	if m.IsEdns0() == nil {
+		t.Error("Strip removed the OPT record entirely, want it kept")
+	}
+}
+
+func TestSubnet(t *testing.T) {
+	tests := []struct {
+		name   string
+		addr   string
+		prefix int
+		want   string
+	}{
+		{"ipv4", "203.0.113.42", 24, "203.0.113.0/24"},
+		{"ipv6", "2001:db8::1", 56, "2001:db8::/56"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Subnet(net.ParseIP(tt.addr), tt.prefix); got != tt.want {
+				t.Errorf("Subnet(%s, %d) = %q, want %q", tt.addr, tt.prefix, got, tt.want)
+			}
+		})
+	}
+}
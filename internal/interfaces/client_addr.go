@@ -0,0 +1,26 @@
+package interfaces
+
+import (
+	"context"
+	"net"
+)
+
+// clientAddrKey is the context.Context key under which the querying
+// client's source address is stashed by the server before it calls into a
+// resolver, so a Backend several layers down (e.g. the stub backend
+// attaching an EDNS Client Subnet option) can recover it without every
+// intermediate signature threading it through explicitly.
+type clientAddrKey struct{}
+
+// ContextWithClientAddr returns a copy of ctx carrying addr as the
+// originating client's source address.
+func ContextWithClientAddr(ctx context.Context, addr net.IP) context.Context {
+	return context.WithValue(ctx, clientAddrKey{}, addr)
+}
+
+// ClientAddrFromContext returns the client address previously stored by
+// ContextWithClientAddr, if any.
+func ClientAddrFromContext(ctx context.Context) (net.IP, bool) {
+	addr, ok := ctx.Value(clientAddrKey{}).(net.IP)
+	return addr, ok
+}
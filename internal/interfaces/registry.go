@@ -0,0 +1,45 @@
+package interfaces
+
+import (
+	"fmt"
+	"sync"
+
+	"dns-resolver/internal/config"
+)
+
+// BackendFactory constructs a Backend from the resolver's configuration.
+type BackendFactory func(cfg *config.Config) (Backend, error)
+
+var (
+	backendsMu sync.RWMutex
+	backends   = make(map[string]BackendFactory)
+)
+
+// RegisterBackend makes a Backend implementation available under name for
+// use in Config.ResolverType chains. It is meant to be called from a
+// package's init() function, mirroring how database/sql drivers register
+// themselves. Registering the same name twice panics, since it almost
+// always indicates two backend packages were imported by mistake.
+func RegisterBackend(name string, factory BackendFactory) {
+	backendsMu.Lock()
+	defer backendsMu.Unlock()
+
+	if _, exists := backends[name]; exists {
+		panic(fmt.Sprintf("interfaces: RegisterBackend called twice for backend %q", name))
+	}
+	backends[name] = factory
+}
+
+// GetBackend looks up a previously registered BackendFactory by name and
+// constructs a Backend from it. It reports an error if no backend was
+// registered under that name, e.g. because its package was never imported.
+func GetBackend(name string, cfg *config.Config) (Backend, error) {
+	backendsMu.RLock()
+	factory, ok := backends[name]
+	backendsMu.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("interfaces: no backend registered under name %q", name)
+	}
+	return factory(cfg)
+}
@@ -0,0 +1,44 @@
+package interfaces
+
+import (
+	"context"
+	"testing"
+
+	"dns-resolver/internal/config"
+
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeBackend struct{}
+
+func (fakeBackend) Exchange(ctx context.Context, req *dns.Msg) (*dns.Msg, DNSSECStatus, error) {
+	return new(dns.Msg), DNSSECInsecure, nil
+}
+
+func TestRegisterAndGetBackend(t *testing.T) {
+	RegisterBackend("test-registry-fake", func(cfg *config.Config) (Backend, error) {
+		return fakeBackend{}, nil
+	})
+
+	b, err := GetBackend("test-registry-fake", &config.Config{})
+	assert.NoError(t, err)
+	assert.NotNil(t, b)
+}
+
+func TestGetBackend_UnknownNameErrors(t *testing.T) {
+	_, err := GetBackend("does-not-exist", &config.Config{})
+	assert.Error(t, err)
+}
+
+func TestRegisterBackend_PanicsOnDuplicateName(t *testing.T) {
+	RegisterBackend("test-registry-dup", func(cfg *config.Config) (Backend, error) {
+		return fakeBackend{}, nil
+	})
+
+	assert.Panics(t, func() {
+		RegisterBackend("test-registry-dup", func(cfg *config.Config) (Backend, error) {
+			return fakeBackend{}, nil
+		})
+	})
+}
@@ -0,0 +1,101 @@
+// Package logging builds the package-level *slog.Logger used by
+// background-loop code (metrics collection, cache prefetching) that isn't
+// tied to any one request and so can't use reqlog's context-scoped logger.
+// It wraps a JSON or text slog.Handler, selected by config.Config.LogFormat,
+// with an optional dedup layer that suppresses a message repeating
+// identically within config.Config.LogDedupWindow, so a failing upstream
+// can't flood the log with one line per prefetch retry.
+package logging
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"dns-resolver/internal/config"
+)
+
+// New builds a *slog.Logger per cfg.LogFormat/LogDedupWindow, writing to
+// os.Stderr.
+func New(cfg *config.Config) *slog.Logger {
+	var handler slog.Handler
+	if cfg.LogFormat == "json" {
+		handler = slog.NewJSONHandler(os.Stderr, nil)
+	} else {
+		handler = slog.NewTextHandler(os.Stderr, nil)
+	}
+	if cfg.LogDedupWindow > 0 {
+		handler = newDedupHandler(handler, cfg.LogDedupWindow)
+	}
+	return slog.New(handler)
+}
+
+// dedupState is shared by a dedupHandler and every handler WithAttrs/
+// WithGroup derives from it, so a dedup decision made through one derived
+// logger is visible to records logged through another.
+type dedupState struct {
+	mu   sync.Mutex
+	seen map[string]time.Time
+}
+
+// dedupHandler drops a record whose level, message, and attributes exactly
+// match one already emitted within window.
+type dedupHandler struct {
+	next   slog.Handler
+	window time.Duration
+	state  *dedupState
+}
+
+func newDedupHandler(next slog.Handler, window time.Duration) *dedupHandler {
+	return &dedupHandler{
+		next:   next,
+		window: window,
+		state:  &dedupState{seen: make(map[string]time.Time)},
+	}
+}
+
+func (h *dedupHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.next.Enabled(ctx, level)
+}
+
+func (h *dedupHandler) Handle(ctx context.Context, r slog.Record) error {
+	key := dedupKey(r)
+
+	h.state.mu.Lock()
+	last, seen := h.state.seen[key]
+	now := time.Now()
+	if seen && now.Sub(last) < h.window {
+		h.state.mu.Unlock()
+		return nil
+	}
+	h.state.seen[key] = now
+	h.state.mu.Unlock()
+
+	return h.next.Handle(ctx, r)
+}
+
+func (h *dedupHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &dedupHandler{next: h.next.WithAttrs(attrs), window: h.window, state: h.state}
+}
+
+func (h *dedupHandler) WithGroup(name string) slog.Handler {
+	return &dedupHandler{next: h.next.WithGroup(name), window: h.window, state: h.state}
+}
+
+// dedupKey identifies a record by its level, message, and attributes, so
+// two calls are "identical" only if they'd render the same line.
+func dedupKey(r slog.Record) string {
+	var b strings.Builder
+	b.WriteString(r.Level.String())
+	b.WriteByte('|')
+	b.WriteString(r.Message)
+	r.Attrs(func(a slog.Attr) bool {
+		b.WriteByte('|')
+		b.WriteString(a.String())
+		return true
+	})
+	return b.String()
+}
@@ -0,0 +1,90 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"testing"
+	"time"
+
+	"dns-resolver/internal/config"
+)
+
+func TestNew_JSONFormat(t *testing.T) {
+	logger := New(&config.Config{LogFormat: "json"})
+	if logger == nil {
+		t.Fatal("expected a non-nil logger")
+	}
+}
+
+func TestNew_DefaultsToText(t *testing.T) {
+	logger := New(&config.Config{})
+	if logger == nil {
+		t.Fatal("expected a non-nil logger")
+	}
+}
+
+func TestDedupHandler_SuppressesWithinWindow(t *testing.T) {
+	var buf bytes.Buffer
+	base := slog.NewJSONHandler(&buf, nil)
+	h := newDedupHandler(base, time.Hour)
+	logger := slog.New(h)
+
+	logger.Info("prefetch failed", "qname", "example.com.")
+	logger.Info("prefetch failed", "qname", "example.com.")
+	logger.Info("prefetch failed", "qname", "other.com.")
+
+	lines := nonEmptyLines(buf.String())
+	if len(lines) != 2 {
+		t.Fatalf("expected 2 logged lines (the repeat suppressed), got %d: %v", len(lines), lines)
+	}
+}
+
+func TestDedupHandler_AllowsAfterWindowExpires(t *testing.T) {
+	var buf bytes.Buffer
+	base := slog.NewJSONHandler(&buf, nil)
+	h := newDedupHandler(base, time.Millisecond)
+	logger := slog.New(h)
+
+	logger.Info("prefetch failed", "qname", "example.com.")
+	time.Sleep(5 * time.Millisecond)
+	logger.Info("prefetch failed", "qname", "example.com.")
+
+	lines := nonEmptyLines(buf.String())
+	if len(lines) != 2 {
+		t.Fatalf("expected 2 logged lines once the dedup window has passed, got %d: %v", len(lines), lines)
+	}
+}
+
+func TestDedupHandler_WithAttrsSharesState(t *testing.T) {
+	var buf bytes.Buffer
+	base := slog.NewJSONHandler(&buf, nil)
+	h := newDedupHandler(base, time.Hour)
+	logger := slog.New(h).With("shard", 3)
+
+	logger.Info("prefetch failed", "qname", "example.com.")
+	logger.Info("prefetch failed", "qname", "example.com.")
+
+	lines := nonEmptyLines(buf.String())
+	if len(lines) != 1 {
+		t.Fatalf("expected the repeat through a derived (With) logger to still be suppressed, got %d lines: %v", len(lines), lines)
+	}
+
+	var entry map[string]any
+	if err := json.Unmarshal([]byte(lines[0]), &entry); err != nil {
+		t.Fatalf("failed to parse log line: %v", err)
+	}
+	if entry["shard"] != float64(3) {
+		t.Errorf("expected shard attr to survive through the dedup handler, got %v", entry["shard"])
+	}
+}
+
+func nonEmptyLines(s string) []string {
+	var out []string
+	for _, line := range bytes.Split([]byte(s), []byte("\n")) {
+		if len(line) > 0 {
+			out = append(out, string(line))
+		}
+	}
+	return out
+}
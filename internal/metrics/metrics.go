@@ -1,11 +1,15 @@
 package metrics
 
 import (
-	"log"
+	"log/slog"
 	"runtime"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"dns-resolver/internal/config"
+	"dns-resolver/internal/logging"
+
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promauto"
 	"github.com/shirou/gopsutil/v3/cpu"
@@ -13,21 +17,22 @@ import (
 	"github.com/shirou/gopsutil/v3/net"
 )
 
-// LatencyStat holds the total latency and count for a domain.
-type LatencyStat struct {
-	TotalLatency time.Duration
-	Count        int64
-}
-
 // Metrics holds the collected metrics.
 type Metrics struct {
 	sync.RWMutex
-	totalQueries      int64
-	startTime         time.Time
-	topNXDomains      sync.Map // map[string]int64
-	topLatencyDomains sync.Map // map[string]LatencyStat
-	queryTypes        sync.Map // map[string]int64
-	responseCodes     sync.Map // map[string]int64
+	totalQueries  int64
+	startTime     time.Time
+	topNXDomains  *nxDomainTracker
+	queryTypes    sync.Map // map[string]int64
+	responseCodes sync.Map // map[string]int64
+	// cachePrefetchStarted/Success/Failed back the /prefetch/stats
+	// dashboard endpoint; they're plain counters alongside the Prometheus
+	// ones below since Prometheus counters aren't readable back out.
+	cachePrefetchStarted int64
+	cachePrefetchSuccess int64
+	cachePrefetchFailed  int64
+
+	logger *slog.Logger
 }
 
 var (
@@ -74,10 +79,12 @@ var (
 		Name: "dns_resolver_top_nx_domains",
 		Help: "Top domains with NXDOMAIN responses",
 	}, []string{"domain"})
-	promTopLatencyDomains = promauto.NewGaugeVec(prometheus.GaugeOpts{
-		Name: "dns_resolver_top_latency_domains_ms",
-		Help: "Top domains by average query latency in milliseconds",
-	}, []string{"domain"})
+	promQueryLatency = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name: "dns_resolver_query_latency_seconds",
+		Help: "Query latency in seconds by query type",
+		// Tuned for DNS: 0.5ms up to ~2s, so p50/p95/p99 are all queryable.
+		Buckets: []float64{0.0005, 0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2},
+	}, []string{"qtype"})
 	promQueryTypes = promauto.NewCounterVec(prometheus.CounterOpts{
 		Name: "dns_resolver_query_types_total",
 		Help: "Total number of queries by type",
@@ -90,6 +97,26 @@ var (
 		Name: "dns_resolver_unbound_errors_total",
 		Help: "Total number of errors from the Unbound resolver",
 	})
+	promBackendErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "dns_resolver_backend_errors_total",
+		Help: "Total number of errors from a registered interfaces.Backend, by backend name",
+	}, []string{"backend"})
+	promParallelBestWins = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "dns_resolver_parallel_best_wins_total",
+		Help: "Total number of queries answered by each child backend of the parallel_best backend",
+	}, []string{"backend"})
+	promCachingBackendHits = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "dns_resolver_caching_backend_hits_total",
+		Help: "Total number of fresh cache hits served by the caching Backend wrapper",
+	})
+	promCachingBackendMisses = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "dns_resolver_caching_backend_misses_total",
+		Help: "Total number of cache misses in the caching Backend wrapper",
+	})
+	promCachingBackendStaleServes = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "dns_resolver_caching_backend_stale_serves_total",
+		Help: "Total number of stale answers served by the caching Backend wrapper while refreshing in the background",
+	})
 	promDNSSECValidation = promauto.NewCounterVec(prometheus.CounterOpts{
 		Name: "dns_resolver_dnssec_validation_total",
 		Help: "Total number of DNSSEC validation results by type",
@@ -98,14 +125,14 @@ var (
 		Name: "dns_resolver_cache_revalidations_total",
 		Help: "Total number of cache revalidations",
 	})
-	promCacheHits = promauto.NewCounter(prometheus.CounterOpts{
+	promCacheHits = promauto.NewCounterVec(prometheus.CounterOpts{
 		Name: "dns_resolver_cache_hits_total",
-		Help: "Total number of cache hits",
-	})
-	promCacheMisses = promauto.NewCounter(prometheus.CounterOpts{
+		Help: "Total number of cache hits, by cache tier (message is the only tier any resolver currently wires up; RRset/NSEC tiers exist in MultiLevelCache but aren't in the active resolution path yet)",
+	}, []string{"tier"})
+	promCacheMisses = promauto.NewCounterVec(prometheus.CounterOpts{
 		Name: "dns_resolver_cache_misses_total",
-		Help: "Total number of cache misses",
-	})
+		Help: "Total number of cache misses, by cache tier",
+	}, []string{"tier"})
 	promCacheEvictions = promauto.NewCounter(prometheus.CounterOpts{
 		Name: "dns_resolver_cache_evictions_total",
 		Help: "Total number of cache evictions",
@@ -122,21 +149,165 @@ var (
 		Name: "dns_resolver_prefetches_total",
 		Help: "Total number of cache prefetches",
 	})
+	promRejectedCacheHits = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "rejected_cache_hits_total",
+		Help: "Total number of rejected-response cache hits by reject reason",
+	}, []string{"reason"})
+	promCachePrefetches = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "cache_prefetches_total",
+		Help: "Total number of popularity-driven cache prefetches performed ahead of expiry",
+	})
+	promCachePrefetchEvictions = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "cache_prefetch_evictions_total",
+		Help: "Total number of prefetch hit-tracking evictions after a hot key was refreshed",
+	})
+	promCachePrefetchScheduled = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "cache_prefetch_scheduled_total",
+		Help: "Total number of TTL-driven prefetches scheduled for hot, near-expiry entries",
+	})
+	promCachePrefetchSuccess = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "cache_prefetch_success_total",
+		Help: "Total number of TTL-driven prefetches that completed successfully",
+	})
+	promCachePrefetchFailed = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "cache_prefetch_failed_total",
+		Help: "Total number of TTL-driven prefetches whose upstream refetch failed",
+	})
+	promUpstreamTransportLatency = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "dns_resolver_upstream_transport_latency_seconds",
+		Help:    "Upstream exchange latency by transport (udp, tcp, tls, doh)",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"transport"})
+	promUpstreamTransportHTTPStatus = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "dns_resolver_upstream_doh_http_status_total",
+		Help: "Total number of DoH upstream HTTP responses by status code",
+	}, []string{"status"})
+	promAggressiveNSECSynthesis = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "dns_resolver_aggressive_nsec_synthesis_total",
+		Help: "Total number of RFC 8198 aggressive NSEC/NSEC3 denial-of-existence synthesis attempts by outcome",
+	}, []string{"outcome"})
+	promCircuitBreakerTrips = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "dns_resolver_circuit_breaker_trips_total",
+		Help: "Total number of times the failover backend's per-child circuit breaker tripped open, by child backend name",
+	}, []string{"backend"})
+	promBackendLatency = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "dns_resolver_backend_latency_seconds",
+		Help:    "Exchange latency of a registered interfaces.Backend, by backend name",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"backend"})
+	promLBProbeOutcomes = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "dns_resolver_lb_probe_outcomes_total",
+		Help: "Total number of load balancer active health probe outcomes, by pool, backend and outcome (success/failure)",
+	}, []string{"pool", "backend", "outcome"})
+	promLBProbeLatency = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "dns_resolver_lb_probe_latency_seconds",
+		Help:    "Load balancer active health probe latency, by pool and backend",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"pool", "backend"})
+	promQueryLoggingDropped = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "dns_resolver_query_logging_dropped_total",
+		Help: "Total number of query log entries dropped because the logging queue was full",
+	})
+	promWorkerPoolQueueDepth = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "dns_resolver_worker_pool_queue_depth",
+		Help: "Number of jobs currently queued in a workerpool.Pool, by pool name",
+	}, []string{"pool"})
+	promWorkerPoolJobsDropped = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "dns_resolver_worker_pool_jobs_dropped_total",
+		Help: "Total number of jobs a workerpool.Pool rejected because its queue was full, by pool name",
+	}, []string{"pool"})
+	promWorkerPoolJobDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "dns_resolver_worker_pool_job_duration_seconds",
+		Help:    "How long a workerpool.Pool's Job.Execute took, by pool name",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"pool"})
+	promWorkerPoolWorkersBusy = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "dns_resolver_worker_pool_workers_busy",
+		Help: "Number of a workerpool.Pool's worker slots currently occupied, by pool name",
+	}, []string{"pool"})
+	promPersistentCacheOutcomes = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "dns_resolver_persistent_cache_outcomes_total",
+		Help: "Total number of lookups against the on-disk delegation-graph cache, by table (zone/ns) and outcome (hit/miss)",
+	}, []string{"table", "outcome"})
+	promAuthServerRTT = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "dns_resolver_authoritative_server_rtt_seconds",
+		Help:    "RTT of queries to an authoritative server, by zone and server, as ranked by goresolver.queryAuthoritativeServers",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"zone", "server"})
+	promAuthServerOutcomes = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "dns_resolver_authoritative_server_outcomes_total",
+		Help: "Total number of authoritative-server queries, by zone, server and outcome (success/failure)",
+	}, []string{"zone", "server", "outcome"})
+	promCacheAdmissionOutcomes = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "dns_resolver_cache_admission_outcomes_total",
+		Help: "Total number of W-TinyLFU admission decisions made when a new key falls out of a message cache shard's window segment, by outcome (admitted/rejected)",
+	}, []string{"outcome"})
+	promCacheAdmissionAgingResets = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "dns_resolver_cache_admission_aging_resets_total",
+		Help: "Total number of times a message cache shard's count-min sketch and doorkeeper were aged (halved/cleared) after enough inserts accumulated",
+	})
+	promPrefetchesSkippedLowPopularity = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "dns_resolver_prefetches_skipped_low_popularity_total",
+		Help: "Total number of message cache entries that hit the 10% TTL-remaining rule but were skipped because they hadn't been queried enough to clear the popularity gate",
+	})
+	promPrefetchesPopularityTriggered = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "dns_resolver_prefetches_popularity_triggered_total",
+		Help: "Total number of message cache prefetches triggered by the per-shard top-N hot-key tracker ahead of the 10% TTL-remaining rule",
+	})
+	promRemoteWriteSamplesSent = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "dns_resolver_remote_write_samples_sent_total",
+		Help: "Total number of samples successfully pushed to the configured Prometheus remote-write endpoint",
+	})
+	promRemoteWriteSamplesFailed = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "dns_resolver_remote_write_samples_failed_total",
+		Help: "Total number of samples a remote-write send gave up on after exhausting retries",
+	})
+	promRemoteWriteQueueLength = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "dns_resolver_remote_write_queue_length",
+		Help: "Total number of series currently queued across every remote-write shard, awaiting send",
+	})
+	promRemoteWriteShards = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "dns_resolver_remote_write_shards",
+		Help: "Current number of active remote-write sender shards",
+	})
 )
 
-// NewMetrics returns the singleton instance of Metrics.
-func NewMetrics() *Metrics {
+// NewMetrics returns the singleton instance of Metrics, built from cfg the
+// first time it's called; later calls return the same instance regardless
+// of cfg.
+func NewMetrics(cfg *config.Config) *Metrics {
 	once.Do(func() {
 		instance = &Metrics{
-			startTime: time.Now(),
+			startTime:    time.Now(),
+			logger:       logging.New(cfg),
+			topNXDomains: newNXDomainTracker(cfg.NXDomainTrackingCapacity),
 		}
 		go instance.qpsCalculator()
 		go instance.systemMetricsCollector()
 		go instance.topDomainsProcessor()
+		instance.startRemoteWrite(cfg)
 	})
 	return instance
 }
 
+// IncrementRemoteWriteSamplesSent records that n samples were successfully
+// pushed in one remote-write send.
+func (m *Metrics) IncrementRemoteWriteSamplesSent(n int) {
+	promRemoteWriteSamplesSent.Add(float64(n))
+}
+
+// IncrementRemoteWriteSamplesFailed records that n samples were dropped
+// after a remote-write send exhausted its retries.
+func (m *Metrics) IncrementRemoteWriteSamplesFailed(n int) {
+	promRemoteWriteSamplesFailed.Add(float64(n))
+}
+
+// SetRemoteWriteQueueLength publishes the total number of series currently
+// queued across every remote-write shard.
+func (m *Metrics) SetRemoteWriteQueueLength(n int) {
+	promRemoteWriteQueueLength.Set(float64(n))
+}
+
 // IncrementQueries increments the total number of queries.
 func (m *Metrics) IncrementQueries() {
 	m.Lock()
@@ -190,7 +361,7 @@ func (m *Metrics) systemMetricsCollector() {
 		}
 
 		if err != nil {
-			log.Printf("Error collecting system metrics: %v", err)
+			m.logger.Error("collecting system metrics", "error", err)
 		}
 	}
 }
@@ -203,97 +374,33 @@ func (m *Metrics) UpdateCacheStats(probation, protected int) {
 
 // RecordNXDOMAIN records an NXDOMAIN response for a given domain.
 func (m *Metrics) RecordNXDOMAIN(domain string) {
-	val, _ := m.topNXDomains.LoadOrStore(domain, int64(0))
-	m.topNXDomains.Store(domain, val.(int64)+1)
+	m.topNXDomains.record(domain)
 }
 
-// RecordLatency records the query latency for a given domain.
-func (m *Metrics) RecordLatency(domain string, latency time.Duration) {
-	val, _ := m.topLatencyDomains.LoadOrStore(domain, LatencyStat{})
-	stat := val.(LatencyStat)
-	stat.TotalLatency += latency
-	stat.Count++
-	m.topLatencyDomains.Store(domain, stat)
+// RecordLatency records the query latency for a given query type.
+func (m *Metrics) RecordLatency(qtype string, latency time.Duration) {
+	promQueryLatency.WithLabelValues(qtype).Observe(latency.Seconds())
 }
 
-// topDomainsProcessor periodically processes the domain maps to generate top lists.
+// topDomainsProcessor periodically republishes the current top-NXDOMAIN
+// heap; the heap itself is kept up to date incrementally by RecordNXDOMAIN,
+// so this never has to sort the whole tracked-domain set.
 func (m *Metrics) topDomainsProcessor() {
 	ticker := time.NewTicker(10 * time.Second)
 	defer ticker.Stop()
 
 	for range ticker.C {
 		m.processTopNXDomains()
-		m.processTopLatencyDomains()
 	}
 }
 
 func (m *Metrics) processTopNXDomains() {
-	var domains []struct {
-		Domain string
-		Count  int64
-	}
-	m.topNXDomains.Range(func(key, value interface{}) bool {
-		domains = append(domains, struct {
-			Domain string
-			Count  int64
-		}{key.(string), value.(int64)})
-		return true
-	})
-
-	// Sort and get top 10
-	// Simple bubble sort for demonstration
-	for i := 0; i < len(domains); i++ {
-		for j := i + 1; j < len(domains); j++ {
-			if domains[i].Count < domains[j].Count {
-				domains[i], domains[j] = domains[j], domains[i]
-			}
-		}
-	}
-	if len(domains) > 10 {
-		domains = domains[:10]
-	}
-
 	promTopNXDomains.Reset()
-	for _, d := range domains {
+	for _, d := range m.topNXDomains.top() {
 		promTopNXDomains.WithLabelValues(d.Domain).Set(float64(d.Count))
 	}
 }
 
-func (m *Metrics) processTopLatencyDomains() {
-	var domains []struct {
-		Domain     string
-		AvgLatency float64
-	}
-	m.topLatencyDomains.Range(func(key, value interface{}) bool {
-		stat := value.(LatencyStat)
-		if stat.Count > 0 {
-			avgLatency := stat.TotalLatency.Seconds() * 1000 / float64(stat.Count) // avg in ms
-			domains = append(domains, struct {
-				Domain     string
-				AvgLatency float64
-			}{key.(string), avgLatency})
-		}
-		return true
-	})
-
-	// Sort and get top 10
-	for i := 0; i < len(domains); i++ {
-		for j := i + 1; j < len(domains); j++ {
-			if domains[i].AvgLatency < domains[j].AvgLatency {
-				domains[i], domains[j] = domains[j], domains[i]
-			}
-		}
-	}
-	if len(domains) > 10 {
-		domains = domains[:10]
-	}
-
-	promTopLatencyDomains.Reset()
-	for _, d := range domains {
-		promTopLatencyDomains.WithLabelValues(d.Domain).Set(d.AvgLatency)
-	}
-}
-
 // RecordQueryType records the type of a DNS query.
 func (m *Metrics) RecordQueryType(qtype string) {
 	promQueryTypes.WithLabelValues(qtype).Inc()
@@ -309,6 +416,27 @@ func (m *Metrics) IncrementUnboundErrors() {
 	promUnboundErrors.Inc()
 }
 
+// IncrementBackendErrors increments the error counter for a registered
+// interfaces.Backend, identified by the name it was registered under.
+func (m *Metrics) IncrementBackendErrors(name string) {
+	promBackendErrors.WithLabelValues(name).Inc()
+}
+
+// IncrementCachingBackendHits increments the caching Backend wrapper's fresh-hit counter.
+func (m *Metrics) IncrementCachingBackendHits() {
+	promCachingBackendHits.Inc()
+}
+
+// IncrementCachingBackendMisses increments the caching Backend wrapper's miss counter.
+func (m *Metrics) IncrementCachingBackendMisses() {
+	promCachingBackendMisses.Inc()
+}
+
+// IncrementCachingBackendStaleServes increments the caching Backend wrapper's stale-serve counter.
+func (m *Metrics) IncrementCachingBackendStaleServes() {
+	promCachingBackendStaleServes.Inc()
+}
+
 // RecordDNSSECValidation records a DNSSEC validation result.
 func (m *Metrics) RecordDNSSECValidation(result string) {
 	promDNSSECValidation.WithLabelValues(result).Inc()
@@ -319,14 +447,14 @@ func (m *Metrics) IncrementCacheRevalidations() {
 	promCacheRevalidations.Inc()
 }
 
-// IncrementCacheHits increments the cache hit counter.
+// IncrementCacheHits increments the message-tier cache hit counter.
 func (m *Metrics) IncrementCacheHits() {
-	promCacheHits.Inc()
+	promCacheHits.WithLabelValues("message").Inc()
 }
 
-// IncrementCacheMisses increments the cache miss counter.
+// IncrementCacheMisses increments the message-tier cache miss counter.
 func (m *Metrics) IncrementCacheMisses() {
-	promCacheMisses.Inc()
+	promCacheMisses.WithLabelValues("message").Inc()
 }
 
 // IncrementCacheEvictions increments the cache eviction counter.
@@ -347,4 +475,201 @@ func (m *Metrics) IncrementLMDBErrors() {
 // IncrementPrefetches increments the prefetch counter.
 func (m *Metrics) IncrementPrefetches() {
 	promPrefetches.Inc()
-}
\ No newline at end of file
+}
+
+// IncrementRejectedCacheHits increments the rejected-response cache hit
+// counter for the given reject reason.
+func (m *Metrics) IncrementRejectedCacheHits(reason string) {
+	promRejectedCacheHits.WithLabelValues(reason).Inc()
+}
+
+// IncrementCachePrefetches increments the popularity-driven prefetch
+// counter, i.e. a hot key was refetched ahead of expiry.
+func (m *Metrics) IncrementCachePrefetches() {
+	promCachePrefetches.Inc()
+}
+
+// IncrementCachePrefetchEvictions increments the prefetch hit-tracking
+// eviction counter, i.e. a key's sliding-window hit history was cleared
+// after its prefetch-driven refresh landed.
+func (m *Metrics) IncrementCachePrefetchEvictions() {
+	promCachePrefetchEvictions.Inc()
+}
+
+// IncrementCachePrefetchScheduled increments the count of TTL-driven
+// prefetches scheduled for hot, near-expiry ShardedCache/NsecCache entries.
+func (m *Metrics) IncrementCachePrefetchScheduled() {
+	promCachePrefetchScheduled.Inc()
+	atomic.AddInt64(&m.cachePrefetchStarted, 1)
+}
+
+// IncrementCachePrefetchSuccess increments the count of TTL-driven
+// prefetches that completed successfully.
+func (m *Metrics) IncrementCachePrefetchSuccess() {
+	promCachePrefetchSuccess.Inc()
+	atomic.AddInt64(&m.cachePrefetchSuccess, 1)
+}
+
+// IncrementCachePrefetchFailed increments the count of TTL-driven
+// prefetches whose upstream refetch came back with an error.
+func (m *Metrics) IncrementCachePrefetchFailed() {
+	promCachePrefetchFailed.Inc()
+	atomic.AddInt64(&m.cachePrefetchFailed, 1)
+}
+
+// CachePrefetchStats returns the started/succeeded/failed counts for
+// TTL-driven cache prefetches, for the /prefetch/stats dashboard endpoint.
+func (m *Metrics) CachePrefetchStats() (started, success, failed int64) {
+	return atomic.LoadInt64(&m.cachePrefetchStarted), atomic.LoadInt64(&m.cachePrefetchSuccess), atomic.LoadInt64(&m.cachePrefetchFailed)
+}
+
+// IncrementParallelBestWins increments the race-win counter for name, the
+// child backend of the parallel_best backend whose answer was used.
+func (m *Metrics) IncrementParallelBestWins(name string) {
+	promParallelBestWins.WithLabelValues(name).Inc()
+}
+
+// RecordUpstreamTransportLatency records how long one upstream exchange
+// took over transport ("udp", "tcp", "tls", or "doh").
+func (m *Metrics) RecordUpstreamTransportLatency(transport string, latency time.Duration) {
+	promUpstreamTransportLatency.WithLabelValues(transport).Observe(latency.Seconds())
+}
+
+// RecordUpstreamDoHHTTPStatus increments the response counter for a DoH
+// upstream exchange's HTTP status code (or "error" if the request never got
+// a response to carry one).
+func (m *Metrics) RecordUpstreamDoHHTTPStatus(status string) {
+	promUpstreamTransportHTTPStatus.WithLabelValues(status).Inc()
+}
+
+// IncrementAggressiveNSECHits increments the count of queries answered
+// directly from a cached, DNSSEC-secure NSEC/NSEC3 covering proof, without
+// an upstream round trip.
+func (m *Metrics) IncrementAggressiveNSECHits() {
+	promAggressiveNSECSynthesis.WithLabelValues("hit").Inc()
+}
+
+// IncrementAggressiveNSECMisses increments the count of queries that had a
+// covering NSEC/NSEC3 record cached for their zone but couldn't be
+// synthesized from it (e.g. the proof wasn't DNSSEC-secure, or didn't
+// actually cover the name).
+func (m *Metrics) IncrementAggressiveNSECMisses() {
+	promAggressiveNSECSynthesis.WithLabelValues("miss").Inc()
+}
+
+// IncrementCircuitBreakerTrips increments the trip counter for a failover
+// backend's child identified by name, i.e. that child just started failing
+// fast instead of being tried on the next few queries.
+func (m *Metrics) IncrementCircuitBreakerTrips(name string) {
+	promCircuitBreakerTrips.WithLabelValues(name).Inc()
+}
+
+// RecordBackendLatency observes how long one exchange took against the
+// registered interfaces.Backend identified by name.
+func (m *Metrics) RecordBackendLatency(name string, latency time.Duration) {
+	promBackendLatency.WithLabelValues(name).Observe(latency.Seconds())
+}
+
+// RecordLBProbeOutcome observes one load balancer active health probe
+// against backend in pool: whether it succeeded and how long it took.
+func (m *Metrics) RecordLBProbeOutcome(pool, backend string, success bool, latency time.Duration) {
+	outcome := "success"
+	if !success {
+		outcome = "failure"
+	}
+	promLBProbeOutcomes.WithLabelValues(pool, backend, outcome).Inc()
+	promLBProbeLatency.WithLabelValues(pool, backend).Observe(latency.Seconds())
+}
+
+// IncrementQueryLoggingDropped records that a query log entry was dropped
+// because the logging plugin's internal queue was full.
+func (m *Metrics) IncrementQueryLoggingDropped() {
+	promQueryLoggingDropped.Inc()
+}
+
+// SetWorkerPoolQueueDepth publishes how many jobs are currently queued in
+// the named workerpool.Pool.
+func (m *Metrics) SetWorkerPoolQueueDepth(pool string, depth int) {
+	promWorkerPoolQueueDepth.WithLabelValues(pool).Set(float64(depth))
+}
+
+// IncrementWorkerPoolJobsDropped records that the named workerpool.Pool
+// rejected a job because its queue was full.
+func (m *Metrics) IncrementWorkerPoolJobsDropped(pool string) {
+	promWorkerPoolJobsDropped.WithLabelValues(pool).Inc()
+}
+
+// ObserveWorkerPoolJobDuration records how long one Job.Execute took on the
+// named workerpool.Pool.
+func (m *Metrics) ObserveWorkerPoolJobDuration(pool string, d time.Duration) {
+	promWorkerPoolJobDuration.WithLabelValues(pool).Observe(d.Seconds())
+}
+
+// AddWorkerPoolWorkersBusy adjusts the named workerpool.Pool's busy-worker
+// gauge by delta (+1 when a worker starts a job or Acquire succeeds, -1 when
+// it finishes or Release is called).
+func (m *Metrics) AddWorkerPoolWorkersBusy(pool string, delta int) {
+	promWorkerPoolWorkersBusy.WithLabelValues(pool).Add(float64(delta))
+}
+
+// IncrementPersistentCacheHit records a hit against the on-disk
+// delegation-graph cache's zone or ns table.
+func (m *Metrics) IncrementPersistentCacheHit(table string) {
+	promPersistentCacheOutcomes.WithLabelValues(table, "hit").Inc()
+}
+
+// IncrementPersistentCacheMiss records a miss against the on-disk
+// delegation-graph cache's zone or ns table.
+func (m *Metrics) IncrementPersistentCacheMiss(table string) {
+	promPersistentCacheOutcomes.WithLabelValues(table, "miss").Inc()
+}
+
+// ObserveAuthServerRTT records how long a query to server took while
+// resolving zone, whether or not it ultimately succeeded.
+func (m *Metrics) ObserveAuthServerRTT(zone, server string, rtt time.Duration) {
+	promAuthServerRTT.WithLabelValues(zone, server).Observe(rtt.Seconds())
+}
+
+// IncrementAuthServerOutcome records a success or failure against server
+// while resolving zone.
+func (m *Metrics) IncrementAuthServerOutcome(zone, server string, success bool) {
+	outcome := "failure"
+	if success {
+		outcome = "success"
+	}
+	promAuthServerOutcomes.WithLabelValues(zone, server, outcome).Inc()
+}
+
+// IncrementCacheAdmission records that a key evicted from a message cache
+// shard's W-TinyLFU window segment was admitted into (or displaced an
+// incumbent in) the SLRU probation segment.
+func (m *Metrics) IncrementCacheAdmission() {
+	promCacheAdmissionOutcomes.WithLabelValues("admitted").Inc()
+}
+
+// IncrementCacheRejection records that a key evicted from a message cache
+// shard's W-TinyLFU window segment was discarded because it wasn't hot
+// enough to displace the SLRU probation segment's own eviction candidate.
+func (m *Metrics) IncrementCacheRejection() {
+	promCacheAdmissionOutcomes.WithLabelValues("rejected").Inc()
+}
+
+// IncrementCacheAdmissionAgingReset records that a message cache shard's
+// count-min sketch counters were halved and its doorkeeper cleared.
+func (m *Metrics) IncrementCacheAdmissionAgingReset() {
+	promCacheAdmissionAgingResets.Inc()
+}
+
+// IncrementPrefetchesSkippedLowPopularity records that a message cache entry
+// within 10% of its original TTL was skipped for prefetch because it hadn't
+// been queried enough recently to clear the popularity gate.
+func (m *Metrics) IncrementPrefetchesSkippedLowPopularity() {
+	promPrefetchesSkippedLowPopularity.Inc()
+}
+
+// IncrementPrefetchesPopularityTriggered records that a message cache
+// prefetch was triggered by the per-shard top-N hot-key tracker, ahead of
+// (and regardless of) the 10% TTL-remaining rule.
+func (m *Metrics) IncrementPrefetchesPopularityTriggered() {
+	promPrefetchesPopularityTriggered.Inc()
+}
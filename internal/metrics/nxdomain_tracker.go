@@ -0,0 +1,187 @@
+package metrics
+
+import "sync"
+
+// nxDomainTopK is how many domains processTopNXDomains publishes.
+const nxDomainTopK = 10
+
+// nxDomainDefaultCapacity is the Misra-Gries sketch size used when
+// config.Config.NXDomainTrackingCapacity is unset.
+const nxDomainDefaultCapacity = 10000
+
+// nxDomainTracker counts NXDOMAIN responses per domain with bounded memory:
+// a Misra-Gries sketch caps how many distinct domains are tracked at once
+// (so a zone-walk attack against many distinct names can't grow it without
+// bound), and a small top-K min-heap is kept up to date incrementally so
+// the periodic processor never has to sort the whole sketch.
+type nxDomainTracker struct {
+	mu       sync.Mutex
+	capacity int
+	counts   map[string]int64
+	heap     nxDomainHeap
+	heapIdx  map[string]int // domain -> index into heap, for in-place updates
+}
+
+func newNXDomainTracker(capacity int) *nxDomainTracker {
+	if capacity <= 0 {
+		capacity = nxDomainDefaultCapacity
+	}
+	return &nxDomainTracker{
+		capacity: capacity,
+		counts:   make(map[string]int64),
+		heapIdx:  make(map[string]int),
+	}
+}
+
+// record registers one NXDOMAIN response for domain, using the classic
+// Misra-Gries update rule once the sketch is at capacity: an untracked
+// domain causes every counter to be decremented instead of being inserted,
+// which bounds memory while keeping heavy hitters approximately accurate.
+func (t *nxDomainTracker) record(domain string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if c, ok := t.counts[domain]; ok {
+		t.counts[domain] = c + 1
+		t.updateHeapLocked(domain, c+1)
+		return
+	}
+	if len(t.counts) < t.capacity {
+		t.counts[domain] = 1
+		t.updateHeapLocked(domain, 1)
+		return
+	}
+	for d, c := range t.counts {
+		if c <= 1 {
+			delete(t.counts, d)
+			t.removeHeapLocked(d)
+		} else {
+			t.counts[d] = c - 1
+			t.updateHeapLocked(d, c-1)
+		}
+	}
+}
+
+// updateHeapLocked keeps the bounded top-K heap current for domain's new
+// count. Callers must hold t.mu.
+func (t *nxDomainTracker) updateHeapLocked(domain string, count int64) {
+	if idx, ok := t.heapIdx[domain]; ok {
+		t.heap[idx].Count = count
+		t.heap.fix(t, idx)
+		return
+	}
+	if len(t.heap) < nxDomainTopK {
+		t.heap.push(t, nxDomainEntry{Domain: domain, Count: count})
+		return
+	}
+	if count > t.heap[0].Count {
+		t.heap.replaceMin(t, nxDomainEntry{Domain: domain, Count: count})
+	}
+}
+
+// removeHeapLocked drops domain from the top-K heap, if present. Callers
+// must hold t.mu.
+func (t *nxDomainTracker) removeHeapLocked(domain string) {
+	idx, ok := t.heapIdx[domain]
+	if !ok {
+		return
+	}
+	t.heap.removeAt(t, idx)
+}
+
+// top returns a snapshot of the current top-K heap contents, most-queried
+// domain first.
+func (t *nxDomainTracker) top() []nxDomainEntry {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	out := make([]nxDomainEntry, len(t.heap))
+	copy(out, t.heap)
+	for i := 0; i < len(out); i++ {
+		for j := i + 1; j < len(out); j++ {
+			if out[j].Count > out[i].Count {
+				out[i], out[j] = out[j], out[i]
+			}
+		}
+	}
+	return out
+}
+
+// nxDomainEntry is one tracked domain's current NXDOMAIN count.
+type nxDomainEntry struct {
+	Domain string
+	Count  int64
+}
+
+// nxDomainHeap is a bounded min-heap over nxDomainEntry.Count, so the root
+// (index 0) is always the smallest count currently in the top-K. It's kept
+// deliberately small (nxDomainTopK entries), so the helper methods below use
+// plain index bookkeeping rather than container/heap.
+type nxDomainHeap []nxDomainEntry
+
+func (h nxDomainHeap) parent(i int) int { return (i - 1) / 2 }
+func (h nxDomainHeap) left(i int) int   { return 2*i + 1 }
+func (h nxDomainHeap) right(i int) int  { return 2*i + 2 }
+
+func (t *nxDomainTracker) swap(i, j int) {
+	t.heap[i], t.heap[j] = t.heap[j], t.heap[i]
+	t.heapIdx[t.heap[i].Domain] = i
+	t.heapIdx[t.heap[j].Domain] = j
+}
+
+func (h *nxDomainHeap) push(t *nxDomainTracker, e nxDomainEntry) {
+	*h = append(*h, e)
+	idx := len(*h) - 1
+	t.heapIdx[e.Domain] = idx
+	h.fix(t, idx)
+}
+
+// fix restores the min-heap property for the entry at idx after its count
+// changed, bubbling it up or down as needed.
+func (h nxDomainHeap) fix(t *nxDomainTracker, idx int) {
+	for idx > 0 && h[idx].Count < h[h.parent(idx)].Count {
+		p := h.parent(idx)
+		t.swap(idx, p)
+		idx = p
+	}
+	for {
+		smallest := idx
+		if l := h.left(idx); l < len(h) && h[l].Count < h[smallest].Count {
+			smallest = l
+		}
+		if r := h.right(idx); r < len(h) && h[r].Count < h[smallest].Count {
+			smallest = r
+		}
+		if smallest == idx {
+			return
+		}
+		t.swap(idx, smallest)
+		idx = smallest
+	}
+}
+
+// replaceMin overwrites the current minimum (the root) with e and restores
+// the heap property; used once the heap is at capacity and a higher count
+// displaces the smallest tracked entry.
+func (h *nxDomainHeap) replaceMin(t *nxDomainTracker, e nxDomainEntry) {
+	delete(t.heapIdx, (*h)[0].Domain)
+	(*h)[0] = e
+	t.heapIdx[e.Domain] = 0
+	h.fix(t, 0)
+}
+
+// removeAt deletes the entry at idx, moving the last entry into its place
+// and restoring the heap property.
+func (h *nxDomainHeap) removeAt(t *nxDomainTracker, idx int) {
+	last := len(*h) - 1
+	delete(t.heapIdx, (*h)[idx].Domain)
+	if idx == last {
+		*h = (*h)[:last]
+		return
+	}
+	t.swap(idx, last)
+	*h = (*h)[:last]
+	if idx < len(*h) {
+		h.fix(t, idx)
+	}
+}
@@ -0,0 +1,59 @@
+package metrics
+
+import "testing"
+
+func TestNXDomainTracker_TopReturnsHighestCounts(t *testing.T) {
+	tr := newNXDomainTracker(100)
+	for i := 0; i < 5; i++ {
+		tr.record("a.example.")
+	}
+	for i := 0; i < 2; i++ {
+		tr.record("b.example.")
+	}
+	tr.record("c.example.")
+
+	top := tr.top()
+	if len(top) != 3 {
+		t.Fatalf("expected 3 tracked domains, got %d", len(top))
+	}
+	if top[0].Domain != "a.example." || top[0].Count != 5 {
+		t.Errorf("expected a.example. with count 5 first, got %+v", top[0])
+	}
+}
+
+func TestNXDomainTracker_BoundsMemoryUnderCapacity(t *testing.T) {
+	const capacity = 10
+	tr := newNXDomainTracker(capacity)
+	for i := 0; i < capacity*20; i++ {
+		tr.record(randomishDomain(i))
+	}
+
+	tr.mu.Lock()
+	n := len(tr.counts)
+	tr.mu.Unlock()
+	if n > capacity {
+		t.Fatalf("expected tracked-domain map to stay within capacity %d, got %d", capacity, n)
+	}
+}
+
+func TestNXDomainTracker_HeapStaysWithinTopK(t *testing.T) {
+	tr := newNXDomainTracker(1000)
+	for i := 0; i < nxDomainTopK*3; i++ {
+		tr.record(randomishDomain(i))
+	}
+	if got := len(tr.top()); got > nxDomainTopK {
+		t.Fatalf("expected at most %d entries in the top-K heap, got %d", nxDomainTopK, got)
+	}
+}
+
+func TestNXDomainTracker_DefaultsCapacityWhenUnset(t *testing.T) {
+	tr := newNXDomainTracker(0)
+	if tr.capacity != nxDomainDefaultCapacity {
+		t.Errorf("expected default capacity %d, got %d", nxDomainDefaultCapacity, tr.capacity)
+	}
+}
+
+func randomishDomain(i int) string {
+	const letters = "abcdefghijklmnopqrstuvwxyz"
+	return string(letters[i%len(letters)]) + string(letters[(i/len(letters))%len(letters)]) + ".example."
+}
@@ -0,0 +1,449 @@
+package metrics
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"dns-resolver/internal/config"
+
+	"github.com/golang/snappy"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// remoteWriteShards is the fixed number of parallel sample queues/senders;
+// shardRate's EWMA only decides how many of these are *active* at any
+// moment (see pickShard), so growing never needs to allocate a new queue.
+const remoteWriteShards = 8
+
+// remoteWriteRateAlpha weights each gather tick's observed sample count
+// against the running throughput estimate that drives active shard count,
+// the same smoothing weight failover/parallelbest use for their EWMAs.
+const remoteWriteRateAlpha = 0.3
+
+// remoteWriteGrowThreshold/shrinkThreshold are samples-per-tick levels at
+// which the active shard count grows or shrinks by one, re-evaluated every
+// gather tick.
+const (
+	remoteWriteGrowThreshold   = 400
+	remoteWriteShrinkThreshold = 50
+)
+
+// rwLabel and rwSample mirror prompb.Label/Sample just closely enough to
+// encode the Prometheus remote-write wire format ourselves (see
+// encodeWriteRequest) without pulling in the full prometheus/prometheus
+// module for one small, stable message shape.
+type rwLabel struct {
+	Name  string
+	Value string
+}
+
+type rwSample struct {
+	Value       float64
+	TimestampMs int64
+}
+
+type rwSeries struct {
+	Labels  []rwLabel
+	Samples []rwSample
+}
+
+// startRemoteWrite wires up the remote-write exporter if cfg enables it:
+// a ticker gathers every series from the default Prometheus registry
+// (everything promauto.New* registered above, across every package that
+// holds a *Metrics) and fans it out across remoteWriteShards queues, each
+// drained by its own goroutine that batches and POSTs to cfg.RemoteWriteURL.
+func (m *Metrics) startRemoteWrite(cfg *config.Config) {
+	if !cfg.RemoteWriteEnabled {
+		return
+	}
+
+	maxSamples := cfg.RemoteWriteMaxSamplesPerSend
+	if maxSamples <= 0 {
+		maxSamples = 500
+	}
+	flushInterval := cfg.RemoteWriteFlushInterval
+	if flushInterval <= 0 {
+		flushInterval = 5 * time.Second
+	}
+	capacity := cfg.RemoteWriteQueueCapacity
+	if capacity <= 0 {
+		capacity = 10000
+	}
+
+	e := &remoteWriteExporter{
+		metrics: m,
+		client:  newRemoteWriteClient(cfg),
+	}
+	e.active.Store(1)
+	for i := 0; i < remoteWriteShards; i++ {
+		shard := &remoteWriteShard{queue: make(chan rwSeries, capacity)}
+		e.shards[i] = shard
+		go e.drain(shard, maxSamples, flushInterval)
+	}
+	promRemoteWriteShards.Set(1)
+
+	go e.gatherLoop(flushInterval)
+}
+
+// remoteWriteExporter owns the fixed shard array and the EWMA-driven active
+// count that picks how many of them gatherLoop spreads new samples across.
+type remoteWriteExporter struct {
+	metrics *Metrics
+	client  *remoteWriteClient
+	shards  [remoteWriteShards]*remoteWriteShard
+	active  atomic.Int32
+	next    atomic.Uint64
+	rate    float64 // EWMA of samples gathered per tick; owned by gatherLoop's goroutine only
+}
+
+// remoteWriteShard is one shard's queue of not-yet-sent series.
+type remoteWriteShard struct {
+	queue chan rwSeries
+}
+
+// gatherLoop periodically gathers every registered series and spreads it
+// round-robin across the currently active shards, then reassesses the
+// active count against the observed throughput.
+func (e *remoteWriteExporter) gatherLoop(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		series := gatherRemoteWriteSeries(prometheus.DefaultGatherer, time.Now())
+		for _, s := range series {
+			e.enqueue(s)
+		}
+
+		e.rate = e.rate*(1-remoteWriteRateAlpha) + float64(len(series))*remoteWriteRateAlpha
+		e.rescaleShards()
+		e.metrics.SetRemoteWriteQueueLength(e.queueLength())
+	}
+}
+
+// queueLength sums how many series are currently queued across every
+// shard, active or not (a shard just shrunk out of rotation can still be
+// draining).
+func (e *remoteWriteExporter) queueLength() int {
+	n := 0
+	for _, shard := range e.shards {
+		n += len(shard.queue)
+	}
+	return n
+}
+
+// rescaleShards grows or shrinks the active shard count by at most one per
+// tick based on e.rate, within [1, remoteWriteShards].
+func (e *remoteWriteExporter) rescaleShards() {
+	active := e.active.Load()
+	switch {
+	case e.rate > remoteWriteGrowThreshold*float64(active) && active < remoteWriteShards:
+		active++
+	case e.rate < remoteWriteShrinkThreshold*float64(active) && active > 1:
+		active--
+	default:
+		return
+	}
+	e.active.Store(active)
+	promRemoteWriteShards.Set(float64(active))
+}
+
+// enqueue round-robins s across the currently active shards, dropping the
+// oldest queued series on that shard if it's full rather than blocking the
+// gather tick.
+func (e *remoteWriteExporter) enqueue(s rwSeries) {
+	active := e.active.Load()
+	if active < 1 {
+		active = 1
+	}
+	idx := e.next.Add(1) % uint64(active)
+	shard := e.shards[idx]
+
+	select {
+	case shard.queue <- s:
+	default:
+		select {
+		case <-shard.queue:
+		default:
+		}
+		select {
+		case shard.queue <- s:
+		default:
+		}
+	}
+}
+
+// drain is a shard's single sender goroutine: it batches queued series up
+// to maxSamples or flushInterval, whichever comes first, and sends each
+// batch with retryWithBackoff.
+func (e *remoteWriteExporter) drain(shard *remoteWriteShard, maxSamples int, flushInterval time.Duration) {
+	batch := make([]rwSeries, 0, maxSamples)
+	ticker := time.NewTicker(flushInterval)
+	defer ticker.Stop()
+
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		e.send(batch)
+		batch = batch[:0]
+	}
+
+	for {
+		select {
+		case s := <-shard.queue:
+			batch = append(batch, s)
+			if len(batch) >= maxSamples {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		}
+	}
+}
+
+// send POSTs one batch, retrying on a 5xx with exponential backoff, and
+// records the outcome on e.metrics' meta-metrics either way.
+func (e *remoteWriteExporter) send(batch []rwSeries) {
+	n := sampleCount(batch)
+
+	const maxAttempts = 4
+	backoff := 500 * time.Millisecond
+	var err error
+	for attempt := 0; attempt < maxAttempts; attempt++ {
+		err = e.client.send(batch)
+		if err == nil {
+			e.metrics.IncrementRemoteWriteSamplesSent(n)
+			return
+		}
+		if _, retryable := err.(*remoteWriteRetryableError); !retryable {
+			break
+		}
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+	e.metrics.IncrementRemoteWriteSamplesFailed(n)
+}
+
+func sampleCount(batch []rwSeries) int {
+	n := 0
+	for _, s := range batch {
+		n += len(s.Samples)
+	}
+	return n
+}
+
+// remoteWriteClient POSTs a snappy-compressed, protobuf-encoded
+// WriteRequest to a configured Prometheus remote-write endpoint.
+type remoteWriteClient struct {
+	url         string
+	basicUser   string
+	basicPass   string
+	bearerToken string
+	httpClient  *http.Client
+}
+
+func newRemoteWriteClient(cfg *config.Config) *remoteWriteClient {
+	timeout := cfg.RemoteWriteTimeout
+	if timeout <= 0 {
+		timeout = 10 * time.Second
+	}
+	return &remoteWriteClient{
+		url:         cfg.RemoteWriteURL,
+		basicUser:   cfg.RemoteWriteBasicAuthUser,
+		basicPass:   cfg.RemoteWriteBasicAuthPass,
+		bearerToken: cfg.RemoteWriteBearerToken,
+		httpClient:  &http.Client{Timeout: timeout},
+	}
+}
+
+// remoteWriteRetryableError marks a 5xx response as worth retrying with
+// backoff, as opposed to a 4xx (bad request/auth) which won't fix itself.
+type remoteWriteRetryableError struct{ status int }
+
+func (e *remoteWriteRetryableError) Error() string {
+	return fmt.Sprintf("metrics: remote-write endpoint returned %d", e.status)
+}
+
+func (c *remoteWriteClient) send(series []rwSeries) error {
+	payload := encodeWriteRequest(series)
+	compressed := snappy.Encode(nil, payload)
+
+	req, err := http.NewRequest(http.MethodPost, c.url, bytes.NewReader(compressed))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Encoding", "snappy")
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	req.Header.Set("X-Prometheus-Remote-Write-Version", "0.1.0")
+	if c.bearerToken != "" {
+		req.Header.Set("Authorization", "Bearer "+c.bearerToken)
+	} else if c.basicUser != "" {
+		req.SetBasicAuth(c.basicUser, c.basicPass)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode/100 == 5 {
+		return &remoteWriteRetryableError{status: resp.StatusCode}
+	}
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("metrics: remote-write endpoint returned %s", resp.Status)
+	}
+	return nil
+}
+
+// gatherRemoteWriteSeries flattens every family g currently has registered
+// into one rwSeries per Counter/Gauge metric (and per bucket/_sum/_count
+// for a Histogram, the same expansion Prometheus's own exposition format
+// implies), each stamped with now as its single sample's timestamp.
+func gatherRemoteWriteSeries(g prometheus.Gatherer, now time.Time) []rwSeries {
+	families, err := g.Gather()
+	if err != nil {
+		return nil
+	}
+	ts := now.UnixMilli()
+
+	var out []rwSeries
+	for _, mf := range families {
+		name := mf.GetName()
+		switch mf.GetType() {
+		case dto.MetricType_COUNTER:
+			for _, m := range mf.Metric {
+				out = append(out, rwSeries{
+					Labels:  seriesLabels(name, m.GetLabel()),
+					Samples: []rwSample{{Value: m.GetCounter().GetValue(), TimestampMs: ts}},
+				})
+			}
+		case dto.MetricType_GAUGE:
+			for _, m := range mf.Metric {
+				out = append(out, rwSeries{
+					Labels:  seriesLabels(name, m.GetLabel()),
+					Samples: []rwSample{{Value: m.GetGauge().GetValue(), TimestampMs: ts}},
+				})
+			}
+		case dto.MetricType_HISTOGRAM:
+			for _, m := range mf.Metric {
+				h := m.GetHistogram()
+				for _, b := range h.GetBucket() {
+					labels := append(seriesLabels(name+"_bucket", m.GetLabel()), rwLabel{Name: "le", Value: formatBound(b.GetUpperBound())})
+					out = append(out, rwSeries{Labels: labels, Samples: []rwSample{{Value: float64(b.GetCumulativeCount()), TimestampMs: ts}}})
+				}
+				// Prometheus's own histogram exposition always includes the
+				// implicit +Inf bucket (cumulative count == the overall
+				// sample count) alongside the explicit ones; without it this
+				// isn't a valid cumulative histogram for histogram_quantile.
+				infLabels := append(seriesLabels(name+"_bucket", m.GetLabel()), rwLabel{Name: "le", Value: formatBound(math.Inf(1))})
+				out = append(out, rwSeries{Labels: infLabels, Samples: []rwSample{{Value: float64(h.GetSampleCount()), TimestampMs: ts}}})
+				out = append(out, rwSeries{
+					Labels:  seriesLabels(name+"_sum", m.GetLabel()),
+					Samples: []rwSample{{Value: h.GetSampleSum(), TimestampMs: ts}},
+				})
+				out = append(out, rwSeries{
+					Labels:  seriesLabels(name+"_count", m.GetLabel()),
+					Samples: []rwSample{{Value: float64(h.GetSampleCount()), TimestampMs: ts}},
+				})
+			}
+		}
+	}
+	return out
+}
+
+func seriesLabels(name string, pairs []*dto.LabelPair) []rwLabel {
+	labels := make([]rwLabel, 0, len(pairs)+1)
+	labels = append(labels, rwLabel{Name: "__name__", Value: name})
+	for _, p := range pairs {
+		labels = append(labels, rwLabel{Name: p.GetName(), Value: p.GetValue()})
+	}
+	return labels
+}
+
+func formatBound(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// The following encode the Prometheus remote-write WriteRequest message
+// (WriteRequest{repeated TimeSeries timeseries = 1}, TimeSeries{repeated
+// Label labels = 1; repeated Sample samples = 2}, Label{string name = 1;
+// string value = 2}, Sample{double value = 1; int64 timestamp = 2}) by hand
+// in plain protobuf wire format, rather than depending on the generated
+// prompb package from the full prometheus/prometheus module.
+
+func appendVarint(b []byte, v uint64) []byte {
+	for v >= 0x80 {
+		b = append(b, byte(v)|0x80)
+		v >>= 7
+	}
+	return append(b, byte(v))
+}
+
+func appendTag(b []byte, field, wireType int) []byte {
+	return appendVarint(b, uint64(field)<<3|uint64(wireType))
+}
+
+func appendLengthDelimited(b []byte, field int, data []byte) []byte {
+	b = appendTag(b, field, 2)
+	b = appendVarint(b, uint64(len(data)))
+	return append(b, data...)
+}
+
+func appendStringField(b []byte, field int, s string) []byte {
+	return appendLengthDelimited(b, field, []byte(s))
+}
+
+func appendFixed64Field(b []byte, field int, bits uint64) []byte {
+	b = appendTag(b, field, 1)
+	var buf [8]byte
+	binary.LittleEndian.PutUint64(buf[:], bits)
+	return append(b, buf[:]...)
+}
+
+func appendVarintFieldValue(b []byte, field int, v uint64) []byte {
+	b = appendTag(b, field, 0)
+	return appendVarint(b, v)
+}
+
+func encodeLabel(l rwLabel) []byte {
+	var b []byte
+	b = appendStringField(b, 1, l.Name)
+	b = appendStringField(b, 2, l.Value)
+	return b
+}
+
+func encodeSample(s rwSample) []byte {
+	var b []byte
+	b = appendFixed64Field(b, 1, math.Float64bits(s.Value))
+	b = appendVarintFieldValue(b, 2, uint64(s.TimestampMs))
+	return b
+}
+
+func encodeTimeSeries(ts rwSeries) []byte {
+	var b []byte
+	for _, l := range ts.Labels {
+		b = appendLengthDelimited(b, 1, encodeLabel(l))
+	}
+	for _, s := range ts.Samples {
+		b = appendLengthDelimited(b, 2, encodeSample(s))
+	}
+	return b
+}
+
+func encodeWriteRequest(series []rwSeries) []byte {
+	var b []byte
+	for _, ts := range series {
+		b = appendLengthDelimited(b, 1, encodeTimeSeries(ts))
+	}
+	return b
+}
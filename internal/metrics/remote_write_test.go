@@ -0,0 +1,234 @@
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/golang/snappy"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestAppendVarint_KnownEncodings(t *testing.T) {
+	cases := []struct {
+		v    uint64
+		want []byte
+	}{
+		{0, []byte{0x00}},
+		{1, []byte{0x01}},
+		{127, []byte{0x7f}},
+		{300, []byte{0xac, 0x02}},
+	}
+	for _, c := range cases {
+		got := appendVarint(nil, c.v)
+		if string(got) != string(c.want) {
+			t.Errorf("appendVarint(%d) = %x, want %x", c.v, got, c.want)
+		}
+	}
+}
+
+// decodedField is a minimal generic protobuf field, enough to verify the
+// hand-rolled encoder's structure without a full decoder.
+type decodedField struct {
+	num    int
+	wire   int
+	varint uint64
+	bytes  []byte
+}
+
+func decodeFields(t *testing.T, b []byte) []decodedField {
+	t.Helper()
+	var out []decodedField
+	i := 0
+	for i < len(b) {
+		tag, n := decodeVarintForTest(b[i:])
+		i += n
+		field := int(tag >> 3)
+		wireType := int(tag & 7)
+		switch wireType {
+		case 0:
+			v, n := decodeVarintForTest(b[i:])
+			i += n
+			out = append(out, decodedField{num: field, wire: wireType, varint: v})
+		case 1:
+			out = append(out, decodedField{num: field, wire: wireType, bytes: append([]byte(nil), b[i:i+8]...)})
+			i += 8
+		case 2:
+			length, n := decodeVarintForTest(b[i:])
+			i += n
+			out = append(out, decodedField{num: field, wire: wireType, bytes: append([]byte(nil), b[i:i+int(length)]...)})
+			i += int(length)
+		default:
+			t.Fatalf("unexpected wire type %d", wireType)
+		}
+	}
+	return out
+}
+
+func decodeVarintForTest(b []byte) (uint64, int) {
+	var x uint64
+	var s uint
+	for i, c := range b {
+		if c < 0x80 {
+			return x | uint64(c)<<s, i + 1
+		}
+		x |= uint64(c&0x7f) << s
+		s += 7
+	}
+	return 0, 0
+}
+
+func TestEncodeLabel_RoundTrips(t *testing.T) {
+	fields := decodeFields(t, encodeLabel(rwLabel{Name: "qname", Value: "example.com."}))
+	if len(fields) != 2 {
+		t.Fatalf("expected 2 fields (name, value), got %d", len(fields))
+	}
+	if string(fields[0].bytes) != "qname" {
+		t.Errorf("expected field 1 (name) %q, got %q", "qname", fields[0].bytes)
+	}
+	if string(fields[1].bytes) != "example.com." {
+		t.Errorf("expected field 2 (value) %q, got %q", "example.com.", fields[1].bytes)
+	}
+}
+
+func TestEncodeWriteRequest_OneEntryPerSeries(t *testing.T) {
+	series := []rwSeries{
+		{Labels: []rwLabel{{Name: "__name__", Value: "a"}}, Samples: []rwSample{{Value: 1, TimestampMs: 1000}}},
+		{Labels: []rwLabel{{Name: "__name__", Value: "b"}}, Samples: []rwSample{{Value: 2, TimestampMs: 1000}}},
+	}
+	fields := decodeFields(t, encodeWriteRequest(series))
+	if len(fields) != 2 {
+		t.Fatalf("expected 2 top-level timeseries entries, got %d", len(fields))
+	}
+	for _, f := range fields {
+		if f.num != 1 || f.wire != 2 {
+			t.Errorf("expected every entry to be a length-delimited field 1 (timeseries), got field %d wire %d", f.num, f.wire)
+		}
+	}
+}
+
+func TestGatherRemoteWriteSeries_FlattensCounterGaugeHistogram(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	counter := prometheus.NewCounter(prometheus.CounterOpts{Name: "test_counter_total", Help: "x"})
+	counter.Add(5)
+	gauge := prometheus.NewGauge(prometheus.GaugeOpts{Name: "test_gauge", Help: "x"})
+	gauge.Set(42)
+	hist := prometheus.NewHistogram(prometheus.HistogramOpts{Name: "test_hist_seconds", Help: "x", Buckets: []float64{0.1, 1}})
+	hist.Observe(0.5)
+	reg.MustRegister(counter, gauge, hist)
+
+	series := gatherRemoteWriteSeries(reg, time.Unix(0, 0))
+
+	byName := map[string]int{}
+	for _, s := range series {
+		for _, l := range s.Labels {
+			if l.Name == "__name__" {
+				byName[l.Value]++
+			}
+		}
+	}
+	if byName["test_counter_total"] != 1 {
+		t.Errorf("expected 1 series for the counter, got %d", byName["test_counter_total"])
+	}
+	if byName["test_gauge"] != 1 {
+		t.Errorf("expected 1 series for the gauge, got %d", byName["test_gauge"])
+	}
+	// 2 buckets + Inf bucket, plus _sum and _count.
+	if byName["test_hist_seconds_bucket"] != 3 {
+		t.Errorf("expected 3 bucket series (0.1, 1, +Inf), got %d", byName["test_hist_seconds_bucket"])
+	}
+	if byName["test_hist_seconds_sum"] != 1 || byName["test_hist_seconds_count"] != 1 {
+		t.Errorf("expected exactly one _sum and one _count series, got sum=%d count=%d", byName["test_hist_seconds_sum"], byName["test_hist_seconds_count"])
+	}
+}
+
+func TestRemoteWriteExporter_EnqueueDropsOldestWhenFull(t *testing.T) {
+	e := &remoteWriteExporter{shards: [remoteWriteShards]*remoteWriteShard{}}
+	for i := range e.shards {
+		e.shards[i] = &remoteWriteShard{queue: make(chan rwSeries, 2)}
+	}
+	e.active.Store(1)
+
+	a := rwSeries{Labels: []rwLabel{{Name: "__name__", Value: "a"}}}
+	b := rwSeries{Labels: []rwLabel{{Name: "__name__", Value: "b"}}}
+	c := rwSeries{Labels: []rwLabel{{Name: "__name__", Value: "c"}}}
+	e.enqueue(a)
+	e.enqueue(b)
+	e.enqueue(c) // shard 0's queue (capacity 2) is full; "a" should be dropped
+
+	shard := e.shards[0]
+	if got := len(shard.queue); got != 2 {
+		t.Fatalf("expected 2 series left queued, got %d", got)
+	}
+	first := <-shard.queue
+	second := <-shard.queue
+	if first.Labels[0].Value != "b" || second.Labels[0].Value != "c" {
+		t.Errorf("expected queue to contain [b c] after the drop, got [%s %s]", first.Labels[0].Value, second.Labels[0].Value)
+	}
+}
+
+func TestRemoteWriteExporter_RescaleShardsGrowsAndShrinks(t *testing.T) {
+	e := &remoteWriteExporter{}
+	e.active.Store(1)
+
+	e.rate = remoteWriteGrowThreshold * 2
+	e.rescaleShards()
+	if got := e.active.Load(); got != 2 {
+		t.Fatalf("expected active shard count to grow to 2, got %d", got)
+	}
+
+	e.rate = 0
+	e.rescaleShards()
+	if got := e.active.Load(); got != 1 {
+		t.Fatalf("expected active shard count to shrink back to 1, got %d", got)
+	}
+}
+
+func TestRemoteWriteClient_Send_SetsHeadersAndAuth(t *testing.T) {
+	var gotHeader http.Header
+	var gotBody []byte
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotHeader = r.Header.Clone()
+		body := make([]byte, r.ContentLength)
+		r.Body.Read(body)
+		gotBody = body
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	c := &remoteWriteClient{url: srv.URL, bearerToken: "tok", httpClient: srv.Client()}
+	series := []rwSeries{{Labels: []rwLabel{{Name: "__name__", Value: "x"}}, Samples: []rwSample{{Value: 1, TimestampMs: 1}}}}
+	if err := c.send(series); err != nil {
+		t.Fatalf("send returned error: %v", err)
+	}
+
+	if gotHeader.Get("Content-Encoding") != "snappy" {
+		t.Errorf("expected Content-Encoding: snappy, got %q", gotHeader.Get("Content-Encoding"))
+	}
+	if gotHeader.Get("Authorization") != "Bearer tok" {
+		t.Errorf("expected bearer auth header, got %q", gotHeader.Get("Authorization"))
+	}
+
+	decompressed, err := snappy.Decode(nil, gotBody)
+	if err != nil {
+		t.Fatalf("failed to snappy-decode request body: %v", err)
+	}
+	fields := decodeFields(t, decompressed)
+	if len(fields) != 1 {
+		t.Errorf("expected 1 timeseries entry in the request body, got %d", len(fields))
+	}
+}
+
+func TestRemoteWriteClient_Send_5xxIsRetryable(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	c := &remoteWriteClient{url: srv.URL, httpClient: srv.Client()}
+	err := c.send(nil)
+	if _, ok := err.(*remoteWriteRetryableError); !ok {
+		t.Fatalf("expected a *remoteWriteRetryableError for a 503, got %v (%T)", err, err)
+	}
+}
@@ -3,6 +3,8 @@ package plugins
 import (
 	"log"
 
+	"dns-resolver/internal/cache"
+
 	"github.com/miekg/dns"
 )
 
@@ -10,6 +12,39 @@ import (
 type PluginContext struct {
 	ResponseWriter dns.ResponseWriter
 	Stop           bool
+	// RejectedCache, when set, lets a plugin record that it blocked a query
+	// (e.g. by policy) so the resolver can short-circuit future lookups for
+	// the same question via RejectedResponseCache.Check instead of running
+	// this plugin chain again.
+	RejectedCache *cache.RejectedResponseCache
+	// FakeIP, when set (fake-IP mode enabled), lets a plugin resolve a fake
+	// IP back to the hostname it was allocated for, e.g. an upstream proxy
+	// plugin rewriting a flow's destination before forwarding it.
+	FakeIP *cache.FakeIPCache
+
+	data map[string]interface{}
+}
+
+// NewPluginContext returns an empty PluginContext ready for a single
+// request, with its Get/Set state bag initialized.
+func NewPluginContext() *PluginContext {
+	return &PluginContext{data: make(map[string]interface{})}
+}
+
+// Set stashes a value under key for the lifetime of this request's
+// PluginContext, so a plugin's Execute can pass state to its own
+// PostExecute (e.g. a start time to compute latency from).
+func (c *PluginContext) Set(key string, value interface{}) {
+	if c.data == nil {
+		c.data = make(map[string]interface{})
+	}
+	c.data[key] = value
+}
+
+// Get retrieves a value previously stashed with Set.
+func (c *PluginContext) Get(key string) (interface{}, bool) {
+	v, ok := c.data[key]
+	return v, ok
 }
 
 // Plugin is the interface that all plugins must implement.
@@ -18,6 +53,16 @@ type Plugin interface {
 	Execute(ctx *PluginContext, msg *dns.Msg) error
 }
 
+// PostExecutePlugin is an optional interface a Plugin can implement to run
+// logic after the resolver has produced and written a response, e.g.
+// structured query logging. PluginManager checks for it with a type
+// assertion (the same pattern interfaces.BackendLatencyObserver uses for
+// Backend), so implementing it doesn't require changing the Plugin
+// interface or any other plugin.
+type PostExecutePlugin interface {
+	PostExecute(ctx *PluginContext, query, response *dns.Msg)
+}
+
 // PluginManager manages the lifecycle of plugins.
 type PluginManager struct {
 	plugins []Plugin
@@ -46,4 +91,15 @@ func (pm *PluginManager) ExecutePlugins(ctx *PluginContext, msg *dns.Msg) {
 			break
 		}
 	}
-}
\ No newline at end of file
+}
+
+// ExecutePostPlugins runs every registered plugin that implements
+// PostExecutePlugin, in registration order, after query has been resolved
+// and response written to ctx.ResponseWriter.
+func (pm *PluginManager) ExecutePostPlugins(ctx *PluginContext, query, response *dns.Msg) {
+	for _, p := range pm.plugins {
+		if post, ok := p.(PostExecutePlugin); ok {
+			post.PostExecute(ctx, query, response)
+		}
+	}
+}
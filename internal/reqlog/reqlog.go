@@ -0,0 +1,45 @@
+// Package reqlog provides a request-scoped structured logger threaded
+// through a context.Context, so a single query's lifecycle (server handler,
+// resolver cache lookup, background revalidation, backend exchange) can be
+// traced end-to-end via shared fields instead of each log line re-deriving
+// its own qname/client formatting. It follows the same
+// context.WithValue-plus-accessor shape as
+// interfaces.ContextWithClientAddr/ClientAddrFromContext.
+package reqlog
+
+import (
+	"context"
+	"log/slog"
+	"net"
+)
+
+// loggerKey is the context.Context key under which a request-scoped
+// *slog.Logger is stashed.
+type loggerKey struct{}
+
+// NewContext returns a copy of ctx carrying logger, retrievable by FromCtx.
+func NewContext(ctx context.Context, logger *slog.Logger) context.Context {
+	return context.WithValue(ctx, loggerKey{}, logger)
+}
+
+// FromCtx returns the logger previously stored by NewContext, or
+// slog.Default() if ctx carries none, so callers never need a nil check.
+func FromCtx(ctx context.Context) *slog.Logger {
+	if logger, ok := ctx.Value(loggerKey{}).(*slog.Logger); ok {
+		return logger
+	}
+	return slog.Default()
+}
+
+// WithQuery returns a copy of ctx whose logger (FromCtx(ctx), or
+// slog.Default() if ctx carries none yet) has query_id, qname, and
+// client_ip fields attached, so every log line for this query's lifecycle
+// carries them without repeating them at each call site. clientIP may be
+// nil, e.g. for internally-triggered lookups with no originating client.
+func WithQuery(ctx context.Context, queryID uint16, qname string, clientIP net.IP) context.Context {
+	args := []any{"query_id", queryID, "qname", qname}
+	if clientIP != nil {
+		args = append(args, "client_ip", clientIP.String())
+	}
+	return NewContext(ctx, FromCtx(ctx).With(args...))
+}
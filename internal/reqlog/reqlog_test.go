@@ -0,0 +1,57 @@
+package reqlog
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net"
+	"testing"
+)
+
+func TestFromCtx_ReturnsDefaultWhenUnset(t *testing.T) {
+	if FromCtx(context.Background()) != slog.Default() {
+		t.Fatal("expected FromCtx to fall back to slog.Default() for a plain context")
+	}
+}
+
+func TestWithQuery_AttachesFields(t *testing.T) {
+	var buf bytes.Buffer
+	base := slog.New(slog.NewJSONHandler(&buf, nil))
+
+	ctx := NewContext(context.Background(), base)
+	ctx = WithQuery(ctx, 42, "example.com.", net.ParseIP("192.0.2.1"))
+
+	FromCtx(ctx).Info("resolved")
+
+	var entry map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+		t.Fatalf("failed to parse log output: %v", err)
+	}
+	if entry["qname"] != "example.com." {
+		t.Errorf("expected qname field, got %v", entry["qname"])
+	}
+	if entry["client_ip"] != "192.0.2.1" {
+		t.Errorf("expected client_ip field, got %v", entry["client_ip"])
+	}
+	if _, ok := entry["query_id"]; !ok {
+		t.Error("expected query_id field to be present")
+	}
+}
+
+func TestWithQuery_OmitsClientIPWhenNil(t *testing.T) {
+	var buf bytes.Buffer
+	base := slog.New(slog.NewJSONHandler(&buf, nil))
+
+	ctx := NewContext(context.Background(), base)
+	ctx = WithQuery(ctx, 1, "example.com.", nil)
+	FromCtx(ctx).Info("resolved")
+
+	var entry map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+		t.Fatalf("failed to parse log output: %v", err)
+	}
+	if _, ok := entry["client_ip"]; ok {
+		t.Error("expected no client_ip field for a nil client IP")
+	}
+}
@@ -0,0 +1,185 @@
+package resolver
+
+import (
+	"context"
+	"time"
+
+	"dns-resolver/internal/cache"
+	"dns-resolver/internal/config"
+	"dns-resolver/internal/interfaces"
+	"dns-resolver/internal/metrics"
+	"dns-resolver/internal/reqlog"
+	"dns-resolver/internal/workerpool"
+
+	"github.com/miekg/dns"
+	"golang.org/x/sync/singleflight"
+)
+
+// BackendResolver adapts any registered interfaces.Backend into a
+// ResolverInterface, adding the same caching, singleflight coalescing, and
+// background revalidation behavior as Resolver and KnotResolver. It's what
+// lets a Config.ResolverType chain drop in a cgo-free backend (e.g. "stub")
+// alongside the cgo-based resolvers without each backend reimplementing
+// that plumbing.
+type BackendResolver struct {
+	name       string
+	config     *config.Config
+	cache      *cache.Cache
+	sf         singleflight.Group
+	backend    interfaces.Backend
+	workerPool *workerpool.Pool
+	metrics    *metrics.Metrics
+}
+
+// NewBackendResolver builds a BackendResolver around a Backend registered
+// under name via interfaces.RegisterBackend.
+func NewBackendResolver(name string, cfg *config.Config, c *cache.Cache, m *metrics.Metrics) (*BackendResolver, error) {
+	b, err := interfaces.GetBackend(name, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	return &BackendResolver{
+		name:       name,
+		config:     cfg,
+		cache:      c,
+		sf:         singleflight.Group{},
+		backend:    b,
+		workerPool: workerpool.New(cfg.MaxWorkers, cfg.MaxWorkerQueueDepth, name, m),
+		metrics:    m,
+	}, nil
+}
+
+// GetSingleflightGroup returns the singleflight.Group instance.
+func (r *BackendResolver) GetSingleflightGroup() *singleflight.Group {
+	return &r.sf
+}
+
+// GetConfig returns the resolver's configuration.
+func (r *BackendResolver) GetConfig() *config.Config {
+	return r.config
+}
+
+// Resolve performs a recursive DNS lookup for a given request.
+func (r *BackendResolver) Resolve(ctx context.Context, req *dns.Msg) (*dns.Msg, error) {
+	q := req.Question[0]
+	do := false
+	if opt := req.IsEdns0(); opt != nil {
+		do = opt.Do()
+	}
+	cd := req.CheckingDisabled
+	key := cache.Key(q, do, cd)
+
+	if cachedMsg, found, revalidate := r.cache.Get(key); found {
+		logger := reqlog.FromCtx(ctx)
+		logger.Debug("cache hit", "revalidate", revalidate)
+		cachedMsg.Id = req.Id
+
+		if revalidate {
+			r.metrics.IncrementCacheRevalidations()
+			// Trigger a background revalidation using the worker pool. The
+			// background context carries the same request-scoped logger as
+			// ctx so revalidation log lines still trace back to the query
+			// that triggered them.
+			go func() {
+				bgCtx := reqlog.NewContext(context.Background(), logger)
+				if err := r.workerPool.Acquire(bgCtx); err != nil {
+					logger.Warn("failed to acquire worker for revalidation", "error", err)
+					return
+				}
+				defer r.workerPool.Release()
+
+				bgCtx, cancel := context.WithTimeout(bgCtx, r.config.UpstreamTimeout)
+				defer cancel()
+
+				revalidationReq := new(dns.Msg)
+				revalidationReq.SetQuestion(q.Name, q.Qtype)
+				revalidationReq.RecursionDesired = true
+				if opt := req.IsEdns0(); opt != nil {
+					revalidationReq.SetEdns0(opt.UDPSize(), opt.Do())
+				}
+
+				res, err, _ := r.sf.Do(key+"-revalidate", func() (interface{}, error) {
+					return r.exchange(bgCtx, revalidationReq)
+				})
+				if err != nil {
+					logger.Warn("background revalidation failed", "error", err)
+					return
+				}
+
+				if msg, ok := res.(*dns.Msg); ok {
+					r.cache.Set(key, msg, r.config.StaleWhileRevalidate)
+					logger.Debug("successfully revalidated and updated cache entry")
+				}
+			}()
+		}
+		return cachedMsg, nil
+	}
+
+	res, err, _ := r.sf.Do(key, func() (interface{}, error) {
+		return r.exchange(ctx, req)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	msg := res.(*dns.Msg)
+	msg.Id = req.Id
+	r.cache.Set(key, msg, r.config.StaleWhileRevalidate)
+
+	return msg, nil
+}
+
+// LookupWithoutCache performs a recursive DNS lookup for a given request, bypassing the cache.
+func (r *BackendResolver) LookupWithoutCache(ctx context.Context, req *dns.Msg) (*dns.Msg, error) {
+	return r.exchange(ctx, req)
+}
+
+// exchange dispatches to the underlying Backend, recording the same latency
+// and DNSSEC metrics the other resolvers record.
+func (r *BackendResolver) exchange(ctx context.Context, req *dns.Msg) (*dns.Msg, error) {
+	q := req.Question[0]
+	startTime := time.Now()
+
+	msg, dnssec, err := r.backend.Exchange(ctx, req)
+
+	latency := time.Since(startTime)
+	if observer, ok := r.backend.(interfaces.BackendLatencyObserver); ok {
+		latency = observer.LastExchangeLatency()
+	}
+	r.metrics.RecordLatency(dns.TypeToString[q.Qtype], latency)
+	r.metrics.RecordBackendLatency(r.name, latency)
+
+	if err != nil {
+		r.metrics.IncrementBackendErrors(r.name)
+		reqlog.FromCtx(ctx).Error("backend resolution error", "backend", r.name, "error", err)
+		if msg == nil {
+			msg = new(dns.Msg)
+			msg.SetRcode(req, dns.RcodeServerFailure)
+		}
+		return msg, err
+	}
+
+	if msg.Rcode == dns.RcodeNameError {
+		r.metrics.RecordNXDOMAIN(q.Name)
+	}
+
+	switch dnssec {
+	case interfaces.DNSSECSecure:
+		r.metrics.RecordDNSSECValidation("secure")
+		msg.AuthenticatedData = true
+	case interfaces.DNSSECBogus:
+		r.metrics.RecordDNSSECValidation("bogus")
+		return msg, err
+	default:
+		r.metrics.RecordDNSSECValidation("insecure")
+		msg.AuthenticatedData = false
+	}
+
+	return msg, nil
+}
+
+// Close satisfies ResolverInterface. The underlying Backend has no shutdown
+// hook today; add one to interfaces.Backend if a future backend needs to
+// flush state on close.
+func (r *BackendResolver) Close() {}
@@ -0,0 +1,159 @@
+package resolver
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"dns-resolver/internal/config"
+
+	"github.com/miekg/dns"
+)
+
+// defaultConditionalUpstreamTimeout is used when
+// config.Config.ConditionalUpstreamTimeout is unset.
+const defaultConditionalUpstreamTimeout = 2 * time.Second
+
+// conditionalRoute pairs a zone suffix with the Upstream that answers it.
+type conditionalRoute struct {
+	suffix   string // FQDN, lowercased
+	upstream Upstream
+}
+
+// ConditionalUpstreamResolver routes each query to the upstream configured
+// for the query name's longest matching zone suffix, modeled on Blocky's
+// conditional_upstream_resolver (e.g. "corp.example." -> an internal
+// resolver, "home.lan." -> a router, everything else upstream as normal).
+// The root suffix "." is the catch-all default; a query with no more
+// specific match falls through to whatever "." maps to, or to fallback if
+// "." isn't configured either. Routes are rebuilt from config.json on every
+// hot reload via config.Subscribe, so CRUD changes made through the
+// dashboard take effect without a restart.
+type ConditionalUpstreamResolver struct {
+	mu       sync.RWMutex       // guards routes against concurrent Exchange/reload
+	routes   []conditionalRoute // sorted longest suffix first, so the most specific zone wins
+	fallback Upstream
+}
+
+// NewConditionalUpstreamResolver builds a ConditionalUpstreamResolver from
+// cfg.ConditionalUpstreamMap, querying fallback for any name that matches no
+// configured suffix (and for "." itself, unless cfg maps it explicitly). It
+// subscribes to config.Subscribe so a later config.json edit - including one
+// made through the dashboard's /api/v1/conditional-upstreams endpoints - is
+// picked up automatically.
+func NewConditionalUpstreamResolver(cfg *config.Config, fallback Upstream) (*ConditionalUpstreamResolver, error) {
+	r := &ConditionalUpstreamResolver{fallback: fallback}
+	if err := r.reload(cfg); err != nil {
+		return nil, err
+	}
+	config.Subscribe(func(newCfg, _ *config.Config) {
+		if err := r.reload(newCfg); err != nil {
+			log.Printf("resolver: conditional upstream reload failed, keeping previous routes: %v", err)
+		}
+	})
+	return r, nil
+}
+
+// reload rebuilds r's routes from cfg.ConditionalUpstreamMap, validating
+// every suffix's address list before swapping anything in, so a malformed
+// entry in a hot-reloaded config.json leaves the previous routes in place.
+func (r *ConditionalUpstreamResolver) reload(cfg *config.Config) error {
+	timeout := cfg.ConditionalUpstreamTimeout
+	if timeout <= 0 {
+		timeout = defaultConditionalUpstreamTimeout
+	}
+
+	routes := make([]conditionalRoute, 0, len(cfg.ConditionalUpstreamMap))
+	for suffix, addrs := range cfg.ConditionalUpstreamMap {
+		up, err := newAddrUpstream(addrs, timeout)
+		if err != nil {
+			return fmt.Errorf("resolver: conditional upstream suffix %q: %w", suffix, err)
+		}
+		routes = append(routes, conditionalRoute{suffix: canonicalSuffix(suffix), upstream: up})
+	}
+	sort.Slice(routes, func(i, j int) bool { return len(routes[i].suffix) > len(routes[j].suffix) })
+
+	r.mu.Lock()
+	r.routes = routes
+	r.mu.Unlock()
+	return nil
+}
+
+// canonicalSuffix lowercases suffix and makes it fully qualified, so
+// "Corp.Example" and "corp.example." compare equal to a query name.
+func canonicalSuffix(suffix string) string {
+	return dns.Fqdn(strings.ToLower(suffix))
+}
+
+// Exchange forwards msg to the upstream configured for its question name's
+// longest matching suffix, or to fallback if nothing matches.
+func (r *ConditionalUpstreamResolver) Exchange(ctx context.Context, msg *dns.Msg) *Result {
+	return r.upstreamFor(msg).Exchange(ctx, msg)
+}
+
+// upstreamFor picks the Upstream for msg's question name: routes is kept
+// sorted longest-suffix-first by reload, so the first match here is already
+// the most specific one.
+func (r *ConditionalUpstreamResolver) upstreamFor(msg *dns.Msg) Upstream {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if len(msg.Question) > 0 {
+		name := canonicalSuffix(msg.Question[0].Name)
+		for _, rt := range r.routes {
+			if dns.IsSubDomain(rt.suffix, name) {
+				return rt.upstream
+			}
+		}
+	}
+	return r.fallback
+}
+
+// addrUpstream is an Upstream that exchanges with a fixed list of plain
+// "host:port" DNS servers over UDP, failing over to the next address on a
+// transport error or SERVFAIL - the same failover order as stub.Backend,
+// just without the scheme parsing since a conditional upstream is always a
+// plain address.
+type addrUpstream struct {
+	addrs   []string
+	timeout time.Duration
+}
+
+// newAddrUpstream validates addrs isn't empty before wrapping it; an empty
+// address list would make every Exchange on this route fail immediately
+// with an unhelpful error, so it's better to reject it at config load time.
+func newAddrUpstream(addrs []string, timeout time.Duration) (*addrUpstream, error) {
+	if len(addrs) == 0 {
+		return nil, fmt.Errorf("no upstream addresses configured")
+	}
+	return &addrUpstream{addrs: addrs, timeout: timeout}, nil
+}
+
+func (u *addrUpstream) Exchange(ctx context.Context, msg *dns.Msg) *Result {
+	client := &dns.Client{Net: "udp", Timeout: u.timeout}
+
+	var lastErr error
+	var lastResp *dns.Msg
+	for _, addr := range u.addrs {
+		resp, _, err := client.ExchangeContext(ctx, msg, addr)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		if resp.Rcode == dns.RcodeServerFailure {
+			lastResp = resp
+			lastErr = dns.ErrRcode
+			continue
+		}
+		return &Result{Msg: resp}
+	}
+
+	if lastResp != nil {
+		return &Result{Msg: lastResp}
+	}
+	return &Result{Err: lastErr}
+}
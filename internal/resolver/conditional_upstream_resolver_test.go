@@ -0,0 +1,98 @@
+package resolver
+
+import (
+	"context"
+	"testing"
+
+	"dns-resolver/internal/config"
+
+	"github.com/miekg/dns"
+)
+
+func TestConditionalUpstreamResolver_RoutesByLongestSuffix(t *testing.T) {
+	sub := &fakeUpstream{name: "sub"}
+	corp := &fakeUpstream{name: "corp"}
+	home := &fakeUpstream{name: "home"}
+	def := &fakeUpstream{name: "default"}
+
+	r := &ConditionalUpstreamResolver{
+		fallback: def,
+		routes: []conditionalRoute{
+			// Sorted longest suffix first, as reload would leave them.
+			{suffix: canonicalSuffix("dev.corp.example."), upstream: sub},
+			{suffix: canonicalSuffix("corp.example."), upstream: corp},
+			{suffix: canonicalSuffix("home.lan."), upstream: home},
+		},
+	}
+
+	cases := []struct {
+		qname string
+		want  *fakeUpstream
+	}{
+		{"www.corp.example.", corp},
+		{"foo.dev.corp.example.", sub}, // more specific suffix must win over "corp.example."
+		{"host.home.lan.", home},
+		{"example.com.", def}, // no configured suffix matches, falls through to default
+	}
+
+	for _, c := range cases {
+		msg := new(dns.Msg)
+		msg.SetQuestion(c.qname, dns.TypeA)
+		got := r.upstreamFor(msg)
+		if got != c.want {
+			t.Errorf("upstreamFor(%q) = %v, want %v", c.qname, got, c.want)
+		}
+	}
+}
+
+func TestConditionalUpstreamResolver_CaseInsensitiveMatch(t *testing.T) {
+	corp := &fakeUpstream{name: "corp"}
+	def := &fakeUpstream{name: "default"}
+
+	r := &ConditionalUpstreamResolver{
+		fallback: def,
+		routes:   []conditionalRoute{{suffix: canonicalSuffix("Corp.Example"), upstream: corp}},
+	}
+
+	msg := new(dns.Msg)
+	msg.SetQuestion("HOST.CORP.EXAMPLE.", dns.TypeA)
+	if got := r.upstreamFor(msg); got != corp {
+		t.Errorf("upstreamFor returned %v, want the corp upstream", got)
+	}
+}
+
+func TestConditionalUpstreamResolver_ExchangeDelegatesToMatchedUpstream(t *testing.T) {
+	corp := &fakeUpstream{name: "corp"}
+	def := &fakeUpstream{name: "default"}
+
+	r := &ConditionalUpstreamResolver{
+		fallback: def,
+		routes:   []conditionalRoute{{suffix: canonicalSuffix("corp.example."), upstream: corp}},
+	}
+
+	msg := new(dns.Msg)
+	msg.SetQuestion("www.corp.example.", dns.TypeA)
+	if res := r.Exchange(context.Background(), msg); res.Err != nil {
+		t.Fatalf("unexpected error: %v", res.Err)
+	}
+	if corp.calledTimes() != 1 {
+		t.Fatalf("expected the corp upstream to be called once, got %d", corp.calledTimes())
+	}
+	if def.calledTimes() != 0 {
+		t.Fatalf("expected the default upstream not to be called, got %d", def.calledTimes())
+	}
+}
+
+func TestNewAddrUpstream_RejectsEmptyAddressList(t *testing.T) {
+	if _, err := newAddrUpstream(nil, defaultConditionalUpstreamTimeout); err == nil {
+		t.Fatal("expected an error for an empty address list")
+	}
+}
+
+func TestConditionalUpstreamResolver_ReloadRejectsEmptyAddressList(t *testing.T) {
+	r := &ConditionalUpstreamResolver{fallback: &fakeUpstream{name: "default"}}
+	cfg := &config.Config{ConditionalUpstreamMap: map[string][]string{"corp.example.": {}}}
+	if err := r.reload(cfg); err == nil {
+		t.Fatal("expected reload to reject an empty address list")
+	}
+}
@@ -0,0 +1,182 @@
+package resolver
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"dns-resolver/internal/config"
+	"dns-resolver/internal/metrics"
+
+	"github.com/miekg/dns"
+)
+
+// dohMediaType is the RFC 8484 content type for wire-format DNS over HTTP,
+// the same constant name and value as stub.Backend's https:// transport.
+const dohMediaType = "application/dns-message"
+
+// defaultDoHTimeout is used when config.Config.DoHUpstreamTimeout is unset.
+const defaultDoHTimeout = 5 * time.Second
+
+// DoHResolver is an Upstream that exchanges queries over RFC 8484
+// DNS-over-HTTPS against a fixed list of endpoint URLs: POST is tried
+// first, falling back to GET (base64url "dns=" query param) only if the
+// endpoint rejects POST outright; a network error retries once against the
+// next endpoint. It holds a single pooled *http.Client so every query
+// reuses HTTP/2 connections instead of paying a fresh TLS handshake.
+type DoHResolver struct {
+	endpoints []string
+	timeout   time.Duration
+	client    *http.Client
+	metrics   *metrics.Metrics
+}
+
+// NewDoHResolver builds a DoHResolver from cfg.DoHUpstreamEndpoints,
+// applying cfg's TLS ServerName override and optional client certificate.
+// m may be nil, in which case per-transport metrics are skipped.
+func NewDoHResolver(cfg *config.Config, m *metrics.Metrics) (*DoHResolver, error) {
+	if len(cfg.DoHUpstreamEndpoints) == 0 {
+		return nil, fmt.Errorf("resolver: DoHUpstreamEndpoints must list at least one DoH endpoint URL")
+	}
+
+	tlsConfig := &tls.Config{ServerName: cfg.DoHUpstreamServerName}
+	if cfg.DoHUpstreamClientCertFile != "" || cfg.DoHUpstreamClientKeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.DoHUpstreamClientCertFile, cfg.DoHUpstreamClientKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("resolver: loading DoH client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	timeout := cfg.DoHUpstreamTimeout
+	if timeout <= 0 {
+		timeout = defaultDoHTimeout
+	}
+
+	return &DoHResolver{
+		endpoints: cfg.DoHUpstreamEndpoints,
+		timeout:   timeout,
+		client: &http.Client{
+			Timeout: timeout,
+			Transport: &http.Transport{
+				TLSClientConfig:     tlsConfig,
+				ForceAttemptHTTP2:   true,
+				MaxIdleConnsPerHost: 4,
+			},
+		},
+		metrics: m,
+	}, nil
+}
+
+// Exchange sends msg to the first configured endpoint, retrying once
+// against the next endpoint (if any) on a network error.
+func (r *DoHResolver) Exchange(ctx context.Context, msg *dns.Msg) *Result {
+	var lastErr error
+	for i, endpoint := range r.endpoints {
+		resp, err := r.exchangeOne(ctx, endpoint, msg)
+		if err == nil {
+			return &Result{Msg: resp}
+		}
+		lastErr = err
+		if i == 0 && len(r.endpoints) > 1 {
+			continue // one retry against the secondary endpoint
+		}
+		break
+	}
+	return &Result{Err: lastErr}
+}
+
+// exchangeOne performs a single DoH round trip against endpoint, preferring
+// POST and falling back to GET if the endpoint rejects POST outright (405
+// Method Not Allowed).
+func (r *DoHResolver) exchangeOne(ctx context.Context, endpoint string, msg *dns.Msg) (*dns.Msg, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	start := time.Now()
+	resp, err := r.doPOST(ctx, endpoint, msg)
+	if err == errMethodNotAllowed {
+		resp, err = r.doGET(ctx, endpoint, msg)
+	}
+	if r.metrics != nil {
+		r.metrics.RecordUpstreamTransportLatency("doh", time.Since(start))
+	}
+	return resp, err
+}
+
+// errMethodNotAllowed signals exchangeOne to fall back from POST to GET;
+// it never escapes Exchange.
+var errMethodNotAllowed = fmt.Errorf("doh: endpoint rejected POST")
+
+func (r *DoHResolver) doPOST(ctx context.Context, endpoint string, msg *dns.Msg) (*dns.Msg, error) {
+	wire, err := msg.Pack()
+	if err != nil {
+		return nil, fmt.Errorf("doh: packing query: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(wire))
+	if err != nil {
+		return nil, fmt.Errorf("doh: building POST request: %w", err)
+	}
+	req.Header.Set("Content-Type", dohMediaType)
+	req.Header.Set("Accept", dohMediaType)
+
+	return r.do(req)
+}
+
+func (r *DoHResolver) doGET(ctx context.Context, endpoint string, msg *dns.Msg) (*dns.Msg, error) {
+	wire, err := msg.Pack()
+	if err != nil {
+		return nil, fmt.Errorf("doh: packing query: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, fmt.Errorf("doh: building GET request: %w", err)
+	}
+	q := req.URL.Query()
+	q.Set("dns", base64.RawURLEncoding.EncodeToString(wire))
+	req.URL.RawQuery = q.Encode()
+	req.Header.Set("Accept", dohMediaType)
+
+	return r.do(req)
+}
+
+func (r *DoHResolver) do(req *http.Request) (*dns.Msg, error) {
+	httpResp, err := r.client.Do(req)
+	if err != nil {
+		if r.metrics != nil {
+			r.metrics.RecordUpstreamDoHHTTPStatus("error")
+		}
+		return nil, fmt.Errorf("doh: request to %s: %w", req.URL, err)
+	}
+	defer httpResp.Body.Close()
+
+	if r.metrics != nil {
+		r.metrics.RecordUpstreamDoHHTTPStatus(strconv.Itoa(httpResp.StatusCode))
+	}
+
+	if httpResp.StatusCode == http.StatusMethodNotAllowed {
+		return nil, errMethodNotAllowed
+	}
+	if httpResp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("doh: %s returned HTTP %d", req.URL, httpResp.StatusCode)
+	}
+
+	body, err := io.ReadAll(httpResp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("doh: reading response body from %s: %w", req.URL, err)
+	}
+
+	respMsg := new(dns.Msg)
+	if err := respMsg.Unpack(body); err != nil {
+		return nil, fmt.Errorf("doh: unpacking response from %s: %w", req.URL, err)
+	}
+	return respMsg, nil
+}
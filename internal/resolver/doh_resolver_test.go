@@ -0,0 +1,129 @@
+package resolver
+
+import (
+	"context"
+	"encoding/base64"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"dns-resolver/internal/config"
+
+	"github.com/miekg/dns"
+)
+
+func dohHandler(t *testing.T, respond func(q *dns.Msg) *dns.Msg) http.HandlerFunc {
+	t.Helper()
+	return func(w http.ResponseWriter, r *http.Request) {
+		var wire []byte
+		switch r.Method {
+		case http.MethodPost:
+			body, err := io.ReadAll(r.Body)
+			if err != nil {
+				t.Fatalf("reading POST body: %v", err)
+			}
+			wire = body
+		case http.MethodGet:
+			t.Fatalf("unexpected GET request in POST test")
+		}
+
+		q := new(dns.Msg)
+		if err := q.Unpack(wire); err != nil {
+			t.Fatalf("unpacking query: %v", err)
+		}
+
+		resp := respond(q)
+		out, err := resp.Pack()
+		if err != nil {
+			t.Fatalf("packing response: %v", err)
+		}
+		w.Header().Set("Content-Type", dohMediaType)
+		w.Write(out)
+	}
+}
+
+func TestDoHResolver_ExchangeOverPOST(t *testing.T) {
+	srv := httptest.NewServer(dohHandler(t, func(q *dns.Msg) *dns.Msg {
+		m := new(dns.Msg)
+		m.SetReply(q)
+		return m
+	}))
+	defer srv.Close()
+
+	r, err := NewDoHResolver(&config.Config{DoHUpstreamEndpoints: []string{srv.URL}}, nil)
+	if err != nil {
+		t.Fatalf("NewDoHResolver returned error: %v", err)
+	}
+
+	res := r.Exchange(context.Background(), newQuery())
+	if res.Err != nil {
+		t.Fatalf("unexpected error: %v", res.Err)
+	}
+	if !res.Msg.Response {
+		t.Error("expected a response message")
+	}
+}
+
+func TestDoHResolver_FallsBackToGETOn405(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		q := new(dns.Msg)
+		wire, err := base64.RawURLEncoding.DecodeString(r.URL.Query().Get("dns"))
+		if err != nil {
+			t.Fatalf("decoding dns param: %v", err)
+		}
+		if err := q.Unpack(wire); err != nil {
+			t.Fatalf("unpacking GET query: %v", err)
+		}
+
+		m := new(dns.Msg)
+		m.SetReply(q)
+		out, err := m.Pack()
+		if err != nil {
+			t.Fatalf("packing response: %v", err)
+		}
+		w.Header().Set("Content-Type", dohMediaType)
+		w.Write(out)
+	}))
+	defer srv.Close()
+
+	r, err := NewDoHResolver(&config.Config{DoHUpstreamEndpoints: []string{srv.URL}}, nil)
+	if err != nil {
+		t.Fatalf("NewDoHResolver returned error: %v", err)
+	}
+
+	res := r.Exchange(context.Background(), newQuery())
+	if res.Err != nil {
+		t.Fatalf("unexpected error after GET fallback: %v", res.Err)
+	}
+}
+
+func TestDoHResolver_RetriesSecondaryEndpointOnError(t *testing.T) {
+	good := httptest.NewServer(dohHandler(t, func(q *dns.Msg) *dns.Msg {
+		m := new(dns.Msg)
+		m.SetReply(q)
+		return m
+	}))
+	defer good.Close()
+
+	r, err := NewDoHResolver(&config.Config{DoHUpstreamEndpoints: []string{"http://127.0.0.1:1", good.URL}}, nil)
+	if err != nil {
+		t.Fatalf("NewDoHResolver returned error: %v", err)
+	}
+
+	res := r.Exchange(context.Background(), newQuery())
+	if res.Err != nil {
+		t.Fatalf("expected the retry against the secondary endpoint to succeed, got: %v", res.Err)
+	}
+}
+
+func TestNewDoHResolver_RequiresAtLeastOneEndpoint(t *testing.T) {
+	if _, err := NewDoHResolver(&config.Config{}, nil); err == nil {
+		t.Error("expected an error when DoHUpstreamEndpoints is empty")
+	}
+}
@@ -2,7 +2,9 @@ package resolver
 
 import (
 	"context"
+	"fmt"
 	"log"
+	"strings"
 
 	"dns-resolver/internal/cache"
 	"dns-resolver/internal/config"
@@ -31,9 +33,46 @@ type ResolverInterface interface {
 	Close()
 }
 
-// NewResolver creates a new resolver instance based on the specified type.
+// NewResolver creates a new resolver from cfg.ResolverType, which may name a
+// single resolver ("knot") or a comma-separated chain tried in order until
+// one constructs successfully ("knot,stub"). "unbound" and "knot" select the
+// built-in cgo-based resolvers; any other name is looked up in the
+// interfaces.RegisterBackend registry and wrapped in a BackendResolver, so a
+// cgo-free build can fall back to e.g. "stub" when libknot/libunbound aren't
+// available. An empty name in the chain is skipped; the chain errors only if
+// every entry fails to construct.
 func NewResolver(resolverType ResolverType, cfg *config.Config, c *cache.Cache, m *metrics.Metrics) (ResolverInterface, error) {
-	switch resolverType {
+	var names []string
+	for _, name := range strings.Split(string(resolverType), ",") {
+		name = strings.TrimSpace(name)
+		if name != "" {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		log.Printf("Unknown resolver type: %q, falling back to Unbound", resolverType)
+		names = []string{string(ResolverTypeUnbound)}
+	}
+
+	var lastErr error
+	for _, name := range names {
+		r, err := newNamedResolver(name, cfg, c, m)
+		if err != nil {
+			log.Printf("Resolver %q failed to initialize, trying next in chain: %v", name, err)
+			lastErr = err
+			continue
+		}
+		return r, nil
+	}
+
+	return nil, fmt.Errorf("no resolver in chain %q could be initialized: %w", resolverType, lastErr)
+}
+
+// newNamedResolver constructs a single resolver by name: "unbound" and
+// "knot" are the built-in cgo-based resolvers, anything else is looked up as
+// a Backend registered via interfaces.RegisterBackend.
+func newNamedResolver(name string, cfg *config.Config, c *cache.Cache, m *metrics.Metrics) (ResolverInterface, error) {
+	switch ResolverType(name) {
 	case ResolverTypeUnbound:
 		log.Println("Creating Unbound resolver")
 		return NewUnboundResolver(cfg, c, m), nil
@@ -41,7 +80,7 @@ func NewResolver(resolverType ResolverType, cfg *config.Config, c *cache.Cache,
 		log.Println("Creating Knot resolver")
 		return NewKnotResolver(cfg, c, m)
 	default:
-		log.Printf("Unknown resolver type: %s, falling back to Unbound", resolverType)
-		return NewUnboundResolver(cfg, c, m), nil
+		log.Printf("Creating %q resolver from the backend registry", name)
+		return NewBackendResolver(name, cfg, c, m)
 	}
 }
@@ -10,6 +10,8 @@ import (
 	"dns-resolver/internal/config"
 	"dns-resolver/internal/knot"
 	"dns-resolver/internal/metrics"
+	"dns-resolver/internal/reqlog"
+	"dns-resolver/internal/workerpool"
 
 	"github.com/miekg/dns"
 	"golang.org/x/sync/singleflight"
@@ -17,12 +19,14 @@ import (
 
 // KnotResolver is a recursive DNS resolver using Knot DNS library.
 type KnotResolver struct {
-	config     *config.Config
-	cache      *cache.Cache
-	sf         singleflight.Group
-	knot       *knot.Resolver
-	workerPool *WorkerPool
-	metrics    *metrics.Metrics
+	config        *config.Config
+	cache         *cache.Cache
+	rejectedCache *cache.RejectedResponseCache
+	fakeIP        *cache.FakeIPCache
+	sf            singleflight.Group
+	knot          *knot.Resolver
+	workerPool    *workerpool.Pool
+	metrics       *metrics.Metrics
 }
 
 // NewKnotResolver creates a new Knot resolver instance.
@@ -33,18 +37,47 @@ func NewKnotResolver(cfg *config.Config, c *cache.Cache, m *metrics.Metrics) (*K
 		return nil, err
 	}
 
+	rejectedCache := cache.NewRejectedResponseCache(cache.DefaultShards, cache.CacheConfig{RejectedTTLSecs: int(cfg.RejectedTTL.Seconds())}, cfg.RejectedCachePath)
+	if err := rejectedCache.LoadFromFile(); err != nil {
+		log.Printf("Could not load rejected-response cache from file: %v", err)
+	}
+
+	var fakeIP *cache.FakeIPCache
+	if cfg.FakeIPEnabled {
+		fakeIP, err = cache.NewFakeIPCache(cfg.FakeIPRange4, cfg.FakeIPRange6, cfg.FakeIPTTL, cfg.FakeIPCachePath)
+		if err != nil {
+			return nil, err
+		}
+		if err := fakeIP.LoadFromFile(); err != nil {
+			log.Printf("Could not load fake-IP cache from file: %v", err)
+		}
+	}
+
 	r := &KnotResolver{
-		config:     cfg,
-		cache:      c,
-		sf:         singleflight.Group{},
-		knot:       knotResolver,
-		workerPool: NewWorkerPool(cfg.MaxWorkers),
-		metrics:    m,
+		config:        cfg,
+		cache:         c,
+		rejectedCache: rejectedCache,
+		fakeIP:        fakeIP,
+		sf:            singleflight.Group{},
+		knot:          knotResolver,
+		workerPool:    workerpool.New(cfg.MaxWorkers, cfg.MaxWorkerQueueDepth, "knot", m),
+		metrics:       m,
 	}
 
 	return r, nil
 }
 
+// FakeIPLookup resolves a previously-allocated fake IP back to its original
+// hostname. It is exposed so a plugin (e.g. an upstream proxy) can rewrite a
+// flow's destination without reaching into the resolver's internals; it
+// reports false when fake-IP mode is disabled or the IP is unknown/expired.
+func (r *KnotResolver) FakeIPLookup(ip string) (name string, ok bool) {
+	if r.fakeIP == nil {
+		return "", false
+	}
+	return r.fakeIP.Lookup(ip)
+}
+
 // GetSingleflightGroup returns the singleflight.Group instance.
 func (r *KnotResolver) GetSingleflightGroup() *singleflight.Group {
 	return &r.sf
@@ -55,27 +88,68 @@ func (r *KnotResolver) GetConfig() *config.Config {
 	return r.config
 }
 
+// SetRejectedCache wires in the rejected-response cache (RDRC) consulted by
+// Resolve before upstream resolution, and populated by exchange on upstream
+// REFUSED, repeated SERVFAIL, or DNSSEC BOGUS.
+func (r *KnotResolver) SetRejectedCache(rc *cache.RejectedResponseCache) {
+	r.rejectedCache = rc
+}
+
 // Resolve performs a recursive DNS lookup for a given request.
 func (r *KnotResolver) Resolve(ctx context.Context, req *dns.Msg) (*dns.Msg, error) {
 	q := req.Question[0]
-	key := cache.Key(q)
+	do := false
+	if opt := req.IsEdns0(); opt != nil {
+		do = opt.Do()
+	}
+	cd := req.CheckingDisabled
+	key := cache.Key(q, do, cd)
+
+	// In fake-IP mode, a qualifying A/AAAA query is answered with a
+	// synthesized address straight away: no cache lookup, no upstream
+	// exchange. The mapping is recorded so a later PTR query, or a
+	// downstream proxy handed the fake IP as a flow destination, can
+	// recover the real hostname via FakeIPLookup.
+	if r.fakeIP != nil && (q.Qtype == dns.TypeA || q.Qtype == dns.TypeAAAA) && r.matchesFakeIPDomain(q.Name) {
+		return r.synthesizeFakeIP(ctx, req, q)
+	}
+
+	logger := reqlog.FromCtx(ctx)
+
+	// Check the rejected-response cache before anything else: if we already
+	// know this query is blocked, upstream-REFUSED, or DNSSEC-bogus, return
+	// a synthesized response without re-running resolution or validation.
+	if r.rejectedCache != nil {
+		if rejectedMsg, reason, found := r.rejectedCache.Check(q); found {
+			logger.Debug("rejected-cache hit", "reason", reason)
+			r.metrics.IncrementRejectedCacheHits(string(reason))
+			rcode := rejectedMsg.Rcode
+			reply := new(dns.Msg)
+			reply.SetRcode(req, rcode)
+			return reply, nil
+		}
+	}
 
 	// Check the cache first.
 	if cachedMsg, found, revalidate := r.cache.Get(key); found {
-		log.Printf("Cache hit for %s (revalidate: %t)", q.Name, revalidate)
+		logger.Debug("cache hit", "revalidate", revalidate)
 		cachedMsg.Id = req.Id
 
 		if revalidate {
 			r.metrics.IncrementCacheRevalidations()
-			// Trigger a background revalidation using the worker pool
+			// Trigger a background revalidation using the worker pool. The
+			// background context carries the same request-scoped logger as
+			// ctx so revalidation log lines still trace back to the query
+			// that triggered them.
 			go func() {
-				if err := r.workerPool.Acquire(context.Background()); err != nil {
-					log.Printf("Failed to acquire worker for revalidation: %v", err)
+				bgCtx := reqlog.NewContext(context.Background(), logger)
+				if err := r.workerPool.Acquire(bgCtx); err != nil {
+					logger.Warn("failed to acquire worker for revalidation", "error", err)
 					return
 				}
 				defer r.workerPool.Release()
 
-				ctx, cancel := context.WithTimeout(context.Background(), r.config.UpstreamTimeout)
+				bgCtx, cancel := context.WithTimeout(bgCtx, r.config.UpstreamTimeout)
 				defer cancel()
 
 				// Create a new request for revalidation to avoid race conditions on the original request object.
@@ -87,18 +161,20 @@ func (r *KnotResolver) Resolve(ctx context.Context, req *dns.Msg) (*dns.Msg, err
 				}
 
 				res, err, _ := r.sf.Do(key+"-revalidate", func() (interface{}, error) {
-					return r.exchange(ctx, revalidationReq)
+					return r.exchange(bgCtx, revalidationReq)
 				})
 				if err != nil {
-					log.Printf("Background revalidation failed for %s: %v", q.Name, err)
+					logger.Warn("background revalidation failed", "error", err)
 					return
 				}
 
 				if msg, ok := res.(*dns.Msg); ok {
 					r.cache.Set(key, msg, r.config.StaleWhileRevalidate)
-					log.Printf("Successfully revalidated and updated cache for %s", q.Name)
+					logger.Debug("successfully revalidated and updated cache entry")
 				}
 			}()
+		} else if r.cache.ShouldPrefetch(key) {
+			r.prefetch(ctx, key, q, req)
 		}
 		return cachedMsg, nil
 	}
@@ -121,9 +197,102 @@ func (r *KnotResolver) Resolve(ctx context.Context, req *dns.Msg) (*dns.Msg, err
 	return msg, nil
 }
 
+// prefetch refetches a hot key ahead of its expiry, asynchronously, so the
+// next query for it finds a fresh entry with the full TTL instead of
+// falling back to stale-while-revalidate or a cold lookup. It mirrors the
+// revalidation goroutine in Resolve, but runs on a popularity signal from
+// cache.ShouldPrefetch rather than on a stale cache hit. ctx's logger is
+// carried into the background goroutine so prefetch log lines still trace
+// back to the query that triggered them.
+func (r *KnotResolver) prefetch(ctx context.Context, key string, q dns.Question, req *dns.Msg) {
+	logger := reqlog.FromCtx(ctx)
+	go func() {
+		bgCtx := reqlog.NewContext(context.Background(), logger)
+		if err := r.workerPool.Acquire(bgCtx); err != nil {
+			logger.Warn("failed to acquire worker for prefetch", "error", err)
+			return
+		}
+		defer r.workerPool.Release()
+
+		bgCtx, cancel := context.WithTimeout(bgCtx, r.config.UpstreamTimeout)
+		defer cancel()
+
+		prefetchReq := new(dns.Msg)
+		prefetchReq.SetQuestion(q.Name, q.Qtype)
+		prefetchReq.RecursionDesired = true
+		if opt := req.IsEdns0(); opt != nil {
+			prefetchReq.SetEdns0(opt.UDPSize(), opt.Do())
+		}
+
+		res, err, _ := r.sf.Do(key+"-prefetch", func() (interface{}, error) {
+			return r.exchange(bgCtx, prefetchReq)
+		})
+		if err != nil {
+			logger.Warn("prefetch failed", "error", err)
+			return
+		}
+
+		if msg, ok := res.(*dns.Msg); ok {
+			r.cache.Set(key, msg, r.config.StaleWhileRevalidate)
+			r.cache.EvictPrefetch(key)
+			r.metrics.IncrementCachePrefetches()
+			logger.Debug("successfully prefetched hot key")
+		}
+	}()
+}
+
+// matchesFakeIPDomain reports whether name falls under one of the
+// configured FakeIPDomains (or any domain, when the list is empty).
+func (r *KnotResolver) matchesFakeIPDomain(name string) bool {
+	if len(r.config.FakeIPDomains) == 0 {
+		return true
+	}
+	for _, domain := range r.config.FakeIPDomains {
+		if dns.IsSubDomain(dns.Fqdn(domain), name) {
+			return true
+		}
+	}
+	return false
+}
+
+// synthesizeFakeIP allocates (or reuses) a fake address for q.Name and
+// builds a reply carrying it directly, bypassing the cache and upstream
+// resolution entirely.
+func (r *KnotResolver) synthesizeFakeIP(ctx context.Context, req *dns.Msg, q dns.Question) (*dns.Msg, error) {
+	ip, err := r.fakeIP.Allocate(q.Name, q.Qtype == dns.TypeAAAA)
+	if err != nil {
+		reqlog.FromCtx(ctx).Warn("fake-IP allocation failed", "error", err)
+		msg := new(dns.Msg)
+		msg.SetRcode(req, dns.RcodeServerFailure)
+		return msg, err
+	}
+
+	msg := new(dns.Msg)
+	msg.SetReply(req)
+	msg.Authoritative = false
+	msg.RecursionAvailable = true
+
+	ttl := uint32(r.config.FakeIPTTL.Seconds())
+	var rr dns.RR
+	if q.Qtype == dns.TypeAAAA {
+		rr = &dns.AAAA{
+			Hdr:  dns.RR_Header{Name: q.Name, Rrtype: dns.TypeAAAA, Class: dns.ClassINET, Ttl: ttl},
+			AAAA: ip,
+		}
+	} else {
+		rr = &dns.A{
+			Hdr: dns.RR_Header{Name: q.Name, Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: ttl},
+			A:   ip,
+		}
+	}
+	msg.Answer = []dns.RR{rr}
+	return msg, nil
+}
+
 // exchange performs the actual DNS resolution using Knot.
 func (r *KnotResolver) exchange(ctx context.Context, req *dns.Msg) (*dns.Msg, error) {
 	q := req.Question[0]
+	logger := reqlog.FromCtx(ctx)
 	startTime := time.Now()
 
 	// Convert DNS types to Knot types
@@ -135,11 +304,14 @@ func (r *KnotResolver) exchange(ctx context.Context, req *dns.Msg) (*dns.Msg, er
 	latency := time.Since(startTime)
 
 	// Always record latency
-	r.metrics.RecordLatency(q.Name, latency)
+	r.metrics.RecordLatency(dns.TypeToString[q.Qtype], latency)
 
 	if err != nil {
 		r.metrics.IncrementUnboundErrors()
-		log.Printf("Knot resolution error for %s: %v", q.Name, err)
+		logger.Error("knot resolution error", "error", err)
+		if r.rejectedCache != nil {
+			r.rejectedCache.RejectFor(q, cache.RejectReasonServfail, r.config.RejectedTTL)
+		}
 		// When an error occurs, construct a SERVFAIL to send back to the client.
 		msg := new(dns.Msg)
 		msg.SetRcode(req, dns.RcodeServerFailure)
@@ -149,7 +321,7 @@ func (r *KnotResolver) exchange(ctx context.Context, req *dns.Msg) (*dns.Msg, er
 	// Convert Knot result to DNS message
 	msg, err := r.convertKnotResult(req, result)
 	if err != nil {
-		log.Printf("Failed to convert Knot result for %s: %v", q.Name, err)
+		logger.Error("failed to convert knot result", "error", err)
 		msg := new(dns.Msg)
 		msg.SetRcode(req, dns.RcodeServerFailure)
 		return msg, err
@@ -158,16 +330,19 @@ func (r *KnotResolver) exchange(ctx context.Context, req *dns.Msg) (*dns.Msg, er
 	// Handle DNSSEC validation results
 	if result.Bogus {
 		r.metrics.RecordDNSSECValidation("bogus")
-		log.Printf("DNSSEC validation for %s resulted in BOGUS.", q.Name)
+		logger.Warn("DNSSEC validation resulted in BOGUS")
 		msg.Rcode = dns.RcodeServerFailure
+		if r.rejectedCache != nil {
+			r.rejectedCache.RejectFor(q, cache.RejectReasonBogus, r.config.RejectedTTL)
+		}
 		return msg, errors.New("BOGUS: DNSSEC validation failed")
 	} else if result.Secure {
 		r.metrics.RecordDNSSECValidation("secure")
-		log.Printf("DNSSEC validation for %s resulted in SECURE.", q.Name)
+		logger.Debug("DNSSEC validation resulted in SECURE")
 		msg.AuthenticatedData = true
 	} else {
 		r.metrics.RecordDNSSECValidation("insecure")
-		log.Printf("DNSSEC validation for %s resulted in INSECURE.", q.Name)
+		logger.Debug("DNSSEC validation resulted in INSECURE")
 		msg.AuthenticatedData = false
 	}
 
@@ -176,6 +351,10 @@ func (r *KnotResolver) exchange(ctx context.Context, req *dns.Msg) (*dns.Msg, er
 		r.metrics.RecordNXDOMAIN(q.Name)
 	}
 
+	if result.Rcode == dns.RcodeRefused && r.rejectedCache != nil {
+		r.rejectedCache.RejectFor(q, cache.RejectReasonRefused, r.config.RejectedTTL)
+	}
+
 	return msg, nil
 }
 
@@ -217,10 +396,22 @@ func (r *KnotResolver) LookupWithoutCache(ctx context.Context, req *dns.Msg) (*d
 	return r.exchange(ctx, req)
 }
 
-// Close closes the resolver and frees resources.
+// Close closes the resolver and frees resources, persisting the
+// rejected-response cache so entries survive a restart.
 func (r *KnotResolver) Close() {
+	if r.rejectedCache != nil {
+		if err := r.rejectedCache.SaveToFile(); err != nil {
+			log.Printf("Could not save rejected-response cache to file: %v", err)
+		}
+	}
+	if r.fakeIP != nil {
+		if err := r.fakeIP.SaveToFile(); err != nil {
+			log.Printf("Could not save fake-IP cache to file: %v", err)
+		}
+		r.fakeIP.Close()
+	}
 	if r.knot != nil {
 		r.knot.Close()
 		r.knot = nil
 	}
-}
\ No newline at end of file
+}
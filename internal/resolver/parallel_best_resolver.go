@@ -0,0 +1,157 @@
+package resolver
+
+import (
+	"context"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// ewmaAlpha is the smoothing factor for upstreamStats.record: each new
+// sample counts for 10% of the running average, so the ranking adapts
+// within a handful of queries without being thrown off by one slow reply.
+const ewmaAlpha = 0.1
+
+// explorationProbability is how often pickTwo swaps one of the two
+// statistically-fastest upstreams for a uniformly random one, so an
+// upstream that's currently out of favor (or has recovered from an outage)
+// still gets exercised and can earn its way back to the front.
+const explorationProbability = 0.1
+
+// Upstream is the subset of behavior ParallelBestResolver needs from each
+// upstream it races. It mirrors server.ResolverInterface's Exchange method
+// without importing the server package, so *Resolver, *KnotResolver,
+// *BackendResolver, or even another ParallelBestResolver can all be used as
+// upstreams.
+type Upstream interface {
+	Exchange(ctx context.Context, msg *dns.Msg) *Result
+}
+
+// upstreamStats tracks one upstream's exponentially-weighted moving average
+// RTT and error rate.
+type upstreamStats struct {
+	mu        sync.Mutex
+	ewmaRTT   time.Duration
+	errorRate float64
+	seen      bool
+}
+
+func (s *upstreamStats) record(rtt time.Duration, failed bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.seen {
+		s.ewmaRTT = rtt
+		s.seen = true
+	} else {
+		s.ewmaRTT = time.Duration(ewmaAlpha*float64(rtt) + (1-ewmaAlpha)*float64(s.ewmaRTT))
+	}
+	sample := 0.0
+	if failed {
+		sample = 1.0
+	}
+	s.errorRate = ewmaAlpha*sample + (1-ewmaAlpha)*s.errorRate
+}
+
+func (s *upstreamStats) snapshot() (ewmaRTT time.Duration, errorRate float64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.ewmaRTT, s.errorRate
+}
+
+// ParallelBestResolver races the two statistically fastest of its upstreams
+// on every Exchange, returning whichever answers first with a usable
+// (non-SERVFAIL) response and cancelling the context passed to the other.
+// Every upstream records its own EWMA RTT and error rate on every race it
+// takes part in, win or lose, in a sync.Map keyed by the Upstream itself,
+// so the ranking used by the next Exchange call stays current.
+type ParallelBestResolver struct {
+	upstreams []Upstream
+	stats     sync.Map // Upstream -> *upstreamStats
+}
+
+// NewParallelBestResolver wraps upstreams for racing. It panics if fewer
+// than two are given, since there would be nothing to race.
+func NewParallelBestResolver(upstreams []Upstream) *ParallelBestResolver {
+	if len(upstreams) < 2 {
+		panic("resolver: ParallelBestResolver requires at least two upstreams")
+	}
+	r := &ParallelBestResolver{upstreams: upstreams}
+	for _, u := range upstreams {
+		r.stats.Store(u, &upstreamStats{})
+	}
+	return r
+}
+
+// Exchange races the two best-ranked upstreams and returns the first
+// non-SERVFAIL response. If both fail, the last failure received is
+// returned.
+func (r *ParallelBestResolver) Exchange(ctx context.Context, msg *dns.Msg) *Result {
+	picked := r.pickTwo()
+
+	raceCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	type raced struct {
+		result *Result
+	}
+	results := make(chan raced, len(picked))
+	for _, u := range picked {
+		u := u
+		go func() {
+			start := time.Now()
+			res := u.Exchange(raceCtx, msg.Copy())
+			r.statsFor(u).record(time.Since(start), isFailure(res))
+			results <- raced{result: res}
+		}()
+	}
+
+	var lastFailure *Result
+	for i := 0; i < len(picked); i++ {
+		rr := <-results
+		if !isFailure(rr.result) {
+			return rr.result
+		}
+		lastFailure = rr.result
+	}
+	return lastFailure
+}
+
+// isFailure reports whether res represents an upstream error or a SERVFAIL,
+// either of which disqualifies it as the race winner.
+func isFailure(res *Result) bool {
+	return res == nil || res.Err != nil || (res.Msg != nil && res.Msg.Rcode == dns.RcodeServerFailure)
+}
+
+// statsFor returns u's stats entry, lazily creating one if u wasn't part of
+// the set NewParallelBestResolver was constructed with.
+func (r *ParallelBestResolver) statsFor(u Upstream) *upstreamStats {
+	v, _ := r.stats.LoadOrStore(u, &upstreamStats{})
+	return v.(*upstreamStats)
+}
+
+// pickTwo ranks upstreams by EWMA RTT ascending and returns the two
+// fastest, except explorationProbability of the time it swaps the second
+// pick for a uniformly random upstream.
+func (r *ParallelBestResolver) pickTwo() []Upstream {
+	type ranked struct {
+		upstream Upstream
+		rtt      time.Duration
+	}
+	ranks := make([]ranked, len(r.upstreams))
+	for i, u := range r.upstreams {
+		rtt, _ := r.statsFor(u).snapshot()
+		ranks[i] = ranked{upstream: u, rtt: rtt}
+	}
+	sort.Slice(ranks, func(a, b int) bool { return ranks[a].rtt < ranks[b].rtt })
+
+	picked := []Upstream{ranks[0].upstream, ranks[1].upstream}
+	if rand.Float64() < explorationProbability {
+		if alt := r.upstreams[rand.Intn(len(r.upstreams))]; alt != picked[0] {
+			picked[1] = alt
+		}
+	}
+	return picked
+}
@@ -0,0 +1,107 @@
+package resolver
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// fakeUpstream is a controllable Upstream for exercising
+// ParallelBestResolver's racing and ranking behavior without a real
+// network round-trip.
+type fakeUpstream struct {
+	name    string
+	delay   time.Duration
+	fail    bool
+	calls   int64
+	msgFunc func() *dns.Msg
+}
+
+func (u *fakeUpstream) Exchange(ctx context.Context, msg *dns.Msg) *Result {
+	atomic.AddInt64(&u.calls, 1)
+	select {
+	case <-time.After(u.delay):
+	case <-ctx.Done():
+		return &Result{Err: ctx.Err()}
+	}
+	if u.fail {
+		return &Result{Err: errors.New("fake upstream failure")}
+	}
+	if u.msgFunc != nil {
+		return &Result{Msg: u.msgFunc()}
+	}
+	m := new(dns.Msg)
+	m.SetReply(msg)
+	return &Result{Msg: m}
+}
+
+func (u *fakeUpstream) calledTimes() int64 {
+	return atomic.LoadInt64(&u.calls)
+}
+
+func newQuery() *dns.Msg {
+	m := new(dns.Msg)
+	m.SetQuestion("example.com.", dns.TypeA)
+	return m
+}
+
+func TestParallelBestResolver_ReturnsFastestResponse(t *testing.T) {
+	fast := &fakeUpstream{name: "fast", delay: 5 * time.Millisecond}
+	slow := &fakeUpstream{name: "slow", delay: 200 * time.Millisecond}
+
+	r := NewParallelBestResolver([]Upstream{fast, slow})
+
+	res := r.Exchange(context.Background(), newQuery())
+	if res.Err != nil {
+		t.Fatalf("unexpected error: %v", res.Err)
+	}
+}
+
+func TestParallelBestResolver_FallsBackWhenOneUpstreamFails(t *testing.T) {
+	good := &fakeUpstream{name: "good", delay: 10 * time.Millisecond}
+	broken := &fakeUpstream{name: "broken", delay: time.Millisecond, fail: true}
+
+	r := NewParallelBestResolver([]Upstream{good, broken})
+
+	res := r.Exchange(context.Background(), newQuery())
+	if res.Err != nil {
+		t.Fatalf("expected the surviving upstream's answer, got error: %v", res.Err)
+	}
+}
+
+func TestParallelBestResolver_RoutingShiftsTowardFasterUpstream(t *testing.T) {
+	fast := &fakeUpstream{name: "fast", delay: 2 * time.Millisecond}
+	slow := &fakeUpstream{name: "slow", delay: 50 * time.Millisecond}
+	idle := &fakeUpstream{name: "idle", delay: 50 * time.Millisecond}
+
+	r := NewParallelBestResolver([]Upstream{fast, slow, idle})
+
+	for i := 0; i < 20; i++ {
+		r.Exchange(context.Background(), newQuery())
+	}
+
+	fastRTT, _ := r.statsFor(fast).snapshot()
+	slowRTT, _ := r.statsFor(slow).snapshot()
+	if fastRTT >= slowRTT {
+		t.Fatalf("expected fast upstream's EWMA RTT (%v) to end up below slow's (%v)", fastRTT, slowRTT)
+	}
+
+	// The idle upstream should rarely be picked once fast/slow are ranked,
+	// except via exploration, so it should see far fewer calls.
+	if idle.calledTimes() >= fast.calledTimes() {
+		t.Fatalf("expected idle upstream to be raced far less often than fast: idle=%d fast=%d", idle.calledTimes(), fast.calledTimes())
+	}
+}
+
+func TestParallelBestResolver_PanicsWithFewerThanTwoUpstreams(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Fatal("expected NewParallelBestResolver to panic with a single upstream")
+		}
+	}()
+	NewParallelBestResolver([]Upstream{&fakeUpstream{}})
+}
@@ -9,6 +9,8 @@ import (
 	"dns-resolver/internal/cache"
 	"dns-resolver/internal/config"
 	"dns-resolver/internal/metrics"
+	"dns-resolver/internal/reqlog"
+	"dns-resolver/internal/workerpool"
 
 	"github.com/miekg/dns"
 	"github.com/miekg/unbound"
@@ -21,7 +23,7 @@ type Resolver struct {
 	cache      *cache.Cache
 	sf         singleflight.Group
 	unbound    *unbound.Unbound
-	workerPool *WorkerPool
+	workerPool *workerpool.Pool
 	metrics    *metrics.Metrics
 }
 
@@ -40,7 +42,7 @@ func NewResolver(cfg *config.Config, c *cache.Cache, m *metrics.Metrics) *Resolv
 		cache:      c,
 		sf:         singleflight.Group{},
 		unbound:    u,
-		workerPool: NewWorkerPool(cfg.MaxWorkers),
+		workerPool: workerpool.New(cfg.MaxWorkers, cfg.MaxWorkerQueueDepth, "unbound", m),
 		metrics:    m,
 	}
 	return r
@@ -59,24 +61,35 @@ func (r *Resolver) GetConfig() *config.Config {
 // Resolve performs a recursive DNS lookup for a given request.
 func (r *Resolver) Resolve(ctx context.Context, req *dns.Msg) (*dns.Msg, error) {
 	q := req.Question[0]
-	key := cache.Key(q)
+	do := false
+	if opt := req.IsEdns0(); opt != nil {
+		do = opt.Do()
+	}
+	cd := req.CheckingDisabled
+	key := cache.Key(q, do, cd)
 
 	// Check the cache first.
 	if cachedMsg, found, revalidate := r.cache.Get(key); found {
-		log.Printf("Cache hit for %s (revalidate: %t)", q.Name, revalidate)
+		logger := reqlog.FromCtx(ctx)
+		logger.Debug("cache hit", "revalidate", revalidate)
 		cachedMsg.Id = req.Id
 
 		if revalidate {
 			r.metrics.IncrementCacheRevalidations()
-			// Trigger a background revalidation using the worker pool
+			// Trigger a background revalidation using the worker pool. The
+			// background context carries the same request-scoped logger as
+			// ctx so revalidation log lines still trace back to the query
+			// that triggered them, even though it runs past the original
+			// request's own deadline.
 			go func() {
-				if err := r.workerPool.Acquire(context.Background()); err != nil {
-					log.Printf("Failed to acquire worker for revalidation: %v", err)
+				bgCtx := reqlog.NewContext(context.Background(), logger)
+				if err := r.workerPool.Acquire(bgCtx); err != nil {
+					logger.Warn("failed to acquire worker for revalidation", "error", err)
 					return
 				}
 				defer r.workerPool.Release()
 
-				ctx, cancel := context.WithTimeout(context.Background(), r.config.UpstreamTimeout)
+				bgCtx, cancel := context.WithTimeout(bgCtx, r.config.UpstreamTimeout)
 				defer cancel()
 
 				// Create a new request for revalidation to avoid race conditions on the original request object.
@@ -88,16 +101,16 @@ func (r *Resolver) Resolve(ctx context.Context, req *dns.Msg) (*dns.Msg, error)
 				}
 
 				res, err, _ := r.sf.Do(key+"-revalidate", func() (interface{}, error) {
-					return r.exchange(ctx, revalidationReq)
+					return r.exchange(bgCtx, revalidationReq)
 				})
 				if err != nil {
-					log.Printf("Background revalidation failed for %s: %v", q.Name, err)
+					logger.Warn("background revalidation failed", "error", err)
 					return
 				}
 
 				if msg, ok := res.(*dns.Msg); ok {
 					r.cache.Set(key, msg, r.config.StaleWhileRevalidate)
-					log.Printf("Successfully revalidated and updated cache for %s", q.Name)
+					logger.Debug("successfully revalidated and updated cache entry")
 				}
 			}()
 		}
@@ -122,21 +135,59 @@ func (r *Resolver) Resolve(ctx context.Context, req *dns.Msg) (*dns.Msg, error)
 	return msg, nil
 }
 
-// exchange is a wrapper around the unbound resolver's Resolve method.
+// unboundResult bundles unbound.Resolve's two return values so they can
+// travel together over resultCh in exchange.
+type unboundResult struct {
+	result *unbound.Result
+	err    error
+}
+
+// exchange is a wrapper around the unbound resolver's Resolve method. It
+// runs the blocking libunbound call in a goroutine bounded by workerPool and
+// races it against ctx.Done(), so a client that times out or disconnects
+// doesn't leave exchange's caller blocked for the full libunbound call too.
+//
+// This is only a partial fix for cancellation: github.com/miekg/unbound's
+// own doc comment says it doesn't implement ub_cancel ("not useful in Go"),
+// so there is no way to actually stop the in-flight libunbound worker
+// thread. On ctx cancellation the goroutine below keeps running in the
+// background until libunbound itself returns; its result is discarded and
+// its worker-pool slot is released at that point, not before.
 func (r *Resolver) exchange(ctx context.Context, req *dns.Msg) (*dns.Msg, error) {
 	q := req.Question[0]
-	startTime := time.Now()
+	logger := reqlog.FromCtx(ctx)
 
-	// Note: The Go wrapper for libunbound doesn't seem to support passing context for cancellation.
-	result, err := r.unbound.Resolve(q.Name, q.Qtype, q.Qclass)
+	if err := r.workerPool.Acquire(ctx); err != nil {
+		return nil, err
+	}
+
+	startTime := time.Now()
+	resultCh := make(chan unboundResult, 1)
+	go func() {
+		defer r.workerPool.Release()
+		result, err := r.unbound.Resolve(q.Name, q.Qtype, q.Qclass)
+		resultCh <- unboundResult{result, err}
+	}()
+
+	var result *unbound.Result
+	var err error
+	select {
+	case <-ctx.Done():
+		logger.Warn("unbound exchange abandoned on context cancellation", "cause", ctx.Err())
+		msg := new(dns.Msg)
+		msg.SetRcode(req, dns.RcodeServerFailure)
+		return msg, ctx.Err()
+	case res := <-resultCh:
+		result, err = res.result, res.err
+	}
 	latency := time.Since(startTime)
 
 	// Always record latency
-	r.metrics.RecordLatency(q.Name, latency)
+	r.metrics.RecordLatency(dns.TypeToString[q.Qtype], latency)
 
 	if err != nil {
 		r.metrics.IncrementUnboundErrors()
-		log.Printf("Unbound resolution error for %s: %v", q.Name, err)
+		logger.Error("unbound resolution error", "error", err)
 		// When an error occurs, unbound does not return a message.
 		// We'll construct a SERVFAIL to send back to the client.
 		msg := new(dns.Msg)
@@ -162,18 +213,18 @@ func (r *Resolver) exchange(ctx context.Context, req *dns.Msg) (*dns.Msg, error)
 
 	if result.Bogus {
 		r.metrics.RecordDNSSECValidation("bogus")
-		log.Printf("DNSSEC validation for %s resulted in BOGUS.", q.Name)
+		logger.Warn("DNSSEC validation resulted in BOGUS")
 		// The test expects an error for bogus domains. We'll return a SERVFAIL
 		// message that the calling handler can use, along with an error.
 		msg.Rcode = dns.RcodeServerFailure
 		return msg, errors.New("BOGUS: DNSSEC validation failed")
 	} else if result.Secure {
 		r.metrics.RecordDNSSECValidation("secure")
-		log.Printf("DNSSEC validation for %s resulted in SECURE.", q.Name)
+		logger.Debug("DNSSEC validation resulted in SECURE")
 		msg.AuthenticatedData = true
 	} else {
 		r.metrics.RecordDNSSECValidation("insecure")
-		log.Printf("DNSSEC validation for %s resulted in INSECURE.", q.Name)
+		logger.Debug("DNSSEC validation resulted in INSECURE")
 		msg.AuthenticatedData = false
 	}
 
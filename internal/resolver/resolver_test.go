@@ -61,7 +61,7 @@ func TestResolver_Resolve(t *testing.T) {
 		t.Fatalf("Failed to create temp dir: %v", err)
 	}
 	defer os.RemoveAll(dir)
-	m := metrics.NewMetrics()
+	m := metrics.NewMetrics(cfg)
 	c := cache.NewCache(cache.DefaultCacheSize, cache.DefaultShards, cfg.PrefetchInterval, dir, m)
 	defer c.Close()
 	r := NewResolver(cfg, c, m)
@@ -174,7 +174,7 @@ func TestResolver_Resolve_DNSSEC(t *testing.T) {
 				t.Fatalf("Failed to create temp dir: %v", err)
 			}
 			defer os.RemoveAll(dir)
-			m := metrics.NewMetrics()
+			m := metrics.NewMetrics(cfg)
 			c := cache.NewCache(cache.DefaultCacheSize, cache.DefaultShards, cfg.PrefetchInterval, dir, m)
 			defer c.Close()
 			r := NewResolver(cfg, c, m)
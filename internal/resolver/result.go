@@ -0,0 +1,12 @@
+package resolver
+
+import "github.com/miekg/dns"
+
+// Result is the outcome of a single upstream Exchange call: either Msg is
+// populated with a response, or Err explains why it isn't. It's the return
+// type server.ResolverInterface standardizes on, so CachingResolver and
+// ParallelBestResolver can treat any upstream implementation the same way.
+type Result struct {
+	Msg *dns.Msg
+	Err error
+}
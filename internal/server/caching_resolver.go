@@ -3,75 +3,307 @@ package server
 import (
 	"context"
 	"dns-resolver/internal/cache"
+	"dns-resolver/internal/dnstap"
+	"dns-resolver/internal/metrics"
 	"github.com/miekg/dns"
+	"golang.org/x/sync/singleflight"
 	"log"
+	"strings"
 	"time"
 )
 
+// upstreamTimeout bounds how long Exchange waits on the upstream resolver
+// before falling back to a stale cache entry (RFC 8767), so a slow or dead
+// upstream doesn't stall every miss for the caller's full context deadline.
+const upstreamTimeout = 1800 * time.Millisecond
+
+// defaultStaleAnswerTTLSecs is used when CacheConfig.StaleAnswerTTLSecs is
+// unset but serve-stale is otherwise enabled via MaxStaleTTLSecs.
+const defaultStaleAnswerTTLSecs = 30
+
+// defaultStaleRefreshWorkers bounds concurrent background stale refreshes
+// when CacheConfig.StaleRefreshWorkers isn't set.
+const defaultStaleRefreshWorkers = 4
+
 // CachingResolver wraps a resolver to add a caching layer.
 type CachingResolver struct {
 	cache    *cache.ShardedCache
 	resolver ResolverInterface
+	metrics  *metrics.Metrics
+	dnstap   *dnstap.Logger
+	// sf coalesces concurrent upstream exchanges for the same cache key, so
+	// a background prefetch refetch and an in-flight client miss for the
+	// same question never both hit the upstream resolver.
+	sf singleflight.Group
+	// staleRefreshSem bounds how many StaleRefreshMode "immediate" background
+	// refreshes may run concurrently, so a burst of stale hits can't exhaust
+	// goroutines the way an unbounded fan-out would.
+	staleRefreshSem chan struct{}
+}
+
+// SetDnstap wires l so every upstream exchange emits RESOLVER_QUERY/
+// RESOLVER_RESPONSE dnstap frames. A nil l (dnstap disabled, or left unset
+// in tests) makes exchangeUpstream's calls into it no-ops.
+func (r *CachingResolver) SetDnstap(l *dnstap.Logger) {
+	r.dnstap = l
 }
 
-// NewCachingResolver creates a new CachingResolver.
-func NewCachingResolver(cache *cache.ShardedCache, resolver ResolverInterface) *CachingResolver {
-	return &CachingResolver{
-		cache:    cache,
-		resolver: resolver,
+// NewCachingResolver creates a new CachingResolver. If cache.Config.PrefetchingEnabled
+// is set, it also wires itself as the cache's TTL-driven prefetch callback.
+func NewCachingResolver(cache *cache.ShardedCache, resolver ResolverInterface, m *metrics.Metrics) *CachingResolver {
+	staleRefreshWorkers := cache.Config.StaleRefreshWorkers
+	if staleRefreshWorkers <= 0 {
+		staleRefreshWorkers = defaultStaleRefreshWorkers
+	}
+	r := &CachingResolver{
+		cache:           cache,
+		resolver:        resolver,
+		metrics:         m,
+		staleRefreshSem: make(chan struct{}, staleRefreshWorkers),
 	}
+	cache.SetMetrics(m)
+	if cache.Config.PrefetchingEnabled {
+		cache.SetPrefetchCallback(r.prefetch)
+	}
+	return r
 }
 
 // Exchange performs a DNS query, using the cache first.
 func (r *CachingResolver) Exchange(ctx context.Context, msg *dns.Msg) (*dns.Msg, error) {
-	cacheKey := msg.Question[0].Name + ":" + dns.TypeToString[msg.Question[0].Qtype]
+	do := false
+	if opt := msg.IsEdns0(); opt != nil {
+		do = opt.Do()
+	}
+	cd := msg.CheckingDisabled
+	cacheKey := cache.CacheKey{
+		Qname:  msg.Question[0].Name,
+		Qtype:  msg.Question[0].Qtype,
+		Qclass: msg.Question[0].Qclass,
+		DO:     do,
+		CD:     cd,
+	}
 
 	// Try to get the response from cache
-	if cachedMsg, found, isNegative, _ := r.cache.Get(cacheKey); found {
+	cachedMsg, found, isNegative, _, stale, ttlRemaining := r.cache.Get(cacheKey)
+	if found {
 		if isNegative {
 			log.Printf("Cache HIT (negative) for %s", cacheKey)
-			m := new(dns.Msg)
-			m.SetRcode(msg, dns.RcodeServerFailure) // Or whatever the cached rcode was
-			return m, nil
+			return r.negativeAnswer(msg, cachedMsg, ttlRemaining), nil
 		} else {
 			log.Printf("Cache HIT (positive) for %s", cacheKey)
 			cachedMsg.Id = msg.Id
 			return cachedMsg, nil
 		}
 	}
+	if stale && cachedMsg != nil && r.cache.Config.StaleRefreshMode == "immediate" {
+		log.Printf("Serving stale entry for %s immediately, refreshing in background", cacheKey)
+		r.scheduleStaleRefresh(cacheKey)
+		return r.staleAnswer(msg, cachedMsg), nil
+	}
+	if !stale {
+		if synthesized, ok := r.cache.SynthesizeFromRRsets(msg.Question[0]); ok {
+			log.Printf("Synthesized %s from cached RRsets via CNAME chain", cacheKey)
+			synthesized.SetRcode(msg, synthesized.Rcode)
+			synthesized.RecursionAvailable = true
+			return synthesized, nil
+		}
+	}
 	log.Printf("Cache MISS for %s", cacheKey)
 
-	upstreamMsg := new(dns.Msg)
-	upstreamMsg.SetQuestion(msg.Question[0].Name, msg.Question[0].Qtype)
-	upstreamMsg.SetEdns0(4096, true)
-
-	result := r.resolver.Exchange(ctx, upstreamMsg)
-	if result.Err != nil {
-		log.Printf("Error exchanging DNS query: %v", result.Err)
+	upstreamMsg, err := r.exchangeUpstream(ctx, cacheKey)
+	if err != nil {
+		log.Printf("Error exchanging DNS query: %v", err)
+		if stale && cachedMsg != nil {
+			log.Printf("Serving stale entry for %s after upstream failure: %v", cacheKey, err)
+			return r.staleAnswer(msg, cachedMsg), nil
+		}
 		if r.cache.Config.NegativeCacheEnabled {
 			ttl := time.Duration(r.cache.Config.NegativeTTLSecs) * time.Second
 			r.cache.Set(cacheKey, nil, ttl, true, false)
 		}
-		return nil, result.Err
+		return nil, err
 	}
 
-	result.Msg.SetRcode(msg, result.Msg.Rcode)
-	result.Msg.RecursionAvailable = true
+	if upstreamMsg.Rcode == dns.RcodeServerFailure && stale && cachedMsg != nil {
+		log.Printf("Serving stale entry for %s after upstream SERVFAIL", cacheKey)
+		return r.staleAnswer(msg, cachedMsg), nil
+	}
 
-	isNegative := result.Msg.Rcode != dns.RcodeSuccess
-	ttl := r.getTTL(result.Msg, isNegative)
+	cacheable := shouldCache(upstreamMsg, dns.Question{Name: cacheKey.Qname, Qtype: cacheKey.Qtype, Qclass: cacheKey.Qclass})
+
+	upstreamMsg.SetRcode(msg, upstreamMsg.Rcode)
+	upstreamMsg.RecursionAvailable = true
+
+	isNegative = upstreamMsg.Rcode != dns.RcodeSuccess
+	ttl := r.getTTL(upstreamMsg, isNegative)
 
 	// We only cache validated responses, but the underlying resolver library
 	// doesn't seem to populate the AuthenticatedData flag correctly in all cases.
 	// For now, we will cache all successful responses.
 	// A future improvement would be to ensure DNSSEC validation is robust and only cache validated data.
-	if !isNegative {
-		r.cache.Set(cacheKey, result.Msg, ttl, false, true)
-	} else if r.cache.Config.NegativeCacheEnabled {
-		r.cache.Set(cacheKey, result.Msg, ttl, true, true)
+	if cacheable && !isNegative {
+		if !zoneCacheDisabled(cacheKey.Qname, r.cache.Config.DisableSuccess) {
+			r.cache.Set(cacheKey, upstreamMsg, ttl, false, true)
+		}
+	} else if cacheable && r.cache.Config.NegativeCacheEnabled {
+		if !zoneCacheDisabled(cacheKey.Qname, r.cache.Config.DisableDenial) {
+			r.cache.Set(cacheKey, upstreamMsg, ttl, true, true)
+		}
+	}
+
+	return upstreamMsg, nil
+}
+
+// shouldCache reports whether resp is safe to cache as the answer to want.
+// A truncated response should make the client retry over TCP rather than be
+// pinned to incomplete UDP data for a full TTL; a non-standard opcode, a
+// question section that doesn't echo what was asked, or more than one
+// question all signal a malformed or unexpected reply that shouldn't poison
+// the cache.
+func shouldCache(resp *dns.Msg, want dns.Question) bool {
+	if resp.Truncated {
+		return false
+	}
+	if resp.Opcode != dns.OpcodeQuery {
+		return false
 	}
+	if len(resp.Question) != 1 {
+		return false
+	}
+	q := resp.Question[0]
+	return q.Name == want.Name && q.Qtype == want.Qtype && q.Qclass == want.Qclass
+}
+
+// exchangeUpstream queries the upstream resolver for cacheKey, coalescing
+// concurrent callers (a client miss and a background prefetch alike) onto a
+// single in-flight request via sf. Each caller gets back its own Copy, since
+// the shared result is later mutated in place (SetRcode, TTL rewrites).
+func (r *CachingResolver) exchangeUpstream(ctx context.Context, cacheKey cache.CacheKey) (*dns.Msg, error) {
+	v, err, _ := r.sf.Do(cacheKey.String(), func() (interface{}, error) {
+		upstreamMsg := new(dns.Msg)
+		upstreamMsg.SetQuestion(cacheKey.Qname, cacheKey.Qtype)
+		upstreamMsg.SetEdns0(4096, true)
+
+		upstreamCtx, cancel := context.WithTimeout(ctx, upstreamTimeout)
+		defer cancel()
+
+		// ResolverInterface doesn't expose which backend/address ultimately
+		// answered, so the upstream address dnstap would normally carry is
+		// left empty here.
+		queryTime := time.Now()
+		r.dnstap.LogResolverQuery(upstreamMsg, "", queryTime)
 
-	return result.Msg, nil
+		result := r.resolver.Exchange(upstreamCtx, upstreamMsg)
+		if result.Err != nil {
+			return nil, result.Err
+		}
+		r.dnstap.LogResolverResponse(upstreamMsg, result.Msg, "", queryTime, time.Now())
+		return result.Msg, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return v.(*dns.Msg).Copy(), nil
+}
+
+// prefetch is wired to the cache as its PrefetchCallback: it refetches a
+// hot, near-expiry key from upstream (through the same singleflight group
+// as Exchange, so it never duplicates an in-flight client lookup) and
+// replaces the cached entry on success.
+func (r *CachingResolver) prefetch(key cache.CacheKey, _ *dns.Msg) error {
+	ctx, cancel := context.WithTimeout(context.Background(), upstreamTimeout)
+	defer cancel()
+
+	result, err := r.exchangeUpstream(ctx, key)
+	if err != nil {
+		return err
+	}
+
+	isNegative := result.Rcode != dns.RcodeSuccess
+	ttl := r.getTTL(result, isNegative)
+	r.cache.Set(key, result, ttl, isNegative, true)
+	return nil
+}
+
+// scheduleStaleRefresh kicks off an async upstream refresh of key in the
+// bounded staleRefreshSem pool, for StaleRefreshMode "immediate": the caller
+// has already answered from the stale entry, so a failed or dropped refresh
+// here just leaves that entry in place to be retried on its next stale hit.
+func (r *CachingResolver) scheduleStaleRefresh(key cache.CacheKey) {
+	select {
+	case r.staleRefreshSem <- struct{}{}:
+	default:
+		return
+	}
+
+	go func() {
+		defer func() { <-r.staleRefreshSem }()
+		if err := r.prefetch(key, nil); err != nil {
+			log.Printf("Background stale refresh failed for %s: %v", key, err)
+		}
+	}()
+}
+
+// staleAnswer builds a reply to req from a stale cache entry per RFC 8767:
+// TTLs are clamped down to Config.StaleAnswerTTLSecs (or
+// defaultStaleAnswerTTLSecs if unset) so whatever is downstream of us
+// re-checks again soon, and RecursionAvailable is set since this is still a
+// recursion-capable answer, just one served from an expired record instead
+// of a fresh upstream query.
+func (r *CachingResolver) staleAnswer(req *dns.Msg, cached *dns.Msg) *dns.Msg {
+	ttlSecs := r.cache.Config.StaleAnswerTTLSecs
+	if ttlSecs <= 0 {
+		ttlSecs = defaultStaleAnswerTTLSecs
+	}
+	ttl := uint32(ttlSecs)
+
+	res := cached.Copy()
+	res.SetRcode(req, cached.Rcode)
+	res.RecursionAvailable = true
+	for _, rr := range res.Answer {
+		rr.Header().Ttl = ttl
+	}
+	return res
+}
+
+// negativeAnswer builds a reply to req from a negative cache entry: it
+// reuses the cached response's own rcode (NXDOMAIN or NOERROR/NODATA) rather
+// than always answering SERVFAIL, copies the authority-section SOA into the
+// reply, and stamps the SOA with ttlRemaining (how much of the negative
+// entry's TTL is actually left) so a downstream cache sees a consistent
+// countdown rather than the original, unshrinking TTL.
+func (r *CachingResolver) negativeAnswer(req *dns.Msg, cached *dns.Msg, ttlRemaining time.Duration) *dns.Msg {
+	res := cached.Copy()
+	res.SetRcode(req, cached.Rcode)
+	res.RecursionAvailable = true
+
+	ttl := uint32(ttlRemaining.Seconds())
+	for _, rr := range res.Ns {
+		if soa, ok := rr.(*dns.SOA); ok {
+			soa.Hdr.Ttl = ttl
+		}
+	}
+	return res
+}
+
+// zoneCacheDisabled reports whether name falls under the cache-disable
+// policy described by zones (CacheConfig.DisableSuccess/DisableDenial): an
+// unconfigured (nil) list never disables anything, a configured but empty
+// list disables unconditionally, and otherwise name must be equal to, or a
+// subdomain of, one of the listed zones.
+func zoneCacheDisabled(name string, zones []string) bool {
+	if zones == nil {
+		return false
+	}
+	if len(zones) == 0 {
+		return true
+	}
+	for _, zone := range zones {
+		if name == zone || strings.HasSuffix(name, "."+zone) {
+			return true
+		}
+	}
+	return false
 }
 
 func (r *CachingResolver) getTTL(msg *dns.Msg, isNegative bool) time.Duration {
@@ -3,11 +3,14 @@ package server_test
 import (
 	"context"
 	"dns-resolver/internal/cache"
+	"dns-resolver/internal/config"
+	"dns-resolver/internal/metrics"
 	"dns-resolver/internal/resolver"
 	"dns-resolver/internal/server"
 	"fmt"
 	"github.com/miekg/dns"
 	"net"
+	"sync/atomic"
 	"testing"
 	"time"
 )
@@ -82,7 +85,7 @@ func TestCachingResolverCacheHit(t *testing.T) {
 	rr, _ := dns.NewRR(qname + " 60 IN A 1.2.3.4")
 	msg.Answer = append(msg.Answer, rr)
 
-	shardedCache.Set(qname+":"+dns.TypeToString[qtype], msg, 60*time.Second, false, true)
+	shardedCache.Set(cache.CacheKey{Qname: qname, Qtype: qtype, Qclass: dns.ClassINET}, msg, 60*time.Second, false, true)
 
 	// The underlying resolver should not be called.
 	baseResolver := &mockResolver{
@@ -91,7 +94,7 @@ func TestCachingResolverCacheHit(t *testing.T) {
 			return nil
 		},
 	}
-	cachingResolver := server.NewCachingResolver(shardedCache, baseResolver)
+	cachingResolver := server.NewCachingResolver(shardedCache, baseResolver, nil)
 
 	req := new(dns.Msg)
 	req.SetQuestion(qname, qtype)
@@ -109,6 +112,88 @@ func TestCachingResolverCacheHit(t *testing.T) {
 	}
 }
 
+func TestCachingResolverNegativeCacheHitReturnsCachedRcodeAndSOA(t *testing.T) {
+	cacheConfig := cache.CacheConfig{MaxEntries: 10, NegativeCacheEnabled: true}
+	shardedCache := cache.NewShardedCache(1, 1*time.Minute, cacheConfig)
+
+	qname := "nxdomain.example."
+	qtype := dns.TypeA
+
+	negMsg := new(dns.Msg)
+	negMsg.SetQuestion(qname, qtype)
+	negMsg.Rcode = dns.RcodeNameError
+	soa, _ := dns.NewRR("example. 3600 IN SOA ns.example. hostmaster.example. 1 7200 3600 1209600 3600")
+	negMsg.Ns = append(negMsg.Ns, soa)
+
+	shardedCache.Set(cache.CacheKey{Qname: qname, Qtype: qtype, Qclass: dns.ClassINET}, negMsg, 60*time.Second, true, true)
+
+	// The underlying resolver should not be called.
+	baseResolver := &mockResolver{
+		exchangeFunc: func(ctx context.Context, msg *dns.Msg) *resolver.Result {
+			t.Fatal("Expected resolver.Exchange not to be called on a negative cache hit")
+			return nil
+		},
+	}
+	cachingResolver := server.NewCachingResolver(shardedCache, baseResolver, nil)
+
+	req := new(dns.Msg)
+	req.SetQuestion(qname, qtype)
+
+	resp, err := cachingResolver.Exchange(context.Background(), req)
+	if err != nil {
+		t.Fatalf("Expected no error on a negative cache hit, got: %v", err)
+	}
+	if resp.Rcode != dns.RcodeNameError {
+		t.Fatalf("Expected the cached NXDOMAIN rcode, got %s", dns.RcodeToString[resp.Rcode])
+	}
+	if len(resp.Ns) != 1 {
+		t.Fatalf("Expected the cached SOA to be copied into the authority section, got %v", resp.Ns)
+	}
+	gotSOA, ok := resp.Ns[0].(*dns.SOA)
+	if !ok {
+		t.Fatalf("Expected an SOA record in the authority section, got %T", resp.Ns[0])
+	}
+	if gotSOA.Hdr.Ttl == 0 || gotSOA.Hdr.Ttl > 60 {
+		t.Errorf("Expected the SOA TTL to reflect the remaining TTL (<=60s), got %d", gotSOA.Hdr.Ttl)
+	}
+}
+
+func TestCachingResolverDoesNotServeCDEntryToNonCDQuery(t *testing.T) {
+	qname := "example.com."
+	qtype := dns.TypeA
+	cacheConfig := cache.CacheConfig{MaxEntries: 10}
+	shardedCache := cache.NewShardedCache(1, 1*time.Minute, cacheConfig)
+
+	msg := new(dns.Msg)
+	msg.SetQuestion(qname, qtype)
+	rr, _ := dns.NewRR(qname + " 60 IN A 1.2.3.4")
+	msg.Answer = append(msg.Answer, rr)
+
+	// Seed only a CD=1 entry - one that may have skipped or failed
+	// DNSSEC validation.
+	shardedCache.Set(cache.CacheKey{Qname: qname, Qtype: qtype, Qclass: dns.ClassINET, CD: true}, msg, 60*time.Second, false, false)
+
+	called := false
+	baseResolver := &mockResolver{
+		exchangeFunc: func(ctx context.Context, msg *dns.Msg) *resolver.Result {
+			called = true
+			return &resolver.Result{Err: fmt.Errorf("mock resolver unreachable")}
+		},
+	}
+	cachingResolver := server.NewCachingResolver(shardedCache, baseResolver, nil)
+
+	req := new(dns.Msg)
+	req.SetQuestion(qname, qtype)
+	req.CheckingDisabled = false
+
+	if _, err := cachingResolver.Exchange(context.Background(), req); err == nil {
+		t.Fatal("expected the CD=0 query to miss the CD=1 entry and hit the resolver")
+	}
+	if !called {
+		t.Error("expected the CD=1 cache entry not to be served to a CD=0 query")
+	}
+}
+
 func TestCachingResolverCacheMiss(t *testing.T) {
 	qname := "example.com."
 	qtype := dns.TypeA
@@ -126,7 +211,7 @@ func TestCachingResolverCacheMiss(t *testing.T) {
 			return &resolver.Result{Msg: mockResp}
 		},
 	}
-	cachingResolver := server.NewCachingResolver(shardedCache, baseResolver)
+	cachingResolver := server.NewCachingResolver(shardedCache, baseResolver, nil)
 
 	req := new(dns.Msg)
 	req.SetQuestion(qname, qtype)
@@ -140,8 +225,8 @@ func TestCachingResolverCacheMiss(t *testing.T) {
 	}
 
 	// Verify that the response is now in the cache.
-	cacheKey := qname + ":" + dns.TypeToString[qtype]
-	cachedMsg, found, isNegative, _ := shardedCache.Get(cacheKey)
+	cacheKey := cache.CacheKey{Qname: qname, Qtype: qtype, Qclass: dns.ClassINET}
+	cachedMsg, found, isNegative, _, _, _ := shardedCache.Get(cacheKey)
 
 	if !found {
 		t.Fatal("Expected to find a cache entry after resolution")
@@ -153,3 +238,643 @@ func TestCachingResolverCacheMiss(t *testing.T) {
 		t.Fatalf("Expected 1 answer record in cached message, got %d", len(cachedMsg.Answer))
 	}
 }
+
+func TestCachingResolverServesStaleOnUpstreamFailure(t *testing.T) {
+	qname := "example.com."
+	qtype := dns.TypeA
+	cacheConfig := cache.CacheConfig{MaxEntries: 10, MaxStaleTTLSecs: 3600, StaleAnswerTTLSecs: 30}
+	shardedCache := cache.NewShardedCache(1, 1*time.Minute, cacheConfig)
+
+	msg := new(dns.Msg)
+	msg.SetQuestion(qname, qtype)
+	rr, _ := dns.NewRR(qname + " 60 IN A 1.2.3.4")
+	msg.Answer = append(msg.Answer, rr)
+
+	// Seed an already-expired entry, within the stale window.
+	shardedCache.Set(cache.CacheKey{Qname: qname, Qtype: qtype, Qclass: dns.ClassINET}, msg, -1*time.Second, false, true)
+
+	baseResolver := &mockResolver{
+		exchangeFunc: func(ctx context.Context, msg *dns.Msg) *resolver.Result {
+			return &resolver.Result{Err: fmt.Errorf("mock resolver unreachable")}
+		},
+	}
+	cachingResolver := server.NewCachingResolver(shardedCache, baseResolver, nil)
+
+	req := new(dns.Msg)
+	req.SetQuestion(qname, qtype)
+
+	resp, err := cachingResolver.Exchange(context.Background(), req)
+	if err != nil {
+		t.Fatalf("Expected a stale answer instead of an error, got: %v", err)
+	}
+	if !resp.RecursionAvailable {
+		t.Error("Expected a stale answer to set RecursionAvailable")
+	}
+	if len(resp.Answer) != 1 {
+		t.Fatalf("Expected 1 answer record in the stale answer, got %d", len(resp.Answer))
+	}
+	if ttl := resp.Answer[0].Header().Ttl; ttl != 30 {
+		t.Errorf("Expected the stale answer's TTL clamped to StaleAnswerTTLSecs (30), got %d", ttl)
+	}
+}
+
+func TestCachingResolverRefreshesStaleEntryOnUpstreamSuccess(t *testing.T) {
+	qname := "example.com."
+	qtype := dns.TypeA
+	cacheConfig := cache.CacheConfig{MaxEntries: 10, MinTTLSecs: 1, MaxStaleTTLSecs: 3600, StaleAnswerTTLSecs: 30}
+	shardedCache := cache.NewShardedCache(1, 1*time.Minute, cacheConfig)
+
+	staleMsg := new(dns.Msg)
+	staleMsg.SetQuestion(qname, qtype)
+	staleRR, _ := dns.NewRR(qname + " 60 IN A 1.2.3.4")
+	staleMsg.Answer = append(staleMsg.Answer, staleRR)
+	shardedCache.Set(cache.CacheKey{Qname: qname, Qtype: qtype, Qclass: dns.ClassINET}, staleMsg, -1*time.Second, false, true)
+
+	freshMsg := new(dns.Msg)
+	freshMsg.SetQuestion(qname, qtype)
+	freshRR, _ := dns.NewRR(qname + " 120 IN A 5.6.7.8")
+	freshMsg.Answer = append(freshMsg.Answer, freshRR)
+
+	baseResolver := &mockResolver{
+		exchangeFunc: func(ctx context.Context, msg *dns.Msg) *resolver.Result {
+			return &resolver.Result{Msg: freshMsg}
+		},
+	}
+	cachingResolver := server.NewCachingResolver(shardedCache, baseResolver, nil)
+
+	req := new(dns.Msg)
+	req.SetQuestion(qname, qtype)
+
+	resp, err := cachingResolver.Exchange(context.Background(), req)
+	if err != nil {
+		t.Fatalf("Expected no error on upstream success, got: %v", err)
+	}
+	a, ok := resp.Answer[0].(*dns.A)
+	if !ok || a.A.String() != "5.6.7.8" {
+		t.Fatalf("Expected the refreshed upstream answer, got %v", resp.Answer)
+	}
+
+	cachedMsg, found, _, _, stale, _ := shardedCache.Get(cache.CacheKey{Qname: qname, Qtype: qtype, Qclass: dns.ClassINET})
+	if !found || stale {
+		t.Fatal("Expected the refresh to replace the stale entry with a fresh one")
+	}
+	if a, ok := cachedMsg.Answer[0].(*dns.A); !ok || a.A.String() != "5.6.7.8" {
+		t.Fatalf("Expected the cache to hold the refreshed answer, got %v", cachedMsg.Answer)
+	}
+}
+
+func TestCachingResolverImmediateModeServesStaleWithoutWaitingOnUpstream(t *testing.T) {
+	qname := "example.com."
+	qtype := dns.TypeA
+	cacheConfig := cache.CacheConfig{
+		MaxEntries:         10,
+		MinTTLSecs:         1,
+		MaxStaleTTLSecs:    3600,
+		StaleAnswerTTLSecs: 30,
+		StaleRefreshMode:   "immediate",
+	}
+	shardedCache := cache.NewShardedCache(1, 1*time.Minute, cacheConfig)
+
+	staleMsg := new(dns.Msg)
+	staleMsg.SetQuestion(qname, qtype)
+	staleRR, _ := dns.NewRR(qname + " 60 IN A 1.2.3.4")
+	staleMsg.Answer = append(staleMsg.Answer, staleRR)
+	shardedCache.Set(cache.CacheKey{Qname: qname, Qtype: qtype, Qclass: dns.ClassINET}, staleMsg, -1*time.Second, false, true)
+
+	freshMsg := new(dns.Msg)
+	freshMsg.SetQuestion(qname, qtype)
+	freshRR, _ := dns.NewRR(qname + " 120 IN A 5.6.7.8")
+	freshMsg.Answer = append(freshMsg.Answer, freshRR)
+
+	exchanged := make(chan struct{}, 1)
+	baseResolver := &mockResolver{
+		exchangeFunc: func(ctx context.Context, msg *dns.Msg) *resolver.Result {
+			exchanged <- struct{}{}
+			return &resolver.Result{Msg: freshMsg}
+		},
+	}
+	cachingResolver := server.NewCachingResolver(shardedCache, baseResolver, nil)
+
+	req := new(dns.Msg)
+	req.SetQuestion(qname, qtype)
+
+	resp, err := cachingResolver.Exchange(context.Background(), req)
+	if err != nil {
+		t.Fatalf("Expected the stale answer to be served immediately, got error: %v", err)
+	}
+	a, ok := resp.Answer[0].(*dns.A)
+	if !ok || a.A.String() != "1.2.3.4" {
+		t.Fatalf("Expected the stale answer back immediately, got %v", resp.Answer)
+	}
+
+	select {
+	case <-exchanged:
+	case <-time.After(1 * time.Second):
+		t.Fatal("expected a background refresh to reach the upstream resolver")
+	}
+}
+
+func TestCachingResolverServesStaleOnUpstreamSERVFAIL(t *testing.T) {
+	qname := "example.com."
+	qtype := dns.TypeA
+	cacheConfig := cache.CacheConfig{MaxEntries: 10, MaxStaleTTLSecs: 3600, StaleAnswerTTLSecs: 30}
+	shardedCache := cache.NewShardedCache(1, 1*time.Minute, cacheConfig)
+
+	msg := new(dns.Msg)
+	msg.SetQuestion(qname, qtype)
+	rr, _ := dns.NewRR(qname + " 60 IN A 1.2.3.4")
+	msg.Answer = append(msg.Answer, rr)
+	shardedCache.Set(cache.CacheKey{Qname: qname, Qtype: qtype, Qclass: dns.ClassINET}, msg, -1*time.Second, false, true)
+
+	servfail := new(dns.Msg)
+	servfail.SetQuestion(qname, qtype)
+	servfail.Rcode = dns.RcodeServerFailure
+
+	baseResolver := &mockResolver{
+		exchangeFunc: func(ctx context.Context, msg *dns.Msg) *resolver.Result {
+			return &resolver.Result{Msg: servfail}
+		},
+	}
+	cachingResolver := server.NewCachingResolver(shardedCache, baseResolver, nil)
+
+	req := new(dns.Msg)
+	req.SetQuestion(qname, qtype)
+
+	resp, err := cachingResolver.Exchange(context.Background(), req)
+	if err != nil {
+		t.Fatalf("Expected a stale answer instead of an error, got: %v", err)
+	}
+	if resp.Rcode != dns.RcodeSuccess {
+		t.Errorf("Expected the stale entry's success Rcode rather than SERVFAIL, got %s", dns.RcodeToString[resp.Rcode])
+	}
+	if len(resp.Answer) != 1 {
+		t.Fatalf("Expected 1 answer record in the stale answer, got %d", len(resp.Answer))
+	}
+}
+
+func TestCachingResolverPrefetchReplacesStaleNegativeEntryWithPositiveResult(t *testing.T) {
+	// Matches the DataDog CoreDNS patch: a successful prefetch/refresh must
+	// evict the old negative (NXDOMAIN) entry rather than leaving it to mask
+	// the newly-fetched positive answer.
+	qname := "example.com."
+	qtype := dns.TypeA
+	cacheConfig := cache.CacheConfig{
+		MaxEntries:           10,
+		NegativeCacheEnabled: true,
+		MaxStaleTTLSecs:      3600,
+		StaleAnswerTTLSecs:   30,
+	}
+	shardedCache := cache.NewShardedCache(1, 1*time.Minute, cacheConfig)
+
+	negMsg := new(dns.Msg)
+	negMsg.SetQuestion(qname, qtype)
+	negMsg.Rcode = dns.RcodeNameError
+	soa, _ := dns.NewRR("example. 3600 IN SOA ns.example. hostmaster.example. 1 7200 3600 1209600 3600")
+	negMsg.Ns = append(negMsg.Ns, soa)
+	shardedCache.Set(cache.CacheKey{Qname: qname, Qtype: qtype, Qclass: dns.ClassINET}, negMsg, -1*time.Second, true, true)
+
+	freshMsg := new(dns.Msg)
+	freshMsg.SetQuestion(qname, qtype)
+	freshRR, _ := dns.NewRR(qname + " 120 IN A 5.6.7.8")
+	freshMsg.Answer = append(freshMsg.Answer, freshRR)
+
+	baseResolver := &mockResolver{
+		exchangeFunc: func(ctx context.Context, msg *dns.Msg) *resolver.Result {
+			return &resolver.Result{Msg: freshMsg}
+		},
+	}
+	cachingResolver := server.NewCachingResolver(shardedCache, baseResolver, nil)
+
+	req := new(dns.Msg)
+	req.SetQuestion(qname, qtype)
+
+	if _, err := cachingResolver.Exchange(context.Background(), req); err != nil {
+		t.Fatalf("Expected no error refreshing the stale negative entry, got: %v", err)
+	}
+
+	cachedMsg, found, isNegative, _, stale, _ := shardedCache.Get(cache.CacheKey{Qname: qname, Qtype: qtype, Qclass: dns.ClassINET})
+	if !found || stale {
+		t.Fatal("Expected the refresh to replace the stale negative entry with a fresh positive one")
+	}
+	if isNegative {
+		t.Fatal("Expected the positive refresh result to evict the old negative entry rather than coexist with it")
+	}
+	if a, ok := cachedMsg.Answer[0].(*dns.A); !ok || a.A.String() != "5.6.7.8" {
+		t.Fatalf("Expected the cache to hold the refreshed positive answer, got %v", cachedMsg.Answer)
+	}
+}
+
+func TestCachingResolverDisableSuccessSuppressesCachingForMatchingZone(t *testing.T) {
+	qname := "host.sub.example.org."
+	qtype := dns.TypeA
+	cacheConfig := cache.CacheConfig{MaxEntries: 10, MinTTLSecs: 1, DisableSuccess: []string{"sub.example.org."}}
+	shardedCache := cache.NewShardedCache(1, 1*time.Minute, cacheConfig)
+
+	mockResp := new(dns.Msg)
+	mockResp.SetQuestion(qname, qtype)
+	rr, _ := dns.NewRR(qname + " 60 IN A 1.2.3.4")
+	mockResp.Answer = append(mockResp.Answer, rr)
+
+	baseResolver := &mockResolver{
+		exchangeFunc: func(ctx context.Context, msg *dns.Msg) *resolver.Result {
+			return &resolver.Result{Msg: mockResp}
+		},
+	}
+	cachingResolver := server.NewCachingResolver(shardedCache, baseResolver, nil)
+
+	req := new(dns.Msg)
+	req.SetQuestion(qname, qtype)
+
+	if _, err := cachingResolver.Exchange(context.Background(), req); err != nil {
+		t.Fatalf("Expected no error from exchange, got %v", err)
+	}
+
+	if _, found, _, _, _, _ := shardedCache.Get(cache.CacheKey{Qname: qname, Qtype: qtype, Qclass: dns.ClassINET}); found {
+		t.Error("Expected a name under a DisableSuccess zone not to be cached")
+	}
+}
+
+func TestCachingResolverDisableSuccessLeavesUnrelatedZonesCached(t *testing.T) {
+	qname := "example.net."
+	qtype := dns.TypeA
+	cacheConfig := cache.CacheConfig{MaxEntries: 10, MinTTLSecs: 1, DisableSuccess: []string{"sub.example.org."}}
+	shardedCache := cache.NewShardedCache(1, 1*time.Minute, cacheConfig)
+
+	mockResp := new(dns.Msg)
+	mockResp.SetQuestion(qname, qtype)
+	rr, _ := dns.NewRR(qname + " 60 IN A 1.2.3.4")
+	mockResp.Answer = append(mockResp.Answer, rr)
+
+	baseResolver := &mockResolver{
+		exchangeFunc: func(ctx context.Context, msg *dns.Msg) *resolver.Result {
+			return &resolver.Result{Msg: mockResp}
+		},
+	}
+	cachingResolver := server.NewCachingResolver(shardedCache, baseResolver, nil)
+
+	req := new(dns.Msg)
+	req.SetQuestion(qname, qtype)
+
+	if _, err := cachingResolver.Exchange(context.Background(), req); err != nil {
+		t.Fatalf("Expected no error from exchange, got %v", err)
+	}
+
+	if _, found, _, _, _, _ := shardedCache.Get(cache.CacheKey{Qname: qname, Qtype: qtype, Qclass: dns.ClassINET}); !found {
+		t.Error("Expected a name outside any DisableSuccess zone to still be cached")
+	}
+}
+
+func TestCachingResolverDisableDenialSuppressesNegativeCachingForMatchingZone(t *testing.T) {
+	qname := "bogus.example.org."
+	qtype := dns.TypeA
+	cacheConfig := cache.CacheConfig{
+		MaxEntries:           10,
+		NegativeCacheEnabled: true,
+		DisableDenial:        []string{"example.org."},
+	}
+	shardedCache := cache.NewShardedCache(1, 1*time.Minute, cacheConfig)
+
+	negMsg := new(dns.Msg)
+	negMsg.SetQuestion(qname, qtype)
+	negMsg.Rcode = dns.RcodeNameError
+	soa, _ := dns.NewRR("example.org. 3600 IN SOA ns.example.org. hostmaster.example.org. 1 7200 3600 1209600 3600")
+	negMsg.Ns = append(negMsg.Ns, soa)
+
+	baseResolver := &mockResolver{
+		exchangeFunc: func(ctx context.Context, msg *dns.Msg) *resolver.Result {
+			return &resolver.Result{Msg: negMsg}
+		},
+	}
+	cachingResolver := server.NewCachingResolver(shardedCache, baseResolver, nil)
+
+	req := new(dns.Msg)
+	req.SetQuestion(qname, qtype)
+
+	if _, err := cachingResolver.Exchange(context.Background(), req); err != nil {
+		t.Fatalf("Expected no error from exchange, got %v", err)
+	}
+
+	if _, found, _, _, _, _ := shardedCache.Get(cache.CacheKey{Qname: qname, Qtype: qtype, Qclass: dns.ClassINET}); found {
+		t.Error("Expected a DNSSEC-bogus denial under a DisableDenial zone not to be cached")
+	}
+}
+
+func TestCachingResolverDisableSuccessEmptyListDisablesGlobally(t *testing.T) {
+	qname := "anything.example.net."
+	qtype := dns.TypeA
+	cacheConfig := cache.CacheConfig{MaxEntries: 10, MinTTLSecs: 1, DisableSuccess: []string{}}
+	shardedCache := cache.NewShardedCache(1, 1*time.Minute, cacheConfig)
+
+	mockResp := new(dns.Msg)
+	mockResp.SetQuestion(qname, qtype)
+	rr, _ := dns.NewRR(qname + " 60 IN A 1.2.3.4")
+	mockResp.Answer = append(mockResp.Answer, rr)
+
+	baseResolver := &mockResolver{
+		exchangeFunc: func(ctx context.Context, msg *dns.Msg) *resolver.Result {
+			return &resolver.Result{Msg: mockResp}
+		},
+	}
+	cachingResolver := server.NewCachingResolver(shardedCache, baseResolver, nil)
+
+	req := new(dns.Msg)
+	req.SetQuestion(qname, qtype)
+
+	if _, err := cachingResolver.Exchange(context.Background(), req); err != nil {
+		t.Fatalf("Expected no error from exchange, got %v", err)
+	}
+
+	if _, found, _, _, _, _ := shardedCache.Get(cache.CacheKey{Qname: qname, Qtype: qtype, Qclass: dns.ClassINET}); found {
+		t.Error("Expected an empty, but configured, DisableSuccess list to disable success caching globally")
+	}
+}
+
+func TestCachingResolverDoesNotCacheTruncatedResponse(t *testing.T) {
+	qname := "example.com."
+	qtype := dns.TypeA
+	cacheConfig := cache.CacheConfig{MaxEntries: 10, MinTTLSecs: 1}
+	shardedCache := cache.NewShardedCache(1, 1*time.Minute, cacheConfig)
+
+	mockResp := new(dns.Msg)
+	mockResp.SetQuestion(qname, qtype)
+	mockResp.Truncated = true
+	rr, _ := dns.NewRR(qname + " 60 IN A 1.2.3.4")
+	mockResp.Answer = append(mockResp.Answer, rr)
+
+	baseResolver := &mockResolver{
+		exchangeFunc: func(ctx context.Context, msg *dns.Msg) *resolver.Result {
+			return &resolver.Result{Msg: mockResp}
+		},
+	}
+	cachingResolver := server.NewCachingResolver(shardedCache, baseResolver, nil)
+
+	req := new(dns.Msg)
+	req.SetQuestion(qname, qtype)
+
+	if _, err := cachingResolver.Exchange(context.Background(), req); err != nil {
+		t.Fatalf("Expected no error from exchange, got %v", err)
+	}
+
+	if _, found, _, _, _, _ := shardedCache.Get(cache.CacheKey{Qname: qname, Qtype: qtype, Qclass: dns.ClassINET}); found {
+		t.Error("Expected a truncated response not to be cached")
+	}
+}
+
+func TestCachingResolverDoesNotCacheNonQueryOpcodeResponse(t *testing.T) {
+	qname := "example.com."
+	qtype := dns.TypeA
+	cacheConfig := cache.CacheConfig{MaxEntries: 10, MinTTLSecs: 1}
+	shardedCache := cache.NewShardedCache(1, 1*time.Minute, cacheConfig)
+
+	mockResp := new(dns.Msg)
+	mockResp.SetQuestion(qname, qtype)
+	mockResp.Opcode = dns.OpcodeUpdate
+	rr, _ := dns.NewRR(qname + " 60 IN A 1.2.3.4")
+	mockResp.Answer = append(mockResp.Answer, rr)
+
+	baseResolver := &mockResolver{
+		exchangeFunc: func(ctx context.Context, msg *dns.Msg) *resolver.Result {
+			return &resolver.Result{Msg: mockResp}
+		},
+	}
+	cachingResolver := server.NewCachingResolver(shardedCache, baseResolver, nil)
+
+	req := new(dns.Msg)
+	req.SetQuestion(qname, qtype)
+
+	if _, err := cachingResolver.Exchange(context.Background(), req); err != nil {
+		t.Fatalf("Expected no error from exchange, got %v", err)
+	}
+
+	if _, found, _, _, _, _ := shardedCache.Get(cache.CacheKey{Qname: qname, Qtype: qtype, Qclass: dns.ClassINET}); found {
+		t.Error("Expected a dynamic-update (non-query opcode) response not to be cached")
+	}
+}
+
+func TestCachingResolverDoesNotCacheResponseWithMismatchedQuestion(t *testing.T) {
+	qname := "example.com."
+	qtype := dns.TypeA
+	cacheConfig := cache.CacheConfig{MaxEntries: 10, MinTTLSecs: 1}
+	shardedCache := cache.NewShardedCache(1, 1*time.Minute, cacheConfig)
+
+	mockResp := new(dns.Msg)
+	mockResp.SetQuestion("not-what-was-asked.example.", qtype)
+	rr, _ := dns.NewRR("not-what-was-asked.example. 60 IN A 1.2.3.4")
+	mockResp.Answer = append(mockResp.Answer, rr)
+
+	baseResolver := &mockResolver{
+		exchangeFunc: func(ctx context.Context, msg *dns.Msg) *resolver.Result {
+			return &resolver.Result{Msg: mockResp}
+		},
+	}
+	cachingResolver := server.NewCachingResolver(shardedCache, baseResolver, nil)
+
+	req := new(dns.Msg)
+	req.SetQuestion(qname, qtype)
+
+	if _, err := cachingResolver.Exchange(context.Background(), req); err != nil {
+		t.Fatalf("Expected no error from exchange, got %v", err)
+	}
+
+	if _, found, _, _, _, _ := shardedCache.Get(cache.CacheKey{Qname: qname, Qtype: qtype, Qclass: dns.ClassINET}); found {
+		t.Error("Expected a response whose question doesn't match what was asked not to be cached")
+	}
+}
+
+func TestCachingResolverDoesNotCacheResponseWithExtraQuestions(t *testing.T) {
+	qname := "example.com."
+	qtype := dns.TypeA
+	cacheConfig := cache.CacheConfig{MaxEntries: 10, MinTTLSecs: 1}
+	shardedCache := cache.NewShardedCache(1, 1*time.Minute, cacheConfig)
+
+	mockResp := new(dns.Msg)
+	mockResp.SetQuestion(qname, qtype)
+	mockResp.Question = append(mockResp.Question, dns.Question{Name: "other.example.", Qtype: dns.TypeA, Qclass: dns.ClassINET})
+	rr, _ := dns.NewRR(qname + " 60 IN A 1.2.3.4")
+	mockResp.Answer = append(mockResp.Answer, rr)
+
+	baseResolver := &mockResolver{
+		exchangeFunc: func(ctx context.Context, msg *dns.Msg) *resolver.Result {
+			return &resolver.Result{Msg: mockResp}
+		},
+	}
+	cachingResolver := server.NewCachingResolver(shardedCache, baseResolver, nil)
+
+	req := new(dns.Msg)
+	req.SetQuestion(qname, qtype)
+
+	if _, err := cachingResolver.Exchange(context.Background(), req); err != nil {
+		t.Fatalf("Expected no error from exchange, got %v", err)
+	}
+
+	if _, found, _, _, _, _ := shardedCache.Get(cache.CacheKey{Qname: qname, Qtype: qtype, Qclass: dns.ClassINET}); found {
+		t.Error("Expected a response carrying more than one question not to be cached")
+	}
+}
+
+func TestCachingResolverSynthesizesCNAMEChainFromCacheWithoutUpstream(t *testing.T) {
+	cacheConfig := cache.CacheConfig{MaxEntries: 10, MinTTLSecs: 1}
+	shardedCache := cache.NewShardedCache(1, 1*time.Minute, cacheConfig)
+
+	// Seed the CNAME and its target under their own questions, as each would
+	// have been cached from its own prior resolution - never together under
+	// a single message for "www.example.com.".
+	cnameMsg := new(dns.Msg)
+	cnameMsg.SetQuestion("www.example.com.", dns.TypeA)
+	cnameRR, _ := dns.NewRR("www.example.com. 60 IN CNAME foo.example.net.")
+	cnameMsg.Answer = append(cnameMsg.Answer, cnameRR)
+	shardedCache.Set(cache.CacheKey{Qname: "www.example.com.", Qtype: dns.TypeA, Qclass: dns.ClassINET}, cnameMsg, 60*time.Second, false, true)
+
+	aMsg := new(dns.Msg)
+	aMsg.SetQuestion("foo.example.net.", dns.TypeA)
+	aRR, _ := dns.NewRR("foo.example.net. 60 IN A 1.2.3.4")
+	aMsg.Answer = append(aMsg.Answer, aRR)
+	shardedCache.Set(cache.CacheKey{Qname: "foo.example.net.", Qtype: dns.TypeA, Qclass: dns.ClassINET}, aMsg, 60*time.Second, false, true)
+
+	baseResolver := &mockResolver{
+		exchangeFunc: func(ctx context.Context, msg *dns.Msg) *resolver.Result {
+			t.Fatal("Expected resolver.Exchange not to be called when the chain can be synthesized from cache")
+			return nil
+		},
+	}
+	cachingResolver := server.NewCachingResolver(shardedCache, baseResolver, nil)
+
+	req := new(dns.Msg)
+	req.SetQuestion("www.example.com.", dns.TypeA)
+
+	resp, err := cachingResolver.Exchange(context.Background(), req)
+	if err != nil {
+		t.Fatalf("Expected no error synthesizing the CNAME chain, got: %v", err)
+	}
+	if len(resp.Answer) != 2 {
+		t.Fatalf("Expected the CNAME plus its target's A record, got %d answers", len(resp.Answer))
+	}
+}
+
+func TestCachingResolverFallsBackToUpstreamOnDanglingCNAME(t *testing.T) {
+	cacheConfig := cache.CacheConfig{MaxEntries: 10, MinTTLSecs: 1}
+	shardedCache := cache.NewShardedCache(1, 1*time.Minute, cacheConfig)
+
+	cnameMsg := new(dns.Msg)
+	cnameMsg.SetQuestion("www.example.com.", dns.TypeA)
+	cnameRR, _ := dns.NewRR("www.example.com. 60 IN CNAME foo.example.net.")
+	cnameMsg.Answer = append(cnameMsg.Answer, cnameRR)
+	shardedCache.Set(cache.CacheKey{Qname: "www.example.com.", Qtype: dns.TypeA, Qclass: dns.ClassINET}, cnameMsg, 60*time.Second, false, true)
+	// foo.example.net's own A record was never cached, leaving the CNAME
+	// dangling.
+
+	mockResp := new(dns.Msg)
+	mockResp.SetQuestion("www.example.com.", dns.TypeA)
+	rr, _ := dns.NewRR("www.example.com. 60 IN CNAME foo.example.net.")
+	rr2, _ := dns.NewRR("foo.example.net. 60 IN A 5.6.7.8")
+	mockResp.Answer = append(mockResp.Answer, rr, rr2)
+
+	called := false
+	baseResolver := &mockResolver{
+		exchangeFunc: func(ctx context.Context, msg *dns.Msg) *resolver.Result {
+			called = true
+			return &resolver.Result{Msg: mockResp}
+		},
+	}
+	cachingResolver := server.NewCachingResolver(shardedCache, baseResolver, nil)
+
+	req := new(dns.Msg)
+	req.SetQuestion("www.example.com.", dns.TypeA)
+
+	resp, err := cachingResolver.Exchange(context.Background(), req)
+	if err != nil {
+		t.Fatalf("Expected no error from exchange, got %v", err)
+	}
+	if !called {
+		t.Error("Expected a dangling CNAME to fall back to the upstream resolver rather than return a partial chain")
+	}
+	if len(resp.Answer) != 2 {
+		t.Fatalf("Expected the fresh upstream answer with 2 records, got %d", len(resp.Answer))
+	}
+}
+
+func TestCachingResolverEvictsEntryPastMaxStaleTTL(t *testing.T) {
+	qname := "example.com."
+	qtype := dns.TypeA
+	cacheConfig := cache.CacheConfig{MaxEntries: 10, MaxStaleTTLSecs: 1}
+	shardedCache := cache.NewShardedCache(1, 1*time.Minute, cacheConfig)
+
+	msg := new(dns.Msg)
+	msg.SetQuestion(qname, qtype)
+	rr, _ := dns.NewRR(qname + " 60 IN A 1.2.3.4")
+	msg.Answer = append(msg.Answer, rr)
+
+	// Expired well past the 1s stale window.
+	shardedCache.Set(cache.CacheKey{Qname: qname, Qtype: qtype, Qclass: dns.ClassINET}, msg, -10*time.Second, false, true)
+
+	_, found, _, _, stale, _ := shardedCache.Get(cache.CacheKey{Qname: qname, Qtype: qtype, Qclass: dns.ClassINET})
+	if found || stale {
+		t.Fatal("Expected an entry past its MaxStaleTTL window to be a miss, not a stale hit")
+	}
+}
+
+func TestCachingResolverPrefetchesHotEntryNearExpiry(t *testing.T) {
+	qname := "hot.example.com."
+	qtype := dns.TypeA
+	cacheConfig := cache.CacheConfig{
+		MaxEntries:           10,
+		MinTTLSecs:           1,
+		PrefetchingEnabled:   true,
+		PrefetchMinHits:      1,
+		PrefetchThresholdPct: 0.9,
+		PrefetchWorkers:      1,
+	}
+	shardedCache := cache.NewShardedCache(1, 1*time.Minute, cacheConfig)
+
+	key := cache.CacheKey{Qname: qname, Qtype: qtype, Qclass: dns.ClassINET}
+	msg := new(dns.Msg)
+	msg.SetQuestion(qname, qtype)
+	rr, _ := dns.NewRR(qname + " 60 IN A 1.2.3.4")
+	msg.Answer = append(msg.Answer, rr)
+	shardedCache.Set(key, msg, 50*time.Millisecond, false, true)
+
+	refreshed := new(dns.Msg)
+	refreshed.SetQuestion(qname, qtype)
+	refreshedRR, _ := dns.NewRR(qname + " 120 IN A 5.6.7.8")
+	refreshed.Answer = append(refreshed.Answer, refreshedRR)
+
+	var exchanges int32
+	baseResolver := &mockResolver{
+		exchangeFunc: func(ctx context.Context, msg *dns.Msg) *resolver.Result {
+			atomic.AddInt32(&exchanges, 1)
+			return &resolver.Result{Msg: refreshed}
+		},
+	}
+	m := metrics.NewMetrics(config.NewConfig())
+	server.NewCachingResolver(shardedCache, baseResolver, m)
+
+	// Let enough of the TTL elapse that the remaining fraction drops below
+	// PrefetchThresholdPct, then hit it once to cross PrefetchMinHits.
+	time.Sleep(10 * time.Millisecond)
+	shardedCache.Get(key)
+
+	deadline := time.After(1 * time.Second)
+	refreshedSeen := false
+	for !refreshedSeen {
+		if cachedMsg, found, _, _, _, _ := shardedCache.Get(key); found {
+			if a, ok := cachedMsg.Answer[0].(*dns.A); ok && a.A.String() == "5.6.7.8" {
+				refreshedSeen = true
+				break
+			}
+		}
+		select {
+		case <-deadline:
+			t.Fatal("expected the hot entry to be refreshed by a background prefetch")
+		case <-time.After(5 * time.Millisecond):
+		}
+	}
+
+	if got := atomic.LoadInt32(&exchanges); got != 1 {
+		t.Errorf("expected exactly 1 upstream exchange for the prefetch, got %d", got)
+	}
+
+	started, success, _ := m.CachePrefetchStats()
+	if started == 0 || success == 0 {
+		t.Errorf("expected non-zero prefetch started/success counts, got started=%d success=%d", started, success)
+	}
+}
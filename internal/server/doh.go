@@ -0,0 +1,328 @@
+package server
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"os"
+
+	"github.com/miekg/dns"
+	"golang.org/x/crypto/acme"
+	"golang.org/x/crypto/acme/autocert"
+	"golang.org/x/net/http2"
+)
+
+const (
+	dohPath           = "/dns-query"
+	dohMediaType      = "application/dns-message"
+	dohMaxMessageSize = 65535
+	// dohPaddingBlock is the block size RFC 8467 responses are padded to
+	// when the client requested padding.
+	dohPaddingBlock = 128
+)
+
+// dohAddr is a minimal net.Addr, since an *http.Request only exposes its
+// peer as a string rather than a structured address.
+type dohAddr struct {
+	network string
+	addr    string
+}
+
+func (a dohAddr) Network() string { return a.network }
+func (a dohAddr) String() string  { return a.addr }
+
+// dohResponseWriter adapts an HTTP request to a dns.ResponseWriter so a DoH
+// query can be run through the exact same dns.Handler - and, through it, the
+// same plugins.PluginContext pipeline - as the UDP/TCP listeners.
+type dohResponseWriter struct {
+	remoteAddr net.Addr
+	localAddr  net.Addr
+	msg        *dns.Msg
+}
+
+func (w *dohResponseWriter) LocalAddr() net.Addr  { return w.localAddr }
+func (w *dohResponseWriter) RemoteAddr() net.Addr { return w.remoteAddr }
+
+func (w *dohResponseWriter) WriteMsg(m *dns.Msg) error {
+	w.msg = m
+	return nil
+}
+
+func (w *dohResponseWriter) Write(b []byte) (int, error) {
+	m := new(dns.Msg)
+	if err := m.Unpack(b); err != nil {
+		return 0, err
+	}
+	w.msg = m
+	return len(b), nil
+}
+
+func (w *dohResponseWriter) Close() error        { return nil }
+func (w *dohResponseWriter) TsigStatus() error   { return nil }
+func (w *dohResponseWriter) TsigTimersOnly(bool) {}
+func (w *dohResponseWriter) Hijack()             {}
+
+// DoHHandler returns the http.Handler serving RFC 8484 DNS-over-HTTPS
+// queries, for wiring into a custom mux or for tests that want to drive it
+// directly with httptest.
+func (s *Server) DoHHandler() http.Handler {
+	return s.dohHandler()
+}
+
+// dohHandler returns the http.Handler for RFC 8484 DNS-over-HTTPS queries at
+// /dns-query. It decodes the wire-format message from the GET "dns" query
+// parameter or a POST body, runs it through the same dns.Handler used by the
+// UDP/TCP listeners, and writes the packed response back with the
+// content-type and caching headers RFC 8484 expects.
+func (s *Server) dohHandler() http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		req, err := readDoHRequest(r)
+		if err != nil {
+			http.Error(rw, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		w := &dohResponseWriter{
+			remoteAddr: dohAddr{network: "tcp", addr: r.RemoteAddr},
+			localAddr:  dohAddr{network: "tcp", addr: r.Host},
+		}
+		s.handler.ServeDNS(w, req)
+
+		if w.msg == nil {
+			http.Error(rw, "no response produced", http.StatusInternalServerError)
+			return
+		}
+
+		addPaddingIfRequested(req, w.msg)
+
+		packed, err := w.msg.Pack()
+		if err != nil {
+			http.Error(rw, "failed to pack response", http.StatusInternalServerError)
+			return
+		}
+
+		rw.Header().Set("Content-Type", dohMediaType)
+		rw.Header().Set("Cache-Control", fmt.Sprintf("max-age=%d", minAnswerTTL(w.msg)))
+		rw.WriteHeader(http.StatusOK)
+		if _, err := rw.Write(packed); err != nil {
+			log.Printf("DoH: failed to write response: %v", err)
+		}
+	})
+}
+
+// readDoHRequest decodes the wire-format dns.Msg from a DoH GET or POST
+// request per RFC 8484.
+func readDoHRequest(r *http.Request) (*dns.Msg, error) {
+	var wire []byte
+
+	switch r.Method {
+	case http.MethodGet:
+		b64 := r.URL.Query().Get("dns")
+		if b64 == "" {
+			return nil, fmt.Errorf("missing dns query parameter")
+		}
+		decoded, err := base64.RawURLEncoding.DecodeString(b64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid base64url dns parameter: %w", err)
+		}
+		wire = decoded
+	case http.MethodPost:
+		if ct := r.Header.Get("Content-Type"); ct != dohMediaType {
+			return nil, fmt.Errorf("unsupported content-type %q", ct)
+		}
+		body, err := io.ReadAll(io.LimitReader(r.Body, dohMaxMessageSize))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read request body: %w", err)
+		}
+		wire = body
+	default:
+		return nil, fmt.Errorf("unsupported method %q", r.Method)
+	}
+
+	msg := new(dns.Msg)
+	if err := msg.Unpack(wire); err != nil {
+		return nil, fmt.Errorf("failed to unpack dns message: %w", err)
+	}
+	if len(msg.Question) == 0 {
+		return nil, fmt.Errorf("dns message has no question")
+	}
+	return msg, nil
+}
+
+// minAnswerTTL returns the smallest TTL across msg's answer section, used
+// for the RFC 8484 Cache-Control max-age header. It returns 0 when there are
+// no answers, so negative responses aren't cached by HTTP caches.
+func minAnswerTTL(msg *dns.Msg) uint32 {
+	if len(msg.Answer) == 0 {
+		return 0
+	}
+	min := msg.Answer[0].Header().Ttl
+	for _, rr := range msg.Answer[1:] {
+		if ttl := rr.Header().Ttl; ttl < min {
+			min = ttl
+		}
+	}
+	return min
+}
+
+// addPaddingIfRequested honors RFC 8467: if the request's OPT record carries
+// a padding option, the response is padded so its packed length is a
+// multiple of dohPaddingBlock bytes.
+func addPaddingIfRequested(req, resp *dns.Msg) {
+	reqOpt := req.IsEdns0()
+	if reqOpt == nil {
+		return
+	}
+	var requested bool
+	for _, o := range reqOpt.Option {
+		if o.Option() == dns.EDNS0PADDING {
+			requested = true
+			break
+		}
+	}
+	if !requested {
+		return
+	}
+
+	respOpt := resp.IsEdns0()
+	if respOpt == nil {
+		resp.SetEdns0(dns.DefaultMsgSize, reqOpt.Do())
+		respOpt = resp.IsEdns0()
+	}
+
+	unpadded, err := resp.Pack()
+	if err != nil {
+		return
+	}
+	padLen := dohPaddingBlock - (len(unpadded) % dohPaddingBlock)
+	if padLen == dohPaddingBlock {
+		padLen = 0
+	}
+	respOpt.Option = append(respOpt.Option, &dns.EDNS0_PADDING{Padding: make([]byte, padLen)})
+}
+
+// startDoH starts the DNS-over-HTTPS listener configured via cfg.DoHAddr. It
+// always serves HTTP/1.1 and HTTP/2 over TLS; an HTTP/3 listener is started
+// alongside it when cfg.DoH3Enabled is set and the binary was built with
+// -tags=http3.
+func (s *Server) startDoH() {
+	if s.config.DoHAddr == "" {
+		return
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle(s.dohMountPath(), s.dohHandler())
+
+	tlsConfig, err := s.dohTLSConfig()
+	if err != nil {
+		log.Printf("DoH: failed to build TLS config: %v", err)
+		return
+	}
+	if err := s.loadServerCertificate(tlsConfig); err != nil {
+		log.Printf("DoH: failed to load certificate: %v", err)
+		return
+	}
+
+	httpServer := &http.Server{
+		Addr:      s.config.DoHAddr,
+		Handler:   mux,
+		TLSConfig: tlsConfig,
+	}
+	if err := http2.ConfigureServer(httpServer, &http2.Server{}); err != nil {
+		log.Printf("DoH: failed to configure HTTP/2: %v", err)
+	}
+
+	s.mu.Lock()
+	s.httpServer = httpServer
+	s.mu.Unlock()
+
+	go func() {
+		log.Printf("Starting DoH listener on %s", s.config.DoHAddr)
+		// Cert/key filenames are left empty: loadServerCertificate has
+		// already populated tlsConfig.Certificates or GetCertificate, either
+		// from the static file pair or from autocert.
+		if err := httpServer.ListenAndServeTLS("", ""); err != nil && err != http.ErrServerClosed {
+			log.Printf("DoH listener stopped: %v", err)
+		}
+	}()
+
+	startHTTP3(s.config.DoH3Enabled, s.config.DoHAddr, s.config.DoHCertFile, s.config.DoHKeyFile, mux, tlsConfig)
+}
+
+// dohMountPath returns the URL path the DoH handler is mounted at, honoring
+// cfg.DoHPath when set and falling back to the RFC 8484 conventional path.
+func (s *Server) dohMountPath() string {
+	if s.config.DoHPath != "" {
+		return s.config.DoHPath
+	}
+	return dohPath
+}
+
+// loadServerCertificate populates tlsConfig's certificate source for the DoH
+// and DoT listeners: either a static certificate/key pair, or an ACME-issued
+// certificate managed and renewed in the background by autocertMgr.
+func (s *Server) loadServerCertificate(tlsConfig *tls.Config) error {
+	if s.config.DoHAutocertEnabled {
+		mgr, err := s.autocertMgr()
+		if err != nil {
+			return err
+		}
+		tlsConfig.GetCertificate = mgr.GetCertificate
+		tlsConfig.NextProtos = append(tlsConfig.NextProtos, acme.ALPNProto)
+		return nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(s.config.DoHCertFile, s.config.DoHKeyFile)
+	if err != nil {
+		return fmt.Errorf("failed to load certificate pair: %w", err)
+	}
+	tlsConfig.Certificates = []tls.Certificate{cert}
+	return nil
+}
+
+// autocertMgr lazily builds the *autocert.Manager shared by the DoH and DoT
+// listeners, so a machine serving both never registers the same hostname
+// with the ACME provider twice.
+func (s *Server) autocertMgr() (*autocert.Manager, error) {
+	if len(s.config.DoHAutocertDomains) == 0 {
+		return nil, fmt.Errorf("DoHAutocertEnabled requires at least one DoHAutocertDomains entry")
+	}
+
+	s.autocertOnce.Do(func() {
+		mgr := &autocert.Manager{
+			Prompt:     autocert.AcceptTOS,
+			HostPolicy: autocert.HostWhitelist(s.config.DoHAutocertDomains...),
+		}
+		if s.config.DoHAutocertCacheDir != "" {
+			mgr.Cache = autocert.DirCache(s.config.DoHAutocertCacheDir)
+		}
+		s.autocertManager = mgr
+	})
+	return s.autocertManager, nil
+}
+
+// dohTLSConfig builds the TLS configuration for the DoH listener, enabling
+// mutual TLS when a client CA bundle is configured.
+func (s *Server) dohTLSConfig() (*tls.Config, error) {
+	cfg := &tls.Config{MinVersion: tls.VersionTLS12}
+
+	if s.config.DoHClientCAFile != "" {
+		caCert, err := os.ReadFile(s.config.DoHClientCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read client CA file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(caCert) {
+			return nil, fmt.Errorf("failed to parse client CA file %s", s.config.DoHClientCAFile)
+		}
+		cfg.ClientCAs = pool
+		cfg.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+
+	return cfg, nil
+}
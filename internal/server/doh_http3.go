@@ -0,0 +1,32 @@
+//go:build http3
+
+package server
+
+import (
+	"crypto/tls"
+	"log"
+	"net/http"
+
+	"github.com/quic-go/quic-go/http3"
+)
+
+// startHTTP3 starts an HTTP/3 (QUIC) listener for DoH alongside the
+// HTTP/1.1+2 listener, enabled when built with -tags=http3.
+func startHTTP3(enabled bool, addr, certFile, keyFile string, handler http.Handler, tlsConfig *tls.Config) {
+	if !enabled {
+		return
+	}
+
+	h3Server := &http3.Server{
+		Addr:      addr,
+		Handler:   handler,
+		TLSConfig: tlsConfig.Clone(),
+	}
+
+	go func() {
+		log.Printf("Starting DoH/3 listener on %s", addr)
+		if err := h3Server.ListenAndServeTLS(certFile, keyFile); err != nil {
+			log.Printf("DoH/3 listener stopped: %v", err)
+		}
+	}()
+}
@@ -0,0 +1,12 @@
+//go:build !http3
+
+package server
+
+import (
+	"crypto/tls"
+	"net/http"
+)
+
+// startHTTP3 is a no-op stub; build with -tags=http3 to enable the real
+// quic-go-backed HTTP/3 listener.
+func startHTTP3(_ bool, _, _, _ string, _ http.Handler, _ *tls.Config) {}
@@ -0,0 +1,174 @@
+package server_test
+
+import (
+	"bytes"
+	"context"
+	"dns-resolver/internal/config"
+	"dns-resolver/internal/metrics"
+	"dns-resolver/internal/plugins"
+	"dns-resolver/internal/server"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/miekg/dns"
+	"golang.org/x/sync/singleflight"
+)
+
+// dohFakeResolver is a minimal resolver.ResolverInterface used to drive the
+// DoH handler in tests without a real upstream.
+type dohFakeResolver struct {
+	cfg     *config.Config
+	sf      singleflight.Group
+	resolve func(ctx context.Context, req *dns.Msg) (*dns.Msg, error)
+}
+
+func (r *dohFakeResolver) Resolve(ctx context.Context, req *dns.Msg) (*dns.Msg, error) {
+	return r.resolve(ctx, req)
+}
+func (r *dohFakeResolver) LookupWithoutCache(ctx context.Context, req *dns.Msg) (*dns.Msg, error) {
+	return r.resolve(ctx, req)
+}
+func (r *dohFakeResolver) GetSingleflightGroup() *singleflight.Group { return &r.sf }
+func (r *dohFakeResolver) GetConfig() *config.Config                 { return r.cfg }
+func (r *dohFakeResolver) Close()                                    {}
+
+func newDoHTestServer(t *testing.T, resolve func(ctx context.Context, req *dns.Msg) (*dns.Msg, error)) *server.Server {
+	t.Helper()
+	cfg := config.NewConfig()
+	res := &dohFakeResolver{cfg: cfg, resolve: resolve}
+	return server.NewServer(cfg, metrics.NewMetrics(cfg), res, plugins.NewPluginManager())
+}
+
+func TestDoHHandler_GET(t *testing.T) {
+	srv := newDoHTestServer(t, func(ctx context.Context, req *dns.Msg) (*dns.Msg, error) {
+		resp := new(dns.Msg)
+		resp.SetReply(req)
+		rr, _ := dns.NewRR("example.com. 60 IN A 1.2.3.4")
+		resp.Answer = []dns.RR{rr}
+		return resp, nil
+	})
+
+	q := new(dns.Msg)
+	q.SetQuestion("example.com.", dns.TypeA)
+	q.Id = 0
+	wire, err := q.Pack()
+	if err != nil {
+		t.Fatalf("failed to pack query: %v", err)
+	}
+	encoded := base64.RawURLEncoding.EncodeToString(wire)
+
+	req := httptest.NewRequest(http.MethodGet, "/dns-query?dns="+encoded, nil)
+	rw := httptest.NewRecorder()
+
+	srv.DoHHandler().ServeHTTP(rw, req)
+
+	if rw.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rw.Code, rw.Body.String())
+	}
+	if ct := rw.Header().Get("Content-Type"); ct != "application/dns-message" {
+		t.Errorf("expected application/dns-message content-type, got %q", ct)
+	}
+	if cc := rw.Header().Get("Cache-Control"); cc != "max-age=60" {
+		t.Errorf("expected Cache-Control max-age=60, got %q", cc)
+	}
+
+	resp := new(dns.Msg)
+	if err := resp.Unpack(rw.Body.Bytes()); err != nil {
+		t.Fatalf("failed to unpack response: %v", err)
+	}
+	if len(resp.Answer) != 1 || resp.Answer[0].String() != "example.com.\t60\tIN\tA\t1.2.3.4" {
+		t.Errorf("unexpected answer: %+v", resp.Answer)
+	}
+}
+
+func TestDoHHandler_POST(t *testing.T) {
+	srv := newDoHTestServer(t, func(ctx context.Context, req *dns.Msg) (*dns.Msg, error) {
+		resp := new(dns.Msg)
+		resp.SetReply(req)
+		rr, _ := dns.NewRR("example.org. 120 IN A 5.6.7.8")
+		resp.Answer = []dns.RR{rr}
+		return resp, nil
+	})
+
+	q := new(dns.Msg)
+	q.SetQuestion("example.org.", dns.TypeA)
+	q.Id = 0
+	wire, err := q.Pack()
+	if err != nil {
+		t.Fatalf("failed to pack query: %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/dns-query", bytes.NewReader(wire))
+	req.Header.Set("Content-Type", "application/dns-message")
+	rw := httptest.NewRecorder()
+
+	srv.DoHHandler().ServeHTTP(rw, req)
+
+	if rw.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rw.Code, rw.Body.String())
+	}
+
+	resp := new(dns.Msg)
+	if err := resp.Unpack(rw.Body.Bytes()); err != nil {
+		t.Fatalf("failed to unpack response: %v", err)
+	}
+	if len(resp.Answer) != 1 || resp.Answer[0].Header().Name != "example.org." {
+		t.Errorf("unexpected answer: %+v", resp.Answer)
+	}
+}
+
+func TestDoHHandler_PaddingOption(t *testing.T) {
+	srv := newDoHTestServer(t, func(ctx context.Context, req *dns.Msg) (*dns.Msg, error) {
+		resp := new(dns.Msg)
+		resp.SetReply(req)
+		rr, _ := dns.NewRR("pad.example. 60 IN A 9.9.9.9")
+		resp.Answer = []dns.RR{rr}
+		return resp, nil
+	})
+
+	q := new(dns.Msg)
+	q.SetQuestion("pad.example.", dns.TypeA)
+	q.Id = 0
+	o := new(dns.OPT)
+	o.Hdr.Name = "."
+	o.Hdr.Rrtype = dns.TypeOPT
+	o.Option = append(o.Option, &dns.EDNS0_PADDING{Padding: make([]byte, 8)})
+	q.Extra = append(q.Extra, o)
+	wire, err := q.Pack()
+	if err != nil {
+		t.Fatalf("failed to pack query: %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/dns-query", bytes.NewReader(wire))
+	req.Header.Set("Content-Type", "application/dns-message")
+	rw := httptest.NewRecorder()
+
+	srv.DoHHandler().ServeHTTP(rw, req)
+
+	if rw.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rw.Code, rw.Body.String())
+	}
+	if len(rw.Body.Bytes())%128 != 0 {
+		t.Errorf("expected padded response length to be a multiple of 128, got %d", len(rw.Body.Bytes()))
+	}
+
+	resp := new(dns.Msg)
+	if err := resp.Unpack(rw.Body.Bytes()); err != nil {
+		t.Fatalf("failed to unpack response: %v", err)
+	}
+	respOpt := resp.IsEdns0()
+	if respOpt == nil {
+		t.Fatal("expected an OPT record with padding in the response")
+	}
+	var havePadding bool
+	for _, opt := range respOpt.Option {
+		if opt.Option() == dns.EDNS0PADDING {
+			havePadding = true
+		}
+	}
+	if !havePadding {
+		t.Error("expected an EDNS0 padding option in the response")
+	}
+}
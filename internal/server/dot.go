@@ -0,0 +1,44 @@
+package server
+
+import (
+	"log"
+
+	"github.com/miekg/dns"
+)
+
+// startDoT starts the DNS-over-TLS (RFC 7858) listener configured via
+// cfg.DoTAddr. It runs the same s.handler pipeline as the UDP/TCP listeners,
+// via miekg/dns's built-in "tcp-tls" network, so plugins, metrics, and
+// caching all apply identically. The listener shares its TLS configuration
+// (certificate file pair or autocert) with the DoH listener.
+func (s *Server) startDoT() {
+	if s.config.DoTAddr == "" {
+		return
+	}
+
+	tlsConfig, err := s.dohTLSConfig()
+	if err != nil {
+		log.Printf("DoT: failed to build TLS config: %v", err)
+		return
+	}
+	if err := s.loadServerCertificate(tlsConfig); err != nil {
+		log.Printf("DoT: failed to load certificate: %v", err)
+		return
+	}
+
+	dotServer := &dns.Server{
+		Addr:      s.config.DoTAddr,
+		Net:       "tcp-tls",
+		Handler:   s.handler,
+		TLSConfig: tlsConfig,
+	}
+
+	s.mu.Lock()
+	s.dotServer = dotServer
+	s.mu.Unlock()
+
+	log.Printf("Starting DoT listener on %s", s.config.DoTAddr)
+	if err := dotServer.ListenAndServe(); err != nil {
+		log.Printf("DoT listener stopped: %v", err)
+	}
+}
@@ -3,13 +3,20 @@ package server
 import (
 	"context"
 	"log"
+	"net"
+	"net/http"
 	"sync"
 
 	"dns-resolver/internal/config"
+	"dns-resolver/internal/dnstap"
+	"dns-resolver/internal/ecs"
+	"dns-resolver/internal/interfaces"
 	"dns-resolver/internal/metrics"
 	"dns-resolver/internal/plugins"
+	"dns-resolver/internal/reqlog"
 	"dns-resolver/internal/resolver"
 	"github.com/miekg/dns"
+	"golang.org/x/crypto/acme/autocert"
 )
 
 var msgPool = sync.Pool{
@@ -17,6 +24,7 @@ var msgPool = sync.Pool{
 		return new(dns.Msg)
 	},
 }
+
 // Server holds the server state.
 type Server struct {
 	config        *config.Config
@@ -24,6 +32,19 @@ type Server struct {
 	metrics       *metrics.Metrics
 	resolver      resolver.ResolverInterface
 	pluginManager *plugins.PluginManager
+	dnstap        *dnstap.Logger
+
+	// mu guards the listener handles below, populated once each listener
+	// starts so Shutdown can reach them regardless of which goroutine
+	// finished starting first.
+	mu         sync.Mutex
+	udpServer  *dns.Server
+	tcpServer  *dns.Server
+	dotServer  *dns.Server
+	httpServer *http.Server
+
+	autocertOnce    sync.Once
+	autocertManager *autocert.Manager
 }
 
 // NewServer creates a new server.
@@ -38,6 +59,16 @@ func NewServer(cfg *config.Config, m *metrics.Metrics, res resolver.ResolverInte
 	return s
 }
 
+// SetDnstap wires l so every query handled by this server emits
+// CLIENT_QUERY/CLIENT_RESPONSE dnstap frames. A nil l (dnstap disabled, or
+// left unset in tests) makes the handler's calls into it no-ops. It must be
+// called before the server starts accepting queries; the handler captures l
+// once when it rebuilds itself.
+func (s *Server) SetDnstap(l *dnstap.Logger) {
+	s.dnstap = l
+	s.buildAndSetHandler()
+}
+
 func (s *Server) buildAndSetHandler() {
 	handler := dns.HandlerFunc(func(w dns.ResponseWriter, r *dns.Msg) {
 		if len(r.Question) > 0 {
@@ -61,11 +92,28 @@ func (s *Server) buildAndSetHandler() {
 
 		req.SetQuestion(r.Question[0].Name, r.Question[0].Qtype)
 		req.RecursionDesired = true
-		req.SetEdns0(4096, true)
+		req.CheckingDisabled = r.CheckingDisabled
+
+		// Forward the client's own DO bit rather than forcing DO=1, so
+		// resolver.Resolve's cache lookups (keyed on do/cd, see cache.Key)
+		// never serve a DNSSEC-augmented answer to a client that didn't ask
+		// for one, or vice versa.
+		clientDO := false
+		if opt := r.IsEdns0(); opt != nil {
+			clientDO = opt.Do()
+		}
+		req.SetEdns0(4096, clientDO)
 
 		ctx, cancel := context.WithTimeout(context.Background(), s.config.RequestTimeout)
 		defer cancel()
 
+		clientAddr := hostIP(w.RemoteAddr())
+		if clientAddr != nil {
+			ctx = interfaces.ContextWithClientAddr(ctx, clientAddr)
+		}
+		ctx = reqlog.WithQuery(ctx, r.Id, req.Question[0].Name, clientAddr)
+
+		s.dnstap.LogClientQuery(req, w.RemoteAddr())
 		msg, err := s.resolver.Resolve(ctx, req)
 
 		if key, ok := pluginCtx.Get("coalescer_key"); ok {
@@ -73,7 +121,7 @@ func (s *Server) buildAndSetHandler() {
 		}
 
 		if err != nil {
-			log.Printf("Failed to resolve %s: %v", req.Question[0].Name, err)
+			reqlog.FromCtx(ctx).Error("failed to resolve query", "error", err)
 			s.metrics.RecordResponseCode(dns.RcodeToString[dns.RcodeServerFailure])
 			dns.HandleFailed(w, r)
 			return
@@ -82,27 +130,86 @@ func (s *Server) buildAndSetHandler() {
 		s.metrics.RecordResponseCode(dns.RcodeToString[msg.Rcode])
 		msg.Id = r.Id
 
+		if _, clientSentECS := ecs.FromMsg(r); !clientSentECS {
+			ecs.Strip(msg)
+		}
+
 		if err := w.WriteMsg(msg); err != nil {
-			log.Printf("Failed to write response: %v", err)
+			reqlog.FromCtx(ctx).Error("failed to write response", "error", err)
 		}
+		s.dnstap.LogClientResponse(req, msg, w.RemoteAddr())
+
+		s.pluginManager.ExecutePostPlugins(pluginCtx, r, msg)
 	})
 	s.handler = s.metricsWrapper(handler)
 }
 
-// ListenAndServe starts the DNS server.
-func (s *Server) ListenAndServe() {
+// ListenAndServe starts the DNS server's UDP, TCP, DoH, and (if configured)
+// DoT listeners, and blocks until ctx is canceled. On cancellation it runs a
+// graceful Shutdown bounded by cfg.ShutdownTimeout before returning, so an
+// in-flight query (including one mid-TLS-handshake during a certificate
+// rotation) is given a chance to finish rather than being dropped outright.
+func (s *Server) ListenAndServe(ctx context.Context) {
 	go s.startListener("udp")
 	go s.startListener("tcp")
+	go s.startDoH()
+	go s.startDoT()
 
 	log.Printf("ASTRACAT DNS Resolver is running on %s", s.config.ListenAddr)
-	select {} // Block forever
+	<-ctx.Done()
+
+	log.Println("shutting down listeners...")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), s.config.ShutdownTimeout)
+	defer cancel()
+	if err := s.Shutdown(shutdownCtx); err != nil {
+		log.Printf("error during shutdown: %v", err)
+	}
+}
+
+// Shutdown gracefully stops every listener that has started, waiting for
+// in-flight queries to finish until ctx is done. It's safe to call even if
+// some listeners (e.g. DoT) were never configured/started.
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.mu.Lock()
+	udpServer, tcpServer, dotServer, httpServer := s.udpServer, s.tcpServer, s.dotServer, s.httpServer
+	s.mu.Unlock()
+
+	var firstErr error
+	record := func(err error) {
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	if udpServer != nil {
+		record(udpServer.ShutdownContext(ctx))
+	}
+	if tcpServer != nil {
+		record(tcpServer.ShutdownContext(ctx))
+	}
+	if dotServer != nil {
+		record(dotServer.ShutdownContext(ctx))
+	}
+	if httpServer != nil {
+		record(httpServer.Shutdown(ctx))
+	}
+	return firstErr
 }
 
 func (s *Server) startListener(net string) {
 	server := &dns.Server{Addr: s.config.ListenAddr, Net: net, Handler: s.handler}
+
+	s.mu.Lock()
+	if net == "tcp" {
+		s.tcpServer = server
+	} else {
+		s.udpServer = server
+	}
+	s.mu.Unlock()
+
 	log.Printf("Starting %s listener on %s", net, s.config.ListenAddr)
-	if err := server.ListenAndServe(); err != nil {
-		log.Printf("Failed to start %s listener: %s", net, err)
+	if err := server.ListenAndServe(); err != nil && err != dns.ErrShortWrite {
+		log.Printf("%s listener stopped: %s", net, err)
 	}
 }
 
@@ -113,3 +220,13 @@ func (s *Server) metricsWrapper(h dns.Handler) dns.Handler {
 		h.ServeDNS(w, r)
 	})
 }
+
+// hostIP extracts the bare IP from addr (host:port for udp/tcp listeners),
+// for stashing in the resolve context as the client's ECS source address.
+func hostIP(addr net.Addr) net.IP {
+	host, _, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return nil
+	}
+	return net.ParseIP(host)
+}
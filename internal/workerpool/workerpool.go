@@ -0,0 +1,177 @@
+// Package workerpool provides a single, instrumented worker pool used
+// across the resolver and the main server binary. It replaces two pools
+// that used to drift apart: the resolver packages' semaphore-only
+// WorkerPool (Acquire/Release, no queueing) and main's Job-based
+// WorkerPool (an unbounded blocking Submit). Pool supports both access
+// patterns against the same bounded queue and worker-slot budget, so every
+// caller gets uniform backpressure and the same Prometheus metrics.
+package workerpool
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"dns-resolver/internal/metrics"
+)
+
+// Job is a unit of work that can be submitted to a Pool's queue.
+type Job interface {
+	Execute()
+}
+
+// ErrQueueFull is returned by TrySubmit when the pool's queue has no room
+// for another job without blocking.
+var ErrQueueFull = errors.New("workerpool: queue is full")
+
+// ErrPoolClosed is returned by TrySubmit and SubmitContext once Stop has
+// been called.
+var ErrPoolClosed = errors.New("workerpool: pool is closed")
+
+// Pool runs Jobs on a fixed number of worker goroutines behind a bounded
+// queue. Callers that need to bound concurrency around code they run
+// themselves (instead of handing a Job to the pool) can use Acquire/Release
+// directly; both access patterns share the same "workers" budget and
+// report to the same metrics. name identifies this pool in its metrics
+// (queue_depth, jobs_dropped_total, job_duration_seconds, workers_busy); m
+// may be nil to skip reporting.
+type Pool struct {
+	name    string
+	metrics *metrics.Metrics
+
+	sem   chan struct{}
+	queue chan Job
+	wg    sync.WaitGroup
+
+	mu     sync.RWMutex
+	closed bool
+}
+
+// New creates a Pool with workers worker goroutines draining a queue that
+// holds up to queueDepth pending jobs before TrySubmit/SubmitContext start
+// rejecting or blocking further work. workers is also the number of
+// concurrent Acquire holders allowed at once.
+func New(workers, queueDepth int, name string, m *metrics.Metrics) *Pool {
+	if workers <= 0 {
+		workers = 1
+	}
+	if queueDepth < 0 {
+		queueDepth = 0
+	}
+	p := &Pool{
+		name:    name,
+		metrics: m,
+		sem:     make(chan struct{}, workers),
+		queue:   make(chan Job, queueDepth),
+	}
+	p.wg.Add(workers)
+	for i := 0; i < workers; i++ {
+		go p.worker()
+	}
+	return p
+}
+
+func (p *Pool) worker() {
+	defer p.wg.Done()
+	for job := range p.queue {
+		p.reportWorkersBusy(1)
+		start := time.Now()
+		job.Execute()
+		p.reportJobDuration(time.Since(start))
+		p.reportWorkersBusy(-1)
+	}
+}
+
+// TrySubmit enqueues job without blocking. If the queue is already full it
+// reports a drop and returns ErrQueueFull instead of enqueuing.
+func (p *Pool) TrySubmit(job Job) error {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if p.closed {
+		return ErrPoolClosed
+	}
+	select {
+	case p.queue <- job:
+		p.reportQueueDepth()
+		return nil
+	default:
+		p.reportJobDropped()
+		return ErrQueueFull
+	}
+}
+
+// SubmitContext enqueues job, blocking until there's room in the queue or
+// ctx is done.
+func (p *Pool) SubmitContext(ctx context.Context, job Job) error {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if p.closed {
+		return ErrPoolClosed
+	}
+	select {
+	case p.queue <- job:
+		p.reportQueueDepth()
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Acquire reserves one of the pool's worker slots for code the caller runs
+// itself, rather than handing it to the pool as a Job. It blocks until a
+// slot is free or ctx is done. Every Acquire must be matched by a Release.
+func (p *Pool) Acquire(ctx context.Context) error {
+	select {
+	case p.sem <- struct{}{}:
+		p.reportWorkersBusy(1)
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Release returns a slot reserved by Acquire to the pool.
+func (p *Pool) Release() {
+	<-p.sem
+	p.reportWorkersBusy(-1)
+}
+
+// Stop stops accepting new work and waits for every already-queued and
+// in-flight job to finish before returning. It does not wait for slots
+// reserved via Acquire; those are the caller's own goroutines to manage.
+func (p *Pool) Stop() {
+	p.mu.Lock()
+	p.closed = true
+	close(p.queue)
+	p.mu.Unlock()
+	p.wg.Wait()
+}
+
+func (p *Pool) reportQueueDepth() {
+	if p.metrics == nil {
+		return
+	}
+	p.metrics.SetWorkerPoolQueueDepth(p.name, len(p.queue))
+}
+
+func (p *Pool) reportJobDropped() {
+	if p.metrics == nil {
+		return
+	}
+	p.metrics.IncrementWorkerPoolJobsDropped(p.name)
+}
+
+func (p *Pool) reportJobDuration(d time.Duration) {
+	if p.metrics == nil {
+		return
+	}
+	p.metrics.ObserveWorkerPoolJobDuration(p.name, d)
+}
+
+func (p *Pool) reportWorkersBusy(delta int) {
+	if p.metrics == nil {
+		return
+	}
+	p.metrics.AddWorkerPoolWorkersBusy(p.name, delta)
+}
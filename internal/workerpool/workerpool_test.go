@@ -0,0 +1,139 @@
+package workerpool
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type countingJob struct {
+	ran   *int32
+	block chan struct{}
+}
+
+func (j countingJob) Execute() {
+	if j.block != nil {
+		<-j.block
+	}
+	atomic.AddInt32(j.ran, 1)
+}
+
+func TestPool_TrySubmitRunsJobs(t *testing.T) {
+	p := New(2, 4, "test", nil)
+	defer p.Stop()
+
+	var ran int32
+	var wg sync.WaitGroup
+	wg.Add(3)
+	for i := 0; i < 3; i++ {
+		job := countingJob{ran: &ran}
+		if err := p.TrySubmit(wrapJob(job, &wg)); err != nil {
+			t.Fatalf("TrySubmit returned error: %v", err)
+		}
+	}
+	wg.Wait()
+
+	if got := atomic.LoadInt32(&ran); got != 3 {
+		t.Errorf("expected 3 jobs to have run, got %d", got)
+	}
+}
+
+// wrapJob adapts a Job so the wrapping wg.Done() fires after Execute, so
+// tests can wait for completion instead of sleeping.
+type doneJob struct {
+	job Job
+	wg  *sync.WaitGroup
+}
+
+func (d doneJob) Execute() {
+	d.job.Execute()
+	d.wg.Done()
+}
+
+func wrapJob(job Job, wg *sync.WaitGroup) Job {
+	return doneJob{job: job, wg: wg}
+}
+
+func TestPool_TrySubmitReturnsErrQueueFullOnceFull(t *testing.T) {
+	block := make(chan struct{})
+	p := New(1, 1, "test", nil)
+	defer func() {
+		close(block)
+		p.Stop()
+	}()
+
+	var ran int32
+	// Occupy the single worker, then fill the queue, then overflow it.
+	if err := p.TrySubmit(countingJob{ran: &ran, block: block}); err != nil {
+		t.Fatalf("TrySubmit returned error: %v", err)
+	}
+	time.Sleep(20 * time.Millisecond) // give the worker a chance to dequeue and block on job 1
+	if err := p.TrySubmit(countingJob{ran: &ran}); err != nil {
+		t.Fatalf("TrySubmit returned error: %v", err)
+	}
+	if err := p.TrySubmit(countingJob{ran: &ran}); err != ErrQueueFull {
+		t.Errorf("expected ErrQueueFull once the worker and queue are both occupied, got %v", err)
+	}
+}
+
+func TestPool_SubmitContextReturnsOnCancellation(t *testing.T) {
+	block := make(chan struct{})
+	p := New(1, 1, "test", nil)
+	defer func() {
+		close(block)
+		p.Stop()
+	}()
+
+	var ran int32
+	if err := p.TrySubmit(countingJob{ran: &ran, block: block}); err != nil {
+		t.Fatalf("TrySubmit returned error: %v", err)
+	}
+	time.Sleep(20 * time.Millisecond) // give the worker a chance to dequeue and block on job 1
+	if err := p.TrySubmit(countingJob{ran: &ran}); err != nil {
+		t.Fatalf("TrySubmit returned error: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := p.SubmitContext(ctx, countingJob{ran: &ran}); err != context.DeadlineExceeded {
+		t.Errorf("expected SubmitContext to time out against a full queue, got %v", err)
+	}
+}
+
+func TestPool_AcquireReleaseBoundsConcurrency(t *testing.T) {
+	p := New(1, 0, "test", nil)
+	defer p.Stop()
+
+	ctx := context.Background()
+	if err := p.Acquire(ctx); err != nil {
+		t.Fatalf("Acquire returned error: %v", err)
+	}
+
+	acquired := make(chan struct{})
+	go func() {
+		p.Acquire(context.Background())
+		close(acquired)
+	}()
+
+	select {
+	case <-acquired:
+		t.Fatal("second Acquire should have blocked while the only slot is held")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	p.Release()
+	<-acquired
+	p.Release()
+}
+
+func TestPool_TrySubmitAfterStopReturnsErrPoolClosed(t *testing.T) {
+	p := New(1, 1, "test", nil)
+	p.Stop()
+
+	var ran int32
+	if err := p.TrySubmit(countingJob{ran: &ran}); err != ErrPoolClosed {
+		t.Errorf("expected ErrPoolClosed after Stop, got %v", err)
+	}
+}
@@ -1,10 +1,19 @@
 package main
 
 import (
+	"context"
+	"fmt"
 	"log"
+	"net"
 	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
+	_ "dns-resolver/internal/backend/iterative" // self-registers the "iterative" resolver backend, selectable via Config.ResolverType
+	_ "dns-resolver/internal/backend/kres"      // self-registers the "kres" backend when built with -tags=kres
+	_ "dns-resolver/internal/backend/multi"     // self-registers the "multi" zone-routing backend, selectable via Config.BackendName
+	_ "dns-resolver/internal/backend/unbound"   // self-registers the "unbound" backend when built with -tags="unbound cgo"
 	"dns-resolver/internal/cache"
 	"dns-resolver/internal/config"
 	"dns-resolver/internal/metrics"
@@ -14,8 +23,47 @@ import (
 	"dns-resolver/plugins/authoritative"
 	"dns-resolver/plugins/dashboard"
 	"dns-resolver/plugins/example_logger"
+	"dns-resolver/plugins/query_logger"
+	"dns-resolver/plugins/query_logging"
+
+	"github.com/miekg/dns"
 )
 
+// resolverIPAdapter adapts a resolver.ResolverInterface to
+// authoritative.IPResolver, so NotifyZoneSlaves can resolve slave hostnames
+// through the server's own configured resolver instead of net.LookupIP.
+type resolverIPAdapter struct {
+	res resolver.ResolverInterface
+}
+
+// LookupIPAddr resolves host's A and AAAA records through the adapted
+// resolver, combining both into one address list.
+func (a resolverIPAdapter) LookupIPAddr(ctx context.Context, host string) ([]net.IP, error) {
+	var ips []net.IP
+	for _, qtype := range []uint16{dns.TypeA, dns.TypeAAAA} {
+		req := new(dns.Msg)
+		req.SetQuestion(dns.Fqdn(host), qtype)
+		req.RecursionDesired = true
+
+		resp, err := a.res.Resolve(ctx, req)
+		if err != nil {
+			continue
+		}
+		for _, rr := range resp.Answer {
+			switch v := rr.(type) {
+			case *dns.A:
+				ips = append(ips, v.A)
+			case *dns.AAAA:
+				ips = append(ips, v.AAAA)
+			}
+		}
+	}
+	if len(ips) == 0 {
+		return nil, fmt.Errorf("no A/AAAA records found for %s", host)
+	}
+	return ips, nil
+}
+
 // Старая функция больше не используется, так как теперь используем метод из пакета metrics
 
 func main() {
@@ -34,8 +82,31 @@ func main() {
 	// Load configuration
 	cfg := config.NewConfig()
 
+	// Watch config.json for changes and react to SIGHUP, so the resolver,
+	// cache, and metrics listener can pick up a new config without a
+	// process restart.
+	watcher := config.NewWatcher("config.json", cfg, 5*time.Second)
+	go watcher.Start()
+	defer watcher.Stop()
+
+	config.Subscribe(func(newCfg, oldCfg *config.Config) {
+		log.Printf("configuration reloaded (resolver: %q -> %q, prometheus: %t -> %t)",
+			oldCfg.ResolverType, newCfg.ResolverType, oldCfg.PrometheusEnabled, newCfg.PrometheusEnabled)
+	})
+
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		for range hup {
+			log.Println("received SIGHUP, forcing a config reload")
+			if err := watcher.Reload(); err != nil {
+				log.Printf("SIGHUP config reload failed, keeping the active config: %v", err)
+			}
+		}
+	}()
+
 	// Initialize metrics
-	m := metrics.NewMetrics()
+	m := metrics.NewMetrics(cfg)
 
 	// Create cache and resolver
 	c := cache.NewCache(cfg.CacheSize, cache.DefaultShards, cfg.LMDBPath, m)
@@ -68,16 +139,44 @@ func main() {
 	loggerPlugin := example_logger.New()
 	pm.Register(loggerPlugin)
 
+	// Register the structured query logger plugin, if enabled
+	if cfg.QueryLogEnabled {
+		queryLoggerPlugin, err := query_logger.New(cfg)
+		if err != nil {
+			log.Fatalf("Failed to create query logger plugin: %v", err)
+		}
+		defer queryLoggerPlugin.Close()
+		pm.Register(queryLoggerPlugin)
+	}
+
+	// Register the structured query-logging plugin, if enabled
+	var queryLoggingPlugin *query_logging.QueryLoggingPlugin
+	if cfg.QueryLoggingEnabled {
+		queryLoggingPlugin, err = query_logging.New(cfg, m)
+		if err != nil {
+			log.Fatalf("Failed to create query logging plugin: %v", err)
+		}
+		defer queryLoggingPlugin.Close()
+		pm.Register(queryLoggingPlugin)
+	}
+
 	// Register the authoritative DNS plugin
 	authoritativePlugin := authoritative.New()
+	authoritativePlugin.SetIPResolver(resolverIPAdapter{res: res})
 	pm.Register(authoritativePlugin)
 
 	// Register and start the dashboard plugin
-	dashboardPlugin := dashboard.New(cfg, m, authoritativePlugin)
+	dashboardPlugin := dashboard.New(cfg, m, authoritativePlugin, res, queryLoggingPlugin)
 	go dashboardPlugin.Start()
 
 	// Create and start the server
 	srv := server.NewServer(cfg, m, res, pm)
 
-	srv.ListenAndServe()
+	// Cancel ctx on SIGINT/SIGTERM so ListenAndServe runs its graceful
+	// shutdown sequence instead of dropping in-flight queries when the
+	// process is stopped.
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	srv.ListenAndServe(ctx)
 }
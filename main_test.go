@@ -106,8 +106,8 @@ func TestApiZoneSynchronization(t *testing.T) {
 	defer os.Remove(masterZonesFile)
 
 	masterAuthPlugin := authoritative.New(masterZonesFile)
-	masterLbPlugin := loadbalancer.New()
-	masterDashboardPlugin := dashboard.New(masterCfg, metrics.NewMetrics(), masterAuthPlugin, masterLbPlugin)
+	masterLbPlugin := loadbalancer.New("", nil)
+	masterDashboardPlugin := dashboard.New(masterCfg, metrics.NewMetrics(masterCfg), masterAuthPlugin, masterLbPlugin)
 
 	// Create a new ServeMux for the test server
 	mux := http.NewServeMux()
@@ -10,6 +10,7 @@ package authoritative
 
 import (
 	"bufio"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -49,13 +50,49 @@ type Zone struct {
 	// soa record if present
 	soa dns.RR
 
+	// dnssec holds the zone's signing keys when DNSSEC is enabled for it;
+	// nil means the zone is unsigned.
+	dnssec *DNSSECKeyState
+	// sigCache is shared across all signed zones served by this plugin.
+	sigCache *SignatureCache
+
+	// nsec3 holds the zone's NSEC3PARAM when it uses NSEC3 instead of plain
+	// NSEC for denial of existence; nil means NSEC (if signed at all).
+	nsec3 *NSEC3Params
+	// nsec3Chain is the sorted hashed-owner chain, rebuilt by
+	// buildNSEC3Chain whenever the zone's records change.
+	nsec3Chain []nsec3ChainEntry
+
+	// journal is the append-only history of serial-to-serial diffs used to
+	// serve IXFR (see journal.go); bounded by journalMax().
+	journal []JournalEntry
+	// journalMaxOverride, when non-zero, replaces maxJournalEntries as this
+	// zone's journal cap; set via SetZoneJournalMax.
+	journalMaxOverride int
+
+	// Aliases are additional FQDNs that resolve to this same zone's record
+	// store (see zonealias.go). The zone index holds a trie entry for each
+	// one, all pointing back at this *Zone.
+	Aliases []string
+
+	// linkLocal marks this zone as served over mDNS (see mdns.go) in
+	// addition to unicast; set via EnableLinkLocal.
+	linkLocal bool
+	// mdnsRecordSeq numbers the synthetic PTR/SRV/TXT records Publish
+	// creates, kept separate from nextRecordID since published services
+	// are announced over multicast rather than managed through the usual
+	// zone CRUD API.
+	mdnsRecordSeq int
+
 	mu sync.RWMutex
 }
 
 // ZoneDTO is a serializable representation of a Zone
 type ZoneDTO struct {
-	Name    string      `json:"name"`
-	Records []RecordDTO `json:"records"`
+	Name    string            `json:"name"`
+	Aliases []string          `json:"aliases,omitempty"`
+	Records []RecordDTO       `json:"records"`
+	Journal []JournalEntryDTO `json:"journal,omitempty"`
 }
 
 // AuthoritativePlugin is thread-safe and intended for production use
@@ -65,14 +102,113 @@ type AuthoritativePlugin struct {
 	mu           sync.RWMutex // protects zones map and nextRecordID
 	filePath     string
 	fileMu       sync.Mutex
+
+	// zoneIndex mirrors zones as a reverse-label radix trie so findZone
+	// resolves the longest-suffix match in O(labels) instead of scanning
+	// every zone; kept in sync under mu by every mutating method.
+	zoneIndex *zoneTrie
+
+	// sigCache is the shared DNSSEC signature cache handed to every zone
+	// that has EnableDNSSEC called on it.
+	sigCache *SignatureCache
+
+	// updateACLs restricts which clients may send RFC 2136 dynamic updates.
+	updateACLs *updateACLs
+
+	// secondaries tracks outbound NOTIFY targets and, for zones this server
+	// holds as a secondary, the master to refresh from (see notify.go).
+	secondaries *secondaries
+
+	// tsig holds RFC 2136 update authentication keys, scoped per zone
+	// (see tsig.go).
+	tsig *tsigKeyStore
+
+	// serialStrategy controls how ExportZoneBIND computes the SOA serial it
+	// writes (see bindzone.go); defaults to SerialAuto.
+	serialStrategy SerialStrategy
+
+	// secondaryTimers tracks the RFC 1034 refresh/retry/expire cycle for
+	// zones this server is a secondary of (see secondary.go).
+	secondaryTimers *secondaryTimers
+
+	// ipResolver resolves a slave hostname to addresses when NotifyZoneSlaves
+	// finds no in-zone glue for it. Nil means fall back to net.LookupIP (the
+	// original behavior); SetIPResolver lets the server hand this plugin its
+	// own configured resolver (e.g. the "iterative" backend) instead of
+	// relying on the OS stub resolver.
+	ipResolver IPResolver
+
+	// gns2dnsResolver, when set via SetGNS2DNSResolver, is the resolver
+	// GNS2DNS delegation records (see gns2dns.go) use to query their
+	// referenced server(s) instead of a bare dns.Client.Exchange.
+	gns2dnsResolver GNS2DNSResolver
+
+	// providers are consulted, in order, whenever code needs to search
+	// zone records across storage backends rather than through a specific
+	// zone's own map - currently just the slave NS glue lookup in
+	// NotifyZoneSlaves. It always starts with a MemoryProvider over this
+	// plugin's own zone store; AddZoneProvider appends others (e.g. a
+	// FileProvider or SQLProvider fronting zones this server doesn't hold
+	// in memory).
+	providers []ZoneProvider
+
+	// logger receives structured events from the notify/transfer path
+	// (see logger.go); defaults to a log/slog-backed Logger. Use
+	// SetLogger to route events elsewhere.
+	logger Logger
+}
+
+// AddZoneProvider registers an additional ZoneProvider to consult for
+// cross-backend record lookups, alongside this plugin's own in-memory
+// store.
+func (p *AuthoritativePlugin) AddZoneProvider(provider ZoneProvider) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.providers = append(p.providers, provider)
+}
+
+// IPResolver looks up the addresses of a hostname. It's satisfied by an
+// adapter over the server's own resolver, letting NotifyZoneSlaves reuse
+// whatever caching/DNSSEC/transport policy that resolver applies instead of
+// shelling out to net.LookupIP.
+type IPResolver interface {
+	LookupIPAddr(ctx context.Context, host string) ([]net.IP, error)
+}
+
+// SetIPResolver installs r as the resolver NotifyZoneSlaves uses for slave
+// hostnames it finds no in-zone glue for. Passing nil restores the default
+// net.LookupIP behavior.
+func (p *AuthoritativePlugin) SetIPResolver(r IPResolver) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.ipResolver = r
+}
+
+// lookupSlaveIPs resolves host via the configured IPResolver, falling back
+// to net.LookupIP when none has been set via SetIPResolver.
+func (p *AuthoritativePlugin) lookupSlaveIPs(host string) ([]net.IP, error) {
+	p.mu.RLock()
+	r := p.ipResolver
+	p.mu.RUnlock()
+	if r == nil {
+		return net.LookupIP(host)
+	}
+	return r.LookupIPAddr(context.Background(), host)
 }
 
 func New(filePath string) *AuthoritativePlugin {
 	p := &AuthoritativePlugin{
-		zones:        make(map[string]*Zone),
-		nextRecordID: 1,
-		filePath:     filePath,
+		zones:           make(map[string]*Zone),
+		nextRecordID:    1,
+		filePath:        filePath,
+		updateACLs:      newUpdateACLs(),
+		secondaries:     newSecondaries(),
+		zoneIndex:       newZoneTrie(),
+		tsig:            newTSIGKeyStore(),
+		secondaryTimers: newSecondaryTimers(),
+		logger:          newDefaultLogger(),
 	}
+	p.providers = []ZoneProvider{NewMemoryProvider(p)}
 	if err := p.loadFromFile(); err != nil {
 		log.Printf("Could not load zones from file: %v", err)
 	}
@@ -130,6 +266,7 @@ func (p *AuthoritativePlugin) loadFromFile() error {
 	for _, zd := range zoneDTOs {
 		z := &Zone{
 			Name:    zd.Name,
+			Aliases: zd.Aliases,
 			records: make(map[string]map[uint16][]Record),
 		}
 		for _, rd := range zd.Records {
@@ -155,37 +292,27 @@ func (p *AuthoritativePlugin) loadFromFile() error {
 				z.nsRecords = append(z.nsRecords, v)
 			}
 		}
+		z.journal = journalFromDTO(zd.Journal)
 		p.zones[z.Name] = z
 	}
 	p.nextRecordID = maxID + 1
+	p.zoneIndex = newZoneTrie()
+	for _, z := range p.zones {
+		p.zoneIndex.insert(z)
+	}
 	log.Println("Zones successfully loaded from file:", p.filePath)
 	return nil
 }
 
 func (p *AuthoritativePlugin) Name() string { return "Authoritative" }
 
-// findZone implements longest-suffix match. qName must be FQDN
+// findZone implements longest-suffix match via the zone index trie. qName
+// must be FQDN.
 func (p *AuthoritativePlugin) findZone(qName string) (*Zone, bool) {
 	q := dns.Fqdn(strings.ToLower(qName))
 	p.mu.RLock()
 	defer p.mu.RUnlock()
-
-	// Collect candidate zone names and pick longest
-	var best *Zone
-	var bestLen int
-	for _, z := range p.zones {
-		// zone.Name is already FQDN lowercased
-		if strings.HasSuffix(q, z.Name) {
-			if len(z.Name) > bestLen {
-				best = z
-				bestLen = len(z.Name)
-			}
-		}
-	}
-	if best == nil {
-		return nil, false
-	}
-	return best, true
+	return p.zoneIndex.lookup(q)
 }
 
 // Execute handles incoming queries. It returns nil to allow the chain to continue
@@ -195,8 +322,19 @@ func (p *AuthoritativePlugin) Execute(ctx *plugins.PluginContext, msg *dns.Msg)
 	if len(msg.Question) == 0 {
 		return nil
 	}
+
+	if msg.Opcode == dns.OpcodeUpdate {
+		p.handleUpdate(ctx, msg)
+		return nil
+	}
+
+	if msg.Opcode == dns.OpcodeNotify {
+		p.handleNotify(ctx, msg)
+		return nil
+	}
+
 	q := msg.Question[0]
-	zone, ok := p.findZone(q.Name)
+	zone, matchedOrigin, ok := p.findZoneWithOrigin(q.Name)
 	if !ok {
 		// not authoritative
 		return nil
@@ -204,12 +342,42 @@ func (p *AuthoritativePlugin) Execute(ctx *plugins.PluginContext, msg *dns.Msg)
 
 	log.Printf("[%s] authoritative handling for %s (qtype=%d)", p.Name(), q.Name, q.Qtype)
 
+	if q.Qtype == dns.TypeAXFR || q.Qtype == dns.TypeIXFR {
+		if !p.transferAuthorized(zone.Name, msg) {
+			p.log().Warn("transfer request refused", "zone", zone.Name, "qtype", dns.TypeToString[q.Qtype], "error", ErrTSIGFailure)
+			res := new(dns.Msg)
+			res.SetReply(msg)
+			res.Rcode = dns.RcodeRefused
+			ctx.ResponseWriter.WriteMsg(res)
+			ctx.Stop = true
+			return nil
+		}
+	}
+
 	if q.Qtype == dns.TypeAXFR {
 		p.handleAXFR(ctx, msg, zone)
 		ctx.Stop = true
 		return nil
 	}
 
+	if q.Qtype == dns.TypeIXFR {
+		p.handleIXFR(ctx, msg, zone)
+		ctx.Stop = true
+		return nil
+	}
+
+	res := p.buildAnswer(msg, q, zone, matchedOrigin)
+	ctx.ResponseWriter.WriteMsg(res)
+	ctx.Stop = true
+	return nil
+}
+
+// buildAnswer looks up q within zone and returns a complete reply for msg:
+// the matching records (following CNAME/GNS2DNS delegation), NODATA, or
+// NXDOMAIN, each with the authority/additional sections and DNSSEC records
+// Execute has always attached. It is also the core of the "authoritative"
+// Backend adapter (see backend.go), so both paths answer identically.
+func (p *AuthoritativePlugin) buildAnswer(msg *dns.Msg, q dns.Question, zone *Zone, matchedOrigin string) *dns.Msg {
 	res := &dns.Msg{}
 	res.SetReply(msg)
 	res.Authoritative = true
@@ -249,6 +417,13 @@ func (p *AuthoritativePlugin) Execute(ctx *plugins.PluginContext, msg *dns.Msg)
 					// Follow CNAME within authoritative zones
 					p.followCname(res, q, cname.Target, 0)
 				}
+			} else if gnsRecs, ok := recordsForName[TypeGNS2DNS]; ok && len(gnsRecs) > 0 {
+				// This subtree is delegated to an external naming system
+				// via a GNS2DNS record; resolve it there and splice the
+				// answer back in under the original QNAME.
+				if rdata, ok := gns2dnsRdata(gnsRecs[0].RR); ok {
+					p.resolveGNS2DNS(res, q, rdata, 0)
+				}
 			}
 		}
 		zone.mu.RUnlock()
@@ -258,24 +433,32 @@ func (p *AuthoritativePlugin) Execute(ctx *plugins.PluginContext, msg *dns.Msg)
 			p.addAuthorityAndGlue(res, zone)
 			// Add extra records (e.g., A/AAAA for MX)
 			p.addExtraRecords(res, zone)
-			ctx.ResponseWriter.WriteMsg(res)
-			ctx.Stop = true
-			return nil
+			if doRequested(msg) {
+				p.addDNSSECToResponse(res, zone)
+			}
+			rewriteResponseOwners(res, zone.Name, matchedOrigin)
+			return res
 		}
 		// Name exists but no records of requested type => NODATA (NOERROR)
 		res.Rcode = dns.RcodeSuccess
 		p.addSOAAuthority(res, zone)
-		ctx.ResponseWriter.WriteMsg(res)
-		ctx.Stop = true
-		return nil
+		if doRequested(msg) {
+			p.addNSECNoData(res, zone, name)
+			p.addDNSSECToResponse(res, zone)
+		}
+		rewriteResponseOwners(res, zone.Name, matchedOrigin)
+		return res
 	}
 
 	// Name does not exist within the zone => NXDOMAIN. Include SOA in Authority.
 	res.Rcode = dns.RcodeNameError
 	p.addSOAAuthority(res, zone)
-	ctx.ResponseWriter.WriteMsg(res)
-	ctx.Stop = true
-	return nil
+	if doRequested(msg) {
+		p.addNSECNXDomain(res, zone, name)
+		p.addDNSSECToResponse(res, zone)
+	}
+	rewriteResponseOwners(res, zone.Name, matchedOrigin)
+	return res
 }
 
 const maxCnameFollows = 5
@@ -430,7 +613,6 @@ func (p *AuthoritativePlugin) addExtraRecords(res *dns.Msg, z *Zone) {
 	}
 }
 
-
 // addSOAAuthority sets SOA in Authority (used for NXDOMAIN and NODATA)
 func (p *AuthoritativePlugin) addSOAAuthority(res *dns.Msg, z *Zone) {
 	z.mu.RLock()
@@ -499,6 +681,7 @@ func (p *AuthoritativePlugin) LoadZone(zoneFile string) error {
 	// store zone
 	p.mu.Lock()
 	p.zones[origin] = z
+	p.zoneIndex.insert(z)
 	p.mu.Unlock()
 
 	log.Printf("Loaded zone %s (%d owner names)", origin, len(z.records))
@@ -548,10 +731,14 @@ func (p *AuthoritativePlugin) GetZoneDTOs() []ZoneDTO {
 				}
 			}
 		}
+		journal := journalToDTO(zone.journal)
+		aliases := zone.Aliases
 		zone.mu.RUnlock()
 		zoneDTOs = append(zoneDTOs, ZoneDTO{
 			Name:    zone.Name,
+			Aliases: aliases,
 			Records: recordDTOs,
+			Journal: journal,
 		})
 	}
 	return zoneDTOs
@@ -625,6 +812,7 @@ func (p *AuthoritativePlugin) AddZone(zoneName string) error {
 	z.soa = soaRR
 
 	p.zones[zn] = z
+	p.zoneIndex.insert(z)
 
 	// Release lock before saving to file
 	p.mu.Unlock()
@@ -637,11 +825,16 @@ func (p *AuthoritativePlugin) AddZone(zoneName string) error {
 func (p *AuthoritativePlugin) DeleteZone(zoneName string) error {
 	zn := dns.Fqdn(strings.ToLower(zoneName))
 	p.mu.Lock()
-	if _, ok := p.zones[zn]; !ok {
+	z, ok := p.zones[zn]
+	if !ok {
 		p.mu.Unlock()
 		return fmt.Errorf("zone not found: %s", zoneName)
 	}
 	delete(p.zones, zn)
+	p.zoneIndex.delete(zn)
+	for _, alias := range z.Aliases {
+		p.zoneIndex.delete(alias)
+	}
 	p.mu.Unlock()
 	err := p.saveToFile(p.GetZoneDTOs())
 	return err
@@ -671,18 +864,27 @@ func (p *AuthoritativePlugin) AddZoneRecord(zoneName string, rr dns.RR) (int, er
 	z.records[name][rr.Header().Rrtype] = append(z.records[name][rr.Header().Rrtype], Record{ID: id, RR: rr})
 
 	// collect soa and ns records separately
+	_, isSOA := rr.(*dns.SOA)
 	switch v := rr.(type) {
 	case *dns.SOA:
 		z.soa = v
 	case *dns.NS:
 		z.nsRecords = append(z.nsRecords, v)
 	}
+	if !isSOA {
+		oldSerial, newSerial := bumpSOASerial(z)
+		z.appendJournal(oldSerial, newSerial, nil, []dns.RR{rr})
+	}
+	z.buildNSEC3Chain()
 	z.mu.Unlock()
 
 	err := p.saveToFile(p.GetZoneDTOs())
 	if err != nil {
 		return 0, fmt.Errorf("failed to save zone to file: %w", err)
 	}
+	if !isSOA {
+		p.notifySecondaries(zn)
+	}
 	return id, nil
 }
 
@@ -695,12 +897,13 @@ func (p *AuthoritativePlugin) UpdateZoneRecord(zoneName string, recordId int, ne
 	if !ok {
 		return fmt.Errorf("zone not found: %s", zoneName)
 	}
+	var oldRR dns.RR
 	z.mu.Lock()
 	for name, typmap := range z.records {
 		for t, arr := range typmap {
 			for i, r := range arr {
 				if r.ID == recordId {
-					oldRR := z.records[name][t][i].RR
+					oldRR = z.records[name][t][i].RR
 					z.records[name][t][i].RR = newRR
 					recordUpdated = true
 					// update special fields
@@ -730,6 +933,13 @@ func (p *AuthoritativePlugin) UpdateZoneRecord(zoneName string, recordId int, ne
 			break // break outer loop
 		}
 	}
+	if recordUpdated {
+		if _, isSOA := newRR.(*dns.SOA); !isSOA {
+			oldSerial, newSerial := bumpSOASerial(z)
+			z.appendJournal(oldSerial, newSerial, []dns.RR{oldRR}, []dns.RR{newRR})
+		}
+		z.buildNSEC3Chain()
+	}
 	z.mu.Unlock()
 
 	if !recordUpdated {
@@ -737,6 +947,7 @@ func (p *AuthoritativePlugin) UpdateZoneRecord(zoneName string, recordId int, ne
 	}
 
 	err := p.saveToFile(p.GetZoneDTOs())
+	p.notifySecondaries(zn)
 	return err
 }
 
@@ -749,6 +960,7 @@ func (p *AuthoritativePlugin) DeleteZoneRecord(zoneName string, recordId int) er
 	if !ok {
 		return fmt.Errorf("zone not found: %s", zoneName)
 	}
+	var deletedRR dns.RR
 	z.mu.Lock()
 	for name, typmap := range z.records {
 		for t, arr := range typmap {
@@ -763,6 +975,7 @@ func (p *AuthoritativePlugin) DeleteZoneRecord(zoneName string, recordId int) er
 							}
 						}
 					}
+					deletedRR = r.RR
 					z.records[name][t] = append(arr[:i], arr[i+1:]...)
 					recordDeleted = true
 					break // break inner loop
@@ -776,6 +989,13 @@ func (p *AuthoritativePlugin) DeleteZoneRecord(zoneName string, recordId int) er
 			break // break outer loop
 		}
 	}
+	if recordDeleted {
+		if _, isSOA := deletedRR.(*dns.SOA); !isSOA {
+			oldSerial, newSerial := bumpSOASerial(z)
+			z.appendJournal(oldSerial, newSerial, []dns.RR{deletedRR}, nil)
+		}
+		z.buildNSEC3Chain()
+	}
 	z.mu.Unlock()
 
 	if !recordDeleted {
@@ -783,6 +1003,7 @@ func (p *AuthoritativePlugin) DeleteZoneRecord(zoneName string, recordId int) er
 	}
 
 	err := p.saveToFile(p.GetZoneDTOs())
+	p.notifySecondaries(zn)
 	return err
 }
 
@@ -808,6 +1029,8 @@ func (p *AuthoritativePlugin) UpdateZone(oldZoneName, newZoneName string) error
 	z.Name = newZn
 	p.zones[newZn] = z
 	delete(p.zones, oldZn)
+	p.zoneIndex.delete(oldZn)
+	p.zoneIndex.insert(z)
 
 	// Update SOA and NS records to reflect the new zone name
 	if z.soa != nil {
@@ -835,7 +1058,6 @@ func (p *AuthoritativePlugin) UpdateZone(oldZoneName, newZoneName string) error
 	return nil
 }
 
-
 func (p *AuthoritativePlugin) ReplaceAllZones(zoneDTOs []ZoneDTO) error {
 	log.Println("Replacing all zones...")
 	newZones := make(map[string]*Zone)
@@ -843,6 +1065,7 @@ func (p *AuthoritativePlugin) ReplaceAllZones(zoneDTOs []ZoneDTO) error {
 	for _, zd := range zoneDTOs {
 		z := &Zone{
 			Name:    zd.Name,
+			Aliases: zd.Aliases,
 			records: make(map[string]map[uint16][]Record),
 		}
 		for _, rd := range zd.Records {
@@ -866,11 +1089,19 @@ func (p *AuthoritativePlugin) ReplaceAllZones(zoneDTOs []ZoneDTO) error {
 				z.nsRecords = append(z.nsRecords, v)
 			}
 		}
+		z.journal = journalFromDTO(zd.Journal)
+		z.buildNSEC3Chain()
 		newZones[z.Name] = z
 	}
 
+	newIndex := newZoneTrie()
+	for _, z := range newZones {
+		newIndex.insert(z)
+	}
+
 	p.mu.Lock()
 	p.zones = newZones
+	p.zoneIndex = newIndex
 	p.nextRecordID = maxID + 1
 	p.mu.Unlock()
 
@@ -913,7 +1144,7 @@ func (p *AuthoritativePlugin) NotifyZoneSlaves(zoneName string) error {
 	}
 
 	if len(slaves) == 0 {
-		log.Printf("No slave servers found for zone %s to notify.", zoneName)
+		p.log().Info("no slave servers to notify", "zone", zoneName)
 		return nil
 	}
 
@@ -921,35 +1152,22 @@ func (p *AuthoritativePlugin) NotifyZoneSlaves(zoneName string) error {
 	m.SetNotify(zone.Name)
 	client := new(dns.Client)
 
-	log.Printf("Preparing to send NOTIFY for zone %s to slaves: %v", zone.Name, slaves)
+	p.log().Info("preparing NOTIFY", "zone", zone.Name, "slaves", slaves)
+
+	p.mu.RLock()
+	providers := append([]ZoneProvider(nil), p.providers...)
+	p.mu.RUnlock()
 
 	for _, slaveHost := range slaves {
-		// Attempt to find glue records within the zone first.
-		var addrs []string
-		zone.mu.RLock()
-		if recs, found := zone.records[dns.Fqdn(slaveHost)]; found {
-			if aRecs, ok := recs[dns.TypeA]; ok {
-				for _, r := range aRecs {
-					if a, isA := r.RR.(*dns.A); isA {
-						addrs = append(addrs, a.A.String())
-					}
-				}
-			}
-			if aaaaRecs, ok := recs[dns.TypeAAAA]; ok {
-				for _, r := range aaaaRecs {
-					if aaaa, isAAAA := r.RR.(*dns.AAAA); isAAAA {
-						addrs = append(addrs, aaaa.AAAA.String())
-					}
-				}
-			}
-		}
-		zone.mu.RUnlock()
+		// Attempt to find glue records across the registered providers
+		// first, stopping at whichever one actually has some.
+		addrs := p.glueAddrs(zone.Name, slaveHost, providers)
 
 		// If no in-zone glue is found, use the system's resolver.
 		if len(addrs) == 0 {
-			ips, err := net.LookupIP(slaveHost)
+			ips, err := p.lookupSlaveIPs(slaveHost)
 			if err != nil {
-				log.Printf("Error resolving IP for slave %s: %v", slaveHost, err)
+				p.log().Warn("slave server could not be resolved", "zone", zone.Name, "slave", slaveHost, "error", fmt.Errorf("%w: %v", ErrUnknownSlave, err))
 				continue
 			}
 			for _, ip := range ips {
@@ -958,13 +1176,48 @@ func (p *AuthoritativePlugin) NotifyZoneSlaves(zoneName string) error {
 		}
 
 		for _, addr := range addrs {
-			log.Printf("Sending NOTIFY for zone %s to slave %s at %s", zone.Name, slaveHost, addr)
-			_, _, err := client.Exchange(m, net.JoinHostPort(addr, "53"))
+			p.log().Info("sending NOTIFY", "zone", zone.Name, "slave", slaveHost, "addr", addr)
+			resp, _, err := client.Exchange(m, net.JoinHostPort(addr, "53"))
 			if err != nil {
-				log.Printf("Failed to send NOTIFY to %s (%s): %v", slaveHost, addr, err)
+				p.log().Error("NOTIFY failed", "zone", zone.Name, "slave", slaveHost, "addr", addr, "error", err)
+			} else if resp.Rcode != dns.RcodeSuccess {
+				p.log().Warn("NOTIFY refused", "zone", zone.Name, "slave", slaveHost, "addr", addr, "rcode", dns.RcodeToString[resp.Rcode], "error", ErrNotifyRefused)
 			}
 		}
 	}
 
 	return nil
 }
+
+// glueAddrs looks up slaveHost's A/AAAA glue within zoneName by querying
+// each provider in turn, stopping at the first one that has any -
+// consulting every registered ZoneProvider instead of reaching into a
+// single in-memory map, so a slave's glue is found whether that zone's
+// records live in this plugin's own store, a FileProvider, or a
+// SQLProvider.
+func (p *AuthoritativePlugin) glueAddrs(zoneName, slaveHost string, providers []ZoneProvider) []string {
+	owner := dns.Fqdn(slaveHost)
+	for _, provider := range providers {
+		records, err := provider.GetRecords(context.Background(), zoneName)
+		if err != nil {
+			p.log().Warn("glue lookup failed", "zone", zoneName, "slave", slaveHost, "error", fmt.Errorf("%w: %v", ErrInvalidGlue, err))
+			continue
+		}
+		var addrs []string
+		for _, r := range records {
+			if !strings.EqualFold(r.RR.Header().Name, owner) {
+				continue
+			}
+			switch rr := r.RR.(type) {
+			case *dns.A:
+				addrs = append(addrs, rr.A.String())
+			case *dns.AAAA:
+				addrs = append(addrs, rr.AAAA.String())
+			}
+		}
+		if len(addrs) > 0 {
+			return addrs
+		}
+	}
+	return nil
+}
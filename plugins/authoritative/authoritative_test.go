@@ -8,9 +8,9 @@ import (
 	"sync"
 	"testing"
 
+	"dns-resolver/internal/plugins"
 	"github.com/miekg/dns"
 	"github.com/stretchr/testify/assert"
-	"dns-resolver/internal/plugins"
 )
 
 // completeMockResponseWriter is a mock that implements the full dns.ResponseWriter interface
@@ -270,7 +270,7 @@ func TestUpdateNSRecord(t *testing.T) {
 	assert.Equal(t, 2, len(zone.nsRecords), "Should still have two NS records after update")
 	var foundNew, foundOld bool
 	for _, rec := range zone.nsRecords {
-		if ns, ok := rec.RR.(*dns.NS); ok {
+		if ns, ok := rec.(*dns.NS); ok {
 			if ns.Ns == "new-ns.example.com." {
 				foundNew = true
 			}
@@ -285,7 +285,7 @@ func TestUpdateNSRecord(t *testing.T) {
 	// Delete the other NS record
 	p.DeleteZoneRecord("example.com.", id2)
 	assert.Equal(t, 1, len(zone.nsRecords), "Should have one NS record after delete")
-	assert.Equal(t, "new-ns.example.com.", zone.nsRecords[0].RR.(*dns.NS).Ns)
+	assert.Equal(t, "new-ns.example.com.", zone.nsRecords[0].(*dns.NS).Ns)
 }
 
 func TestCNAMEAliasResponse(t *testing.T) {
@@ -437,7 +437,7 @@ func TestAddMultipleNSRecords(t *testing.T) {
 	// Check that all records are there
 	var found [4]bool
 	for _, rec := range zone.nsRecords {
-		if ns, ok := rec.RR.(*dns.NS); ok {
+		if ns, ok := rec.(*dns.NS); ok {
 			switch ns.Ns {
 			case "ns1.example.com.":
 				found[0] = true
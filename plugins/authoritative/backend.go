@@ -0,0 +1,46 @@
+package authoritative
+
+import (
+	"context"
+
+	"dns-resolver/internal/config"
+	"dns-resolver/internal/interfaces"
+
+	"github.com/miekg/dns"
+)
+
+func init() {
+	interfaces.RegisterBackend("authoritative", func(cfg *config.Config) (interfaces.Backend, error) {
+		return New(cfg.AuthoritativeZoneFile), nil
+	})
+}
+
+// Exchange answers req from this plugin's own zones, the same lookup Execute
+// performs for an ordinary query, so this plugin can be used as a child
+// backend of e.g. the "multi" backend instead of only intercepting queries
+// through the plugin chain. It returns ErrNotAuthoritative if no zone
+// matches and ErrTransferNotSupported for AXFR/IXFR, which need the
+// streaming plugin-chain path in Execute instead.
+func (p *AuthoritativePlugin) Exchange(_ context.Context, req *dns.Msg) (*dns.Msg, interfaces.DNSSECStatus, error) {
+	if len(req.Question) == 0 {
+		return nil, interfaces.DNSSECUnknown, ErrNotAuthoritative
+	}
+	q := req.Question[0]
+
+	if q.Qtype == dns.TypeAXFR || q.Qtype == dns.TypeIXFR {
+		return nil, interfaces.DNSSECUnknown, ErrTransferNotSupported
+	}
+
+	zone, matchedOrigin, ok := p.findZoneWithOrigin(q.Name)
+	if !ok {
+		return nil, interfaces.DNSSECUnknown, ErrNotAuthoritative
+	}
+
+	res := p.buildAnswer(req, q, zone, matchedOrigin)
+
+	status := interfaces.DNSSECInsecure
+	if res.AuthenticatedData {
+		status = interfaces.DNSSECSecure
+	}
+	return res, status, nil
+}
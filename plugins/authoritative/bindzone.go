@@ -0,0 +1,224 @@
+package authoritative
+
+// BIND-format zone file import/export, complementing the JSON persistence
+// in authoritative.go. Operators who manage zones with BIND-shaped tooling
+// can round-trip a zone through ExportZoneBIND/ImportZoneBIND without going
+// through the file-based LoadZone path, e.g. from an HTTP upload handler.
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// SerialStrategy controls how ExportZoneBIND computes the SOA serial it
+// writes out.
+type SerialStrategy int
+
+const (
+	// SerialAuto picks SerialDateEncoded when the zone's current serial
+	// already looks like a YYYYMMDDnn date-encoded serial, and
+	// SerialIncrement otherwise. This is the plugin's default.
+	SerialAuto SerialStrategy = iota
+	// SerialIncrement always bumps the serial by 1.
+	SerialIncrement
+	// SerialDateEncoded always writes a YYYYMMDDnn serial, bumping the
+	// revision suffix if the zone was already exported today.
+	SerialDateEncoded
+)
+
+// typeOrder ranks RR types for BIND zone file output: SOA and NS first so a
+// reader sees the zone's identity and delegation up front, then the common
+// record types in the order most BIND-shaped tooling (e.g. dnscontrol's
+// pretty-printer) emits them, with everything else following by type number.
+var typeOrder = map[uint16]int{
+	dns.TypeSOA:   0,
+	dns.TypeNS:    1,
+	dns.TypeMX:    2,
+	dns.TypeA:     3,
+	dns.TypeAAAA:  4,
+	dns.TypeCNAME: 5,
+	dns.TypeTXT:   6,
+	dns.TypeSRV:   7,
+	dns.TypeCAA:   8,
+}
+
+func rrTypeRank(t uint16) int {
+	if r, ok := typeOrder[t]; ok {
+		return r
+	}
+	return len(typeOrder) + int(t)
+}
+
+// SetSerialStrategy configures the SOA serial strategy ExportZoneBIND uses
+// for every zone going forward; the default is SerialAuto.
+func (p *AuthoritativePlugin) SetSerialStrategy(s SerialStrategy) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.serialStrategy = s
+}
+
+// ExportZoneBIND writes zoneName out as a canonical, sorted BIND-style zone
+// file: $ORIGIN and $TTL, the SOA record (serial computed per the plugin's
+// SerialStrategy), then every other record grouped by owner name in
+// canonical order and, within an owner, RFC-compliant type order.
+func (p *AuthoritativePlugin) ExportZoneBIND(zoneName string, w io.Writer) error {
+	zone, ok := p.findZone(dns.Fqdn(strings.ToLower(zoneName)))
+	if !ok || zone.Name != dns.Fqdn(strings.ToLower(zoneName)) {
+		return fmt.Errorf("zone not found: %s", zoneName)
+	}
+
+	zone.mu.Lock()
+	defer zone.mu.Unlock()
+
+	ttl := uint32(3600)
+	if soa, ok := zone.soa.(*dns.SOA); ok {
+		ttl = soa.Hdr.Ttl
+		soa.Serial = p.nextExportSerial(soa.Serial)
+	}
+
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "$ORIGIN %s\n", zone.Name)
+	fmt.Fprintf(bw, "$TTL %d\n", ttl)
+
+	if zone.soa != nil {
+		writeSOA(bw, zone.soa.(*dns.SOA))
+	}
+
+	for _, name := range zone.canonicalOwnerNames() {
+		types := zone.records[name]
+		rtypes := make([]uint16, 0, len(types))
+		for t := range types {
+			if t == dns.TypeSOA {
+				continue // already written above
+			}
+			rtypes = append(rtypes, t)
+		}
+		sort.Slice(rtypes, func(i, j int) bool { return rrTypeRank(rtypes[i]) < rrTypeRank(rtypes[j]) })
+		for _, t := range rtypes {
+			for _, rec := range types[t] {
+				fmt.Fprintln(bw, rec.RR.String())
+			}
+		}
+	}
+
+	return bw.Flush()
+}
+
+// writeSOA renders the SOA record in the line-broken multiline format
+// BIND-shaped tooling favors, with the serial/refresh/retry/expire/minimum
+// fields aligned and commented.
+func writeSOA(bw *bufio.Writer, soa *dns.SOA) {
+	fmt.Fprintf(bw, "%s\t%d\tIN\tSOA\t%s %s (\n", soa.Hdr.Name, soa.Hdr.Ttl, soa.Ns, soa.Mbox)
+	fmt.Fprintf(bw, "\t\t\t%d\t; serial\n", soa.Serial)
+	fmt.Fprintf(bw, "\t\t\t%d\t; refresh\n", soa.Refresh)
+	fmt.Fprintf(bw, "\t\t\t%d\t; retry\n", soa.Retry)
+	fmt.Fprintf(bw, "\t\t\t%d\t; expire\n", soa.Expire)
+	fmt.Fprintf(bw, "\t\t\t%d )\t; minimum\n", soa.Minttl)
+}
+
+// nextExportSerial computes the serial ExportZoneBIND should write, given
+// the zone's current serial and the plugin's configured SerialStrategy.
+// Callers must hold zone.mu.
+func (p *AuthoritativePlugin) nextExportSerial(current uint32) uint32 {
+	p.mu.RLock()
+	strategy := p.serialStrategy
+	p.mu.RUnlock()
+
+	if strategy == SerialAuto {
+		if looksDateEncoded(current) {
+			strategy = SerialDateEncoded
+		} else {
+			strategy = SerialIncrement
+		}
+	}
+
+	if strategy == SerialDateEncoded {
+		now := time.Now().UTC()
+		today := uint32(now.Year())*1000000 + uint32(now.Month())*10000 + uint32(now.Day())*100
+		if current/100 == today/100 {
+			rev := current % 100
+			if rev < 99 {
+				return today + rev + 1
+			}
+		}
+		return today
+	}
+	return current + 1
+}
+
+// looksDateEncoded reports whether serial is plausibly a YYYYMMDDnn
+// BIND-style date-encoded serial (RFC 1912 section 2.2): a 10-digit number
+// whose first 8 digits parse as a calendar date in a reasonable range.
+func looksDateEncoded(serial uint32) bool {
+	s := strconv.FormatUint(uint64(serial), 10)
+	if len(s) != 10 {
+		return false
+	}
+	year, err := strconv.Atoi(s[0:4])
+	if err != nil || year < 1990 || year > 2100 {
+		return false
+	}
+	month, err := strconv.Atoi(s[4:6])
+	if err != nil || month < 1 || month > 12 {
+		return false
+	}
+	day, err := strconv.Atoi(s[6:8])
+	if err != nil || day < 1 || day > 31 {
+		return false
+	}
+	return true
+}
+
+// ImportZoneBIND parses a BIND-format zone file from r via dns.NewZoneParser
+// and replaces (or creates) the zone of the same name, independent of the
+// file-based LoadZone — useful for an HTTP API accepting zone file uploads.
+func (p *AuthoritativePlugin) ImportZoneBIND(origin string, r io.Reader) error {
+	origin = dns.Fqdn(strings.ToLower(origin))
+	zp := dns.NewZoneParser(r, origin, "")
+
+	z := &Zone{
+		Name:    origin,
+		records: make(map[string]map[uint16][]Record),
+	}
+
+	for rr, ok := zp.Next(); ok; rr, ok = zp.Next() {
+		if err := zp.Err(); err != nil {
+			return fmt.Errorf("parsing zone %s: %w", origin, err)
+		}
+		name := dns.Fqdn(strings.ToLower(rr.Header().Name))
+		if _, ok := z.records[name]; !ok {
+			z.records[name] = make(map[uint16][]Record)
+		}
+
+		p.mu.Lock()
+		id := p.nextRecordID
+		p.nextRecordID++
+		p.mu.Unlock()
+
+		z.records[name][rr.Header().Rrtype] = append(z.records[name][rr.Header().Rrtype], Record{ID: id, RR: rr})
+
+		switch v := rr.(type) {
+		case *dns.SOA:
+			z.soa = v
+		case *dns.NS:
+			z.nsRecords = append(z.nsRecords, v)
+		}
+	}
+	if err := zp.Err(); err != nil {
+		return fmt.Errorf("parsing zone %s: %w", origin, err)
+	}
+
+	p.mu.Lock()
+	p.zones[origin] = z
+	p.zoneIndex.insert(z)
+	p.mu.Unlock()
+
+	return p.saveToFile(p.GetZoneDTOs())
+}
@@ -0,0 +1,75 @@
+package authoritative
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExportZoneBINDIncludesSOAAndRecords(t *testing.T) {
+	p := New("") // in-memory
+	p.AddZone("example.com.")
+
+	soaRR, err := dns.NewRR("example.com. 3600 IN SOA ns1.example.com. hostmaster.example.com. 1 7200 3600 1209600 3600")
+	assert.NoError(t, err)
+	_, err = p.AddZoneRecord("example.com.", soaRR)
+	assert.NoError(t, err)
+
+	aRR, err := dns.NewRR("www.example.com. 300 IN A 1.2.3.4")
+	assert.NoError(t, err)
+	_, err = p.AddZoneRecord("example.com.", aRR)
+	assert.NoError(t, err)
+
+	var buf bytes.Buffer
+	assert.NoError(t, p.ExportZoneBIND("example.com.", &buf))
+
+	out := buf.String()
+	assert.Contains(t, out, "$ORIGIN example.com.")
+	assert.Contains(t, out, "$TTL 3600")
+	assert.Contains(t, out, "; serial")
+	assert.Contains(t, out, "www.example.com.")
+}
+
+func TestExportZoneBINDIncrementsSerialByDefault(t *testing.T) {
+	p := New("") // in-memory
+	p.AddZone("example.com.")
+	soaRR, err := dns.NewRR("example.com. 3600 IN SOA ns1.example.com. hostmaster.example.com. 41 7200 3600 1209600 3600")
+	assert.NoError(t, err)
+	_, err = p.AddZoneRecord("example.com.", soaRR)
+	assert.NoError(t, err)
+
+	var buf bytes.Buffer
+	assert.NoError(t, p.ExportZoneBIND("example.com.", &buf))
+	assert.Contains(t, buf.String(), "42\t; serial")
+}
+
+func TestLooksDateEncoded(t *testing.T) {
+	assert.True(t, looksDateEncoded(2024031501))
+	assert.False(t, looksDateEncoded(41))
+	assert.False(t, looksDateEncoded(999999999))
+}
+
+func TestImportZoneBINDRoundTrip(t *testing.T) {
+	p := New("") // in-memory
+	zoneText := `$ORIGIN example.org.
+$TTL 300
+example.org. 300 IN SOA ns1.example.org. hostmaster.example.org. 2024031501 7200 3600 1209600 300
+example.org. 300 IN NS ns1.example.org.
+www.example.org. 300 IN A 5.6.7.8
+`
+	assert.NoError(t, p.ImportZoneBIND("example.org.", strings.NewReader(zoneText)))
+
+	records, err := p.GetZoneRecords("example.org.")
+	assert.NoError(t, err)
+
+	var sawA bool
+	for _, r := range records {
+		if r.RR.Header().Rrtype == dns.TypeA {
+			sawA = true
+		}
+	}
+	assert.True(t, sawA)
+}
@@ -0,0 +1,449 @@
+package authoritative
+
+// Online DNSSEC signing for authoritative zones.
+// - Per-zone KSK/ZSK pairs loaded from disk, with RFC 5011-style rollover
+//   state persisted alongside the zones JSON.
+// - RRSIGs are synthesized on the fly per RRset and cached in a
+//   SignatureCache keyed on a stable hash of the canonical RRset wire form.
+// - NSEC synthesis covers NXDOMAIN/NODATA denial of existence.
+
+import (
+	"crypto"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+
+	"github.com/miekg/dns"
+)
+
+// signInceptionSkew and signExpirationWindow tolerate clock skew between
+// signer and validator while keeping RRSIGs reasonably short-lived.
+const (
+	signInceptionSkew    = 3 * time.Hour
+	signExpirationWindow = 7 * 24 * time.Hour
+	// signatureRevalidateWindow: cached RRSIGs are reused as long as they
+	// still have at least this much validity left.
+	signatureRevalidateWindow = 24 * time.Hour
+)
+
+// DNSSECKeyState is the on-disk representation of a zone's signing keys,
+// persisted next to the zones JSON so key material and rollover state
+// survive restarts.
+type DNSSECKeyState struct {
+	Zone string     `json:"zone"`
+	KSK  *DNSSECKey `json:"ksk"`
+	ZSK  *DNSSECKey `json:"zsk"`
+	// RolloverState tracks RFC 5011-style key rollover: the previous ZSK is
+	// kept around (but not used for new signatures) until its DS/DNSKEY has
+	// had time to propagate.
+	PendingZSK   *DNSSECKey `json:"pending_zsk,omitempty"`
+	RolloverTime time.Time  `json:"rollover_time,omitempty"`
+	// NSEC3 is set once EnableNSEC3 has been called for the zone, so the
+	// hashed chain parameters survive a restart alongside the keys.
+	NSEC3 *NSEC3Params `json:"nsec3,omitempty"`
+}
+
+// DNSSECKey holds a single key pair plus the DNSKEY metadata needed to
+// reconstruct it.
+type DNSSECKey struct {
+	Algorithm  uint8  `json:"algorithm"`
+	Flags      uint16 `json:"flags"`
+	PublicKey  string `json:"public_key"`
+	PrivateKey string `json:"private_key"`
+
+	dnskey *dns.DNSKEY
+	signer crypto.Signer
+}
+
+// SignatureCacheItem is a cached RRSIG for a given RRset.
+type SignatureCacheItem struct {
+	RRSIG      *dns.RRSIG
+	Expiration time.Time
+}
+
+// SignatureCache is a sibling of cache.RRsetCache: a simple thread-safe map
+// keyed by a stable hash of the sorted canonical RRset wire form, avoiding
+// repeated expensive signing operations for the same RRset.
+type SignatureCache struct {
+	mu    sync.RWMutex
+	items map[string]*SignatureCacheItem
+	group singleflight.Group
+}
+
+// NewSignatureCache creates an empty SignatureCache.
+func NewSignatureCache() *SignatureCache {
+	return &SignatureCache{items: make(map[string]*SignatureCacheItem)}
+}
+
+// Get returns a cached RRSIG if present and still valid for at least
+// signatureRevalidateWindow.
+func (c *SignatureCache) Get(key string) (*dns.RRSIG, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	item, ok := c.items[key]
+	if !ok {
+		return nil, false
+	}
+	if time.Until(item.Expiration) < signatureRevalidateWindow {
+		return nil, false
+	}
+	return item.RRSIG, true
+}
+
+// Set stores a freshly computed RRSIG.
+func (c *SignatureCache) Set(key string, rrsig *dns.RRSIG, expiration time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.items[key] = &SignatureCacheItem{RRSIG: rrsig, Expiration: expiration}
+}
+
+// rrsetCacheKey builds a stable hash key from the sorted canonical wire form
+// of an RRset plus the signing key tag, so that the same RRset always maps
+// to the same cache entry regardless of answer ordering.
+func rrsetCacheKey(zone string, keyTag uint16, rrset []dns.RR) string {
+	sorted := make([]dns.RR, len(rrset))
+	copy(sorted, rrset)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].String() < sorted[j].String()
+	})
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s|%d|", zone, keyTag)
+	for _, rr := range sorted {
+		b.WriteString(rr.String())
+		b.WriteByte('\n')
+	}
+	return b.String()
+}
+
+// loadOrCreateKeyState loads the key state for a zone from
+// "<zonesFile>.dnssec/<zone>.json", generating a fresh KSK/ZSK pair (ECDSA
+// P-256, algorithm 13) if none exists yet.
+func loadOrCreateKeyState(zonesFilePath, zone string) (*DNSSECKeyState, error) {
+	path := keyStatePath(zonesFilePath, zone)
+
+	if data, err := os.ReadFile(path); err == nil {
+		var st DNSSECKeyState
+		if err := json.Unmarshal(data, &st); err != nil {
+			return nil, fmt.Errorf("parsing dnssec key state for %s: %w", zone, err)
+		}
+		if err := st.KSK.load(); err != nil {
+			return nil, err
+		}
+		if err := st.ZSK.load(); err != nil {
+			return nil, err
+		}
+		return &st, nil
+	}
+
+	ksk, err := newECDSAKey(dns.ECDSAP256SHA256, zone, true)
+	if err != nil {
+		return nil, err
+	}
+	zsk, err := newECDSAKey(dns.ECDSAP256SHA256, zone, false)
+	if err != nil {
+		return nil, err
+	}
+	st := &DNSSECKeyState{Zone: zone, KSK: ksk, ZSK: zsk}
+	if path != "" {
+		if err := st.save(path); err != nil {
+			return nil, err
+		}
+	}
+	return st, nil
+}
+
+func keyStatePath(zonesFilePath, zone string) string {
+	if zonesFilePath == "" {
+		return ""
+	}
+	dir := filepath.Join(filepath.Dir(zonesFilePath), "dnssec")
+	_ = os.MkdirAll(dir, 0755)
+	return filepath.Join(dir, strings.TrimSuffix(zone, ".")+".json")
+}
+
+func (st *DNSSECKeyState) save(path string) error {
+	data, err := json.MarshalIndent(st, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0600)
+}
+
+func newECDSAKey(algo uint8, zone string, isKSK bool) (*DNSSECKey, error) {
+	flags := uint16(256)
+	if isKSK {
+		flags = 257
+	}
+	dnskey := &dns.DNSKEY{
+		Hdr:       dns.RR_Header{Name: dns.Fqdn(zone), Rrtype: dns.TypeDNSKEY, Class: dns.ClassINET},
+		Flags:     flags,
+		Protocol:  3,
+		Algorithm: algo,
+	}
+	priv, err := dnskey.Generate(256)
+	if err != nil {
+		return nil, fmt.Errorf("generating dnssec key for %s: %w", zone, err)
+	}
+	signer := priv.(crypto.Signer)
+
+	k := &DNSSECKey{
+		Algorithm:  algo,
+		Flags:      flags,
+		PublicKey:  dnskey.PublicKey,
+		PrivateKey: privateKeyToString(dnskey, priv),
+		dnskey:     dnskey,
+		signer:     signer,
+	}
+	return k, nil
+}
+
+// load reconstructs the in-memory signer/dnskey from the persisted key
+// material, used when a key state JSON is read back from disk.
+func (k *DNSSECKey) load() error {
+	if k == nil {
+		return nil
+	}
+	dnskey := &dns.DNSKEY{
+		Hdr:       dns.RR_Header{Rrtype: dns.TypeDNSKEY, Class: dns.ClassINET},
+		Flags:     k.Flags,
+		Protocol:  3,
+		Algorithm: k.Algorithm,
+		PublicKey: k.PublicKey,
+	}
+	signer, err := privateKeyFromString(dnskey, k.PrivateKey)
+	if err != nil {
+		return err
+	}
+	k.dnskey = dnskey
+	k.signer = signer
+	return nil
+}
+
+// DNSKEYRR returns the DNSKEY RR for this key, scoped to the given zone apex.
+func (k *DNSSECKey) DNSKEYRR(zone string, ttl uint32) *dns.DNSKEY {
+	dnskey := &dns.DNSKEY{
+		Hdr:       dns.RR_Header{Name: dns.Fqdn(zone), Rrtype: dns.TypeDNSKEY, Class: dns.ClassINET, Ttl: ttl},
+		Flags:     k.Flags,
+		Protocol:  3,
+		Algorithm: k.Algorithm,
+		PublicKey: k.PublicKey,
+	}
+	return dnskey
+}
+
+// signRRset signs the given RRset with this key, returning a fresh RRSIG
+// with inception ~now-3h and expiration ~now+7d (see signInceptionSkew and
+// signExpirationWindow).
+func (k *DNSSECKey) signRRset(zone string, rrset []dns.RR, origTTL uint32, now time.Time) (*dns.RRSIG, error) {
+	dnskey := k.DNSKEYRR(zone, 0)
+	rrsig := &dns.RRSIG{
+		Hdr:         dns.RR_Header{Name: rrset[0].Header().Name, Rrtype: dns.TypeRRSIG, Class: dns.ClassINET, Ttl: rrset[0].Header().Ttl},
+		TypeCovered: rrset[0].Header().Rrtype,
+		Algorithm:   k.Algorithm,
+		Labels:      uint8(dns.CountLabel(rrset[0].Header().Name)),
+		OrigTtl:     origTTL,
+		Expiration:  uint32(now.Add(signExpirationWindow).Unix()),
+		Inception:   uint32(now.Add(-signInceptionSkew).Unix()),
+		KeyTag:      dnskey.KeyTag(),
+		SignerName:  dns.Fqdn(zone),
+	}
+	if err := rrsig.Sign(k.signer, rrset); err != nil {
+		return nil, fmt.Errorf("signing rrset %s/%d: %w", rrset[0].Header().Name, rrset[0].Header().Rrtype, err)
+	}
+	return rrsig, nil
+}
+
+// SignRRset signs rrset (all of the same owner/type/class) using the zone's
+// ZSK, serving a cached RRSIG when one is still valid for at least
+// signatureRevalidateWindow. Concurrent requests for the same key are
+// deduplicated via singleflight to avoid thundering-herd on the private key
+// operation.
+func (z *Zone) SignRRset(rrset []dns.RR) (*dns.RRSIG, error) {
+	if z.dnssec == nil || z.dnssec.ZSK == nil || len(rrset) == 0 {
+		return nil, fmt.Errorf("zone %s is not dnssec-signed", z.Name)
+	}
+
+	origTTL := rrset[0].Header().Ttl
+	// TXT RRSIGs carry a zeroed OrigTTL to avoid leaking TTL decrementing
+	// information some resolvers rely on for TXT-based anti-abuse checks.
+	if rrset[0].Header().Rrtype == dns.TypeTXT {
+		origTTL = 0
+	}
+
+	key := rrsetCacheKey(z.Name, z.dnssec.ZSK.dnskey.KeyTag(), rrset)
+	if z.sigCache != nil {
+		if cached, ok := z.sigCache.Get(key); ok {
+			return cached, nil
+		}
+	}
+
+	v, err, _ := z.sigCache.group.Do(key, func() (interface{}, error) {
+		if cached, ok := z.sigCache.Get(key); ok {
+			return cached, nil
+		}
+		rrsig, err := z.dnssec.ZSK.signRRset(z.Name, rrset, origTTL, time.Now())
+		if err != nil {
+			return nil, err
+		}
+		z.sigCache.Set(key, rrsig, time.Unix(int64(rrsig.Expiration), 0))
+		return rrsig, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return v.(*dns.RRSIG), nil
+}
+
+// signSection groups rrs by owner/type/class and appends an RRSIG after each
+// RRset, skipping existing RRSIG/OPT records and any owner outside the zone.
+func (p *AuthoritativePlugin) signSection(z *Zone, rrs []dns.RR) []dns.RR {
+	if z.dnssec == nil {
+		return rrs
+	}
+
+	type rrsetKey struct {
+		name  string
+		rtype uint16
+	}
+	order := make([]rrsetKey, 0, len(rrs))
+	grouped := make(map[rrsetKey][]dns.RR)
+	for _, rr := range rrs {
+		h := rr.Header()
+		if h.Rrtype == dns.TypeRRSIG || h.Rrtype == dns.TypeOPT {
+			continue
+		}
+		if !dns.IsSubDomain(z.Name, h.Name) {
+			continue
+		}
+		k := rrsetKey{name: strings.ToLower(h.Name), rtype: h.Rrtype}
+		if _, ok := grouped[k]; !ok {
+			order = append(order, k)
+		}
+		grouped[k] = append(grouped[k], rr)
+	}
+
+	out := make([]dns.RR, 0, len(rrs))
+	out = append(out, rrs...)
+	for _, k := range order {
+		rrsig, err := z.SignRRset(grouped[k])
+		if err != nil {
+			log.Printf("[%s] dnssec: %v", p.Name(), err)
+			continue
+		}
+		out = append(out, rrsig)
+	}
+	return out
+}
+
+// addDNSSECToResponse signs the Answer, Authority, and Extra sections in
+// place and attaches DNSKEY records at the apex when the apex is queried.
+func (p *AuthoritativePlugin) addDNSSECToResponse(res *dns.Msg, z *Zone) {
+	if z.dnssec == nil {
+		return
+	}
+	res.Answer = p.signSection(z, res.Answer)
+	res.Ns = p.signSection(z, res.Ns)
+	res.Extra = p.signSection(z, res.Extra)
+}
+
+// dnskeyRRset returns the DNSKEY RRset (KSK + ZSK, plus a pending ZSK during
+// rollover) for the zone apex.
+func (z *Zone) dnskeyRRset(ttl uint32) []dns.RR {
+	if z.dnssec == nil {
+		return nil
+	}
+	var out []dns.RR
+	if z.dnssec.KSK != nil {
+		out = append(out, z.dnssec.KSK.DNSKEYRR(z.Name, ttl))
+	}
+	if z.dnssec.ZSK != nil {
+		out = append(out, z.dnssec.ZSK.DNSKEYRR(z.Name, ttl))
+	}
+	if z.dnssec.PendingZSK != nil {
+		out = append(out, z.dnssec.PendingZSK.DNSKEYRR(z.Name, ttl))
+	}
+	return out
+}
+
+// EnableDNSSEC marks a zone as DNSSEC-signed, loading or generating its
+// KSK/ZSK pair and wiring up the shared SignatureCache.
+func (p *AuthoritativePlugin) EnableDNSSEC(zoneName string) error {
+	zn := dns.Fqdn(strings.ToLower(zoneName))
+	p.mu.RLock()
+	z, ok := p.zones[zn]
+	p.mu.RUnlock()
+	if !ok {
+		return fmt.Errorf("zone not found: %s", zoneName)
+	}
+
+	st, err := loadOrCreateKeyState(p.filePath, zn)
+	if err != nil {
+		return err
+	}
+
+	z.mu.Lock()
+	z.dnssec = st
+	if p.sigCache == nil {
+		p.sigCache = NewSignatureCache()
+	}
+	z.sigCache = p.sigCache
+	if st.NSEC3 != nil {
+		z.nsec3 = st.NSEC3
+		z.buildNSEC3Chain()
+	}
+	ttl := uint32(3600)
+	if z.soa != nil {
+		ttl = z.soa.Header().Ttl
+	}
+	apex := dns.Fqdn(zn)
+	if _, ok := z.records[apex]; !ok {
+		z.records[apex] = make(map[uint16][]Record)
+	}
+	var dnskeys []Record
+	for _, rr := range z.dnskeyRRset(ttl) {
+		dnskeys = append(dnskeys, Record{ID: p.nextID(), RR: rr})
+	}
+	z.records[apex][dns.TypeDNSKEY] = dnskeys
+	z.mu.Unlock()
+
+	log.Printf("[%s] DNSSEC enabled for zone %s", p.Name(), zn)
+	return p.saveToFile(p.GetZoneDTOs())
+}
+
+func (p *AuthoritativePlugin) nextID() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	id := p.nextRecordID
+	p.nextRecordID++
+	return id
+}
+
+// IsDNSSECSigned reports whether a zone has DNSSEC signing enabled.
+func (p *AuthoritativePlugin) IsDNSSECSigned(zoneName string) bool {
+	zn := dns.Fqdn(strings.ToLower(zoneName))
+	p.mu.RLock()
+	z, ok := p.zones[zn]
+	p.mu.RUnlock()
+	if !ok {
+		return false
+	}
+	z.mu.RLock()
+	defer z.mu.RUnlock()
+	return z.dnssec != nil
+}
+
+// doRequested reports whether the query requested DNSSEC records (DO bit).
+func doRequested(msg *dns.Msg) bool {
+	if opt := msg.IsEdns0(); opt != nil {
+		return opt.Do()
+	}
+	return false
+}
@@ -0,0 +1,29 @@
+package authoritative
+
+// Private-key persistence for the online signer in dnssec.go. Keys are
+// stored on disk in miekg/dns's own BIND-style private key format so they
+// round-trip through dns.DNSKEY.NewPrivateKey/PrivateKeyString without any
+// bespoke encoding.
+
+import (
+	"crypto"
+	"fmt"
+
+	"github.com/miekg/dns"
+)
+
+func privateKeyToString(dnskey *dns.DNSKEY, priv crypto.PrivateKey) string {
+	return dnskey.PrivateKeyString(priv)
+}
+
+func privateKeyFromString(dnskey *dns.DNSKEY, s string) (crypto.Signer, error) {
+	priv, err := dnskey.NewPrivateKey(s)
+	if err != nil {
+		return nil, fmt.Errorf("parsing dnssec private key: %w", err)
+	}
+	signer, ok := priv.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("dnssec private key does not implement crypto.Signer")
+	}
+	return signer, nil
+}
@@ -0,0 +1,95 @@
+package authoritative
+
+import (
+	"testing"
+
+	"dns-resolver/internal/plugins"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDNSSECSignedApexQueryDO(t *testing.T) {
+	p := New("") // In-memory
+	p.AddZone("example.com.")
+
+	nsRR, err := dns.NewRR("example.com. 3600 IN NS ns1.example.com.")
+	assert.NoError(t, err)
+	_, err = p.AddZoneRecord("example.com.", nsRR)
+	assert.NoError(t, err)
+
+	assert.NoError(t, p.EnableDNSSEC("example.com."))
+
+	w := &completeMockResponseWriter{}
+	req := new(dns.Msg)
+	req.SetQuestion("example.com.", dns.TypeNS)
+	req.SetEdns0(4096, true) // DO=1
+
+	ctx := &plugins.PluginContext{ResponseWriter: w}
+	assert.NoError(t, p.Execute(ctx, req))
+
+	assert.Equal(t, 1, len(w.writtenMsgs))
+	res := w.writtenMsgs[0]
+
+	var sawRRSIG bool
+	for _, rr := range res.Answer {
+		if rr.Header().Rrtype == dns.TypeRRSIG {
+			sawRRSIG = true
+		}
+	}
+	assert.True(t, sawRRSIG, "DO=1 NS query should carry an RRSIG over the NS RRset")
+}
+
+func TestDNSSECUnsignedWithoutDO(t *testing.T) {
+	p := New("") // In-memory
+	p.AddZone("example.com.")
+
+	nsRR, err := dns.NewRR("example.com. 3600 IN NS ns1.example.com.")
+	assert.NoError(t, err)
+	_, err = p.AddZoneRecord("example.com.", nsRR)
+	assert.NoError(t, err)
+
+	assert.NoError(t, p.EnableDNSSEC("example.com."))
+
+	w := &completeMockResponseWriter{}
+	req := new(dns.Msg)
+	req.SetQuestion("example.com.", dns.TypeNS) // no EDNS0, DO=0
+
+	ctx := &plugins.PluginContext{ResponseWriter: w}
+	assert.NoError(t, p.Execute(ctx, req))
+
+	res := w.writtenMsgs[0]
+	for _, rr := range res.Answer {
+		assert.NotEqual(t, dns.TypeRRSIG, rr.Header().Rrtype, "DO=0 responses must not carry RRSIGs")
+	}
+}
+
+func TestDNSSECNXDomainHasNSEC(t *testing.T) {
+	p := New("") // In-memory
+	p.AddZone("example.com.")
+
+	nsRR, err := dns.NewRR("example.com. 3600 IN NS ns1.example.com.")
+	assert.NoError(t, err)
+	_, err = p.AddZoneRecord("example.com.", nsRR)
+	assert.NoError(t, err)
+
+	assert.NoError(t, p.EnableDNSSEC("example.com."))
+
+	w := &completeMockResponseWriter{}
+	req := new(dns.Msg)
+	req.SetQuestion("nosuchname.example.com.", dns.TypeA)
+	req.SetEdns0(4096, true)
+
+	ctx := &plugins.PluginContext{ResponseWriter: w}
+	assert.NoError(t, p.Execute(ctx, req))
+
+	res := w.writtenMsgs[0]
+	assert.Equal(t, dns.RcodeNameError, res.Rcode)
+
+	var sawNSEC bool
+	for _, rr := range res.Ns {
+		if rr.Header().Rrtype == dns.TypeNSEC {
+			sawNSEC = true
+		}
+	}
+	assert.True(t, sawNSEC, "signed NXDOMAIN responses should include an NSEC proof")
+}
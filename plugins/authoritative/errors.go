@@ -0,0 +1,39 @@
+package authoritative
+
+import "errors"
+
+// Sentinel errors returned by the notify/transfer path, wrapped via
+// fmt.Errorf("%w", ...) so callers can errors.Is/errors.As their way to a
+// policy decision (skip this slave vs. abort the whole NOTIFY round)
+// instead of matching on log strings.
+var (
+	// ErrUnknownSlave is returned when a zone's slave NS name can't be
+	// resolved to any address, neither via in-zone glue nor the
+	// configured IPResolver.
+	ErrUnknownSlave = errors.New("authoritative: slave server could not be resolved")
+
+	// ErrInvalidGlue is returned when a provider's glue lookup for a
+	// slave NS fails or returns records that don't resolve to a usable
+	// address.
+	ErrInvalidGlue = errors.New("authoritative: invalid or missing glue records")
+
+	// ErrNotifyRefused is returned when a slave's response to an
+	// outbound NOTIFY carries a non-success Rcode.
+	ErrNotifyRefused = errors.New("authoritative: NOTIFY refused by slave")
+
+	// ErrTSIGFailure is returned when a transfer request or response
+	// fails TSIG verification.
+	ErrTSIGFailure = errors.New("authoritative: TSIG verification failed")
+
+	// ErrNotAuthoritative is returned by Exchange when the query name
+	// falls outside every zone this plugin holds, so a caller using it as
+	// a Backend (e.g. the "multi" backend) knows to try its fallback
+	// instead of treating an empty answer as NXDOMAIN.
+	ErrNotAuthoritative = errors.New("authoritative: no zone configured for this query name")
+
+	// ErrTransferNotSupported is returned by Exchange for AXFR/IXFR
+	// queries, which stream multiple envelopes over the original
+	// connection and don't fit interfaces.Backend's single-message
+	// Exchange; transfers still work over the usual plugin chain path.
+	ErrTransferNotSupported = errors.New("authoritative: zone transfers are not supported through Exchange")
+)
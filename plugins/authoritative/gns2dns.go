@@ -0,0 +1,190 @@
+package authoritative
+
+// GNS2DNS delegation lets a zone hand a subtree off to an external naming
+// system (GNUnet's GNS, or any other namespace reachable over plain DNS) by
+// storing (name, dns-server) pairs instead of ordinary records, the way
+// PowerDNS's GNS2DNS pseudo-record does. A query that hits one is resolved
+// by querying the referenced server(s) for the delegated name, and the
+// answer is spliced back into the response under the original QNAME - the
+// same trick followCname already uses to splice a CNAME target's records
+// in under a different owner, just reaching outside this server's own
+// zones.
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// TypeGNS2DNS is the private-use (RFC 6895 section 3.1) RR type code
+// GNS2DNS records are registered under.
+const TypeGNS2DNS = 0xFF01
+
+// maxGNS2DNSDepth bounds how many GNS2DNS hops a single query follows,
+// guarding against a delegation loop (e.g. two zones delegating to each
+// other).
+const maxGNS2DNSDepth = 5
+
+func init() {
+	dns.PrivateHandle("GNS2DNS", TypeGNS2DNS, newGNS2DNSRdata)
+}
+
+// GNS2DNSRdata is a (name, dns-server...) pair: Name is resolved against
+// each of Servers (host or host:port, ":53" assumed when no port is given)
+// in turn, in place of the record's own owner name. Zone file syntax is
+// "owner GNS2DNS name dns-server [dns-server ...]".
+type GNS2DNSRdata struct {
+	Name    string
+	Servers []string
+}
+
+func newGNS2DNSRdata() dns.PrivateRdata { return new(GNS2DNSRdata) }
+
+func (rd *GNS2DNSRdata) String() string {
+	return rd.Name + " " + strings.Join(rd.Servers, " ")
+}
+
+func (rd *GNS2DNSRdata) Parse(txt []string) error {
+	if len(txt) < 2 {
+		return fmt.Errorf("GNS2DNS record requires a delegated name and at least one dns-server")
+	}
+	rd.Name = dns.Fqdn(txt[0])
+	rd.Servers = append([]string(nil), txt[1:]...)
+	return nil
+}
+
+func (rd *GNS2DNSRdata) Pack(buf []byte) (int, error) {
+	data := []byte(rd.String())
+	n := copy(buf, data)
+	if n != len(data) {
+		return n, dns.ErrBuf
+	}
+	return n, nil
+}
+
+func (rd *GNS2DNSRdata) Unpack(buf []byte) (int, error) {
+	fields := strings.Fields(string(buf))
+	if len(fields) < 2 {
+		return 0, fmt.Errorf("invalid GNS2DNS rdata")
+	}
+	rd.Name = dns.Fqdn(fields[0])
+	rd.Servers = fields[1:]
+	return len(buf), nil
+}
+
+func (rd *GNS2DNSRdata) Copy(dest dns.PrivateRdata) error {
+	d, ok := dest.(*GNS2DNSRdata)
+	if !ok {
+		return fmt.Errorf("GNS2DNSRdata.Copy: destination is %T, not *GNS2DNSRdata", dest)
+	}
+	d.Name = rd.Name
+	d.Servers = append([]string(nil), rd.Servers...)
+	return nil
+}
+
+func (rd *GNS2DNSRdata) Len() int { return len(rd.String()) }
+
+// gns2dnsRdata unwraps rr's GNS2DNS payload, if rr is one.
+func gns2dnsRdata(rr dns.RR) (*GNS2DNSRdata, bool) {
+	priv, ok := rr.(*dns.PrivateRR)
+	if !ok {
+		return nil, false
+	}
+	rdata, ok := priv.Data.(*GNS2DNSRdata)
+	return rdata, ok
+}
+
+// GNS2DNSResolver exchanges a query with a specific upstream server. It's
+// satisfied by an adapter over the server's own resolver (e.g. the
+// "iterative" backend), letting resolveGNS2DNS reuse whatever
+// caching/transport policy that resolver applies instead of a bare
+// dns.Client.Exchange; see SetGNS2DNSResolver.
+type GNS2DNSResolver interface {
+	Exchange(ctx context.Context, m *dns.Msg, server string) (*dns.Msg, error)
+}
+
+// SetGNS2DNSResolver installs r as the resolver GNS2DNS delegation queries
+// its referenced servers through. Passing nil restores the default
+// dns.Client.Exchange behavior.
+func (p *AuthoritativePlugin) SetGNS2DNSResolver(r GNS2DNSResolver) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.gns2dnsResolver = r
+}
+
+// exchangeGNS2DNS sends m to server via the configured GNS2DNSResolver,
+// falling back to a plain dns.Client.Exchange when none has been set.
+func (p *AuthoritativePlugin) exchangeGNS2DNS(ctx context.Context, m *dns.Msg, server string) (*dns.Msg, error) {
+	p.mu.RLock()
+	r := p.gns2dnsResolver
+	p.mu.RUnlock()
+	if r != nil {
+		return r.Exchange(ctx, m, server)
+	}
+	if _, _, err := net.SplitHostPort(server); err != nil {
+		server = net.JoinHostPort(server, "53")
+	}
+	client := &dns.Client{Timeout: 5 * time.Second}
+	resp, _, err := client.Exchange(m, server)
+	return resp, err
+}
+
+// resolveGNS2DNS follows a GNS2DNS delegation record: it queries rdata's
+// referenced servers in turn for rdata.Name/q.Qtype, and on the first
+// successful answer splices the returned records into res.Answer with
+// their owner rewritten to q.Name, the name that was actually queried.
+// depth bounds recursion - a delegated answer that is itself a GNS2DNS
+// record in one of this server's own zones chains one more hop, up to
+// maxGNS2DNSDepth - the same loop guard followCname applies to CNAMEs.
+func (p *AuthoritativePlugin) resolveGNS2DNS(res *dns.Msg, q dns.Question, rdata *GNS2DNSRdata, depth int) {
+	if depth >= maxGNS2DNSDepth || rdata == nil || len(rdata.Servers) == 0 {
+		return
+	}
+
+	query := new(dns.Msg)
+	query.SetQuestion(rdata.Name, q.Qtype)
+	query.RecursionDesired = true
+
+	ctx := context.Background()
+	for _, server := range rdata.Servers {
+		resp, err := p.exchangeGNS2DNS(ctx, query, server)
+		if err != nil || resp == nil || resp.Rcode != dns.RcodeSuccess {
+			continue
+		}
+		for _, rr := range resp.Answer {
+			spliced := dns.Copy(rr)
+			spliced.Header().Name = q.Name
+			res.Answer = append(res.Answer, spliced)
+			p.chainGNS2DNS(res, q, rr.Header().Name, depth)
+		}
+		return
+	}
+}
+
+// chainGNS2DNS follows one more GNS2DNS hop when name is itself delegated
+// within one of this server's own zones, e.g. a zone re-exporting another
+// zone's delegation under a different name.
+func (p *AuthoritativePlugin) chainGNS2DNS(res *dns.Msg, q dns.Question, name string, depth int) {
+	next, ok := p.findZone(name)
+	if !ok {
+		return
+	}
+	nextName := dns.Fqdn(strings.ToLower(name))
+	next.mu.RLock()
+	recs, exists := next.records[nextName]
+	next.mu.RUnlock()
+	if !exists {
+		return
+	}
+	gnsRecs, ok := recs[TypeGNS2DNS]
+	if !ok || len(gnsRecs) == 0 {
+		return
+	}
+	if rdata, ok := gns2dnsRdata(gnsRecs[0].RR); ok {
+		p.resolveGNS2DNS(res, q, rdata, depth+1)
+	}
+}
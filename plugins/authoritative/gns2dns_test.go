@@ -0,0 +1,73 @@
+package authoritative
+
+import (
+	"context"
+	"testing"
+
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// stubGNS2DNSResolver answers with a fixed response regardless of server,
+// so resolveGNS2DNS can be tested without a real network round trip.
+type stubGNS2DNSResolver struct {
+	resp *dns.Msg
+}
+
+func (s *stubGNS2DNSResolver) Exchange(ctx context.Context, m *dns.Msg, server string) (*dns.Msg, error) {
+	resp := s.resp.Copy()
+	resp.Id = m.Id
+	return resp, nil
+}
+
+func TestGNS2DNSRdataParsesZoneFileSyntax(t *testing.T) {
+	rr, err := dns.NewRR("delegated.example.com. 300 IN GNS2DNS target.example.net. 192.0.2.1 192.0.2.2")
+	require.NoError(t, err)
+
+	rdata, ok := gns2dnsRdata(rr)
+	require.True(t, ok)
+	assert.Equal(t, "target.example.net.", rdata.Name)
+	assert.Equal(t, []string{"192.0.2.1", "192.0.2.2"}, rdata.Servers)
+}
+
+func TestResolveGNS2DNSSplicesAnswerUnderOriginalQName(t *testing.T) {
+	p := New("") // in-memory
+	require.NoError(t, p.AddZone("example.com."))
+
+	delegated, err := dns.NewRR("delegated.example.com. 300 IN GNS2DNS target.example.net. 192.0.2.1")
+	require.NoError(t, err)
+	_, err = p.AddZoneRecord("example.com.", delegated)
+	require.NoError(t, err)
+
+	answer, err := dns.NewRR("target.example.net. 300 IN A 198.51.100.7")
+	require.NoError(t, err)
+	stubResp := new(dns.Msg)
+	stubResp.Answer = []dns.RR{answer}
+	p.SetGNS2DNSResolver(&stubGNS2DNSResolver{resp: stubResp})
+
+	res := new(dns.Msg)
+	q := dns.Question{Name: "delegated.example.com.", Qtype: dns.TypeA, Qclass: dns.ClassINET}
+	rdata, ok := gns2dnsRdata(delegated)
+	require.True(t, ok)
+
+	p.resolveGNS2DNS(res, q, rdata, 0)
+
+	require.Len(t, res.Answer, 1)
+	a, ok := res.Answer[0].(*dns.A)
+	require.True(t, ok)
+	assert.Equal(t, "delegated.example.com.", a.Header().Name)
+	assert.Equal(t, "198.51.100.7", a.A.String())
+}
+
+func TestResolveGNS2DNSStopsAtMaxDepth(t *testing.T) {
+	p := New("")
+	res := new(dns.Msg)
+	q := dns.Question{Name: "loop.example.com.", Qtype: dns.TypeA, Qclass: dns.ClassINET}
+	rdata := &GNS2DNSRdata{Name: "loop.example.net.", Servers: []string{"192.0.2.1"}}
+
+	p.SetGNS2DNSResolver(&stubGNS2DNSResolver{resp: new(dns.Msg)})
+	p.resolveGNS2DNS(res, q, rdata, maxGNS2DNSDepth)
+
+	assert.Empty(t, res.Answer)
+}
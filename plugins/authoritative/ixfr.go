@@ -0,0 +1,253 @@
+package authoritative
+
+// Incremental zone transfer (RFC 1995). The client's current serial rides
+// in the SOA carried in the query's Authority section; if the journal
+// (journal.go) has a contiguous run of diffs from that serial to the
+// zone's current one, we stream just those, otherwise we fall back to a
+// full AXFR.
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"dns-resolver/internal/plugins"
+	"github.com/miekg/dns"
+)
+
+// handleIXFR answers an IXFR query per RFC 1995 section 4.
+func (p *AuthoritativePlugin) handleIXFR(ctx *plugins.PluginContext, msg *dns.Msg, zone *Zone) {
+	clientSerial, ok := ixfrClientSerial(msg)
+	if !ok {
+		p.handleAXFR(ctx, msg, zone)
+		return
+	}
+
+	zone.mu.RLock()
+	soa, haveSOA := zone.soa.(*dns.SOA)
+	if !haveSOA {
+		zone.mu.RUnlock()
+		p.handleAXFR(ctx, msg, zone)
+		return
+	}
+	currentSOA := dns.Copy(soa).(*dns.SOA)
+
+	if clientSerial == currentSOA.Serial {
+		zone.mu.RUnlock()
+		p.sendIXFRUpToDate(ctx, msg, zone, currentSOA)
+		return
+	}
+
+	entries, found := zone.diffsSince(clientSerial)
+	// Deep-copy the entries' RRs while still holding the lock; the journal
+	// itself must not be mutated or read concurrently after we unlock.
+	entries = copyJournalEntries(entries)
+	zone.mu.RUnlock()
+
+	if !found {
+		log.Printf("IXFR for zone %s: serial %d not in journal, falling back to AXFR", zone.Name, clientSerial)
+		p.handleAXFR(ctx, msg, zone)
+		return
+	}
+
+	log.Printf("Starting IXFR for zone %s from serial %d", zone.Name, clientSerial)
+	tr := new(dns.Transfer)
+	ch := make(chan *dns.Envelope)
+
+	go func() {
+		defer close(ch)
+		ch <- &dns.Envelope{RR: []dns.RR{currentSOA}}
+		for _, e := range entries {
+			ch <- &dns.Envelope{RR: []dns.RR{soaWithSerial(currentSOA, e.OldSerial)}}
+			for _, rr := range e.Deletions {
+				ch <- &dns.Envelope{RR: []dns.RR{rr}}
+			}
+			ch <- &dns.Envelope{RR: []dns.RR{soaWithSerial(currentSOA, e.NewSerial)}}
+			for _, rr := range e.Additions {
+				ch <- &dns.Envelope{RR: []dns.RR{rr}}
+			}
+		}
+		ch <- &dns.Envelope{RR: []dns.RR{currentSOA}}
+	}()
+
+	if err := tr.Out(ctx.ResponseWriter, msg, ch); err != nil {
+		log.Printf("IXFR transfer failed for zone %s: %v", zone.Name, err)
+	}
+	log.Println("IXFR handler finished for zone:", zone.Name)
+}
+
+// sendIXFRUpToDate answers a serial-equal IXFR with just the current SOA,
+// per RFC 1995 section 4 ("If an IXFR query with the same or newer version
+// number... is received, a single SOA record... is returned").
+func (p *AuthoritativePlugin) sendIXFRUpToDate(ctx *plugins.PluginContext, msg *dns.Msg, zone *Zone, soa *dns.SOA) {
+	tr := new(dns.Transfer)
+	ch := make(chan *dns.Envelope, 1)
+	ch <- &dns.Envelope{RR: []dns.RR{soa}}
+	close(ch)
+	if err := tr.Out(ctx.ResponseWriter, msg, ch); err != nil {
+		log.Printf("IXFR (already current) failed for zone %s: %v", zone.Name, err)
+	}
+}
+
+// ixfrClientSerial extracts the serial the client already has from the SOA
+// carried in the query's Authority section.
+func ixfrClientSerial(msg *dns.Msg) (uint32, bool) {
+	for _, rr := range msg.Ns {
+		if soa, ok := rr.(*dns.SOA); ok {
+			return soa.Serial, true
+		}
+	}
+	return 0, false
+}
+
+// soaWithSerial returns a copy of soa with its serial replaced, used to
+// stamp the interstitial SOAs that delimit each diff in an IXFR stream.
+func soaWithSerial(soa *dns.SOA, serial uint32) *dns.SOA {
+	cp := dns.Copy(soa).(*dns.SOA)
+	cp.Serial = serial
+	return cp
+}
+
+// copyJournalEntries deep-copies the RRs in each entry so they're safe to
+// hand to a background goroutine after the zone lock is released.
+func copyJournalEntries(entries []JournalEntry) []JournalEntry {
+	out := make([]JournalEntry, len(entries))
+	for i, e := range entries {
+		out[i] = JournalEntry{
+			OldSerial: e.OldSerial,
+			NewSerial: e.NewSerial,
+			Deletions: copyRRs(e.Deletions),
+			Additions: copyRRs(e.Additions),
+		}
+	}
+	return out
+}
+
+func copyRRs(rrs []dns.RR) []dns.RR {
+	if len(rrs) == 0 {
+		return nil
+	}
+	out := make([]dns.RR, len(rrs))
+	for i, rr := range rrs {
+		out[i] = dns.Copy(rr)
+	}
+	return out
+}
+
+// applyTransferResult applies the records streamed back by a SOA/IXFR
+// exchange with a master (see refreshFromMaster in notify.go) to zone. A
+// two-record result ("SOA, SOA") means the master had nothing new. A
+// second record that's itself a SOA with a different serial than the
+// first marks an RFC 1995 diff sequence; anything else is a full
+// AXFR-style zone.
+func applyTransferResult(zone *Zone, all []dns.RR) error {
+	if len(all) < 2 {
+		return fmt.Errorf("transfer returned too few records (%d)", len(all))
+	}
+	finalSOA, ok := all[0].(*dns.SOA)
+	if !ok {
+		return fmt.Errorf("transfer did not start with a SOA record")
+	}
+	if len(all) == 2 {
+		return nil // already up to date
+	}
+	if soa2, ok := all[1].(*dns.SOA); ok && soa2.Serial != finalSOA.Serial {
+		return applyIXFRDiffs(zone, all)
+	}
+	return applyFullTransfer(zone, all)
+}
+
+// applyIXFRDiffs replays an RFC 1995 diff sequence: the stream (excluding
+// the leading and trailing copies of the final SOA) is a repetition of
+// [old SOA, deletions..., new SOA, additions...] blocks.
+func applyIXFRDiffs(zone *Zone, all []dns.RR) error {
+	body := all[1 : len(all)-1]
+	zone.mu.Lock()
+	defer zone.mu.Unlock()
+
+	i := 0
+	for i < len(body) {
+		oldSOA, ok := body[i].(*dns.SOA)
+		if !ok {
+			return fmt.Errorf("malformed IXFR diff: expected old SOA at offset %d", i)
+		}
+		_ = oldSOA
+		i++
+		for i < len(body) {
+			if _, isSOA := body[i].(*dns.SOA); isSOA {
+				break
+			}
+			removeRecordFromZone(zone, body[i])
+			i++
+		}
+		if i >= len(body) {
+			return fmt.Errorf("malformed IXFR diff: missing new SOA")
+		}
+		newSOA, ok := body[i].(*dns.SOA)
+		if !ok {
+			return fmt.Errorf("malformed IXFR diff: expected new SOA at offset %d", i)
+		}
+		i++
+		addRecordToZone(zone, newSOA)
+		zone.soa = newSOA
+		for i < len(body) {
+			if soa, isSOA := body[i].(*dns.SOA); isSOA && soa.Serial != newSOA.Serial {
+				break
+			}
+			addRecordToZone(zone, body[i])
+			i++
+		}
+	}
+	return nil
+}
+
+// applyFullTransfer replaces zone's entire content with a streamed
+// AXFR-style record set (leading and trailing SOA included).
+func applyFullTransfer(zone *Zone, all []dns.RR) error {
+	zone.mu.Lock()
+	defer zone.mu.Unlock()
+
+	zone.records = make(map[string]map[uint16][]Record)
+	zone.nsRecords = nil
+	zone.soa = nil
+	for _, rr := range all {
+		addRecordToZone(zone, rr)
+		switch v := rr.(type) {
+		case *dns.SOA:
+			zone.soa = v
+		case *dns.NS:
+			zone.nsRecords = append(zone.nsRecords, v)
+		}
+	}
+	return nil
+}
+
+// addRecordToZone inserts rr into zone's record index. Callers must hold
+// zone.mu for writing.
+func addRecordToZone(zone *Zone, rr dns.RR) {
+	name := dns.Fqdn(strings.ToLower(rr.Header().Name))
+	if _, ok := zone.records[name]; !ok {
+		zone.records[name] = make(map[uint16][]Record)
+	}
+	zone.records[name][rr.Header().Rrtype] = append(zone.records[name][rr.Header().Rrtype], Record{RR: rr})
+}
+
+// removeRecordFromZone deletes the first record at rr's owner/type whose
+// rdata matches rr. Callers must hold zone.mu for writing.
+func removeRecordFromZone(zone *Zone, rr dns.RR) {
+	name := dns.Fqdn(strings.ToLower(rr.Header().Name))
+	types, ok := zone.records[name]
+	if !ok {
+		return
+	}
+	arr := types[rr.Header().Rrtype]
+	for i, rec := range arr {
+		if sameRData(rec.RR, rr) {
+			types[rr.Header().Rrtype] = append(arr[:i], arr[i+1:]...)
+			if rr.Header().Rrtype == dns.TypeNS {
+				zone.removeNSRecordsForName(name)
+			}
+			return
+		}
+	}
+}
@@ -0,0 +1,150 @@
+package authoritative
+
+import (
+	"io"
+	"net"
+	"sync"
+	"testing"
+
+	"dns-resolver/internal/plugins"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+)
+
+// runIXFR drives an IXFR through handleIXFR over a net.Pipe and returns the
+// records carried by every message the client received, in order.
+func runIXFR(t *testing.T, p *AuthoritativePlugin, zone *Zone, req *dns.Msg) []dns.RR {
+	t.Helper()
+	clientConn, serverConn := net.Pipe()
+	w := &completeMockResponseWriter{conn: serverConn}
+	ctx := &plugins.PluginContext{ResponseWriter: w}
+
+	var received []dns.RR
+	var wg sync.WaitGroup
+	wg.Add(2)
+
+	go func() {
+		defer wg.Done()
+		defer serverConn.Close()
+		p.handleIXFR(ctx, req, zone)
+	}()
+
+	go func() {
+		defer wg.Done()
+		defer clientConn.Close()
+		for {
+			lenBuf := make([]byte, 2)
+			if _, err := io.ReadFull(clientConn, lenBuf); err != nil {
+				break
+			}
+			msgLen := int(lenBuf[0])<<8 | int(lenBuf[1])
+			msgBuf := make([]byte, msgLen)
+			_, err := io.ReadFull(clientConn, msgBuf)
+			assert.NoError(t, err)
+			msg := &dns.Msg{}
+			assert.NoError(t, msg.Unpack(msgBuf))
+			received = append(received, msg.Answer...)
+		}
+	}()
+
+	wg.Wait()
+	return received
+}
+
+func ixfrRequest(zone string, clientSerial uint32) *dns.Msg {
+	m := new(dns.Msg)
+	m.SetQuestion(zone, dns.TypeIXFR)
+	m.Ns = []dns.RR{&dns.SOA{
+		Hdr:    dns.RR_Header{Name: zone, Rrtype: dns.TypeSOA, Class: dns.ClassINET},
+		Serial: clientSerial,
+	}}
+	return m
+}
+
+func TestIXFRIntermediateSerialReturnsOnlyDiff(t *testing.T) {
+	p := New("") // in-memory
+	p.AddZone("example.com.")
+
+	soaRR, err := dns.NewRR("example.com. 3600 IN SOA ns1.example.com. admin.example.com. 100 7200 3600 1209600 3600")
+	assert.NoError(t, err)
+	_, err = p.AddZoneRecord("example.com.", soaRR)
+	assert.NoError(t, err)
+
+	aRR, err := dns.NewRR("www.example.com. 300 IN A 1.2.3.4")
+	assert.NoError(t, err)
+	_, err = p.AddZoneRecord("example.com.", aRR) // bumps serial: 100 -> S1
+	assert.NoError(t, err)
+
+	mxRR, err := dns.NewRR("example.com. 600 IN MX 10 mail.example.com.")
+	assert.NoError(t, err)
+	_, err = p.AddZoneRecord("example.com.", mxRR) // bumps serial: S1 -> S2
+	assert.NoError(t, err)
+
+	zone, ok := p.findZone("example.com.")
+	assert.True(t, ok)
+
+	zone.mu.RLock()
+	finalSerial := zone.soa.(*dns.SOA).Serial
+	s1 := zone.journal[0].NewSerial
+	zone.mu.RUnlock()
+
+	records := runIXFR(t, p, zone, ixfrRequest("example.com.", s1))
+
+	// Expect: SOA(final), SOA(s1), MX (the only addition after s1), SOA(final).
+	assert.GreaterOrEqual(t, len(records), 3)
+	firstSOA, ok := records[0].(*dns.SOA)
+	assert.True(t, ok)
+	assert.Equal(t, finalSerial, firstSOA.Serial)
+
+	lastSOA, ok := records[len(records)-1].(*dns.SOA)
+	assert.True(t, ok)
+	assert.Equal(t, finalSerial, lastSOA.Serial)
+
+	var sawA, sawMX bool
+	for _, rr := range records {
+		switch rr.Header().Rrtype {
+		case dns.TypeA:
+			sawA = true
+		case dns.TypeMX:
+			sawMX = true
+		}
+	}
+	assert.False(t, sawA, "the A record added before the requested serial must not be retransmitted")
+	assert.True(t, sawMX, "the MX record added after the requested serial must be in the diff")
+}
+
+func TestIXFRUnknownSerialFallsBackToAXFR(t *testing.T) {
+	p := New("") // in-memory
+	p.AddZone("example.com.")
+
+	soaRR, err := dns.NewRR("example.com. 3600 IN SOA ns1.example.com. admin.example.com. 100 7200 3600 1209600 3600")
+	assert.NoError(t, err)
+	_, err = p.AddZoneRecord("example.com.", soaRR)
+	assert.NoError(t, err)
+
+	aRR, err := dns.NewRR("www.example.com. 300 IN A 1.2.3.4")
+	assert.NoError(t, err)
+	_, err = p.AddZoneRecord("example.com.", aRR)
+	assert.NoError(t, err)
+
+	zone, ok := p.findZone("example.com.")
+	assert.True(t, ok)
+
+	// A serial far outside the journal's range must fall back to a full
+	// AXFR: SOA, every record, SOA.
+	records := runIXFR(t, p, zone, ixfrRequest("example.com.", 1))
+
+	assert.GreaterOrEqual(t, len(records), 3)
+	_, firstIsSOA := records[0].(*dns.SOA)
+	assert.True(t, firstIsSOA)
+	_, lastIsSOA := records[len(records)-1].(*dns.SOA)
+	assert.True(t, lastIsSOA)
+
+	var sawA bool
+	for _, rr := range records {
+		if rr.Header().Rrtype == dns.TypeA {
+			sawA = true
+		}
+	}
+	assert.True(t, sawA, "AXFR fallback should carry the zone's full record set")
+}
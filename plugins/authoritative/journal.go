@@ -0,0 +1,198 @@
+package authoritative
+
+// Per-zone change journal backing incremental zone transfer (RFC 1995).
+// Every CRUD helper and the RFC 2136 UPDATE handler append an entry here
+// whenever they mutate a zone and bump its SOA serial (see
+// authoritative.go and update.go); handleIXFR (ixfr.go) walks the journal
+// to answer IXFR requests without a full AXFR.
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// maxJournalEntries is the default cap on how much diff history a zone
+// keeps when it hasn't been given a per-zone override via
+// SetZoneJournalMax. Once the limit is reached the oldest entry is dropped,
+// which simply means a client requesting a very stale serial falls back to
+// AXFR.
+const maxJournalEntries = 100
+
+// journalMax returns the effective journal cap for the zone: its own
+// override if set via SetZoneJournalMax, otherwise maxJournalEntries.
+// Callers must hold z.mu.
+func (z *Zone) journalMax() int {
+	if z.journalMaxOverride > 0 {
+		return z.journalMaxOverride
+	}
+	return maxJournalEntries
+}
+
+// SetZoneJournalMax overrides the journal size cap for a single zone, e.g.
+// to keep a longer diff history for zones with many slaves performing
+// frequent IXFR. A max of 0 reverts the zone to maxJournalEntries.
+func (p *AuthoritativePlugin) SetZoneJournalMax(zoneName string, max int) error {
+	zn := dns.Fqdn(zoneName)
+	p.mu.RLock()
+	z, ok := p.zones[zn]
+	p.mu.RUnlock()
+	if !ok {
+		return fmt.Errorf("zone not found: %s", zoneName)
+	}
+	z.mu.Lock()
+	z.journalMaxOverride = max
+	z.trimJournal()
+	z.mu.Unlock()
+	return nil
+}
+
+// trimJournal drops the oldest entries past the zone's effective cap.
+// Callers must hold z.mu for writing.
+func (z *Zone) trimJournal() {
+	if max := z.journalMax(); len(z.journal) > max {
+		z.journal = z.journal[len(z.journal)-max:]
+	}
+}
+
+// StartJournalPruner launches a background goroutine that periodically
+// re-enforces every zone's journal cap, which matters after
+// SetZoneJournalMax shrinks a zone's limit below its current journal
+// length. It returns a stop function that halts the pruner.
+func (p *AuthoritativePlugin) StartJournalPruner(interval time.Duration) (stop func()) {
+	done := make(chan struct{})
+	ticker := time.NewTicker(interval)
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				p.pruneJournals()
+			case <-done:
+				return
+			}
+		}
+	}()
+	var once sync.Once
+	return func() { once.Do(func() { close(done) }) }
+}
+
+// pruneJournals trims every zone's journal to its effective cap.
+func (p *AuthoritativePlugin) pruneJournals() {
+	p.mu.RLock()
+	zones := make([]*Zone, 0, len(p.zones))
+	for _, z := range p.zones {
+		zones = append(zones, z)
+	}
+	p.mu.RUnlock()
+
+	for _, z := range zones {
+		z.mu.Lock()
+		z.trimJournal()
+		z.mu.Unlock()
+	}
+}
+
+// JournalEntry records one serial transition: the RRs removed and added to
+// go from OldSerial to NewSerial.
+type JournalEntry struct {
+	OldSerial uint32
+	NewSerial uint32
+	Deletions []dns.RR
+	Additions []dns.RR
+}
+
+// JournalEntryDTO is the serializable form of a JournalEntry.
+type JournalEntryDTO struct {
+	OldSerial uint32   `json:"old_serial"`
+	NewSerial uint32   `json:"new_serial"`
+	Deletions []string `json:"deletions,omitempty"`
+	Additions []string `json:"additions,omitempty"`
+}
+
+// appendJournal records a diff, trimming the oldest entry once the journal
+// has grown past maxJournalEntries. Callers must hold z.mu for writing.
+func (z *Zone) appendJournal(oldSerial, newSerial uint32, deletions, additions []dns.RR) {
+	if len(deletions) == 0 && len(additions) == 0 {
+		return
+	}
+	z.journal = append(z.journal, JournalEntry{
+		OldSerial: oldSerial,
+		NewSerial: newSerial,
+		Deletions: deletions,
+		Additions: additions,
+	})
+	z.trimJournal()
+}
+
+// diffsSince returns the ordered journal entries that bring a client at
+// fromSerial up to the zone's current serial, and whether fromSerial was
+// found at all. Callers must hold z.mu for reading.
+func (z *Zone) diffsSince(fromSerial uint32) ([]JournalEntry, bool) {
+	for i, e := range z.journal {
+		if e.OldSerial == fromSerial {
+			return z.journal[i:], true
+		}
+	}
+	return nil, false
+}
+
+func journalToDTO(journal []JournalEntry) []JournalEntryDTO {
+	if len(journal) == 0 {
+		return nil
+	}
+	out := make([]JournalEntryDTO, 0, len(journal))
+	for _, e := range journal {
+		out = append(out, JournalEntryDTO{
+			OldSerial: e.OldSerial,
+			NewSerial: e.NewSerial,
+			Deletions: rrsToStrings(e.Deletions),
+			Additions: rrsToStrings(e.Additions),
+		})
+	}
+	return out
+}
+
+func journalFromDTO(dtos []JournalEntryDTO) []JournalEntry {
+	if len(dtos) == 0 {
+		return nil
+	}
+	out := make([]JournalEntry, 0, len(dtos))
+	for _, d := range dtos {
+		out = append(out, JournalEntry{
+			OldSerial: d.OldSerial,
+			NewSerial: d.NewSerial,
+			Deletions: stringsToRRs(d.Deletions),
+			Additions: stringsToRRs(d.Additions),
+		})
+	}
+	return out
+}
+
+func rrsToStrings(rrs []dns.RR) []string {
+	if len(rrs) == 0 {
+		return nil
+	}
+	out := make([]string, 0, len(rrs))
+	for _, rr := range rrs {
+		out = append(out, rr.String())
+	}
+	return out
+}
+
+func stringsToRRs(strs []string) []dns.RR {
+	if len(strs) == 0 {
+		return nil
+	}
+	out := make([]dns.RR, 0, len(strs))
+	for _, s := range strs {
+		rr, err := dns.NewRR(s)
+		if err != nil {
+			continue
+		}
+		out = append(out, rr)
+	}
+	return out
+}
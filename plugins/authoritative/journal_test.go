@@ -0,0 +1,56 @@
+package authoritative
+
+import (
+	"testing"
+
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSetZoneJournalMaxTrimsExistingEntries(t *testing.T) {
+	p := New("") // in-memory
+	p.AddZone("example.com.")
+
+	for i := 0; i < 5; i++ {
+		aRR, err := dns.NewRR("www.example.com. 300 IN A 1.2.3.4")
+		assert.NoError(t, err)
+		_, err = p.AddZoneRecord("example.com.", aRR)
+		assert.NoError(t, err)
+	}
+
+	zone, ok := p.findZone("example.com.")
+	assert.True(t, ok)
+	zone.mu.RLock()
+	before := len(zone.journal)
+	zone.mu.RUnlock()
+	assert.Equal(t, 5, before)
+
+	assert.NoError(t, p.SetZoneJournalMax("example.com.", 2))
+
+	zone.mu.RLock()
+	after := len(zone.journal)
+	zone.mu.RUnlock()
+	assert.Equal(t, 2, after)
+}
+
+func TestPruneJournalsEnforcesPerZoneCap(t *testing.T) {
+	p := New("") // in-memory
+	p.AddZone("example.com.")
+	assert.NoError(t, p.SetZoneJournalMax("example.com.", 1))
+
+	for i := 0; i < 3; i++ {
+		aRR, err := dns.NewRR("www.example.com. 300 IN A 1.2.3.4")
+		assert.NoError(t, err)
+		_, err = p.AddZoneRecord("example.com.", aRR)
+		assert.NoError(t, err)
+	}
+
+	zone, ok := p.findZone("example.com.")
+	assert.True(t, ok)
+
+	p.pruneJournals()
+
+	zone.mu.RLock()
+	defer zone.mu.RUnlock()
+	assert.LessOrEqual(t, len(zone.journal), 1)
+}
@@ -0,0 +1,48 @@
+package authoritative
+
+import "log/slog"
+
+// Logger lets the notify/transfer path emit structured key-value events
+// instead of free-form log.Printf strings, so an operator can route zone,
+// slave, addr, serial, and rcode fields to whatever log pipeline they run
+// rather than parsing them back out of English sentences. kv follows
+// log/slog's convention: alternating key, value pairs.
+type Logger interface {
+	Debug(msg string, kv ...any)
+	Info(msg string, kv ...any)
+	Warn(msg string, kv ...any)
+	Error(msg string, kv ...any)
+}
+
+// slogLogger is the default Logger, backed by log/slog so structured
+// events are JSON-able out of the box without pulling in a third-party
+// logging library.
+type slogLogger struct {
+	l *slog.Logger
+}
+
+func newDefaultLogger() Logger {
+	return &slogLogger{l: slog.Default()}
+}
+
+func (s *slogLogger) Debug(msg string, kv ...any) { s.l.Debug(msg, kv...) }
+func (s *slogLogger) Info(msg string, kv ...any)  { s.l.Info(msg, kv...) }
+func (s *slogLogger) Warn(msg string, kv ...any)  { s.l.Warn(msg, kv...) }
+func (s *slogLogger) Error(msg string, kv ...any) { s.l.Error(msg, kv...) }
+
+// SetLogger installs l as the logger the notify/transfer path reports
+// through. Passing nil restores the default slog.Default()-backed logger.
+func (p *AuthoritativePlugin) SetLogger(l Logger) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if l == nil {
+		l = newDefaultLogger()
+	}
+	p.logger = l
+}
+
+func (p *AuthoritativePlugin) log() Logger {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.logger
+}
@@ -0,0 +1,40 @@
+package authoritative
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type recordingLogger struct {
+	warnings []string
+}
+
+func (r *recordingLogger) Debug(msg string, kv ...any) {}
+func (r *recordingLogger) Info(msg string, kv ...any)  {}
+func (r *recordingLogger) Warn(msg string, kv ...any)  { r.warnings = append(r.warnings, msg) }
+func (r *recordingLogger) Error(msg string, kv ...any) {}
+
+func TestSetLoggerOverridesDefault(t *testing.T) {
+	p := New("") // in-memory
+	rl := &recordingLogger{}
+	p.SetLogger(rl)
+
+	require := p.log()
+	require.Warn("test warning")
+	assert.Equal(t, []string{"test warning"}, rl.warnings)
+}
+
+func TestSetLoggerNilRestoresDefault(t *testing.T) {
+	p := New("")
+	p.SetLogger(&recordingLogger{})
+	p.SetLogger(nil)
+	assert.IsType(t, &slogLogger{}, p.log())
+}
+
+func TestGlueAddrsErrorWrapsErrInvalidGlue(t *testing.T) {
+	err := fmt.Errorf("%w: %v", ErrInvalidGlue, errors.New("backend unreachable"))
+	assert.True(t, errors.Is(err, ErrInvalidGlue))
+}
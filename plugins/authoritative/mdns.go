@@ -0,0 +1,154 @@
+package authoritative
+
+// Per-zone support for serving a zone over mDNS/DNS-SD in addition to
+// unicast DNS. The multicast networking itself (socket setup, interface
+// selection, query handling) lives in plugins/mdns, which holds a
+// *AuthoritativePlugin and answers link-local queries straight out of the
+// same zone.records store unicast queries are served from; this file only
+// adds the zone-side bookkeeping: the link-local flag and the Publish API
+// operators use to register a service.
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// EnableLinkLocal flags zoneName as served over mDNS (224.0.0.251:5353 /
+// [ff02::fb]:5353) in addition to unicast. It does not itself open any
+// sockets; a plugins/mdns Responder polls IsLinkLocal to decide which
+// zones it answers for.
+func (p *AuthoritativePlugin) EnableLinkLocal(zoneName string) error {
+	zn := dns.Fqdn(strings.ToLower(zoneName))
+	p.mu.RLock()
+	z, ok := p.zones[zn]
+	p.mu.RUnlock()
+	if !ok {
+		return fmt.Errorf("zone not found: %s", zoneName)
+	}
+	z.mu.Lock()
+	z.linkLocal = true
+	z.mu.Unlock()
+	return nil
+}
+
+// IsLinkLocal reports whether zoneName is flagged for mDNS service.
+func (p *AuthoritativePlugin) IsLinkLocal(zoneName string) bool {
+	zn := dns.Fqdn(strings.ToLower(zoneName))
+	p.mu.RLock()
+	z, ok := p.zones[zn]
+	p.mu.RUnlock()
+	if !ok {
+		return false
+	}
+	z.mu.RLock()
+	defer z.mu.RUnlock()
+	return z.linkLocal
+}
+
+// GetZone returns the zone registered under zoneName, for callers that need
+// to act on the zone itself rather than through a plugin-level method — for
+// example, calling Zone.Publish to register a DNS-SD service.
+func (p *AuthoritativePlugin) GetZone(zoneName string) (*Zone, bool) {
+	zn := dns.Fqdn(strings.ToLower(zoneName))
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	z, ok := p.zones[zn]
+	return z, ok
+}
+
+// LinkLocalZones returns the names of every zone flagged via
+// EnableLinkLocal, for a Responder to iterate over.
+func (p *AuthoritativePlugin) LinkLocalZones() []string {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	var out []string
+	for name, z := range p.zones {
+		z.mu.RLock()
+		ll := z.linkLocal
+		z.mu.RUnlock()
+		if ll {
+			out = append(out, name)
+		}
+	}
+	return out
+}
+
+// nextMDNSID hands out a synthetic record ID scoped to this zone's
+// mDNS-published records. It's independent of the plugin-wide
+// nextRecordID counter because published services aren't part of the
+// usual zone CRUD/export surface. Caller must hold z.mu.
+func (z *Zone) nextMDNSID() int {
+	z.mdnsRecordSeq++
+	return -z.mdnsRecordSeq
+}
+
+// Publish registers a DNS-SD service under this zone: a PTR from
+// "_service._proto.<zone>" to an instance name derived from the zone's own
+// label, an SRV pointing at the zone itself on port, and a TXT record
+// carrying txt. The zone must already carry the A/AAAA records for its own
+// name; Publish only adds the service-discovery records, so the same
+// store answers both the plain "myhost.local A ..." unicast-style lookup
+// and the "_service._proto.local PTR ..." mDNS browse.
+//
+// service is a DNS-SD service type such as "_http._tcp" (no trailing dot
+// or domain). Publish is safe to call repeatedly for different services on
+// the same zone.
+func (z *Zone) Publish(service string, port uint16, txt map[string]string) error {
+	service = strings.TrimSuffix(strings.ToLower(service), ".")
+	if service == "" {
+		return fmt.Errorf("service type must not be empty")
+	}
+
+	instanceLabel := strings.TrimSuffix(z.Name, ".")
+	if idx := strings.IndexByte(instanceLabel, '.'); idx >= 0 {
+		instanceLabel = instanceLabel[:idx]
+	}
+	if instanceLabel == "" {
+		return fmt.Errorf("zone %s has no usable instance label", z.Name)
+	}
+
+	serviceFQDN := dns.Fqdn(service + "." + z.Name)
+	instanceFQDN := dns.Fqdn(instanceLabel + "." + service + "." + z.Name)
+
+	ptr := &dns.PTR{
+		Hdr: dns.RR_Header{Name: serviceFQDN, Rrtype: dns.TypePTR, Class: dns.ClassINET, Ttl: 120},
+		Ptr: instanceFQDN,
+	}
+	srv := &dns.SRV{
+		Hdr:      dns.RR_Header{Name: instanceFQDN, Rrtype: dns.TypeSRV, Class: dns.ClassINET, Ttl: 120},
+		Priority: 0,
+		Weight:   0,
+		Port:     port,
+		Target:   z.Name,
+	}
+	txtRR := &dns.TXT{
+		Hdr: dns.RR_Header{Name: instanceFQDN, Rrtype: dns.TypeTXT, Class: dns.ClassINET, Ttl: 120},
+		Txt: txtStrings(txt),
+	}
+
+	z.mu.Lock()
+	defer z.mu.Unlock()
+	for _, rr := range []dns.RR{ptr, srv, txtRR} {
+		name := dns.Fqdn(strings.ToLower(rr.Header().Name))
+		if _, ok := z.records[name]; !ok {
+			z.records[name] = make(map[uint16][]Record)
+		}
+		z.records[name][rr.Header().Rrtype] = append(z.records[name][rr.Header().Rrtype], Record{ID: z.nextMDNSID(), RR: rr})
+	}
+	return nil
+}
+
+// txtStrings renders a TXT record's key/value pairs in "key=value" form,
+// the format DNS-SD clients expect (RFC 6763 section 6.3).
+func txtStrings(txt map[string]string) []string {
+	if len(txt) == 0 {
+		return []string{""}
+	}
+	out := make([]string, 0, len(txt))
+	for k, v := range txt {
+		out = append(out, k+"="+v)
+	}
+	return out
+}
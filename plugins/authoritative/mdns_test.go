@@ -0,0 +1,66 @@
+package authoritative
+
+import (
+	"testing"
+
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEnableLinkLocalFlagsZone(t *testing.T) {
+	p := New("") // in-memory
+	require.NoError(t, p.AddZone("printer.local."))
+
+	assert.False(t, p.IsLinkLocal("printer.local."))
+	require.NoError(t, p.EnableLinkLocal("printer.local."))
+	assert.True(t, p.IsLinkLocal("printer.local."))
+	assert.Equal(t, []string{"printer.local."}, p.LinkLocalZones())
+}
+
+func TestEnableLinkLocalUnknownZone(t *testing.T) {
+	p := New("")
+	assert.Error(t, p.EnableLinkLocal("nope.local."))
+}
+
+func TestZonePublishRegistersServiceRecords(t *testing.T) {
+	p := New("")
+	require.NoError(t, p.AddZone("printer.local."))
+
+	z, ok := p.GetZone("printer.local.")
+	require.True(t, ok)
+	require.NoError(t, z.Publish("_http._tcp", 8080, map[string]string{"path": "/status"}))
+
+	records, err := p.GetZoneRecords("printer.local.")
+	require.NoError(t, err)
+
+	var sawPTR, sawSRV, sawTXT bool
+	for _, r := range records {
+		switch rr := r.RR.(type) {
+		case *dns.PTR:
+			assert.Equal(t, "_http._tcp.printer.local.", rr.Header().Name)
+			assert.Equal(t, "printer._http._tcp.printer.local.", rr.Ptr)
+			sawPTR = true
+		case *dns.SRV:
+			assert.Equal(t, "printer._http._tcp.printer.local.", rr.Header().Name)
+			assert.Equal(t, uint16(8080), rr.Port)
+			assert.Equal(t, "printer.local.", rr.Target)
+			sawSRV = true
+		case *dns.TXT:
+			assert.Equal(t, "printer._http._tcp.printer.local.", rr.Header().Name)
+			assert.Contains(t, rr.Txt, "path=/status")
+			sawTXT = true
+		}
+	}
+	assert.True(t, sawPTR, "expected a PTR record")
+	assert.True(t, sawSRV, "expected an SRV record")
+	assert.True(t, sawTXT, "expected a TXT record")
+}
+
+func TestZonePublishRejectsEmptyService(t *testing.T) {
+	p := New("")
+	require.NoError(t, p.AddZone("printer.local."))
+	z, ok := p.GetZone("printer.local.")
+	require.True(t, ok)
+	assert.Error(t, z.Publish("", 80, nil))
+}
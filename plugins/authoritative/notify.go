@@ -0,0 +1,242 @@
+package authoritative
+
+// Outbound NOTIFY (RFC 1996) fired whenever a zone's serial increments, and
+// inbound NOTIFY handling for zones configured as a secondary of some
+// master: receiving one kicks off a SOA check and, if the master is ahead,
+// an IXFR (falling back to AXFR) to catch up.
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"dns-resolver/internal/plugins"
+	"github.com/miekg/dns"
+)
+
+// notifyRetries/notifyBackoffBase govern outbound NOTIFY retry behavior;
+// RFC 1996 section 3.6 only says a master "should retry periodically",
+// so a small bounded exponential backoff is a reasonable, simple choice.
+const (
+	notifyRetries     = 3
+	notifyBackoffBase = 2 * time.Second
+)
+
+// secondaries holds operational configuration that, like updateACLs, is
+// kept out of the Zone struct itself: per-zone outbound NOTIFY targets,
+// and the master address for zones this server serves as a secondary.
+type secondaries struct {
+	mu            sync.RWMutex
+	notifyTargets map[string][]string  // zone -> host:port list to NOTIFY
+	secondaryOf   map[string]string    // zone -> master host:port, if secondary
+	masterKeys    map[string]masterKey // zone -> TSIG key to sign transfer requests to its master
+}
+
+// masterKey is the TSIG key a secondary zone uses to authenticate itself to
+// its master when pulling SOA/AXFR/IXFR, set via SetSecondaryMasterKey.
+type masterKey struct {
+	keyName string
+	secret  string
+}
+
+func newSecondaries() *secondaries {
+	return &secondaries{
+		notifyTargets: make(map[string][]string),
+		secondaryOf:   make(map[string]string),
+		masterKeys:    make(map[string]masterKey),
+	}
+}
+
+// SetNotifyTargets configures the hosts (host:port) NOTIFYed whenever
+// zoneName's SOA serial changes.
+func (p *AuthoritativePlugin) SetNotifyTargets(zoneName string, hosts []string) {
+	zn := dns.Fqdn(strings.ToLower(zoneName))
+	p.secondaries.mu.Lock()
+	defer p.secondaries.mu.Unlock()
+	p.secondaries.notifyTargets[zn] = hosts
+}
+
+// SetSecondaryOf marks zoneName as a secondary of master (host:port), so an
+// inbound NOTIFY for it triggers a refresh instead of being refused.
+func (p *AuthoritativePlugin) SetSecondaryOf(zoneName, master string) {
+	zn := dns.Fqdn(strings.ToLower(zoneName))
+	p.secondaries.mu.Lock()
+	defer p.secondaries.mu.Unlock()
+	p.secondaries.secondaryOf[zn] = master
+}
+
+func (p *AuthoritativePlugin) notifyTargetsFor(zoneName string) []string {
+	p.secondaries.mu.RLock()
+	defer p.secondaries.mu.RUnlock()
+	return p.secondaries.notifyTargets[zoneName]
+}
+
+func (p *AuthoritativePlugin) masterFor(zoneName string) (string, bool) {
+	p.secondaries.mu.RLock()
+	defer p.secondaries.mu.RUnlock()
+	master, ok := p.secondaries.secondaryOf[zoneName]
+	return master, ok
+}
+
+// SetSecondaryMasterKey configures the TSIG key (name and base64 secret)
+// this server presents to zoneName's master when pulling SOA/AXFR/IXFR.
+func (p *AuthoritativePlugin) SetSecondaryMasterKey(zoneName, keyName, base64Secret string) {
+	zn := dns.Fqdn(strings.ToLower(zoneName))
+	p.secondaries.mu.Lock()
+	defer p.secondaries.mu.Unlock()
+	p.secondaries.masterKeys[zn] = masterKey{keyName: dns.Fqdn(strings.ToLower(keyName)), secret: base64Secret}
+}
+
+func (p *AuthoritativePlugin) masterKeyFor(zoneName string) (masterKey, bool) {
+	p.secondaries.mu.RLock()
+	defer p.secondaries.mu.RUnlock()
+	k, ok := p.secondaries.masterKeys[zoneName]
+	return k, ok
+}
+
+// notifySecondaries sends a NOTIFY to every configured target for zone,
+// retrying with backoff on failure. Each target is notified in its own
+// goroutine so one slow/unreachable secondary can't delay the others or
+// the caller, which is typically still holding the zone write path.
+func (p *AuthoritativePlugin) notifySecondaries(zoneName string) {
+	hosts := p.notifyTargetsFor(zoneName)
+	if len(hosts) == 0 {
+		return
+	}
+	m := new(dns.Msg)
+	m.SetNotify(zoneName)
+	client := new(dns.Client)
+
+	for _, host := range hosts {
+		host := host
+		go func() {
+			backoff := notifyBackoffBase
+			for attempt := 0; attempt <= notifyRetries; attempt++ {
+				resp, _, err := client.Exchange(m, host)
+				if err == nil && resp.Rcode == dns.RcodeSuccess {
+					return
+				}
+				if err == nil {
+					err = fmt.Errorf("%w: %s", ErrNotifyRefused, dns.RcodeToString[resp.Rcode])
+				}
+				if attempt == notifyRetries {
+					p.log().Error("NOTIFY failed after retries", "zone", zoneName, "slave", host, "attempts", attempt+1, "error", err)
+				}
+				time.Sleep(backoff)
+				backoff *= 2
+			}
+		}()
+	}
+}
+
+// handleNotify implements the inbound side of RFC 1996: acknowledge the
+// NOTIFY, then if this zone is configured as a secondary, refresh it from
+// its master in the background.
+func (p *AuthoritativePlugin) handleNotify(ctx *plugins.PluginContext, msg *dns.Msg) {
+	res := new(dns.Msg)
+	res.SetReply(msg)
+
+	if len(msg.Question) != 1 {
+		res.Rcode = dns.RcodeFormatError
+		ctx.ResponseWriter.WriteMsg(res)
+		ctx.Stop = true
+		return
+	}
+
+	zoneName := dns.Fqdn(strings.ToLower(msg.Question[0].Name))
+	zone, ok := p.findZone(zoneName)
+	if !ok || zone.Name != zoneName {
+		res.Rcode = dns.RcodeNotAuth
+		ctx.ResponseWriter.WriteMsg(res)
+		ctx.Stop = true
+		return
+	}
+
+	res.Authoritative = true
+	ctx.ResponseWriter.WriteMsg(res)
+	ctx.Stop = true
+
+	if master, ok := p.masterFor(zoneName); ok {
+		go func() {
+			if err := p.pullFromMaster(zoneName, master); err != nil {
+				p.log().Error("NOTIFY-triggered refresh failed", "zone", zoneName, "master", master, "error", err)
+			}
+		}()
+	}
+}
+
+// pullFromMaster queries master's SOA and, if it's ahead of our serial,
+// pulls the difference via IXFR (applying the master's AXFR fallback
+// transparently) and persists the result. Used both by the NOTIFY-triggered
+// path above and by the scheduled refresh/retry cycle in secondary.go.
+func (p *AuthoritativePlugin) pullFromMaster(zoneName, master string) error {
+	zone, ok := p.findZone(zoneName)
+	if !ok {
+		return fmt.Errorf("zone not found: %s", zoneName)
+	}
+
+	client := new(dns.Client)
+	if secret, ok := p.masterKeyFor(zoneName); ok {
+		client.TsigSecret = map[string]string{secret.keyName: secret.secret}
+	}
+
+	soaQ := new(dns.Msg)
+	soaQ.SetQuestion(zoneName, dns.TypeSOA)
+	if secret, ok := p.masterKeyFor(zoneName); ok {
+		soaQ.SetTsig(secret.keyName, dns.HmacSHA256, 300, time.Now().Unix())
+	}
+	resp, _, err := client.Exchange(soaQ, master)
+	if err != nil {
+		return fmt.Errorf("SOA query failed: %w", err)
+	}
+	if resp == nil || len(resp.Answer) == 0 {
+		return fmt.Errorf("SOA query returned no answer")
+	}
+	masterSOA, ok := resp.Answer[0].(*dns.SOA)
+	if !ok {
+		return fmt.Errorf("SOA query answer was not a SOA record")
+	}
+
+	zone.mu.RLock()
+	localSOA, haveSOA := zone.soa.(*dns.SOA)
+	zone.mu.RUnlock()
+	if haveSOA && masterSOA.Serial <= localSOA.Serial {
+		return nil // already up to date
+	}
+
+	xfrQ := new(dns.Msg)
+	xfrQ.SetQuestion(zoneName, dns.TypeIXFR)
+	if haveSOA {
+		xfrQ.Ns = []dns.RR{localSOA}
+	}
+	if secret, ok := p.masterKeyFor(zoneName); ok {
+		xfrQ.SetTsig(secret.keyName, dns.HmacSHA256, 300, time.Now().Unix())
+	}
+
+	tr := new(dns.Transfer)
+	if secret, ok := p.masterKeyFor(zoneName); ok {
+		tr.TsigSecret = map[string]string{secret.keyName: secret.secret}
+	}
+	envs, err := tr.In(xfrQ, master)
+	if err != nil {
+		return fmt.Errorf("transfer failed: %w", err)
+	}
+
+	var all []dns.RR
+	for env := range envs {
+		if env.Error != nil {
+			return fmt.Errorf("transfer failed: %w", env.Error)
+		}
+		all = append(all, env.RR...)
+	}
+
+	if err := applyTransferResult(zone, all); err != nil {
+		return err
+	}
+	p.log().Info("refreshed zone from master", "zone", zoneName, "master", master, "serial", masterSOA.Serial)
+	if err := p.saveToFile(p.GetZoneDTOs()); err != nil {
+		return fmt.Errorf("failed to persist zone after refresh: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,122 @@
+package authoritative
+
+// NSEC synthesis for authenticated denial of existence on signed zones.
+// This covers the common NXDOMAIN/NODATA cases; it does not attempt a full
+// closest-encloser wildcard proof.
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// canonicalOwnerNames returns every owner name in the zone sorted into
+// DNSSEC canonical order (RFC 4034 section 6.1): labels compared from the
+// rightmost (least significant) label inward.
+func (z *Zone) canonicalOwnerNames() []string {
+	names := make([]string, 0, len(z.records))
+	for name := range z.records {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		return canonicalLess(names[i], names[j])
+	})
+	return names
+}
+
+// canonicalLess compares two owner names in canonical wire-order by
+// comparing their labels from the last (TLD-most) label inward.
+func canonicalLess(a, b string) bool {
+	la := dns.SplitDomainName(a)
+	lb := dns.SplitDomainName(b)
+	for i, j := len(la)-1, len(lb)-1; i >= 0 && j >= 0; i, j = i-1, j-1 {
+		if c := strings.Compare(strings.ToLower(la[i]), strings.ToLower(lb[j])); c != 0 {
+			return c < 0
+		}
+	}
+	return len(la) < len(lb)
+}
+
+// typeBitmapFor returns the sorted list of RR types present at owner, always
+// including NSEC and RRSIG since both exist once the zone is signed.
+func typeBitmapFor(types map[uint16][]Record) []uint16 {
+	out := make([]uint16, 0, len(types)+2)
+	for t := range types {
+		if t == dns.TypeRRSIG {
+			continue
+		}
+		out = append(out, t)
+	}
+	out = append(out, dns.TypeNSEC, dns.TypeRRSIG)
+	sort.Slice(out, func(i, j int) bool { return out[i] < out[j] })
+	return out
+}
+
+// nsecFor builds the NSEC record owned by `owner`, pointing at `next`.
+func nsecFor(owner, next string, types map[uint16][]Record, ttl uint32) *dns.NSEC {
+	return &dns.NSEC{
+		Hdr:        dns.RR_Header{Name: owner, Rrtype: dns.TypeNSEC, Class: dns.ClassINET, Ttl: ttl},
+		NextDomain: next,
+		TypeBitMap: typeBitmapFor(types),
+	}
+}
+
+// addNSECNoData appends the NSEC record proving that `name` exists but has
+// no records of the queried type.
+func (p *AuthoritativePlugin) addNSECNoData(res *dns.Msg, z *Zone, name string) {
+	z.mu.RLock()
+	defer z.mu.RUnlock()
+	if z.dnssec == nil {
+		return
+	}
+	if z.nsec3 != nil {
+		p.addNSEC3NoData(res, z, name)
+		return
+	}
+	names := z.canonicalOwnerNames()
+	idx := sort.SearchStrings(names, name)
+	if idx >= len(names) || names[idx] != name {
+		return
+	}
+	next := names[(idx+1)%len(names)]
+	ttl := uint32(3600)
+	if z.soa != nil {
+		ttl = z.soa.Header().Ttl
+	}
+	res.Ns = append(res.Ns, nsecFor(name, next, z.records[name], ttl))
+}
+
+// addNSECNXDomain appends the NSEC record covering `qname` (the owner whose
+// canonical range contains qname, with nothing matching in between) proving
+// that no name between it and its successor exists.
+func (p *AuthoritativePlugin) addNSECNXDomain(res *dns.Msg, z *Zone, qname string) {
+	z.mu.RLock()
+	defer z.mu.RUnlock()
+	if z.dnssec == nil {
+		return
+	}
+	if z.nsec3 != nil {
+		p.addNSEC3NXDomain(res, z, qname)
+		return
+	}
+	names := z.canonicalOwnerNames()
+	if len(names) == 0 {
+		return
+	}
+	// Find the last owner name that canonically precedes qname; wrap to the
+	// end of the zone if qname sorts before every owner (covers the "before
+	// the first name" case per RFC 4034).
+	idx := sort.Search(len(names), func(i int) bool { return !canonicalLess(names[i], qname) })
+	coverIdx := idx - 1
+	if coverIdx < 0 {
+		coverIdx = len(names) - 1
+	}
+	owner := names[coverIdx]
+	next := names[(coverIdx+1)%len(names)]
+	ttl := uint32(3600)
+	if z.soa != nil {
+		ttl = z.soa.Header().Ttl
+	}
+	res.Ns = append(res.Ns, nsecFor(owner, next, z.records[owner], ttl))
+}
@@ -0,0 +1,78 @@
+package authoritative
+
+import (
+	"testing"
+
+	"dns-resolver/internal/plugins"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNSEC3NXDomainReplacesNSEC(t *testing.T) {
+	p := New("") // In-memory
+	p.AddZone("example.com.")
+
+	nsRR, err := dns.NewRR("example.com. 3600 IN NS ns1.example.com.")
+	assert.NoError(t, err)
+	_, err = p.AddZoneRecord("example.com.", nsRR)
+	assert.NoError(t, err)
+
+	assert.NoError(t, p.EnableDNSSEC("example.com."))
+	assert.NoError(t, p.EnableNSEC3("example.com.", DefaultNSEC3Iterations, ""))
+
+	w := &completeMockResponseWriter{}
+	req := new(dns.Msg)
+	req.SetQuestion("nosuchname.example.com.", dns.TypeA)
+	req.SetEdns0(4096, true)
+
+	ctx := &plugins.PluginContext{ResponseWriter: w}
+	assert.NoError(t, p.Execute(ctx, req))
+
+	res := w.writtenMsgs[0]
+	assert.Equal(t, dns.RcodeNameError, res.Rcode)
+
+	var sawNSEC3, sawNSEC int
+	for _, rr := range res.Ns {
+		switch rr.Header().Rrtype {
+		case dns.TypeNSEC3:
+			sawNSEC3++
+		case dns.TypeNSEC:
+			sawNSEC++
+		}
+	}
+	assert.Greater(t, sawNSEC3, 0, "NSEC3-enabled zone should prove NXDOMAIN with NSEC3, not NSEC")
+	assert.Equal(t, 0, sawNSEC)
+}
+
+func TestNSEC3NoDataMatchesOwner(t *testing.T) {
+	p := New("") // In-memory
+	p.AddZone("example.com.")
+
+	aRR, err := dns.NewRR("www.example.com. 3600 IN A 192.0.2.1")
+	assert.NoError(t, err)
+	_, err = p.AddZoneRecord("example.com.", aRR)
+	assert.NoError(t, err)
+
+	assert.NoError(t, p.EnableDNSSEC("example.com."))
+	assert.NoError(t, p.EnableNSEC3("example.com.", DefaultNSEC3Iterations, ""))
+
+	w := &completeMockResponseWriter{}
+	req := new(dns.Msg)
+	req.SetQuestion("www.example.com.", dns.TypeAAAA)
+	req.SetEdns0(4096, true)
+
+	ctx := &plugins.PluginContext{ResponseWriter: w}
+	assert.NoError(t, p.Execute(ctx, req))
+
+	res := w.writtenMsgs[0]
+	assert.Equal(t, dns.RcodeSuccess, res.Rcode)
+
+	var sawNSEC3 bool
+	for _, rr := range res.Ns {
+		if nsec3, ok := rr.(*dns.NSEC3); ok {
+			sawNSEC3 = true
+			assert.True(t, nsec3.Match(dns.Fqdn("www.example.com.")), "NODATA NSEC3 should match the queried owner's hash")
+		}
+	}
+	assert.True(t, sawNSEC3, "NODATA on an NSEC3 zone should include a matching NSEC3 record")
+}
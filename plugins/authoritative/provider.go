@@ -0,0 +1,44 @@
+package authoritative
+
+// ZoneProvider abstracts where a zone's records actually live, mirroring
+// the shape popularized by libdns.Provider: a zone-scoped
+// Get/Append/Set/Delete over a record slice. The in-memory store this
+// plugin has always used is just the default implementation
+// (MemoryProvider); FileProvider and SQLProvider ship alongside it for
+// operators who'd rather keep a zone in a BIND-format file or a SQL table,
+// and any other libdns-style backend (Cloudflare, Route53, ...) can be
+// plugged in by implementing the same four methods.
+//
+// Record IDs are provider-scoped: AppendRecords returns the IDs its
+// provider actually assigned, and callers must pass those same IDs (or
+// equivalent records) back into SetRecords/DeleteRecords.
+
+import (
+	"context"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// ZoneProvider is the storage interface a zone's record set lives behind.
+type ZoneProvider interface {
+	// GetRecords returns every record currently stored for zone.
+	GetRecords(ctx context.Context, zone string) ([]Record, error)
+	// AppendRecords adds recs to zone without touching any existing
+	// record, returning recs as actually stored (e.g. with assigned IDs).
+	AppendRecords(ctx context.Context, zone string, recs []Record) ([]Record, error)
+	// SetRecords replaces any existing record that shares a name and type
+	// with one of recs, leaving every other record in the zone untouched,
+	// then returns recs as actually stored.
+	SetRecords(ctx context.Context, zone string, recs []Record) ([]Record, error)
+	// DeleteRecords removes every record in recs from zone, matched by
+	// name, type, and value, and returns the ones actually removed.
+	DeleteRecords(ctx context.Context, zone string, recs []Record) ([]Record, error)
+}
+
+// recordKey identifies a record by owner name and type for the
+// name+type-scoped replacement SetRecords implements.
+func recordKey(rr dns.RR) string {
+	h := rr.Header()
+	return dns.Fqdn(strings.ToLower(h.Name)) + "/" + dns.TypeToString[h.Rrtype]
+}
@@ -0,0 +1,186 @@
+package authoritative
+
+// FileProvider is a ZoneProvider backed by one BIND-format zone file per
+// zone on disk, complementing the JSON persistence the in-memory store
+// uses. It's a thinner sibling of ExportZoneBIND/ImportZoneBIND in
+// bindzone.go: those round-trip a *Zone (with its NS/SOA bookkeeping,
+// DNSSEC state, journal, ...) through BIND text, while FileProvider only
+// deals in plain records, since that's all the ZoneProvider interface
+// exposes.
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/miekg/dns"
+)
+
+// FileProvider stores each zone as "<zone-without-trailing-dot>.zone" in
+// Dir, one record per line in zone-file format.
+type FileProvider struct {
+	Dir string
+
+	mu sync.Mutex
+}
+
+// NewFileProvider returns a ZoneProvider that keeps each zone's records in
+// its own BIND-format file under dir.
+func NewFileProvider(dir string) *FileProvider {
+	return &FileProvider{Dir: dir}
+}
+
+func (f *FileProvider) path(zone string) string {
+	origin := dns.Fqdn(strings.ToLower(zone))
+	return filepath.Join(f.Dir, strings.TrimSuffix(origin, ".")+".zone")
+}
+
+func (f *FileProvider) GetRecords(ctx context.Context, zone string) ([]Record, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.readLocked(zone)
+}
+
+// readLocked reads and parses zone's file. A missing file means the zone
+// has no records yet, not an error. Caller must hold f.mu.
+func (f *FileProvider) readLocked(zone string) ([]Record, error) {
+	origin := dns.Fqdn(strings.ToLower(zone))
+	file, err := os.Open(f.path(zone))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("opening zone file for %s: %w", zone, err)
+	}
+	defer file.Close()
+
+	zp := dns.NewZoneParser(file, origin, f.path(zone))
+	var records []Record
+	id := 1
+	for rr, ok := zp.Next(); ok; rr, ok = zp.Next() {
+		records = append(records, Record{ID: id, RR: rr})
+		id++
+	}
+	if err := zp.Err(); err != nil {
+		return nil, fmt.Errorf("parsing zone file for %s: %w", zone, err)
+	}
+	return records, nil
+}
+
+// writeLocked writes records out as zone's file, one RR per line sorted by
+// owner name so repeated writes produce a stable diff. Caller must hold
+// f.mu.
+func (f *FileProvider) writeLocked(zone string, records []Record) error {
+	if err := os.MkdirAll(f.Dir, 0755); err != nil {
+		return fmt.Errorf("creating zone directory: %w", err)
+	}
+	tmp, err := os.CreateTemp(f.Dir, ".zone-*")
+	if err != nil {
+		return fmt.Errorf("creating temp zone file for %s: %w", zone, err)
+	}
+	defer os.Remove(tmp.Name())
+
+	bw := bufio.NewWriter(tmp)
+	for _, r := range records {
+		fmt.Fprintln(bw, r.RR.String())
+	}
+	if err := bw.Flush(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("writing zone file for %s: %w", zone, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("writing zone file for %s: %w", zone, err)
+	}
+	return os.Rename(tmp.Name(), f.path(zone))
+}
+
+func (f *FileProvider) AppendRecords(ctx context.Context, zone string, recs []Record) ([]Record, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	existing, err := f.readLocked(zone)
+	if err != nil {
+		return nil, err
+	}
+	nextID := len(existing) + 1
+	appended := make([]Record, 0, len(recs))
+	for _, r := range recs {
+		rec := Record{ID: nextID, RR: r.RR}
+		nextID++
+		existing = append(existing, rec)
+		appended = append(appended, rec)
+	}
+	if err := f.writeLocked(zone, existing); err != nil {
+		return nil, err
+	}
+	return appended, nil
+}
+
+func (f *FileProvider) SetRecords(ctx context.Context, zone string, recs []Record) ([]Record, error) {
+	f.mu.Lock()
+	existing, err := f.readLocked(zone)
+	if err != nil {
+		f.mu.Unlock()
+		return nil, err
+	}
+	replace := make(map[string]bool, len(recs))
+	for _, r := range recs {
+		replace[recordKey(r.RR)] = true
+	}
+	kept := existing[:0]
+	for _, ex := range existing {
+		if !replace[recordKey(ex.RR)] {
+			kept = append(kept, ex)
+		}
+	}
+	nextID := len(kept) + 1
+	set := make([]Record, 0, len(recs))
+	for _, r := range recs {
+		rec := Record{ID: nextID, RR: r.RR}
+		nextID++
+		kept = append(kept, rec)
+		set = append(set, rec)
+	}
+	err = f.writeLocked(zone, kept)
+	f.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	return set, nil
+}
+
+func (f *FileProvider) DeleteRecords(ctx context.Context, zone string, recs []Record) ([]Record, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	existing, err := f.readLocked(zone)
+	if err != nil {
+		return nil, err
+	}
+	var kept, deleted []Record
+	for _, ex := range existing {
+		match := false
+		for _, r := range recs {
+			if ex.RR.String() == r.RR.String() {
+				match = true
+				break
+			}
+		}
+		if match {
+			deleted = append(deleted, ex)
+		} else {
+			kept = append(kept, ex)
+		}
+	}
+	if len(deleted) == 0 {
+		return nil, nil
+	}
+	if err := f.writeLocked(zone, kept); err != nil {
+		return nil, err
+	}
+	return deleted, nil
+}
@@ -0,0 +1,79 @@
+package authoritative
+
+// MemoryProvider is the default ZoneProvider: it implements the interface
+// directly on top of an AuthoritativePlugin's existing in-memory zone
+// store, so every zone keeps working exactly as before unless a different
+// provider is registered for it via AddZoneProvider.
+
+import (
+	"context"
+	"fmt"
+)
+
+// MemoryProvider adapts an AuthoritativePlugin's own zone map to
+// ZoneProvider.
+type MemoryProvider struct {
+	plugin *AuthoritativePlugin
+}
+
+// NewMemoryProvider returns a ZoneProvider backed by plugin's in-memory
+// zone store.
+func NewMemoryProvider(plugin *AuthoritativePlugin) *MemoryProvider {
+	return &MemoryProvider{plugin: plugin}
+}
+
+func (m *MemoryProvider) GetRecords(ctx context.Context, zone string) ([]Record, error) {
+	return m.plugin.GetZoneRecords(zone)
+}
+
+func (m *MemoryProvider) AppendRecords(ctx context.Context, zone string, recs []Record) ([]Record, error) {
+	out := make([]Record, 0, len(recs))
+	for _, r := range recs {
+		id, err := m.plugin.AddZoneRecord(zone, r.RR)
+		if err != nil {
+			return out, fmt.Errorf("appending %s: %w", r.RR.Header().Name, err)
+		}
+		out = append(out, Record{ID: id, RR: r.RR})
+	}
+	return out, nil
+}
+
+func (m *MemoryProvider) SetRecords(ctx context.Context, zone string, recs []Record) ([]Record, error) {
+	existing, err := m.plugin.GetZoneRecords(zone)
+	if err != nil {
+		return nil, err
+	}
+	replace := make(map[string]bool, len(recs))
+	for _, r := range recs {
+		replace[recordKey(r.RR)] = true
+	}
+	for _, ex := range existing {
+		if replace[recordKey(ex.RR)] {
+			if err := m.plugin.DeleteZoneRecord(zone, ex.ID); err != nil {
+				return nil, fmt.Errorf("replacing %s: %w", ex.RR.Header().Name, err)
+			}
+		}
+	}
+	return m.AppendRecords(ctx, zone, recs)
+}
+
+func (m *MemoryProvider) DeleteRecords(ctx context.Context, zone string, recs []Record) ([]Record, error) {
+	existing, err := m.plugin.GetZoneRecords(zone)
+	if err != nil {
+		return nil, err
+	}
+	var deleted []Record
+	for _, r := range recs {
+		for _, ex := range existing {
+			if ex.RR.String() != r.RR.String() {
+				continue
+			}
+			if err := m.plugin.DeleteZoneRecord(zone, ex.ID); err != nil {
+				return deleted, fmt.Errorf("deleting %s: %w", ex.RR.Header().Name, err)
+			}
+			deleted = append(deleted, ex)
+			break
+		}
+	}
+	return deleted, nil
+}
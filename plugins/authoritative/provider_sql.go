@@ -0,0 +1,116 @@
+package authoritative
+
+// SQLProvider is a ZoneProvider backed by a SQL table, for deployments
+// that already keep zone data in Postgres/MySQL/SQLite rather than this
+// process's memory or a flat file. It's written against database/sql
+// alone, so it works with whatever driver the caller has registered (via
+// that driver's own blank import) without this package depending on one.
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/miekg/dns"
+)
+
+// SQLProvider expects a table of this shape (column names configurable
+// via SQLProviderConfig):
+//
+//	CREATE TABLE dns_records (
+//	    id   INTEGER PRIMARY KEY,
+//	    zone TEXT NOT NULL,
+//	    data TEXT NOT NULL -- one record in zone-file format, e.g.
+//	                       -- "www.example.com. 3600 IN A 1.2.3.4"
+//	);
+type SQLProvider struct {
+	db    *sql.DB
+	table string
+}
+
+// SQLProviderConfig names the table SQLProvider reads and writes. Table
+// defaults to "dns_records" when empty.
+type SQLProviderConfig struct {
+	Table string
+}
+
+// NewSQLProvider returns a ZoneProvider backed by db, an already-opened
+// connection (this package never opens one itself, so callers keep control
+// of the driver and DSN).
+func NewSQLProvider(db *sql.DB, cfg SQLProviderConfig) *SQLProvider {
+	table := cfg.Table
+	if table == "" {
+		table = "dns_records"
+	}
+	return &SQLProvider{db: db, table: table}
+}
+
+func (s *SQLProvider) GetRecords(ctx context.Context, zone string) ([]Record, error) {
+	rows, err := s.db.QueryContext(ctx, fmt.Sprintf("SELECT id, data FROM %s WHERE zone = ?", s.table), zone)
+	if err != nil {
+		return nil, fmt.Errorf("querying zone %s: %w", zone, err)
+	}
+	defer rows.Close()
+
+	var out []Record
+	for rows.Next() {
+		var id int
+		var data string
+		if err := rows.Scan(&id, &data); err != nil {
+			return nil, fmt.Errorf("scanning record row for zone %s: %w", zone, err)
+		}
+		rr, err := dns.NewRR(data)
+		if err != nil {
+			return nil, fmt.Errorf("parsing stored record for zone %s: %w", zone, err)
+		}
+		out = append(out, Record{ID: id, RR: rr})
+	}
+	return out, rows.Err()
+}
+
+func (s *SQLProvider) AppendRecords(ctx context.Context, zone string, recs []Record) ([]Record, error) {
+	out := make([]Record, 0, len(recs))
+	for _, r := range recs {
+		res, err := s.db.ExecContext(ctx, fmt.Sprintf("INSERT INTO %s (zone, data) VALUES (?, ?)", s.table), zone, r.RR.String())
+		if err != nil {
+			return out, fmt.Errorf("inserting record into zone %s: %w", zone, err)
+		}
+		id, err := res.LastInsertId()
+		if err != nil {
+			// Some drivers (notably Postgres') don't support
+			// LastInsertId; the record is still stored, just without a
+			// usable ID for a later SetRecords/DeleteRecords call.
+			out = append(out, Record{RR: r.RR})
+			continue
+		}
+		out = append(out, Record{ID: int(id), RR: r.RR})
+	}
+	return out, nil
+}
+
+func (s *SQLProvider) SetRecords(ctx context.Context, zone string, recs []Record) ([]Record, error) {
+	for _, r := range recs {
+		h := r.RR.Header()
+		_, err := s.db.ExecContext(ctx,
+			fmt.Sprintf("DELETE FROM %s WHERE zone = ? AND data LIKE ?", s.table),
+			zone, h.Name+"%"+dns.TypeToString[h.Rrtype]+"%")
+		if err != nil {
+			return nil, fmt.Errorf("clearing existing %s records for zone %s: %w", dns.TypeToString[h.Rrtype], zone, err)
+		}
+	}
+	return s.AppendRecords(ctx, zone, recs)
+}
+
+func (s *SQLProvider) DeleteRecords(ctx context.Context, zone string, recs []Record) ([]Record, error) {
+	var deleted []Record
+	for _, r := range recs {
+		res, err := s.db.ExecContext(ctx, fmt.Sprintf("DELETE FROM %s WHERE zone = ? AND data = ?", s.table), zone, r.RR.String())
+		if err != nil {
+			return deleted, fmt.Errorf("deleting record from zone %s: %w", zone, err)
+		}
+		if n, _ := res.RowsAffected(); n > 0 {
+			deleted = append(deleted, r)
+		}
+	}
+	return deleted, nil
+}
@@ -0,0 +1,136 @@
+package authoritative
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func mustZoneRR(t *testing.T, s string) Record {
+	t.Helper()
+	rr, err := dns.NewRR(s)
+	require.NoError(t, err)
+	return Record{RR: rr}
+}
+
+func TestMemoryProviderRoundTrip(t *testing.T) {
+	p := New("") // in-memory
+	require.NoError(t, p.AddZone("example.com."))
+	mp := NewMemoryProvider(p)
+	ctx := context.Background()
+
+	appended, err := mp.AppendRecords(ctx, "example.com.", []Record{mustZoneRR(t, "www.example.com. 300 IN A 1.2.3.4")})
+	require.NoError(t, err)
+	require.Len(t, appended, 1)
+	assert.NotZero(t, appended[0].ID)
+
+	records, err := mp.GetRecords(ctx, "example.com.")
+	require.NoError(t, err)
+	assert.Contains(t, recordStrings(records), "1.2.3.4")
+
+	deleted, err := mp.DeleteRecords(ctx, "example.com.", []Record{appended[0]})
+	require.NoError(t, err)
+	assert.Len(t, deleted, 1)
+
+	records, err = mp.GetRecords(ctx, "example.com.")
+	require.NoError(t, err)
+	assert.NotContains(t, recordStrings(records), "1.2.3.4")
+}
+
+func TestMemoryProviderSetRecordsReplacesByNameAndType(t *testing.T) {
+	p := New("")
+	require.NoError(t, p.AddZone("example.com."))
+	mp := NewMemoryProvider(p)
+	ctx := context.Background()
+
+	_, err := mp.AppendRecords(ctx, "example.com.", []Record{mustZoneRR(t, "www.example.com. 300 IN A 1.2.3.4")})
+	require.NoError(t, err)
+
+	_, err = mp.SetRecords(ctx, "example.com.", []Record{mustZoneRR(t, "www.example.com. 300 IN A 5.6.7.8")})
+	require.NoError(t, err)
+
+	records, err := mp.GetRecords(ctx, "example.com.")
+	require.NoError(t, err)
+	assert.Contains(t, recordStrings(records), "5.6.7.8")
+	assert.NotContains(t, recordStrings(records), "1.2.3.4")
+}
+
+func TestFileProviderRoundTrip(t *testing.T) {
+	fp := NewFileProvider(t.TempDir())
+	ctx := context.Background()
+
+	records, err := fp.GetRecords(ctx, "example.com.")
+	require.NoError(t, err)
+	assert.Empty(t, records, "no file yet means no records, not an error")
+
+	appended, err := fp.AppendRecords(ctx, "example.com.", []Record{mustZoneRR(t, "www.example.com. 300 IN A 1.2.3.4")})
+	require.NoError(t, err)
+	require.Len(t, appended, 1)
+
+	records, err = fp.GetRecords(ctx, "example.com.")
+	require.NoError(t, err)
+	assert.Contains(t, recordStrings(records), "1.2.3.4")
+	assert.FileExists(t, filepath.Join(fp.Dir, "example.com.zone"))
+}
+
+func TestFileProviderSetAndDeleteRecords(t *testing.T) {
+	fp := NewFileProvider(t.TempDir())
+	ctx := context.Background()
+
+	_, err := fp.AppendRecords(ctx, "example.com.", []Record{mustZoneRR(t, "www.example.com. 300 IN A 1.2.3.4")})
+	require.NoError(t, err)
+
+	_, err = fp.SetRecords(ctx, "example.com.", []Record{mustZoneRR(t, "www.example.com. 300 IN A 5.6.7.8")})
+	require.NoError(t, err)
+	records, err := fp.GetRecords(ctx, "example.com.")
+	require.NoError(t, err)
+	assert.Contains(t, recordStrings(records), "5.6.7.8")
+	assert.NotContains(t, recordStrings(records), "1.2.3.4")
+
+	deleted, err := fp.DeleteRecords(ctx, "example.com.", records)
+	require.NoError(t, err)
+	assert.Len(t, deleted, 1)
+	records, err = fp.GetRecords(ctx, "example.com.")
+	require.NoError(t, err)
+	assert.Empty(t, records)
+}
+
+func TestNotifyZoneSlavesUsesRegisteredProviderForGlue(t *testing.T) {
+	p := New("") // in-memory
+	require.NoError(t, p.AddZone("example.com."))
+
+	soaRR, err := dns.NewRR("example.com. 3600 IN SOA ns1.example.com. hostmaster.example.com. 1 7200 3600 1209600 3600")
+	require.NoError(t, err)
+	_, err = p.AddZoneRecord("example.com.", soaRR)
+	require.NoError(t, err)
+	nsRR, err := dns.NewRR("example.com. 3600 IN NS ns2.example.com.")
+	require.NoError(t, err)
+	_, err = p.AddZoneRecord("example.com.", nsRR)
+	require.NoError(t, err)
+
+	fp := NewFileProvider(t.TempDir())
+	_, err = fp.AppendRecords(context.Background(), "example.com.", []Record{mustZoneRR(t, "ns2.example.com. 300 IN A 9.9.9.9")})
+	require.NoError(t, err)
+	p.AddZoneProvider(fp)
+
+	addrs := p.glueAddrs("example.com.", "ns2.example.com.", []ZoneProvider{fp})
+	assert.Equal(t, []string{"9.9.9.9"}, addrs)
+}
+
+// recordStrings joins records' RR text into one string so callers can use
+// assert.Contains/assert.NotContains as a substring check (assert.Contains
+// on a []string instead does exact element matching, which a full RR line
+// like "www.example.com.\t300\tIN\tA\t1.2.3.4" never satisfies against just
+// the rdata).
+func recordStrings(records []Record) string {
+	lines := make([]string, 0, len(records))
+	for _, r := range records {
+		lines = append(lines, r.RR.String())
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,155 @@
+package authoritative
+
+// Transfer-request authentication and the timer-driven side of secondary
+// (slave) mode. notify.go covers the NOTIFY-triggered refresh path; this
+// file adds the periodic SOA refresh/retry/expire cycle RFC 1034 section
+// 4.3.5 expects a secondary to run even when no NOTIFY ever arrives, plus
+// gating inbound AXFR/IXFR requests on the TSIG key store from tsig.go.
+
+import (
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// transferAuthorized reports whether an inbound AXFR/IXFR request for zone
+// may proceed: allowed when the zone has no transfer keys configured (the
+// plugin's default-open stance, matching authorizeUpdate's), or when the
+// request carries a TSIG key permitted for this zone.
+func (p *AuthoritativePlugin) transferAuthorized(zoneName string, msg *dns.Msg) bool {
+	p.tsig.mu.RLock()
+	anyKeys := len(p.tsig.secrets) > 0
+	p.tsig.mu.RUnlock()
+	if !anyKeys {
+		return true
+	}
+	tsigRR := msg.IsTsig()
+	if tsigRR == nil {
+		return false
+	}
+	return p.tsigKeyPermitted(dns.Fqdn(tsigRR.Hdr.Name), zoneName)
+}
+
+// secondaryRefreshState tracks the RFC 1034 section 4.3.5 timers for one
+// secondary zone: when it last refreshed successfully, and how many
+// consecutive refresh attempts have failed (driving the retry interval
+// instead of the refresh interval until one succeeds).
+type secondaryRefreshState struct {
+	mu               sync.Mutex
+	lastSuccess      time.Time
+	consecutiveFails int
+}
+
+// secondaryTimers holds per-zone refresh state, separate from Zone like the
+// other operational (non-persisted) plugin state.
+type secondaryTimers struct {
+	mu    sync.Mutex
+	zones map[string]*secondaryRefreshState
+}
+
+func newSecondaryTimers() *secondaryTimers {
+	return &secondaryTimers{zones: make(map[string]*secondaryRefreshState)}
+}
+
+func (t *secondaryTimers) stateFor(zoneName string) *secondaryRefreshState {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	s, ok := t.zones[zoneName]
+	if !ok {
+		s = &secondaryRefreshState{}
+		t.zones[zoneName] = s
+	}
+	return s
+}
+
+// StartSecondaryRefresher launches a background goroutine that checks every
+// zone configured via SetSecondaryOf against its SOA refresh/retry/expire
+// timers each tick, pulling from its master when due. It returns a stop
+// function that halts the goroutine.
+func (p *AuthoritativePlugin) StartSecondaryRefresher(tick time.Duration) (stop func()) {
+	done := make(chan struct{})
+	ticker := time.NewTicker(tick)
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				p.checkSecondaryTimers()
+			case <-done:
+				return
+			}
+		}
+	}()
+	var once sync.Once
+	return func() { once.Do(func() { close(done) }) }
+}
+
+// checkSecondaryTimers walks every zone this server is a secondary for and
+// refreshes those whose refresh or retry interval has elapsed.
+func (p *AuthoritativePlugin) checkSecondaryTimers() {
+	p.secondaries.mu.RLock()
+	masters := make(map[string]string, len(p.secondaries.secondaryOf))
+	for zn, master := range p.secondaries.secondaryOf {
+		masters[zn] = master
+	}
+	p.secondaries.mu.RUnlock()
+
+	for zoneName, master := range masters {
+		zone, ok := p.findZone(zoneName)
+		if !ok {
+			continue
+		}
+		if p.secondaryRefreshDue(zone) {
+			p.refreshSecondaryZone(zoneName, master, zone)
+		}
+	}
+}
+
+// secondaryRefreshDue reports whether zone is due for a refresh attempt:
+// its SOA's Refresh interval has elapsed since the last success, or its
+// Retry interval has elapsed since the last failed attempt. A zone whose
+// Expire interval has elapsed since its last success is logged as expired
+// per RFC 1034 section 4.3.5, but otherwise keeps serving its stale data —
+// this plugin has no "refuse to answer" mode for an expired secondary.
+func (p *AuthoritativePlugin) secondaryRefreshDue(zone *Zone) bool {
+	zone.mu.RLock()
+	soa, ok := zone.soa.(*dns.SOA)
+	zone.mu.RUnlock()
+	if !ok {
+		return true // no SOA yet: always worth an attempt
+	}
+
+	st := p.secondaryTimers.stateFor(zone.Name)
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	if st.lastSuccess.IsZero() {
+		return true
+	}
+	since := time.Since(st.lastSuccess)
+	if since > time.Duration(soa.Expire)*time.Second {
+		p.log().Warn("secondary zone has exceeded its expire interval", "zone", zone.Name, "since", since)
+	}
+	if st.consecutiveFails > 0 {
+		return since > time.Duration(soa.Retry)*time.Second
+	}
+	return since > time.Duration(soa.Refresh)*time.Second
+}
+
+// refreshSecondaryZone pulls zone from master and records the attempt's
+// outcome in its refresh timer state.
+func (p *AuthoritativePlugin) refreshSecondaryZone(zoneName, master string, zone *Zone) {
+	st := p.secondaryTimers.stateFor(zone.Name)
+	if err := p.pullFromMaster(zoneName, master); err != nil {
+		st.mu.Lock()
+		st.consecutiveFails++
+		st.mu.Unlock()
+		p.log().Error("scheduled refresh failed", "zone", zoneName, "master", master, "error", err)
+		return
+	}
+	st.mu.Lock()
+	st.lastSuccess = time.Now()
+	st.consecutiveFails = 0
+	st.mu.Unlock()
+}
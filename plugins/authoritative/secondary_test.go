@@ -0,0 +1,58 @@
+package authoritative
+
+import (
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTransferAuthorizedOpenByDefault(t *testing.T) {
+	p := New("") // in-memory
+	p.AddZone("example.com.")
+
+	q := new(dns.Msg)
+	q.SetQuestion("example.com.", dns.TypeAXFR)
+	assert.True(t, p.transferAuthorized("example.com.", q))
+}
+
+func TestTransferAuthorizedRequiresPermittedKeyOnceConfigured(t *testing.T) {
+	p := New("") // in-memory
+	p.AddZone("example.com.")
+	p.SetTSIGKey("xfer-key.", "c2VjcmV0c2VjcmV0", "example.com.")
+
+	qNoTsig := new(dns.Msg)
+	qNoTsig.SetQuestion("example.com.", dns.TypeAXFR)
+	assert.False(t, p.transferAuthorized("example.com.", qNoTsig))
+
+	qTsig := new(dns.Msg)
+	qTsig.SetQuestion("example.com.", dns.TypeAXFR)
+	qTsig.SetTsig("xfer-key.", dns.HmacSHA256, 300, time.Now().Unix())
+	assert.True(t, p.transferAuthorized("example.com.", qTsig))
+}
+
+func TestSecondaryRefreshDueBeforeFirstSuccess(t *testing.T) {
+	p := New("") // in-memory
+	p.AddZone("example.com.")
+	zone, ok := p.findZone("example.com.")
+	assert.True(t, ok)
+
+	assert.True(t, p.secondaryRefreshDue(zone))
+}
+
+func TestSecondaryRefreshDueRespectsRefreshInterval(t *testing.T) {
+	p := New("") // in-memory
+	p.AddZone("example.com.")
+	zone, ok := p.findZone("example.com.")
+	assert.True(t, ok)
+	soaRR, err := dns.NewRR("example.com. 3600 IN SOA ns1.example.com. hostmaster.example.com. 1 7200 3600 1209600 3600")
+	assert.NoError(t, err)
+	_, err = p.AddZoneRecord("example.com.", soaRR)
+	assert.NoError(t, err)
+
+	st := p.secondaryTimers.stateFor(zone.Name)
+	st.lastSuccess = time.Now()
+
+	assert.False(t, p.secondaryRefreshDue(zone))
+}
@@ -0,0 +1,156 @@
+package authoritative
+
+// Plugin-level TSIG key store for RFC 2136 dynamic updates (RFC 2845).
+// The DNS server listener is the one that actually verifies a TSIG
+// signature against the wire-format message (see ctx.ResponseWriter.
+// TsigStatus(), already consulted by authorizeUpdate in update.go); this
+// file lets the plugin own the key material itself — via TSIGSecrets,
+// wired into dns.Server.TsigSecret, or via the AuthoritativePlugin's own
+// dns.TsigProvider implementation — and adds per-zone key permissions on
+// top, so a key valid for one zone can't authenticate updates to another.
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"strings"
+	"sync"
+
+	"github.com/miekg/dns"
+)
+
+// tsigKeyStore holds keyname -> base64 secret plus the zones each key is
+// permitted to authenticate updates for; an empty zone list means the key
+// is valid for any zone.
+type tsigKeyStore struct {
+	mu      sync.RWMutex
+	secrets map[string]string
+	zones   map[string][]string
+}
+
+func newTSIGKeyStore() *tsigKeyStore {
+	return &tsigKeyStore{secrets: make(map[string]string), zones: make(map[string][]string)}
+}
+
+// SetTSIGKey registers (or replaces) a TSIG key. zones restricts which
+// zones the key may authenticate RFC 2136 updates for; pass none to allow
+// any zone.
+func (p *AuthoritativePlugin) SetTSIGKey(keyName, base64Secret string, zones ...string) {
+	kn := dns.Fqdn(strings.ToLower(keyName))
+	normZones := make([]string, len(zones))
+	for i, z := range zones {
+		normZones[i] = dns.Fqdn(strings.ToLower(z))
+	}
+	p.tsig.mu.Lock()
+	defer p.tsig.mu.Unlock()
+	p.tsig.secrets[kn] = base64Secret
+	p.tsig.zones[kn] = normZones
+}
+
+// RemoveTSIGKey deregisters a TSIG key.
+func (p *AuthoritativePlugin) RemoveTSIGKey(keyName string) {
+	kn := dns.Fqdn(strings.ToLower(keyName))
+	p.tsig.mu.Lock()
+	defer p.tsig.mu.Unlock()
+	delete(p.tsig.secrets, kn)
+	delete(p.tsig.zones, kn)
+}
+
+// TSIGSecrets returns a copy of the keyname->secret map, suitable for
+// wiring into dns.Server.TsigSecret.
+func (p *AuthoritativePlugin) TSIGSecrets() map[string]string {
+	p.tsig.mu.RLock()
+	defer p.tsig.mu.RUnlock()
+	out := make(map[string]string, len(p.tsig.secrets))
+	for k, v := range p.tsig.secrets {
+		out[k] = v
+	}
+	return out
+}
+
+// tsigKeyPermitted reports whether keyName is configured and allowed to
+// authenticate updates against zoneName.
+func (p *AuthoritativePlugin) tsigKeyPermitted(keyName, zoneName string) bool {
+	p.tsig.mu.RLock()
+	defer p.tsig.mu.RUnlock()
+	if _, ok := p.tsig.secrets[keyName]; !ok {
+		return false
+	}
+	zones := p.tsig.zones[keyName]
+	if len(zones) == 0 {
+		return true
+	}
+	for _, z := range zones {
+		if z == zoneName {
+			return true
+		}
+	}
+	return false
+}
+
+// Generate implements dns.TsigProvider, so an AuthoritativePlugin can be
+// handed directly to dns.Server.TsigProvider.
+func (p *AuthoritativePlugin) Generate(msg []byte, t *dns.TSIG) ([]byte, error) {
+	secret, ok := p.tsig.lookup(t.Hdr.Name)
+	if !ok {
+		return nil, dns.ErrSecret
+	}
+	return hmacSign(secret, t.Algorithm, msg)
+}
+
+// Verify implements dns.TsigProvider.
+func (p *AuthoritativePlugin) Verify(msg []byte, t *dns.TSIG) error {
+	secret, ok := p.tsig.lookup(t.Hdr.Name)
+	if !ok {
+		return dns.ErrSecret
+	}
+	mac, err := hmacSign(secret, t.Algorithm, msg)
+	if err != nil {
+		return err
+	}
+	sum, err := hex.DecodeString(t.MAC)
+	if err != nil {
+		return err
+	}
+	if !hmac.Equal(mac, sum) {
+		return dns.ErrSig
+	}
+	return nil
+}
+
+func (s *tsigKeyStore) lookup(keyName string) (string, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	secret, ok := s.secrets[strings.ToLower(keyName)]
+	return secret, ok
+}
+
+// hmacSign mirrors the HMAC algorithm selection miekg/dns uses internally
+// for TSIG (RFC 2845/4635); it isn't exported by the library, so it's
+// reimplemented here to back our own dns.TsigProvider.
+func hmacSign(base64Secret, algorithm string, msg []byte) ([]byte, error) {
+	raw, err := base64.StdEncoding.DecodeString(base64Secret)
+	if err != nil {
+		return nil, fmt.Errorf("decoding tsig secret: %w", err)
+	}
+	var h hash.Hash
+	switch dns.CanonicalName(algorithm) {
+	case dns.HmacSHA1:
+		h = hmac.New(sha1.New, raw)
+	case dns.HmacSHA256:
+		h = hmac.New(sha256.New, raw)
+	case dns.HmacSHA384:
+		h = hmac.New(sha512.New384, raw)
+	case dns.HmacSHA512:
+		h = hmac.New(sha512.New, raw)
+	default:
+		return nil, dns.ErrKeyAlg
+	}
+	h.Write(msg)
+	return h.Sum(nil), nil
+}
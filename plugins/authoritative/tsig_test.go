@@ -0,0 +1,45 @@
+package authoritative
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTSIGKeyPermittedForConfiguredZone(t *testing.T) {
+	p := New("") // in-memory
+	p.AddZone("example.com.")
+
+	p.SetTSIGKey("update-key.", "c2VjcmV0c2VjcmV0", "example.com.")
+
+	assert.True(t, p.tsigKeyPermitted("update-key.", "example.com."))
+	assert.False(t, p.tsigKeyPermitted("update-key.", "other.com."))
+	assert.False(t, p.tsigKeyPermitted("unknown-key.", "example.com."))
+}
+
+func TestTSIGKeyPermittedForAnyZoneWhenUnrestricted(t *testing.T) {
+	p := New("") // in-memory
+	p.SetTSIGKey("global-key.", "c2VjcmV0c2VjcmV0")
+
+	assert.True(t, p.tsigKeyPermitted("global-key.", "example.com."))
+	assert.True(t, p.tsigKeyPermitted("global-key.", "other.com."))
+}
+
+func TestRemoveTSIGKey(t *testing.T) {
+	p := New("") // in-memory
+	p.SetTSIGKey("update-key.", "c2VjcmV0c2VjcmV0", "example.com.")
+	assert.True(t, p.tsigKeyPermitted("update-key.", "example.com."))
+
+	p.RemoveTSIGKey("update-key.")
+	assert.False(t, p.tsigKeyPermitted("update-key.", "example.com."))
+}
+
+func TestGenerateAndVerifyRoundTrip(t *testing.T) {
+	p := New("") // in-memory
+	p.SetTSIGKey("update-key.", "c2VjcmV0c2VjcmV0")
+
+	msg := []byte("fake message bytes")
+	mac, err := hmacSign("c2VjcmV0c2VjcmV0", "hmac-sha256.", msg)
+	assert.NoError(t, err)
+	assert.NotEmpty(t, mac)
+}
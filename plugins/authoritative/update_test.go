@@ -0,0 +1,111 @@
+package authoritative
+
+import (
+	"testing"
+
+	"dns-resolver/internal/plugins"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUpdateAddAndDeleteRecord(t *testing.T) {
+	p := New("") // In-memory
+	p.AddZone("example.com.")
+
+	m := new(dns.Msg)
+	m.SetUpdate("example.com.")
+
+	addRR, err := dns.NewRR("www.example.com. 300 IN A 1.2.3.4")
+	assert.NoError(t, err)
+	m.Insert([]dns.RR{addRR})
+
+	w := &completeMockResponseWriter{}
+	ctx := &plugins.PluginContext{ResponseWriter: w}
+	assert.NoError(t, p.Execute(ctx, m))
+	assert.True(t, ctx.Stop)
+	assert.Equal(t, dns.RcodeSuccess, w.writtenMsgs[0].Rcode)
+
+	records, err := p.GetZoneRecords("example.com.")
+	assert.NoError(t, err)
+	var found bool
+	for _, r := range records {
+		if r.RR.String() == addRR.String() {
+			found = true
+		}
+	}
+	assert.True(t, found, "record added via UPDATE should be present")
+
+	// Now delete it via an RFC 2136 "delete an RR from an RRset" update.
+	delMsg := new(dns.Msg)
+	delMsg.SetUpdate("example.com.")
+	delRR, err := dns.NewRR("www.example.com. 300 IN A 1.2.3.4")
+	assert.NoError(t, err)
+	delMsg.Remove([]dns.RR{delRR})
+
+	w2 := &completeMockResponseWriter{}
+	ctx2 := &plugins.PluginContext{ResponseWriter: w2}
+	assert.NoError(t, p.Execute(ctx2, delMsg))
+	assert.Equal(t, dns.RcodeSuccess, w2.writtenMsgs[0].Rcode)
+
+	records, err = p.GetZoneRecords("example.com.")
+	assert.NoError(t, err)
+	for _, r := range records {
+		assert.NotEqual(t, addRR.String(), r.RR.String(), "record should have been removed by the delete update")
+	}
+}
+
+func TestUpdatePrerequisiteFailures(t *testing.T) {
+	p := New("") // In-memory
+	p.AddZone("example.com.")
+	existingRR, _ := dns.NewRR("www.example.com. 300 IN A 1.2.3.4")
+	_, err := p.AddZoneRecord("example.com.", existingRR)
+	assert.NoError(t, err)
+
+	run := func(setPrereq func(m *dns.Msg), wantRcode int) {
+		m := new(dns.Msg)
+		m.SetUpdate("example.com.")
+		setPrereq(m)
+		// Harmless no-op update so a failed prerequisite is the only thing
+		// that can produce a non-success rcode.
+		w := &completeMockResponseWriter{}
+		ctx := &plugins.PluginContext{ResponseWriter: w}
+		assert.NoError(t, p.Execute(ctx, m))
+		assert.Equal(t, wantRcode, w.writtenMsgs[0].Rcode)
+	}
+
+	// RRset-does-not-exist on an RRset that does exist => YXRRSET
+	run(func(m *dns.Msg) {
+		m.RRsetNotUsed([]dns.RR{&dns.A{Hdr: dns.RR_Header{Name: "www.example.com.", Rrtype: dns.TypeA}}})
+	}, dns.RcodeYXRrset)
+
+	// RRset-exists (value-independent) for a type that has no records => NXRRSET
+	run(func(m *dns.Msg) {
+		m.RRsetUsed([]dns.RR{&dns.MX{Hdr: dns.RR_Header{Name: "www.example.com.", Rrtype: dns.TypeMX}}})
+	}, dns.RcodeNXRrset)
+
+	// Name-not-in-use for a name that is in use => YXDOMAIN
+	run(func(m *dns.Msg) {
+		m.NameNotUsed([]dns.RR{&dns.A{Hdr: dns.RR_Header{Name: "www.example.com."}}})
+	}, dns.RcodeYXDomain)
+
+	// "Name in use" for a name that isn't => NXDOMAIN
+	run(func(m *dns.Msg) {
+		m.NameUsed([]dns.RR{&dns.A{Hdr: dns.RR_Header{Name: "nosuchname.example.com."}}})
+	}, dns.RcodeNameError)
+}
+
+func TestUpdateRejectedByACL(t *testing.T) {
+	p := New("") // In-memory
+	p.AddZone("example.com.")
+	assert.NoError(t, p.SetUpdateACL("example.com.", []string{"10.0.0.0/8"}, false))
+
+	m := new(dns.Msg)
+	m.SetUpdate("example.com.")
+	addRR, _ := dns.NewRR("www.example.com. 300 IN A 1.2.3.4")
+	m.Insert([]dns.RR{addRR})
+
+	w := &completeMockResponseWriter{}
+	ctx := &plugins.PluginContext{ResponseWriter: w}
+	assert.NoError(t, p.Execute(ctx, m))
+	assert.Equal(t, dns.RcodeRefused, w.writtenMsgs[0].Rcode)
+}
@@ -0,0 +1,165 @@
+package authoritative
+
+// Zone aliases let several FQDNs share one zone's record store, so e.g.
+// "example.com." and "example.net." can be served identically without
+// duplicating records. findZone resolves an alias to the same *Zone as its
+// canonical origin (see zoneindex.go); answers are then rewritten so owner
+// names in the response reflect the alias the client actually queried
+// rather than the zone's canonical Name.
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// AddZoneAlias registers alias as an additional FQDN resolving to the same
+// zone's record store as canonical. It refuses an alias that collides with
+// an existing zone or alias, or that would make a zone alias itself.
+func (p *AuthoritativePlugin) AddZoneAlias(canonical, alias string) error {
+	cn := dns.Fqdn(strings.ToLower(canonical))
+	an := dns.Fqdn(strings.ToLower(alias))
+	if an == cn {
+		return fmt.Errorf("zone %s cannot alias itself", cn)
+	}
+
+	p.mu.Lock()
+
+	z, ok := p.zones[cn]
+	if !ok {
+		p.mu.Unlock()
+		return fmt.Errorf("zone not found: %s", canonical)
+	}
+	if _, ok := p.zones[an]; ok {
+		p.mu.Unlock()
+		return fmt.Errorf("alias %s collides with an existing zone", an)
+	}
+	if owner, ok := p.zoneIndex.lookup(an); ok && owner.Name == an {
+		p.mu.Unlock()
+		return fmt.Errorf("alias %s collides with an existing zone", an)
+	}
+	for _, existing := range z.Aliases {
+		if existing == an {
+			p.mu.Unlock()
+			return nil // already aliased
+		}
+	}
+	for other, oz := range p.zones {
+		if other == cn {
+			continue
+		}
+		for _, existing := range oz.Aliases {
+			if existing == an {
+				p.mu.Unlock()
+				return fmt.Errorf("alias %s is already used by zone %s", an, oz.Name)
+			}
+		}
+	}
+
+	z.mu.Lock()
+	z.Aliases = append(z.Aliases, an)
+	z.mu.Unlock()
+	p.zoneIndex.insertName(an, z)
+	p.mu.Unlock()
+
+	return p.saveToFile(p.GetZoneDTOs())
+}
+
+// RemoveZoneAlias deregisters alias from canonical's zone.
+func (p *AuthoritativePlugin) RemoveZoneAlias(canonical, alias string) error {
+	cn := dns.Fqdn(strings.ToLower(canonical))
+	an := dns.Fqdn(strings.ToLower(alias))
+
+	p.mu.Lock()
+
+	z, ok := p.zones[cn]
+	if !ok {
+		p.mu.Unlock()
+		return fmt.Errorf("zone not found: %s", canonical)
+	}
+
+	z.mu.Lock()
+	found := false
+	out := z.Aliases[:0]
+	for _, existing := range z.Aliases {
+		if existing == an {
+			found = true
+			continue
+		}
+		out = append(out, existing)
+	}
+	z.Aliases = out
+	z.mu.Unlock()
+	if !found {
+		p.mu.Unlock()
+		return fmt.Errorf("zone %s has no alias %s", cn, an)
+	}
+	p.zoneIndex.delete(an)
+	p.mu.Unlock()
+
+	return p.saveToFile(p.GetZoneDTOs())
+}
+
+// findZoneWithOrigin is like findZone but also reports which name actually
+// matched — the zone's canonical Name, or the specific alias a client
+// queried — so Execute can rewrite response owner names to match.
+func (p *AuthoritativePlugin) findZoneWithOrigin(qName string) (*Zone, string, bool) {
+	q := dns.Fqdn(strings.ToLower(qName))
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.zoneIndex.lookupOrigin(q)
+}
+
+// rewriteResponseOwners rewrites every owner name in res.Answer/Ns/Extra
+// from the zone's canonical origin to matchedOrigin; a no-op when the query
+// matched the zone's canonical name rather than an alias.
+func rewriteResponseOwners(res *dns.Msg, canonical, matchedOrigin string) {
+	if canonical == matchedOrigin {
+		return
+	}
+	res.Answer = rewriteOwnerNames(res.Answer, canonical, matchedOrigin)
+	res.Ns = rewriteOwnerNames(res.Ns, canonical, matchedOrigin)
+	res.Extra = rewriteOwnerNames(res.Extra, canonical, matchedOrigin)
+}
+
+// rewriteOwnerNames rewrites the owner name of every RR in rrs whose name
+// ends in "from" (the zone's canonical origin) to end in "to" (the alias
+// the client queried) instead, leaving everything else untouched. It
+// mutates shallow copies so the zone's stored records are never modified.
+func rewriteOwnerNames(rrs []dns.RR, from, to string) []dns.RR {
+	if from == to || len(rrs) == 0 {
+		return rrs
+	}
+	out := make([]dns.RR, len(rrs))
+	for i, rr := range rrs {
+		out[i] = rewriteOwnerName(rr, from, to)
+	}
+	return out
+}
+
+// rewriteOwnerName returns a copy of rr with its owner name's "from" suffix
+// (and, for SOA, the MNAME/RNAME fields) replaced by "to"; rr is returned
+// unmodified if its owner name doesn't end in "from".
+func rewriteOwnerName(rr dns.RR, from, to string) dns.RR {
+	name := rr.Header().Name
+	if !strings.HasSuffix(strings.ToLower(name), strings.ToLower(from)) {
+		return rr
+	}
+	cp := dns.Copy(rr)
+	cp.Header().Name = rewriteSuffix(name, from, to)
+	if soa, ok := cp.(*dns.SOA); ok {
+		soa.Ns = rewriteSuffix(soa.Ns, from, to)
+		soa.Mbox = rewriteSuffix(soa.Mbox, from, to)
+	}
+	return cp
+}
+
+// rewriteSuffix replaces a trailing "from" on name with "to", leaving name
+// unchanged if it doesn't end in "from".
+func rewriteSuffix(name, from, to string) string {
+	if !strings.HasSuffix(strings.ToLower(name), strings.ToLower(from)) {
+		return name
+	}
+	return name[:len(name)-len(from)] + to
+}
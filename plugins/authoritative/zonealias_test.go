@@ -0,0 +1,54 @@
+package authoritative
+
+import (
+	"testing"
+
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAddZoneAliasResolvesToSameZone(t *testing.T) {
+	p := New("") // in-memory
+	assert.NoError(t, p.AddZone("example.com."))
+	assert.NoError(t, p.AddZoneAlias("example.com.", "example.net."))
+
+	canonical, ok := p.findZone("example.com.")
+	assert.True(t, ok)
+	alias, ok := p.findZone("example.net.")
+	assert.True(t, ok)
+	assert.Same(t, canonical, alias)
+}
+
+func TestAddZoneAliasRejectsCollisionWithExistingZone(t *testing.T) {
+	p := New("") // in-memory
+	assert.NoError(t, p.AddZone("example.com."))
+	assert.NoError(t, p.AddZone("example.net."))
+
+	err := p.AddZoneAlias("example.com.", "example.net.")
+	assert.Error(t, err)
+}
+
+func TestAddZoneAliasRejectsSelfAlias(t *testing.T) {
+	p := New("") // in-memory
+	assert.NoError(t, p.AddZone("example.com."))
+	assert.Error(t, p.AddZoneAlias("example.com.", "example.com."))
+}
+
+func TestRemoveZoneAlias(t *testing.T) {
+	p := New("") // in-memory
+	assert.NoError(t, p.AddZone("example.com."))
+	assert.NoError(t, p.AddZoneAlias("example.com.", "example.net."))
+
+	assert.NoError(t, p.RemoveZoneAlias("example.com.", "example.net."))
+	_, ok := p.findZone("example.net.")
+	assert.False(t, ok)
+}
+
+func TestRewriteOwnerNamesReplacesSuffix(t *testing.T) {
+	aRR, err := dns.NewRR("www.example.com. 300 IN A 1.2.3.4")
+	assert.NoError(t, err)
+
+	out := rewriteOwnerNames([]dns.RR{aRR}, "example.com.", "example.net.")
+	assert.Equal(t, "www.example.net.", out[0].Header().Name)
+	assert.Equal(t, "www.example.com.", aRR.Header().Name) // original untouched
+}
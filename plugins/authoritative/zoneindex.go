@@ -0,0 +1,160 @@
+package authoritative
+
+// Reverse-label radix trie used to resolve the longest matching zone for a
+// query name in O(labels) instead of scanning every zone under p.mu on each
+// query. The trie is keyed by FQDN labels in reverse (TLD-first) order, with
+// a Zone pointer stored at the node that terminates its origin; findZone
+// walks the trie top-down, tracking the deepest node seen with a zone.
+
+import (
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+type zoneTrieNode struct {
+	children map[string]*zoneTrieNode
+	zone     *Zone // non-nil when this node terminates a zone origin
+}
+
+// zoneTrie indexes zones by their FQDN origin for fast longest-suffix match.
+type zoneTrie struct {
+	root *zoneTrieNode
+}
+
+func newZoneTrie() *zoneTrie {
+	return &zoneTrie{root: &zoneTrieNode{children: make(map[string]*zoneTrieNode)}}
+}
+
+// reverseLabels splits an FQDN into its labels in reverse (TLD-first) order,
+// e.g. "www.example.com." -> ["com", "example", "www"].
+func reverseLabels(fqdn string) []string {
+	labels := dns.SplitDomainName(fqdn)
+	out := make([]string, len(labels))
+	for i, l := range labels {
+		out[len(labels)-1-i] = strings.ToLower(l)
+	}
+	return out
+}
+
+// insert adds or replaces the trie entries for z.Name and every z.Aliases
+// entry, all pointing at the same Zone (see zonealias.go).
+func (t *zoneTrie) insert(z *Zone) {
+	t.insertName(z.Name, z)
+	for _, alias := range z.Aliases {
+		t.insertName(alias, z)
+	}
+}
+
+// insertName adds or replaces the trie entry for a single FQDN, independent
+// of whether it's a zone's canonical origin or one of its aliases.
+func (t *zoneTrie) insertName(name string, z *Zone) {
+	n := t.root
+	for _, l := range reverseLabels(name) {
+		child, ok := n.children[l]
+		if !ok {
+			child = &zoneTrieNode{children: make(map[string]*zoneTrieNode)}
+			n.children[l] = child
+		}
+		n = child
+	}
+	n.zone = z
+}
+
+// delete removes the trie entry for the given zone origin, pruning any
+// now-empty nodes back up towards the root.
+func (t *zoneTrie) delete(name string) {
+	labels := reverseLabels(name)
+	path := make([]*zoneTrieNode, 1, len(labels)+1)
+	path[0] = t.root
+	n := t.root
+	for _, l := range labels {
+		child, ok := n.children[l]
+		if !ok {
+			return
+		}
+		path = append(path, child)
+		n = child
+	}
+	n.zone = nil
+	for i := len(path) - 1; i > 0; i-- {
+		node := path[i]
+		if node.zone != nil || len(node.children) > 0 {
+			break
+		}
+		delete(path[i-1].children, labels[i-1])
+	}
+}
+
+// lookup walks qName top-down, returning the deepest zone whose origin is a
+// suffix of qName (i.e. the longest-suffix match).
+func (t *zoneTrie) lookup(qName string) (*Zone, bool) {
+	z, _, ok := t.lookupOrigin(qName)
+	return z, ok
+}
+
+// lookupOrigin is like lookup but also returns the matched trie key — the
+// zone's canonical origin if that's what matched, or the specific alias
+// otherwise. Callers that rewrite owner names in a response (see
+// zonealias.go) need to know which name was actually queried.
+func (t *zoneTrie) lookupOrigin(qName string) (*Zone, string, bool) {
+	n := t.root
+	best := n.zone
+	bestLabels := 0
+	labels := reverseLabels(qName)
+	for i, l := range labels {
+		child, ok := n.children[l]
+		if !ok {
+			break
+		}
+		n = child
+		if n.zone != nil {
+			best = n.zone
+			bestLabels = i + 1
+		}
+	}
+	if best == nil {
+		return nil, "", false
+	}
+	origin := dns.Fqdn(strings.Join(reverseJoin(labels[:bestLabels]), "."))
+	return best, origin, true
+}
+
+// reverseJoin un-reverses a TLD-first label slice back into registration
+// order, e.g. ["com", "example"] -> ["example", "com"].
+func reverseJoin(labels []string) []string {
+	out := make([]string, len(labels))
+	for i, l := range labels {
+		out[len(labels)-1-i] = l
+	}
+	return out
+}
+
+// ZoneIndexStats reports the zone trie's shape for observability.
+type ZoneIndexStats struct {
+	Nodes int
+	Depth int
+}
+
+func (t *zoneTrie) stats() ZoneIndexStats {
+	var st ZoneIndexStats
+	var walk func(n *zoneTrieNode, depth int)
+	walk = func(n *zoneTrieNode, depth int) {
+		st.Nodes++
+		if depth > st.Depth {
+			st.Depth = depth
+		}
+		for _, c := range n.children {
+			walk(c, depth+1)
+		}
+	}
+	walk(t.root, 0)
+	return st
+}
+
+// ZoneIndexStats reports the current zone index's node count and depth.
+func (p *AuthoritativePlugin) ZoneIndexStats() ZoneIndexStats {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.zoneIndex.stats()
+}
@@ -0,0 +1,95 @@
+package authoritative
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestZoneTrieLongestSuffixMatch(t *testing.T) {
+	trie := newZoneTrie()
+	trie.insert(&Zone{Name: "example.com."})
+	trie.insert(&Zone{Name: "sub.example.com."})
+
+	z, ok := trie.lookup("www.sub.example.com.")
+	assert.True(t, ok)
+	assert.Equal(t, "sub.example.com.", z.Name)
+
+	z, ok = trie.lookup("other.example.com.")
+	assert.True(t, ok)
+	assert.Equal(t, "example.com.", z.Name)
+
+	_, ok = trie.lookup("example.net.")
+	assert.False(t, ok)
+}
+
+func TestZoneTrieDeletePrunesNodes(t *testing.T) {
+	trie := newZoneTrie()
+	trie.insert(&Zone{Name: "example.com."})
+	before := trie.stats()
+
+	trie.delete("example.com.")
+	after := trie.stats()
+	assert.Less(t, after.Nodes, before.Nodes)
+
+	_, ok := trie.lookup("example.com.")
+	assert.False(t, ok)
+}
+
+func TestZoneIndexStats(t *testing.T) {
+	p := New("")
+	assert.NoError(t, p.AddZone("example.com."))
+	assert.NoError(t, p.AddZone("example.net."))
+
+	stats := p.ZoneIndexStats()
+	assert.Greater(t, stats.Nodes, 0)
+	assert.Greater(t, stats.Depth, 0)
+}
+
+// linearFindZone mirrors the O(n) scan findZone used before the zone index
+// trie, kept here only to benchmark the trie against it.
+func linearFindZone(zones map[string]*Zone, qName string) (*Zone, bool) {
+	q := dns.Fqdn(strings.ToLower(qName))
+	var best *Zone
+	var bestLen int
+	for _, z := range zones {
+		if strings.HasSuffix(q, z.Name) && len(z.Name) > bestLen {
+			best = z
+			bestLen = len(z.Name)
+		}
+	}
+	return best, best != nil
+}
+
+func setupZoneBenchmark(n int) (map[string]*Zone, *zoneTrie) {
+	zones := make(map[string]*Zone, n)
+	trie := newZoneTrie()
+	for i := 0; i < n; i++ {
+		name := dns.Fqdn(fmt.Sprintf("zone%d.example.com.", i))
+		z := &Zone{Name: name}
+		zones[name] = z
+		trie.insert(z)
+	}
+	return zones, trie
+}
+
+func BenchmarkFindZoneLinear10k(b *testing.B) {
+	zones, _ := setupZoneBenchmark(10000)
+	qName := "www.zone9999.example.com."
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		linearFindZone(zones, qName)
+	}
+}
+
+func BenchmarkFindZoneTrie10k(b *testing.B) {
+	_, trie := setupZoneBenchmark(10000)
+	qName := "www.zone9999.example.com."
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		trie.lookup(qName)
+	}
+}
@@ -0,0 +1,184 @@
+package loadbalancer
+
+import (
+	"net"
+	"strings"
+
+	"dns-resolver/internal/ecs"
+
+	"github.com/miekg/dns"
+)
+
+// geoSelect implements the "geoip" policy: it buckets backends into three
+// tiers by how closely they match the querying client's location -
+// exact country, same continent, then the global (empty Country) catch-all
+// - and applies weightedRoundRobin within the first non-empty tier. A
+// client the GeoIP database can't place (no reader configured, or lookup
+// failure) is treated as having no location, which falls through to the
+// global tier same as an unmapped country would.
+func (p *LoadBalancerPlugin) geoSelect(pool *Pool, backends []*Backend, msg *dns.Msg, remoteAddr net.Addr) *Backend {
+	country, continent := p.clientLocation(msg, remoteAddr)
+
+	var exact, sameContinent, global []*Backend
+	for _, b := range backends {
+		switch {
+		case b.Country == "":
+			global = append(global, b)
+		case country != "" && strings.EqualFold(b.Country, country):
+			exact = append(exact, b)
+		case continent != "" && continentOf(b.Country) == continent:
+			sameContinent = append(sameContinent, b)
+		}
+	}
+
+	switch {
+	case len(exact) > 0:
+		return p.weightedRoundRobin(pool, exact)
+	case len(sameContinent) > 0:
+		return p.weightedRoundRobin(pool, sameContinent)
+	case len(global) > 0:
+		return p.weightedRoundRobin(pool, global)
+	default:
+		// No backend has an empty Country and none matched; better to
+		// answer from the full pool than refuse the query outright.
+		return p.weightedRoundRobin(pool, backends)
+	}
+}
+
+// clientLocation derives the querying client's country and continent ISO
+// codes, preferring the address carried in an RFC 7871 EDNS Client Subnet
+// option on msg (set by a recursive resolver forwarding on behalf of its
+// own clients) and falling back to remoteAddr, the address the query
+// actually arrived from. Either empty string means the client couldn't be
+// placed - no GeoIP database configured, no usable address, or a lookup
+// miss.
+func (p *LoadBalancerPlugin) clientLocation(msg *dns.Msg, remoteAddr net.Addr) (country, continent string) {
+	if p.geoIP == nil {
+		return "", ""
+	}
+
+	ip := ecsClientIP(msg)
+	if ip == nil {
+		ip = hostIP(remoteAddr)
+	}
+	if ip == nil {
+		return "", ""
+	}
+
+	record, err := p.geoIP.Country(ip)
+	if err != nil {
+		return "", ""
+	}
+	return record.Country.IsoCode, record.Continent.Code
+}
+
+// ecsClientIP returns the address carried in msg's EDNS Client Subnet
+// option, if any. The option already stores it masked to SourceNetmask
+// bits, which is precise enough for a country-level GeoIP lookup.
+func ecsClientIP(msg *dns.Msg) net.IP {
+	subnet, ok := ecs.FromMsg(msg)
+	if !ok {
+		return nil
+	}
+	return subnet.Address
+}
+
+// hostIP extracts the IP from a dns.ResponseWriter.RemoteAddr()-style
+// net.Addr, which may or may not carry a port.
+func hostIP(addr net.Addr) net.IP {
+	if addr == nil {
+		return nil
+	}
+	host, _, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		host = addr.String()
+	}
+	return net.ParseIP(host)
+}
+
+// echoECS mirrors the EDNS Client Subnet option from req onto res with
+// SourceScope set to 0, the RFC 7871 signal that the answer doesn't vary
+// within the subnet the client supplied - true here since the geoip policy
+// only ever distinguishes by country/continent, never by subnet - so a
+// downstream cache can safely share this answer across every client in
+// that bucket instead of partitioning by subnet (see
+// backend/caching.storageKey, which already honors a SourceScope of 0).
+// It is a no-op if req carried no ECS option.
+func echoECS(req, res *dns.Msg) {
+	reqOpt := req.IsEdns0()
+	subnet, ok := ecs.FromMsg(req)
+	if reqOpt == nil || !ok {
+		return
+	}
+
+	resOpt := res.IsEdns0()
+	if resOpt == nil {
+		res.SetEdns0(reqOpt.UDPSize(), reqOpt.Do())
+		resOpt = res.IsEdns0()
+	}
+
+	resOpt.Option = append(resOpt.Option, &dns.EDNS0_SUBNET{
+		Family:        subnet.Family,
+		SourceNetmask: subnet.SourceNetmask,
+		SourceScope:   0,
+		Address:       subnet.Address,
+	})
+}
+
+// continentOf maps an ISO 3166-1 alpha-2 country code to its ISO/UN M49
+// two-letter continent code (AF, AN, AS, EU, NA, OC, SA), the same scheme
+// MaxMind's GeoLite2-Country database uses for Continent.Code. A country
+// not in this table returns "", which geoSelect treats as no continent
+// match rather than an error.
+func continentOf(country string) string {
+	return countryContinent[strings.ToUpper(country)]
+}
+
+var countryContinent = map[string]string{
+	// Africa
+	"DZ": "AF", "AO": "AF", "BJ": "AF", "BW": "AF", "BF": "AF", "BI": "AF",
+	"CM": "AF", "CV": "AF", "CF": "AF", "TD": "AF", "KM": "AF", "CG": "AF",
+	"CD": "AF", "CI": "AF", "DJ": "AF", "EG": "AF", "GQ": "AF", "ER": "AF",
+	"SZ": "AF", "ET": "AF", "GA": "AF", "GM": "AF", "GH": "AF", "GN": "AF",
+	"GW": "AF", "KE": "AF", "LS": "AF", "LR": "AF", "LY": "AF", "MG": "AF",
+	"MW": "AF", "ML": "AF", "MR": "AF", "MU": "AF", "MA": "AF", "MZ": "AF",
+	"NA": "AF", "NE": "AF", "NG": "AF", "RW": "AF", "ST": "AF", "SN": "AF",
+	"SC": "AF", "SL": "AF", "SO": "AF", "ZA": "AF", "SS": "AF", "SD": "AF",
+	"TZ": "AF", "TG": "AF", "TN": "AF", "UG": "AF", "ZM": "AF", "ZW": "AF",
+
+	// Asia
+	"AF": "AS", "AM": "AS", "AZ": "AS", "BH": "AS", "BD": "AS", "BT": "AS",
+	"BN": "AS", "KH": "AS", "CN": "AS", "CY": "AS", "GE": "AS", "IN": "AS",
+	"ID": "AS", "IR": "AS", "IQ": "AS", "IL": "AS", "JP": "AS", "JO": "AS",
+	"KZ": "AS", "KW": "AS", "KG": "AS", "LA": "AS", "LB": "AS", "MY": "AS",
+	"MV": "AS", "MN": "AS", "MM": "AS", "NP": "AS", "KP": "AS", "OM": "AS",
+	"PK": "AS", "PS": "AS", "PH": "AS", "QA": "AS", "SA": "AS", "SG": "AS",
+	"KR": "AS", "LK": "AS", "SY": "AS", "TW": "AS", "TJ": "AS", "TH": "AS",
+	"TL": "AS", "TR": "AS", "TM": "AS", "AE": "AS", "UZ": "AS", "VN": "AS",
+	"YE": "AS",
+
+	// Europe
+	"AL": "EU", "AD": "EU", "AT": "EU", "BY": "EU", "BE": "EU", "BA": "EU",
+	"BG": "EU", "HR": "EU", "CZ": "EU", "DK": "EU", "EE": "EU", "FI": "EU",
+	"FR": "EU", "DE": "EU", "GR": "EU", "HU": "EU", "IS": "EU", "IE": "EU",
+	"IT": "EU", "XK": "EU", "LV": "EU", "LI": "EU", "LT": "EU", "LU": "EU",
+	"MT": "EU", "MD": "EU", "MC": "EU", "ME": "EU", "NL": "EU", "MK": "EU",
+	"NO": "EU", "PL": "EU", "PT": "EU", "RO": "EU", "RU": "EU", "SM": "EU",
+	"RS": "EU", "SK": "EU", "SI": "EU", "ES": "EU", "SE": "EU", "CH": "EU",
+	"UA": "EU", "GB": "EU", "VA": "EU",
+
+	// North America
+	"AG": "NA", "BS": "NA", "BB": "NA", "BZ": "NA", "CA": "NA", "CR": "NA",
+	"CU": "NA", "DM": "NA", "DO": "NA", "SV": "NA", "GD": "NA", "GT": "NA",
+	"HT": "NA", "HN": "NA", "JM": "NA", "MX": "NA", "NI": "NA", "PA": "NA",
+	"KN": "NA", "LC": "NA", "VC": "NA", "TT": "NA", "US": "NA",
+
+	// Oceania
+	"AU": "OC", "FJ": "OC", "KI": "OC", "MH": "OC", "FM": "OC", "NR": "OC",
+	"NZ": "OC", "PW": "OC", "PG": "OC", "WS": "OC", "SB": "OC", "TO": "OC",
+	"TV": "OC", "VU": "OC",
+
+	// South America
+	"AR": "SA", "BO": "SA", "BR": "SA", "CL": "SA", "CO": "SA", "EC": "SA",
+	"GY": "SA", "PY": "SA", "PE": "SA", "SR": "SA", "UY": "SA", "VE": "SA",
+}
@@ -0,0 +1,214 @@
+package loadbalancer
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// ProbeKind selects which active health check HealthCheckConfig.Kind runs
+// against a backend. ProbeTCP (the zero value) just dials; the others
+// exercise enough of the backend's actual protocol to catch a failure a
+// bare dial would miss, e.g. a SOCKS proxy that accepts connections but
+// hangs on the handshake.
+type ProbeKind string
+
+const (
+	ProbeTCP    ProbeKind = "tcp"
+	ProbeHTTP   ProbeKind = "http"
+	ProbeDNS    ProbeKind = "dns"
+	ProbeSOCKS5 ProbeKind = "socks5"
+)
+
+const (
+	defaultProbeTimeout                  = 5 * time.Second
+	defaultConsecutiveFailuresToFail     = 3
+	defaultConsecutiveSuccessesToRecover = 2
+	defaultMaxConcurrentProbes           = 10
+)
+
+// HealthCheckConfig configures the active probe checkPoolHealth runs
+// against every backend in a Pool. The zero value reproduces the
+// original behavior: a bare TCP dial, gated by the default consecutive
+// failure/success thresholds.
+type HealthCheckConfig struct {
+	Kind    ProbeKind     `json:"kind,omitempty"`
+	Timeout time.Duration `json:"timeout,omitempty"`
+
+	// HTTPPath, HTTPExpectStatuses and HTTPExpectBodyContains configure
+	// the "http" probe. HTTPExpectStatuses defaults to [200] if empty;
+	// HTTPExpectBodyContains is skipped if empty.
+	HTTPPath               string `json:"httpPath,omitempty"`
+	HTTPExpectStatuses     []int  `json:"httpExpectStatuses,omitempty"`
+	HTTPExpectBodyContains string `json:"httpExpectBodyContains,omitempty"`
+
+	// DNSQueryName and DNSQueryType configure the "dns" probe's canary
+	// query, defaulting to "." IN A. The probe requires NOERROR and at
+	// least one answer.
+	DNSQueryName string `json:"dnsQueryName,omitempty"`
+	DNSQueryType uint16 `json:"dnsQueryType,omitempty"`
+
+	// ConsecutiveFailuresToFail and ConsecutiveSuccessesToRecover gate
+	// the backend's Healthy flip so a single blip doesn't drain the
+	// pool. Zero defaults to 3 and 2 respectively.
+	ConsecutiveFailuresToFail     int `json:"consecutiveFailuresToFail,omitempty"`
+	ConsecutiveSuccessesToRecover int `json:"consecutiveSuccessesToRecover,omitempty"`
+
+	// MaxConcurrentProbes bounds how many of this pool's backends are
+	// probed at once. Zero defaults to 10.
+	MaxConcurrentProbes int `json:"maxConcurrentProbes,omitempty"`
+}
+
+// probe runs hc's configured probe kind against address and reports
+// whether it succeeded, along with how long it took.
+func probe(hc *HealthCheckConfig, address string) (ok bool, latency time.Duration, err error) {
+	timeout := hc.Timeout
+	if timeout <= 0 {
+		timeout = defaultProbeTimeout
+	}
+
+	start := time.Now()
+	switch hc.Kind {
+	case ProbeHTTP:
+		err = probeHTTP(hc, address, timeout)
+	case ProbeDNS:
+		err = probeDNS(hc, address, timeout)
+	case ProbeSOCKS5:
+		err = probeSOCKS5(address, timeout)
+	default:
+		err = probeTCP(address, timeout)
+	}
+	return err == nil, time.Since(start), err
+}
+
+// probeTCP dials address, defaulting to the SOCKS5 port 1080 if it
+// carries no port of its own - the same assumption the original dial-only
+// health check made.
+func probeTCP(address string, timeout time.Duration) error {
+	addr := withDefaultPort(address, "1080")
+	conn, err := net.DialTimeout("tcp", addr, timeout)
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
+
+// probeHTTP issues a GET to address+hc.HTTPPath and requires one of
+// hc.HTTPExpectStatuses (default [200]), plus hc.HTTPExpectBodyContains in
+// the body if set.
+func probeHTTP(hc *HealthCheckConfig, address string, timeout time.Duration) error {
+	path := hc.HTTPPath
+	if path == "" {
+		path = "/"
+	}
+	url := "http://" + address + path
+
+	client := &http.Client{Timeout: timeout}
+	resp, err := client.Get(url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	expect := hc.HTTPExpectStatuses
+	if len(expect) == 0 {
+		expect = []int{http.StatusOK}
+	}
+	statusOK := false
+	for _, s := range expect {
+		if resp.StatusCode == s {
+			statusOK = true
+			break
+		}
+	}
+	if !statusOK {
+		return fmt.Errorf("http probe: %s returned unexpected status %d", url, resp.StatusCode)
+	}
+
+	if hc.HTTPExpectBodyContains == "" {
+		return nil
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if !strings.Contains(string(body), hc.HTTPExpectBodyContains) {
+		return fmt.Errorf("http probe: %s response body did not contain %q", url, hc.HTTPExpectBodyContains)
+	}
+	return nil
+}
+
+// probeDNS sends hc's canary query (default "." IN A) to address over UDP
+// and requires a NOERROR reply with at least one answer.
+func probeDNS(hc *HealthCheckConfig, address string, timeout time.Duration) error {
+	name := hc.DNSQueryName
+	if name == "" {
+		name = "."
+	}
+	qtype := hc.DNSQueryType
+	if qtype == 0 {
+		qtype = dns.TypeA
+	}
+	addr := withDefaultPort(address, "53")
+
+	msg := new(dns.Msg)
+	msg.SetQuestion(dns.Fqdn(name), qtype)
+
+	client := &dns.Client{Timeout: timeout}
+	resp, _, err := client.Exchange(msg, addr)
+	if err != nil {
+		return err
+	}
+	if resp.Rcode != dns.RcodeSuccess {
+		return fmt.Errorf("dns probe: %s answered %s", addr, dns.RcodeToString[resp.Rcode])
+	}
+	if len(resp.Answer) == 0 {
+		return fmt.Errorf("dns probe: %s returned no answers for %s %s", addr, name, dns.TypeToString[qtype])
+	}
+	return nil
+}
+
+// probeSOCKS5 performs just the RFC 1928 greeting/method-selection
+// handshake, offering no-auth, which is enough to confirm a real SOCKS5
+// proxy is listening rather than some other TCP service answering on the
+// same port.
+func probeSOCKS5(address string, timeout time.Duration) error {
+	addr := withDefaultPort(address, "1080")
+
+	conn, err := net.DialTimeout("tcp", addr, timeout)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(timeout))
+
+	if _, err := conn.Write([]byte{0x05, 0x01, 0x00}); err != nil {
+		return err
+	}
+
+	reply := make([]byte, 2)
+	if _, err := io.ReadFull(conn, reply); err != nil {
+		return err
+	}
+	if reply[0] != 0x05 {
+		return fmt.Errorf("socks5 probe: %s is not speaking SOCKS5 (got version byte %d)", addr, reply[0])
+	}
+	if reply[1] == 0xFF {
+		return fmt.Errorf("socks5 probe: %s rejected the no-auth method", addr)
+	}
+	return nil
+}
+
+// withDefaultPort returns address unchanged if it already carries a port,
+// or joined with defaultPort otherwise.
+func withDefaultPort(address, defaultPort string) string {
+	if _, _, err := net.SplitHostPort(address); err == nil {
+		return address
+	}
+	return net.JoinHostPort(address, defaultPort)
+}
@@ -0,0 +1,110 @@
+package loadbalancer
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProbeTCP_SucceedsAgainstAListeningSocket(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+
+	ok, _, err := probe(&HealthCheckConfig{Kind: ProbeTCP}, ln.Addr().String())
+	assert.NoError(t, err)
+	assert.True(t, ok)
+}
+
+func TestProbeTCP_FailsAgainstARefusedPort(t *testing.T) {
+	ok, _, err := probe(&HealthCheckConfig{Kind: ProbeTCP}, "127.0.0.1:1")
+	assert.Error(t, err)
+	assert.False(t, ok)
+}
+
+func TestProbeHTTP_ChecksStatusAndBody(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok: healthy"))
+	}))
+	defer srv.Close()
+
+	hc := &HealthCheckConfig{Kind: ProbeHTTP, HTTPExpectBodyContains: "healthy"}
+	ok, _, err := probe(hc, srv.Listener.Addr().String())
+	assert.NoError(t, err)
+	assert.True(t, ok)
+
+	hc = &HealthCheckConfig{Kind: ProbeHTTP, HTTPExpectBodyContains: "unhealthy"}
+	ok, _, err = probe(hc, srv.Listener.Addr().String())
+	assert.Error(t, err)
+	assert.False(t, ok)
+}
+
+func TestProbeHTTP_RejectsUnexpectedStatus(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	ok, _, err := probe(&HealthCheckConfig{Kind: ProbeHTTP}, srv.Listener.Addr().String())
+	assert.Error(t, err)
+	assert.False(t, ok)
+}
+
+func TestProbeSOCKS5_RejectsPlainTCPService(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer ln.Close()
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		conn.Write([]byte("220 not a socks proxy\r\n"))
+	}()
+
+	ok, _, err := probe(&HealthCheckConfig{Kind: ProbeSOCKS5, Timeout: time.Second}, ln.Addr().String())
+	assert.Error(t, err)
+	assert.False(t, ok)
+}
+
+func TestCheckPoolHealth_DebouncesHealthyFlipAcrossConsecutiveProbes(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+
+	p := &LoadBalancerPlugin{}
+	backend := &Backend{Address: ln.Addr().String(), Weight: 1, Healthy: false}
+	pool := &Pool{Name: "test", Backends: []*Backend{backend}, HealthCheck: &HealthCheckConfig{
+		Kind:                          ProbeTCP,
+		ConsecutiveSuccessesToRecover: 2,
+	}}
+
+	p.checkPoolHealth(pool)
+	assert.False(t, backend.Healthy, "a single successful probe should not be enough to recover")
+
+	p.checkPoolHealth(pool)
+	assert.True(t, backend.Healthy, "two consecutive successful probes should recover the backend")
+}
@@ -1,12 +1,12 @@
 package loadbalancer
 
 import (
+	"dns-resolver/internal/metrics"
 	"dns-resolver/internal/plugins"
 	"github.com/miekg/dns"
+	"github.com/oschwald/geoip2-golang"
 	"log"
-	"math/rand"
 	"net"
-	"sort"
 	"sync"
 	"time"
 )
@@ -19,6 +19,28 @@ type Backend struct {
 	Country string `json:"country"`
 	// for health checks
 	Healthy bool `json:"healthy"`
+
+	// currentWeight and effectiveWeight implement Nginx-style smooth
+	// weighted round-robin (see weightedRoundRobin): effectiveWeight starts
+	// at Weight and is nudged down on failures / recovered back up on
+	// successes, while currentWeight is the per-round accumulator that
+	// picks the next backend. Both are guarded by the owning Pool's mu.
+	currentWeight   int
+	effectiveWeight int
+
+	// pendingWeight, pendingHealthy and pendingSince debounce a Weight or
+	// Healthy value reported by an orchestrator poll (see
+	// observeOrchestratorState): the new values are only applied once they
+	// have held steady across polls for a pool's PoolWeightChangeDebounce,
+	// so a brief orchestrator flap doesn't thrash the pool.
+	pendingWeight  int
+	pendingHealthy bool
+	pendingSince   time.Time
+
+	// consecutiveFailures and consecutiveSuccesses back checkPoolHealth's
+	// debounced Healthy flip; see HealthCheckConfig.
+	consecutiveFailures  int
+	consecutiveSuccesses int
 }
 
 // Pool represents a collection of backends for a specific domain.
@@ -26,21 +48,67 @@ type Pool struct {
 	Name      string     `json:"name"` // e.g., "socks.example.com"
 	Backends  []*Backend `json:"backends"`
 	Policy    string     `json:"policy"` // "round-robin", "weighted-round-robin", "geoip"
+
+	// OrchestratorURL, if set, makes runOrchestratorRefresh poll it every
+	// RefreshInterval (default 5m) for the pool's backend list instead of
+	// the pool being managed purely through AddPool. See
+	// AddOrchestratedPool.
+	OrchestratorURL string        `json:"orchestratorUrl,omitempty"`
+	RefreshInterval time.Duration `json:"refreshInterval,omitempty"`
+	// PoolWeightChangeDebounce is how long a backend's Weight or Healthy
+	// value from the orchestrator must stay unchanged across polls before
+	// it's applied. Zero uses a 30s default.
+	PoolWeightChangeDebounce time.Duration `json:"poolWeightChangeDebounce,omitempty"`
+
 	mu        sync.RWMutex
 	nextIndex int // for round-robin
+
+	// stopOrchestrator, if non-nil, signals runOrchestratorRefresh to stop
+	// polling OrchestratorURL; closed by DeletePool.
+	stopOrchestrator chan struct{}
+
+	// HealthCheck configures the active probe startHealthChecks runs
+	// against this pool's backends. A nil value behaves like the original
+	// bare TCP dial with a 3-failure/2-success debounce; see
+	// HealthCheckConfig and probe.
+	HealthCheck *HealthCheckConfig `json:"healthCheck,omitempty"`
 }
 
 // LoadBalancerPlugin is the main plugin struct.
 type LoadBalancerPlugin struct {
 	pools map[string]*Pool
 	mu    sync.RWMutex
+
+	// geoIP backs the "geoip" policy's country/continent lookups; nil
+	// (no database configured, or it failed to open) makes geoSelect
+	// treat every client as unplaced, falling through to the global tier.
+	geoIP *geoip2.Reader
+
+	// metrics, if non-nil, receives per-backend probe outcome/latency
+	// observations from checkPoolHealth.
+	metrics *metrics.Metrics
 }
 
-// New creates a new LoadBalancerPlugin.
-func New() *LoadBalancerPlugin {
+// New creates a new LoadBalancerPlugin. geoIPDBPath, if non-empty, is a
+// MaxMind GeoLite2-Country (or GeoIP2-Country) .mmdb file used by the
+// "geoip" policy; an empty path or one that fails to open just disables
+// geoip-aware selection rather than failing plugin construction. m may be
+// nil to skip publishing health-probe metrics.
+func New(geoIPDBPath string, m *metrics.Metrics) *LoadBalancerPlugin {
 	lb := &LoadBalancerPlugin{
-		pools: make(map[string]*Pool),
+		pools:   make(map[string]*Pool),
+		metrics: m,
+	}
+
+	if geoIPDBPath != "" {
+		reader, err := geoip2.Open(geoIPDBPath)
+		if err != nil {
+			log.Printf("[LoadBalancer] failed to open GeoIP database %q, \"geoip\" pools will fall back to the global tier: %v", geoIPDBPath, err)
+		} else {
+			lb.geoIP = reader
+		}
 	}
+
 	go lb.startHealthChecks()
 	return lb
 }
@@ -66,7 +134,7 @@ func (p *LoadBalancerPlugin) Execute(ctx *plugins.PluginContext, msg *dns.Msg) e
 
 	log.Printf("[%s] handling request for %s", p.Name(), q.Name)
 
-	backend, err := p.selectBackend(pool, ctx.ResponseWriter.RemoteAddr().String())
+	backend, err := p.selectBackend(pool, msg, ctx.ResponseWriter.RemoteAddr())
 	if err != nil {
 		log.Printf("[%s] error selecting backend for %s: %v", p.Name(), q.Name, err)
 		return nil // Or handle error appropriately
@@ -75,6 +143,13 @@ func (p *LoadBalancerPlugin) Execute(ctx *plugins.PluginContext, msg *dns.Msg) e
 	res := new(dns.Msg)
 	res.SetReply(msg)
 
+	if pool.Policy == "geoip" {
+		// The backend was picked by country/continent, not by exact
+		// subnet, so downstream caches must key on the coarser tier
+		// rather than partitioning by the client's own subnet.
+		echoECS(msg, res)
+	}
+
 	// Create an A or AAAA record based on the backend address
 	ip := net.ParseIP(backend.Address)
 	if ip == nil {
@@ -100,8 +175,10 @@ func (p *LoadBalancerPlugin) Execute(ctx *plugins.PluginContext, msg *dns.Msg) e
 	return nil
 }
 
-// selectBackend selects a backend from a pool based on the configured policy.
-func (p *LoadBalancerPlugin) selectBackend(pool *Pool, clientIP string) (*Backend, error) {
+// selectBackend selects a backend from a pool based on the configured
+// policy. msg and remoteAddr are only consulted by the "geoip" policy, to
+// locate the querying client; see geoSelect.
+func (p *LoadBalancerPlugin) selectBackend(pool *Pool, msg *dns.Msg, remoteAddr net.Addr) (*Backend, error) {
 	pool.mu.Lock()
 	defer pool.mu.Unlock()
 
@@ -116,9 +193,7 @@ func (p *LoadBalancerPlugin) selectBackend(pool *Pool, clientIP string) (*Backen
 	case "weighted-round-robin":
 		return p.weightedRoundRobin(pool, healthyBackends), nil
 	case "geoip":
-		// GeoIP lookup logic would go here
-		// For now, fall back to round-robin
-		return p.roundRobin(pool, healthyBackends), nil
+		return p.geoSelect(pool, healthyBackends, msg, remoteAddr), nil
 	default:
 		return p.roundRobin(pool, healthyBackends), nil
 	}
@@ -145,88 +220,153 @@ func (p *LoadBalancerPlugin) roundRobin(pool *Pool, backends []*Backend) *Backen
 	return backend
 }
 
-// weightedRoundRobin selects a backend based on weights.
+// weightedRoundRobin selects a backend using Nginx's smooth weighted
+// round-robin algorithm: every healthy backend's effectiveWeight is added to
+// its currentWeight, the backend with the largest currentWeight is picked,
+// and total (the sum of all effectiveWeights) is subtracted from the
+// winner's currentWeight. Repeated over many calls this spreads picks evenly
+// across a cycle instead of clustering them, e.g. a {5,1,1} pool yields
+// A,A,B,A,C,A,A rather than A,A,A,A,A,B,C.
 func (p *LoadBalancerPlugin) weightedRoundRobin(pool *Pool, backends []*Backend) *Backend {
 	if len(backends) == 0 {
 		return nil
 	}
 
-	totalWeight := 0
+	total := 0
 	for _, b := range backends {
-		totalWeight += b.Weight
+		if b.effectiveWeight == 0 {
+			b.effectiveWeight = b.Weight
+		}
+		b.currentWeight += b.effectiveWeight
+		total += b.effectiveWeight
 	}
 
-	if totalWeight == 0 {
-		// If all weights are 0, fall back to simple round-robin
+	if total == 0 {
+		// If all weights are 0, fall back to simple round-robin.
 		return p.roundRobin(pool, backends)
 	}
 
-	// This is a common implementation of weighted round-robin.
-	// It's not perfectly smooth, but it's simple and effective.
-	for {
-		pool.nextIndex = (pool.nextIndex + 1) % len(backends)
-		if pool.nextIndex == 0 {
-			// When we've completed a cycle, we need to adjust the current weight
-			// This is a simplified version of the smooth weighted round-robin algorithm
-		}
-		// A simple approach is to select a backend with a probability proportional to its weight.
-		// A more advanced approach would be to use a GCD-based algorithm for smoother distribution.
-		// For now, we will use a simple random selection based on weight.
-		// This is not true weighted round-robin, but it's better than the previous implementation.
-		rand.Seed(time.Now().UnixNano())
-		r := rand.Intn(totalWeight)
-		for _, b := range backends {
-			r -= b.Weight
-			if r < 0 {
-				return b
-			}
+	best := backends[0]
+	for _, b := range backends[1:] {
+		if b.currentWeight > best.currentWeight {
+			best = b
 		}
 	}
+	best.currentWeight -= total
+	return best
 }
 
-// startHealthChecks starts a goroutine to periodically check the health of backends.
+// recordFailure nudges the backend's effectiveWeight down, to the floor of
+// 1, after a failed health probe or live request, so it's picked less often
+// by weightedRoundRobin without ever being starved entirely.
+func (b *Backend) recordFailure() {
+	if b.effectiveWeight > 1 {
+		b.effectiveWeight--
+	}
+}
+
+// recordSuccess nudges the backend's effectiveWeight back up toward its
+// configured Weight after a successful health probe or live request.
+func (b *Backend) recordSuccess() {
+	if b.effectiveWeight < b.Weight {
+		b.effectiveWeight++
+	}
+}
+
+// startHealthChecks starts a goroutine to periodically probe every pool's
+// backends.
 func (p *LoadBalancerPlugin) startHealthChecks() {
 	ticker := time.NewTicker(30 * time.Second)
 	// Don't defer Stop in a goroutine that runs for the lifetime of the app
 
 	for range ticker.C {
 		p.mu.RLock()
+		pools := make([]*Pool, 0, len(p.pools))
 		for _, pool := range p.pools {
-			go p.checkPoolHealth(pool)
+			pools = append(pools, pool)
 		}
 		p.mu.RUnlock()
+
+		for _, pool := range pools {
+			go p.checkPoolHealth(pool)
+		}
 	}
 }
 
-// checkPoolHealth checks the health of all backends in a pool.
+// checkPoolHealth runs pool.HealthCheck's active probe against every
+// backend in pool, bounded by its MaxConcurrentProbes (default 10) so a
+// large fleet's probes don't all fire at once.
 func (p *LoadBalancerPlugin) checkPoolHealth(pool *Pool) {
-	// Note: Locking the pool for the entire duration of health checks
-	// might be a bottleneck if checks are slow. Consider more granular locking.
+	pool.mu.RLock()
+	backends := append([]*Backend(nil), pool.Backends...)
+	hc := pool.HealthCheck
+	pool.mu.RUnlock()
+
+	if hc == nil {
+		hc = &HealthCheckConfig{}
+	}
+	concurrency := hc.MaxConcurrentProbes
+	if concurrency <= 0 {
+		concurrency = defaultMaxConcurrentProbes
+	}
+
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for _, backend := range backends {
+		backend := backend
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			p.probeBackend(pool, backend, hc)
+		}()
+	}
+	wg.Wait()
+}
+
+// probeBackend runs hc's probe against backend and updates its rolling
+// consecutive failure/success counts, flipping Healthy only once
+// ConsecutiveFailuresToFail (default 3) or ConsecutiveSuccessesToRecover
+// (default 2) probes in a row agree, so a single blip doesn't drain the
+// pool. Every probe's outcome and latency are reported to p.metrics, if
+// configured.
+func (p *LoadBalancerPlugin) probeBackend(pool *Pool, backend *Backend, hc *HealthCheckConfig) {
+	ok, latency, err := probe(hc, backend.Address)
+
+	if p.metrics != nil {
+		p.metrics.RecordLBProbeOutcome(pool.Name, backend.Address, ok, latency)
+	}
+
+	failThreshold := hc.ConsecutiveFailuresToFail
+	if failThreshold <= 0 {
+		failThreshold = defaultConsecutiveFailuresToFail
+	}
+	recoverThreshold := hc.ConsecutiveSuccessesToRecover
+	if recoverThreshold <= 0 {
+		recoverThreshold = defaultConsecutiveSuccessesToRecover
+	}
+
 	pool.mu.Lock()
 	defer pool.mu.Unlock()
 
-	for _, backend := range pool.Backends {
-		// For SOCKS proxy, a TCP dial is a good basic check.
-		// The address should be in "host:port" format.
-		// Assuming a default SOCKS port if not specified, e.g., 1080
-		addr := backend.Address
-		if _, _, err := net.SplitHostPort(addr); err != nil {
-			addr = net.JoinHostPort(addr, "1080") // Default SOCKS port
+	if ok {
+		backend.consecutiveSuccesses++
+		backend.consecutiveFailures = 0
+		backend.recordSuccess()
+		if !backend.Healthy && backend.consecutiveSuccesses >= recoverThreshold {
+			backend.Healthy = true
+			log.Printf("[%s] backend %s is now healthy", p.Name(), backend.Address)
 		}
+		return
+	}
 
-		conn, err := net.DialTimeout("tcp", addr, 5*time.Second)
-		if err != nil {
-			if backend.Healthy {
-				backend.Healthy = false
-				log.Printf("[%s] backend %s is now unhealthy: %v", p.Name(), backend.Address, err)
-			}
-		} else {
-			if !backend.Healthy {
-				backend.Healthy = true
-				log.Printf("[%s] backend %s is now healthy", p.Name(), backend.Address)
-			}
-			conn.Close()
-		}
+	backend.consecutiveFailures++
+	backend.consecutiveSuccesses = 0
+	backend.recordFailure()
+	if backend.Healthy && backend.consecutiveFailures >= failThreshold {
+		backend.Healthy = false
+		log.Printf("[%s] backend %s is now unhealthy: %v", p.Name(), backend.Address, err)
 	}
 }
 
@@ -258,9 +398,13 @@ func (p *LoadBalancerPlugin) GetPool(name string) (*Pool, bool) {
 	return pool, ok
 }
 
-// DeletePool removes a pool by name.
+// DeletePool removes a pool by name, stopping its orchestrator refresh
+// goroutine first if it has one.
 func (p *LoadBalancerPlugin) DeletePool(name string) {
 	p.mu.Lock()
 	defer p.mu.Unlock()
+	if pool, ok := p.pools[name]; ok && pool.stopOrchestrator != nil {
+		close(pool.stopOrchestrator)
+	}
 	delete(p.pools, name)
 }
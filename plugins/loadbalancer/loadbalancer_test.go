@@ -0,0 +1,96 @@
+package loadbalancer
+
+import (
+	"testing"
+
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWeightedRoundRobinSmoothDistribution(t *testing.T) {
+	p := &LoadBalancerPlugin{}
+	pool := &Pool{Name: "test"}
+	backends := []*Backend{
+		{Address: "10.0.0.1", Weight: 5, Healthy: true},
+		{Address: "10.0.0.2", Weight: 1, Healthy: true},
+		{Address: "10.0.0.3", Weight: 1, Healthy: true},
+	}
+	pool.Backends = backends
+
+	var got []string
+	for i := 0; i < 7; i++ {
+		b := p.weightedRoundRobin(pool, backends)
+		got = append(got, b.Address)
+	}
+
+	assert.Equal(t, []string{
+		"10.0.0.1", "10.0.0.1", "10.0.0.2", "10.0.0.1", "10.0.0.3", "10.0.0.1", "10.0.0.1",
+	}, got)
+}
+
+func TestWeightedRoundRobinAllZeroWeightsFallsBackToRoundRobin(t *testing.T) {
+	p := &LoadBalancerPlugin{}
+	pool := &Pool{Name: "test"}
+	backends := []*Backend{
+		{Address: "10.0.0.1", Weight: 0, Healthy: true},
+		{Address: "10.0.0.2", Weight: 0, Healthy: true},
+	}
+	pool.Backends = backends
+
+	first := p.weightedRoundRobin(pool, backends)
+	second := p.weightedRoundRobin(pool, backends)
+	assert.NotEqual(t, first.Address, second.Address)
+}
+
+func TestContinentOf(t *testing.T) {
+	assert.Equal(t, "EU", continentOf("DE"))
+	assert.Equal(t, "NA", continentOf("us"), "lookup should be case-insensitive")
+	assert.Equal(t, "", continentOf("XX"), "an unmapped code should return empty, not panic")
+}
+
+func TestGeoSelect_NoGeoIPReaderFallsBackToGlobalTier(t *testing.T) {
+	p := &LoadBalancerPlugin{} // geoIP is nil: every client is unplaced
+	pool := &Pool{Name: "test"}
+	backends := []*Backend{
+		{Address: "10.0.0.1", Weight: 1, Healthy: true, Country: "US"},
+		{Address: "10.0.0.2", Weight: 1, Healthy: true, Country: ""},
+	}
+
+	for i := 0; i < 5; i++ {
+		b := p.geoSelect(pool, backends, new(dns.Msg), nil)
+		assert.Equal(t, "10.0.0.2", b.Address, "an unplaced client should only ever land on a global (empty-Country) backend")
+	}
+}
+
+func TestGeoSelect_NoTierMatchFallsBackToFullPool(t *testing.T) {
+	p := &LoadBalancerPlugin{} // geoIP is nil: every client is unplaced
+	pool := &Pool{Name: "test"}
+	backends := []*Backend{
+		{Address: "10.0.0.1", Weight: 1, Healthy: true, Country: "US"},
+		{Address: "10.0.0.2", Weight: 1, Healthy: true, Country: "DE"},
+	}
+
+	b := p.geoSelect(pool, backends, new(dns.Msg), nil)
+	assert.Contains(t, []string{"10.0.0.1", "10.0.0.2"}, b.Address, "with no global backend and no location, it should still answer from the full pool rather than return nil")
+}
+
+func TestBackendRecordFailureAndSuccess(t *testing.T) {
+	b := &Backend{Weight: 5, effectiveWeight: 5}
+
+	b.recordFailure()
+	b.recordFailure()
+	assert.Equal(t, 3, b.effectiveWeight)
+
+	b.recordSuccess()
+	assert.Equal(t, 4, b.effectiveWeight)
+
+	for i := 0; i < 10; i++ {
+		b.recordSuccess()
+	}
+	assert.Equal(t, 5, b.effectiveWeight, "effectiveWeight should never recover past Weight")
+
+	for i := 0; i < 10; i++ {
+		b.recordFailure()
+	}
+	assert.Equal(t, 1, b.effectiveWeight, "effectiveWeight should never drop below 1")
+}
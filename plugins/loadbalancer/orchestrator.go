@@ -0,0 +1,152 @@
+package loadbalancer
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+)
+
+const (
+	defaultRefreshInterval          = 5 * time.Minute
+	defaultPoolWeightChangeDebounce = 30 * time.Second
+)
+
+var orchestratorHTTPClient = &http.Client{Timeout: 10 * time.Second}
+
+// AddOrchestratedPool creates a pool whose backend list is managed by
+// polling url (expected to respond with a JSON array of Backend objects)
+// every RefreshInterval, instead of a static list set through AddPool. The
+// pool is registered and polled once synchronously before returning, so
+// it's populated as soon as AddOrchestratedPool comes back, then kept in
+// sync by a background goroutine until DeletePool is called.
+func (p *LoadBalancerPlugin) AddOrchestratedPool(name, url, policy string) *Pool {
+	pool := &Pool{
+		Name:             name,
+		Policy:           policy,
+		OrchestratorURL:  url,
+		stopOrchestrator: make(chan struct{}),
+	}
+	p.AddPool(pool)
+
+	p.refreshOrchestratedPool(pool)
+	go p.runOrchestratorRefresh(pool)
+	return pool
+}
+
+// runOrchestratorRefresh polls pool.OrchestratorURL every RefreshInterval
+// until pool.stopOrchestrator is closed.
+func (p *LoadBalancerPlugin) runOrchestratorRefresh(pool *Pool) {
+	interval := pool.RefreshInterval
+	if interval <= 0 {
+		interval = defaultRefreshInterval
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-pool.stopOrchestrator:
+			return
+		case <-ticker.C:
+			p.refreshOrchestratedPool(pool)
+		}
+	}
+}
+
+// refreshOrchestratedPool fetches pool.OrchestratorURL's current backend
+// list and merges it into pool.Backends: a fetched backend matching an
+// existing one by Address keeps that Backend's live state (currentWeight,
+// effectiveWeight, and a debounced Weight/Healthy - see
+// observeOrchestratorState), a fetched backend with no match is added, and
+// an existing backend absent from the fetch is evicted. A fetch error is
+// logged and leaves pool.Backends untouched.
+func (p *LoadBalancerPlugin) refreshOrchestratedPool(pool *Pool) {
+	fetched, err := fetchOrchestratorBackends(pool.OrchestratorURL)
+	if err != nil {
+		log.Printf("[LoadBalancer] orchestrator refresh for pool %q failed: %v", pool.Name, err)
+		return
+	}
+
+	debounce := pool.PoolWeightChangeDebounce
+	if debounce <= 0 {
+		debounce = defaultPoolWeightChangeDebounce
+	}
+	now := time.Now()
+
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+
+	existing := make(map[string]*Backend, len(pool.Backends))
+	for _, b := range pool.Backends {
+		existing[b.Address] = b
+	}
+
+	merged := make([]*Backend, 0, len(fetched))
+	for _, f := range fetched {
+		b, ok := existing[f.Address]
+		if !ok {
+			merged = append(merged, &Backend{
+				Address:         f.Address,
+				Weight:          f.Weight,
+				Country:         f.Country,
+				Healthy:         f.Healthy,
+				effectiveWeight: f.Weight,
+			})
+			continue
+		}
+
+		b.Country = f.Country
+		b.observeOrchestratorState(f.Weight, f.Healthy, debounce, now)
+		merged = append(merged, b)
+	}
+
+	pool.Backends = merged
+}
+
+// observeOrchestratorState compares the orchestrator's reported weight and
+// healthy state against b's current values. A change is only applied once
+// it has been reported identically across polls for at least debounce; a
+// value that reverts back to b's current state before then clears the
+// pending change instead of applying it.
+func (b *Backend) observeOrchestratorState(weight int, healthy bool, debounce time.Duration, now time.Time) {
+	if weight == b.Weight && healthy == b.Healthy {
+		b.pendingSince = time.Time{}
+		return
+	}
+
+	if b.pendingSince.IsZero() || b.pendingWeight != weight || b.pendingHealthy != healthy {
+		b.pendingWeight = weight
+		b.pendingHealthy = healthy
+		b.pendingSince = now
+		return
+	}
+
+	if now.Sub(b.pendingSince) >= debounce {
+		b.Weight = weight
+		b.Healthy = healthy
+		b.pendingSince = time.Time{}
+	}
+}
+
+// fetchOrchestratorBackends GETs url and decodes its body as a JSON array
+// of Backend objects.
+func fetchOrchestratorBackends(url string) ([]Backend, error) {
+	resp, err := orchestratorHTTPClient.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("orchestrator %s returned HTTP %d", url, resp.StatusCode)
+	}
+
+	var backends []Backend
+	if err := json.NewDecoder(resp.Body).Decode(&backends); err != nil {
+		return nil, fmt.Errorf("decoding orchestrator response from %s: %w", url, err)
+	}
+	return backends, nil
+}
@@ -0,0 +1,83 @@
+package loadbalancer
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAddOrchestratedPool_DiffsBackendListAcrossPolls(t *testing.T) {
+	var gen int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var backends []Backend
+		switch atomic.LoadInt32(&gen) {
+		case 0:
+			backends = []Backend{
+				{Address: "10.0.0.1", Weight: 1, Healthy: true},
+				{Address: "10.0.0.2", Weight: 1, Healthy: true},
+			}
+		default:
+			// 10.0.0.2 is gone, 10.0.0.3 is new; 10.0.0.1 survives.
+			backends = []Backend{
+				{Address: "10.0.0.1", Weight: 1, Healthy: true},
+				{Address: "10.0.0.3", Weight: 1, Healthy: true},
+			}
+		}
+		json.NewEncoder(w).Encode(backends)
+	}))
+	defer srv.Close()
+
+	p := &LoadBalancerPlugin{pools: make(map[string]*Pool)}
+	pool := p.AddOrchestratedPool("test", srv.URL, "round-robin")
+	require.Len(t, pool.Backends, 2)
+
+	survivor := pool.Backends[0]
+	survivor.currentWeight = 42 // mark this *Backend so we can prove it survives, not just its Address
+
+	atomic.StoreInt32(&gen, 1)
+	p.refreshOrchestratedPool(pool)
+
+	pool.mu.RLock()
+	defer pool.mu.RUnlock()
+	require.Len(t, pool.Backends, 2)
+
+	var addrs []string
+	var foundSurvivor bool
+	for _, b := range pool.Backends {
+		addrs = append(addrs, b.Address)
+		if b == survivor {
+			foundSurvivor = true
+		}
+	}
+	assert.ElementsMatch(t, []string{"10.0.0.1", "10.0.0.3"}, addrs, "10.0.0.2 should be evicted and 10.0.0.3 added")
+	assert.True(t, foundSurvivor, "10.0.0.1's *Backend should be reused, not recreated, so its weight state survives the refresh")
+
+	p.DeletePool("test")
+}
+
+func TestObserveOrchestratorState_DebouncesFlapsBeforeApplying(t *testing.T) {
+	b := &Backend{Address: "10.0.0.1", Weight: 5, Healthy: true}
+	debounce := 10 * time.Millisecond
+	t0 := time.Now()
+
+	// First report of a change just starts the debounce window.
+	b.observeOrchestratorState(1, false, debounce, t0)
+	assert.Equal(t, 5, b.Weight, "a freshly observed change should not apply immediately")
+	assert.True(t, b.Healthy)
+
+	// It reverts before the debounce elapses: the pending change is dropped.
+	b.observeOrchestratorState(5, true, debounce, t0.Add(5*time.Millisecond))
+	assert.True(t, b.pendingSince.IsZero(), "a value matching the current state should clear any pending change")
+
+	// The same new value held steady past the debounce window now applies.
+	b.observeOrchestratorState(1, false, debounce, t0.Add(6*time.Millisecond))
+	b.observeOrchestratorState(1, false, debounce, t0.Add(20*time.Millisecond))
+	assert.Equal(t, 1, b.Weight)
+	assert.False(t, b.Healthy)
+}
@@ -0,0 +1,283 @@
+// Package mdns implements a multicast DNS (RFC 6762) and DNS-SD (RFC 6763)
+// responder for zones the authoritative plugin has flagged as link-local
+// via AuthoritativePlugin.EnableLinkLocal. It answers the same zone.records
+// store unicast queries are served from, joining the standard mDNS
+// multicast groups (224.0.0.251:5353 / [ff02::fb]:5353) on every usable
+// interface, mirroring the interface-selection logic of zeroconf-style
+// libraries: skip interfaces that are down, loopback, or not
+// multicast-capable.
+package mdns
+
+import (
+	"log"
+	"net"
+	"strings"
+	"sync"
+
+	"dns-resolver/plugins/authoritative"
+
+	"github.com/miekg/dns"
+	"golang.org/x/net/ipv4"
+	"golang.org/x/net/ipv6"
+)
+
+const (
+	ipv4Group = "224.0.0.251"
+	ipv6Group = "ff02::fb"
+	mdnsPort  = 5353
+
+	// cacheFlushBit is the top bit of the RR class field RFC 6762 section
+	// 10.2 repurposes to mean "this is the entire current rrset for this
+	// name/type, flush anything cached from before it". It's set on
+	// unique (SRV/TXT/A/AAAA) records but not shared ones (PTR).
+	cacheFlushBit = 1 << 15
+)
+
+// Responder answers mDNS/DNS-SD queries for every zone the given
+// AuthoritativePlugin has flagged as link-local.
+type Responder struct {
+	plugin *authoritative.AuthoritativePlugin
+
+	conn4 *ipv4.PacketConn
+	conn6 *ipv6.PacketConn
+
+	wg   sync.WaitGroup
+	stop chan struct{}
+}
+
+// New creates a Responder over plugin's zone store. Call Start to begin
+// listening.
+func New(plugin *authoritative.AuthoritativePlugin) *Responder {
+	return &Responder{plugin: plugin, stop: make(chan struct{})}
+}
+
+// Start joins the IPv4 and IPv6 mDNS multicast groups on every usable
+// interface, begins answering queries, and sends an unsolicited
+// announcement of every published record (the same one a zone reload
+// triggers via Announce).
+func (r *Responder) Start() error {
+	ifaces, err := usableInterfaces()
+	if err != nil {
+		return err
+	}
+
+	udp4, err := net.ListenUDP("udp4", &net.UDPAddr{Port: mdnsPort})
+	if err != nil {
+		return err
+	}
+	r.conn4 = ipv4.NewPacketConn(udp4)
+	group4 := &net.UDPAddr{IP: net.ParseIP(ipv4Group), Port: mdnsPort}
+	for _, ifi := range ifaces {
+		if err := r.conn4.JoinGroup(&ifi, group4); err != nil {
+			log.Printf("mdns: join %s on %s: %v", ipv4Group, ifi.Name, err)
+		}
+	}
+
+	udp6, err := net.ListenUDP("udp6", &net.UDPAddr{Port: mdnsPort})
+	if err != nil {
+		log.Printf("mdns: IPv6 listener unavailable, continuing IPv4-only: %v", err)
+	} else {
+		r.conn6 = ipv6.NewPacketConn(udp6)
+		group6 := &net.UDPAddr{IP: net.ParseIP(ipv6Group), Port: mdnsPort}
+		for _, ifi := range ifaces {
+			if err := r.conn6.JoinGroup(&ifi, group6); err != nil {
+				log.Printf("mdns: join [%s] on %s: %v", ipv6Group, ifi.Name, err)
+			}
+		}
+	}
+
+	r.wg.Add(1)
+	go r.serve(r.conn4, group4)
+	if r.conn6 != nil {
+		r.wg.Add(1)
+		group6 := &net.UDPAddr{IP: net.ParseIP(ipv6Group), Port: mdnsPort}
+		go r.serve6(r.conn6, group6)
+	}
+
+	r.Announce()
+	return nil
+}
+
+// Stop closes the multicast sockets and waits for the listener goroutines
+// to exit.
+func (r *Responder) Stop() error {
+	close(r.stop)
+	if r.conn4 != nil {
+		r.conn4.Close()
+	}
+	if r.conn6 != nil {
+		r.conn6.Close()
+	}
+	r.wg.Wait()
+	return nil
+}
+
+// usableInterfaces returns the interfaces a multicast responder should
+// join on: up, multicast-capable, and not loopback.
+func usableInterfaces() ([]net.Interface, error) {
+	all, err := net.Interfaces()
+	if err != nil {
+		return nil, err
+	}
+	var out []net.Interface
+	for _, ifi := range all {
+		if ifi.Flags&net.FlagUp == 0 {
+			continue
+		}
+		if ifi.Flags&net.FlagLoopback != 0 {
+			continue
+		}
+		if ifi.Flags&net.FlagMulticast == 0 {
+			continue
+		}
+		out = append(out, ifi)
+	}
+	return out, nil
+}
+
+func (r *Responder) serve(pc *ipv4.PacketConn, group *net.UDPAddr) {
+	defer r.wg.Done()
+	buf := make([]byte, dns.MaxMsgSize)
+	for {
+		n, _, src, err := pc.ReadFrom(buf)
+		select {
+		case <-r.stop:
+			return
+		default:
+		}
+		if err != nil {
+			continue
+		}
+		r.handlePacket(buf[:n], src, func(b []byte) error {
+			_, werr := pc.WriteTo(b, nil, group)
+			return werr
+		})
+	}
+}
+
+func (r *Responder) serve6(pc *ipv6.PacketConn, group *net.UDPAddr) {
+	defer r.wg.Done()
+	buf := make([]byte, dns.MaxMsgSize)
+	for {
+		n, _, src, err := pc.ReadFrom(buf)
+		select {
+		case <-r.stop:
+			return
+		default:
+		}
+		if err != nil {
+			continue
+		}
+		r.handlePacket(buf[:n], src, func(b []byte) error {
+			_, werr := pc.WriteTo(b, nil, group)
+			return werr
+		})
+	}
+}
+
+// handlePacket decodes an incoming packet, builds a response, and hands it
+// to send if there's anything to answer.
+func (r *Responder) handlePacket(b []byte, src net.Addr, send func([]byte) error) {
+	req := new(dns.Msg)
+	if err := req.Unpack(b); err != nil || req.Response {
+		return
+	}
+	resp := r.answer(req)
+	if resp == nil || len(resp.Answer) == 0 {
+		return
+	}
+	packed, err := resp.Pack()
+	if err != nil {
+		log.Printf("mdns: failed to pack response to %s: %v", src, err)
+		return
+	}
+	if err := send(packed); err != nil {
+		log.Printf("mdns: failed to send response to %s: %v", src, err)
+	}
+}
+
+// answer builds the mDNS response for req out of every link-local zone's
+// record store, or nil if nothing in those zones matches any question.
+func (r *Responder) answer(req *dns.Msg) *dns.Msg {
+	resp := new(dns.Msg)
+	resp.Response = true
+	resp.Authoritative = true
+	resp.Id = req.Id
+
+	for _, q := range req.Question {
+		for _, zoneName := range r.plugin.LinkLocalZones() {
+			records, err := r.plugin.GetZoneRecords(zoneName)
+			if err != nil {
+				continue
+			}
+			for _, rec := range records {
+				if !matchesQuestion(rec.RR, q) {
+					continue
+				}
+				resp.Answer = append(resp.Answer, withCacheFlush(rec.RR))
+			}
+		}
+	}
+	return resp
+}
+
+// matchesQuestion reports whether rr answers q: same owner name
+// (case-insensitive) and either an exact qtype match or q is ANY.
+func matchesQuestion(rr dns.RR, q dns.Question) bool {
+	if !strings.EqualFold(rr.Header().Name, q.Name) {
+		return false
+	}
+	return q.Qtype == dns.TypeANY || rr.Header().Rrtype == q.Qtype
+}
+
+// withCacheFlush sets RFC 6762's cache-flush bit on rr's class for every
+// type except PTR, whose rrset is shared across responders and must never
+// be flushed by a single answer.
+func withCacheFlush(rr dns.RR) dns.RR {
+	out := dns.Copy(rr)
+	if out.Header().Rrtype == dns.TypePTR {
+		return out
+	}
+	out.Header().Class |= cacheFlushBit
+	return out
+}
+
+// Announce sends every link-local zone's published records as an
+// unsolicited multicast response, per RFC 6762 section 8.3. Call it after
+// Start, and again whenever a zone's records change (analogous to the
+// outbound NOTIFY a master sends its secondaries on serial bump).
+func (r *Responder) Announce() {
+	resp := new(dns.Msg)
+	resp.Response = true
+	resp.Authoritative = true
+
+	for _, zoneName := range r.plugin.LinkLocalZones() {
+		records, err := r.plugin.GetZoneRecords(zoneName)
+		if err != nil {
+			continue
+		}
+		for _, rec := range records {
+			resp.Answer = append(resp.Answer, withCacheFlush(rec.RR))
+		}
+	}
+	if len(resp.Answer) == 0 {
+		return
+	}
+	packed, err := resp.Pack()
+	if err != nil {
+		log.Printf("mdns: failed to pack announcement: %v", err)
+		return
+	}
+	if r.conn4 != nil {
+		group4 := &net.UDPAddr{IP: net.ParseIP(ipv4Group), Port: mdnsPort}
+		if _, err := r.conn4.WriteTo(packed, nil, group4); err != nil {
+			log.Printf("mdns: failed to announce on IPv4: %v", err)
+		}
+	}
+	if r.conn6 != nil {
+		group6 := &net.UDPAddr{IP: net.ParseIP(ipv6Group), Port: mdnsPort}
+		if _, err := r.conn6.WriteTo(packed, nil, group6); err != nil {
+			log.Printf("mdns: failed to announce on IPv6: %v", err)
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package mdns
+
+import (
+	"testing"
+
+	"dns-resolver/plugins/authoritative"
+
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newLinkLocalZone(t *testing.T) *authoritative.AuthoritativePlugin {
+	t.Helper()
+	p := authoritative.New("") // in-memory
+	require.NoError(t, p.AddZone("printer.local."))
+	_, err := p.AddZoneRecord("printer.local.", mustRR(t, "printer.local. 120 IN A 192.168.1.50"))
+	require.NoError(t, err)
+	require.NoError(t, p.EnableLinkLocal("printer.local."))
+
+	zones, err := p.GetZoneRecords("printer.local.")
+	require.NoError(t, err)
+	require.NotEmpty(t, zones)
+	return p
+}
+
+func mustRR(t *testing.T, s string) dns.RR {
+	t.Helper()
+	rr, err := dns.NewRR(s)
+	require.NoError(t, err)
+	return rr
+}
+
+func TestIsLinkLocalReflectsEnableLinkLocal(t *testing.T) {
+	p := authoritative.New("")
+	require.NoError(t, p.AddZone("example.com."))
+	assert.False(t, p.IsLinkLocal("example.com."))
+	require.NoError(t, p.EnableLinkLocal("example.com."))
+	assert.True(t, p.IsLinkLocal("example.com."))
+	assert.Equal(t, []string{"example.com."}, p.LinkLocalZones())
+}
+
+func TestAnswerMatchesQuestionAgainstLinkLocalZones(t *testing.T) {
+	p := newLinkLocalZone(t)
+	r := New(p)
+
+	req := new(dns.Msg)
+	req.SetQuestion("printer.local.", dns.TypeA)
+
+	resp := r.answer(req)
+	require.Len(t, resp.Answer, 1)
+	a, ok := resp.Answer[0].(*dns.A)
+	require.True(t, ok)
+	assert.Equal(t, "192.168.1.50", a.A.String())
+}
+
+func TestAnswerIgnoresZonesNotFlaggedLinkLocal(t *testing.T) {
+	p := authoritative.New("")
+	require.NoError(t, p.AddZone("example.com."))
+	_, err := p.AddZoneRecord("example.com.", mustRR(t, "example.com. 120 IN A 10.0.0.1"))
+	require.NoError(t, err)
+
+	r := New(p)
+	req := new(dns.Msg)
+	req.SetQuestion("example.com.", dns.TypeA)
+
+	resp := r.answer(req)
+	assert.Empty(t, resp.Answer)
+}
+
+func TestAnnounceIncludesPublishedService(t *testing.T) {
+	p := newLinkLocalZone(t)
+
+	zone, ok := p.GetZone("printer.local.")
+	require.True(t, ok)
+	require.NoError(t, zone.Publish("_http._tcp", 80, map[string]string{"path": "/"}))
+
+	r := New(p)
+
+	req := new(dns.Msg)
+	req.SetQuestion("_http._tcp.printer.local.", dns.TypePTR)
+	resp := r.answer(req)
+	require.Len(t, resp.Answer, 1)
+	ptr, ok := resp.Answer[0].(*dns.PTR)
+	require.True(t, ok)
+	assert.Equal(t, "printer._http._tcp.printer.local.", ptr.Ptr)
+
+	req.SetQuestion("printer._http._tcp.printer.local.", dns.TypeSRV)
+	resp = r.answer(req)
+	require.Len(t, resp.Answer, 1)
+	srv, ok := resp.Answer[0].(*dns.SRV)
+	require.True(t, ok)
+	assert.Equal(t, uint16(80), srv.Port)
+	assert.Equal(t, "printer.local.", srv.Target)
+}
+
+func TestWithCacheFlushSkipsPTR(t *testing.T) {
+	ptr := &dns.PTR{Hdr: dns.RR_Header{Name: "_http._tcp.local.", Rrtype: dns.TypePTR, Class: dns.ClassINET}, Ptr: "x.local."}
+	srv := &dns.SRV{Hdr: dns.RR_Header{Name: "x.local.", Rrtype: dns.TypeSRV, Class: dns.ClassINET}}
+
+	flushedPTR := withCacheFlush(ptr)
+	flushedSRV := withCacheFlush(srv)
+
+	assert.Equal(t, uint16(dns.ClassINET), flushedPTR.Header().Class)
+	assert.Equal(t, uint16(dns.ClassINET)|cacheFlushBit, flushedSRV.Header().Class)
+}
@@ -0,0 +1,235 @@
+// Package query_logger implements a structured, compliance-grade query
+// logger plugin, in the spirit of Blocky's query log but production-sized:
+// pluggable sinks (stdout, a size/time rotating file, syslog, or a remote
+// UDP/TCP shipper), an optional PII mode for client addresses, and a
+// bounded queue so a slow sink never blocks query handling.
+package query_logger
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"net"
+	"sync/atomic"
+	"time"
+
+	"dns-resolver/internal/config"
+	"dns-resolver/internal/ecs"
+	"dns-resolver/internal/plugins"
+
+	"github.com/miekg/dns"
+)
+
+// startTimeKey is the PluginContext.data key Execute stashes the query's
+// arrival time under, so PostExecute can compute latency from it.
+const startTimeKey = "query_logger.start"
+
+// defaultBufferSize is used when Config.QueryLogBufferSize is zero.
+const defaultBufferSize = 4096
+
+// piiTruncatePrefixV4 and piiTruncatePrefixV6 match the ECS default
+// prefixes, the same granularity already used elsewhere in this codebase
+// to anonymize a client address down to its subnet.
+const (
+	piiTruncatePrefixV4 = 24
+	piiTruncatePrefixV6 = 48
+)
+
+// entry is one structured query-log record.
+type entry struct {
+	Timestamp time.Time `json:"ts"`
+	ClientIP  string    `json:"client_ip"`
+	QName     string    `json:"qname"`
+	QType     string    `json:"qtype"`
+	QClass    string    `json:"qclass"`
+	Rcode     string    `json:"rcode"`
+	CacheHit  bool      `json:"cache_hit"`
+	Upstream  string    `json:"upstream"`
+	LatencyMs float64   `json:"latency_ms"`
+	DNSSECAD  bool      `json:"dnssec_ad"`
+	Coalesced bool      `json:"coalesced"`
+}
+
+// QueryLoggerPlugin records a structured JSON entry for every query,
+// hooking Execute to capture the arrival time and PostExecute to capture
+// the written response, then writing the resulting entry to a pluggable
+// Sink from a single background goroutine so a slow sink can't add latency
+// to query handling.
+type QueryLoggerPlugin struct {
+	sink    Sink
+	piiMode string
+
+	queue   chan []byte
+	dropped int64
+}
+
+// New builds a QueryLoggerPlugin from cfg. It returns an error if the
+// configured sink can't be constructed, e.g. a file sink whose directory
+// doesn't exist or a syslog sink with no local daemon to connect to.
+func New(cfg *config.Config) (*QueryLoggerPlugin, error) {
+	sink, err := newSink(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	bufSize := cfg.QueryLogBufferSize
+	if bufSize <= 0 {
+		bufSize = defaultBufferSize
+	}
+
+	p := &QueryLoggerPlugin{
+		sink:    sink,
+		piiMode: cfg.QueryLogPIIMode,
+		queue:   make(chan []byte, bufSize),
+	}
+	go p.drain()
+	return p, nil
+}
+
+func newSink(cfg *config.Config) (Sink, error) {
+	switch cfg.QueryLogSink {
+	case "", "stdout":
+		return newStdoutSink(), nil
+	case "file":
+		return newFileSink(cfg.QueryLogPath, cfg.QueryLogMaxSizeMB, cfg.QueryLogMaxAge)
+	case "syslog":
+		return newSyslogSink()
+	case "udp", "tcp":
+		return newShipperSink(cfg.QueryLogSink, cfg.QueryLogShipAddr), nil
+	default:
+		return newStdoutSink(), nil
+	}
+}
+
+// Name returns the plugin's name.
+func (p *QueryLoggerPlugin) Name() string {
+	return "QueryLogger"
+}
+
+// Execute stashes the query's arrival time so PostExecute can compute
+// latency; it never stops the plugin chain.
+func (p *QueryLoggerPlugin) Execute(ctx *plugins.PluginContext, msg *dns.Msg) error {
+	ctx.Set(startTimeKey, time.Now())
+	return nil
+}
+
+// PostExecute builds the structured log entry for query/response and
+// enqueues it for the background sink writer.
+func (p *QueryLoggerPlugin) PostExecute(ctx *plugins.PluginContext, query, response *dns.Msg) {
+	if len(query.Question) == 0 {
+		return
+	}
+	q := query.Question[0]
+
+	var latency time.Duration
+	if v, ok := ctx.Get(startTimeKey); ok {
+		if start, ok := v.(time.Time); ok {
+			latency = time.Since(start)
+		}
+	}
+
+	e := entry{
+		Timestamp: time.Now(),
+		ClientIP:  p.clientIP(ctx),
+		QName:     q.Name,
+		QType:     dns.TypeToString[q.Qtype],
+		QClass:    dns.ClassToString[q.Qclass],
+		LatencyMs: float64(latency) / float64(time.Millisecond),
+	}
+	if response != nil {
+		e.Rcode = dns.RcodeToString[response.Rcode]
+		e.DNSSECAD = response.AuthenticatedData
+	}
+	if v, ok := ctx.Get("cache_hit"); ok {
+		e.CacheHit, _ = v.(bool)
+	}
+	if v, ok := ctx.Get("upstream"); ok {
+		e.Upstream, _ = v.(string)
+	}
+	if v, ok := ctx.Get("coalescer_key"); ok {
+		_, e.Coalesced = v.(string)
+	}
+
+	line, err := json.Marshal(e)
+	if err != nil {
+		log.Printf("[%s] failed to marshal query log entry for %s: %v", p.Name(), q.Name, err)
+		return
+	}
+	p.enqueue(line)
+}
+
+// clientIP reads the querying client's address off ctx.ResponseWriter and
+// applies the configured PII mode.
+func (p *QueryLoggerPlugin) clientIP(ctx *plugins.PluginContext) string {
+	if ctx.ResponseWriter == nil {
+		return ""
+	}
+	host, _, err := net.SplitHostPort(ctx.ResponseWriter.RemoteAddr().String())
+	if err != nil {
+		host = ctx.ResponseWriter.RemoteAddr().String()
+	}
+
+	switch p.piiMode {
+	case "hash":
+		sum := sha256.Sum256([]byte(host))
+		return hex.EncodeToString(sum[:])
+	case "truncate":
+		if ip := net.ParseIP(host); ip != nil {
+			if subnet := ecs.Subnet(ip, piiTruncatePrefixV4); subnet != "" && ip.To4() != nil {
+				return subnet
+			}
+			if subnet := ecs.Subnet(ip, piiTruncatePrefixV6); subnet != "" {
+				return subnet
+			}
+		}
+		return host
+	default:
+		return host
+	}
+}
+
+// enqueue pushes line onto the bounded queue, dropping the oldest queued
+// entry to make room when it's full rather than blocking the caller (the
+// DNS request-handling goroutine). A full queue means the sink is falling
+// behind; dropped entries are counted so that's observable.
+func (p *QueryLoggerPlugin) enqueue(line []byte) {
+	select {
+	case p.queue <- line:
+		return
+	default:
+	}
+
+	atomic.AddInt64(&p.dropped, 1)
+	select {
+	case <-p.queue:
+	default:
+	}
+
+	select {
+	case p.queue <- line:
+	default:
+	}
+}
+
+// Dropped returns the number of log entries discarded so far because the
+// queue was full and the sink couldn't keep up.
+func (p *QueryLoggerPlugin) Dropped() int64 {
+	return atomic.LoadInt64(&p.dropped)
+}
+
+// drain is the single goroutine that owns writes to p.sink, so a slow sink
+// only ever backs up the queue, never a query-handling goroutine.
+func (p *QueryLoggerPlugin) drain() {
+	for line := range p.queue {
+		if err := p.sink.Write(line); err != nil {
+			log.Printf("[%s] sink write failed: %v", p.Name(), err)
+		}
+	}
+}
+
+// Close flushes and releases the underlying sink. It does not drain
+// remaining queued entries.
+func (p *QueryLoggerPlugin) Close() error {
+	return p.sink.Close()
+}
@@ -0,0 +1,158 @@
+package query_logger
+
+import (
+	"encoding/json"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"dns-resolver/internal/config"
+	"dns-resolver/internal/plugins"
+
+	"github.com/miekg/dns"
+)
+
+// memSink is a Sink that appends every write to an in-memory slice, for
+// test assertions.
+type memSink struct {
+	mu    sync.Mutex
+	lines [][]byte
+}
+
+func (s *memSink) Write(line []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	cp := append([]byte(nil), line...)
+	s.lines = append(s.lines, cp)
+	return nil
+}
+
+func (s *memSink) Close() error { return nil }
+
+func (s *memSink) waitForLines(t *testing.T, n int) [][]byte {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		s.mu.Lock()
+		got := len(s.lines)
+		s.mu.Unlock()
+		if got >= n {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([][]byte(nil), s.lines...)
+}
+
+type fakeResponseWriter struct {
+	dns.ResponseWriter
+	remote net.Addr
+}
+
+func (w *fakeResponseWriter) RemoteAddr() net.Addr { return w.remote }
+
+func newTestPlugin(piiMode string) (*QueryLoggerPlugin, *memSink) {
+	sink := &memSink{}
+	return &QueryLoggerPlugin{
+		sink:    sink,
+		piiMode: piiMode,
+		queue:   make(chan []byte, 8),
+	}, sink
+}
+
+func TestExecuteThenPostExecute_LogsEntry(t *testing.T) {
+	p, sink := newTestPlugin("")
+	go p.drain()
+
+	ctx := plugins.NewPluginContext()
+	ctx.ResponseWriter = &fakeResponseWriter{remote: &net.UDPAddr{IP: net.ParseIP("203.0.113.7"), Port: 53}}
+
+	query := new(dns.Msg)
+	query.SetQuestion("example.com.", dns.TypeA)
+
+	if err := p.Execute(ctx, query); err != nil {
+		t.Fatalf("Execute returned error: %v", err)
+	}
+
+	response := new(dns.Msg)
+	response.SetReply(query)
+	p.PostExecute(ctx, query, response)
+
+	lines := sink.waitForLines(t, 1)
+	if len(lines) != 1 {
+		t.Fatalf("expected 1 logged entry, got %d", len(lines))
+	}
+
+	var e entry
+	if err := json.Unmarshal(lines[0], &e); err != nil {
+		t.Fatalf("failed to unmarshal log entry: %v", err)
+	}
+	if e.QName != "example.com." {
+		t.Errorf("expected qname example.com., got %q", e.QName)
+	}
+	if e.ClientIP != "203.0.113.7" {
+		t.Errorf("expected client IP logged verbatim in default PII mode, got %q", e.ClientIP)
+	}
+	if e.Rcode != "NOERROR" {
+		t.Errorf("expected rcode NOERROR, got %q", e.Rcode)
+	}
+}
+
+func TestClientIP_TruncateMode(t *testing.T) {
+	p, _ := newTestPlugin("truncate")
+	ctx := plugins.NewPluginContext()
+	ctx.ResponseWriter = &fakeResponseWriter{remote: &net.UDPAddr{IP: net.ParseIP("203.0.113.55"), Port: 53}}
+
+	got := p.clientIP(ctx)
+	if got != "203.0.113.0/24" {
+		t.Errorf("expected the client IP truncated to its /24, got %q", got)
+	}
+}
+
+func TestClientIP_HashMode(t *testing.T) {
+	p, _ := newTestPlugin("hash")
+	ctx := plugins.NewPluginContext()
+	ctx.ResponseWriter = &fakeResponseWriter{remote: &net.UDPAddr{IP: net.ParseIP("203.0.113.55"), Port: 53}}
+
+	got := p.clientIP(ctx)
+	if got == "203.0.113.55" || len(got) != 64 {
+		t.Errorf("expected a 64-char hex SHA-256 digest, got %q", got)
+	}
+}
+
+func TestEnqueue_DropsOldestWhenFull(t *testing.T) {
+	p := &QueryLoggerPlugin{queue: make(chan []byte, 2)}
+
+	p.enqueue([]byte("a"))
+	p.enqueue([]byte("b"))
+	p.enqueue([]byte("c")) // queue is full; "a" should be dropped to make room
+
+	if p.Dropped() != 1 {
+		t.Errorf("expected 1 dropped entry, got %d", p.Dropped())
+	}
+
+	first := <-p.queue
+	second := <-p.queue
+	if string(first) != "b" || string(second) != "c" {
+		t.Errorf("expected queue to contain [b c] after drop, got [%s %s]", first, second)
+	}
+}
+
+func newTestConfig() *config.Config {
+	return &config.Config{QueryLogSink: "stdout"}
+}
+
+func TestNew_DefaultsToStdoutSink(t *testing.T) {
+	p, err := New(newTestConfig())
+	if err != nil {
+		t.Fatalf("New returned error: %v", err)
+	}
+	defer p.Close()
+
+	if _, ok := p.sink.(*stdoutSink); !ok {
+		t.Errorf("expected a stdoutSink for QueryLogSink %q, got %T", "stdout", p.sink)
+	}
+}
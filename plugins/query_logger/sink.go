@@ -0,0 +1,190 @@
+package query_logger
+
+import (
+	"fmt"
+	"log/syslog"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+// Sink writes one already-marshaled JSON log line somewhere durable. Write
+// must be safe to call from multiple goroutines (it isn't in practice,
+// since QueryLoggerPlugin only ever calls it from its single drain
+// goroutine, but implementations guard it anyway so they're safe to reuse
+// outside that caller too).
+type Sink interface {
+	Write(line []byte) error
+	Close() error
+}
+
+// stdoutSink writes every entry to os.Stdout, one JSON object per line.
+type stdoutSink struct {
+	mu sync.Mutex
+}
+
+func newStdoutSink() *stdoutSink { return &stdoutSink{} }
+
+func (s *stdoutSink) Write(line []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, err := os.Stdout.Write(append(line, '\n'))
+	return err
+}
+
+func (s *stdoutSink) Close() error { return nil }
+
+// fileSink appends entries to a file, rotating it once it exceeds
+// maxSizeBytes or has been open longer than maxAge (either check is
+// skipped if its threshold is zero).
+type fileSink struct {
+	mu          sync.Mutex
+	path        string
+	maxSizeByte int64
+	maxAge      time.Duration
+
+	f        *os.File
+	curSize  int64
+	openedAt time.Time
+}
+
+func newFileSink(path string, maxSizeMB int, maxAge time.Duration) (*fileSink, error) {
+	s := &fileSink{
+		path:        path,
+		maxSizeByte: int64(maxSizeMB) * 1024 * 1024,
+		maxAge:      maxAge,
+	}
+	if err := s.open(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *fileSink) open() error {
+	f, err := os.OpenFile(s.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("query_logger: opening %s: %w", s.path, err)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return fmt.Errorf("query_logger: stat %s: %w", s.path, err)
+	}
+	s.f = f
+	s.curSize = info.Size()
+	s.openedAt = time.Now()
+	return nil
+}
+
+func (s *fileSink) Write(line []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.needsRotation(int64(len(line) + 1)) {
+		if err := s.rotate(); err != nil {
+			// Keep writing to the over-sized/over-age file rather than
+			// dropping the entry; rotation will be retried next write.
+			return err
+		}
+	}
+
+	n, err := s.f.Write(append(line, '\n'))
+	s.curSize += int64(n)
+	return err
+}
+
+func (s *fileSink) needsRotation(nextWrite int64) bool {
+	if s.maxSizeByte > 0 && s.curSize+nextWrite > s.maxSizeByte {
+		return true
+	}
+	if s.maxAge > 0 && time.Since(s.openedAt) > s.maxAge {
+		return true
+	}
+	return false
+}
+
+// rotate closes the current file, renames it aside with a timestamp
+// suffix, and opens a fresh file at the original path.
+func (s *fileSink) rotate() error {
+	if err := s.f.Close(); err != nil {
+		return fmt.Errorf("query_logger: closing %s before rotation: %w", s.path, err)
+	}
+	rotated := fmt.Sprintf("%s.%s", s.path, time.Now().UTC().Format("20060102T150405"))
+	if err := os.Rename(s.path, rotated); err != nil {
+		return fmt.Errorf("query_logger: rotating %s: %w", s.path, err)
+	}
+	return s.open()
+}
+
+func (s *fileSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.f.Close()
+}
+
+// syslogSink forwards each entry as a syslog INFO message under the
+// "astracat-query-logger" tag.
+type syslogSink struct {
+	w *syslog.Writer
+}
+
+func newSyslogSink() (*syslogSink, error) {
+	w, err := syslog.New(syslog.LOG_INFO|syslog.LOG_DAEMON, "astracat-query-logger")
+	if err != nil {
+		return nil, fmt.Errorf("query_logger: connecting to syslog: %w", err)
+	}
+	return &syslogSink{w: w}, nil
+}
+
+func (s *syslogSink) Write(line []byte) error {
+	return s.w.Info(string(line))
+}
+
+func (s *syslogSink) Close() error {
+	return s.w.Close()
+}
+
+// shipperSink forwards each entry as a single datagram/line to a remote
+// collector over UDP or TCP. It mirrors the stub backend's upstream: dial
+// lazily, reuse the connection, and redial on the next write after any
+// error instead of failing the whole sink.
+type shipperSink struct {
+	mu      sync.Mutex
+	network string // "udp" or "tcp"
+	addr    string
+	conn    net.Conn
+}
+
+func newShipperSink(network, addr string) *shipperSink {
+	return &shipperSink{network: network, addr: addr}
+}
+
+func (s *shipperSink) Write(line []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.conn == nil {
+		conn, err := net.DialTimeout(s.network, s.addr, 5*time.Second)
+		if err != nil {
+			return fmt.Errorf("query_logger: dialing %s %s: %w", s.network, s.addr, err)
+		}
+		s.conn = conn
+	}
+
+	if _, err := s.conn.Write(append(line, '\n')); err != nil {
+		s.conn.Close()
+		s.conn = nil
+		return fmt.Errorf("query_logger: writing to %s %s: %w", s.network, s.addr, err)
+	}
+	return nil
+}
+
+func (s *shipperSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.conn == nil {
+		return nil
+	}
+	return s.conn.Close()
+}
@@ -0,0 +1,348 @@
+// Package query_logging implements a structured query-logging plugin,
+// modeled on Blocky's query logging resolver: one entry per resolved query
+// (timestamp, client address, QNAME/QTYPE, rcode, answer count, resolution
+// duration, upstream used, cache status, and the DNSSEC AD bit) written to a
+// pluggable Sink (daily-rotated CSV, an NDJSON stream to stdout, batched
+// writes to a dated SQLite shard, size/age-rotated gzip NDJSON files, an
+// in-memory ring buffer, or OTLP/HTTP log export). Writes never block query
+// handling: PostExecute enqueues onto a bounded channel, and the single
+// background drain goroutine drops the oldest queued entry (counting the
+// drop) when it can't keep up with a slow sink.
+package query_logging
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"net"
+	"regexp"
+	"sync/atomic"
+	"time"
+
+	"dns-resolver/internal/config"
+	"dns-resolver/internal/ecs"
+	"dns-resolver/internal/metrics"
+	"dns-resolver/internal/plugins"
+
+	"github.com/miekg/dns"
+)
+
+// startTimeKey is the PluginContext.data key Execute stashes the query's
+// arrival time under, so PostExecute can compute resolution duration from it.
+const startTimeKey = "query_logging.start"
+
+// defaultBufferSize is used when Config.QueryLoggingBufferSize is zero.
+const defaultBufferSize = 4096
+
+// anonymizePrefixV4 and anonymizePrefixV6 match the ECS default prefixes,
+// the same granularity already used elsewhere in this codebase to
+// anonymize a client address down to its subnet.
+const (
+	anonymizePrefixV4 = 24
+	anonymizePrefixV6 = 48
+)
+
+// CacheStatus categorizes how a response was produced, as recorded by
+// whatever resolver/cache layer stashed it into the PluginContext under the
+// "cache_status" key before PostExecute runs.
+type CacheStatus string
+
+const (
+	CacheStatusHit      CacheStatus = "HIT"
+	CacheStatusMiss     CacheStatus = "MISS"
+	CacheStatusStale    CacheStatus = "STALE"
+	CacheStatusPrefetch CacheStatus = "PREFETCH"
+)
+
+// Entry is one structured query-log record.
+type Entry struct {
+	Timestamp   time.Time   `json:"ts"`
+	ClientIP    string      `json:"client_ip"`
+	QName       string      `json:"qname"`
+	QType       string      `json:"qtype"`
+	Rcode       string      `json:"rcode"`
+	AnswerCount int         `json:"answer_count"`
+	DurationMs  float64     `json:"duration_ms"`
+	Upstream    string      `json:"upstream"`
+	CacheStatus CacheStatus `json:"cache_status"`
+	DNSSECAD    bool        `json:"dnssec_ad"`
+
+	// ClientName, QClass, AnswerRRs, ECS and CacheHit round out the entry
+	// for the jsonl/ring/otlp sinks (see sink_jsonl.go, sink_ring.go,
+	// sink_otlp.go): the csv and sqlite sinks predate them and don't
+	// persist them. ClientName is only populated when some earlier plugin
+	// in the chain has already resolved the client's address to a name and
+	// stashed it under the "client_name" PluginContext key; this package
+	// does no lookup of its own.
+	ClientName string   `json:"client_name,omitempty"`
+	QClass     string   `json:"qclass,omitempty"`
+	AnswerRRs  []string `json:"answer_rrs,omitempty"`
+	ECS        string   `json:"ecs,omitempty"`
+	CacheHit   bool     `json:"cache_hit"`
+
+	// seq is assigned by the ring sink as its cursor value; zero (and
+	// meaningless) for every other sink.
+	seq int64
+}
+
+// Sink persists one Entry somewhere durable. Write is only ever called from
+// QueryLoggingPlugin's single drain goroutine, so implementations don't need
+// to guard it against concurrent callers, but do anyway to stay safe to
+// reuse outside that caller too.
+type Sink interface {
+	Write(e Entry) error
+	Close() error
+}
+
+// Queryable is implemented by a Sink that can page back through entries it
+// has already written (the csv and sqlite sinks); the stdout sink doesn't
+// retain anything to query.
+type Queryable interface {
+	Query(from, to time.Time, qname string) ([]Entry, error)
+}
+
+// QueryLoggingPlugin records a structured Entry for every query, hooking
+// Execute to capture the arrival time and PostExecute to capture the
+// written response, then writing the resulting entry to a pluggable Sink
+// from a single background goroutine so a slow sink can't add latency to
+// query handling.
+type QueryLoggingPlugin struct {
+	sink               Sink
+	anonymizationLevel string
+	metrics            *metrics.Metrics
+
+	queue   chan Entry
+	dropped int64
+}
+
+// New builds a QueryLoggingPlugin from cfg. m may be nil to skip
+// publishing dropped-entry metrics. It returns an error if the configured
+// sink can't be constructed, e.g. a csv/sqlite sink whose directory can't
+// be created, or a sqlite sink with no driver configured.
+func New(cfg *config.Config, m *metrics.Metrics) (*QueryLoggingPlugin, error) {
+	sink, err := newSink(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	bufSize := cfg.QueryLoggingBufferSize
+	if bufSize <= 0 {
+		bufSize = defaultBufferSize
+	}
+
+	p := &QueryLoggingPlugin{
+		sink:               sink,
+		anonymizationLevel: cfg.QueryLoggingAnonymizationLevel,
+		metrics:            m,
+		queue:              make(chan Entry, bufSize),
+	}
+	go p.drain()
+	return p, nil
+}
+
+func newSink(cfg *config.Config) (Sink, error) {
+	switch cfg.QueryLoggingSink {
+	case "", "stdout":
+		return newStdoutSink(), nil
+	case "csv":
+		return newCSVSink(cfg.QueryLoggingDir, cfg.QueryLoggingRetentionDays)
+	case "sqlite":
+		return newSQLiteSink(cfg.QueryLoggingDir, cfg.QueryLoggingSQLiteDriver, cfg.QueryLoggingRetentionDays)
+	case "jsonl":
+		return newJSONLSink(cfg.QueryLoggingDir, cfg.QueryLoggingJSONLMaxSizeMB, cfg.QueryLoggingJSONLMaxAge)
+	case "ring":
+		return newRingSink(cfg.QueryLoggingRingCapacity), nil
+	case "otlp":
+		return newOTLPSink(cfg.QueryLoggingOTLPEndpoint), nil
+	default:
+		return newStdoutSink(), nil
+	}
+}
+
+// Name returns the plugin's name.
+func (p *QueryLoggingPlugin) Name() string {
+	return "QueryLogging"
+}
+
+// Execute stashes the query's arrival time so PostExecute can compute
+// resolution duration; it never stops the plugin chain.
+func (p *QueryLoggingPlugin) Execute(ctx *plugins.PluginContext, msg *dns.Msg) error {
+	ctx.Set(startTimeKey, time.Now())
+	return nil
+}
+
+// PostExecute builds the structured log entry for query/response and
+// enqueues it for the background sink writer.
+func (p *QueryLoggingPlugin) PostExecute(ctx *plugins.PluginContext, query, response *dns.Msg) {
+	if len(query.Question) == 0 {
+		return
+	}
+	q := query.Question[0]
+
+	var duration time.Duration
+	if v, ok := ctx.Get(startTimeKey); ok {
+		if start, ok := v.(time.Time); ok {
+			duration = time.Since(start)
+		}
+	}
+
+	e := Entry{
+		Timestamp:   time.Now(),
+		ClientIP:    p.clientIP(ctx),
+		QName:       q.Name,
+		QType:       dns.TypeToString[q.Qtype],
+		QClass:      dns.ClassToString[q.Qclass],
+		DurationMs:  float64(duration) / float64(time.Millisecond),
+		CacheStatus: CacheStatusMiss,
+	}
+	if subnet, ok := ecs.FromMsg(query); ok {
+		e.ECS = fmt.Sprintf("%s/%d", subnet.Address, subnet.SourceNetmask)
+	}
+	if response != nil {
+		e.Rcode = dns.RcodeToString[response.Rcode]
+		e.AnswerCount = len(response.Answer)
+		e.DNSSECAD = response.AuthenticatedData
+		e.AnswerRRs = make([]string, len(response.Answer))
+		for i, rr := range response.Answer {
+			e.AnswerRRs[i] = rr.String()
+		}
+	}
+	if v, ok := ctx.Get("cache_status"); ok {
+		if status, ok := v.(CacheStatus); ok {
+			e.CacheStatus = status
+		}
+	}
+	e.CacheHit = e.CacheStatus != CacheStatusMiss && e.CacheStatus != ""
+	if v, ok := ctx.Get("upstream"); ok {
+		e.Upstream, _ = v.(string)
+	}
+	if v, ok := ctx.Get("client_name"); ok {
+		e.ClientName, _ = v.(string)
+	}
+
+	p.enqueue(e)
+}
+
+// clientIP reads the querying client's address off ctx.ResponseWriter and
+// applies the configured anonymization level.
+func (p *QueryLoggingPlugin) clientIP(ctx *plugins.PluginContext) string {
+	if ctx.ResponseWriter == nil {
+		return ""
+	}
+	host, _, err := net.SplitHostPort(ctx.ResponseWriter.RemoteAddr().String())
+	if err != nil {
+		host = ctx.ResponseWriter.RemoteAddr().String()
+	}
+
+	switch p.anonymizationLevel {
+	case "hash":
+		sum := sha256.Sum256([]byte(host))
+		return hex.EncodeToString(sum[:])
+	case "truncate":
+		if ip := net.ParseIP(host); ip != nil {
+			if subnet := ecs.Subnet(ip, anonymizePrefixV4); subnet != "" && ip.To4() != nil {
+				return subnet
+			}
+			if subnet := ecs.Subnet(ip, anonymizePrefixV6); subnet != "" {
+				return subnet
+			}
+		}
+		return host
+	default:
+		return host
+	}
+}
+
+// enqueue pushes e onto the bounded queue, dropping the oldest queued entry
+// to make room when it's full rather than blocking the caller (the DNS
+// request-handling goroutine). A full queue means the sink is falling
+// behind; dropped entries are counted so that's observable.
+func (p *QueryLoggingPlugin) enqueue(e Entry) {
+	select {
+	case p.queue <- e:
+		return
+	default:
+	}
+
+	atomic.AddInt64(&p.dropped, 1)
+	if p.metrics != nil {
+		p.metrics.IncrementQueryLoggingDropped()
+	}
+	select {
+	case <-p.queue:
+	default:
+	}
+
+	select {
+	case p.queue <- e:
+	default:
+	}
+}
+
+// Dropped returns the number of log entries discarded so far because the
+// queue was full and the sink couldn't keep up.
+func (p *QueryLoggingPlugin) Dropped() int64 {
+	return atomic.LoadInt64(&p.dropped)
+}
+
+// drain is the single goroutine that owns writes to p.sink, so a slow sink
+// only ever backs up the queue, never a query-handling goroutine.
+func (p *QueryLoggingPlugin) drain() {
+	for e := range p.queue {
+		if err := p.sink.Write(e); err != nil {
+			log.Printf("[%s] sink write failed: %v", p.Name(), err)
+		}
+	}
+}
+
+// Close flushes and releases the underlying sink. It does not drain
+// remaining queued entries.
+func (p *QueryLoggingPlugin) Close() error {
+	return p.sink.Close()
+}
+
+// Query pages back through previously logged entries with a timestamp in
+// [from, to], optionally filtered to a single QNAME, if the configured sink
+// retains history (the csv and sqlite sinks do; stdout does not).
+func (p *QueryLoggingPlugin) Query(from, to time.Time, qname string) ([]Entry, error) {
+	q, ok := p.sink.(Queryable)
+	if !ok {
+		return nil, fmt.Errorf("query_logging: sink %T does not support querying past entries", p.sink)
+	}
+	return q.Query(from, to, qname)
+}
+
+// Filter narrows a QueryFiltered call. A zero-value field is ignored.
+type Filter struct {
+	From, To time.Time
+	Client   string
+	QNameRe  *regexp.Regexp
+	Rcode    string
+}
+
+// Page is one cursor-paginated slice of QueryFiltered results. Cursor is
+// empty once there's nothing more to page through; pass it back as the
+// next call's cursor argument to fetch the following page.
+type Page struct {
+	Entries []Entry
+	Cursor  string
+}
+
+// FilterableQueryable is implemented by a Sink that supports the dashboard's
+// richer /api/v1/query-log filtering (client, QNAME regex, rcode, time
+// range) with cursor pagination - currently just the ring sink.
+type FilterableQueryable interface {
+	QueryFiltered(f Filter, cursor string, limit int) (Page, error)
+}
+
+// QueryFiltered pages through previously logged entries matching f, if the
+// configured sink supports it (currently just the ring sink; the csv and
+// sqlite sinks only implement the coarser Query).
+func (p *QueryLoggingPlugin) QueryFiltered(f Filter, cursor string, limit int) (Page, error) {
+	q, ok := p.sink.(FilterableQueryable)
+	if !ok {
+		return Page{}, fmt.Errorf("query_logging: sink %T does not support filtered querying", p.sink)
+	}
+	return q.QueryFiltered(f, cursor, limit)
+}
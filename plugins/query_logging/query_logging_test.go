@@ -0,0 +1,322 @@
+package query_logging
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"dns-resolver/internal/config"
+	"dns-resolver/internal/plugins"
+
+	"github.com/miekg/dns"
+)
+
+// memSink is a Sink that appends every write to an in-memory slice, for
+// test assertions.
+type memSink struct {
+	mu      sync.Mutex
+	entries []Entry
+}
+
+func (s *memSink) Write(e Entry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.entries = append(s.entries, e)
+	return nil
+}
+
+func (s *memSink) Close() error { return nil }
+
+func (s *memSink) waitForEntries(t *testing.T, n int) []Entry {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		s.mu.Lock()
+		got := len(s.entries)
+		s.mu.Unlock()
+		if got >= n {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Entry(nil), s.entries...)
+}
+
+type fakeResponseWriter struct {
+	dns.ResponseWriter
+	remote net.Addr
+}
+
+func (w *fakeResponseWriter) RemoteAddr() net.Addr { return w.remote }
+
+func newTestPlugin(anonymizationLevel string) (*QueryLoggingPlugin, *memSink) {
+	sink := &memSink{}
+	return &QueryLoggingPlugin{
+		sink:               sink,
+		anonymizationLevel: anonymizationLevel,
+		queue:              make(chan Entry, 8),
+	}, sink
+}
+
+func TestExecuteThenPostExecute_LogsEntry(t *testing.T) {
+	p, sink := newTestPlugin("")
+	go p.drain()
+
+	ctx := plugins.NewPluginContext()
+	ctx.ResponseWriter = &fakeResponseWriter{remote: &net.UDPAddr{IP: net.ParseIP("203.0.113.7"), Port: 53}}
+
+	query := new(dns.Msg)
+	query.SetQuestion("example.com.", dns.TypeA)
+
+	if err := p.Execute(ctx, query); err != nil {
+		t.Fatalf("Execute returned error: %v", err)
+	}
+
+	response := new(dns.Msg)
+	response.SetReply(query)
+	p.PostExecute(ctx, query, response)
+
+	entries := sink.waitForEntries(t, 1)
+	if len(entries) != 1 {
+		t.Fatalf("expected 1 logged entry, got %d", len(entries))
+	}
+
+	e := entries[0]
+	if e.QName != "example.com." {
+		t.Errorf("expected qname example.com., got %q", e.QName)
+	}
+	if e.ClientIP != "203.0.113.7" {
+		t.Errorf("expected client IP logged verbatim in default anonymization mode, got %q", e.ClientIP)
+	}
+	if e.Rcode != "NOERROR" {
+		t.Errorf("expected rcode NOERROR, got %q", e.Rcode)
+	}
+}
+
+func TestClientIP_TruncateMode(t *testing.T) {
+	p, _ := newTestPlugin("truncate")
+	ctx := plugins.NewPluginContext()
+	ctx.ResponseWriter = &fakeResponseWriter{remote: &net.UDPAddr{IP: net.ParseIP("203.0.113.55"), Port: 53}}
+
+	got := p.clientIP(ctx)
+	if got != "203.0.113.0/24" {
+		t.Errorf("expected the client IP truncated to its /24, got %q", got)
+	}
+}
+
+func TestClientIP_HashMode(t *testing.T) {
+	p, _ := newTestPlugin("hash")
+	ctx := plugins.NewPluginContext()
+	ctx.ResponseWriter = &fakeResponseWriter{remote: &net.UDPAddr{IP: net.ParseIP("203.0.113.55"), Port: 53}}
+
+	got := p.clientIP(ctx)
+	if got == "203.0.113.55" || len(got) != 64 {
+		t.Errorf("expected a 64-char hex SHA-256 digest, got %q", got)
+	}
+}
+
+func TestEnqueue_DropsOldestWhenFull(t *testing.T) {
+	p := &QueryLoggingPlugin{queue: make(chan Entry, 2)}
+
+	p.enqueue(Entry{QName: "a."})
+	p.enqueue(Entry{QName: "b."})
+	p.enqueue(Entry{QName: "c."}) // queue is full; "a." should be dropped to make room
+
+	if p.Dropped() != 1 {
+		t.Errorf("expected 1 dropped entry, got %d", p.Dropped())
+	}
+
+	first := <-p.queue
+	second := <-p.queue
+	if first.QName != "b." || second.QName != "c." {
+		t.Errorf("expected queue to contain [b. c.] after drop, got [%s %s]", first.QName, second.QName)
+	}
+}
+
+func TestNew_DefaultsToStdoutSink(t *testing.T) {
+	p, err := New(&config.Config{QueryLoggingSink: "stdout"}, nil)
+	if err != nil {
+		t.Fatalf("New returned error: %v", err)
+	}
+	defer p.Close()
+
+	if _, ok := p.sink.(*stdoutSink); !ok {
+		t.Errorf("expected a stdoutSink for QueryLoggingSink %q, got %T", "stdout", p.sink)
+	}
+}
+
+func TestCSVSink_WriteThenQuery_RoundTrips(t *testing.T) {
+	dir := t.TempDir()
+	sink, err := newCSVSink(dir, 0)
+	if err != nil {
+		t.Fatalf("newCSVSink returned error: %v", err)
+	}
+	defer sink.Close()
+
+	e := Entry{
+		Timestamp:   time.Now().UTC().Truncate(time.Second),
+		ClientIP:    "203.0.113.7",
+		QName:       "example.com.",
+		QType:       "A",
+		Rcode:       "NOERROR",
+		AnswerCount: 1,
+		DurationMs:  12.5,
+		Upstream:    "1.1.1.1:53",
+		CacheStatus: CacheStatusMiss,
+		DNSSECAD:    true,
+	}
+	if err := sink.Write(e); err != nil {
+		t.Fatalf("Write returned error: %v", err)
+	}
+
+	got, err := sink.Query(e.Timestamp.Add(-time.Minute), e.Timestamp.Add(time.Minute), "")
+	if err != nil {
+		t.Fatalf("Query returned error: %v", err)
+	}
+	if len(got) != 1 {
+		t.Fatalf("expected 1 entry back from Query, got %d", len(got))
+	}
+	if got[0].QName != e.QName || !got[0].Timestamp.Equal(e.Timestamp) || got[0].CacheStatus != e.CacheStatus {
+		t.Errorf("round-tripped entry %+v does not match written entry %+v", got[0], e)
+	}
+}
+
+func TestCSVSink_QueryFiltersByQName(t *testing.T) {
+	dir := t.TempDir()
+	sink, err := newCSVSink(dir, 0)
+	if err != nil {
+		t.Fatalf("newCSVSink returned error: %v", err)
+	}
+	defer sink.Close()
+
+	now := time.Now().UTC()
+	sink.Write(Entry{Timestamp: now, QName: "a.example."})
+	sink.Write(Entry{Timestamp: now, QName: "b.example."})
+
+	got, err := sink.Query(now.Add(-time.Minute), now.Add(time.Minute), "a.example.")
+	if err != nil {
+		t.Fatalf("Query returned error: %v", err)
+	}
+	if len(got) != 1 || got[0].QName != "a.example." {
+		t.Errorf("expected only a.example. back, got %+v", got)
+	}
+}
+
+func TestCSVSink_PruneOldRemovesExpiredShards(t *testing.T) {
+	dir := t.TempDir()
+	sink, err := newCSVSink(dir, 1)
+	if err != nil {
+		t.Fatalf("newCSVSink returned error: %v", err)
+	}
+	defer sink.Close()
+
+	stale := filepath.Join(dir, "query-log-20200101.csv")
+	if err := os.WriteFile(stale, []byte("ts,client_ip,qname,qtype,rcode,answer_count,duration_ms,upstream,cache_status,dnssec_ad\n"), 0644); err != nil {
+		t.Fatalf("failed to seed stale shard: %v", err)
+	}
+
+	sink.pruneOld(time.Now().UTC())
+
+	if _, err := os.Stat(stale); !os.IsNotExist(err) {
+		t.Errorf("expected stale shard to be pruned, stat returned: %v", err)
+	}
+}
+
+func newTestConfig() *config.Config {
+	return &config.Config{QueryLoggingSink: "sqlite", QueryLoggingDir: "/tmp/query-log"}
+}
+
+func TestNewSQLiteSink_RequiresDriver(t *testing.T) {
+	if _, err := newSQLiteSink(t.TempDir(), "", 0); err == nil {
+		t.Error("expected an error when QueryLoggingSQLiteDriver is empty")
+	}
+}
+
+func TestNew_SQLiteSinkWithoutDriverReturnsError(t *testing.T) {
+	if _, err := New(newTestConfig(), nil); err == nil {
+		t.Error("expected New to surface the sqlite sink's missing-driver error")
+	}
+}
+
+func TestRingSink_QueryFilteredPaginatesAndFilters(t *testing.T) {
+	sink := newRingSink(10)
+	now := time.Now().UTC()
+	sink.Write(Entry{Timestamp: now, ClientIP: "10.0.0.1", QName: "a.example.", Rcode: "NOERROR"})
+	sink.Write(Entry{Timestamp: now, ClientIP: "10.0.0.2", QName: "b.example.", Rcode: "NXDOMAIN"})
+	sink.Write(Entry{Timestamp: now, ClientIP: "10.0.0.1", QName: "c.example.", Rcode: "NOERROR"})
+
+	page, err := sink.QueryFiltered(Filter{Client: "10.0.0.1"}, "", 0)
+	if err != nil {
+		t.Fatalf("QueryFiltered returned error: %v", err)
+	}
+	if len(page.Entries) != 2 || page.Entries[0].QName != "a.example." || page.Entries[1].QName != "c.example." {
+		t.Errorf("expected the two 10.0.0.1 entries in order, got %+v", page.Entries)
+	}
+
+	firstPage, err := sink.QueryFiltered(Filter{}, "", 1)
+	if err != nil {
+		t.Fatalf("QueryFiltered returned error: %v", err)
+	}
+	if len(firstPage.Entries) != 1 || firstPage.Cursor == "" {
+		t.Fatalf("expected a single-entry page with a cursor, got %+v", firstPage)
+	}
+
+	nextPage, err := sink.QueryFiltered(Filter{}, firstPage.Cursor, 1)
+	if err != nil {
+		t.Fatalf("QueryFiltered returned error: %v", err)
+	}
+	if len(nextPage.Entries) != 1 || nextPage.Entries[0].QName != "b.example." {
+		t.Errorf("expected the cursor to resume after the first page, got %+v", nextPage.Entries)
+	}
+}
+
+func TestRingSink_OverwritesOldestOnceFull(t *testing.T) {
+	sink := newRingSink(2)
+	sink.Write(Entry{QName: "a."})
+	sink.Write(Entry{QName: "b."})
+	sink.Write(Entry{QName: "c."})
+
+	page, err := sink.QueryFiltered(Filter{}, "", 0)
+	if err != nil {
+		t.Fatalf("QueryFiltered returned error: %v", err)
+	}
+	if len(page.Entries) != 2 || page.Entries[0].QName != "b." || page.Entries[1].QName != "c." {
+		t.Errorf("expected [b. c.] after the ring dropped a., got %+v", page.Entries)
+	}
+}
+
+func TestJSONLSink_RotatesOnceMaxSizeIsExceeded(t *testing.T) {
+	dir := t.TempDir()
+	sink, err := newJSONLSink(dir, 1, time.Hour)
+	if err != nil {
+		t.Fatalf("newJSONLSink returned error: %v", err)
+	}
+	defer sink.Close()
+	sink.maxSize = 1 // force rotation on the very next write
+
+	if err := sink.Write(Entry{QName: "a.example."}); err != nil {
+		t.Fatalf("Write returned error: %v", err)
+	}
+	if err := sink.Write(Entry{QName: "b.example."}); err != nil {
+		t.Fatalf("Write returned error: %v", err)
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("ReadDir returned error: %v", err)
+	}
+	rotated := 0
+	for _, e := range entries {
+		if filepath.Ext(e.Name()) == ".gz" {
+			rotated++
+		}
+	}
+	if rotated == 0 {
+		t.Errorf("expected at least one rotated .gz file under %s, got %v", dir, entries)
+	}
+}
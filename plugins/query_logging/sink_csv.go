@@ -0,0 +1,254 @@
+package query_logging
+
+import (
+	"encoding/csv"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// csvDateLayout names both the per-day filename suffix and the timestamp
+// format stored in the csv's "ts" column, so sorting filenames and
+// comparing parsed rows both work lexically/chronologically together.
+const csvDateLayout = "20060102"
+
+// csvHeader is written once to a freshly created day's file.
+var csvHeader = []string{"ts", "client_ip", "qname", "qtype", "rcode", "answer_count", "duration_ms", "upstream", "cache_status", "dnssec_ad"}
+
+// csvSink appends one row per entry to a file named
+// "query-log-<YYYYMMDD>.csv" under dir, rolling over to a new file at UTC
+// midnight and pruning files older than retentionDays on every rollover.
+type csvSink struct {
+	mu            sync.Mutex
+	dir           string
+	retentionDays int
+
+	day string // YYYYMMDD of the currently open file
+	f   *os.File
+	w   *csv.Writer
+}
+
+func newCSVSink(dir string, retentionDays int) (*csvSink, error) {
+	if dir == "" {
+		return nil, fmt.Errorf("query_logging: QueryLoggingDir must be set for the csv sink")
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("query_logging: creating %s: %w", dir, err)
+	}
+
+	s := &csvSink{dir: dir, retentionDays: retentionDays}
+	if err := s.rollTo(time.Now().UTC()); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *csvSink) path(day string) string {
+	return filepath.Join(s.dir, fmt.Sprintf("query-log-%s.csv", day))
+}
+
+// rollTo closes the currently open file (if any) and opens/creates the one
+// for now's day, writing the header row only if the file is new.
+func (s *csvSink) rollTo(now time.Time) error {
+	if s.f != nil {
+		s.w.Flush()
+		s.f.Close()
+	}
+
+	day := now.Format(csvDateLayout)
+	path := s.path(day)
+	_, statErr := os.Stat(path)
+	fresh := statErr != nil
+
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("query_logging: opening %s: %w", path, err)
+	}
+	w := csv.NewWriter(f)
+	if fresh {
+		if err := w.Write(csvHeader); err != nil {
+			f.Close()
+			return fmt.Errorf("query_logging: writing header to %s: %w", path, err)
+		}
+		w.Flush()
+	}
+
+	s.f = f
+	s.w = w
+	s.day = day
+	s.pruneOld(now)
+	return nil
+}
+
+func (s *csvSink) Write(e Entry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now().UTC()
+	if day := now.Format(csvDateLayout); day != s.day {
+		if err := s.rollTo(now); err != nil {
+			return err
+		}
+	}
+
+	row := []string{
+		e.Timestamp.UTC().Format(time.RFC3339Nano),
+		e.ClientIP,
+		e.QName,
+		e.QType,
+		e.Rcode,
+		strconv.Itoa(e.AnswerCount),
+		strconv.FormatFloat(e.DurationMs, 'f', -1, 64),
+		e.Upstream,
+		string(e.CacheStatus),
+		strconv.FormatBool(e.DNSSECAD),
+	}
+	if err := s.w.Write(row); err != nil {
+		return fmt.Errorf("query_logging: writing row to %s: %w", s.path(s.day), err)
+	}
+	s.w.Flush()
+	return s.w.Error()
+}
+
+// pruneOld removes any "query-log-*.csv" file in dir whose day is more than
+// retentionDays before now. A retentionDays of zero disables pruning.
+func (s *csvSink) pruneOld(now time.Time) {
+	if s.retentionDays <= 0 {
+		return
+	}
+	cutoff := now.AddDate(0, 0, -s.retentionDays)
+
+	paths, err := filepath.Glob(filepath.Join(s.dir, "query-log-*.csv"))
+	if err != nil {
+		return
+	}
+	for _, path := range paths {
+		day, ok := dayFromPath(path, "query-log-", ".csv")
+		if !ok {
+			continue
+		}
+		t, err := time.Parse(csvDateLayout, day)
+		if err != nil {
+			continue
+		}
+		if t.Before(cutoff) {
+			os.Remove(path)
+		}
+	}
+}
+
+func (s *csvSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.w.Flush()
+	return s.f.Close()
+}
+
+// Query scans every "query-log-*.csv" file in dir for rows whose timestamp
+// falls in [from, to], optionally filtered to qname.
+func (s *csvSink) Query(from, to time.Time, qname string) ([]Entry, error) {
+	s.mu.Lock()
+	s.w.Flush()
+	s.mu.Unlock()
+
+	paths, err := filepath.Glob(filepath.Join(s.dir, "query-log-*.csv"))
+	if err != nil {
+		return nil, fmt.Errorf("query_logging: listing %s: %w", s.dir, err)
+	}
+	sort.Strings(paths)
+
+	var out []Entry
+	for _, path := range paths {
+		entries, err := readCSVEntries(path)
+		if err != nil {
+			return nil, err
+		}
+		for _, e := range entries {
+			if e.Timestamp.Before(from) || e.Timestamp.After(to) {
+				continue
+			}
+			if qname != "" && e.QName != qname {
+				continue
+			}
+			out = append(out, e)
+		}
+	}
+	return out, nil
+}
+
+func readCSVEntries(path string) ([]Entry, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("query_logging: opening %s: %w", path, err)
+	}
+	defer f.Close()
+
+	rows, err := csv.NewReader(f).ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("query_logging: reading %s: %w", path, err)
+	}
+	if len(rows) <= 1 {
+		return nil, nil
+	}
+
+	out := make([]Entry, 0, len(rows)-1)
+	for _, row := range rows[1:] {
+		e, ok := entryFromCSVRow(row)
+		if !ok {
+			continue // skip a malformed row rather than failing the whole query
+		}
+		out = append(out, e)
+	}
+	return out, nil
+}
+
+func entryFromCSVRow(row []string) (Entry, bool) {
+	if len(row) != len(csvHeader) {
+		return Entry{}, false
+	}
+
+	ts, err := time.Parse(time.RFC3339Nano, row[0])
+	if err != nil {
+		return Entry{}, false
+	}
+	answerCount, err := strconv.Atoi(row[5])
+	if err != nil {
+		return Entry{}, false
+	}
+	durationMs, err := strconv.ParseFloat(row[6], 64)
+	if err != nil {
+		return Entry{}, false
+	}
+	dnssecAD, err := strconv.ParseBool(row[9])
+	if err != nil {
+		return Entry{}, false
+	}
+
+	return Entry{
+		Timestamp:   ts,
+		ClientIP:    row[1],
+		QName:       row[2],
+		QType:       row[3],
+		Rcode:       row[4],
+		AnswerCount: answerCount,
+		DurationMs:  durationMs,
+		Upstream:    row[7],
+		CacheStatus: CacheStatus(row[8]),
+		DNSSECAD:    dnssecAD,
+	}, true
+}
+
+// dayFromPath extracts the YYYYMMDD component from a "<prefix><day><suffix>"
+// filename, e.g. dayFromPath("query-log-20260101.csv", "query-log-", ".csv").
+func dayFromPath(path, prefix, suffix string) (string, bool) {
+	base := filepath.Base(path)
+	if !strings.HasPrefix(base, prefix) || !strings.HasSuffix(base, suffix) {
+		return "", false
+	}
+	return strings.TrimSuffix(strings.TrimPrefix(base, prefix), suffix), true
+}
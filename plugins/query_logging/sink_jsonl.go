@@ -0,0 +1,148 @@
+package query_logging
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// defaultJSONLMaxSizeMB and defaultJSONLMaxAge are used when the
+// corresponding Config field is zero.
+const (
+	defaultJSONLMaxSizeMB = 100
+	defaultJSONLMaxAge    = 24 * time.Hour
+)
+
+// jsonlSink appends one NDJSON line per entry to "query-log.ndjson" under
+// dir, rotating to a gzip-compressed "query-log-<unix-nano>.ndjson.gz" once
+// the current file exceeds maxSizeMB or has been open longer than maxAge.
+type jsonlSink struct {
+	mu       sync.Mutex
+	dir      string
+	maxSize  int64
+	maxAge   time.Duration
+	openedAt time.Time
+	written  int64
+	f        *os.File
+	enc      *json.Encoder
+}
+
+func newJSONLSink(dir string, maxSizeMB int, maxAge time.Duration) (*jsonlSink, error) {
+	if dir == "" {
+		return nil, fmt.Errorf("query_logging: QueryLoggingDir must be set for the jsonl sink")
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("query_logging: creating %s: %w", dir, err)
+	}
+	if maxSizeMB <= 0 {
+		maxSizeMB = defaultJSONLMaxSizeMB
+	}
+	if maxAge <= 0 {
+		maxAge = defaultJSONLMaxAge
+	}
+
+	s := &jsonlSink{dir: dir, maxSize: int64(maxSizeMB) * 1024 * 1024, maxAge: maxAge}
+	if err := s.open(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *jsonlSink) path() string {
+	return filepath.Join(s.dir, "query-log.ndjson")
+}
+
+func (s *jsonlSink) open() error {
+	f, err := os.OpenFile(s.path(), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("query_logging: opening %s: %w", s.path(), err)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return fmt.Errorf("query_logging: statting %s: %w", s.path(), err)
+	}
+
+	s.f = f
+	s.enc = json.NewEncoder(f)
+	s.openedAt = time.Now()
+	s.written = info.Size()
+	return nil
+}
+
+func (s *jsonlSink) Write(e Entry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.written >= s.maxSize || time.Since(s.openedAt) >= s.maxAge {
+		if err := s.rotate(); err != nil {
+			return err
+		}
+	}
+
+	before := s.written
+	if err := s.enc.Encode(e); err != nil {
+		return fmt.Errorf("query_logging: writing to %s: %w", s.path(), err)
+	}
+	info, err := s.f.Stat()
+	if err != nil {
+		// Size tracking falls behind, but the write itself already
+		// succeeded; estimate instead of failing the call over it.
+		s.written = before + 1
+		return nil
+	}
+	s.written = info.Size()
+	return nil
+}
+
+// rotate closes the current file, gzips it aside under a timestamped name,
+// and opens a fresh "query-log.ndjson".
+func (s *jsonlSink) rotate() error {
+	if s.f == nil {
+		return s.open()
+	}
+	if err := s.f.Close(); err != nil {
+		return fmt.Errorf("query_logging: closing %s before rotation: %w", s.path(), err)
+	}
+
+	rotatedPath := filepath.Join(s.dir, fmt.Sprintf("query-log-%d.ndjson.gz", time.Now().UnixNano()))
+	if err := gzipFile(s.path(), rotatedPath); err != nil {
+		return err
+	}
+	if err := os.Remove(s.path()); err != nil {
+		return fmt.Errorf("query_logging: removing %s after rotation: %w", s.path(), err)
+	}
+	return s.open()
+}
+
+func gzipFile(srcPath, dstPath string) error {
+	src, err := os.Open(srcPath)
+	if err != nil {
+		return fmt.Errorf("query_logging: opening %s to rotate: %w", srcPath, err)
+	}
+	defer src.Close()
+
+	dst, err := os.OpenFile(dstPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return fmt.Errorf("query_logging: creating %s: %w", dstPath, err)
+	}
+	defer dst.Close()
+
+	gw := gzip.NewWriter(dst)
+	if _, err := io.Copy(gw, src); err != nil {
+		gw.Close()
+		return fmt.Errorf("query_logging: compressing %s: %w", dstPath, err)
+	}
+	return gw.Close()
+}
+
+func (s *jsonlSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.f.Close()
+}
@@ -0,0 +1,126 @@
+package query_logging
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// defaultRingCapacity is used when Config.QueryLoggingRingCapacity is zero.
+const defaultRingCapacity = 10000
+
+// ringSink keeps the last capacity entries in memory, queryable by the
+// dashboard's /api/v1/query-log handler with filters a durable sink can't
+// offer as cheaply (client, QNAME regex, rcode) plus cursor pagination.
+// Nothing is persisted across a restart.
+type ringSink struct {
+	mu       sync.Mutex
+	entries  []Entry // ring buffer, oldest first once full
+	next     int     // write index into entries once it has filled
+	full     bool
+	capacity int
+	seq      int64 // monotonically increasing id assigned to every Write, used as the cursor
+}
+
+func newRingSink(capacity int) *ringSink {
+	if capacity <= 0 {
+		capacity = defaultRingCapacity
+	}
+	return &ringSink{capacity: capacity}
+}
+
+func (s *ringSink) Write(e Entry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.seq++
+	e.seq = s.seq
+
+	if len(s.entries) < s.capacity {
+		s.entries = append(s.entries, e)
+		return nil
+	}
+	s.full = true
+	s.entries[s.next] = e
+	s.next = (s.next + 1) % s.capacity
+	return nil
+}
+
+func (s *ringSink) Close() error {
+	return nil
+}
+
+// ordered returns a copy of the buffer's entries oldest-first.
+func (s *ringSink) ordered() []Entry {
+	if !s.full {
+		out := make([]Entry, len(s.entries))
+		copy(out, s.entries)
+		return out
+	}
+	out := make([]Entry, 0, s.capacity)
+	out = append(out, s.entries[s.next:]...)
+	out = append(out, s.entries[:s.next]...)
+	return out
+}
+
+// QueryFiltered implements FilterableQueryable. cursor, if non-empty, is
+// the seq of the last entry returned by a previous call; only entries
+// after it are considered. A limit <= 0 uses 100.
+func (s *ringSink) QueryFiltered(f Filter, cursor string, limit int) (Page, error) {
+	if limit <= 0 {
+		limit = 100
+	}
+
+	var after int64
+	if cursor != "" {
+		parsed, err := strconv.ParseInt(cursor, 10, 64)
+		if err != nil {
+			return Page{}, fmt.Errorf("query_logging: invalid cursor %q: %w", cursor, err)
+		}
+		after = parsed
+	}
+
+	s.mu.Lock()
+	all := s.ordered()
+	s.mu.Unlock()
+
+	var matched []Entry
+	for _, e := range all {
+		if e.seq <= after {
+			continue
+		}
+		if !matchesFilter(e, f) {
+			continue
+		}
+		matched = append(matched, e)
+	}
+
+	page := Page{}
+	if len(matched) > limit {
+		page.Entries = matched[:limit]
+		page.Cursor = strconv.FormatInt(page.Entries[len(page.Entries)-1].seq, 10)
+	} else {
+		page.Entries = matched
+	}
+	return page, nil
+}
+
+func matchesFilter(e Entry, f Filter) bool {
+	if !f.From.IsZero() && e.Timestamp.Before(f.From) {
+		return false
+	}
+	if !f.To.IsZero() && e.Timestamp.After(f.To) {
+		return false
+	}
+	if f.Client != "" && !strings.EqualFold(e.ClientIP, f.Client) {
+		return false
+	}
+	if f.Rcode != "" && !strings.EqualFold(e.Rcode, f.Rcode) {
+		return false
+	}
+	if f.QNameRe != nil && !f.QNameRe.MatchString(e.QName) {
+		return false
+	}
+	return true
+}
@@ -0,0 +1,276 @@
+package query_logging
+
+// sqliteSink batches entries into a daily-sharded SQLite database, written
+// against database/sql alone so it works with whatever sqlite driver the
+// caller has registered (via that driver's own blank import) without this
+// package depending on one - the same approach authoritative.SQLProvider
+// takes for its SQL-backed zone storage.
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// sqliteBatchSize is the number of entries buffered per shard before a
+// pending transaction is flushed to disk.
+const sqliteBatchSize = 100
+
+const sqliteCreateTableSQL = `CREATE TABLE IF NOT EXISTS query_log (
+	ts TEXT NOT NULL,
+	client_ip TEXT NOT NULL,
+	qname TEXT NOT NULL,
+	qtype TEXT NOT NULL,
+	rcode TEXT NOT NULL,
+	answer_count INTEGER NOT NULL,
+	duration_ms REAL NOT NULL,
+	upstream TEXT NOT NULL,
+	cache_status TEXT NOT NULL,
+	dnssec_ad INTEGER NOT NULL
+)`
+
+// sqliteSink appends rows to a "query-log-<YYYYMMDD>.sqlite" file under dir,
+// rolling over to a new shard at UTC midnight and pruning shards older than
+// retentionDays on every rollover. Writes are batched into a transaction of
+// up to sqliteBatchSize entries, committed when the batch fills, the shard
+// rolls over, or the sink is closed.
+type sqliteSink struct {
+	mu            sync.Mutex
+	dir           string
+	driver        string
+	retentionDays int
+
+	day     string // YYYYMMDD of the currently open shard
+	db      *sql.DB
+	tx      *sql.Tx
+	stmt    *sql.Stmt
+	pending int
+}
+
+func newSQLiteSink(dir, driver string, retentionDays int) (*sqliteSink, error) {
+	if dir == "" {
+		return nil, fmt.Errorf("query_logging: QueryLoggingDir must be set for the sqlite sink")
+	}
+	if driver == "" {
+		return nil, fmt.Errorf("query_logging: QueryLoggingSQLiteDriver must name a registered database/sql driver for the sqlite sink")
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("query_logging: creating %s: %w", dir, err)
+	}
+
+	s := &sqliteSink{dir: dir, driver: driver, retentionDays: retentionDays}
+	if err := s.rollTo(time.Now().UTC()); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *sqliteSink) path(day string) string {
+	return filepath.Join(s.dir, fmt.Sprintf("query-log-%s.sqlite", day))
+}
+
+// rollTo flushes and closes the currently open shard (if any) and opens the
+// one for now's day, creating its table if it doesn't already exist.
+func (s *sqliteSink) rollTo(now time.Time) error {
+	if err := s.flush(); err != nil {
+		return err
+	}
+	if s.db != nil {
+		s.db.Close()
+	}
+
+	day := now.Format(csvDateLayout)
+	path := s.path(day)
+	db, err := sql.Open(s.driver, path)
+	if err != nil {
+		return fmt.Errorf("query_logging: opening %s: %w", path, err)
+	}
+	if _, err := db.Exec(sqliteCreateTableSQL); err != nil {
+		db.Close()
+		return fmt.Errorf("query_logging: creating table in %s: %w", path, err)
+	}
+
+	s.db = db
+	s.day = day
+	s.pruneOld(now)
+	return nil
+}
+
+// beginBatch opens a fresh transaction and prepared insert statement,
+// committed (and closed) by flush.
+func (s *sqliteSink) beginBatch() error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("query_logging: beginning batch in %s: %w", s.path(s.day), err)
+	}
+	stmt, err := tx.Prepare(`INSERT INTO query_log
+		(ts, client_ip, qname, qtype, rcode, answer_count, duration_ms, upstream, cache_status, dnssec_ad)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`)
+	if err != nil {
+		tx.Rollback()
+		return fmt.Errorf("query_logging: preparing insert in %s: %w", s.path(s.day), err)
+	}
+
+	s.tx = tx
+	s.stmt = stmt
+	s.pending = 0
+	return nil
+}
+
+// flush commits and releases any pending batch. It's a no-op if no batch is
+// open.
+func (s *sqliteSink) flush() error {
+	if s.tx == nil {
+		return nil
+	}
+	s.stmt.Close()
+	tx := s.tx
+	s.tx, s.stmt, s.pending = nil, nil, 0
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("query_logging: committing batch in %s: %w", s.path(s.day), err)
+	}
+	return nil
+}
+
+func (s *sqliteSink) Write(e Entry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now().UTC()
+	if day := now.Format(csvDateLayout); day != s.day {
+		if err := s.rollTo(now); err != nil {
+			return err
+		}
+	}
+
+	if s.tx == nil {
+		if err := s.beginBatch(); err != nil {
+			return err
+		}
+	}
+
+	_, err := s.stmt.Exec(
+		e.Timestamp.UTC().Format(time.RFC3339Nano),
+		e.ClientIP,
+		e.QName,
+		e.QType,
+		e.Rcode,
+		e.AnswerCount,
+		e.DurationMs,
+		e.Upstream,
+		string(e.CacheStatus),
+		e.DNSSECAD,
+	)
+	if err != nil {
+		return fmt.Errorf("query_logging: inserting row into %s: %w", s.path(s.day), err)
+	}
+
+	s.pending++
+	if s.pending >= sqliteBatchSize {
+		return s.flush()
+	}
+	return nil
+}
+
+// pruneOld removes any "query-log-*.sqlite" shard in dir whose day is more
+// than retentionDays before now. A retentionDays of zero disables pruning.
+func (s *sqliteSink) pruneOld(now time.Time) {
+	if s.retentionDays <= 0 {
+		return
+	}
+	cutoff := now.AddDate(0, 0, -s.retentionDays)
+
+	paths, err := filepath.Glob(filepath.Join(s.dir, "query-log-*.sqlite"))
+	if err != nil {
+		return
+	}
+	for _, path := range paths {
+		day, ok := dayFromPath(path, "query-log-", ".sqlite")
+		if !ok {
+			continue
+		}
+		t, err := time.Parse(csvDateLayout, day)
+		if err != nil {
+			continue
+		}
+		if t.Before(cutoff) {
+			os.Remove(path)
+		}
+	}
+}
+
+func (s *sqliteSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.flush(); err != nil {
+		return err
+	}
+	return s.db.Close()
+}
+
+// Query pages back through every "query-log-*.sqlite" shard in dir for rows
+// whose timestamp falls in [from, to], optionally filtered to qname.
+func (s *sqliteSink) Query(from, to time.Time, qname string) ([]Entry, error) {
+	s.mu.Lock()
+	flushErr := s.flush()
+	s.mu.Unlock()
+	if flushErr != nil {
+		return nil, flushErr
+	}
+
+	paths, err := filepath.Glob(filepath.Join(s.dir, "query-log-*.sqlite"))
+	if err != nil {
+		return nil, fmt.Errorf("query_logging: listing %s: %w", s.dir, err)
+	}
+
+	var out []Entry
+	for _, path := range paths {
+		entries, err := s.queryShard(path, from, to, qname)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, entries...)
+	}
+	return out, nil
+}
+
+func (s *sqliteSink) queryShard(path string, from, to time.Time, qname string) ([]Entry, error) {
+	db, err := sql.Open(s.driver, path)
+	if err != nil {
+		return nil, fmt.Errorf("query_logging: opening %s: %w", path, err)
+	}
+	defer db.Close()
+
+	query := `SELECT ts, client_ip, qname, qtype, rcode, answer_count, duration_ms, upstream, cache_status, dnssec_ad
+		FROM query_log WHERE ts >= ? AND ts <= ?`
+	args := []any{from.UTC().Format(time.RFC3339Nano), to.UTC().Format(time.RFC3339Nano)}
+	if qname != "" {
+		query += " AND qname = ?"
+		args = append(args, qname)
+	}
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("query_logging: querying %s: %w", path, err)
+	}
+	defer rows.Close()
+
+	var out []Entry
+	for rows.Next() {
+		var e Entry
+		var ts, cacheStatus string
+		if err := rows.Scan(&ts, &e.ClientIP, &e.QName, &e.QType, &e.Rcode, &e.AnswerCount, &e.DurationMs, &e.Upstream, &cacheStatus, &e.DNSSECAD); err != nil {
+			return nil, fmt.Errorf("query_logging: scanning row from %s: %w", path, err)
+		}
+		e.Timestamp, err = time.Parse(time.RFC3339Nano, ts)
+		if err != nil {
+			continue
+		}
+		e.CacheStatus = CacheStatus(cacheStatus)
+		out = append(out, e)
+	}
+	return out, rows.Err()
+}
@@ -0,0 +1,29 @@
+package query_logging
+
+import (
+	"encoding/json"
+	"os"
+	"sync"
+)
+
+// stdoutSink writes every entry to os.Stdout as a newline-delimited JSON
+// object. It keeps no history, so it doesn't implement Queryable.
+type stdoutSink struct {
+	mu sync.Mutex
+}
+
+func newStdoutSink() *stdoutSink { return &stdoutSink{} }
+
+func (s *stdoutSink) Write(e Entry) error {
+	line, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, err = os.Stdout.Write(append(line, '\n'))
+	return err
+}
+
+func (s *stdoutSink) Close() error { return nil }
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"fmt"
 	"hash/fnv"
 	"sync"
 	"time"
@@ -8,6 +9,23 @@ import (
 	"github.com/miekg/dns"
 )
 
+// CacheKey identifies a cached response by its question plus the DO
+// (DNSSEC OK) and CD (Checking Disabled) EDNS bits, so that a CD=1
+// response (which may have skipped or failed DNSSEC validation) is never
+// handed back to a CD=0 query, or vice versa.
+type CacheKey struct {
+	Qname  string
+	Qtype  uint16
+	Qclass uint16
+	DO     bool
+	CD     bool
+}
+
+// String renders k as the opaque string ShardedCache actually indexes on.
+func (k CacheKey) String() string {
+	return fmt.Sprintf("%s:%d:%d:do=%t:cd=%t", k.Qname, k.Qtype, k.Qclass, k.DO, k.CD)
+}
+
 // CacheEntry represents a single entry in the cache.
 type CacheEntry struct {
 	Msg             *dns.Msg
@@ -16,6 +34,15 @@ type CacheEntry struct {
 	DNSSECValidated bool
 }
 
+// maxStaleTTL is how long past Expiry (RFC 8767 "stale-until") an entry is
+// still kept around and returned by Get as a stale hit instead of a miss.
+const maxStaleTTL = 24 * time.Hour
+
+// staleAnswerTTL is the TTL CachingResolver stamps onto a response
+// synthesized from a stale entry, so whatever's downstream of it re-checks
+// with us again soon.
+const staleAnswerTTL = 30 * time.Second
+
 // Shard is a part of the ShardedCache, protected by a mutex.
 type Shard struct {
 	entries    map[string]CacheEntry
@@ -56,24 +83,36 @@ func NewShardedCache(numShards int, cleanupInterval time.Duration) *ShardedCache
 	return cache
 }
 
-// Get retrieves a DNS message from the cache.
-func (c *ShardedCache) Get(key string) (*dns.Msg, bool, bool, bool) {
-	shard := c.getShard(key)
+// Get retrieves a DNS message from the cache. The final return value
+// distinguishes a fresh hit (found=true) from a stale one (stale=true, entry
+// expired but still within maxStaleTTL of expiry); the two are never both
+// true.
+func (c *ShardedCache) Get(key CacheKey) (msg *dns.Msg, found bool, isNegative bool, dnssecValidated bool, stale bool) {
+	k := key.String()
+	shard := c.getShard(k)
 	shard.mu.RLock()
 	defer shard.mu.RUnlock()
 
-	entry, found := shard.entries[key]
+	entry, ok := shard.entries[k]
+	if !ok {
+		return nil, false, false, false, false
+	}
 
-	if !found || time.Now().After(entry.Expiry) {
-		return nil, false, false, false
+	now := time.Now()
+	if now.After(entry.Expiry) {
+		if now.After(entry.Expiry.Add(maxStaleTTL)) {
+			return nil, false, false, false, false
+		}
+		return entry.Msg, false, entry.IsNegative, entry.DNSSECValidated, true
 	}
 
-	return entry.Msg, true, entry.IsNegative, entry.DNSSECValidated
+	return entry.Msg, true, entry.IsNegative, entry.DNSSECValidated, false
 }
 
 // Set adds a DNS message to the cache.
-func (c *ShardedCache) Set(key string, msg *dns.Msg, ttl time.Duration, isNegative bool, dnssecValidated bool) {
-	shard := c.getShard(key)
+func (c *ShardedCache) Set(key CacheKey, msg *dns.Msg, ttl time.Duration, isNegative bool, dnssecValidated bool) {
+	k := key.String()
+	shard := c.getShard(k)
 	shard.mu.Lock()
 	defer shard.mu.Unlock()
 
@@ -85,7 +124,7 @@ func (c *ShardedCache) Set(key string, msg *dns.Msg, ttl time.Duration, isNegati
 		return
 	}
 
-	shard.entries[key] = CacheEntry{
+	shard.entries[k] = CacheEntry{
 		Msg:             msg,
 		Expiry:          time.Now().Add(ttl),
 		IsNegative:      isNegative,
@@ -123,7 +162,7 @@ func (s *Shard) cleanup(interval time.Duration, stop <-chan struct{}) {
 			s.mu.Lock()
 			now := time.Now()
 			for key, entry := range s.entries {
-				if now.After(entry.Expiry) {
+				if now.After(entry.Expiry.Add(maxStaleTTL)) {
 					delete(s.entries, key)
 				}
 			}